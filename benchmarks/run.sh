@@ -0,0 +1,17 @@
+#!/bin/sh
+# Runs the benchmark suite and saves the results under benchmarks/results, named after the
+# current commit. When benchstat is installed the results are compared with the baseline.
+#
+# Usage: benchmarks/run.sh [name]
+# Set TP_BENCH_ADDRESS (and TP_BENCH_USERNAME, TP_BENCH_PASSWORD) to include the insert benchmarks.
+set -e
+
+cd "$(dirname "$0")/.."
+name=${1:-$(git rev-parse --short HEAD)}
+out=benchmarks/results/$name.txt
+
+go test -run '^$' -bench . -benchmem -count "${COUNT:-5}" ./pkg/timeplus ./pkg/services | tee "$out"
+
+if command -v benchstat >/dev/null 2>&1 && [ "$out" != benchmarks/results/baseline.txt ]; then
+	benchstat benchmarks/results/baseline.txt "$out"
+fi
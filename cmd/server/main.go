@@ -10,6 +10,7 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Timezones for server.timezone on hosts without a zoneinfo database
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -17,9 +18,15 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 
 	"github.com/timeplus-io/tp-alert-gateway/pkg/api"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/archive"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/federation"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/ui"
 )
 
 // @title Timeplus Alert Gateway API
@@ -50,6 +57,8 @@ func main() {
 
 	// Parse command line flags
 	configPath := flag.String("config", "", "path to config file")
+	demo := flag.Bool("demo", false, "Create a demo stream and sample rules, and fill the stream with generated readings")
+	rebuildStreams := flag.Bool("rebuild-streams", false, "Rebuild system streams whose schema can't be migrated with ALTER STREAM, copying their data into the new stream")
 	flag.Parse()
 
 	// Load configuration
@@ -58,6 +67,40 @@ func main() {
 		logrus.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Timestamps are stored in UTC; the server timezone is only used to show them
+	displayTimezone, err := services.LoadDisplayTimezone(cfg.Server.Timezone)
+	if err != nil {
+		logrus.Fatalf("Invalid server timezone %q: %v", cfg.Server.Timezone, err)
+	}
+	services.SetDisplayTimezone(displayTimezone)
+
+	// Namespace the system streams of the environment before any stream is set up or queried
+	if err := timeplus.SetEnvironment(cfg.Environment); err != nil {
+		logrus.Fatalf("Invalid environment: %v", err)
+	}
+	if cfg.Environment != "" {
+		logrus.Infof("Using environment %s, system streams and generated objects are prefixed with %q",
+			cfg.Environment, timeplus.EnvironmentPrefix())
+	}
+
+	// Partition the shared alert acks stream before any stream is set up or queried
+	timeplus.SetAlertAcksPartitions(cfg.Timeplus.AlertAcksPartitions)
+
+	// Bound the triggering rows captured with alerts of rules started from now on
+	timeplus.SetPayloadLimits(timeplus.PayloadLimits{MaxBytes: cfg.Rules.Payload.MaxBytes, KeepKeys: cfg.Rules.Payload.KeepKeys})
+
+	// Encrypt the alert data of rules with encryptData at rest
+	encryptionKey, err := cfg.Encryption.LoadKey()
+	if err != nil {
+		logrus.Fatalf("Failed to load encryption key: %v", err)
+	}
+	if err := timeplus.SetPayloadKey(encryptionKey); err != nil {
+		logrus.Fatalf("Invalid encryption key: %v", err)
+	}
+
+	// Only drop and rebuild live system streams when explicitly asked to
+	timeplus.SetStreamRebuild(*rebuildStreams)
+
 	// Set up the Timeplus client
 	tpClient, err := timeplus.NewClient(&cfg.Timeplus)
 	if err != nil {
@@ -70,44 +113,415 @@ func main() {
 		logrus.Warnf("Failed to set up streams: %v", err)
 	}
 
+	// Fail fast while Timeplus keeps failing, rather than each request waiting out retries
+	var client timeplus.TimeplusClient = tpClient
+	if breaker := cfg.Timeplus.CircuitBreaker; breaker.FailureThreshold > 0 {
+		client = timeplus.NewBreakerClient(tpClient, timeplus.BreakerOptions{
+			FailureThreshold: breaker.FailureThreshold,
+			OpenDuration:     time.Duration(breaker.OpenSeconds) * time.Second,
+		})
+	}
+
+	// Rules with encryptData stage their alerts for the gateway to encrypt, so the key never appears in SQL
+	var payloadEncryptor *services.PayloadEncryptor
+	if len(encryptionKey) > 0 {
+		payloadEncryptor = services.NewPayloadEncryptor(client)
+		if err := payloadEncryptor.Start(ctx); err != nil {
+			logrus.Fatalf("Failed to start payload encryptor: %v", err)
+		}
+	}
+
 	// Initialize services
-	ruleService, err := services.NewRuleService(tpClient)
+	ruleService, err := services.NewRuleService(client)
 	if err != nil {
 		logrus.Fatalf("Failed to create rule service: %v", err)
 	}
 
-	// Define the alert stream name
-	const AlertStreamName = "tp_alerts"
+	// Set up the notification pipeline
+	var notifiers []notify.Notifier
+	webhooks := append([]config.WebhookConfig{}, cfg.Notifications.Webhooks...)
+	for _, url := range cfg.Notifications.WebhookURLs {
+		webhooks = append(webhooks, config.WebhookConfig{URL: url})
+	}
+	for _, webhook := range webhooks {
+		if webhook.Locale != "" {
+			if err := i18n.Validate(webhook.Locale); err != nil {
+				logrus.Fatalf("Invalid webhook locale: %v", err)
+			}
+		}
+		webhookNotifier, err := notify.NewWebhookNotifierWithOptions(webhook.URL, notify.WebhookOptions{
+			Secret:   webhook.Secret,
+			CertFile: webhook.TLS.CertFile,
+			KeyFile:  webhook.TLS.KeyFile,
+			CAFile:   webhook.TLS.CAFile,
+			Proxy:    notify.ResolveProxy(webhook.Proxy, cfg.Notifications.Proxy),
+			Locale:   webhook.Locale,
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to set up webhook notifier: %v", err)
+		}
+		notifiers = append(notifiers, webhookNotifier)
+	}
+	var slackNotifier *notify.SlackNotifier
+	if slack := cfg.Notifications.Slack; slack.WebhookURL != "" {
+		slackNotifier = notify.NewSlackNotifier(slack.WebhookURL, slack.Channel, slack.RouteToOwner, slack.TeamChannelPrefix)
+		if err := slackNotifier.SetProxy(notify.ResolveProxy(slack.Proxy, cfg.Notifications.Proxy)); err != nil {
+			logrus.Fatalf("Failed to set up Slack notifier: %v", err)
+		}
+		locales := []string{slack.Locale}
+		for _, locale := range slack.ChannelLocales {
+			locales = append(locales, locale)
+		}
+		for _, locale := range locales {
+			if locale == "" {
+				continue
+			}
+			if err := i18n.Validate(locale); err != nil {
+				logrus.Fatalf("Invalid Slack locale: %v", err)
+			}
+		}
+		slackNotifier.SetLocales(slack.Locale, slack.ChannelLocales)
+		if slack.Interactive {
+			if slack.SigningSecret == "" {
+				logrus.Fatalf("Interactive Slack messages require notifications.slack.signingSecret")
+			}
+			slackNotifier.SetInteractive(true)
+		}
+		notifiers = append(notifiers, slackNotifier)
+	}
+	var actionLinks *notify.ActionLinks
+	if email := cfg.Notifications.Email; email.SMTPHost != "" {
+		if email.Locale != "" {
+			if err := i18n.Validate(email.Locale); err != nil {
+				logrus.Fatalf("Invalid email locale: %v", err)
+			}
+		}
+		emailNotifier, err := notify.NewEmailNotifier(notify.EmailOptions{
+			Host:     email.SMTPHost,
+			Port:     email.SMTPPort,
+			Username: email.Username,
+			Password: email.Password,
+			From:     email.From,
+			To:       email.To,
+			Locale:   email.Locale,
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to set up email notifier: %v", err)
+		}
+		if links := email.ActionLinks; links.BaseURL != "" {
+			actionLinks, err = notify.NewActionLinks(links.BaseURL, links.Secret, time.Duration(links.TTLMinutes)*time.Minute)
+			if err != nil {
+				logrus.Fatalf("Invalid email action links: %v", err)
+			}
+			emailNotifier.SetActionLinks(actionLinks)
+		}
+		notifiers = append(notifiers, emailNotifier)
+	}
+	if push := cfg.Notifications.Push; push.Enabled {
+		if push.Locale != "" {
+			if err := i18n.Validate(push.Locale); err != nil {
+				logrus.Fatalf("Invalid push locale: %v", err)
+			}
+		}
+		if err := ruleService.EnablePushDevices(ctx); err != nil {
+			logrus.Fatalf("Failed to enable push devices: %v", err)
+		}
+		proxy := notify.ResolveProxy(push.Proxy, cfg.Notifications.Proxy)
+		pushNotifier := notify.NewPushNotifier(ruleService.PushDevices(), push.Severities, push.Locale)
+		if push.FCM.CredentialsFile != "" {
+			fcmSender, err := notify.NewFCMSender(push.FCM.CredentialsFile, proxy)
+			if err != nil {
+				logrus.Fatalf("Failed to set up FCM: %v", err)
+			}
+			pushNotifier.SetSender(models.PushPlatformFCM, fcmSender)
+		}
+		if push.APNs.KeyFile != "" {
+			apnsSender, err := notify.NewAPNsSender(notify.APNsOptions{
+				KeyFile: push.APNs.KeyFile,
+				KeyID:   push.APNs.KeyID,
+				TeamID:  push.APNs.TeamID,
+				Topic:   push.APNs.Topic,
+				Sandbox: push.APNs.Sandbox,
+				Proxy:   proxy,
+			})
+			if err != nil {
+				logrus.Fatalf("Failed to set up APNs: %v", err)
+			}
+			pushNotifier.SetSender(models.PushPlatformAPNs, apnsSender)
+		}
+		notifiers = append(notifiers, pushNotifier)
+	}
+	var twilioNotifier *notify.TwilioNotifier
+	var notificationLog *notify.NotificationLog
+	if twilio := cfg.Notifications.Twilio; twilio.AccountSID != "" {
+		if twilio.Locale != "" {
+			if err := i18n.Validate(twilio.Locale); err != nil {
+				logrus.Fatalf("Invalid Twilio locale: %v", err)
+			}
+		}
+		recipients := make([]notify.TwilioRecipient, len(twilio.Recipients))
+		for i, recipient := range twilio.Recipients {
+			recipients[i] = notify.TwilioRecipient{Name: recipient.Name, Phone: recipient.Phone}
+			if quiet := recipient.QuietHours; quiet != nil {
+				recipients[i].QuietHours = &notify.QuietHours{Start: quiet.Start, End: quiet.End, Timezone: quiet.Timezone}
+			}
+		}
+		twilioNotifier, err = notify.NewTwilioNotifier(notify.TwilioOptions{
+			AccountSID: twilio.AccountSID,
+			AuthToken:  twilio.AuthToken,
+			From:       twilio.From,
+			Recipients: recipients,
+			Severities: twilio.Severities,
+			CallEvents: twilio.CallEvents,
+			MaxPerHour: twilio.MaxPerHour,
+			BaseURL:    twilio.BaseURL,
+			Locale:     twilio.Locale,
+			Proxy:      notify.ResolveProxy(twilio.Proxy, cfg.Notifications.Proxy),
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to set up Twilio notifier: %v", err)
+		}
+		if notificationLog, err = notify.NewNotificationLog(ctx, client); err != nil {
+			logrus.Warnf("Twilio deliveries won't be recorded: %v", err)
+		} else {
+			twilioNotifier.SetNotificationLog(notificationLog)
+		}
+		notifiers = append(notifiers, twilioNotifier)
+	}
+	if cfg.Notifications.KafkaTopic != "" {
+		kafkaNotifier, err := notify.NewKafkaNotifier(ctx, client, cfg.Notifications.KafkaBrokers, cfg.Notifications.KafkaTopic)
+		if err != nil {
+			logrus.Warnf("Failed to set up Kafka notifier: %v", err)
+		} else {
+			notifiers = append(notifiers, kafkaNotifier)
+		}
+	}
+	// Live alert feed the dashboard follows
+	var feed *notify.Feed
+	if cfg.UI.Enabled {
+		feed = notify.NewFeed(0)
+		notifiers = append(notifiers, feed)
+	}
+	if len(notifiers) > 0 {
+		dispatcher := notify.NewDispatcher(cfg.Notifications.QueueSize, cfg.Notifications.Workers, notifiers...)
+		ruleService.SetNotificationDispatcher(dispatcher)
+		logrus.Infof("Notification pipeline started with %d notifier(s)", len(notifiers))
+
+		// Record alerts until they are delivered, so restarts neither lose nor repeat them
+		if cfg.Notifications.Outbox.Enabled {
+			outbox := services.NewNotificationOutbox(client, dispatcher, cfg.Notifications.Outbox.MaxAttempts,
+				time.Duration(cfg.Notifications.Outbox.PollSeconds)*time.Second)
+			outbox.SetMaxBackoff(time.Duration(cfg.Notifications.Outbox.MaxBackoffSeconds) * time.Second)
+			outbox.SetRetention(time.Duration(cfg.Notifications.Outbox.RetentionHours) * time.Hour)
+			if err := outbox.Start(ctx); err != nil {
+				logrus.Fatalf("Failed to start notification outbox: %v", err)
+			}
+			ruleService.SetNotificationOutbox(outbox)
+			logrus.Info("Notification outbox started")
+		}
+	}
+
+	// Columns picked as the entity ID of rules that don't name one
+	ruleService.SetEntityIDPriority(cfg.Rules.EntityIDPriority)
+
+	// Names of the Timeplus objects generated for new rules, within the environment's namespace
+	objectNaming := services.ObjectNaming{Prefix: timeplus.EnvironmentPrefix() + cfg.Rules.ObjectPrefix, Suffix: cfg.Rules.ObjectSuffix}
+	if err := ruleService.SetObjectNaming(objectNaming); err != nil {
+		logrus.Fatalf("Invalid rule object naming: %v", err)
+	}
+
+	// Whether rules with cross joins may run
+	ruleService.SetAllowExpensiveQueries(cfg.Rules.AllowExpensiveQueries)
+
+	// Time allowed to create each rule's streams and views as it starts
+	ruleService.SetRuleStartTimeout(time.Duration(cfg.Rules.StartTimeout) * time.Second)
+
+	// Services the built-in enrichment hooks of rules call
+	ruleService.SetEnrichmentConfig(services.EnrichmentConfig{
+		GeoIPURL: cfg.Enrichment.GeoIPURL,
+		Timeout:  time.Duration(cfg.Enrichment.Timeout) * time.Second,
+	})
+
+	// Group notified alerts sharing labels into incidents, notified once each
+	if cfg.Incidents.Enabled {
+		if err := ruleService.EnableIncidents(ctx, services.IncidentConfig{
+			GroupBy:   cfg.Incidents.GroupBy,
+			Window:    time.Duration(cfg.Incidents.WindowMinutes) * time.Minute,
+			GroupWait: time.Duration(cfg.Incidents.GroupWaitSeconds) * time.Second,
+		}); err != nil {
+			logrus.Fatalf("Failed to enable incidents: %v", err)
+		}
+		logrus.Infof("Grouping alerts into incidents by %s", strings.Join(cfg.Incidents.GroupBy, ", "))
+	}
+
+	// Severities rules may use, lowest first
+	severityLevels, err := models.NewSeverityLevels(cfg.Severity.Levels)
+	if err != nil {
+		logrus.Fatalf("Invalid severity levels: %v", err)
+	}
+	ruleService.SetSeverityLevels(severityLevels)
+
+	// Alert response time targets
+	slaTargets := make(map[string]time.Duration, len(cfg.SLA.Targets))
+	for severity, minutes := range cfg.SLA.Targets {
+		if !severityLevels.Valid(models.RuleSeverity(strings.ToLower(severity))) {
+			logrus.Warnf("SLA target set for unknown severity %q", severity)
+		}
+		slaTargets[severity] = time.Duration(minutes) * time.Minute
+	}
+	ruleService.SetSLATargets(slaTargets)
+
+	// Start the rules that were running, now that the rule settings are applied
+	if err := ruleService.ResumeRunningRules(ctx); err != nil {
+		logrus.Warnf("Error resuming running rules: %v", err)
+	}
+
+	if cfg.SLA.EscalateOnBreach && len(slaTargets) > 0 {
+		ruleService.StartSLAEscalation(time.Duration(cfg.SLA.CheckInterval) * time.Second)
+		logrus.Infof("SLA escalation enabled for %d severity level(s)", len(slaTargets))
+	}
+
+	// Recreate views of running rules that go missing while the gateway runs
+	if cfg.Health.CheckInterval > 0 {
+		ruleService.StartHealthMonitor(time.Duration(cfg.Health.CheckInterval) * time.Second)
+		logrus.Infof("Health monitor checking every %ds", cfg.Health.CheckInterval)
+	}
+
+	// Review each rule's firing and acknowledgment history for tuning recommendations
+	ruleService.SetRecommendationWindow(time.Duration(cfg.Recommendations.WindowDays) * 24 * time.Hour)
+	if cfg.Recommendations.Interval > 0 {
+		ruleService.StartRecommendationAnalysis(time.Duration(cfg.Recommendations.Interval) * time.Second)
+	}
+
+	// Throttle rules firing more alerts than their quota allows
+	ruleService.SetAlertQuotas(services.AlertQuotas{
+		RulePerMinute:   int64(cfg.Quotas.MaxAlertsPerMinute),
+		TeamPerMinute:   int64(cfg.Quotas.MaxTeamAlertsPerMinute),
+		ThrottleMinutes: cfg.Quotas.ThrottleMinutes,
+	})
+	if cfg.Quotas.CheckInterval > 0 {
+		ruleService.StartQuotaGuard(time.Duration(cfg.Quotas.CheckInterval) * time.Second)
+	}
 
-	// Initialize the alert monitoring service
-	// This is now a simplified version without polling goroutines
-	alertMonitor := services.NewAlertMonitor(
-		ruleService,
-		AlertStreamName,
-		cfg.Timeplus.Address,
-		cfg.Timeplus.Username,
-		cfg.Timeplus.Password,
-		cfg.Timeplus.Workspace,
-		tpClient,
-		cfg.Timeplus.Address, // Use the same address for server address
-	)
+	// Alert on problems of the gateway itself through the same notification pipeline
+	ruleService.SetSelfAlertThresholds(services.SelfAlertThresholds{
+		Reconnects:              int64(cfg.SelfAlerts.MaxReconnects),
+		NotificationFailureRate: cfg.SelfAlerts.MaxNotificationFailureRate,
+		MinNotifications:        int64(cfg.SelfAlerts.MinNotifications),
+		AckBacklog:              int64(cfg.SelfAlerts.MaxAckBacklog),
+	})
+	if cfg.SelfAlerts.CheckInterval > 0 {
+		ruleService.StartSelfAlerts(time.Duration(cfg.SelfAlerts.CheckInterval) * time.Second)
+	}
 
-	// Start the alert monitor (only establishes connection, no polling)
+	// Write the gateway's counters to Timeplus, so rules can monitor the gateway itself
+	if cfg.GatewayMetrics.Enabled {
+		if err := ruleService.StartGatewayMetrics(ctx, time.Duration(cfg.GatewayMetrics.Interval)*time.Second); err != nil {
+			logrus.Warnf("Gateway metrics won't be written: %v", err)
+		}
+	}
+
+	// Push alerts to the notification pipeline as rules fire
+	alertMonitor := services.NewAlertMonitor(ruleService, client)
+	alertMonitor.SetStateChanges(cfg.Notifications.StateChanges)
+	if cfg.Notifications.MetricsStream {
+		alertMonitor.SetMetrics(services.NewAlertMetrics(client))
+	}
 	if err := alertMonitor.Start(ctx); err != nil {
 		logrus.Fatalf("Failed to start alert monitor: %v", err)
 	}
 	logrus.Info("Alert monitoring service started")
 
+	// Seed sample rules and feed them readings so alerts flow without separate tools
+	if *demo {
+		if err := ruleService.SeedDemo(ctx); err != nil {
+			logrus.Fatalf("Failed to seed demo: %v", err)
+		}
+		ruleService.StartDemoGenerator(services.DefaultDemoInterval)
+		logrus.Infof("Demo mode: generating readings into %s", services.DemoStream)
+	}
+
+	// Pick up rules changed through other replicas as they change
+	if cfg.Replicas.RuleChangeFeed {
+		if err := ruleService.StartRuleChangeFeed(); err != nil {
+			logrus.Fatalf("Failed to start rule change feed: %v", err)
+		}
+		logrus.Info("Following rule changes made through other replicas")
+	}
+
+	// Export old alerts to cold storage
+	var alertArchiver *services.AlertArchiver
+	if cfg.Archive.Enabled {
+		format, err := archive.ParseFormat(cfg.Archive.Format)
+		if err != nil {
+			logrus.Fatalf("Invalid archive configuration: %v", err)
+		}
+		if cfg.Archive.OlderThanDays <= 0 {
+			logrus.Fatalf("Invalid archive configuration: olderThanDays must be positive")
+		}
+		store, err := archive.NewStore(archive.StoreConfig{
+			Provider:        cfg.Archive.Provider,
+			Bucket:          cfg.Archive.Bucket,
+			Region:          cfg.Archive.Region,
+			Endpoint:        cfg.Archive.Endpoint,
+			AccessKeyID:     cfg.Archive.AccessKeyID,
+			SecretAccessKey: cfg.Archive.SecretAccessKey,
+		})
+		if err != nil {
+			logrus.Fatalf("Invalid archive configuration: %v", err)
+		}
+		alertArchiver = services.NewAlertArchiver(ruleService, client, store, services.AlertArchiveOptions{
+			OlderThan: time.Duration(cfg.Archive.OlderThanDays) * 24 * time.Hour,
+			Format:    format,
+			Prefix:    cfg.Archive.Prefix,
+			BatchSize: cfg.Archive.BatchSize,
+			Delete:    cfg.Archive.Delete,
+		})
+		if err := alertArchiver.Start(ctx, time.Duration(cfg.Archive.Interval)*time.Second); err != nil {
+			logrus.Fatalf("Failed to start alert archiver: %v", err)
+		}
+	}
+
 	// Set up the Echo server
 	e := echo.New()
 
 	// Middleware
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
 	// API routes
 	apiHandler := api.NewAPIHandler(ruleService)
+	apiHandler.SetConfig(cfg)
+	apiHandler.SetFeed(feed)
+	apiHandler.SetEncryptionReaders(cfg.Encryption.ReaderTokens)
+	if slack := cfg.Notifications.Slack; slackNotifier != nil && slack.Interactive {
+		apiHandler.SetSlack(slackNotifier, slack.SigningSecret, slack.UserNames)
+	}
+	if actionLinks != nil {
+		apiHandler.SetActionLinks(actionLinks)
+	}
+	if twilioNotifier != nil {
+		apiHandler.SetTwilio(twilioNotifier, notificationLog)
+	}
+	if cfg.Federation.Enabled {
+		remotes := make([]federation.Remote, 0, len(cfg.Federation.Remotes))
+		for _, remote := range cfg.Federation.Remotes {
+			remotes = append(remotes, federation.Remote{Name: remote.Name, URL: remote.URL, Token: remote.Token})
+		}
+		federated, err := federation.New(ruleService, remotes, federation.Options{
+			CacheTTL:  time.Duration(cfg.Federation.CacheSeconds) * time.Second,
+			Timeout:   time.Duration(cfg.Federation.Timeout) * time.Second,
+			LocalName: cfg.Federation.Name,
+		})
+		if err != nil {
+			logrus.Fatalf("Invalid federation configuration: %v", err)
+		}
+		apiHandler.SetFederation(federated)
+		logrus.Infof("Federating alerts and rules of %d remote gateway(s)", len(remotes))
+	}
 	apiHandler.SetupRoutes(e)
 
 	// Temporary route to list all streams
@@ -116,7 +530,7 @@ func main() {
 		ctx := context.Background()
 		streams, err := client.ListStreams(ctx)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list streams: %v", err)})
+			return api.ErrorJSON(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list streams: %v", err))
 		}
 		return c.JSON(http.StatusOK, streams)
 	})
@@ -125,44 +539,24 @@ func main() {
 	e.GET("/debug/alert_acks", func(c echo.Context) error {
 		client := ruleService.GetTimeplusClient()
 		ctx := context.Background()
-		query := fmt.Sprintf("SELECT * FROM table(%s) ORDER BY created_at DESC LIMIT 100", timeplus.AlertAcksMutableStream)
+		query := fmt.Sprintf("SELECT * FROM %s ORDER BY created_at DESC LIMIT 100", timeplus.AlertAcksTable())
 		results, err := client.ExecuteQuery(ctx, query)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to query alert acks: %v", err)})
+			return api.ErrorJSON(c, http.StatusInternalServerError, fmt.Sprintf("Failed to query alert acks: %v", err))
 		}
 		return c.JSON(http.StatusOK, results)
 	})
 
-	// Temporary route to delete a stream
-	e.DELETE("/debug/streams/:name", func(c echo.Context) error {
-		streamName := c.Param("name")
-		client := ruleService.GetTimeplusClient()
-		ctx := context.Background()
-
-		// First try to delete as a view
-		err := client.DeleteMaterializedView(ctx, streamName)
-		if err != nil {
-			logrus.Warnf("Failed to delete as view: %v", err)
-		}
-
-		// Then try to delete as a stream
-		err = client.DeleteStream(ctx, streamName)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": fmt.Sprintf("Failed to delete stream: %v", err),
-			})
-		}
-
-		return c.JSON(http.StatusOK, map[string]string{
-			"message": fmt.Sprintf("Stream %s deleted successfully", streamName),
-		})
-	})
+	// Temporary route to delete a stream, guarded like DELETE /api/admin/streams/:name
+	e.DELETE("/debug/streams/:name", apiHandler.DeleteStream)
 
 	// Swagger documentation
 	e.GET("/swagger/*", echo.WrapHandler(httpSwagger.Handler()))
 
-	// Static files for UI
-	e.Static("/", "./ui/build")
+	// Web dashboard, the built-in one unless a custom build is configured
+	if cfg.UI.Enabled {
+		e.GET("/*", echo.WrapHandler(ui.Handler(cfg.UI.Dir)))
+	}
 
 	// Create HTTP server
 	// Use PORT environment variable if available, otherwise use config
@@ -193,17 +587,41 @@ func main() {
 	<-quit
 	logrus.Info("Shutting down server...")
 
-	// Shutdown alert monitor
-	alertMonitor.Shutdown()
-	logrus.Info("Alert monitor shutdown complete")
-
-	// Create a deadline for graceful shutdown
+	// Create a deadline for graceful shutdown shared by all pipelines
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout)*time.Second)
 	defer cancel()
 
-	// Shutdown the server
+	// Stop accepting new HTTP requests and let in-flight ones finish
 	if err := e.Shutdown(ctx); err != nil {
-		logrus.Fatalf("Server forced to shutdown: %v", err)
+		logrus.Errorf("Server forced to shutdown: %v", err)
+	}
+
+	// Stop archiving before the rule service stops accepting work
+	if alertArchiver != nil {
+		alertArchiver.Shutdown()
+	}
+
+	// Stop moving staged alerts, those staged meanwhile are moved at the next start
+	if payloadEncryptor != nil {
+		payloadEncryptor.Shutdown()
+	}
+
+	// Stop pushing alerts before the notification pipeline is drained
+	alertMonitor.Shutdown()
+	logrus.Info("Alert monitor shutdown complete")
+
+	// Quiesce the rule service: cancel streaming queries and flush pending alert/ack writes
+	report := ruleService.Shutdown(ctx)
+	if len(report.DroppedTasks) > 0 {
+		logrus.Warnf("Dropped during shutdown: %s", strings.Join(report.DroppedTasks, ", "))
+	}
+	if report.DroppedNotifications > 0 {
+		logrus.Warnf("Dropped %d queued notification(s) during shutdown", report.DroppedNotifications)
+	}
+
+	// Finally close the Timeplus connection
+	if err := tpClient.Close(); err != nil {
+		logrus.Warnf("Error closing Timeplus connection: %v", err)
 	}
 
 	logrus.Info("Server exited properly")
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+)
+
+// Clock difference allowed between the simulator, the gateway and Timeplus
+const assertClockSkew = 2 * time.Second
+
+// assertConfig configures an assertion run
+type assertConfig struct {
+	Duration        time.Duration // How long data is sent
+	Interval        time.Duration // Time between ingestion ticks
+	AnomalyInterval time.Duration // Time between bursts of anomalies, one per entity
+	Settle          time.Duration // How long to wait for alerts after the data stops
+	ReportFile      string
+}
+
+// assertConfigFromEnv reads the assertion run configuration from environment variables
+func assertConfigFromEnv(intervalMs int) (assertConfig, error) {
+	cfg := assertConfig{
+		Interval:   time.Duration(intervalMs) * time.Millisecond,
+		ReportFile: getEnv("ASSERT_REPORT_FILE", ""),
+	}
+	for _, setting := range []struct {
+		name     string
+		fallback string
+		value    *time.Duration
+	}{
+		{"ASSERT_DURATION_SEC", "300", &cfg.Duration},
+		{"ASSERT_ANOMALY_INTERVAL_SEC", "30", &cfg.AnomalyInterval},
+		{"ASSERT_SETTLE_SEC", "20", &cfg.Settle},
+	} {
+		seconds, err := strconv.Atoi(getEnv(setting.name, setting.fallback))
+		if err != nil || seconds <= 0 {
+			return cfg, fmt.Errorf("%s must be a positive number of seconds", setting.name)
+		}
+		*setting.value = time.Duration(seconds) * time.Second
+	}
+	return cfg, nil
+}
+
+// AssertCheck is one check of a rule's alerts
+type AssertCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// RuleAssertion is the outcome of checking one rule's alerts
+type RuleAssertion struct {
+	RuleID  string        `json:"ruleId"`
+	Name    string        `json:"name"`
+	Passed  bool          `json:"passed"`
+	Alerts  int           `json:"alerts"`  // Distinct alerts fired during the run
+	Firings int           `json:"firings"` // Alert history entries, including re-fires after the throttle window
+	Checks  []AssertCheck `json:"checks"`
+}
+
+// check records a check and returns whether it passed
+func (r *RuleAssertion) check(name string, err error, detail string) bool {
+	c := AssertCheck{Name: name, Passed: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Passed
+}
+
+// AssertReport is the outcome of an assertion run
+type AssertReport struct {
+	Scenario  string          `json:"scenario"`
+	StartedAt time.Time       `json:"startedAt"`
+	Duration  float64         `json:"durationSeconds"`
+	Passed    bool            `json:"passed"`
+	Rules     []RuleAssertion `json:"rules"`
+}
+
+// historyEntry is a firing as returned by the rule alert history endpoint
+type historyEntry struct {
+	AlertID     string    `json:"alertId"`
+	EntityID    string    `json:"entityId"`
+	TriggeredAt time.Time `json:"triggeredAt"`
+}
+
+// acknowledgement is an alert the assertion run acknowledged
+type acknowledgement struct {
+	alertID  string
+	at       time.Time
+	readBack error // Why the alert didn't read back as acknowledged by the simulator
+}
+
+// assertRun sends data for a fixed time, acknowledges the first alert of every rule, then checks
+// each rule's alerts against the scenario's expectations
+type assertRun struct {
+	cfg        assertConfig
+	gatewayURL string
+	client     *http.Client
+	in         *ingester
+	ruleIDs    []string
+	acked      map[string]acknowledgement // By rule ID
+}
+
+// runAssertions runs the scenario for the configured duration and checks the alerts it caused
+func runAssertions(ctx context.Context, conn driver.Conn, scenario *Scenario, generators []*streamGenerator,
+	alertGatewayURL string, ruleIDs []string, cfg assertConfig) *AssertReport {
+	run := &assertRun{
+		cfg:        cfg,
+		gatewayURL: alertGatewayURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		in:         &ingester{conn: conn, generators: generators},
+		ruleIDs:    ruleIDs,
+		acked:      make(map[string]acknowledgement, len(ruleIDs)),
+	}
+	report := &AssertReport{Scenario: scenario.Name, StartedAt: time.Now(), Rules: []RuleAssertion{}}
+
+	run.send(ctx)
+	if ctx.Err() == nil {
+		logrus.Infof("Assert: data stopped, waiting %s for the last alerts", cfg.Settle)
+		select {
+		case <-ctx.Done():
+		case <-time.After(cfg.Settle):
+		}
+	}
+	report.Duration = time.Since(report.StartedAt).Seconds()
+
+	report.Passed = ctx.Err() == nil
+	for i, rule := range scenario.Rules {
+		result := run.checkRule(rule, ruleIDs[i], report.StartedAt)
+		logrus.Infof("Assert: %s %s", rule.Name, passFail(result.Passed))
+		report.Rules = append(report.Rules, result)
+		report.Passed = report.Passed && result.Passed
+	}
+	return report
+}
+
+// send ingests normal data with regular bursts of anomalies until the run's duration has passed,
+// acknowledging the first alert of each rule as it appears
+func (r *assertRun) send(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, r.cfg.Duration)
+	defer cancel()
+	go r.in.run(ctx, r.cfg.Interval)
+
+	anomalies := time.NewTicker(r.cfg.AnomalyInterval)
+	defer anomalies.Stop()
+	poll := time.NewTicker(5 * time.Second)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-anomalies.C:
+			if err := r.in.sendAnomalies(ctx); err != nil && ctx.Err() == nil {
+				logrus.Warnf("Assert: failed to send anomalies: %v", err)
+			}
+		case <-poll.C:
+			// Reading an acknowledgement back may outlast the data
+			r.acknowledgeFirstAlerts(parent)
+		}
+	}
+}
+
+// acknowledgeFirstAlerts acknowledges an active alert of every rule that has none acknowledged yet
+func (r *assertRun) acknowledgeFirstAlerts(ctx context.Context) {
+	for _, ruleID := range r.ruleIDs {
+		if _, ok := r.acked[ruleID]; ok {
+			continue
+		}
+		var alerts []Alert
+		if err := r.get("/api/alerts?rule_id="+url.QueryEscape(ruleID), &alerts); err != nil {
+			logrus.Warnf("Assert: failed to get alerts of rule %s: %v", ruleID, err)
+			continue
+		}
+		for _, alert := range alerts {
+			if alert.Acknowledged {
+				continue
+			}
+			if err := r.acknowledge(alert.ID); err != nil {
+				logrus.Warnf("Assert: failed to acknowledge alert %s: %v", alert.ID, err)
+				break
+			}
+			ack := acknowledgement{alertID: alert.ID, at: time.Now()}
+			ack.readBack = waitFor(ctx, 15*time.Second, func() error { return r.readAcknowledged(alert.ID) })
+			r.acked[ruleID] = ack
+			logrus.Infof("Assert: acknowledged alert %s", alert.ID)
+			break
+		}
+	}
+}
+
+// checkRule checks a rule's alert count, that its alerts were throttled and that the alert the run
+// acknowledged read back as acknowledged and didn't fire again
+func (r *assertRun) checkRule(rule RuleRequest, ruleID string, since time.Time) RuleAssertion {
+	result := RuleAssertion{RuleID: ruleID, Name: rule.Name}
+
+	var history []historyEntry
+	query := url.Values{"start_time": {since.Add(-assertClockSkew).UTC().Format(time.RFC3339)}, "limit": {"100000"}}
+	if !result.check("read alert history", r.get("/api/rules/"+ruleID+"/alerts/history?"+query.Encode(), &history), "") {
+		return result
+	}
+	result.Firings = len(history)
+	alerts := map[string][]time.Time{}
+	for _, entry := range history {
+		alerts[entry.AlertID] = append(alerts[entry.AlertID], entry.TriggeredAt)
+	}
+	result.Alerts = len(alerts)
+
+	minAlerts, maxAlerts := rule.expectedAlerts()
+	result.check("alert count", checkAlertCount(result.Alerts, minAlerts, maxAlerts), fmt.Sprintf("%d alert(s)", result.Alerts))
+	result.check("throttling", checkThrottle(alerts, rule.ThrottleMinutes), fmt.Sprintf("%d firing(s)", result.Firings))
+
+	if ack, ok := r.acked[ruleID]; ok {
+		result.check("acknowledgement", checkAcknowledged(ack, alerts[ack.alertID]), ack.alertID)
+	} else if result.Alerts > 0 {
+		result.check("acknowledgement", fmt.Errorf("no alert was acknowledged during the run"), "")
+	}
+
+	result.Passed = true
+	for _, c := range result.Checks {
+		result.Passed = result.Passed && c.Passed
+	}
+	return result
+}
+
+// readAcknowledged checks that an alert reads as acknowledged by the simulator
+func (r *assertRun) readAcknowledged(alertID string) error {
+	var alert Alert
+	if err := r.get("/api/alerts/"+url.PathEscape(alertID), &alert); err != nil {
+		return err
+	}
+	if !alert.Acknowledged {
+		return fmt.Errorf("alert isn't acknowledged")
+	}
+	if alert.AcknowledgedBy != "simulator" {
+		return fmt.Errorf("alert was acknowledged by %q, not the simulator", alert.AcknowledgedBy)
+	}
+	return nil
+}
+
+// checkAcknowledged checks that an acknowledged alert read back as acknowledged and didn't fire
+// again, since matches after an acknowledgement start a new alert for the entity
+func checkAcknowledged(ack acknowledgement, firings []time.Time) error {
+	if ack.readBack != nil {
+		return ack.readBack
+	}
+	for _, at := range firings {
+		if at.After(ack.at.Add(assertClockSkew)) {
+			return fmt.Errorf("alert fired again at %s after being acknowledged", at.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// expectedAlerts returns the bounds on the number of alerts a rule may fire during an assertion run.
+// Hand-written query rules alert on every anomaly they match, so they must fire at least once unless
+// the scenario says otherwise; generated rule types aren't expected to. maxAlerts is -1 without a limit.
+func (r RuleRequest) expectedAlerts() (minAlerts, maxAlerts int) {
+	maxAlerts = -1
+	if r.Type == "" || r.Type == "query" {
+		minAlerts = 1
+	}
+	if r.Expect != nil {
+		if r.Expect.MinAlerts != nil {
+			minAlerts = *r.Expect.MinAlerts
+		}
+		if r.Expect.MaxAlerts != nil {
+			maxAlerts = *r.Expect.MaxAlerts
+		}
+	}
+	return minAlerts, maxAlerts
+}
+
+// checkAlertCount checks a number of alerts against its bounds, maxAlerts -1 meaning no limit
+func checkAlertCount(alerts, minAlerts, maxAlerts int) error {
+	if alerts < minAlerts {
+		return fmt.Errorf("%d alert(s), expected at least %d", alerts, minAlerts)
+	}
+	if maxAlerts >= 0 && alerts > maxAlerts {
+		return fmt.Errorf("%d alert(s), expected at most %d", alerts, maxAlerts)
+	}
+	return nil
+}
+
+// checkThrottle checks that no alert fired again within the throttle window of its previous firing.
+// firings holds the firing times of each alert.
+func checkThrottle(firings map[string][]time.Time, throttleMinutes int) error {
+	window := time.Duration(throttleMinutes) * time.Minute
+	var violations []string
+	for alertID, times := range firings {
+		sorted := append([]time.Time(nil), times...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+		for i := 1; i < len(sorted); i++ {
+			if gap := sorted[i].Sub(sorted[i-1]); gap < window-assertClockSkew {
+				violations = append(violations, fmt.Sprintf("%s fired again after %s", alertID, gap.Round(time.Second)))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return fmt.Errorf("re-fired within the %d minute throttle: %s", throttleMinutes, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// acknowledge acknowledges an alert as the simulator
+func (r *assertRun) acknowledge(alertID string) error {
+	data, _ := json.Marshal(map[string]string{
+		"acknowledgedBy": "simulator",
+		"comment":        "Acknowledged by the simulator's assertion run",
+	})
+	resp, err := postWithRetry(r.client, fmt.Sprintf("%s/api/alerts/%s/acknowledge", r.gatewayURL, url.PathEscape(alertID)), data, uuid.NewString())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("acknowledge returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// get decodes the JSON response of a gateway endpoint
+func (r *assertRun) get(path string, into interface{}) error {
+	resp, err := r.client.Get(r.gatewayURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("failed to decode GET %s: %w", path, err)
+	}
+	return nil
+}
+
+// logAssertReport prints the pass/fail report and writes it as JSON to the configured report file
+func logAssertReport(report *AssertReport, reportFile string) {
+	var b strings.Builder
+	for _, result := range report.Rules {
+		fmt.Fprintf(&b, "  %-32s %s (%d alert(s), %d firing(s))\n", result.Name, passFail(result.Passed), result.Alerts, result.Firings)
+		for _, c := range result.Checks {
+			fmt.Fprintf(&b, "    [%s] %s", passFail(c.Passed), c.Name)
+			if c.Detail != "" {
+				fmt.Fprintf(&b, ": %s", c.Detail)
+			}
+			b.WriteString("\n")
+		}
+	}
+	logrus.Infof("🧪 ASSERT REPORT (%s, %.0fs): %s\n%s", report.Scenario, report.Duration, passFail(report.Passed), b.String())
+
+	if reportFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logrus.Errorf("Failed to marshal assert report: %v", err)
+		return
+	}
+	if err := os.WriteFile(reportFile, data, 0o644); err != nil {
+		logrus.Errorf("Failed to write assert report to %s: %v", reportFile, err)
+		return
+	}
+	logrus.Infof("Wrote assert report to %s", reportFile)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedAlerts(t *testing.T) {
+	scenario, err := parseScenario([]byte(`
+name: expectations
+streams:
+  - name: s
+    entities: {count: 1}
+    columns:
+      - name: v
+        type: float64
+        generator: {kind: uniform, min: 0, max: 1}
+rules:
+  - name: query
+    query: SELECT * FROM s WHERE v > 0.9
+  - name: window
+    type: window
+  - name: bounded
+    query: SELECT * FROM s WHERE v > 0.5
+    expect: {minAlerts: 0, maxAlerts: 3}
+`))
+	require.NoError(t, err)
+
+	for i, want := range [][2]int{{1, -1}, {0, -1}, {0, 3}} {
+		minAlerts, maxAlerts := scenario.Rules[i].expectedAlerts()
+		assert.Equal(t, want, [2]int{minAlerts, maxAlerts}, scenario.Rules[i].Name)
+	}
+	assert.NoError(t, checkAlertCount(3, 0, 3))
+	assert.ErrorContains(t, checkAlertCount(4, 0, 3), "at most 3")
+	assert.ErrorContains(t, checkAlertCount(0, 1, -1), "at least 1")
+
+	_, err = parseScenario([]byte(`
+name: bad
+streams:
+  - name: s
+    entities: {count: 1}
+    columns:
+      - name: v
+        type: float64
+        generator: {kind: uniform, min: 0, max: 1}
+rules:
+  - name: query
+    query: SELECT * FROM s
+    expect: {minAlerts: 2, maxAlerts: 1}
+`))
+	assert.ErrorContains(t, err, "at least expect.minAlerts")
+}
+
+func TestCheckThrottle(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	firings := map[string][]time.Time{
+		"r1:device_1:1": {at.Add(2 * time.Minute), at},
+		"r1:device_2:1": {at},
+		// A new firing after an acknowledgement isn't throttled
+		"r1:device_1:2": {at.Add(30 * time.Second)},
+	}
+	assert.NoError(t, checkThrottle(firings, 2))
+
+	firings["r1:device_2:1"] = append(firings["r1:device_2:1"], at.Add(90*time.Second))
+	assert.EqualError(t, checkThrottle(firings, 2), "re-fired within the 2 minute throttle: r1:device_2:1 fired again after 1m30s")
+}
+
+func TestCheckAcknowledged(t *testing.T) {
+	ackedAt := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	ack := acknowledgement{alertID: "r1:device_1:1", at: ackedAt}
+	assert.NoError(t, checkAcknowledged(ack, []time.Time{ackedAt.Add(-time.Minute), ackedAt.Add(time.Second)}))
+	assert.ErrorContains(t, checkAcknowledged(ack, []time.Time{ackedAt.Add(time.Minute)}), "fired again")
+
+	ack.readBack = errors.New("alert isn't acknowledged")
+	assert.EqualError(t, checkAcknowledged(ack, nil), "alert isn't acknowledged")
+}
+
+func TestAssertConfigFromEnv(t *testing.T) {
+	t.Setenv("ASSERT_DURATION_SEC", "120")
+	cfg, err := assertConfigFromEnv(500)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, cfg.Duration)
+	assert.Equal(t, 30*time.Second, cfg.AnomalyInterval)
+	assert.Equal(t, 500*time.Millisecond, cfg.Interval)
+
+	t.Setenv("ASSERT_SETTLE_SEC", "soon")
+	_, err = assertConfigFromEnv(500)
+	assert.ErrorContains(t, err, "ASSERT_SETTLE_SEC")
+}
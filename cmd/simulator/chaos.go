@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+)
+
+// Faults the chaos mode can inject
+const (
+	faultConnectionDrop = "connection_drop" // Close the simulator's Timeplus connection and reconnect later
+	faultMalformedRows  = "malformed_rows"  // Insert rows with wrong types, missing values, nulls and extreme values
+	faultViewDeletion   = "view_deletion"   // Drop a running rule's materialized view behind the gateway's back
+	faultIngestionStall = "ingestion_stall" // Stop sending data for a while
+)
+
+var allFaults = []string{faultConnectionDrop, faultMalformedRows, faultViewDeletion, faultIngestionStall}
+
+// chaosConfig configures a chaos run
+type chaosConfig struct {
+	Faults          []string
+	Interval        time.Duration // Time between ingestion ticks
+	RecoveryTimeout time.Duration // How long recovery may take before a check fails
+	DropDuration    time.Duration // How long the connection stays down
+	StallDuration   time.Duration // How long ingestion stalls
+	ReportFile      string
+}
+
+// chaosConfigFromEnv reads the chaos configuration from environment variables
+func chaosConfigFromEnv(intervalMs int) (chaosConfig, error) {
+	recoverySec, _ := strconv.Atoi(getEnv("CHAOS_RECOVERY_TIMEOUT_SEC", "180"))
+	dropSec, _ := strconv.Atoi(getEnv("CHAOS_DROP_SEC", "15"))
+	stallSec, _ := strconv.Atoi(getEnv("CHAOS_STALL_SEC", "60"))
+
+	cfg := chaosConfig{
+		Interval:        time.Duration(intervalMs) * time.Millisecond,
+		RecoveryTimeout: time.Duration(recoverySec) * time.Second,
+		DropDuration:    time.Duration(dropSec) * time.Second,
+		StallDuration:   time.Duration(stallSec) * time.Second,
+		ReportFile:      getEnv("CHAOS_REPORT_FILE", ""),
+	}
+
+	faults := getEnv("CHAOS_FAULTS", strings.Join(allFaults, ","))
+	for _, fault := range strings.Split(faults, ",") {
+		fault = strings.TrimSpace(fault)
+		known := false
+		for _, f := range allFaults {
+			known = known || f == fault
+		}
+		if !known {
+			return cfg, fmt.Errorf("unknown fault %q, expected one of %s", fault, strings.Join(allFaults, ", "))
+		}
+		cfg.Faults = append(cfg.Faults, fault)
+	}
+	return cfg, nil
+}
+
+// ChaosCheck is one recovery check of a fault
+type ChaosCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ChaosResult is the outcome of injecting one fault
+type ChaosResult struct {
+	Fault           string       `json:"fault"`
+	Passed          bool         `json:"passed"`
+	InjectedAt      time.Time    `json:"injectedAt"`
+	RecoverySeconds float64      `json:"recoverySeconds"` // From the fault ending to alerts firing again
+	Checks          []ChaosCheck `json:"checks"`
+}
+
+// check records a check and returns whether it passed
+func (r *ChaosResult) check(name string, err error, detail string) bool {
+	c := ChaosCheck{Name: name, Passed: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Passed
+}
+
+// ChaosReport is the outcome of a chaos run
+type ChaosReport struct {
+	Scenario  string        `json:"scenario"`
+	StartedAt time.Time     `json:"startedAt"`
+	Passed    bool          `json:"passed"`
+	Baseline  ChaosResult   `json:"baseline"`
+	Faults    []ChaosResult `json:"faults"`
+}
+
+// ingester keeps sending one row per entity every tick over a connection that faults can close,
+// replace or pause. All use of the generators goes through it, so their state isn't shared.
+type ingester struct {
+	mu          sync.Mutex
+	conn        driver.Conn
+	generators  []*streamGenerator
+	paused      bool
+	failures    int64
+	lastSuccess time.Time
+}
+
+// run sends data every interval until ctx is cancelled
+func (in *ingester) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			in.mu.Lock()
+			if !in.paused {
+				for _, gen := range in.generators {
+					if err := sendStreamData(ctx, in.conn, gen); err != nil {
+						in.failures++
+						logrus.Debugf("Chaos ingestion into %s failed: %v", gen.stream.Name, err)
+					} else {
+						in.lastSuccess = time.Now()
+					}
+				}
+			}
+			in.mu.Unlock()
+		}
+	}
+}
+
+// sendAnomalies sends an anomalous row for every entity of every stream
+func (in *ingester) sendAnomalies(ctx context.Context) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for _, gen := range in.generators {
+		names := make([]string, len(gen.stream.Columns))
+		for i, column := range gen.stream.Columns {
+			names[i] = column.Name
+		}
+
+		batch, err := in.conn.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO %s (%s)", gen.stream.Name, strings.Join(names, ", ")))
+		if err != nil {
+			return fmt.Errorf("failed to prepare batch: %w", err)
+		}
+		for _, entityID := range gen.entityIDs() {
+			row, err := gen.row(entityID, true)
+			if err != nil {
+				batch.Abort()
+				return err
+			}
+			if err := batch.Append(row...); err != nil {
+				batch.Abort()
+				return fmt.Errorf("failed to append anomaly to batch: %w", err)
+			}
+		}
+		if err := batch.Send(); err != nil {
+			return fmt.Errorf("failed to send anomalies to %s: %w", gen.stream.Name, err)
+		}
+	}
+	return nil
+}
+
+// validRow generates a normal row for the first entity of a stream
+func (in *ingester) validRow(gen *streamGenerator) ([]interface{}, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return gen.row(gen.entityIDs()[0], false)
+}
+
+func (in *ingester) connection() driver.Conn {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.conn
+}
+
+func (in *ingester) setPaused(paused bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.paused = paused
+}
+
+func (in *ingester) status() (failures int64, lastSuccess time.Time) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.failures, in.lastSuccess
+}
+
+// chaosRun injects faults one at a time and checks that the gateway recovers from each
+type chaosRun struct {
+	cfg        chaosConfig
+	gatewayURL string
+	client     *http.Client
+	in         *ingester
+	// IDs of the created rules that are hand-written queries, which alert as soon as an anomaly arrives
+	queryRuleIDs []string
+}
+
+// runChaos runs the baseline check and every configured fault in random order
+func runChaos(ctx context.Context, conn driver.Conn, scenario *Scenario, generators []*streamGenerator,
+	alertGatewayURL string, ruleIDs []string, cfg chaosConfig) *ChaosReport {
+	run := &chaosRun{
+		cfg:        cfg,
+		gatewayURL: alertGatewayURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		in:         &ingester{conn: conn, generators: generators},
+	}
+	for i, rule := range scenario.Rules {
+		if rule.Type == "" || rule.Type == "query" {
+			run.queryRuleIDs = append(run.queryRuleIDs, ruleIDs[i])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go run.in.run(ctx, cfg.Interval)
+
+	report := &ChaosReport{Scenario: scenario.Name, StartedAt: time.Now(), Faults: []ChaosResult{}}
+
+	// Without a working pipeline there is nothing to recover to
+	logrus.Info("Chaos: checking that alerts fire before injecting faults")
+	report.Baseline = ChaosResult{Fault: "baseline", InjectedAt: time.Now()}
+	report.Baseline.Passed = run.checkRecovery(ctx, &report.Baseline, run.queryRuleIDs, time.Now())
+	if !report.Baseline.Passed {
+		return report
+	}
+
+	faults := append([]string(nil), cfg.Faults...)
+	rand.Shuffle(len(faults), func(i, j int) { faults[i], faults[j] = faults[j], faults[i] })
+
+	report.Passed = true
+	for _, fault := range faults {
+		// Let the system settle for a random while between faults
+		wait := 5*time.Second + time.Duration(rand.Int63n(int64(10*time.Second)))
+		select {
+		case <-ctx.Done():
+			report.Passed = false
+			return report
+		case <-time.After(wait):
+		}
+
+		logrus.Warnf("💥 Chaos: injecting %s", fault)
+		result := run.inject(ctx, fault)
+		logrus.Infof("Chaos: %s %s", fault, passFail(result.Passed))
+		report.Faults = append(report.Faults, result)
+		report.Passed = report.Passed && result.Passed
+	}
+	return report
+}
+
+// inject injects one fault and checks the recovery from it
+func (r *chaosRun) inject(ctx context.Context, fault string) ChaosResult {
+	result := ChaosResult{Fault: fault, InjectedAt: time.Now()}
+	probeRules := r.queryRuleIDs
+
+	switch fault {
+	case faultConnectionDrop:
+		failuresBefore, _ := r.in.status()
+		r.in.mu.Lock()
+		r.in.conn.Close()
+		r.in.mu.Unlock()
+		time.Sleep(r.cfg.DropDuration)
+
+		var dropErr error
+		failures, _ := r.in.status()
+		if failures == failuresBefore {
+			dropErr = fmt.Errorf("inserts kept succeeding after closing the connection")
+		}
+		result.check("ingestion fails while disconnected", dropErr, fmt.Sprintf("%d failed inserts", failures-failuresBefore))
+
+		conn, err := openTimeplus(5)
+		if !result.check("simulator reconnects", err, "") {
+			return result
+		}
+		r.in.mu.Lock()
+		r.in.conn = conn
+		r.in.mu.Unlock()
+
+		reconnectedAt := time.Now()
+		result.check("ingestion resumes", waitFor(ctx, r.cfg.RecoveryTimeout, func() error {
+			if _, lastSuccess := r.in.status(); lastSuccess.Before(reconnectedAt) {
+				return fmt.Errorf("no successful insert since reconnecting")
+			}
+			return nil
+		}), "")
+
+	case faultMalformedRows:
+		accepted, rejected := 0, 0
+		for _, gen := range r.in.generators {
+			row, err := r.in.validRow(gen)
+			if err != nil {
+				result.check("generate malformed rows", err, "")
+				return result
+			}
+			for _, insert := range malformedInserts(gen.stream, row) {
+				if err := r.in.connection().Exec(ctx, insert); err != nil {
+					rejected++
+				} else {
+					accepted++
+				}
+			}
+		}
+		result.check("malformed rows sent", nil, fmt.Sprintf("%d rejected by Timeplus, %d accepted", rejected, accepted))
+		result.check("rules keep running", r.rulesRunning(), "")
+
+	case faultViewDeletion:
+		if len(r.queryRuleIDs) == 0 {
+			result.check("pick a rule", fmt.Errorf("no running query rule"), "")
+			return result
+		}
+		ruleID := r.queryRuleIDs[rand.Intn(len(r.queryRuleIDs))]
+		view := fmt.Sprintf("rule_%s_mv", strings.ReplaceAll(ruleID, "-", "_"))
+		probeRules = []string{ruleID}
+
+		err := r.in.connection().Exec(ctx, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", view))
+		if !result.check("drop view", err, view) {
+			return result
+		}
+		result.check("gateway recreates view", waitFor(ctx, r.cfg.RecoveryTimeout, func() error {
+			exists, err := streamExists(ctx, r.in.connection(), view)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("%s still missing", view)
+			}
+			return nil
+		}), view)
+		result.check("rules keep running", r.rulesRunning(), "")
+
+	case faultIngestionStall:
+		r.in.setPaused(true)
+		time.Sleep(r.cfg.StallDuration)
+		result.check("gateway healthy during stall", r.gatewayHealthy(), "")
+		r.in.setPaused(false)
+	}
+
+	r.checkRecovery(ctx, &result, probeRules, time.Now())
+	result.Passed = true
+	for _, c := range result.Checks {
+		result.Passed = result.Passed && c.Passed
+	}
+	return result
+}
+
+// checkRecovery checks that the gateway reports healthy and that every given rule alerts again on
+// fresh anomalies, recording how long that took from recoveryFrom
+func (r *chaosRun) checkRecovery(ctx context.Context, result *ChaosResult, ruleIDs []string, recoveryFrom time.Time) bool {
+	healthy := result.check("gateway healthy", waitFor(ctx, r.cfg.RecoveryTimeout, r.gatewayHealthy), "")
+
+	if len(ruleIDs) == 0 {
+		return result.check("alerts fire", fmt.Errorf("scenario has no query rules to probe"), "") && healthy
+	}
+
+	// Acknowledge current alerts so throttling doesn't hide new firings
+	for _, ruleID := range ruleIDs {
+		if err := r.acknowledgeAll(ruleID); err != nil {
+			result.check("acknowledge existing alerts", err, ruleID)
+			return false
+		}
+	}
+
+	probeAt := time.Now()
+	lastSent := time.Time{}
+	pending := make(map[string]bool, len(ruleIDs))
+	for _, ruleID := range ruleIDs {
+		pending[ruleID] = true
+	}
+
+	err := waitFor(ctx, r.cfg.RecoveryTimeout, func() error {
+		// Anomalies are random, so keep sending them until every rule has matched one
+		if time.Since(lastSent) >= 10*time.Second {
+			if err := r.in.sendAnomalies(ctx); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+		}
+
+		for ruleID := range pending {
+			fired, err := r.firedSince(ruleID, probeAt)
+			if err != nil {
+				return err
+			}
+			if fired {
+				delete(pending, ruleID)
+			}
+		}
+		if len(pending) > 0 {
+			ids := make([]string, 0, len(pending))
+			for ruleID := range pending {
+				ids = append(ids, ruleID)
+			}
+			return fmt.Errorf("no new alert from rule(s) %s", strings.Join(ids, ", "))
+		}
+		return nil
+	})
+	if err == nil {
+		result.RecoverySeconds = time.Since(recoveryFrom).Seconds()
+	}
+	return result.check("alerts fire", err, fmt.Sprintf("%d rule(s)", len(ruleIDs))) && healthy
+}
+
+// gatewayHealthy asks the gateway for a fresh health check
+func (r *chaosRun) gatewayHealthy() error {
+	var health struct {
+		Status        string `json:"status"`
+		TimeplusError string `json:"timeplusError"`
+	}
+	resp, err := r.client.Get(r.gatewayURL + "/api/health?refresh=true")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("failed to decode health (status %d): %w", resp.StatusCode, err)
+	}
+	if health.Status != "ok" {
+		return fmt.Errorf("gateway is %s %s", health.Status, health.TimeplusError)
+	}
+	return nil
+}
+
+// rulesRunning checks that every created query rule is still running
+func (r *chaosRun) rulesRunning() error {
+	for _, ruleID := range r.queryRuleIDs {
+		var rule struct {
+			Status    string `json:"status"`
+			LastError string `json:"lastError"`
+		}
+		resp, err := r.client.Get(r.gatewayURL + "/api/rules/" + ruleID)
+		if err != nil {
+			return err
+		}
+		err = json.NewDecoder(resp.Body).Decode(&rule)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode rule %s: %w", ruleID, err)
+		}
+		if rule.Status != "running" {
+			return fmt.Errorf("rule %s is %s: %s", ruleID, rule.Status, rule.LastError)
+		}
+	}
+	return nil
+}
+
+// acknowledgeAll acknowledges every active alert of a rule
+func (r *chaosRun) acknowledgeAll(ruleID string) error {
+	data, _ := json.Marshal(map[string]string{
+		"acknowledgedBy": "simulator",
+		"comment":        "Acknowledged before a chaos probe",
+	})
+	resp, err := postWithRetry(r.client, fmt.Sprintf("%s/api/rules/%s/alerts/acknowledge-all", r.gatewayURL, ruleID), data, uuid.NewString())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("acknowledge-all returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// firedSince reports whether a rule has an unacknowledged alert that fired after a point in time
+func (r *chaosRun) firedSince(ruleID string, since time.Time) (bool, error) {
+	resp, err := r.client.Get(r.gatewayURL + "/api/alerts?rule_id=" + ruleID)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var alerts []Alert
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		return false, fmt.Errorf("failed to decode alerts (status %d): %w", resp.StatusCode, err)
+	}
+	for _, alert := range alerts {
+		// Allow for a little clock difference between the simulator and Timeplus
+		if !alert.Acknowledged && alert.TriggeredAt.After(since.Add(-time.Second)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitFor retries check every 2 seconds until it succeeds or the timeout passes, returning its last error
+func waitFor(ctx context.Context, timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not recovered within %s: %w", timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// streamExists checks if a stream or view exists
+func streamExists(ctx context.Context, conn driver.Conn, name string) (bool, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf("SHOW STREAMS LIKE '%s'", strings.ReplaceAll(name, "'", "''")))
+	if err != nil {
+		return false, fmt.Errorf("error executing SHOW STREAMS: %w", err)
+	}
+	defer rows.Close()
+
+	exists := rows.Next()
+	return exists, rows.Err()
+}
+
+// malformedInserts builds INSERT statements with broken variants of a valid row: values of the wrong
+// type, missing values, nulls in non-nullable columns, empty and oversized strings, and extreme numbers.
+// Timeplus rejects some of them and accepts others; either way rules must keep working.
+func malformedInserts(stream *StreamScenario, valid []interface{}) []string {
+	names := make([]string, len(stream.Columns))
+	for i, column := range stream.Columns {
+		names[i] = column.Name
+	}
+	insert := func(values []string) string {
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", stream.Name, strings.Join(names, ", "), strings.Join(values, ", "))
+	}
+	variant := func(replace func(column ColumnSpec, value interface{}) string) string {
+		values := make([]string, len(valid))
+		for i, column := range stream.Columns {
+			values[i] = replace(column, valid[i])
+		}
+		return insert(values)
+	}
+
+	return []string{
+		variant(func(column ColumnSpec, value interface{}) string {
+			if column.Type == "string" {
+				return sqlLiteral(value)
+			}
+			return fmt.Sprintf("'not a %s'", column.Type)
+		}),
+		insert([]string{sqlLiteral(valid[0])}),
+		variant(func(ColumnSpec, interface{}) string { return "NULL" }),
+		variant(func(column ColumnSpec, value interface{}) string {
+			if column.Type == "string" {
+				return "''"
+			}
+			return sqlLiteral(value)
+		}),
+		variant(func(column ColumnSpec, value interface{}) string {
+			if column.Type == "string" {
+				return sqlLiteral(strings.Repeat("x", 64*1024))
+			}
+			return sqlLiteral(value)
+		}),
+		variant(func(column ColumnSpec, value interface{}) string {
+			switch column.Type {
+			case "float64":
+				return "nan"
+			case "int64":
+				return "9223372036854775807"
+			}
+			return sqlLiteral(value)
+		}),
+	}
+}
+
+// sqlLiteral formats a generated value as a SQL literal
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
+	case time.Time:
+		return fmt.Sprintf("'%s'", v.UTC().Format("2006-01-02 15:04:05.000"))
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func passFail(passed bool) string {
+	if passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+// logChaosReport prints the pass/fail report and writes it as JSON to the configured report file
+func logChaosReport(report *ChaosReport, reportFile string) {
+	var b strings.Builder
+	for _, result := range append([]ChaosResult{report.Baseline}, report.Faults...) {
+		fmt.Fprintf(&b, "  %-16s %s", result.Fault, passFail(result.Passed))
+		if result.Passed {
+			fmt.Fprintf(&b, " (alerts fired %.0fs after recovery)", result.RecoverySeconds)
+		}
+		b.WriteString("\n")
+		for _, c := range result.Checks {
+			fmt.Fprintf(&b, "    [%s] %s", passFail(c.Passed), c.Name)
+			if c.Detail != "" {
+				fmt.Fprintf(&b, ": %s", c.Detail)
+			}
+			b.WriteString("\n")
+		}
+	}
+	logrus.Infof("🧪 CHAOS REPORT (%s): %s\n%s", report.Scenario, passFail(report.Passed), b.String())
+
+	if reportFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logrus.Errorf("Failed to marshal chaos report: %v", err)
+		return
+	}
+	if err := os.WriteFile(reportFile, data, 0o644); err != nil {
+		logrus.Errorf("Failed to write chaos report to %s: %v", reportFile, err)
+		return
+	}
+	logrus.Infof("Wrote chaos report to %s", reportFile)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMalformedInserts(t *testing.T) {
+	stream := &StreamScenario{
+		Name: "device_temperatures",
+		Columns: []ColumnSpec{
+			{Name: "device_id", Type: "string"},
+			{Name: "temperature", Type: "float64"},
+			{Name: "timestamp", Type: "datetime64"},
+		},
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6e6, time.UTC)
+
+	inserts := malformedInserts(stream, []interface{}{"device_1", 21.5, at})
+	require.Len(t, inserts, 6)
+
+	prefix := "INSERT INTO device_temperatures (device_id, temperature, timestamp) VALUES "
+	assert.Equal(t, prefix+"('device_1', 'not a float64', 'not a datetime64')", inserts[0])
+	assert.Equal(t, prefix+"('device_1')", inserts[1])
+	assert.Equal(t, prefix+"(NULL, NULL, NULL)", inserts[2])
+	assert.Equal(t, prefix+"('', 21.5, '2026-01-02 03:04:05.006')", inserts[3])
+	assert.Equal(t, prefix+"('device_1', nan, '2026-01-02 03:04:05.006')", inserts[5])
+}
+
+func TestChaosConfigRejectsUnknownFault(t *testing.T) {
+	t.Setenv("CHAOS_FAULTS", "view_deletion, disk_full")
+	_, err := chaosConfigFromEnv(1000)
+	assert.ErrorContains(t, err, `unknown fault "disk_full"`)
+
+	t.Setenv("CHAOS_FAULTS", "view_deletion, ingestion_stall")
+	cfg, err := chaosConfigFromEnv(1000)
+	require.NoError(t, err)
+	assert.Equal(t, []string{faultViewDeletion, faultIngestionStall}, cfg.Faults)
+}
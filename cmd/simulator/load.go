@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+)
+
+// loadConfig configures a load test run
+type loadConfig struct {
+	EventsPerSec       int           // Target throughput across all streams once ramped up
+	Entities           int           // Entities per stream, 0 keeps the scenario's count
+	RampUp             time.Duration // Time to grow linearly from 0 to the target throughput
+	Duration           time.Duration // Total run time including the ramp-up
+	Workers            int           // Concurrent batch inserts
+	BatchSize          int           // Maximum rows per insert
+	AlertCheckInterval time.Duration
+	ReportFile         string // Optional path the JSON report is written to
+}
+
+// loadConfigFromEnv reads the load test configuration from environment variables
+func loadConfigFromEnv() loadConfig {
+	eventsPerSec, _ := strconv.Atoi(getEnv("LOAD_EVENTS_PER_SEC", "1000"))
+	entities, _ := strconv.Atoi(getEnv("LOAD_ENTITIES", "0"))
+	rampUpSec, _ := strconv.Atoi(getEnv("LOAD_RAMP_UP_SEC", "30"))
+	durationSec, _ := strconv.Atoi(getEnv("LOAD_DURATION_SEC", "300"))
+	workers, _ := strconv.Atoi(getEnv("LOAD_WORKERS", "4"))
+	batchSize, _ := strconv.Atoi(getEnv("LOAD_BATCH_SIZE", "500"))
+	alertCheckIntervalSec, _ := strconv.Atoi(getEnv("ALERT_CHECK_INTERVAL_SEC", "2"))
+
+	cfg := loadConfig{
+		EventsPerSec:       eventsPerSec,
+		Entities:           entities,
+		RampUp:             time.Duration(rampUpSec) * time.Second,
+		Duration:           time.Duration(durationSec) * time.Second,
+		Workers:            workers,
+		BatchSize:          batchSize,
+		AlertCheckInterval: time.Duration(alertCheckIntervalSec) * time.Second,
+		ReportFile:         getEnv("LOAD_REPORT_FILE", ""),
+	}
+	if cfg.EventsPerSec <= 0 {
+		cfg.EventsPerSec = 1000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.AlertCheckInterval <= 0 {
+		cfg.AlertCheckInterval = 2 * time.Second
+	}
+	if cfg.RampUp > cfg.Duration {
+		cfg.RampUp = cfg.Duration
+	}
+	return cfg
+}
+
+// targetRate returns the events per second to send at a point of the run
+func (cfg loadConfig) targetRate(elapsed time.Duration) float64 {
+	if cfg.RampUp > 0 && elapsed < cfg.RampUp {
+		return float64(cfg.EventsPerSec) * elapsed.Seconds() / cfg.RampUp.Seconds()
+	}
+	return float64(cfg.EventsPerSec)
+}
+
+// LatencySummary summarizes a latency distribution in milliseconds
+type LatencySummary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50Ms"`
+	P90   float64 `json:"p90Ms"`
+	P99   float64 `json:"p99Ms"`
+	Max   float64 `json:"maxMs"`
+}
+
+// APIStats counts the requests made to one gateway endpoint
+type APIStats struct {
+	Requests  int64          `json:"requests"`
+	Errors    int64          `json:"errors"` // Network errors and non-2xx responses
+	ErrorRate float64        `json:"errorRate"`
+	Latency   LatencySummary `json:"latency"`
+
+	latencies []time.Duration
+}
+
+// LoadReport is the outcome of a load test run
+type LoadReport struct {
+	Scenario          string               `json:"scenario"`
+	StartedAt         time.Time            `json:"startedAt"`
+	DurationSeconds   float64              `json:"durationSeconds"`
+	TargetEventsSec   int                  `json:"targetEventsPerSec"`
+	AchievedEventsSec float64              `json:"achievedEventsPerSec"` // Over the whole run
+	SteadyEventsSec   float64              `json:"steadyEventsPerSec"`   // After the ramp-up
+	EventsSent        int64                `json:"eventsSent"`
+	EventsFailed      int64                `json:"eventsFailed"`
+	AnomaliesSent     int64                `json:"anomaliesSent"`
+	BatchesSent       int64                `json:"batchesSent"`
+	BatchesFailed     int64                `json:"batchesFailed"`
+	InsertLatency     LatencySummary       `json:"insertLatency"`
+	AlertsObserved    int                  `json:"alertsObserved"`
+	AlertLatency      LatencySummary       `json:"alertLatency"` // From sending an anomaly to the alert firing for its entity
+	API               map[string]*APIStats `json:"api"`
+}
+
+// loadJob is a batch of rows for one stream, inserted by a worker
+type loadJob struct {
+	gen       *streamGenerator
+	rows      [][]interface{}
+	anomalies []string // Entities with an anomalous row in the batch
+}
+
+// loadRun holds the counters of a running load test
+type loadRun struct {
+	cfg   loadConfig
+	start time.Time
+
+	eventsSent    int64
+	eventsFailed  int64
+	anomaliesSent int64
+	batchesSent   int64
+	batchesFailed int64
+	steadyEvents  int64 // Events sent after the ramp-up
+
+	mu              sync.Mutex
+	insertLatencies []time.Duration
+	pending         map[string]time.Time // Entity -> send time of its oldest anomaly not alerted yet
+	alertLatencies  []time.Duration
+	alertsObserved  int
+	api             map[string]*APIStats
+}
+
+// runLoadTest sends events at the configured target rate with concurrent batch inserts until the
+// duration elapses or ctx is cancelled, while polling the gateway for the alerts they trigger
+func runLoadTest(ctx context.Context, conn driver.Conn, scenario *Scenario, generators []*streamGenerator,
+	alertGatewayURL string, cfg loadConfig) *LoadReport {
+	run := &loadRun{
+		cfg:     cfg,
+		start:   time.Now(),
+		pending: make(map[string]time.Time),
+		api:     make(map[string]*APIStats),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	logrus.Infof("Load test: %d events/sec across %d stream(s), %s ramp-up, %s duration, %d workers, batches of %d",
+		cfg.EventsPerSec, len(generators), cfg.RampUp, cfg.Duration, cfg.Workers, cfg.BatchSize)
+
+	jobs := make(chan loadJob, cfg.Workers*2)
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				run.insert(conn, job)
+			}
+		}()
+	}
+
+	var monitor sync.WaitGroup
+	monitor.Add(2)
+	go func() {
+		defer monitor.Done()
+		run.pollAlerts(ctx, alertGatewayURL)
+	}()
+	go func() {
+		defer monitor.Done()
+		run.logProgress(ctx)
+	}()
+
+	run.schedule(ctx, generators, jobs)
+	close(jobs)
+	workers.Wait()
+	monitor.Wait()
+
+	return run.report(scenario.Name)
+}
+
+// schedule generates rows at the target rate, spread round-robin over the streams and their entities,
+// and queues them in batches. When the workers can't keep up the queue blocks, so the achieved
+// throughput falls below the target rather than rows piling up in memory.
+func (r *loadRun) schedule(ctx context.Context, generators []*streamGenerator, jobs chan<- loadJob) {
+	const tick = 100 * time.Millisecond
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	entityIDs := make([][]string, len(generators))
+	cursors := make([]int, len(generators))
+	batches := make([]loadJob, len(generators))
+	for i, gen := range generators {
+		entityIDs[i] = gen.entityIDs()
+		batches[i] = loadJob{gen: gen}
+	}
+
+	flush := func(i int) bool {
+		if len(batches[i].rows) == 0 {
+			return true
+		}
+		select {
+		case jobs <- batches[i]:
+			batches[i] = loadJob{gen: generators[i]}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	streamIdx := 0
+	due := 0.0
+	last := r.start
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due += r.cfg.targetRate(now.Sub(r.start)) * now.Sub(last).Seconds()
+			last = now
+
+			for ; due >= 1; due-- {
+				i := streamIdx
+				streamIdx = (streamIdx + 1) % len(generators)
+
+				gen := generators[i]
+				entityID := entityIDs[i][cursors[i]]
+				cursors[i] = (cursors[i] + 1) % len(entityIDs[i])
+
+				anomaly := rand.Float64() < gen.stream.AnomalyRate
+				row, err := gen.row(entityID, anomaly)
+				if err != nil {
+					logrus.Errorf("Failed to generate row for %s: %v", gen.stream.Name, err)
+					continue
+				}
+				batches[i].rows = append(batches[i].rows, row)
+				if anomaly {
+					batches[i].anomalies = append(batches[i].anomalies, entityID)
+				}
+				if len(batches[i].rows) >= r.cfg.BatchSize && !flush(i) {
+					return
+				}
+			}
+
+			// Send partial batches every tick so rows don't wait for a batch to fill
+			for i := range batches {
+				if !flush(i) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// insert sends one batch and records its outcome
+func (r *loadRun) insert(conn driver.Conn, job loadJob) {
+	names := make([]string, len(job.gen.stream.Columns))
+	for i, column := range job.gen.stream.Columns {
+		names[i] = column.Name
+	}
+
+	sentAt := time.Now()
+	err := func() error {
+		batch, err := conn.PrepareBatch(context.Background(),
+			fmt.Sprintf("INSERT INTO %s (%s)", job.gen.stream.Name, strings.Join(names, ", ")))
+		if err != nil {
+			return fmt.Errorf("failed to prepare batch: %w", err)
+		}
+		defer batch.Abort()
+
+		for _, row := range job.rows {
+			if err := batch.Append(row...); err != nil {
+				return fmt.Errorf("failed to append data to batch: %w", err)
+			}
+		}
+		return batch.Send()
+	}()
+	elapsed := time.Since(sentAt)
+
+	if err != nil {
+		atomic.AddInt64(&r.batchesFailed, 1)
+		atomic.AddInt64(&r.eventsFailed, int64(len(job.rows)))
+		logrus.Errorf("Failed to insert batch of %d rows into %s: %v", len(job.rows), job.gen.stream.Name, err)
+		return
+	}
+
+	atomic.AddInt64(&r.batchesSent, 1)
+	atomic.AddInt64(&r.eventsSent, int64(len(job.rows)))
+	atomic.AddInt64(&r.anomaliesSent, int64(len(job.anomalies)))
+	if sentAt.Sub(r.start) >= r.cfg.RampUp {
+		atomic.AddInt64(&r.steadyEvents, int64(len(job.rows)))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.insertLatencies = append(r.insertLatencies, elapsed)
+	for _, entityID := range job.anomalies {
+		if _, ok := r.pending[entityID]; !ok {
+			r.pending[entityID] = sentAt
+		}
+	}
+}
+
+// pollAlerts polls the gateway for new alerts, measuring the latency from an entity's anomaly to its
+// alert, and acknowledges some of them so the acknowledge API is exercised too
+func (r *loadRun) pollAlerts(ctx context.Context, alertGatewayURL string) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(r.cfg.AlertCheckInterval)
+	defer ticker.Stop()
+
+	seen := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var alerts []Alert
+			if err := r.getJSON(client, "GET /api/alerts", alertGatewayURL+"/api/alerts", &alerts); err != nil {
+				logrus.Warnf("Failed to get alerts: %v", err)
+				continue
+			}
+
+			for _, alert := range alerts {
+				// Alerts from before the run didn't come from its anomalies
+				if seen[alert.ID] || alert.TriggeredAt.Before(r.start) {
+					continue
+				}
+				seen[alert.ID] = true
+				r.observeAlert(alert)
+
+				if !alert.Acknowledged && rand.Intn(3) == 0 {
+					go r.acknowledge(client, alertGatewayURL, alert.ID)
+				}
+			}
+		}
+	}
+}
+
+// observeAlert records the latency of a new alert from the oldest pending anomaly of its entity
+func (r *loadRun) observeAlert(alert Alert) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.alertsObserved++
+	entityID := alertEntityID(alert.ID)
+	sentAt, ok := r.pending[entityID]
+	if !ok || alert.TriggeredAt.Before(sentAt) {
+		return
+	}
+	r.alertLatencies = append(r.alertLatencies, alert.TriggeredAt.Sub(sentAt))
+	delete(r.pending, entityID)
+}
+
+// alertEntityID extracts the entity ID from an alert ID of the form rule_id:entity_id:firing_seq
+func alertEntityID(alertID string) string {
+	first := strings.Index(alertID, ":")
+	last := strings.LastIndex(alertID, ":")
+	if first < 0 || last <= first {
+		return ""
+	}
+	return alertID[first+1 : last]
+}
+
+// acknowledge acknowledges an alert, recording the request in the API stats
+func (r *loadRun) acknowledge(client *http.Client, alertGatewayURL, alertID string) {
+	data, _ := json.Marshal(map[string]string{
+		"acknowledgedBy": "simulator",
+		"comment":        "Acknowledged by load test",
+	})
+
+	startedAt := time.Now()
+	resp, err := postWithRetry(client, fmt.Sprintf("%s/api/alerts/%s/acknowledge", alertGatewayURL, alertID), data, uuid.NewString())
+	ok := err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+	if resp != nil {
+		resp.Body.Close()
+	}
+	r.recordAPI("POST /api/alerts/:id/acknowledge", time.Since(startedAt), ok)
+}
+
+// getJSON gets a gateway endpoint and decodes its JSON response, recording the request in the API stats
+func (r *loadRun) getJSON(client *http.Client, endpoint, url string, v interface{}) error {
+	startedAt := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		r.recordAPI(endpoint, time.Since(startedAt), false)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		r.recordAPI(endpoint, time.Since(startedAt), false)
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	r.recordAPI(endpoint, time.Since(startedAt), err == nil)
+	return err
+}
+
+// recordAPI records the outcome of a gateway request
+func (r *loadRun) recordAPI(endpoint string, latency time.Duration, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, exists := r.api[endpoint]
+	if !exists {
+		stats = &APIStats{}
+		r.api[endpoint] = stats
+	}
+	stats.Requests++
+	if !ok {
+		stats.Errors++
+	}
+	stats.latencies = append(stats.latencies, latency)
+}
+
+// logProgress periodically logs the throughput achieved so far
+func (r *loadRun) logProgress(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	var lastEvents int64
+	lastAt := r.start
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			events := atomic.LoadInt64(&r.eventsSent)
+			rate := float64(events-lastEvents) / now.Sub(lastAt).Seconds()
+			logrus.Infof("Load test: %.0f events/sec (target %.0f), %d sent, %d failed",
+				rate, r.cfg.targetRate(now.Sub(r.start)), events, atomic.LoadInt64(&r.eventsFailed))
+			lastEvents, lastAt = events, now
+		}
+	}
+}
+
+// report summarizes the run
+func (r *loadRun) report(scenarioName string) *LoadReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := time.Since(r.start)
+	report := &LoadReport{
+		Scenario:        scenarioName,
+		StartedAt:       r.start,
+		DurationSeconds: elapsed.Seconds(),
+		TargetEventsSec: r.cfg.EventsPerSec,
+		EventsSent:      r.eventsSent,
+		EventsFailed:    r.eventsFailed,
+		AnomaliesSent:   r.anomaliesSent,
+		BatchesSent:     r.batchesSent,
+		BatchesFailed:   r.batchesFailed,
+		InsertLatency:   summarizeLatencies(r.insertLatencies),
+		AlertsObserved:  r.alertsObserved,
+		AlertLatency:    summarizeLatencies(r.alertLatencies),
+		API:             r.api,
+	}
+	if elapsed > 0 {
+		report.AchievedEventsSec = float64(r.eventsSent) / elapsed.Seconds()
+	}
+	if steady := elapsed - r.cfg.RampUp; steady > 0 {
+		report.SteadyEventsSec = float64(r.steadyEvents) / steady.Seconds()
+	}
+	for _, stats := range r.api {
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+		stats.Latency = summarizeLatencies(stats.latencies)
+	}
+	return report
+}
+
+// summarizeLatencies computes percentiles of a latency distribution
+func summarizeLatencies(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		idx := int(p*float64(len(sorted))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		return float64(sorted[idx]) / float64(time.Millisecond)
+	}
+
+	return LatencySummary{
+		Count: len(sorted),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   float64(sorted[len(sorted)-1]) / float64(time.Millisecond),
+	}
+}
+
+// logLoadReport prints the report and writes it as JSON to the configured report file
+func logLoadReport(report *LoadReport, reportFile string) {
+	endpoints := make([]string, 0, len(report.API))
+	for endpoint := range report.API {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	var api strings.Builder
+	for _, endpoint := range endpoints {
+		stats := report.API[endpoint]
+		fmt.Fprintf(&api, "    %-36s %d requests, %.2f%% errors, p50 %.0fms, p99 %.0fms\n",
+			endpoint, stats.Requests, stats.ErrorRate*100, stats.Latency.P50, stats.Latency.P99)
+	}
+
+	logrus.Infof("📊 LOAD TEST REPORT (%s, %.0fs):\n"+
+		"  Throughput:     %.0f events/sec overall, %.0f after ramp-up (target %d)\n"+
+		"  Events:         %d sent, %d failed, %d anomalies\n"+
+		"  Batches:        %d sent, %d failed\n"+
+		"  Insert latency: p50 %.0fms, p90 %.0fms, p99 %.0fms, max %.0fms\n"+
+		"  Alerts:         %d observed, %d matched to an anomaly\n"+
+		"  Alert latency:  p50 %.0fms, p90 %.0fms, p99 %.0fms, max %.0fms\n"+
+		"  API:\n%s",
+		report.Scenario, report.DurationSeconds,
+		report.AchievedEventsSec, report.SteadyEventsSec, report.TargetEventsSec,
+		report.EventsSent, report.EventsFailed, report.AnomaliesSent,
+		report.BatchesSent, report.BatchesFailed,
+		report.InsertLatency.P50, report.InsertLatency.P90, report.InsertLatency.P99, report.InsertLatency.Max,
+		report.AlertsObserved, report.AlertLatency.Count,
+		report.AlertLatency.P50, report.AlertLatency.P90, report.AlertLatency.P99, report.AlertLatency.Max,
+		api.String())
+
+	if reportFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logrus.Errorf("Failed to marshal load test report: %v", err)
+		return
+	}
+	if err := os.WriteFile(reportFile, data, 0o644); err != nil {
+		logrus.Errorf("Failed to write load test report to %s: %v", reportFile, err)
+		return
+	}
+	logrus.Infof("Wrote load test report to %s", reportFile)
+}
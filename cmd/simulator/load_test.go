@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTargetRateRampsUp(t *testing.T) {
+	cfg := loadConfig{EventsPerSec: 1000, RampUp: 10 * time.Second}
+
+	assert.Equal(t, 0.0, cfg.targetRate(0))
+	assert.Equal(t, 500.0, cfg.targetRate(5*time.Second))
+	assert.Equal(t, 1000.0, cfg.targetRate(10*time.Second))
+	assert.Equal(t, 1000.0, cfg.targetRate(time.Minute))
+}
+
+func TestSummarizeLatencies(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	summary := summarizeLatencies(latencies)
+	assert.Equal(t, 100, summary.Count)
+	assert.Equal(t, 50.0, summary.P50)
+	assert.Equal(t, 90.0, summary.P90)
+	assert.Equal(t, 99.0, summary.P99)
+	assert.Equal(t, 100.0, summary.Max)
+
+	assert.Equal(t, LatencySummary{}, summarizeLatencies(nil))
+}
+
+func TestLoadAlertLatencyMatchesEntityAnomaly(t *testing.T) {
+	sentAt := time.Now()
+	run := &loadRun{pending: map[string]time.Time{"device_1": sentAt}}
+
+	run.observeAlert(Alert{ID: "rule-1:device_1:3", TriggeredAt: sentAt.Add(800 * time.Millisecond)})
+	run.observeAlert(Alert{ID: "rule-1:device_2:1", TriggeredAt: sentAt.Add(time.Second)})
+
+	assert.Equal(t, 2, run.alertsObserved)
+	assert.Equal(t, []time.Duration{800 * time.Millisecond}, run.alertLatencies)
+	assert.Empty(t, run.pending)
+}
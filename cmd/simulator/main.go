@@ -4,41 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	proton "github.com/timeplus-io/proton-go-driver/v2"
 	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
 )
 
 const (
-	defaultDeviceCount = 5
-	defaultIntervalMs  = 1000 // 1 second
-	streamName         = "device_temperatures"
+	defaultScenario   = "temperature"
+	defaultIntervalMs = 1000 // 1 second
 )
 
-// DeviceTemperature represents a temperature reading from a device
-type DeviceTemperature struct {
-	DeviceID    string    `json:"device_id"`
-	Temperature float64   `json:"temperature"`
-	Timestamp   time.Time `json:"timestamp"`
-}
-
-// RuleRequest represents a request to create a rule
-type RuleRequest struct {
-	Name            string `json:"name"`
-	Description     string `json:"description"`
-	Query           string `json:"query"`
-	Severity        string `json:"severity"`
-	ThrottleMinutes int    `json:"throttleMinutes"`
-	SourceStream    string `json:"sourceStream"`
-}
-
 // Alert represents an alert returned from the API
 type Alert struct {
 	ID             string     `json:"id"`
@@ -53,32 +41,129 @@ type Alert struct {
 }
 
 func main() {
+	assertRun := flag.Bool("assert", false,
+		"Run for ASSERT_DURATION_SEC, then check each rule's alerts and exit with status 1 on a mismatch")
+	flag.Parse()
+
 	// Initialize random number generator
 	rand.Seed(time.Now().UnixNano())
 
 	// Get configuration from environment variables
 	alertGatewayURL := getEnv("ALERT_GATEWAY_URL", "http://localhost:8080")
-	deviceCount, _ := strconv.Atoi(getEnv("DEVICE_COUNT", fmt.Sprintf("%d", defaultDeviceCount)))
+	scenarioName := getEnv("SCENARIO", defaultScenario)
+	mode := getEnv("MODE", "demo")
 	intervalMs, _ := strconv.Atoi(getEnv("INTERVAL_MS", fmt.Sprintf("%d", defaultIntervalMs)))
 	checkAlerts, _ := strconv.ParseBool(getEnv("CHECK_ALERTS", "true"))
 	alertCheckIntervalSec, _ := strconv.Atoi(getEnv("ALERT_CHECK_INTERVAL_SEC", "10"))
 
+	scenario, err := loadScenario(scenarioName)
+	if err != nil {
+		logrus.Fatalf("Failed to load scenario: %v", err)
+	}
+
+	// DEVICE_COUNT overrides the entity count of every stream
+	if deviceCount, err := strconv.Atoi(getEnv("DEVICE_COUNT", "")); err == nil && deviceCount > 0 {
+		for i := range scenario.Streams {
+			scenario.Streams[i].Entities.Count = deviceCount
+		}
+	}
+
+	var loadCfg loadConfig
+	var chaosCfg chaosConfig
+	var assertCfg assertConfig
+	if *assertRun && mode != "demo" {
+		logrus.Fatalf("--assert can't be combined with MODE=%s", mode)
+	}
+	switch mode {
+	case "demo":
+		if !*assertRun {
+			break
+		}
+		if assertCfg, err = assertConfigFromEnv(intervalMs); err != nil {
+			logrus.Fatalf("Invalid assert configuration: %v", err)
+		}
+		// Anomalies are sent in regular bursts instead, so every entity gets some
+		for i := range scenario.Streams {
+			scenario.Streams[i].AnomalyRate = 0
+		}
+	case "load":
+		loadCfg = loadConfigFromEnv()
+		if loadCfg.Entities > 0 {
+			for i := range scenario.Streams {
+				scenario.Streams[i].Entities.Count = loadCfg.Entities
+			}
+		}
+	case "chaos":
+		if chaosCfg, err = chaosConfigFromEnv(intervalMs); err != nil {
+			logrus.Fatalf("Invalid chaos configuration: %v", err)
+		}
+		// Anomalies are only sent by the recovery probes, so alerts can be traced back to them
+		for i := range scenario.Streams {
+			scenario.Streams[i].AnomalyRate = 0
+		}
+	default:
+		logrus.Fatalf("Unknown MODE %q, expected demo, load or chaos", mode)
+	}
+
+	logrus.Infof("Running scenario %s: %s", scenario.Name, scenario.Description)
+
 	// Connect to Timeplus
 	conn := connectToTimeplus()
 
-	// Create stream if it doesn't exist
-	if err := createTemperatureStream(conn); err != nil {
-		logrus.Fatalf("Failed to create stream: %v", err)
+	// Create streams if they don't exist
+	for i := range scenario.Streams {
+		if err := createStream(conn, &scenario.Streams[i]); err != nil {
+			logrus.Fatalf("Failed to create stream %s: %v", scenario.Streams[i].Name, err)
+		}
 	}
 
-	// Create and start sample rules FIRST
-	createdRuleIDs, ok := createSampleRules(alertGatewayURL)
+	// Create and start the scenario's rules FIRST
+	createdRuleIDs, ok := createSampleRules(alertGatewayURL, scenario.Rules)
 	if !ok {
 		logrus.Fatal("Failed to create or start sample rules. Exiting simulator.")
 	}
 
-	logrus.Infof("Starting data generation with %d devices, sending data every %d ms",
-		deviceCount, intervalMs)
+	generators := make([]*streamGenerator, len(scenario.Streams))
+	for i := range scenario.Streams {
+		generators[i] = newStreamGenerator(&scenario.Streams[i])
+	}
+
+	if mode == "load" {
+		// Interrupting a load test ends it early but still reports what was measured
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		logLoadReport(runLoadTest(ctx, conn, scenario, generators, alertGatewayURL, loadCfg), loadCfg.ReportFile)
+		return
+	}
+
+	if mode == "chaos" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		report := runChaos(ctx, conn, scenario, generators, alertGatewayURL, createdRuleIDs, chaosCfg)
+		logChaosReport(report, chaosCfg.ReportFile)
+		if !report.Passed {
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *assertRun {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		report := runAssertions(ctx, conn, scenario, generators, alertGatewayURL, createdRuleIDs, assertCfg)
+		logAssertReport(report, assertCfg.ReportFile)
+		if !report.Passed {
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, stream := range scenario.Streams {
+		logrus.Infof("Generating data for stream %s with %d entities, sending data every %d ms",
+			stream.Name, stream.Entities.Count, intervalMs)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -95,23 +180,9 @@ func main() {
 	for {
 		select {
 		case <-ticker.C:
-			// Generate and send data for each device
-			for i := 1; i <= deviceCount; i++ {
-				deviceID := fmt.Sprintf("device_%d", i)
-				temp := generateTemperature(deviceID)
-				if err := sendTemperatureData(ctx, conn, temp); err != nil {
-					logrus.Errorf("Error sending data: %v", err)
-				}
-
-				// Occasionally generate anomalous temperatures to trigger alerts
-				if rand.Intn(50) == 0 {
-					anomalyTemp := generateAnomalyTemperature(deviceID)
-					if err := sendTemperatureData(ctx, conn, anomalyTemp); err != nil {
-						logrus.Errorf("Error sending anomaly data: %v", err)
-					} else {
-						logrus.Warnf("🔥 Sent anomaly data: %s - %.2f°C (should trigger alert)",
-							anomalyTemp.DeviceID, anomalyTemp.Temperature)
-					}
+			for _, gen := range generators {
+				if err := sendStreamData(ctx, conn, gen); err != nil {
+					logrus.Errorf("Error sending data to %s: %v", gen.stream.Name, err)
 				}
 			}
 		}
@@ -126,8 +197,19 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// connectToTimeplus connects to the Timeplus instance
+// connectToTimeplus connects to the Timeplus instance, exiting when it can't be reached
 func connectToTimeplus() driver.Conn {
+	conn, err := openTimeplus(10)
+	if err != nil {
+		logrus.Fatalf("Failed to connect to Timeplus: %v", err)
+	}
+
+	logrus.Info("Connected to Timeplus")
+	return conn
+}
+
+// openTimeplus opens a connection to the Timeplus instance, pinging it up to attempts times
+func openTimeplus(attempts int) (driver.Conn, error) {
 	// Get Timeplus connection details from environment variables
 	tpAddress := getEnv("TIMEPLUS_ADDRESS", "localhost:8464")
 	tpUser := getEnv("TIMEPLUS_USER", "test")
@@ -149,35 +231,34 @@ func connectToTimeplus() driver.Conn {
 			Method: proton.CompressionLZ4,
 		},
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// Retry connection a few times
-	for i := 0; i < 10; i++ {
+	for i := 0; i < attempts; i++ {
 		err = conn.Ping(ctx)
 		if err == nil {
-			break
+			return conn, nil
 		}
-		logrus.Warnf("Failed to connect to Timeplus (attempt %d/10): %v", i+1, err)
+		logrus.Warnf("Failed to connect to Timeplus (attempt %d/%d): %v", i+1, attempts, err)
 		time.Sleep(3 * time.Second)
 	}
 
-	if err != nil {
-		logrus.Fatalf("Failed to connect to Timeplus: %v", err)
-	}
-
-	logrus.Info("Connected to Timeplus")
-	return conn
+	conn.Close()
+	return nil, err
 }
 
-// createTemperatureStream creates the device_temperatures stream in Timeplus
-func createTemperatureStream(conn driver.Conn) error {
+// createStream creates a scenario stream in Timeplus if it doesn't exist yet
+func createStream(conn driver.Conn, stream *StreamScenario) error {
 	ctx := context.Background()
 
 	// Check if stream exists using SHOW STREAMS
-	query := fmt.Sprintf("SHOW STREAMS LIKE '%s'", streamName)
+	query := fmt.Sprintf("SHOW STREAMS LIKE '%s'", stream.Name)
 	rows, err := conn.Query(ctx, query)
 	if err != nil {
 		return fmt.Errorf("error executing SHOW STREAMS: %w", err)
@@ -187,7 +268,7 @@ func createTemperatureStream(conn driver.Conn) error {
 	if rows.Next() {
 		// Stream already exists
 		if rows.Err() == nil {
-			logrus.Infof("Stream %s already exists", streamName)
+			logrus.Infof("Stream %s already exists", stream.Name)
 			return nil
 		} else {
 			return fmt.Errorf("error checking rows from SHOW STREAMS: %w", rows.Err())
@@ -198,13 +279,11 @@ func createTemperatureStream(conn driver.Conn) error {
 	}
 
 	// Create the stream
-	createSQL := fmt.Sprintf(`
-		CREATE STREAM %s (
-			device_id string,
-			temperature float64,
-			timestamp datetime64
-		)
-	`, streamName)
+	columns := make([]string, len(stream.Columns))
+	for i, column := range stream.Columns {
+		columns[i] = fmt.Sprintf("%s %s", column.Name, column.Type)
+	}
+	createSQL := fmt.Sprintf("CREATE STREAM %s (%s)", stream.Name, strings.Join(columns, ", "))
 
 	// Use Exec instead of ExecContext
 	err = conn.Exec(ctx, createSQL)
@@ -212,69 +291,46 @@ func createTemperatureStream(conn driver.Conn) error {
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
 
-	logrus.Infof("Created stream: %s", streamName)
+	logrus.Infof("Created stream: %s", stream.Name)
 	return nil
 }
 
-// generateTemperature generates a realistic temperature for a device
-func generateTemperature(deviceID string) DeviceTemperature {
-	// Base temperature is 20-25°C, with some randomization based on device ID
-	deviceNum, _ := strconv.Atoi(deviceID[7:])
-	baseTemp := 20.0 + float64(deviceNum%5)
-
-	// Add some noise
-	noise := rand.Float64()*2.0 - 1.0 // -1.0 to 1.0
-
-	return DeviceTemperature{
-		DeviceID:    deviceID,
-		Temperature: baseTemp + noise,
-		Timestamp:   time.Now(),
-	}
-}
-
-// generateAnomalyTemperature creates an anomalous temperature reading to trigger alerts
-func generateAnomalyTemperature(deviceID string) DeviceTemperature {
-	// For device_1, generate high temperatures (>25°C)
-	// For other devices, generate either very high (>30°C) or very low (<19°C) temperatures
-	deviceNum, _ := strconv.Atoi(deviceID[7:])
-	var temperature float64
-
-	if deviceNum == 1 {
-		// For device_1 specific alert
-		temperature = 26.0 + rand.Float64()*4.0 // 26-30°C
-	} else if rand.Intn(2) == 0 {
-		// High temperature alert
-		temperature = 31.0 + rand.Float64()*4.0 // 31-35°C
-	} else {
-		// Low temperature alert
-		temperature = 16.0 + rand.Float64()*2.5 // 16-18.5°C
-	}
-
-	return DeviceTemperature{
-		DeviceID:    deviceID,
-		Temperature: temperature,
-		Timestamp:   time.Now(),
+// sendStreamData inserts one row per entity into a stream, plus an anomalous row for entities picked
+// by the stream's anomaly rate, in a single batch
+func sendStreamData(ctx context.Context, conn driver.Conn, gen *streamGenerator) error {
+	names := make([]string, len(gen.stream.Columns))
+	for i, column := range gen.stream.Columns {
+		names[i] = column.Name
 	}
-}
 
-// sendTemperatureData inserts temperature data into Timeplus
-func sendTemperatureData(ctx context.Context, conn driver.Conn, temp DeviceTemperature) error {
 	// Prepare a batch for insertion
-	query := fmt.Sprintf("INSERT INTO %s (device_id, temperature, timestamp)", streamName)
+	query := fmt.Sprintf("INSERT INTO %s (%s)", gen.stream.Name, strings.Join(names, ", "))
 	batch, err := conn.PrepareBatch(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to prepare batch: %w", err)
 	}
 	defer batch.Abort()
 
-	// Add values to the batch
-	err = batch.Append(
-		temp.DeviceID,
-		temp.Temperature,
-		temp.Timestamp,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to append data to batch: %w", err)
+	for _, entityID := range gen.entityIDs() {
+		row, err := gen.row(entityID, false)
+		if err != nil {
+			return err
+		}
+		if err := batch.Append(row...); err != nil {
+			return fmt.Errorf("failed to append data to batch: %w", err)
+		}
+
+		// Occasionally generate anomalous rows to trigger alerts
+		if rand.Float64() < gen.stream.AnomalyRate {
+			anomaly, err := gen.row(entityID, true)
+			if err != nil {
+				return err
+			}
+			if err := batch.Append(anomaly...); err != nil {
+				return fmt.Errorf("failed to append anomaly to batch: %w", err)
+			}
+			logrus.Warnf("🔥 Sent anomaly data to %s: %s (should trigger alert)", gen.stream.Name, formatRow(names, anomaly))
+		}
 	}
 
 	// Send the batch
@@ -285,36 +341,25 @@ func sendTemperatureData(ctx context.Context, conn driver.Conn, temp DeviceTempe
 	return nil
 }
 
-// createSampleRules creates and starts sample alert rules
-// Returns the created rule IDs and a boolean success indicator
-func createSampleRules(alertGatewayURL string) ([]string, bool) {
-	rules := []RuleRequest{
-		{
-			Name:            "High Temperature Alert",
-			Description:     "Alert when any device temperature exceeds 30°C",
-			Query:           fmt.Sprintf("SELECT * FROM %s WHERE temperature > 30", streamName),
-			Severity:        "critical",
-			ThrottleMinutes: 1,
-			SourceStream:    streamName,
-		},
-		{
-			Name:            "Device 1 Temperature Alert",
-			Description:     "Alert when device_1 temperature exceeds 25°C",
-			Query:           fmt.Sprintf("SELECT * FROM %s WHERE device_id = 'device_1' AND temperature > 25", streamName),
-			Severity:        "warning",
-			ThrottleMinutes: 2,
-			SourceStream:    streamName,
-		},
-		{
-			Name:            "Low Temperature Alert",
-			Description:     "Alert when any device temperature drops below 19°C",
-			Query:           fmt.Sprintf("SELECT * FROM %s WHERE temperature < 19", streamName),
-			Severity:        "info",
-			ThrottleMinutes: 5,
-			SourceStream:    streamName,
-		},
+// formatRow formats generated column values as name=value pairs, leaving out timestamps
+func formatRow(names []string, values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			continue
+		case float64:
+			parts = append(parts, fmt.Sprintf("%s=%.2f", names[i], v))
+		default:
+			parts = append(parts, fmt.Sprintf("%s=%v", names[i], v))
+		}
 	}
+	return strings.Join(parts, " ")
+}
 
+// createSampleRules creates and starts the scenario's alert rules
+// Returns the created rule IDs and a boolean success indicator
+func createSampleRules(alertGatewayURL string, rules []RuleRequest) ([]string, bool) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	createdRuleIDs := []string{}
 	allCreated := true
@@ -328,7 +373,9 @@ func createSampleRules(alertGatewayURL string) ([]string, bool) {
 			continue
 		}
 
-		resp, err := client.Post(alertGatewayURL+"/api/rules", "application/json", bytes.NewBuffer(data))
+		// Retries reuse the same Idempotency-Key so a request that timed out after the rule
+		// was created doesn't create it a second time
+		resp, err := postWithRetry(client, alertGatewayURL+"/api/rules", data, uuid.NewString())
 		if err != nil {
 			logrus.Errorf("Failed POST request to create rule '%s': %v", rule.Name, err)
 			allCreated = false
@@ -467,14 +514,12 @@ func monitorAlertsForRules(ctx context.Context, alertGatewayURL string, ruleIDs
 					"  Rule:        %s (%s)\n"+
 					"  Severity:    %s\n"+
 					"  Triggered:   %s\n"+
-					"  Device:      %s\n"+
-					"  Temperature: %.2f°C\n",
+					"  Data:        %s\n",
 					alert.ID,
 					alert.RuleName, alert.RuleID,
 					alert.Severity,
 					alert.TriggeredAt.Format(time.RFC3339),
-					getValueAsString(alertData, "parsed_data", "device_id"),
-					getValueAsFloat(alertData, "parsed_data", "temperature"),
+					formatAlertData(alertData),
 				)
 
 				// Randomly acknowledge some alerts
@@ -500,7 +545,7 @@ func acknowledgeAlert(client *http.Client, alertGatewayURL, alertID string) {
 	}
 
 	ackURL := fmt.Sprintf("%s/api/alerts/%s/acknowledge", alertGatewayURL, alertID)
-	resp, err := client.Post(ackURL, "application/json", bytes.NewBuffer(data))
+	resp, err := postWithRetry(client, ackURL, data, uuid.NewString())
 	if err != nil {
 		logrus.Errorf("Failed to acknowledge alert %s: %v", alertID, err)
 		return
@@ -514,50 +559,56 @@ func acknowledgeAlert(client *http.Client, alertGatewayURL, alertID string) {
 	}
 }
 
-// getValueAsString safely extracts a string value from nested maps
-func getValueAsString(data map[string]interface{}, keys ...string) string {
-	current := data
-	for i, key := range keys {
-		if i == len(keys)-1 {
-			if str, ok := current[key].(string); ok {
-				return str
-			}
-			return ""
+// postWithRetry posts JSON to the gateway, retrying network errors and server errors a few times.
+// Every attempt carries the same Idempotency-Key so the gateway applies the request only once.
+func postWithRetry(client *http.Client, url string, data []byte, idempotencyKey string) (*http.Response, error) {
+	const maxAttempts = 3
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+		if err != nil {
+			return nil, err
 		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
 
-		if next, ok := current[key].(map[string]interface{}); ok {
-			current = next
-		} else {
-			return ""
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
 		}
-	}
-	return ""
-}
 
-// getValueAsFloat safely extracts a float value from nested maps
-func getValueAsFloat(data map[string]interface{}, keys ...string) float64 {
-	current := data
-	for i, key := range keys {
-		if i == len(keys)-1 {
-			switch v := current[key].(type) {
-			case float64:
-				return v
-			case float32:
-				return float64(v)
-			case int:
-				return float64(v)
-			case int64:
-				return float64(v)
-			default:
-				return 0
+		if attempt < maxAttempts {
+			if err != nil {
+				logrus.Warnf("POST %s failed (attempt %d/%d): %v", url, attempt, maxAttempts, err)
+			} else {
+				logrus.Warnf("POST %s returned status %d (attempt %d/%d)", url, resp.StatusCode, attempt, maxAttempts)
+				resp.Body.Close()
 			}
+			time.Sleep(time.Duration(attempt) * time.Second)
 		}
+	}
+	return resp, err
+}
 
-		if next, ok := current[key].(map[string]interface{}); ok {
-			current = next
-		} else {
-			return 0
-		}
+// formatAlertData formats the parsed triggering data of an alert as sorted name=value pairs
+func formatAlertData(alertData map[string]interface{}) string {
+	parsed, ok := alertData["parsed_data"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	keys := make([]string, 0, len(parsed))
+	for key := range parsed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, parsed[key]))
 	}
-	return 0
+	return strings.Join(parts, " ")
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed scenarios/*.yaml
+var builtinScenarios embed.FS
+
+// Scenario describes the data a simulator run generates and the rules it creates to alert on it
+type Scenario struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Streams     []StreamScenario `yaml:"streams"`
+	Rules       []RuleRequest    `yaml:"rules"`
+}
+
+// StreamScenario describes a stream, its entities and how each of its columns is generated
+type StreamScenario struct {
+	Name     string         `yaml:"name"`
+	Entities EntityScenario `yaml:"entities"`
+	Columns  []ColumnSpec   `yaml:"columns"`
+
+	// Chance per entity and tick of sending an extra row that uses the anomaly generators
+	AnomalyRate float64 `yaml:"anomalyRate"`
+}
+
+// EntityScenario describes the entities that report to a stream. Every tick one row is sent per entity.
+type EntityScenario struct {
+	Count  int    `yaml:"count"`
+	Prefix string `yaml:"prefix"` // Entity IDs are the prefix followed by 1..count
+}
+
+// ColumnSpec is a column of a simulated stream
+type ColumnSpec struct {
+	Name      string     `yaml:"name"`
+	Type      string     `yaml:"type"`
+	Generator Generator  `yaml:"generator"`
+	Anomaly   *Generator `yaml:"anomaly,omitempty"` // Generator used for anomalous rows, defaults to Generator
+}
+
+// Generator produces column values. Which fields apply depends on the kind:
+//
+//	constant  value
+//	uniform   min, max
+//	normal    mean, stddev
+//	walk      min, max, step: random walk per entity kept within [min, max]
+//	choice    values, optional weights
+//	oneOf     options: picks one of the nested generators
+//	entity    the entity ID of the row
+//	now       the current time
+//	uuid      a random UUID
+type Generator struct {
+	Kind    string        `yaml:"kind"`
+	Value   interface{}   `yaml:"value,omitempty"`
+	Min     float64       `yaml:"min,omitempty"`
+	Max     float64       `yaml:"max,omitempty"`
+	Mean    float64       `yaml:"mean,omitempty"`
+	StdDev  float64       `yaml:"stddev,omitempty"`
+	Step    float64       `yaml:"step,omitempty"`
+	Values  []interface{} `yaml:"values,omitempty"`
+	Weights []float64     `yaml:"weights,omitempty"`
+	Options []Generator   `yaml:"options,omitempty"`
+}
+
+// RuleRequest represents a request to create a rule
+type RuleRequest struct {
+	Name            string                 `yaml:"name" json:"name"`
+	Description     string                 `yaml:"description" json:"description"`
+	Type            string                 `yaml:"type,omitempty" json:"type,omitempty"`
+	Spec            map[string]interface{} `yaml:"spec,omitempty" json:"spec,omitempty"`
+	Query           string                 `yaml:"query,omitempty" json:"query,omitempty"`
+	Severity        string                 `yaml:"severity" json:"severity"`
+	ThrottleMinutes int                    `yaml:"throttleMinutes" json:"throttleMinutes"`
+	EntityIDColumns string                 `yaml:"entityIdColumns,omitempty" json:"entityIdColumns,omitempty"`
+	SourceStream    string                 `yaml:"sourceStream,omitempty" json:"sourceStream,omitempty"`
+
+	// What an assertion run expects of the rule's alerts, not sent to the gateway
+	Expect *RuleExpectation `yaml:"expect,omitempty" json:"-"`
+}
+
+// RuleExpectation bounds the number of alerts a rule fires during an assertion run
+type RuleExpectation struct {
+	MinAlerts *int `yaml:"minAlerts,omitempty"` // Defaults to 1 for query rules and 0 for generated rule types
+	MaxAlerts *int `yaml:"maxAlerts,omitempty"` // Unlimited by default
+}
+
+// columnTypes are the column types the simulator can generate values for
+var columnTypes = map[string]bool{
+	"string":        true,
+	"float64":       true,
+	"int64":         true,
+	"bool":          true,
+	"datetime64":    true,
+	"datetime64(3)": true,
+}
+
+// loadScenario loads a built-in scenario by name, or a scenario file by path
+func loadScenario(nameOrPath string) (*Scenario, error) {
+	data, err := builtinScenarios.ReadFile(path.Join("scenarios", nameOrPath+".yaml"))
+	if err != nil {
+		data, err = os.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q is neither a built-in scenario (%s) nor a readable file: %w",
+				nameOrPath, strings.Join(builtinScenarioNames(), ", "), err)
+		}
+	}
+	return parseScenario(data)
+}
+
+// builtinScenarioNames lists the names of the embedded scenarios
+func builtinScenarioNames() []string {
+	entries, _ := builtinScenarios.ReadDir("scenarios")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	return names
+}
+
+// parseScenario decodes and validates a scenario definition
+func parseScenario(data []byte) (*Scenario, error) {
+	var scenario Scenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %q: %w", scenario.Name, err)
+	}
+	return &scenario, nil
+}
+
+// validate checks that every stream and generator of the scenario can be used
+func (s *Scenario) validate() error {
+	if len(s.Streams) == 0 {
+		return fmt.Errorf("at least one stream is required")
+	}
+
+	for _, stream := range s.Streams {
+		if stream.Name == "" {
+			return fmt.Errorf("stream name is required")
+		}
+		if stream.Entities.Count <= 0 {
+			return fmt.Errorf("stream %s: entities.count must be positive", stream.Name)
+		}
+		if stream.AnomalyRate < 0 || stream.AnomalyRate > 1 {
+			return fmt.Errorf("stream %s: anomalyRate must be between 0 and 1", stream.Name)
+		}
+		if len(stream.Columns) == 0 {
+			return fmt.Errorf("stream %s: at least one column is required", stream.Name)
+		}
+		for _, column := range stream.Columns {
+			if !columnTypes[column.Type] {
+				return fmt.Errorf("stream %s: column %s has unsupported type %q", stream.Name, column.Name, column.Type)
+			}
+			if err := column.Generator.validate(); err != nil {
+				return fmt.Errorf("stream %s: column %s: %w", stream.Name, column.Name, err)
+			}
+			if column.Anomaly != nil {
+				if err := column.Anomaly.validate(); err != nil {
+					return fmt.Errorf("stream %s: column %s anomaly: %w", stream.Name, column.Name, err)
+				}
+			}
+		}
+	}
+
+	for _, rule := range s.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule name is required")
+		}
+		if rule.Query == "" && rule.Type == "" {
+			return fmt.Errorf("rule %s: either query or type is required", rule.Name)
+		}
+		if expect := rule.Expect; expect != nil {
+			if (expect.MinAlerts != nil && *expect.MinAlerts < 0) || (expect.MaxAlerts != nil && *expect.MaxAlerts < 0) {
+				return fmt.Errorf("rule %s: expected alert counts can't be negative", rule.Name)
+			}
+			if expect.MinAlerts != nil && expect.MaxAlerts != nil && *expect.MaxAlerts < *expect.MinAlerts {
+				return fmt.Errorf("rule %s: expect.maxAlerts must be at least expect.minAlerts", rule.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks that the generator has the fields its kind needs
+func (g *Generator) validate() error {
+	switch g.Kind {
+	case "constant":
+		if g.Value == nil {
+			return fmt.Errorf("constant generator needs a value")
+		}
+	case "uniform", "walk":
+		if g.Max < g.Min {
+			return fmt.Errorf("%s generator needs max >= min", g.Kind)
+		}
+	case "normal":
+		if g.StdDev < 0 {
+			return fmt.Errorf("normal generator needs a non-negative stddev")
+		}
+	case "choice":
+		if len(g.Values) == 0 {
+			return fmt.Errorf("choice generator needs values")
+		}
+		if len(g.Weights) > 0 && len(g.Weights) != len(g.Values) {
+			return fmt.Errorf("choice generator needs one weight per value")
+		}
+	case "oneOf":
+		if len(g.Options) == 0 {
+			return fmt.Errorf("oneOf generator needs options")
+		}
+		for i := range g.Options {
+			if err := g.Options[i].validate(); err != nil {
+				return err
+			}
+		}
+	case "entity", "now", "uuid":
+	default:
+		return fmt.Errorf("unknown generator kind %q", g.Kind)
+	}
+	return nil
+}
+
+// streamGenerator generates rows for a stream, keeping the random walk position of every entity
+type streamGenerator struct {
+	stream *StreamScenario
+	walks  map[string]float64
+}
+
+func newStreamGenerator(stream *StreamScenario) *streamGenerator {
+	return &streamGenerator{stream: stream, walks: make(map[string]float64)}
+}
+
+// entityIDs returns the IDs of the stream's entities
+func (sg *streamGenerator) entityIDs() []string {
+	ids := make([]string, sg.stream.Entities.Count)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s%d", sg.stream.Entities.Prefix, i+1)
+	}
+	return ids
+}
+
+// row generates one row for an entity, in column order. Anomalous rows use the columns' anomaly
+// generators where they have one.
+func (sg *streamGenerator) row(entityID string, anomaly bool) ([]interface{}, error) {
+	values := make([]interface{}, len(sg.stream.Columns))
+	for i, column := range sg.stream.Columns {
+		gen := &column.Generator
+		if anomaly && column.Anomaly != nil {
+			gen = column.Anomaly
+		}
+		value, err := convertValue(sg.next(gen, entityID+"/"+column.Name, entityID), column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column.Name, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// next produces a value from a generator. walkKey identifies the random walk the value continues.
+func (sg *streamGenerator) next(g *Generator, walkKey string, entityID string) interface{} {
+	switch g.Kind {
+	case "constant":
+		return g.Value
+	case "uniform":
+		return g.Min + rand.Float64()*(g.Max-g.Min)
+	case "normal":
+		return g.Mean + rand.NormFloat64()*g.StdDev
+	case "walk":
+		current, ok := sg.walks[walkKey]
+		if !ok {
+			current = g.Min + rand.Float64()*(g.Max-g.Min)
+		}
+		current = math.Max(g.Min, math.Min(g.Max, current+(rand.Float64()*2-1)*g.Step))
+		sg.walks[walkKey] = current
+		return current
+	case "choice":
+		return g.Values[weightedIndex(g.Weights, len(g.Values))]
+	case "oneOf":
+		return sg.next(&g.Options[rand.Intn(len(g.Options))], walkKey, entityID)
+	case "entity":
+		return entityID
+	case "now":
+		return time.Now()
+	case "uuid":
+		return uuid.NewString()
+	}
+	return nil
+}
+
+// weightedIndex picks an index in [0, n), weighted when weights are given
+func weightedIndex(weights []float64, n int) int {
+	if len(weights) == 0 {
+		return rand.Intn(n)
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	pick := rand.Float64() * total
+	for i, w := range weights {
+		if pick < w {
+			return i
+		}
+		pick -= w
+	}
+	return n - 1
+}
+
+// convertValue converts a generated value to the Go type the driver expects for a column type
+func convertValue(value interface{}, columnType string) (interface{}, error) {
+	switch columnType {
+	case "string":
+		if t, ok := value.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), nil
+		}
+		return fmt.Sprint(value), nil
+	case "float64":
+		if f, ok := toFloat(value); ok {
+			return f, nil
+		}
+	case "int64":
+		if f, ok := toFloat(value); ok {
+			return int64(math.Round(f)), nil
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "datetime64", "datetime64(3)":
+		if t, ok := value.(time.Time); ok {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %v (%T) as %s", value, value, columnType)
+}
+
+// toFloat converts numeric values decoded from YAML or generated to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
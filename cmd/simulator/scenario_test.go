@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinScenariosGenerateRows(t *testing.T) {
+	names := builtinScenarioNames()
+	require.ElementsMatch(t, []string{"cpu", "fraud", "log_errors", "temperature"}, names)
+
+	for _, name := range names {
+		scenario, err := loadScenario(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, name, scenario.Name)
+		assert.NotEmpty(t, scenario.Rules, name)
+
+		for i := range scenario.Streams {
+			gen := newStreamGenerator(&scenario.Streams[i])
+			for _, anomaly := range []bool{false, true} {
+				row, err := gen.row(gen.entityIDs()[0], anomaly)
+				require.NoError(t, err, "%s/%s", name, scenario.Streams[i].Name)
+				assert.Len(t, row, len(scenario.Streams[i].Columns))
+			}
+		}
+	}
+}
+
+func TestScenarioValidation(t *testing.T) {
+	_, err := parseScenario([]byte(`
+name: bad
+streams:
+  - name: s
+    entities: {count: 1}
+    columns:
+      - name: v
+        type: float64
+        generator: {kind: choice, values: [1, 2], weights: [1]}
+`))
+	assert.ErrorContains(t, err, "one weight per value")
+
+	_, err = parseScenario([]byte(`
+name: bad
+streams:
+  - name: s
+    entities: {count: 1}
+    columns:
+      - name: v
+        type: decimal
+        generator: {kind: uniform, min: 0, max: 1}
+`))
+	assert.ErrorContains(t, err, "unsupported type")
+}
+
+func TestWalkStaysWithinBounds(t *testing.T) {
+	gen := newStreamGenerator(&StreamScenario{Name: "s", Entities: EntityScenario{Count: 1}})
+	walk := &Generator{Kind: "walk", Min: 10, Max: 20, Step: 5}
+	for i := 0; i < 100; i++ {
+		value := gen.next(walk, "e/v", "e").(float64)
+		assert.GreaterOrEqual(t, value, 10.0)
+		assert.LessOrEqual(t, value, 20.0)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// defaultCompactionDays is how long resolved alerts are kept by a compaction that doesn't say
+const defaultCompactionDays = 7
+
+// GetAckStreams lists the shared and dedicated alert acks streams with the rules using them
+func (h *APIHandler) GetAckStreams(c echo.Context) error {
+	streams, err := h.ruleService.ListAckStreams(c.Request().Context())
+	if err != nil {
+		logrus.Errorf("Error listing alert acks streams: %v", err)
+		return serviceError(c, err, "Failed to list alert acks streams")
+	}
+	return c.JSON(http.StatusOK, streams)
+}
+
+// GetRuleAckStream returns the alert acks stream a rule writes to
+func (h *APIHandler) GetRuleAckStream(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	info, err := h.ruleService.GetRuleAckStream(c.Request().Context(), id)
+	if err != nil {
+		logrus.Errorf("Error reading alert acks stream of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to read alert acks stream")
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// CompactRuleAckStream deletes a rule's alerts resolved more than olderThanDays ago
+func (h *APIHandler) CompactRuleAckStream(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	days := defaultCompactionDays
+	if daysStr := c.QueryParam("olderThanDays"); daysStr != "" {
+		var err error
+		if days, err = strconv.Atoi(daysStr); err != nil || days <= 0 {
+			return ErrorJSON(c, http.StatusBadRequest, "olderThanDays must be a positive number of days")
+		}
+	}
+
+	result, err := h.ruleService.CompactRuleAckStream(c.Request().Context(), id, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		logrus.Errorf("Error compacting alert acks stream of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to compact alert acks stream")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// MigrateRuleAckStream moves a rule between the shared alert acks stream and a dedicated one
+func (h *APIHandler) MigrateRuleAckStream(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	var migration services.AckStreamMigration
+	if err := c.Bind(&migration); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	info, err := h.ruleService.MigrateRuleAckStream(c.Request().Context(), id, migration)
+	if err != nil {
+		logrus.Errorf("Error migrating alert acks stream of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to migrate alert acks stream")
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// RebalanceAckPartitions moves alerts to the shared alert acks partition their rule is routed to,
+// after the number of partitions changed
+func (h *APIHandler) RebalanceAckPartitions(c echo.Context) error {
+	result, err := h.ruleService.RebalanceAckPartitions(c.Request().Context())
+	if err != nil {
+		logrus.Errorf("Error rebalancing alert acks partitions: %v", err)
+		return serviceError(c, err, "Failed to rebalance alert acks partitions")
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// SetActionLinks enables the one-click acknowledge and resolve links of alert emails, verified
+// with the links' signing secret
+func (h *APIHandler) SetActionLinks(links *notify.ActionLinks) {
+	h.actionLinks = links
+}
+
+// AlertActionLink handles the acknowledge and resolve links of alert emails, taking the action of
+// a signed, unexpired token on behalf of the recipient it was sent to. It answers with a page
+// rather than JSON, since the link is opened in a browser.
+func (h *APIHandler) AlertActionLink(c echo.Context) error {
+	if h.actionLinks == nil {
+		return actionLinkPage(c, http.StatusServiceUnavailable, "Alert links are not configured")
+	}
+	token := c.QueryParam("token")
+	if token == "" {
+		return actionLinkPage(c, http.StatusBadRequest, "The link is missing its token")
+	}
+
+	claims, err := h.actionLinks.Verify(token, time.Now())
+	if errors.Is(err, notify.ErrActionTokenExpired) {
+		return actionLinkPage(c, http.StatusGone, "This link has expired, acknowledge the alert from the dashboard instead")
+	}
+	if err != nil {
+		logrus.Warnf("Rejected alert action link: %v", err)
+		return actionLinkPage(c, http.StatusUnauthorized, "This link is not valid")
+	}
+
+	ctx := c.Request().Context()
+	var done string
+	switch claims.Action {
+	case notify.ActionAcknowledge:
+		err = h.ruleService.AcknowledgeAlertFrom(ctx, claims.AlertID, claims.Recipient, "email link")
+		done = "acknowledged"
+	case notify.ActionResolve:
+		err = h.ruleService.ResolveAlert(ctx, claims.AlertID, claims.Recipient, "Resolved via email link")
+		done = "resolved"
+	}
+	if err != nil {
+		logrus.Warnf("Failed to %s alert %s from an email link: %v", claims.Action, claims.AlertID, err)
+		status, _ := serviceErrorStatus(err)
+		return actionLinkPage(c, status, fmt.Sprintf("Alert %s couldn't be %s: %v", claims.AlertID, done, err))
+	}
+	return actionLinkPage(c, http.StatusOK, fmt.Sprintf("Alert %s %s by %s", claims.AlertID, done, claims.Recipient))
+}
+
+// actionLinkPage responds with a page showing the outcome of an action link
+func actionLinkPage(c echo.Context, status int, message string) error {
+	return c.HTML(status, fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Alert Gateway</title></head>
+<body style="font-family: sans-serif; margin: 2em"><p>%s</p></body></html>
+`, html.EscapeString(message)))
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestAlertActionLinkRejectsBadTokens(t *testing.T) {
+	e := echo.New()
+	h := &APIHandler{}
+	open := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, notify.ActionLinkPath+"?token="+url.QueryEscape(token), nil)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.AlertActionLink(e.NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, open("anything").Code)
+
+	links, err := notify.NewActionLinks("https://alerts.example.com", "secret", time.Hour)
+	require.NoError(t, err)
+	h.SetActionLinks(links)
+	other, err := notify.NewActionLinks("https://alerts.example.com", "other", time.Hour)
+	require.NoError(t, err)
+	claims := notify.ActionClaims{Action: notify.ActionAcknowledge, AlertID: "rule1:dev1:4", Recipient: "alice@example.com",
+		ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	assert.Equal(t, http.StatusBadRequest, open("").Code)
+	assert.Equal(t, http.StatusUnauthorized, open(other.Token(claims)).Code)
+
+	claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	rec := open(links.Token(claims))
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), "text/html")
+	assert.Contains(t, rec.Body.String(), "expired")
+}
@@ -0,0 +1,12 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetAlertArchiveStatus reports the alert archiver's progress
+func (h *APIHandler) GetAlertArchiveStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ruleService.AlertArchiveStatus())
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+)
+
+// SetConfig sets the configuration included, redacted, in diagnostics bundles
+func (h *APIHandler) SetConfig(cfg *config.Config) {
+	h.config = cfg
+}
+
+// GetDiagnostics returns a diagnostics bundle for support tickets: build, redacted config, rule
+// states, the Timeplus inventory and connection stats. With format=zip it is downloaded as a zip.
+func (h *APIHandler) GetDiagnostics(c echo.Context) error {
+	var cfg interface{}
+	if h.config != nil {
+		cfg = h.config.Redacted()
+	}
+	diagnostics := h.ruleService.Diagnostics(c.Request().Context(), cfg)
+
+	switch format := c.QueryParam("format"); format {
+	case "", "json":
+		return c.JSON(http.StatusOK, diagnostics)
+	case "zip":
+		data, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			return serviceError(c, err, "Failed to encode diagnostics")
+		}
+
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		file, err := archive.Create("diagnostics.json")
+		if err == nil {
+			_, err = file.Write(data)
+		}
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			logrus.Errorf("Error writing diagnostics zip: %v", err)
+			return serviceError(c, err, "Failed to write diagnostics zip")
+		}
+
+		filename := fmt.Sprintf("tp-alert-gateway-diagnostics-%s.zip", diagnostics.GeneratedAt.UTC().Format("20060102T150405Z"))
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+		return c.Blob(http.StatusOK, "application/zip", buf.Bytes())
+	default:
+		return ErrorJSON(c, http.StatusBadRequest, fmt.Sprintf("Unsupported format %q, expected json or zip", format))
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// SetEncryptionReaders sets the bearer tokens of the readers shown decrypted alert data. Without
+// tokens every reader is.
+func (h *APIHandler) SetEncryptionReaders(tokens []string) {
+	h.encryptionReaders = tokens
+}
+
+// encryptedDataReaders is middleware withholding encrypted alert data from requests that don't carry
+// one of the reader tokens
+func (h *APIHandler) encryptedDataReaders(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if len(h.encryptionReaders) > 0 && !h.encryptionReader(c) {
+			req := c.Request()
+			c.SetRequest(req.WithContext(services.WithEncryptedDataWithheld(req.Context())))
+		}
+		return next(c)
+	}
+}
+
+// encryptionReader reports whether a request carries one of the reader tokens
+func (h *APIHandler) encryptionReader(c echo.Context) bool {
+	token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, reader := range h.encryptionReaders {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(reader)) == 1 {
+			return true
+		}
+	}
+	return false
+}
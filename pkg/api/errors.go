@@ -0,0 +1,210 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Error codes of API error responses. They are stable, so clients can react to them rather than
+// to messages.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"   // 400: the body or a parameter can't be read
+	ErrorCodeNotFound         = "not_found"         // 404: the rule, alert or other resource doesn't exist
+	ErrorCodeAlreadyExists    = "already_exists"    // 409: a resource with the name exists
+	ErrorCodeConflict         = "conflict"          // 409: the resource's state doesn't allow the request
+	ErrorCodeValidationFailed = "validation_failed" // 422: the request is well-formed but not valid
+	ErrorCodeUnavailable      = "unavailable"       // 503: a feature is disabled, the gateway is shutting down or Timeplus is unavailable
+	ErrorCodeInternal         = "internal"          // 500: Timeplus or the gateway failed
+)
+
+// APIError is the body of every error response, wrapped in an "error" field
+type APIError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Whether the same request may succeed later, e.g. after a Timeplus outage
+	Retryable bool `json:"retryable"`
+	// Also returned in the X-Request-ID header, to find the request in the gateway's logs
+	CorrelationID string `json:"correlationId"`
+}
+
+// ErrorResponse is the JSON document of error responses
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// errorCodes are the default codes of error statuses
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          ErrorCodeInvalidRequest,
+	http.StatusNotFound:            ErrorCodeNotFound,
+	http.StatusConflict:            ErrorCodeConflict,
+	http.StatusUnprocessableEntity: ErrorCodeValidationFailed,
+	http.StatusServiceUnavailable:  ErrorCodeUnavailable,
+	http.StatusInternalServerError: ErrorCodeInternal,
+}
+
+// Error codes more specific than their status' default, for clients that handle them
+const (
+	ErrorCodeIdempotencyKeyReused = "idempotency_key_reused" // 422: the Idempotency-Key was sent with another request
+	ErrorCodeRequestInProgress    = "request_in_progress"    // 409: the request with the Idempotency-Key hasn't finished
+)
+
+// errorJSON responds with an error with the default code of its status
+func ErrorJSON(c echo.Context, status int, message string) error {
+	return writeError(c, status, &APIError{Message: message, Retryable: status >= http.StatusInternalServerError})
+}
+
+// writeError responds with an error, setting its correlation ID and, when empty, the default code
+// of its status
+func writeError(c echo.Context, status int, apiErr *APIError) error {
+	if apiErr.Code == "" {
+		var ok bool
+		if apiErr.Code, ok = errorCodes[status]; !ok {
+			apiErr.Code = ErrorCodeInternal
+			if status < http.StatusInternalServerError {
+				apiErr.Code = ErrorCodeInvalidRequest
+			}
+		}
+	}
+	apiErr.CorrelationID = correlationID(c)
+	return c.JSON(status, ErrorResponse{Error: apiErr})
+}
+
+// notFound responds that a resource doesn't exist
+func notFound(c echo.Context, kind, id string) error {
+	return writeError(c, http.StatusNotFound, &APIError{
+		Message: fmt.Sprintf("%s with ID %s not found", kind, id),
+		Details: map[string]interface{}{"resource": strings.ToLower(kind), "id": id},
+	})
+}
+
+// lookupFailed responds to a failed lookup of a resource: not found, unless Timeplus couldn't be
+// asked because its circuit breaker is open
+func lookupFailed(c echo.Context, kind, id string, err error) error {
+	if errors.Is(err, timeplus.ErrCircuitOpen) {
+		return serviceError(c, err, fmt.Sprintf("Failed to get %s", strings.ToLower(kind)))
+	}
+	return notFound(c, kind, id)
+}
+
+// serviceError responds with the status and code matching an error of the services. message
+// describes what failed, e.g. "Failed to start rule", and prefixes errors that aren't the client's.
+func serviceError(c echo.Context, err error, message string) error {
+	status, code := serviceErrorStatus(err)
+	if retryAfter, ok := timeplus.CircuitRetryAfter(err); ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	var details map[string]interface{}
+	var validationErr *services.RuleValidationError
+	if errors.As(err, &validationErr) {
+		details = map[string]interface{}{"problems": validationErr.Problems}
+	}
+	var inUseErr *services.StreamInUseError
+	if errors.As(err, &inUseErr) {
+		details = map[string]interface{}{"stream": inUseErr.Stream, "rules": inUseErr.RuleIDs}
+	}
+
+	// The client's mistakes are explained by the error itself; failures keep what was attempted
+	text := err.Error()
+	if status >= http.StatusInternalServerError {
+		text = fmt.Sprintf("%s: %v", message, err)
+	}
+	return writeError(c, status, &APIError{
+		Code:      code,
+		Message:   text,
+		Details:   details,
+		Retryable: status >= http.StatusInternalServerError,
+	})
+}
+
+// serviceErrorStatus returns the status and code matching an error of the services
+func serviceErrorStatus(err error) (int, string) {
+	status, code := http.StatusInternalServerError, ErrorCodeInternal
+	switch {
+	case errors.Is(err, services.ErrInvalidAlertID), errors.Is(err, services.ErrInvalidAlertCountQuery),
+		errors.Is(err, services.ErrInvalidIncidentQuery), errors.Is(err, services.ErrInvalidReportQuery):
+		status, code = http.StatusBadRequest, ErrorCodeInvalidRequest
+	case errors.Is(err, services.ErrInvalidRule), errors.Is(err, services.ErrRuleValidation),
+		errors.Is(err, services.ErrInvalidTemplate), errors.Is(err, services.ErrInvalidInhibition),
+		errors.Is(err, services.ErrInvalidBulkAcknowledge), errors.Is(err, services.ErrInvalidSchedule),
+		errors.Is(err, services.ErrInvalidRuleGroup), errors.Is(err, services.ErrInvalidSQLMacro),
+		errors.Is(err, services.ErrInvalidPushDevice):
+		status, code = http.StatusUnprocessableEntity, ErrorCodeValidationFailed
+	case errors.Is(err, services.ErrAlertNotFound), errors.Is(err, services.ErrTemplateNotFound),
+		errors.Is(err, services.ErrInhibitionNotFound), errors.Is(err, services.ErrScheduleNotFound),
+		errors.Is(err, services.ErrIncidentNotFound), errors.Is(err, services.ErrRuleGroupNotFound),
+		errors.Is(err, services.ErrSQLMacroNotFound), errors.Is(err, services.ErrPushDeviceNotFound):
+		status, code = http.StatusNotFound, ErrorCodeNotFound
+	case errors.Is(err, services.ErrTemplateExists), errors.Is(err, services.ErrInhibitionExists),
+		errors.Is(err, services.ErrScheduleExists), errors.Is(err, services.ErrRuleGroupExists),
+		errors.Is(err, services.ErrSQLMacroExists):
+		status, code = http.StatusConflict, ErrorCodeAlreadyExists
+	case errors.Is(err, services.ErrAlertSuperseded), errors.Is(err, services.ErrAlertNotAcknowledged),
+		errors.Is(err, services.ErrAlertResolved), errors.Is(err, services.ErrGatewayPaused),
+		errors.Is(err, services.ErrIncidentResolved), errors.Is(err, services.ErrRuleGroupInUse),
+		errors.Is(err, services.ErrRuleComponentHealthy), errors.Is(err, services.ErrSQLMacroInUse),
+		errors.Is(err, services.ErrStreamInUse):
+		status, code = http.StatusConflict, ErrorCodeConflict
+	case errors.Is(err, services.ErrShuttingDown), errors.Is(err, notify.ErrQueueFull),
+		errors.Is(err, notify.ErrDispatcherClosed), errors.Is(err, timeplus.ErrCircuitOpen):
+		status, code = http.StatusServiceUnavailable, ErrorCodeUnavailable
+	}
+	return status, code
+}
+
+// correlationID returns the ID of the request, set by the request ID middleware or the client.
+// Requests without one are given one so every error can be traced.
+func correlationID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	id := c.Request().Header.Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = uuid.New().String()
+	}
+	c.Response().Header().Set(echo.HeaderXRequestID, id)
+	return id
+}
+
+// HTTPErrorHandler renders errors returned by handlers and middleware, such as unknown routes or
+// rejected request bodies, in the same structure as the handlers' own errors
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, message := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		message = fmt.Sprint(httpErr.Message)
+		if httpErr.Internal != nil {
+			logrus.Debugf("Request %s failed: %v", correlationID(c), httpErr.Internal)
+		}
+	} else {
+		logrus.Errorf("Request %s failed: %v", correlationID(c), err)
+	}
+
+	var writeErr error
+	if c.Request().Method == http.MethodHead {
+		writeErr = c.NoContent(status)
+	} else {
+		writeErr = ErrorJSON(c, status, message)
+	}
+	if writeErr != nil {
+		logrus.Warnf("Failed to write error response: %v", writeErr)
+	}
+}
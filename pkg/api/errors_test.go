@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// decodeError returns the error of an error response
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) *APIError {
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Error)
+	return resp.Error
+}
+
+func TestServiceErrorMapping(t *testing.T) {
+	e := echo.New()
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+		retryable  bool
+	}{
+		{fmt.Errorf("%w: bad", services.ErrInvalidRule), http.StatusUnprocessableEntity, ErrorCodeValidationFailed, false},
+		{&services.RuleValidationError{Problems: []services.RuleValidationProblem{{Field: "query", Message: "unknown stream"}}},
+			http.StatusUnprocessableEntity, ErrorCodeValidationFailed, false},
+		{services.ErrInvalidAlertID, http.StatusBadRequest, ErrorCodeInvalidRequest, false},
+		{services.ErrAlertNotFound, http.StatusNotFound, ErrorCodeNotFound, false},
+		{fmt.Errorf("%w: on-call", services.ErrTemplateExists), http.StatusConflict, ErrorCodeAlreadyExists, false},
+		{services.ErrAlertSuperseded, http.StatusConflict, ErrorCodeConflict, false},
+		{&services.StreamInUseError{Stream: "sensors", RuleIDs: []string{"r1"}}, http.StatusConflict, ErrorCodeConflict, false},
+		{services.ErrShuttingDown, http.StatusServiceUnavailable, ErrorCodeUnavailable, true},
+		{fmt.Errorf("failed to query rule: %w", &timeplus.CircuitOpenError{RetryAfter: time.Second}),
+			http.StatusServiceUnavailable, ErrorCodeUnavailable, true},
+		{fmt.Errorf("connection refused"), http.StatusInternalServerError, ErrorCodeInternal, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			require.NoError(t, serviceError(c, tt.err, "Failed to do it"))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			apiErr := decodeError(t, rec)
+			assert.Equal(t, tt.wantCode, apiErr.Code)
+			assert.Equal(t, tt.retryable, apiErr.Retryable)
+			assert.NotEmpty(t, apiErr.CorrelationID)
+			assert.Equal(t, apiErr.CorrelationID, rec.Header().Get(echo.HeaderXRequestID))
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, serviceError(c, fmt.Errorf("connection refused"), "Failed to start rule"))
+	assert.Equal(t, "Failed to start rule: connection refused", decodeError(t, rec).Message)
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, lookupFailed(c, "Rule", "r1", &timeplus.CircuitOpenError{RetryAfter: 12500 * time.Millisecond}))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "an unavailable Timeplus isn't a missing rule")
+	assert.Equal(t, "13", rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, serviceError(c, &services.RuleValidationError{
+		Problems: []services.RuleValidationProblem{{Field: "query", Message: "unknown stream"}},
+	}, "Failed to create rule"))
+	assert.Equal(t, map[string]interface{}{
+		"problems": []interface{}{map[string]interface{}{"field": "query", "message": "unknown stream"}},
+	}, decodeError(t, rec).Details)
+}
+
+func TestErrorCorrelationID(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/rules/r1", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-42")
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, notFound(e.NewContext(req, rec), "Rule", "r1"))
+	apiErr := decodeError(t, rec)
+	assert.Equal(t, "req-42", apiErr.CorrelationID)
+	assert.Equal(t, "Rule with ID r1 not found", apiErr.Message)
+	assert.Equal(t, map[string]interface{}{"resource": "rule", "id": "r1"}, apiErr.Details)
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	apiErr := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeNotFound, apiErr.Code)
+	assert.Equal(t, "Not Found", apiErr.Message)
+	assert.NotEmpty(t, apiErr.CorrelationID)
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// exportFlushEvery is the number of exported rows buffered before they are flushed to the client
+const exportFlushEvery = 500
+
+// alertExportColumns are the CSV columns of an alerts export
+var alertExportColumns = []string{
+	"id", "ruleId", "ruleName", "entityId", "severity", "state", "triggeredAt", "acknowledged",
+	"acknowledgedAt", "acknowledgedBy", "owner", "team", "slaStatus", "slaDeadline", "data",
+}
+
+// ruleExportColumns are the CSV columns of a rules export
+var ruleExportColumns = []string{
+	"id", "name", "description", "type", "status", "severity", "owner", "team", "group", "query", "resolveQuery",
+	"throttleMinutes", "entityIdColumns", "createdAt", "updatedAt", "lastTriggeredAt", "lastError",
+}
+
+// ExportAlerts streams the alerts that fired in a time range as CSV or a JSON array, for compliance
+// reports and offline analysis. start and end default to the last 24 hours.
+func (h *APIHandler) ExportAlerts(c echo.Context) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, err.Error())
+	}
+
+	end := time.Now()
+	if value := c.QueryParam("end"); value != "" {
+		if end, err = services.ParseTime(value); err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid end format, expected RFC3339 or a date and time")
+		}
+	}
+	start := end.Add(-24 * time.Hour)
+	if value := c.QueryParam("start"); value != "" {
+		if start, err = services.ParseTime(value); err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid start format, expected RFC3339 or a date and time")
+		}
+	}
+	if start.After(end) {
+		return ErrorJSON(c, http.StatusBadRequest, "start must not be after end")
+	}
+
+	ruleID := c.QueryParam("rule_id")
+	if ruleID != "" {
+		if _, err := h.ruleService.GetRule(c.Request().Context(), ruleID); err != nil {
+			return lookupFailed(c, "Rule", ruleID, err)
+		}
+	}
+
+	writer := newExportWriter(c, format, "alerts", alertExportColumns)
+	err = h.ruleService.ExportAlerts(c.Request().Context(), ruleID, start, end, func(alert *services.ExportedAlert) error {
+		return writer.write(alert, alertExportRow(alert))
+	})
+	if err == nil {
+		err = writer.close()
+	}
+	if err != nil {
+		// The status was sent with the first bytes, so the client only sees a truncated export
+		logrus.Errorf("Error exporting alerts: %v", err)
+	}
+	return nil
+}
+
+// ExportRules streams all rules, optionally filtered by owner, team, group and folder, as CSV or a
+// JSON array
+func (h *APIHandler) ExportRules(c echo.Context) error {
+	format, err := exportFormat(c)
+	if err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, err.Error())
+	}
+
+	rules, err := h.ruleService.GetRules(c.Request().Context())
+	if err != nil {
+		logrus.Errorf("Error getting rules: %v", err)
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get rules")
+	}
+
+	owner := c.QueryParam("owner")
+	team := c.QueryParam("team")
+	rules = h.ruleService.FilterRulesByGroup(rules, c.QueryParam("group"), c.QueryParam("folder"))
+	filtered := make([]*models.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if (owner == "" || rule.Owner == owner) && (team == "" || rule.Team == team) {
+			filtered = append(filtered, rule)
+		}
+	}
+	writeRulesExport(c, format, "rules", filtered)
+	return nil
+}
+
+// writeRulesExport streams rules to the client in the export format
+func writeRulesExport(c echo.Context, format, name string, rules []*models.Rule) {
+	var err error
+	writer := newExportWriter(c, format, name, ruleExportColumns)
+	for _, rule := range rules {
+		if err = writer.write(rule, ruleExportRow(rule)); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.close()
+	}
+	if err != nil {
+		// The status was sent with the first bytes, so the client only sees a truncated export
+		logrus.Errorf("Error exporting rules: %v", err)
+	}
+}
+
+// exportFormat returns the requested export format, csv or json, csv when not given
+func exportFormat(c echo.Context) (string, error) {
+	switch format := c.QueryParam("format"); format {
+	case "", "csv":
+		return "csv", nil
+	case "json":
+		return "json", nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q, expected csv or json", format)
+	}
+}
+
+// exportWriter writes an export to the response as rows arrive, so exports are never held in memory
+type exportWriter struct {
+	response *echo.Response
+	format   string
+	csv      *csv.Writer
+	columns  []string
+	started  bool
+	rows     int
+}
+
+func newExportWriter(c echo.Context, format, name string, columns []string) *exportWriter {
+	contentType := "text/csv; charset=utf-8"
+	if format == "json" {
+		contentType = echo.MIMEApplicationJSONCharsetUTF8
+	}
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, contentType)
+	response.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102T150405Z"), format)))
+	return &exportWriter{response: response, format: format, csv: csv.NewWriter(response), columns: columns}
+}
+
+// start sends the status and the start of the export
+func (w *exportWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	w.response.WriteHeader(http.StatusOK)
+	if w.format == "json" {
+		_, err := io.WriteString(w.response, "[")
+		return err
+	}
+	return w.csv.Write(w.columns)
+}
+
+// write appends a row to the export, as JSON or its CSV record
+func (w *exportWriter) write(value interface{}, record []string) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.format == "json" {
+		if w.rows > 0 {
+			if _, err := io.WriteString(w.response, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if _, err := w.response.Write(data); err != nil {
+			return err
+		}
+	} else if err := w.csv.Write(record); err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%exportFlushEvery == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+// close ends the export, sending the header of empty exports
+func (w *exportWriter) close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.format == "json" {
+		if _, err := io.WriteString(w.response, "]"); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+func (w *exportWriter) flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	w.response.Flush()
+	return nil
+}
+
+// alertExportRow is the CSV record of an exported alert
+func alertExportRow(alert *services.ExportedAlert) []string {
+	return []string{
+		alert.ID,
+		alert.RuleID,
+		alert.RuleName,
+		alert.EntityID,
+		string(alert.Severity),
+		alert.State,
+		exportTime(&alert.TriggeredAt),
+		strconv.FormatBool(alert.Acknowledged),
+		exportTime(alert.AcknowledgedAt),
+		alert.AcknowledgedBy,
+		alert.Owner,
+		alert.Team,
+		alert.SLAStatus,
+		exportTime(alert.SLADeadline),
+		alert.Data,
+	}
+}
+
+// ruleExportRow is the CSV record of an exported rule
+func ruleExportRow(rule *models.Rule) []string {
+	return []string{
+		rule.ID,
+		rule.Name,
+		rule.Description,
+		rule.Type,
+		string(rule.Status),
+		string(rule.Severity),
+		rule.Owner,
+		rule.Team,
+		rule.Group,
+		rule.Query,
+		rule.ResolveQuery,
+		strconv.Itoa(rule.ThrottleMinutes),
+		rule.EntityIDColumns,
+		exportTime(&rule.CreatedAt),
+		exportTime(&rule.UpdatedAt),
+		exportTime(rule.LastTriggeredAt),
+		rule.LastError,
+	}
+}
+
+// exportTime formats a timestamp in UTC RFC3339, empty when unset
+func exportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
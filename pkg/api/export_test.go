@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestExportWriterCSV(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/rules/export", nil), rec)
+
+	created := time.Date(2026, 1, 2, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	writer := newExportWriter(c, "csv", "rules", ruleExportColumns)
+	rule := &models.Rule{ID: "rule-1", Name: "High, \"hot\" temperature", Query: "SELECT 1", CreatedAt: created}
+	require.NoError(t, writer.write(rule, ruleExportRow(rule)))
+	require.NoError(t, writer.close())
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), `attachment; filename="rules-`)
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, strings.Join(ruleExportColumns, ","), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], `rule-1,"High, ""hot"" temperature",`))
+	assert.Contains(t, lines[1], ",2026-01-02T09:00:00Z,")
+}
+
+func TestExportWriterJSON(t *testing.T) {
+	for _, count := range []int{0, 2} {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/rules/export?format=json", nil), rec)
+
+		writer := newExportWriter(c, "json", "rules", ruleExportColumns)
+		for i := 0; i < count; i++ {
+			rule := &models.Rule{ID: "rule-" + string(rune('a'+i))}
+			require.NoError(t, writer.write(rule, ruleExportRow(rule)))
+		}
+		require.NoError(t, writer.close())
+
+		var rules []models.Rule
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rules))
+		assert.Len(t, rules, count)
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	for query, expected := range map[string]string{"": "csv", "?format=csv": "csv", "?format=json": "json"} {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts/export"+query, nil), httptest.NewRecorder())
+		format, err := exportFormat(c)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts/export?format=xml", nil), httptest.NewRecorder())
+	_, err := exportFormat(c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/federation"
+)
+
+// SetFederation sets the federation of remote gateways served under /api/federation
+func (h *APIHandler) SetFederation(f *federation.Federation) {
+	h.federation = f
+}
+
+// federationUnavailable responds when federation isn't enabled
+func federationUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Federation is not enabled")
+}
+
+// GetFederatedAlerts returns the alerts of this gateway and the remote gateways, newest first, each
+// with the gateway it came from, optionally filtered by ?rule_id= and ?gateway=
+func (h *APIHandler) GetFederatedAlerts(c echo.Context) error {
+	if h.federation == nil {
+		return federationUnavailable(c)
+	}
+	view := h.federation.Alerts(c.Request().Context(), c.QueryParam("rule_id"))
+	if gateway := c.QueryParam("gateway"); gateway != "" {
+		filtered := make([]federation.Alert, 0, len(view.Alerts))
+		for _, alert := range view.Alerts {
+			if alert.Gateway == gateway {
+				filtered = append(filtered, alert)
+			}
+		}
+		view.Alerts = filtered
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+// GetFederatedRules returns the rules of this gateway and the remote gateways, optionally filtered
+// by ?gateway=
+func (h *APIHandler) GetFederatedRules(c echo.Context) error {
+	if h.federation == nil {
+		return federationUnavailable(c)
+	}
+	view := h.federation.Rules(c.Request().Context())
+	if gateway := c.QueryParam("gateway"); gateway != "" {
+		filtered := make([]federation.Rule, 0, len(view.Rules))
+		for _, rule := range view.Rules {
+			if rule.Gateway == gateway {
+				filtered = append(filtered, rule)
+			}
+		}
+		view.Rules = filtered
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+// GetFederatedGateways returns the health of each gateway as of its last request, or after querying
+// each remote's health endpoint with refresh=true
+func (h *APIHandler) GetFederatedGateways(c echo.Context) error {
+	if h.federation == nil {
+		return federationUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, h.federation.Gateways(c.Request().Context(), c.QueryParam("refresh") == "true"))
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// feedHeartbeat is how often an idle alert feed sends a comment, so proxies keep the connection open
+const feedHeartbeat = 15 * time.Second
+
+// SetFeed sets the feed alert events are streamed from
+func (h *APIHandler) SetFeed(feed *notify.Feed) {
+	h.feed = feed
+}
+
+// StreamAlertEvents streams fired and escalated alerts as server-sent events, one event per
+// notification named after its type, until the client disconnects
+func (h *APIHandler) StreamAlertEvents(c echo.Context) error {
+	if h.feed == nil {
+		return ErrorJSON(c, http.StatusServiceUnavailable, "Alert feed is not enabled")
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(c.Response()).SetWriteDeadline(time.Time{}); err != nil {
+		logrus.Debugf("Could not clear the write deadline of the alert feed: %v", err)
+	}
+
+	events, unsubscribe := h.feed.Subscribe()
+	defer unsubscribe()
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	fmt.Fprint(response, ": connected\n\n")
+	response.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logrus.Errorf("Error encoding %s event for the alert feed: %v", event.Type, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(response, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
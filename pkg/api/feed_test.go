@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestStreamAlertEvents(t *testing.T) {
+	feed := notify.NewFeed(10)
+	h := &APIHandler{}
+	h.SetFeed(feed)
+
+	e := echo.New()
+	e.GET("/api/alerts/events", h.StreamAlertEvents)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/alerts/events", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+	require.Equal(t, 1, feed.Subscribers())
+
+	alert := &models.Alert{ID: "rule1:dev1", RuleID: "rule1", RuleName: "High temperature"}
+	require.NoError(t, feed.Notify(context.Background(), notify.NewEvent(notify.EventFired, alert)))
+
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, "event: fired", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "data: "))
+	var event notify.Event
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event))
+	assert.Equal(t, "rule1:dev1", event.Alert.ID)
+}
+
+func TestStreamAlertEventsWithoutFeed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/alerts/events", nil), rec)
+	require.NoError(t, (&APIHandler{}).StreamAlertEvents(c))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -2,46 +2,79 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/federation"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
 )
 
 // APIHandler handles HTTP API requests
 type APIHandler struct {
 	ruleService *services.RuleService
+	idempotency *IdempotencyStore
+	config      *config.Config // Included in diagnostics bundles, nil when not set
+	feed        *notify.Feed   // Streams alert events to dashboards, nil when not set
+	slack       *slackIntegration
+	actionLinks *notify.ActionLinks    // Verifies the action links of alert emails, nil when not set
+	twilio      *notify.TwilioNotifier // Records the delivery status Twilio reports, nil when not set
+	deliveries  *notify.NotificationLog
+	federation  *federation.Federation // Aggregates remote gateways, nil unless federation is enabled
+
+	// Bearer tokens of the readers shown decrypted alert data, every reader when empty
+	encryptionReaders []string
 }
 
 // NewAPIHandler creates a new API handler
 func NewAPIHandler(ruleService *services.RuleService) *APIHandler {
 	return &APIHandler{
 		ruleService: ruleService,
+		idempotency: NewIdempotencyStore(),
 	}
 }
 
-// GetRules returns all rules
+// GetRules returns all rules, optionally filtered by owner, team, group and folder. A folder
+// includes the groups of its subfolders.
 func (h *APIHandler) GetRules(c echo.Context) error {
-	rules, err := h.ruleService.GetRules()
+	rules, err := h.ruleService.GetRules(c.Request().Context())
 	if err != nil {
 		logrus.Errorf("Error getting rules: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get rules"})
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get rules")
 	}
+	rules = h.ruleService.FilterRulesByGroup(rules, c.QueryParam("group"), c.QueryParam("folder"))
+
+	owner := c.QueryParam("owner")
+	team := c.QueryParam("team")
+	if owner != "" || team != "" {
+		filtered := make([]*models.Rule, 0, len(rules))
+		for _, rule := range rules {
+			if (owner == "" || rule.Owner == owner) && (team == "" || rule.Team == team) {
+				filtered = append(filtered, rule)
+			}
+		}
+		rules = filtered
+	}
+
 	return c.JSON(http.StatusOK, rules)
 }
 
 // GetRule returns a rule by ID
 func (h *APIHandler) GetRule(c echo.Context) error {
 	id := c.Param("id")
-	rule, err := h.ruleService.GetRule(id)
+	rule, err := h.ruleService.GetRule(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error getting rule %s: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Rule with ID %s not found", id)})
+		return lookupFailed(c, "Rule", id, err)
 	}
 	return c.JSON(http.StatusOK, rule)
 }
@@ -49,19 +82,24 @@ func (h *APIHandler) GetRule(c echo.Context) error {
 // GetAlertRawData returns the raw parsed data field of an alert
 func (h *APIHandler) GetAlertRawData(c echo.Context) error {
 	id := c.Param("id")
-	alert, err := h.ruleService.GetAlert(id)
+	alert, err := h.ruleService.GetAlert(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error getting alert %s: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Alert with ID %s not found", id)})
+		if errors.Is(err, services.ErrInvalidAlertID) || errors.Is(err, services.ErrAlertSuperseded) {
+			return serviceError(c, err, "Failed to get alert")
+		}
+		return lookupFailed(c, "Alert", id, err)
 	}
 
-	// Parse the data field (which is a JSON string) into a map
+	// Parse the data field (which is a JSON string) into a map, keeping numbers exact
 	var dataMap map[string]interface{}
-	if err := json.Unmarshal([]byte(alert.Data), &dataMap); err != nil {
+	decoder := json.NewDecoder(strings.NewReader(alert.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&dataMap); err != nil {
 		logrus.Errorf("Error parsing alert data JSON: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to parse alert data",
-			"data":  alert.Data,
+		return writeError(c, http.StatusInternalServerError, &APIError{
+			Message: "Failed to parse alert data",
+			Details: map[string]interface{}{"data": alert.Data},
 		})
 	}
 
@@ -81,38 +119,73 @@ func (h *APIHandler) CreateRule(c echo.Context) error {
 	var req models.CreateRuleRequest
 	if err := c.Bind(&req); err != nil {
 		logrus.Errorf("Error binding create rule request: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
 	}
 
-	// Validate request - removed sourceStream requirement
-	if req.Name == "" || req.Query == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name and query are required"})
+	// Validate request - removed sourceStream requirement, generated rule types don't need a query
+	if req.Name == "" {
+		return ErrorJSON(c, http.StatusUnprocessableEntity, "Name is required")
+	}
+	if req.Query == "" && (req.Type == "" || req.Type == models.RuleTypeQuery) {
+		return ErrorJSON(c, http.StatusUnprocessableEntity, "Query is required for query rules")
+	}
+	if err := h.normalizeSeverity(&req.Severity); err != nil {
+		return ErrorJSON(c, http.StatusUnprocessableEntity, err.Error())
 	}
 
 	// Create rule
 	rule, err := h.ruleService.CreateRule(c.Request().Context(), &req)
 	if err != nil {
 		logrus.Errorf("Error creating rule: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to create rule: %v", err)})
+		return serviceError(c, err, "Failed to create rule")
 	}
 
 	return c.JSON(http.StatusCreated, rule)
 }
 
+// ValidateRule checks a create rule request against Timeplus and lints it without creating the rule
+func (h *APIHandler) ValidateRule(c echo.Context) error {
+	var req models.CreateRuleRequest
+	if err := c.Bind(&req); err != nil {
+		logrus.Errorf("Error binding validate rule request: %v", err)
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	if req.Query == "" && (req.Type == "" || req.Type == models.RuleTypeQuery) {
+		return ErrorJSON(c, http.StatusUnprocessableEntity, "Query is required")
+	}
+	if err := h.normalizeSeverity(&req.Severity); err != nil {
+		return ErrorJSON(c, http.StatusUnprocessableEntity, err.Error())
+	}
+
+	result, err := h.ruleService.ValidateRule(c.Request().Context(), &req)
+	if err != nil {
+		logrus.Errorf("Error validating rule: %v", err)
+		return serviceError(c, err, "Failed to validate rule")
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 // UpdateRule updates a rule
 func (h *APIHandler) UpdateRule(c echo.Context) error {
 	id := c.Param("id")
 	var req models.UpdateRuleRequest
 	if err := c.Bind(&req); err != nil {
 		logrus.Errorf("Error binding update rule request: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+	if req.Severity != nil {
+		if err := h.normalizeSeverity(req.Severity); err != nil {
+			return ErrorJSON(c, http.StatusUnprocessableEntity, err.Error())
+		}
 	}
 
 	// Update rule
 	rule, err := h.ruleService.UpdateRule(c.Request().Context(), id, &req)
 	if err != nil {
 		logrus.Errorf("Error updating rule %s: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update rule: %v", err)})
+		return serviceError(c, err, "Failed to update rule")
 	}
 
 	return c.JSON(http.StatusOK, rule)
@@ -124,7 +197,7 @@ func (h *APIHandler) DeleteRule(c echo.Context) error {
 	err := h.ruleService.DeleteRule(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error deleting rule %s: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to delete rule: %v", err)})
+		return serviceError(c, err, "Failed to delete rule")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Rule deleted successfully"})
@@ -136,7 +209,7 @@ func (h *APIHandler) StartRule(c echo.Context) error {
 	err := h.ruleService.StartRule(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error starting rule %s: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to start rule: %v", err)})
+		return serviceError(c, err, "Failed to start rule")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Rule started successfully"})
@@ -148,30 +221,450 @@ func (h *APIHandler) StopRule(c echo.Context) error {
 	err := h.ruleService.StopRule(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error stopping rule %s: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to stop rule: %v", err)})
+		return serviceError(c, err, "Failed to stop rule")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Rule stopped successfully"})
 }
 
+// GetRuleStats returns sampled evaluation lag and throughput for a rule
+func (h *APIHandler) GetRuleStats(c echo.Context) error {
+	id := c.Param("id")
+
+	window := services.DefaultStatsWindow
+	if windowStr := c.QueryParam("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed < time.Second {
+			return ErrorJSON(c, http.StatusBadRequest, "window must be a duration of at least 1s, e.g. 5m")
+		}
+		window = parsed
+	}
+
+	stats, err := h.ruleService.GetRuleStats(c.Request().Context(), id, window)
+	if err != nil {
+		logrus.Errorf("Error getting stats for rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to get rule stats")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// GetRuleRecommendations returns a rule's noise report with tuning suggestions from its firing and
+// acknowledgment history. refresh=true re-analyzes the history instead of returning the latest report.
+func (h *APIHandler) GetRuleRecommendations(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	refresh, _ := strconv.ParseBool(c.QueryParam("refresh"))
+	report, err := h.ruleService.GetRuleRecommendations(c.Request().Context(), id, refresh)
+	if err != nil {
+		logrus.Errorf("Error getting recommendations for rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to get rule recommendations")
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetRuleArtifacts returns the DDL of a rule's views and streams and whether they exist
+func (h *APIHandler) GetRuleArtifacts(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	artifacts, err := h.ruleService.GetRuleArtifacts(c.Request().Context(), id)
+	if err != nil {
+		logrus.Errorf("Error getting artifacts for rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to get rule artifacts")
+	}
+
+	return c.JSON(http.StatusOK, artifacts)
+}
+
+// GetRuleGraph returns how rules relate to the streams they read and write, to each other and to the
+// routes their alerts are delivered through. With ?stream= it also lists what dropping the stream
+// would affect.
+func (h *APIHandler) GetRuleGraph(c echo.Context) error {
+	graph, err := h.ruleService.GetRuleGraph(c.Request().Context())
+	if err != nil {
+		logrus.Errorf("Error building rule graph: %v", err)
+		return serviceError(c, err, "Failed to build rule graph")
+	}
+	if stream := c.QueryParam("stream"); stream != "" {
+		graph.Impact = graph.ImpactOf(stream)
+	}
+	return c.JSON(http.StatusOK, graph)
+}
+
+// GetRuleLiveness reports whether a rule's materialized view has processed data within maxIdle
+func (h *APIHandler) GetRuleLiveness(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	maxIdle := services.DefaultLivenessMaxIdle
+	if value := c.QueryParam("maxIdle"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Second {
+			return ErrorJSON(c, http.StatusBadRequest, "maxIdle must be a duration of at least 1s, e.g. 5m")
+		}
+		maxIdle = parsed
+	}
+
+	liveness, err := h.ruleService.GetRuleLiveness(c.Request().Context(), id, maxIdle)
+	if err != nil {
+		logrus.Errorf("Error checking liveness of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to check rule liveness")
+	}
+
+	return c.JSON(http.StatusOK, liveness)
+}
+
+// GetRuleErrors returns a rule's recent failures with the phase and statement that failed
+func (h *APIHandler) GetRuleErrors(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	limit := 0
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return ErrorJSON(c, http.StatusBadRequest, "limit must be a positive integer")
+		}
+	}
+
+	ruleErrors, err := h.ruleService.GetRuleErrors(c.Request().Context(), id, limit)
+	if err != nil {
+		logrus.Errorf("Error getting errors of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to get rule errors")
+	}
+
+	return c.JSON(http.StatusOK, ruleErrors)
+}
+
+// RetryRuleComponent recreates a failed component of a degraded rule
+func (h *APIHandler) RetryRuleComponent(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	rule, err := h.ruleService.RetryRuleComponent(c.Request().Context(), id, c.Param("component"))
+	if err != nil {
+		logrus.Errorf("Error retrying %s of rule %s: %v", c.Param("component"), id, err)
+		return serviceError(c, err, "Failed to retry rule component")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// RebuildRule drops and recreates a rule's views from its stored definition
+func (h *APIHandler) RebuildRule(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	resetAlerts := false
+	if resetStr := c.QueryParam("resetAlerts"); resetStr != "" {
+		var err error
+		if resetAlerts, err = strconv.ParseBool(resetStr); err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "resetAlerts must be true or false")
+		}
+	}
+
+	artifacts, err := h.ruleService.RebuildRule(c.Request().Context(), id, resetAlerts)
+	if err != nil {
+		logrus.Errorf("Error rebuilding rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to rebuild rule")
+	}
+
+	return c.JSON(http.StatusOK, artifacts)
+}
+
+// SetRuleResolveQuery adds or replaces a rule's resolve query, replacing the resolve views of a running rule
+func (h *APIHandler) SetRuleResolveQuery(c echo.Context) error {
+	id := c.Param("id")
+	var req models.ResolveQueryRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	rule, err := h.ruleService.SetResolveQuery(c.Request().Context(), id, req.ResolveQuery)
+	if err != nil {
+		logrus.Errorf("Error setting resolve query of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to set resolve query")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// RemoveRuleResolveQuery removes a rule's resolve query and the resolve views of a running rule
+func (h *APIHandler) RemoveRuleResolveQuery(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	rule, err := h.ruleService.RemoveResolveQuery(c.Request().Context(), id)
+	if err != nil {
+		logrus.Errorf("Error removing resolve query of rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to remove resolve query")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// RecoverRule restores the throttle of a rule degraded for exceeding its alert volume quota
+func (h *APIHandler) RecoverRule(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+
+	rule, err := h.ruleService.RecoverRule(c.Request().Context(), id)
+	if err != nil {
+		logrus.Errorf("Error recovering rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to recover rule")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// GetRuleAlertHistory returns every firing of a rule in a time range
+func (h *APIHandler) GetRuleAlertHistory(c echo.Context) error {
+	id := c.Param("id")
+
+	// Default to the last 24 hours
+	endTime := time.Now()
+	startTime := endTime.Add(-24 * time.Hour)
+	var err error
+
+	if startTimeStr := c.QueryParam("start_time"); startTimeStr != "" {
+		startTime, err = services.ParseTime(startTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid start_time format")
+		}
+	}
+	if endTimeStr := c.QueryParam("end_time"); endTimeStr != "" {
+		endTime, err = services.ParseTime(endTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid end_time format")
+		}
+	}
+
+	limit := services.DefaultAlertHistoryLimit
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return ErrorJSON(c, http.StatusBadRequest, "limit must be a positive integer")
+		}
+	}
+
+	history, err := h.ruleService.GetAlertHistory(c.Request().Context(), id, startTime, endTime, c.QueryParam("entity_id"), limit)
+	if err != nil {
+		logrus.Errorf("Error getting alert history for rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to get alert history")
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
+
+// BackfillRule evaluates a running rule over recent historical data
+func (h *APIHandler) BackfillRule(c echo.Context) error {
+	id := c.Param("id")
+	minutes, err := strconv.Atoi(c.QueryParam("minutes"))
+	if err != nil || minutes <= 0 {
+		return ErrorJSON(c, http.StatusBadRequest, "minutes must be a positive integer")
+	}
+
+	result, err := h.ruleService.BackfillRule(c.Request().Context(), id, minutes)
+	if err != nil {
+		logrus.Errorf("Error backfilling rule %s: %v", id, err)
+		return serviceError(c, err, "Failed to backfill rule")
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 // GetAlerts returns all alerts, optionally filtered by rule ID
 func (h *APIHandler) GetAlerts(c echo.Context) error {
 	ruleID := c.QueryParam("rule_id")
-	alerts, err := h.ruleService.GetAlerts(ruleID)
+	alerts, err := h.ruleService.GetAlerts(c.Request().Context(), ruleID)
 	if err != nil {
 		logrus.Errorf("Error getting alerts: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get alerts"})
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get alerts")
 	}
 	return c.JSON(http.StatusOK, alerts)
 }
 
+// GetAlertCounts returns alert totals for dashboard badges, optionally grouped by severity, state or rule
+func (h *APIHandler) GetAlertCounts(c echo.Context) error {
+	counts, err := h.ruleService.GetAlertCounts(c.Request().Context(), c.QueryParam("groupBy"), c.QueryParam("state"), c.QueryParam("rule_id"))
+	if err != nil {
+		logrus.Errorf("Error getting alert counts: %v", err)
+		if errors.Is(err, services.ErrInvalidAlertCountQuery) {
+			return serviceError(c, err, "Failed to get alert counts")
+		}
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get alert counts")
+	}
+	return c.JSON(http.StatusOK, counts)
+}
+
+// GetActiveAlerts returns what is firing right now: active alerts per rule with the latest one's
+// triggering data. Cheap enough for dashboards to poll every few seconds.
+func (h *APIHandler) GetActiveAlerts(c echo.Context) error {
+	active, err := h.ruleService.GetActiveAlerts(c.Request().Context(), c.QueryParam("rule_id"))
+	if err != nil {
+		logrus.Errorf("Error getting active alerts: %v", err)
+		return serviceError(c, err, "Failed to get active alerts")
+	}
+	return c.JSON(http.StatusOK, active)
+}
+
+// GetSLAReport returns per-severity SLA compliance of alerts that fired in a time range
+func (h *APIHandler) GetSLAReport(c echo.Context) error {
+	// Default to the last 24 hours
+	endTime := time.Now()
+	startTime := endTime.Add(-24 * time.Hour)
+	var err error
+
+	if startTimeStr := c.QueryParam("start_time"); startTimeStr != "" {
+		startTime, err = services.ParseTime(startTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid start_time format")
+		}
+	}
+	if endTimeStr := c.QueryParam("end_time"); endTimeStr != "" {
+		endTime, err = services.ParseTime(endTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid end_time format")
+		}
+	}
+
+	report, err := h.ruleService.GetSLAReport(c.Request().Context(), startTime, endTime, c.QueryParam("rule_id"))
+	if err != nil {
+		logrus.Errorf("Error getting SLA report: %v", err)
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get SLA report")
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetResponseTimeReport returns the mean and percentile times to acknowledge and resolve alerts
+// that fired in a time range, overall or per rule or team
+func (h *APIHandler) GetResponseTimeReport(c echo.Context) error {
+	// Default to the last 24 hours
+	endTime := time.Now()
+	startTime := endTime.Add(-24 * time.Hour)
+	var err error
+
+	if startTimeStr := c.QueryParam("start_time"); startTimeStr != "" {
+		startTime, err = services.ParseTime(startTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid start_time format")
+		}
+	}
+	if endTimeStr := c.QueryParam("end_time"); endTimeStr != "" {
+		endTime, err = services.ParseTime(endTimeStr)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid end_time format")
+		}
+	}
+
+	report, err := h.ruleService.GetResponseTimeReport(c.Request().Context(), startTime, endTime,
+		c.QueryParam("groupBy"), c.QueryParam("rule_id"), c.QueryParam("team"))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidReportQuery) {
+			logrus.Errorf("Error getting response time report: %v", err)
+		}
+		return serviceError(c, err, "Failed to get response time report")
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetAlertHeatmap returns the firings of the last days counted by day of the week and time of day,
+// over all rules or the rule in rule_id, with each rule's heatmap for groupBy=rule
+func (h *APIHandler) GetAlertHeatmap(c echo.Context) error {
+	days := services.DefaultHeatmapDays
+	if daysStr := c.QueryParam("days"); daysStr != "" {
+		var err error
+		if days, err = strconv.Atoi(daysStr); err != nil || days <= 0 || days > services.MaxHeatmapDays {
+			return ErrorJSON(c, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", services.MaxHeatmapDays))
+		}
+	}
+	bucketHours, err := services.ParseHeatmapBucket(c.QueryParam("bucket"))
+	if err != nil {
+		return serviceError(c, err, "Failed to get alert heatmap")
+	}
+	perRule := false
+	switch groupBy := c.QueryParam("groupBy"); groupBy {
+	case "":
+	case "rule":
+		perRule = true
+	default:
+		return ErrorJSON(c, http.StatusBadRequest, fmt.Sprintf("unsupported groupBy %q, expected rule", groupBy))
+	}
+
+	ruleID := c.QueryParam("rule_id")
+	if ruleID != "" {
+		if _, err := h.ruleService.GetRule(c.Request().Context(), ruleID); err != nil {
+			return lookupFailed(c, "Rule", ruleID, err)
+		}
+	}
+
+	heatmap, err := h.ruleService.GetAlertHeatmap(c.Request().Context(), days, bucketHours, ruleID, perRule)
+	if err != nil {
+		logrus.Errorf("Error getting alert heatmap: %v", err)
+		return serviceError(c, err, "Failed to get alert heatmap")
+	}
+	return c.JSON(http.StatusOK, heatmap)
+}
+
+// GetAlertForecast projects each rule's alert volume over the next 24 hours from its firing history
+// and flags rules whose latest hour was a spike. rule_id limits it to one rule.
+func (h *APIHandler) GetAlertForecast(c echo.Context) error {
+	lookbackDays := services.DefaultForecastLookbackDays
+	if daysStr := c.QueryParam("lookbackDays"); daysStr != "" {
+		var err error
+		if lookbackDays, err = strconv.Atoi(daysStr); err != nil || lookbackDays <= 0 || lookbackDays > services.MaxForecastLookbackDays {
+			return ErrorJSON(c, http.StatusBadRequest, fmt.Sprintf("lookbackDays must be between 1 and %d", services.MaxForecastLookbackDays))
+		}
+	}
+
+	ruleID := c.QueryParam("rule_id")
+	if ruleID != "" {
+		if _, err := h.ruleService.GetRule(c.Request().Context(), ruleID); err != nil {
+			return lookupFailed(c, "Rule", ruleID, err)
+		}
+	}
+
+	forecast, err := h.ruleService.ForecastAlertVolume(c.Request().Context(), ruleID, lookbackDays)
+	if err != nil {
+		logrus.Errorf("Error forecasting alert volume: %v", err)
+		return serviceError(c, err, "Failed to forecast alert volume")
+	}
+	return c.JSON(http.StatusOK, forecast)
+}
+
 // GetAlert returns an alert by ID
 func (h *APIHandler) GetAlert(c echo.Context) error {
 	id := c.Param("id")
-	alert, err := h.ruleService.GetAlert(id)
+	alert, err := h.ruleService.GetAlert(c.Request().Context(), id)
 	if err != nil {
 		logrus.Errorf("Error getting alert %s: %v", id, err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("Alert with ID %s not found", id)})
+		if errors.Is(err, services.ErrInvalidAlertID) || errors.Is(err, services.ErrAlertSuperseded) {
+			return serviceError(c, err, "Failed to get alert")
+		}
+		return lookupFailed(c, "Alert", id, err)
 	}
 	return c.JSON(http.StatusOK, alert)
 }
@@ -183,18 +676,128 @@ func (h *APIHandler) AcknowledgeAlert(c echo.Context) error {
 		AcknowledgedBy string `json:"acknowledged_by"`
 	}
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
 	}
 
-	err := h.ruleService.AcknowledgeAlert(id, req.AcknowledgedBy)
+	err := h.ruleService.AcknowledgeAlert(c.Request().Context(), id, req.AcknowledgedBy)
 	if err != nil {
 		logrus.Errorf("Error acknowledging alert %s: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to acknowledge alert: %v", err)})
+		return serviceError(c, err, "Failed to acknowledge alert")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Alert acknowledged successfully"})
 }
 
+// UnacknowledgeAlert reopens an alert that was acknowledged by mistake
+func (h *APIHandler) UnacknowledgeAlert(c echo.Context) error {
+	id := c.Param("id")
+	var req struct {
+		ReopenedBy string `json:"reopenedBy"`
+		Reason     string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	err := h.ruleService.UnacknowledgeAlert(c.Request().Context(), id, req.ReopenedBy, req.Reason)
+	if errors.Is(err, services.ErrAlertNotFound) {
+		return lookupFailed(c, "Alert", id, err)
+	}
+	if err != nil {
+		logrus.Errorf("Error unacknowledging alert %s: %v", id, err)
+		return serviceError(c, err, "Failed to reopen alert")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Alert reopened successfully"})
+}
+
+// GetAlertAudit returns who acknowledged or reopened an alert and why
+func (h *APIHandler) GetAlertAudit(c echo.Context) error {
+	id := c.Param("id")
+	entries, err := h.ruleService.GetAlertAudit(c.Request().Context(), id)
+	if err != nil {
+		logrus.Errorf("Error getting audit trail of alert %s: %v", id, err)
+		if errors.Is(err, services.ErrInvalidAlertID) {
+			return serviceError(c, err, "Failed to get alert audit trail")
+		}
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get alert audit trail")
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// AcknowledgeAlerts acknowledges all active alerts matching a filter
+func (h *APIHandler) AcknowledgeAlerts(c echo.Context) error {
+	var req models.BulkAcknowledgeRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+	return h.acknowledgeAlerts(c, req)
+}
+
+// AcknowledgeAllRuleAlerts acknowledges all active alerts of a rule
+func (h *APIHandler) AcknowledgeAllRuleAlerts(c echo.Context) error {
+	id := c.Param("id")
+	var req models.BulkAcknowledgeRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+	if _, err := h.ruleService.GetRule(c.Request().Context(), id); err != nil {
+		return lookupFailed(c, "Rule", id, err)
+	}
+	req.RuleID = id
+	return h.acknowledgeAlerts(c, req)
+}
+
+func (h *APIHandler) acknowledgeAlerts(c echo.Context, req models.BulkAcknowledgeRequest) error {
+	count, err := h.ruleService.AcknowledgeAlerts(c.Request().Context(), req)
+	if err != nil {
+		logrus.Errorf("Error bulk acknowledging alerts: %v", err)
+		return serviceError(c, err, "Failed to acknowledge alerts")
+	}
+
+	response := map[string]interface{}{"acknowledged": count}
+	if req.Reference != "" {
+		response["reference"] = req.Reference
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetReferenceAudit returns the audit entries of every acknowledgment made under a reference
+func (h *APIHandler) GetReferenceAudit(c echo.Context) error {
+	reference := c.QueryParam("reference")
+	if reference == "" {
+		return ErrorJSON(c, http.StatusBadRequest, "reference is required")
+	}
+
+	entries, err := h.ruleService.GetReferenceAudit(c.Request().Context(), reference)
+	if err != nil {
+		logrus.Errorf("Error getting audit trail of reference %s: %v", reference, err)
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get reference audit trail")
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// ReplayAlerts re-emits alerts from a time range to the notification pipeline or a chosen sink
+func (h *APIHandler) ReplayAlerts(c echo.Context) error {
+	var req models.ReplayAlertsRequest
+	if err := c.Bind(&req); err != nil {
+		logrus.Errorf("Error binding replay alerts request: %v", err)
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	if req.StartTime.IsZero() || req.EndTime.IsZero() {
+		return ErrorJSON(c, http.StatusBadRequest, "startTime and endTime are required")
+	}
+
+	result, err := h.ruleService.ReplayAlerts(c.Request().Context(), &req)
+	if err != nil {
+		logrus.Errorf("Error replaying alerts: %v", err)
+		return serviceError(c, err, "Failed to replay alerts")
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 // GetAlertsByTimeRange returns alerts within a specified time range
 func (h *APIHandler) GetAlertsByTimeRange(c echo.Context) error {
 	ruleID := c.QueryParam("rule_id")
@@ -206,9 +809,9 @@ func (h *APIHandler) GetAlertsByTimeRange(c echo.Context) error {
 	var err error
 
 	if startTimeStr != "" {
-		startTime, err = time.Parse(time.RFC3339, startTimeStr)
+		startTime, err = services.ParseTime(startTimeStr)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid start_time format"})
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid start_time format")
 		}
 	} else {
 		// Default to 24 hours ago if not specified
@@ -216,39 +819,201 @@ func (h *APIHandler) GetAlertsByTimeRange(c echo.Context) error {
 	}
 
 	if endTimeStr != "" {
-		endTime, err = time.Parse(time.RFC3339, endTimeStr)
+		endTime, err = services.ParseTime(endTimeStr)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid end_time format"})
+			return ErrorJSON(c, http.StatusBadRequest, "Invalid end_time format")
 		}
 	} else {
 		// Default to now if not specified
 		endTime = time.Now()
 	}
 
-	alerts, err := h.ruleService.GetAlertsByTimeRange(ruleID, startTime, endTime)
+	alerts, err := h.ruleService.GetAlertsByTimeRange(c.Request().Context(), ruleID, startTime, endTime)
 	if err != nil {
 		logrus.Errorf("Error getting alerts by time range: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get alerts"})
+		return ErrorJSON(c, http.StatusInternalServerError, "Failed to get alerts")
 	}
 
 	return c.JSON(http.StatusOK, alerts)
 }
 
+// GetSelfAlerts returns the gateway problems found by the latest self-alert check
+func (h *APIHandler) GetSelfAlerts(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ruleService.SelfAlerts())
+}
+
+// GetHealth returns the latest health check, or runs one now with refresh=true. It responds 503
+// when Timeplus can't be reached.
+func (h *APIHandler) GetHealth(c echo.Context) error {
+	var report services.HealthReport
+	if c.QueryParam("refresh") == "true" {
+		report = h.ruleService.CheckHealth(c.Request().Context())
+	} else {
+		report = h.ruleService.Health(c.Request().Context())
+	}
+
+	if report.Status == services.HealthStatusUnavailable {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
 // SetupRoutes sets up the API routes
 func (h *APIHandler) SetupRoutes(e *echo.Echo) {
+	// Retried creates and acknowledgments with the same Idempotency-Key are not applied twice
+	idempotent := Idempotency(h.idempotency)
+
+	// Every response is flagged while the gateway is paused
+	e.Use(h.pauseFlag)
+
+	// Encrypted alert data is only decrypted for the configured readers
+	e.Use(h.encryptedDataReaders)
+
 	// Rule endpoints
 	e.GET("/api/rules", h.GetRules)
+	e.GET("/api/rules/export", h.ExportRules)
+	e.GET("/api/rules/graph", h.GetRuleGraph)
 	e.GET("/api/rules/:id", h.GetRule)
-	e.POST("/api/rules", h.CreateRule)
+	e.POST("/api/rules", h.CreateRule, idempotent)
+	e.POST("/api/rules/validate", h.ValidateRule)
 	e.PUT("/api/rules/:id", h.UpdateRule)
 	e.DELETE("/api/rules/:id", h.DeleteRule)
 	e.POST("/api/rules/:id/start", h.StartRule)
 	e.POST("/api/rules/:id/stop", h.StopRule)
+	e.POST("/api/rules/:id/backfill", h.BackfillRule)
+	e.GET("/api/rules/:id/stats", h.GetRuleStats)
+	e.GET("/api/rules/:id/recommendations", h.GetRuleRecommendations)
+	e.GET("/api/rules/:id/artifacts", h.GetRuleArtifacts)
+	e.GET("/api/rules/:id/liveness", h.GetRuleLiveness)
+	e.GET("/api/rules/:id/errors", h.GetRuleErrors)
+	e.POST("/api/rules/:id/rebuild", h.RebuildRule)
+	e.POST("/api/rules/:id/components/:component/retry", h.RetryRuleComponent)
+	e.DELETE("/api/rules/:id/degraded", h.RecoverRule)
+	e.PUT("/api/rules/:id/resolve-query", h.SetRuleResolveQuery)
+	e.DELETE("/api/rules/:id/resolve-query", h.RemoveRuleResolveQuery)
+	e.GET("/api/rules/:id/alerts/history", h.GetRuleAlertHistory)
+	e.POST("/api/rules/:id/alerts/acknowledge-all", h.AcknowledgeAllRuleAlerts, idempotent)
+
+	// Alert acks streams, shared or dedicated to a rule
+	e.GET("/api/ack-streams", h.GetAckStreams)
+	e.GET("/api/rules/:id/ack-stream", h.GetRuleAckStream)
+	e.POST("/api/rules/:id/ack-stream/compact", h.CompactRuleAckStream)
+	e.POST("/api/rules/:id/ack-stream/migrate", h.MigrateRuleAckStream)
+	e.POST("/api/admin/ack-partitions/rebalance", h.RebalanceAckPartitions)
+
+	// Stream administration
+	e.DELETE("/api/admin/streams/:name", h.DeleteStream)
 
 	// Alert endpoints
 	e.GET("/api/alerts", h.GetAlerts)
 	e.GET("/api/alerts/by-time", h.GetAlertsByTimeRange)
+	e.GET("/api/alerts/export", h.ExportAlerts)
+	e.GET("/api/alerts/counts", h.GetAlertCounts)
+	e.GET("/api/alerts/active", h.GetActiveAlerts)
+	e.GET("/api/alerts/events", h.StreamAlertEvents)
+	e.GET("/api/alerts/sla", h.GetSLAReport)
+	e.GET("/api/reports/response-times", h.GetResponseTimeReport)
+	e.GET("/api/reports/heatmap", h.GetAlertHeatmap)
+	e.GET("/api/alerts/forecast", h.GetAlertForecast)
+	e.GET("/api/alerts/archive/status", h.GetAlertArchiveStatus)
+	e.POST("/api/alerts/replay", h.ReplayAlerts)
+	e.POST("/api/alerts/acknowledge", h.AcknowledgeAlerts, idempotent)
+	e.GET("/api/alerts/audit", h.GetReferenceAudit)
 	e.GET("/api/alerts/:id", h.GetAlert)
 	e.GET("/api/alerts/:id/data", h.GetAlertRawData)
-	e.POST("/api/alerts/:id/acknowledge", h.AcknowledgeAlert)
+	e.POST("/api/alerts/:id/acknowledge", h.AcknowledgeAlert, idempotent)
+	e.POST("/api/alerts/:id/unacknowledge", h.UnacknowledgeAlert, idempotent)
+	e.GET("/api/alerts/:id/audit", h.GetAlertAudit)
+
+	// Notification template endpoints, addressed by template name
+	e.GET("/api/templates", h.GetTemplates)
+	e.POST("/api/templates", h.CreateTemplate)
+	e.GET("/api/templates/:id", h.GetTemplate)
+	e.PUT("/api/templates/:id", h.UpdateTemplate)
+	e.DELETE("/api/templates/:id", h.DeleteTemplate)
+	e.POST("/api/templates/:id/preview", h.PreviewTemplate)
+
+	// Inhibitions, addressed by name
+	e.GET("/api/inhibitions", h.GetInhibitions)
+	e.POST("/api/inhibitions", h.CreateInhibition)
+	e.GET("/api/inhibitions/:id", h.GetInhibition)
+	e.PUT("/api/inhibitions/:id", h.UpdateInhibition)
+	e.DELETE("/api/inhibitions/:id", h.DeleteInhibition)
+
+	// Incidents grouping correlated alerts
+	e.GET("/api/incidents", h.GetIncidents)
+	e.GET("/api/incidents/:id", h.GetIncident)
+	e.POST("/api/incidents/:id/acknowledge", h.AcknowledgeIncident)
+	e.POST("/api/incidents/:id/resolve", h.ResolveIncident)
+
+	// Read-only view of the alerts and rules of federated gateways
+	e.GET("/api/federation/alerts", h.GetFederatedAlerts)
+	e.GET("/api/federation/rules", h.GetFederatedRules)
+	e.GET("/api/federation/gateways", h.GetFederatedGateways)
+
+	// SQL macro endpoints, addressed by macro name
+	e.GET("/api/macros", h.GetSQLMacros)
+	e.POST("/api/macros", h.CreateSQLMacro)
+	e.POST("/api/macros/expand", h.ExpandSQLMacros)
+	e.GET("/api/macros/:id", h.GetSQLMacro)
+	e.PUT("/api/macros/:id", h.UpdateSQLMacro)
+	e.DELETE("/api/macros/:id", h.DeleteSQLMacro)
+	e.GET("/api/macros/:id/versions", h.GetSQLMacroVersions)
+	e.GET("/api/macros/:id/versions/:version", h.GetSQLMacroVersion)
+	e.GET("/api/macros/:id/rules", h.GetSQLMacroRules)
+
+	// Rule groups, addressed by name
+	e.GET("/api/groups", h.GetRuleGroups)
+	e.POST("/api/groups", h.CreateRuleGroup)
+	e.GET("/api/groups/:id", h.GetRuleGroup)
+	e.PUT("/api/groups/:id", h.UpdateRuleGroup)
+	e.DELETE("/api/groups/:id", h.DeleteRuleGroup)
+	e.POST("/api/groups/:id/start", h.StartRuleGroup)
+	e.POST("/api/groups/:id/stop", h.StopRuleGroup)
+	e.GET("/api/groups/:id/export", h.ExportRuleGroup)
+
+	// On-call schedules, addressed by name
+	e.GET("/api/oncall/schedules", h.GetOnCallSchedules)
+	e.POST("/api/oncall/schedules", h.CreateOnCallSchedule)
+	e.GET("/api/oncall/schedules/:id", h.GetOnCallSchedule)
+	e.PUT("/api/oncall/schedules/:id", h.UpdateOnCallSchedule)
+	e.DELETE("/api/oncall/schedules/:id", h.DeleteOnCallSchedule)
+	e.GET("/api/oncall/schedules/:id/current", h.GetOnCallShift)
+
+	// Notifications recorded in the outbox until they are delivered
+	e.GET("/api/notifications/outbox", h.GetOutboxEntries)
+	e.POST("/api/notifications/outbox/:id/retry", h.RetryOutboxEntry)
+
+	// Slack interactivity, e.g. acknowledge buttons
+	e.POST("/api/integrations/slack/actions", h.SlackActions)
+
+	// One-click acknowledge and resolve links of alert emails
+	e.GET(notify.ActionLinkPath, h.AlertActionLink)
+
+	// Delivery status of SMS messages and voice calls
+	e.POST(notify.TwilioStatusPath, h.TwilioStatus)
+	e.GET("/api/notifications/log", h.GetNotificationLog)
+
+	// Devices alerts are pushed to
+	e.GET("/api/push/devices", h.GetPushDevices)
+	e.POST("/api/push/devices", h.RegisterPushDevice)
+	e.DELETE("/api/push/devices/:token", h.UnregisterPushDevice)
+
+	// Severity levels, lowest first
+	e.GET("/api/severities", h.GetSeverities)
+
+	// Health check, also recreating missing rule views
+	e.GET("/api/health", h.GetHealth)
+	e.GET("/api/health/self-alerts", h.GetSelfAlerts)
+
+	// Diagnostics bundle for support tickets
+	e.GET("/api/admin/diagnostics", h.GetDiagnostics)
+
+	// Emergency switch stopping notifications, and optionally rule evaluation, gateway-wide
+	e.GET("/api/admin/pause", h.GetPause)
+	e.POST("/api/admin/pause", h.Pause)
+	e.POST("/api/admin/resume", h.Resume)
+
+	// Prometheus metrics
+	e.GET("/metrics", h.Metrics)
 }
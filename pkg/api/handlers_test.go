@@ -57,7 +57,7 @@ func TestCreateRule(t *testing.T) {
 				Query:       "SELECT * FROM network_logs",
 				Severity:    "critical",
 			},
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusUnprocessableEntity,
 		},
 	}
 
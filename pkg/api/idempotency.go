@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make retries safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyTTL is how long a completed response is kept for replay
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyEntry is the recorded outcome of a request made with an idempotency key
+type idempotencyEntry struct {
+	requestHash [32]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// IdempotencyStore remembers responses by idempotency key so retried requests get the
+// original response instead of being executed again. Entries are kept in memory.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+}
+
+// NewIdempotencyStore creates an empty idempotency store
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     idempotencyTTL,
+	}
+}
+
+// begin reserves a key for a request. It returns the existing entry if the key was seen before.
+func (s *IdempotencyStore) begin(key string, requestHash [32]byte) (*idempotencyEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range s.entries {
+		if e.done && now.After(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+
+	if existing, ok := s.entries[key]; ok {
+		return existing, true
+	}
+
+	s.entries[key] = &idempotencyEntry{requestHash: requestHash}
+	return nil, false
+}
+
+// complete records the response for a key
+func (s *IdempotencyStore) complete(key string, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.done = true
+		e.status = status
+		e.contentType = contentType
+		e.body = body
+		e.expiresAt = time.Now().Add(s.ttl)
+	}
+}
+
+// release forgets a key so the request can be retried
+func (s *IdempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// recordingWriter captures the response body while it is written to the client
+type recordingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Idempotency returns middleware that replays the original response for requests repeated with the same
+// Idempotency-Key header. A key reused with a different request body is rejected, and server errors are
+// not recorded so the client can retry them.
+func Idempotency(store *IdempotencyStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			idempotencyKey := c.Request().Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				return next(c)
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return ErrorJSON(c, http.StatusBadRequest, "Failed to read request body")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			// Keys are scoped to the endpoint so the same key can't collide across resources
+			key := c.Request().Method + " " + c.Request().URL.Path + " " + idempotencyKey
+			requestHash := sha256.Sum256(body)
+
+			if existing, found := store.begin(key, requestHash); found {
+				if existing.requestHash != requestHash {
+					return writeError(c, http.StatusUnprocessableEntity, &APIError{
+						Code:    ErrorCodeIdempotencyKeyReused,
+						Message: "Idempotency-Key was already used with a different request",
+					})
+				}
+				if !existing.done {
+					return writeError(c, http.StatusConflict, &APIError{
+						Code:      ErrorCodeRequestInProgress,
+						Message:   "A request with this Idempotency-Key is still in progress",
+						Retryable: true,
+					})
+				}
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(existing.status, existing.contentType, existing.body)
+			}
+
+			recorder := &recordingWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				store.release(key)
+			} else {
+				store.complete(key, status, c.Response().Header().Get(echo.HeaderContentType), recorder.body.Bytes())
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	e := echo.New()
+	calls := 0
+	e.POST("/api/rules", func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]int{"call": calls})
+	}, Idempotency(NewIdempotencyStore()))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("key-1", `{"name":"a"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	// A retry with the same key gets the original response without running the handler again
+	retry := send("key-1", `{"name":"a"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// The same key with a different body is rejected
+	assert.Equal(t, http.StatusUnprocessableEntity, send("key-1", `{"name":"b"}`).Code)
+
+	// Requests without a key are not deduplicated
+	send("", `{"name":"a"}`)
+	send("", `{"name":"a"}`)
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotencyDoesNotRecordServerErrors(t *testing.T) {
+	e := echo.New()
+	calls := 0
+	e.POST("/api/alerts/:id/acknowledge", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "boom"})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+	}, Idempotency(NewIdempotencyStore()))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/alerts/rule1:dev1/acknowledge", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "ack-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, send())
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, http.StatusOK, send())
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// incidentsUnavailable responds when incidents aren't enabled
+func incidentsUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Incidents are not enabled")
+}
+
+// incidentError maps incident store errors to HTTP responses
+func incidentError(c echo.Context, id string, err error) error {
+	if errors.Is(err, services.ErrIncidentNotFound) {
+		return notFound(c, "Incident", id)
+	}
+	if !errors.Is(err, services.ErrIncidentResolved) && !errors.Is(err, services.ErrInvalidIncidentQuery) {
+		logrus.Errorf("Error handling incident %s: %v", id, err)
+	}
+	return serviceError(c, err, "Failed to handle incident")
+}
+
+// GetIncidents returns the incidents, latest first, optionally filtered by ?status=
+func (h *APIHandler) GetIncidents(c echo.Context) error {
+	store := h.ruleService.Incidents()
+	if store == nil {
+		return incidentsUnavailable(c)
+	}
+	incidents, err := store.List(c.Request().Context(), c.QueryParam("status"))
+	if err != nil {
+		return incidentError(c, "", err)
+	}
+	return c.JSON(http.StatusOK, incidents)
+}
+
+// GetIncident returns an incident with its member alerts
+func (h *APIHandler) GetIncident(c echo.Context) error {
+	store := h.ruleService.Incidents()
+	if store == nil {
+		return incidentsUnavailable(c)
+	}
+	id := c.Param("id")
+	incident, err := store.Get(c.Request().Context(), id)
+	if err != nil {
+		return incidentError(c, id, err)
+	}
+	return c.JSON(http.StatusOK, incident)
+}
+
+// AcknowledgeIncident marks an incident as being worked on
+func (h *APIHandler) AcknowledgeIncident(c echo.Context) error {
+	store := h.ruleService.Incidents()
+	if store == nil {
+		return incidentsUnavailable(c)
+	}
+	id := c.Param("id")
+	var req models.IncidentActionRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	incident, err := store.Acknowledge(c.Request().Context(), id, req.By)
+	if err != nil {
+		return incidentError(c, id, err)
+	}
+	return c.JSON(http.StatusOK, incident)
+}
+
+// ResolveIncident closes an incident, so new alerts open a new one
+func (h *APIHandler) ResolveIncident(c echo.Context) error {
+	store := h.ruleService.Incidents()
+	if store == nil {
+		return incidentsUnavailable(c)
+	}
+	id := c.Param("id")
+	var req models.IncidentActionRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	incident, err := store.Resolve(c.Request().Context(), id, req.By)
+	if err != nil {
+		return incidentError(c, id, err)
+	}
+	return c.JSON(http.StatusOK, incident)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// inhibitionsUnavailable responds when the rule service has no inhibition store
+func inhibitionsUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Inhibitions are not available")
+}
+
+// inhibitionError maps inhibition store errors to HTTP responses
+func inhibitionError(c echo.Context, name string, err error) error {
+	if errors.Is(err, services.ErrInhibitionNotFound) {
+		return notFound(c, "Inhibition", name)
+	}
+	if !errors.Is(err, services.ErrInhibitionExists) && !errors.Is(err, services.ErrInvalidInhibition) {
+		logrus.Errorf("Error handling inhibition %s: %v", name, err)
+	}
+	return serviceError(c, err, "Failed to save inhibition")
+}
+
+// GetInhibitions returns all inhibitions
+func (h *APIHandler) GetInhibitions(c echo.Context) error {
+	store := h.ruleService.Inhibitions()
+	if store == nil {
+		return inhibitionsUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, store.List())
+}
+
+// GetInhibition returns an inhibition by name
+func (h *APIHandler) GetInhibition(c echo.Context) error {
+	store := h.ruleService.Inhibitions()
+	if store == nil {
+		return inhibitionsUnavailable(c)
+	}
+	name := c.Param("id")
+	inhibition, err := store.Get(name)
+	if err != nil {
+		return inhibitionError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, inhibition)
+}
+
+// CreateInhibition creates an inhibition
+func (h *APIHandler) CreateInhibition(c echo.Context) error {
+	store := h.ruleService.Inhibitions()
+	if store == nil {
+		return inhibitionsUnavailable(c)
+	}
+	var req models.Inhibition
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	inhibition, err := store.Create(c.Request().Context(), &req)
+	if err != nil {
+		return inhibitionError(c, req.Name, err)
+	}
+	return c.JSON(http.StatusCreated, inhibition)
+}
+
+// UpdateInhibition replaces the severities, labels and description of an inhibition
+func (h *APIHandler) UpdateInhibition(c echo.Context) error {
+	store := h.ruleService.Inhibitions()
+	if store == nil {
+		return inhibitionsUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.Inhibition
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	inhibition, err := store.Update(c.Request().Context(), name, &req)
+	if err != nil {
+		return inhibitionError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, inhibition)
+}
+
+// DeleteInhibition deletes an inhibition
+func (h *APIHandler) DeleteInhibition(c echo.Context) error {
+	store := h.ruleService.Inhibitions()
+	if store == nil {
+		return inhibitionsUnavailable(c)
+	}
+	name := c.Param("id")
+	if err := store.Delete(c.Request().Context(), name); err != nil {
+		return inhibitionError(c, name, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// ruleMetric describes a per-rule gauge exposed on the Prometheus endpoint
+type ruleMetric struct {
+	name  string
+	help  string
+	value func(*services.RuleStats) float64
+}
+
+var ruleMetrics = []ruleMetric{
+	{"tp_alert_gateway_rule_rows_per_second", "Rows per second flowing through the rule view", func(s *services.RuleStats) float64 { return s.RowsPerSecond }},
+	{"tp_alert_gateway_rule_alerts", "Alerts created by the rule in the sampling window", func(s *services.RuleStats) float64 { return float64(s.Alerts) }},
+	{"tp_alert_gateway_rule_alert_lag_avg_seconds", "Average delay between event time and alert creation", func(s *services.RuleStats) float64 { return s.AvgLagMs / 1000 }},
+	{"tp_alert_gateway_rule_alert_lag_p95_seconds", "95th percentile delay between event time and alert creation", func(s *services.RuleStats) float64 { return s.P95LagMs / 1000 }},
+	{"tp_alert_gateway_rule_alert_lag_max_seconds", "Maximum delay between event time and alert creation", func(s *services.RuleStats) float64 { return s.MaxLagMs / 1000 }},
+}
+
+// Metrics exposes per-rule evaluation metrics in the Prometheus text format
+func (h *APIHandler) Metrics(c echo.Context) error {
+	stats, err := h.ruleService.GetAllRuleStats(c.Request().Context(), services.DefaultStatsWindow)
+	if err != nil {
+		logrus.Errorf("Error sampling rule stats for metrics: %v", err)
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("failed to sample rule stats: %v\n", err))
+	}
+
+	var b strings.Builder
+	for _, m := range ruleMetrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", m.name)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{rule_id=\"%s\",rule_name=\"%s\"} %g\n", m.name, escapeLabel(s.RuleID), escapeLabel(s.RuleName), m.value(s))
+		}
+	}
+
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
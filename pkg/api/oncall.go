@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// onCallUnavailable responds when the rule service has no on-call schedule store
+func onCallUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "On-call schedules are not available")
+}
+
+// onCallError maps on-call schedule store errors to HTTP responses
+func onCallError(c echo.Context, name string, err error) error {
+	if errors.Is(err, services.ErrScheduleNotFound) {
+		return notFound(c, "On-call schedule", name)
+	}
+	if !errors.Is(err, services.ErrScheduleExists) && !errors.Is(err, services.ErrInvalidSchedule) {
+		logrus.Errorf("Error handling on-call schedule %s: %v", name, err)
+	}
+	return serviceError(c, err, "Failed to save on-call schedule")
+}
+
+// GetOnCallSchedules returns all on-call schedules
+func (h *APIHandler) GetOnCallSchedules(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, store.List())
+}
+
+// GetOnCallSchedule returns an on-call schedule by name
+func (h *APIHandler) GetOnCallSchedule(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	name := c.Param("id")
+	schedule, err := store.Get(name)
+	if err != nil {
+		return onCallError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// GetOnCallShift returns who is on call in a schedule now, or at the RFC3339 time in the at parameter
+func (h *APIHandler) GetOnCallShift(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	at := time.Now()
+	if param := c.QueryParam("at"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "at must be an RFC3339 time")
+		}
+		at = parsed
+	}
+
+	name := c.Param("id")
+	shift, err := store.ShiftAt(name, at)
+	if err != nil {
+		return onCallError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, shift)
+}
+
+// CreateOnCallSchedule creates an on-call schedule
+func (h *APIHandler) CreateOnCallSchedule(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	var req models.OnCallSchedule
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	schedule, err := store.Create(c.Request().Context(), &req)
+	if err != nil {
+		return onCallError(c, req.Name, err)
+	}
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+// UpdateOnCallSchedule replaces the rotation, overrides and description of an on-call schedule
+func (h *APIHandler) UpdateOnCallSchedule(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.OnCallSchedule
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	schedule, err := store.Update(c.Request().Context(), name, &req)
+	if err != nil {
+		return onCallError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteOnCallSchedule deletes an on-call schedule
+func (h *APIHandler) DeleteOnCallSchedule(c echo.Context) error {
+	store := h.ruleService.OnCallSchedules()
+	if store == nil {
+		return onCallUnavailable(c)
+	}
+	name := c.Param("id")
+	if err := store.Delete(c.Request().Context(), name); err != nil {
+		return onCallError(c, name, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// outboxUnavailable responds when the notification outbox isn't enabled
+func outboxUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Notification outbox is not enabled")
+}
+
+// GetOutboxEntries returns the notification outbox entries, newest first, optionally only those with
+// the status in the status parameter
+func (h *APIHandler) GetOutboxEntries(c echo.Context) error {
+	outbox := h.ruleService.NotificationOutbox()
+	if outbox == nil {
+		return outboxUnavailable(c)
+	}
+
+	status := c.QueryParam("status")
+	switch status {
+	case "", services.OutboxStatusPending, services.OutboxStatusSent, services.OutboxStatusFailed:
+	default:
+		return ErrorJSON(c, http.StatusBadRequest, "status must be pending, sent or failed")
+	}
+	limit := 100
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return ErrorJSON(c, http.StatusBadRequest, "limit must be a positive integer")
+		}
+	}
+
+	entries, err := outbox.Entries(c.Request().Context(), status, limit)
+	if err != nil {
+		logrus.Errorf("Error listing notification outbox: %v", err)
+		return serviceError(c, err, "Failed to list notification outbox")
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// RetryOutboxEntry delivers a failed outbox entry again to the notifiers that didn't deliver it
+func (h *APIHandler) RetryOutboxEntry(c echo.Context) error {
+	outbox := h.ruleService.NotificationOutbox()
+	if outbox == nil {
+		return outboxUnavailable(c)
+	}
+
+	id := c.Param("id")
+	entry, err := outbox.Retry(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrOutboxEntryNotFound) {
+			return notFound(c, "Outbox entry", id)
+		}
+		logrus.Errorf("Error retrying outbox entry %s: %v", id, err)
+		return serviceError(c, err, "Failed to retry outbox entry")
+	}
+	return c.JSON(http.StatusOK, entry)
+}
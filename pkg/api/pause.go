@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// PausedHeader is set on every API response while the gateway is paused
+const PausedHeader = "X-Gateway-Paused"
+
+// pauseFlag is middleware flagging every response while the gateway is paused
+func (h *APIHandler) pauseFlag(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if h.ruleService != nil && h.ruleService.Paused() {
+			c.Response().Header().Set(PausedHeader, "true")
+		}
+		return next(c)
+	}
+}
+
+// GetPause returns whether the gateway is paused
+func (h *APIHandler) GetPause(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ruleService.PauseState())
+}
+
+// Pause stops notification dispatch gateway-wide, and with stopRules also stops the running rules
+func (h *APIHandler) Pause(c echo.Context) error {
+	var req models.PauseRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	state, err := h.ruleService.Pause(c.Request().Context(), &req)
+	if err != nil {
+		logrus.Errorf("Error pausing the gateway: %v", err)
+		return serviceError(c, err, "Failed to pause the gateway")
+	}
+	// The middleware ran before the pause took effect
+	c.Response().Header().Set(PausedHeader, "true")
+	return c.JSON(http.StatusOK, state)
+}
+
+// Resume restarts notification dispatch and the rules the pause stopped
+func (h *APIHandler) Resume(c echo.Context) error {
+	var req models.ResumeRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	state, err := h.ruleService.Resume(c.Request().Context(), &req)
+	if err != nil {
+		logrus.Errorf("Error resuming the gateway: %v", err)
+		return serviceError(c, err, "Failed to resume the gateway")
+	}
+	c.Response().Header().Del(PausedHeader)
+	return c.JSON(http.StatusOK, state)
+}
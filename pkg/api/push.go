@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// pushUnavailable responds when push notifications aren't enabled
+func pushUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Push notifications are not enabled")
+}
+
+// pushDeviceError maps push device store errors to HTTP responses
+func pushDeviceError(c echo.Context, token string, err error) error {
+	if errors.Is(err, services.ErrPushDeviceNotFound) {
+		return notFound(c, "Push device", token)
+	}
+	if !errors.Is(err, services.ErrInvalidPushDevice) {
+		logrus.Errorf("Error handling push device: %v", err)
+	}
+	return serviceError(c, err, "Failed to handle push device")
+}
+
+// GetPushDevices returns the devices registered for push notifications
+func (h *APIHandler) GetPushDevices(c echo.Context) error {
+	store := h.ruleService.PushDevices()
+	if store == nil {
+		return pushUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, store.List())
+}
+
+// RegisterPushDevice registers a device for push notifications, or refreshes one registered before
+func (h *APIHandler) RegisterPushDevice(c echo.Context) error {
+	store := h.ruleService.PushDevices()
+	if store == nil {
+		return pushUnavailable(c)
+	}
+	var req models.PushDevice
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	device, err := store.Register(c.Request().Context(), &req)
+	if err != nil {
+		return pushDeviceError(c, req.Token, err)
+	}
+	return c.JSON(http.StatusCreated, device)
+}
+
+// UnregisterPushDevice stops pushing alerts to a device
+func (h *APIHandler) UnregisterPushDevice(c echo.Context) error {
+	store := h.ruleService.PushDevices()
+	if store == nil {
+		return pushUnavailable(c)
+	}
+	token := c.Param("token")
+	if err := store.Unregister(c.Request().Context(), token); err != nil {
+		return pushDeviceError(c, token, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// ruleGroupsUnavailable responds when the rule service has no rule group store
+func ruleGroupsUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Rule groups are not available")
+}
+
+// ruleGroupError maps rule group errors to HTTP responses
+func ruleGroupError(c echo.Context, name string, err error) error {
+	if errors.Is(err, services.ErrRuleGroupNotFound) {
+		return notFound(c, "Rule group", name)
+	}
+	if !errors.Is(err, services.ErrRuleGroupExists) && !errors.Is(err, services.ErrInvalidRuleGroup) &&
+		!errors.Is(err, services.ErrRuleGroupInUse) {
+		logrus.Errorf("Error handling rule group %s: %v", name, err)
+	}
+	return serviceError(c, err, "Failed to handle rule group")
+}
+
+// GetRuleGroups returns all rule groups with their rule counts, optionally only those in ?folder=
+// and its subfolders
+func (h *APIHandler) GetRuleGroups(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	groups, err := h.ruleService.ListRuleGroups(c.Request().Context(), c.QueryParam("folder"))
+	if err != nil {
+		return ruleGroupError(c, "", err)
+	}
+	return c.JSON(http.StatusOK, groups)
+}
+
+// GetRuleGroup returns a rule group by name
+func (h *APIHandler) GetRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	name := c.Param("id")
+	group, err := h.ruleService.GetRuleGroup(c.Request().Context(), name)
+	if err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, group)
+}
+
+// CreateRuleGroup creates a rule group
+func (h *APIHandler) CreateRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	var req models.RuleGroup
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	group, err := h.ruleService.CreateRuleGroup(c.Request().Context(), &req)
+	if err != nil {
+		return ruleGroupError(c, req.Name, err)
+	}
+	return c.JSON(http.StatusCreated, group)
+}
+
+// UpdateRuleGroup replaces the folder, description and notification defaults of a rule group
+func (h *APIHandler) UpdateRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.RuleGroup
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	group, err := h.ruleService.UpdateRuleGroup(c.Request().Context(), name, &req)
+	if err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, group)
+}
+
+// DeleteRuleGroup deletes a rule group without rules
+func (h *APIHandler) DeleteRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	name := c.Param("id")
+	if err := h.ruleService.DeleteRuleGroup(c.Request().Context(), name); err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// StartRuleGroup starts all rules of a group, reporting which started, were already running or failed
+func (h *APIHandler) StartRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	name := c.Param("id")
+	result, err := h.ruleService.StartRuleGroup(c.Request().Context(), name)
+	if err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// StopRuleGroup stops all running rules of a group
+func (h *APIHandler) StopRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	name := c.Param("id")
+	result, err := h.ruleService.StopRuleGroup(c.Request().Context(), name)
+	if err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// ExportRuleGroup streams the rules of a group as CSV or a JSON array
+func (h *APIHandler) ExportRuleGroup(c echo.Context) error {
+	if h.ruleService.RuleGroups() == nil {
+		return ruleGroupsUnavailable(c)
+	}
+	format, err := exportFormat(c)
+	if err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, err.Error())
+	}
+	name := c.Param("id")
+	if _, err := h.ruleService.RuleGroups().Get(name); err != nil {
+		return ruleGroupError(c, name, err)
+	}
+	rules, err := h.ruleService.RuleGroupRules(c.Request().Context(), name)
+	if err != nil {
+		return ruleGroupError(c, name, err)
+	}
+
+	writeRulesExport(c, format, "rules-"+name, rules)
+	return nil
+}
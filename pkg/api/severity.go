@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// normalizeSeverity lowercases a requested severity and checks it is one of the configured levels.
+// An empty severity is left empty, rules don't need one.
+func (h *APIHandler) normalizeSeverity(severity *models.RuleSeverity) error {
+	*severity = models.RuleSeverity(strings.ToLower(strings.TrimSpace(string(*severity))))
+	if *severity == "" {
+		return nil
+	}
+	return h.ruleService.SeverityLevels().Validate(*severity)
+}
+
+// GetSeverities returns the severities rules may use, lowest first
+func (h *APIHandler) GetSeverities(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ruleService.SeverityLevels().Levels())
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+func TestNormalizeSeverity(t *testing.T) {
+	ruleService := &services.RuleService{}
+	levels, err := models.NewSeverityLevels([]string{"low", "high", "page"})
+	require.NoError(t, err)
+	ruleService.SetSeverityLevels(levels)
+	h := &APIHandler{ruleService: ruleService}
+
+	severity := models.RuleSeverity(" High ")
+	assert.NoError(t, h.normalizeSeverity(&severity))
+	assert.Equal(t, models.RuleSeverity("high"), severity)
+
+	empty := models.RuleSeverity("")
+	assert.NoError(t, h.normalizeSeverity(&empty))
+
+	critical := models.RuleSeverityCritical
+	assert.EqualError(t, h.normalizeSeverity(&critical), `invalid severity "critical", expected one of low, high, page`)
+}
+
+func TestCreateRuleRejectsUnknownSeverity(t *testing.T) {
+	e := echo.New()
+	h := &APIHandler{ruleService: &services.RuleService{}}
+
+	body := `{"name": "hot devices", "query": "SELECT * FROM devices", "severity": "urgent"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, h.CreateRule(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "expected one of info, warning, critical")
+}
+
+func TestCreateRuleRequiresQueryForQueryRules(t *testing.T) {
+	e := echo.New()
+	h := &APIHandler{ruleService: &services.RuleService{}}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/rules", strings.NewReader(`{"name": "hot devices"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, h.CreateRule(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Query is required for query rules")
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// slackIntegration holds what the Slack interactivity endpoint needs, nil when it's not configured
+type slackIntegration struct {
+	notifier      *notify.SlackNotifier
+	signingSecret string
+	userNames     map[string]string // Names alerts are acknowledged as, by Slack user ID
+}
+
+// slackActionPayload is the part of a Slack block_actions payload the gateway uses
+type slackActionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+	Message     struct {
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// SetSlack enables acknowledging alerts from the acknowledge buttons of Slack messages. Requests
+// must be signed with signingSecret; userNames maps Slack user IDs to the names alerts are
+// acknowledged as.
+func (h *APIHandler) SetSlack(notifier *notify.SlackNotifier, signingSecret string, userNames map[string]string) {
+	h.slack = &slackIntegration{notifier: notifier, signingSecret: signingSecret, userNames: userNames}
+}
+
+// SlackActions handles Slack interactivity requests, acknowledging the alert of a pressed
+// acknowledge button and replacing the message with who acknowledged it
+func (h *APIHandler) SlackActions(c echo.Context) error {
+	if h.slack == nil {
+		return ErrorJSON(c, http.StatusServiceUnavailable, "Slack interactivity is not configured")
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Failed to read request body")
+	}
+	if err := notify.VerifySlackSignature(h.slack.signingSecret, c.Request().Header.Get(notify.SlackTimestampHeader),
+		c.Request().Header.Get(notify.SlackSignatureHeader), body, time.Now()); err != nil {
+		logrus.Warnf("Rejected Slack action: %v", err)
+		return ErrorJSON(c, http.StatusUnauthorized, "Invalid Slack signature")
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+	var payload slackActionPayload
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid Slack payload")
+	}
+	if payload.Type != "block_actions" {
+		return c.NoContent(http.StatusOK)
+	}
+
+	acknowledgedBy := h.slack.userName(payload)
+	for _, action := range payload.Actions {
+		if action.ActionID != notify.SlackAcknowledgeAction {
+			continue
+		}
+
+		text := fmt.Sprintf("%s\n:white_check_mark: Acknowledged by %s", payload.Message.Text, acknowledgedBy)
+		if err := h.ruleService.AcknowledgeAlertFrom(c.Request().Context(), action.Value, acknowledgedBy, "Slack"); err != nil {
+			logrus.Warnf("Failed to acknowledge alert %s from Slack: %v", action.Value, err)
+			text = fmt.Sprintf("%s\n:warning: %s couldn't acknowledge the alert: %v", payload.Message.Text, acknowledgedBy, err)
+		}
+		if payload.ResponseURL != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := h.slack.notifier.Respond(ctx, payload.ResponseURL, text)
+			cancel()
+			if err != nil {
+				logrus.Warnf("Failed to update Slack message of alert %s: %v", action.Value, err)
+			}
+		}
+	}
+
+	// Slack only needs to know the request arrived
+	return c.NoContent(http.StatusOK)
+}
+
+// userName returns the name a Slack user acknowledges alerts as
+func (s *slackIntegration) userName(payload slackActionPayload) string {
+	if name := s.userNames[payload.User.ID]; name != "" {
+		return name
+	}
+	for _, name := range []string{payload.User.Username, payload.User.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return "slack:" + payload.User.ID
+}
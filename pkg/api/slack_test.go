@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestSlackActionsRejectsUnsignedRequests(t *testing.T) {
+	e := echo.New()
+	h := &APIHandler{}
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/integrations/slack/actions", strings.NewReader("payload=%7B%7D"))
+		req.Header.Set(notify.SlackTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+		req.Header.Set(notify.SlackSignatureHeader, "v0=deadbeef")
+		rec := httptest.NewRecorder()
+		h.SlackActions(e.NewContext(req, rec))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, send().Code)
+
+	h.SetSlack(notify.NewSlackNotifier("http://example.invalid", "", false, ""), "secret", nil)
+	rec := send()
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, ErrorCodeInvalidRequest, decodeError(t, rec).Code)
+}
+
+func TestSlackUserName(t *testing.T) {
+	slack := &slackIntegration{userNames: map[string]string{"U1": "alice"}}
+	payload := func(id, username, name string) slackActionPayload {
+		var p slackActionPayload
+		p.User.ID, p.User.Username, p.User.Name = id, username, name
+		return p
+	}
+
+	assert.Equal(t, "alice", slack.userName(payload("U1", "al", "Alice")))
+	assert.Equal(t, "bob", slack.userName(payload("U2", "bob", "Bob")))
+	assert.Equal(t, "Carol", slack.userName(payload("U3", "", "Carol")))
+	assert.Equal(t, "slack:U4", slack.userName(payload("U4", "", "")))
+}
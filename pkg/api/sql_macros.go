@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// sqlMacrosUnavailable responds when the rule service has no SQL macro store
+func sqlMacrosUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "SQL macros are not available")
+}
+
+// sqlMacroError maps SQL macro errors to HTTP responses
+func sqlMacroError(c echo.Context, name string, err error) error {
+	if errors.Is(err, services.ErrSQLMacroNotFound) {
+		return notFound(c, "SQL macro", name)
+	}
+	if !errors.Is(err, services.ErrSQLMacroExists) && !errors.Is(err, services.ErrInvalidSQLMacro) &&
+		!errors.Is(err, services.ErrSQLMacroInUse) {
+		logrus.Errorf("Error handling SQL macro %s: %v", name, err)
+	}
+	return serviceError(c, err, "Failed to handle SQL macro")
+}
+
+// GetSQLMacros returns the latest version of every SQL macro
+func (h *APIHandler) GetSQLMacros(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, store.List())
+}
+
+// GetSQLMacro returns the latest version of a SQL macro by name
+func (h *APIHandler) GetSQLMacro(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	macro, err := store.Get(name)
+	if err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, macro)
+}
+
+// GetSQLMacroVersions returns every version of a SQL macro, newest first
+func (h *APIHandler) GetSQLMacroVersions(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	versions, err := store.Versions(name)
+	if err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// GetSQLMacroVersion returns a version of a SQL macro
+func (h *APIHandler) GetSQLMacroVersion(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		return ErrorJSON(c, http.StatusBadRequest, "version must be a positive integer")
+	}
+	macro, err := store.GetVersion(name, version)
+	if err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, macro)
+}
+
+// GetSQLMacroRules returns the rules whose query references a SQL macro, with the version each uses
+func (h *APIHandler) GetSQLMacroRules(c echo.Context) error {
+	if h.ruleService.SQLMacros() == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	usages, err := h.ruleService.SQLMacroRules(c.Request().Context(), name)
+	if err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, usages)
+}
+
+// CreateSQLMacro creates a SQL macro at version 1
+func (h *APIHandler) CreateSQLMacro(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	var req models.SQLMacro
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	macro, err := store.Create(c.Request().Context(), &req)
+	if err != nil {
+		return sqlMacroError(c, req.Name, err)
+	}
+	return c.JSON(http.StatusCreated, macro)
+}
+
+// UpdateSQLMacro saves a new version of a SQL macro
+func (h *APIHandler) UpdateSQLMacro(c echo.Context) error {
+	store := h.ruleService.SQLMacros()
+	if store == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.SQLMacro
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	macro, err := store.Update(c.Request().Context(), name, &req)
+	if err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, macro)
+}
+
+// DeleteSQLMacro deletes a SQL macro that no rule references
+func (h *APIHandler) DeleteSQLMacro(c echo.Context) error {
+	if h.ruleService.SQLMacros() == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	name := c.Param("id")
+	if err := h.ruleService.DeleteSQLMacro(c.Request().Context(), name); err != nil {
+		return sqlMacroError(c, name, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ExpandSQLMacros previews a query with its macro references expanded
+func (h *APIHandler) ExpandSQLMacros(c echo.Context) error {
+	if h.ruleService.SQLMacros() == nil {
+		return sqlMacrosUnavailable(c)
+	}
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	expansion, err := h.ruleService.ExpandSQLMacros(req.Query)
+	if err != nil {
+		return sqlMacroError(c, "", err)
+	}
+	return c.JSON(http.StatusOK, expansion)
+}
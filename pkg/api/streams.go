@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// DeleteStream drops a stream or view. Streams active rules read from or write to are only
+// deleted with ?force=true.
+func (h *APIHandler) DeleteStream(c echo.Context) error {
+	name := c.Param("name")
+	force := false
+	if forceStr := c.QueryParam("force"); forceStr != "" {
+		var err error
+		if force, err = strconv.ParseBool(forceStr); err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, "force must be true or false")
+		}
+	}
+
+	impact, err := h.ruleService.DeleteStream(c.Request().Context(), name, force)
+	if err != nil {
+		if !errors.Is(err, services.ErrStreamInUse) {
+			logrus.Errorf("Error deleting stream %s: %v", name, err)
+		}
+		return serviceError(c, err, "Failed to delete stream")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": fmt.Sprintf("Stream %s deleted successfully", name),
+		"impact":  impact,
+	})
+}
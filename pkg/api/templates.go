@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+)
+
+// templatesUnavailable responds when the rule service has no template store
+func templatesUnavailable(c echo.Context) error {
+	return ErrorJSON(c, http.StatusServiceUnavailable, "Notification templates are not available")
+}
+
+// templateError maps template store errors to HTTP responses
+func templateError(c echo.Context, name string, err error) error {
+	if errors.Is(err, services.ErrTemplateNotFound) {
+		return notFound(c, "Template", name)
+	}
+	if !errors.Is(err, services.ErrTemplateExists) && !errors.Is(err, services.ErrInvalidTemplate) {
+		logrus.Errorf("Error handling notification template %s: %v", name, err)
+	}
+	return serviceError(c, err, "Failed to save template")
+}
+
+// GetTemplates returns all notification templates
+func (h *APIHandler) GetTemplates(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	return c.JSON(http.StatusOK, store.List())
+}
+
+// GetTemplate returns a notification template by name
+func (h *APIHandler) GetTemplate(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	name := c.Param("id")
+	tmpl, err := store.Get(name)
+	if err != nil {
+		return templateError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
+
+// CreateTemplate creates a notification template
+func (h *APIHandler) CreateTemplate(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	var req models.NotificationTemplate
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	tmpl, err := store.Create(c.Request().Context(), &req)
+	if err != nil {
+		return templateError(c, req.Name, err)
+	}
+	return c.JSON(http.StatusCreated, tmpl)
+}
+
+// UpdateTemplate replaces the body, translations and description of a notification template
+func (h *APIHandler) UpdateTemplate(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.NotificationTemplate
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	tmpl, err := store.Update(c.Request().Context(), name, &req)
+	if err != nil {
+		return templateError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteTemplate deletes a notification template
+func (h *APIHandler) DeleteTemplate(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	name := c.Param("id")
+	if err := store.Delete(c.Request().Context(), name); err != nil {
+		return templateError(c, name, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PreviewTemplate renders a notification template against a sample alert
+func (h *APIHandler) PreviewTemplate(c echo.Context) error {
+	store := h.ruleService.Templates()
+	if store == nil {
+		return templatesUnavailable(c)
+	}
+	name := c.Param("id")
+	var req models.TemplatePreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	if req.Locale != "" {
+		if err := i18n.Validate(req.Locale); err != nil {
+			return ErrorJSON(c, http.StatusBadRequest, err.Error())
+		}
+	}
+
+	// A stored template renders its translation for the locale, or falls back to English
+	body, locale := req.Body, req.Locale
+	if body == "" {
+		tmpl, err := store.Get(name)
+		if err != nil {
+			return templateError(c, name, err)
+		}
+		body, locale = services.TemplateBody(tmpl, req.Locale)
+	}
+	eventType := req.Event
+	if eventType == "" {
+		eventType = notify.EventFired
+	}
+	alert := req.Alert
+	if alert == nil {
+		alert = services.SampleAlert()
+	}
+
+	if locale == "" {
+		locale = i18n.DefaultLocale
+	}
+	message, err := services.RenderLocalizedNotificationTemplate(body, locale, eventType, alert)
+	if err != nil {
+		return templateError(c, name, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": message, "locale": i18n.Normalize(locale)})
+}
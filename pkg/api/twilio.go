@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// defaultNotificationLogLimit is how many delivery records are listed when no limit is given
+const defaultNotificationLogLimit = 100
+
+// SetTwilio enables the status callbacks of Twilio messages and calls, recorded in log, and
+// listing the notification log
+func (h *APIHandler) SetTwilio(notifier *notify.TwilioNotifier, log *notify.NotificationLog) {
+	h.twilio = notifier
+	h.deliveries = log
+}
+
+// TwilioStatus records the delivery status Twilio reports for a message or call. Requests must be
+// signed with the account's auth token.
+func (h *APIHandler) TwilioStatus(c echo.Context) error {
+	if h.twilio == nil {
+		return ErrorJSON(c, http.StatusServiceUnavailable, "Twilio is not configured")
+	}
+	// Twilio signs the body's parameters; the query names what the message was sent for
+	if err := c.Request().ParseForm(); err != nil {
+		return ErrorJSON(c, http.StatusBadRequest, "Invalid request format")
+	}
+
+	if err := h.twilio.HandleStatusCallback(c.Request().Context(), c.Request().URL.RawQuery, c.Request().PostForm,
+		c.Request().Header.Get(notify.TwilioSignatureHeader)); err != nil {
+		logrus.Warnf("Rejected Twilio status callback: %v", err)
+		return ErrorJSON(c, http.StatusUnauthorized, "Invalid Twilio signature")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetNotificationLog returns the delivery records of SMS messages and voice calls, newest first,
+// optionally of one alert with ?alert_id= and up to ?limit=
+func (h *APIHandler) GetNotificationLog(c echo.Context) error {
+	if h.deliveries == nil {
+		return ErrorJSON(c, http.StatusServiceUnavailable, "Notification log is not enabled")
+	}
+	limit := defaultNotificationLogLimit
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return ErrorJSON(c, http.StatusBadRequest, "limit must be a positive integer")
+		}
+		limit = parsed
+	}
+
+	records, err := h.deliveries.List(c.Request().Context(), c.QueryParam("alert_id"), limit)
+	if err != nil {
+		return serviceError(c, err, "Failed to read notification log")
+	}
+	return c.JSON(http.StatusOK, records)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestTwilioStatusRejectsUnsignedCallbacks(t *testing.T) {
+	e := echo.New()
+	h := &APIHandler{}
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, notify.TwilioStatusPath+"?alert_id=rule1%3Adev1%3A4",
+			strings.NewReader("MessageSid=SM1&MessageStatus=delivered"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set(notify.TwilioSignatureHeader, "bogus")
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.TwilioStatus(e.NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, post().Code)
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.GetNotificationLog(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/notifications/log", nil), rec)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	twilio, err := notify.NewTwilioNotifier(notify.TwilioOptions{AccountSID: "AC123", AuthToken: "token", From: "+15551234567",
+		Recipients: []notify.TwilioRecipient{{Phone: "+15550000001"}}, BaseURL: "https://alerts.example.com"})
+	require.NoError(t, err)
+	h.SetTwilio(twilio, nil)
+	assert.Equal(t, http.StatusUnauthorized, post().Code)
+}
@@ -0,0 +1,87 @@
+// Package archive writes alerts to cold storage in S3 or Google Cloud Storage
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is the file format alerts are archived in
+type Format string
+
+// Supported archive formats
+const (
+	FormatJSONL   Format = "jsonl"   // One JSON object per line
+	FormatParquet Format = "parquet" // Columnar, for querying the archive in place
+)
+
+// ParseFormat returns the format with the given name, case-insensitively
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(name))); format {
+	case FormatJSONL, FormatParquet:
+		return format, nil
+	case "":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format %q, expected jsonl or parquet", name)
+	}
+}
+
+// Extension returns the file extension of archive objects in the format
+func (f Format) Extension() string {
+	if f == FormatParquet {
+		return "parquet"
+	}
+	return "jsonl"
+}
+
+// ContentType returns the MIME type of archive objects in the format
+func (f Format) ContentType() string {
+	if f == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// Record is an archived alert, a row of an alert acks stream
+type Record struct {
+	AlertID   string     `json:"alertId" parquet:"alert_id"`
+	RuleID    string     `json:"ruleId" parquet:"rule_id"`
+	EntityID  string     `json:"entityId" parquet:"entity_id"`
+	FiringSeq int64      `json:"firingSeq" parquet:"firing_seq"`
+	State     string     `json:"state" parquet:"state"`
+	Severity  string     `json:"severity,omitempty" parquet:"severity"`
+	CreatedAt time.Time  `json:"createdAt" parquet:"created_at,timestamp(millisecond)"`
+	UpdatedAt time.Time  `json:"updatedAt" parquet:"updated_at,timestamp(millisecond)"`
+	UpdatedBy string     `json:"updatedBy,omitempty" parquet:"updated_by"`
+	Comment   string     `json:"comment,omitempty" parquet:"comment"`
+	EventTime *time.Time `json:"eventTime,omitempty" parquet:"event_time,optional"`
+	Stream    string     `json:"stream" parquet:"stream"` // Alert acks stream the alert was archived from
+}
+
+// Encode writes records to w in the given format
+func Encode(w io.Writer, format Format, records []Record) error {
+	switch format {
+	case FormatParquet:
+		writer := parquet.NewGenericWriter[Record](w)
+		if _, err := writer.Write(records); err != nil {
+			return fmt.Errorf("failed to write parquet rows: %w", err)
+		}
+		return writer.Close()
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
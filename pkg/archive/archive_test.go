@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords() []Record {
+	eventTime := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	return []Record{
+		{
+			AlertID: "r1:host-1:2", RuleID: "r1", EntityID: "host-1", FiringSeq: 2, State: "resolved", Severity: "critical",
+			CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), UpdatedAt: time.Date(2024, 1, 2, 4, 0, 0, 0, time.UTC),
+			UpdatedBy: "auto-resolver", EventTime: &eventTime, Stream: "tp_alert_acks_mutable",
+		},
+		{
+			AlertID: "r1:host-2:1", RuleID: "r1", EntityID: "host-2", FiringSeq: 1, State: "acknowledged",
+			CreatedAt: time.Date(2024, 1, 2, 3, 5, 0, 0, time.UTC), UpdatedAt: time.Date(2024, 1, 2, 3, 6, 0, 0, time.UTC),
+			UpdatedBy: "alice", Comment: "known issue", Stream: "tp_alert_acks_mutable",
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("Parquet")
+	require.NoError(t, err)
+	assert.Equal(t, FormatParquet, format)
+
+	format, err = ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSONL, format)
+
+	_, err = ParseFormat("csv")
+	assert.Error(t, err)
+}
+
+func TestEncodeJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, FormatJSONL, testRecords()))
+
+	assert.Equal(t,
+		`{"alertId":"r1:host-1:2","ruleId":"r1","entityId":"host-1","firingSeq":2,"state":"resolved","severity":"critical",`+
+			`"createdAt":"2024-01-02T03:04:05Z","updatedAt":"2024-01-02T04:00:00Z","updatedBy":"auto-resolver",`+
+			`"eventTime":"2024-01-02T03:04:00Z","stream":"tp_alert_acks_mutable"}`+"\n"+
+			`{"alertId":"r1:host-2:1","ruleId":"r1","entityId":"host-2","firingSeq":1,"state":"acknowledged",`+
+			`"createdAt":"2024-01-02T03:05:00Z","updatedAt":"2024-01-02T03:06:00Z","updatedBy":"alice","comment":"known issue",`+
+			`"stream":"tp_alert_acks_mutable"}`+"\n",
+		buf.String())
+}
+
+func TestEncodeParquetRoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, FormatParquet, testRecords()))
+
+	rows, err := parquet.Read[Record](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	want := testRecords()
+	for i := range rows {
+		assert.Equal(t, want[i].AlertID, rows[i].AlertID)
+		assert.Equal(t, want[i].FiringSeq, rows[i].FiringSeq)
+		assert.Equal(t, want[i].Comment, rows[i].Comment)
+		assert.True(t, want[i].UpdatedAt.Equal(rows[i].UpdatedAt))
+	}
+	require.NotNil(t, rows[0].EventTime)
+	assert.True(t, want[0].EventTime.Equal(*rows[0].EventTime))
+	assert.Nil(t, rows[1].EventTime)
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Storage providers
+const (
+	ProviderS3  = "s3"
+	ProviderGCS = "gcs"
+)
+
+// Store uploads archive objects
+type Store interface {
+	// Put uploads an object, replacing any object with the same key
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Location describes where objects are stored, e.g. s3://bucket
+	Location() string
+}
+
+// StoreConfig configures an S3 compatible object store
+type StoreConfig struct {
+	Provider        string // "s3" or "gcs", S3 when empty
+	Bucket          string
+	Region          string // AWS region, "auto" for GCS
+	Endpoint        string // Overrides the provider's endpoint, e.g. for MinIO
+	AccessKeyID     string // For GCS, an HMAC key of a service account
+	SecretAccessKey string
+}
+
+// S3Store uploads objects with the S3 API, signed with AWS Signature Version 4. Google Cloud
+// Storage is supported through its S3 compatible XML API with HMAC keys.
+type S3Store struct {
+	provider        string
+	endpoint        *url.URL
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+	now             func() time.Time
+}
+
+// NewStore creates the object store described by the configuration
+func NewStore(cfg StoreConfig) (*S3Store, error) {
+	provider := strings.ToLower(cfg.Provider)
+	if provider == "" {
+		provider = ProviderS3
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("archive bucket is required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("archive access key ID and secret access key are required")
+	}
+
+	region, endpoint := cfg.Region, cfg.Endpoint
+	switch provider {
+	case ProviderS3:
+		if region == "" {
+			region = "us-east-1"
+		}
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+	case ProviderGCS:
+		if region == "" {
+			region = "auto"
+		}
+		if endpoint == "" {
+			endpoint = "https://storage.googleapis.com"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported archive provider %q, expected s3 or gcs", cfg.Provider)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive endpoint %q", endpoint)
+	}
+
+	return &S3Store{
+		provider:        provider,
+		endpoint:        u,
+		bucket:          cfg.Bucket,
+		region:          region,
+		accessKeyID:     cfg.AccessKeyID,
+		secretAccessKey: cfg.SecretAccessKey,
+		client:          &http.Client{Timeout: 5 * time.Minute},
+		now:             time.Now,
+	}, nil
+}
+
+// Location returns the bucket URL, gs://bucket for GCS
+func (s *S3Store) Location() string {
+	scheme := "s3"
+	if s.provider == ProviderGCS {
+		scheme = "gs"
+	}
+	return fmt.Sprintf("%s://%s", scheme, s.bucket)
+}
+
+// Put uploads an object to the bucket with path-style addressing
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + strings.TrimPrefix(key, "/")
+	u.RawPath = escapePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, s.now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to a request
+func (s *S3Store) sign(req *http.Request, payload []byte, at time.Time) {
+	amzDate := at.Format("20060102T150405Z")
+	date := at.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		req.Header.Get("Content-Type"), req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+}
+
+// escapePath URI-encodes an object path the way S3 signs it: every byte but unreserved characters
+// and the slashes between segments
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStoreDefaults(t *testing.T) {
+	store, err := NewStore(StoreConfig{Bucket: "alerts", AccessKeyID: "id", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://s3.us-east-1.amazonaws.com", store.endpoint.String())
+	assert.Equal(t, "s3://alerts", store.Location())
+
+	store, err = NewStore(StoreConfig{Provider: "gcs", Bucket: "alerts", AccessKeyID: "id", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://storage.googleapis.com", store.endpoint.String())
+	assert.Equal(t, "auto", store.region)
+	assert.Equal(t, "gs://alerts", store.Location())
+
+	_, err = NewStore(StoreConfig{Provider: "azure", Bucket: "alerts", AccessKeyID: "id", SecretAccessKey: "secret"})
+	assert.Error(t, err)
+	_, err = NewStore(StoreConfig{Bucket: "alerts"})
+	assert.Error(t, err)
+}
+
+func TestSignMatchesSignatureV4(t *testing.T) {
+	store, err := NewStore(StoreConfig{Bucket: "alerts-bucket", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+
+	payload := []byte(`{"ruleId":"r1"}` + "\n")
+	req, err := http.NewRequest(http.MethodPut, "https://s3.us-east-1.amazonaws.com/alerts-bucket/archive/tp_alert_acks_mutable/run%3D1.jsonl", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	store.sign(req, payload, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	// Computed independently from the Signature Version 4 specification
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-east-1/s3/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, "+
+		"Signature=b0eca31eaa00e181e31c589ba5e2603a61d855dd60caa6b64510b9702f2241ab",
+		req.Header.Get("Authorization"))
+	assert.Equal(t, "20240102T030405Z", req.Header.Get("X-Amz-Date"))
+}
+
+func TestPutUploadsObject(t *testing.T) {
+	var gotPath, gotContentType, gotAuth string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		gotPath, gotContentType, gotAuth = r.URL.EscapedPath(), r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	store, err := NewStore(StoreConfig{Bucket: "alerts", Endpoint: server.URL, AccessKeyID: "id", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "archive/tp_alert_acks_mutable/a=b.jsonl", []byte("{}\n"), FormatJSONL.ContentType()))
+
+	assert.Equal(t, "/alerts/archive/tp_alert_acks_mutable/a%3Db.jsonl", gotPath)
+	assert.Equal(t, "application/x-ndjson", gotContentType)
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=id/"))
+	assert.Equal(t, "{}\n", string(gotBody))
+}
+
+func TestPutReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	store, err := NewStore(StoreConfig{Bucket: "alerts", Endpoint: server.URL, AccessKeyID: "id", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+	err = store.Put(context.Background(), "a.jsonl", []byte("{}\n"), FormatJSONL.ContentType())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+}
@@ -0,0 +1,337 @@
+// Package harness runs the alert gateway in-process against a disposable Proton container, so
+// end-to-end tests don't depend on a manually started Timeplus instance.
+//
+// A test calls New, which starts Proton with dockertest, provisions the system streams, and serves
+// the gateway API on a local HTTP server. Tests drive it through the helpers:
+//
+//	h := harness.New(t)
+//	stream := h.UniqueName("temperatures")
+//	h.CreateStream(stream, columns)
+//	rule := h.CreateRule(models.CreateRuleRequest{...})
+//	h.Insert(stream, map[string]interface{}{"device_id": "d1", "temperature": 35.0})
+//	alert := h.AwaitAlert(rule.ID, 30*time.Second, harness.ForEntity("d1"))
+//	h.Ack(alert.ID, "test-user")
+//
+// Set TP_E2E_ADDRESS (and TP_E2E_USERNAME, TP_E2E_PASSWORD, TP_E2E_WORKSPACE) to run against an
+// existing instance instead of a container. Tests are skipped when Docker isn't available and no
+// address is set, and with -short.
+package harness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/api"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+const (
+	defaultImage = "ghcr.io/timeplus-io/proton"
+	defaultTag   = "latest"
+	nativePort   = "8463/tcp"
+)
+
+// Harness is a running gateway backed by a Timeplus instance
+type Harness struct {
+	t testing.TB
+
+	// Client is connected to the Timeplus instance
+	Client *timeplus.Client
+	// Rules is the gateway's rule service
+	Rules *services.RuleService
+	// URL is the base URL of the gateway API
+	URL string
+
+	http   *http.Client
+	rules  []string // Rules created through the harness, deleted on cleanup
+	stream []string // Streams created through the harness, dropped on cleanup
+}
+
+// New starts Timeplus and the gateway for a test. Everything is torn down when the test ends.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+
+	cfg := startTimeplus(t)
+
+	client, err := timeplus.NewClient(cfg)
+	require.NoError(t, err, "failed to connect to Timeplus")
+	t.Cleanup(func() { client.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, client.SetupStreams(ctx), "failed to set up system streams")
+
+	ruleService, err := services.NewRuleService(client)
+	require.NoError(t, err, "failed to create rule service")
+	require.NoError(t, ruleService.ResumeRunningRules(ctx), "failed to resume running rules")
+
+	e := echo.New()
+	e.HideBanner = true
+	api.NewAPIHandler(ruleService).SetupRoutes(e)
+	server := httptest.NewServer(e)
+
+	h := &Harness{
+		t:      t,
+		Client: client,
+		Rules:  ruleService,
+		URL:    server.URL,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	// Cleanups run last-in first-out: resources are removed before the server and connection go away
+	t.Cleanup(func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ruleService.Shutdown(shutdownCtx)
+		server.Close()
+	})
+	t.Cleanup(h.cleanup)
+	return h
+}
+
+// startTimeplus returns the connection settings of the configured Timeplus instance, or starts a
+// Proton container and returns its settings
+func startTimeplus(t testing.TB) *config.TimeplusConfig {
+	t.Helper()
+
+	if address := os.Getenv("TP_E2E_ADDRESS"); address != "" {
+		return &config.TimeplusConfig{
+			Address:   address,
+			Username:  getEnv("TP_E2E_USERNAME", "default"),
+			Password:  os.Getenv("TP_E2E_PASSWORD"),
+			Workspace: getEnv("TP_E2E_WORKSPACE", "default"),
+		}
+	}
+
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		t.Skipf("skipping end-to-end test, Docker is not available and TP_E2E_ADDRESS is not set: %v", err)
+	}
+	pool.MaxWait = 2 * time.Minute
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository:   getEnv("TP_E2E_IMAGE", defaultImage),
+		Tag:          getEnv("TP_E2E_TAG", defaultTag),
+		ExposedPorts: []string{nativePort},
+	}, func(hc *docker.HostConfig) {
+		hc.AutoRemove = true
+		hc.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	require.NoError(t, err, "failed to start Proton container")
+	t.Cleanup(func() {
+		if err := pool.Purge(resource); err != nil {
+			t.Logf("failed to remove Proton container: %v", err)
+		}
+	})
+	// Don't leave the container behind if the test binary is killed
+	_ = resource.Expire(600)
+
+	address := resource.GetHostPort(nativePort)
+	require.NoError(t, pool.Retry(func() error {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}), "Proton did not start listening on %s", address)
+
+	return &config.TimeplusConfig{Address: address, Username: "default", Workspace: "default"}
+}
+
+// UniqueName returns prefix with a random suffix, for resources that must not clash between runs
+// against a shared instance
+func (h *Harness) UniqueName(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, strings.ReplaceAll(uuid.NewString()[:8], "-", ""))
+}
+
+// CreateStream creates a stream, replacing any stream of the same name. It is dropped when the test ends.
+func (h *Harness) CreateStream(name string, columns []timeplus.Column) {
+	h.t.Helper()
+	ctx := context.Background()
+
+	_, err := h.Client.ExecuteQuery(ctx, fmt.Sprintf("DROP STREAM IF EXISTS `%s`", name))
+	require.NoError(h.t, err, "failed to drop stream %s", name)
+	require.NoError(h.t, h.Client.CreateStream(ctx, name, columns), "failed to create stream %s", name)
+	h.stream = append(h.stream, name)
+}
+
+// Insert inserts a row into a stream
+func (h *Harness) Insert(stream string, row map[string]interface{}) {
+	h.t.Helper()
+
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = row[column]
+	}
+	require.NoError(h.t, h.Client.InsertIntoStream(context.Background(), stream, columns, values),
+		"failed to insert into %s", stream)
+}
+
+// CreateRule creates a rule through the API and starts it. It is deleted when the test ends.
+func (h *Harness) CreateRule(req models.CreateRuleRequest) *models.Rule {
+	h.t.Helper()
+
+	var rule models.Rule
+	h.Do(http.MethodPost, "/api/rules", req, http.StatusCreated, &rule)
+	h.rules = append(h.rules, rule.ID)
+
+	h.Do(http.MethodPost, "/api/rules/"+rule.ID+"/start", nil, http.StatusOK, nil)
+
+	// The rule stream is read back eventually consistently, so give the new status a moment to show
+	for i := 0; i < 20; i++ {
+		h.Do(http.MethodGet, "/api/rules/"+rule.ID, nil, http.StatusOK, &rule)
+		if rule.Status == models.RuleStatusRunning {
+			return &rule
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	h.t.Fatalf("rule %s did not start, status %s: %s", rule.ID, rule.Status, rule.LastError)
+	return nil
+}
+
+// Alerts returns the current alerts of a rule
+func (h *Harness) Alerts(ruleID string) []*models.Alert {
+	h.t.Helper()
+
+	var alerts []*models.Alert
+	h.Do(http.MethodGet, "/api/alerts?rule_id="+ruleID, nil, http.StatusOK, &alerts)
+	return alerts
+}
+
+// AwaitAlert waits until a rule has an alert that matches, failing the test after timeout
+func (h *Harness) AwaitAlert(ruleID string, timeout time.Duration, match func(*models.Alert) bool) *models.Alert {
+	h.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, alert := range h.Alerts(ruleID) {
+			if match == nil || match(alert) {
+				return alert
+			}
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("no matching alert for rule %s within %s", ruleID, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// AssertNoAlert checks that a rule has no matching alert for the whole duration
+func (h *Harness) AssertNoAlert(ruleID string, duration time.Duration, match func(*models.Alert) bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		for _, alert := range h.Alerts(ruleID) {
+			if match == nil || match(alert) {
+				h.t.Fatalf("unexpected alert %s for rule %s", alert.ID, ruleID)
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Ack acknowledges an alert through the API
+func (h *Harness) Ack(alertID, acknowledgedBy string) {
+	h.t.Helper()
+	h.Do(http.MethodPost, "/api/alerts/"+alertID+"/acknowledge",
+		map[string]string{"acknowledged_by": acknowledgedBy}, http.StatusOK, nil)
+}
+
+// Alert returns an alert by ID
+func (h *Harness) Alert(alertID string) *models.Alert {
+	h.t.Helper()
+
+	var alert models.Alert
+	h.Do(http.MethodGet, "/api/alerts/"+alertID, nil, http.StatusOK, &alert)
+	return &alert
+}
+
+// Do sends a request to the gateway API, requires the expected status, and decodes the response into
+// out when it isn't nil
+func (h *Harness) Do(method, path string, body interface{}, wantStatus int, out interface{}) {
+	h.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(h.t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, h.URL+path, reader)
+	require.NoError(h.t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.http.Do(req)
+	require.NoError(h.t, err, "%s %s failed", method, path)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(h.t, err)
+	require.Equal(h.t, wantStatus, resp.StatusCode, "%s %s: %s", method, path, data)
+
+	if out != nil {
+		require.NoError(h.t, json.Unmarshal(data, out), "failed to decode %s %s response", method, path)
+	}
+}
+
+// ForEntity matches alerts of an entity
+func ForEntity(entityID string) func(*models.Alert) bool {
+	return func(alert *models.Alert) bool {
+		return strings.HasPrefix(alert.ID, alert.RuleID+":"+entityID+":")
+	}
+}
+
+// cleanup deletes the rules and streams the test created, which matters when running against a
+// shared instance
+func (h *Harness) cleanup() {
+	for _, ruleID := range h.rules {
+		if err := h.Rules.DeleteRule(context.Background(), ruleID); err != nil {
+			h.t.Logf("failed to delete rule %s: %v", ruleID, err)
+		}
+	}
+	for _, stream := range h.stream {
+		if _, err := h.Client.ExecuteQuery(context.Background(), fmt.Sprintf("DROP STREAM IF EXISTS `%s`", stream)); err != nil {
+			h.t.Logf("failed to drop stream %s: %v", stream, err)
+		}
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,358 @@
+package e2e
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/e2e/harness"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/services"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// sqlContractCase is a representative rule: a source stream schema, the rule's view query, and
+// the expressions the rule service passes to the materialized view builder
+type sqlContractCase struct {
+	name            string
+	columns         []timeplus.Column
+	query           string // %s is replaced with the source stream name
+	resolveQuery    string // Optional, %s is replaced with the source stream name
+	throttleMinutes int
+	severityExpr    string
+	eventTimeExpr   string
+	row             map[string]interface{} // Row that makes the rule fire, nil when firing needs time to pass
+	payload         timeplus.PayloadLimits // Limits the triggering row is captured with
+	redaction       timeplus.Redaction     // Values masked in the triggering row
+	encrypted       bool                   // Whether the triggering row is encrypted at rest
+	dataKeys        []string               // Keys of the captured row, the row's columns but the entity when empty
+	data            map[string]interface{} // Values expected in the captured row, when they differ from the row's
+}
+
+// TestSQLContract executes the SQL the gateway generates against Proton, so syntax regressions in the
+// builders are caught when they change rather than when a rule fails to start
+func TestSQLContract(t *testing.T) {
+	h := harness.New(t)
+
+	t.Run("system streams", func(t *testing.T) {
+		schemas := append(timeplus.SystemStreamSchemas(), timeplus.AlertHistoryStreamSchema(""))
+		for _, schema := range schemas {
+			createSchemaStream(t, h, h.UniqueName("contract_"+schema.Name), schema)
+		}
+	})
+
+	cases := []sqlContractCase{
+		{
+			name: "scalar columns",
+			columns: []timeplus.Column{
+				{Name: "device_id", Type: "string"},
+				{Name: "temperature", Type: "float64"},
+				{Name: "readings", Type: "int64"},
+				{Name: "flags", Type: "uint32"},
+				{Name: "healthy", Type: "bool"},
+				{Name: "note", Type: "string", Nullable: true},
+				{Name: "battery", Type: "float64", Nullable: true},
+				{Name: "measured_at", Type: "datetime64(3)"},
+			},
+			query:           "SELECT * FROM `%s` WHERE temperature > 30",
+			resolveQuery:    "SELECT device_id FROM `%s` WHERE temperature < 25",
+			throttleMinutes: 5,
+			severityExpr:    "'warning'",
+			eventTimeExpr:   "view._tp_time",
+			row: map[string]interface{}{
+				"device_id":   "d1",
+				"temperature": 35.5,
+				"readings":    int64(12),
+				"flags":       uint32(3),
+				"healthy":     false,
+				"note":        `it's "hot"` + "\n",
+				"battery":     nil,
+				"measured_at": time.Now(),
+			},
+		},
+		{
+			name: "severity expression without throttling",
+			columns: []timeplus.Column{
+				{Name: "host", Type: "string"},
+				{Name: "cpu", Type: "float64"},
+			},
+			query:           "SELECT host, cpu FROM `%s` WHERE cpu > 80",
+			throttleMinutes: -1,
+			severityExpr:    "to_string(multi_if(cpu > 95, 'critical', 'warning'))",
+			eventTimeExpr:   "view._tp_time",
+			row:             map[string]interface{}{"host": "web-1", "cpu": 97.0},
+		},
+		{
+			name: "truncated payload",
+			columns: []timeplus.Column{
+				{Name: "host", Type: "string"},
+				{Name: "cpu", Type: "float64"},
+				{Name: "dump", Type: "string"},
+			},
+			query:           "SELECT host, cpu, dump FROM `%s` WHERE cpu > 80",
+			throttleMinutes: 5,
+			severityExpr:    "'critical'",
+			eventTimeExpr:   "view._tp_time",
+			row:             map[string]interface{}{"host": "web-1", "cpu": 97.0, "dump": strings.Repeat("x", 500)},
+			payload:         timeplus.PayloadLimits{MaxBytes: 200, KeepKeys: []string{"cpu"}},
+			dataKeys:        []string{"cpu", "_truncated", "_originalBytes"},
+		},
+		{
+			name: "redacted payload",
+			columns: []timeplus.Column{
+				{Name: "account", Type: "string"},
+				{Name: "email", Type: "string"},
+				{Name: "note", Type: "string"},
+				{Name: "amount", Type: "float64"},
+			},
+			query:           "SELECT account, email, note, amount FROM `%s` WHERE amount > 500",
+			throttleMinutes: 5,
+			severityExpr:    "'critical'",
+			eventTimeExpr:   "view._tp_time",
+			row:             map[string]interface{}{"account": "acc-1", "email": "jo@example.com", "note": "paid with 4111-1111-1111-1111", "amount": 950.0},
+			redaction:       timeplus.Redaction{Columns: []string{"email"}, Patterns: []string{`\d{4}(-\d{4}){3}`}},
+			data:            map[string]interface{}{"email": timeplus.RedactedValue, "note": "paid with " + timeplus.RedactedValue},
+		},
+		{
+			name: "nested columns",
+			columns: []timeplus.Column{
+				{Name: "host", Type: "string"},
+				{Name: "cpu", Type: "float64"},
+				{Name: "tags", Type: "array(string)"},
+				{Name: "readings", Type: "array(nullable(int32))"},
+				{Name: "labels", Type: "map(string, string)"},
+				{Name: "location", Type: "tuple(lat float64, lon float64)"},
+			},
+			query:           "SELECT * FROM `%s` WHERE cpu > 90",
+			throttleMinutes: 5,
+			severityExpr:    "'critical'",
+			eventTimeExpr:   "view._tp_time",
+			row: map[string]interface{}{
+				"host":     "web-1",
+				"cpu":      97.0,
+				"tags":     []string{"edge", "secret-42"},
+				"readings": []interface{}{int32(1), nil},
+				"labels":   map[string]string{"env": `prod "eu"`},
+				"location": map[string]interface{}{"lat": 1.5, "lon": 2.5},
+			},
+			redaction: timeplus.Redaction{Patterns: []string{`secret-\d+`}},
+			data: map[string]interface{}{
+				"tags":     []interface{}{"edge", timeplus.RedactedValue},
+				"readings": []interface{}{float64(1), nil},
+				"labels":   map[string]interface{}{"env": `prod "eu"`},
+				"location": map[string]interface{}{"lat": 1.5, "lon": 2.5},
+			},
+		},
+		{
+			name: "encrypted payload",
+			columns: []timeplus.Column{
+				{Name: "account", Type: "string"},
+				{Name: "amount", Type: "float64"},
+			},
+			query:           "SELECT account, amount FROM `%s` WHERE amount > 500",
+			throttleMinutes: 5,
+			severityExpr:    "'critical'",
+			eventTimeExpr:   "view._tp_time",
+			row:             map[string]interface{}{"account": "acc-1", "amount": 950.0},
+			encrypted:       true,
+		},
+		{
+			// Shaped like the query of a window rule, which has no _tp_time
+			name: "windowed aggregation",
+			columns: []timeplus.Column{
+				{Name: "host", Type: "string"},
+				{Name: "cpu", Type: "float64"},
+			},
+			query:           "SELECT window_start, window_end, `host`, avg(`cpu`) AS `avg_cpu` FROM tumble(`%s`, 1m) GROUP BY window_start, window_end, `host` HAVING `avg_cpu` > 80",
+			throttleMinutes: 0,
+			severityExpr:    "'critical'",
+			eventTimeExpr:   "view.window_end",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			runSQLContractCase(t, h, tc)
+		})
+	}
+}
+
+// runSQLContractCase creates a rule's views and materialized views the way StartRule does and,
+// when the case has a firing row, checks the alert the materialized view writes
+func runSQLContractCase(t *testing.T, h *harness.Harness, tc sqlContractCase) {
+	ctx := context.Background()
+
+	// The harness helpers fail the parent test, so subtests create and insert through the client
+	source := h.UniqueName("contract_source")
+	createSchemaStream(t, h, source, timeplus.StreamSchema{Name: source, Columns: tc.columns})
+
+	acks := h.UniqueName("contract_acks")
+	createSchemaStream(t, h, acks, timeplus.AlertAcksStreamSchema(acks))
+	history := h.UniqueName("contract_history")
+	createSchemaStream(t, h, history, timeplus.AlertHistoryStreamSchema(history))
+
+	ruleID := uuid.NewString()
+	viewName := ruleResourceName(ruleID, "view")
+
+	execDDL(t, h, timeplus.GetRulePlainViewQuery(viewName, fmt.Sprintf(tc.query, source)), "VIEW", viewName)
+
+	timeplus.SetPayloadLimits(tc.payload)
+	defer timeplus.SetPayloadLimits(timeplus.PayloadLimits{})
+	key := []byte(strings.Repeat("k", 32))
+	stagingStream := ""
+	if tc.encrypted {
+		require.NoError(t, timeplus.SetPayloadKey(key))
+		defer timeplus.SetPayloadKey(nil)
+		// Alerts are staged as they are and encrypted by the gateway as it moves them to the acks stream
+		encryptor := services.NewPayloadEncryptor(h.Client)
+		require.NoError(t, encryptor.Start(ctx))
+		defer encryptor.Shutdown()
+		stagingStream = timeplus.AlertPayloadStagingStream
+	}
+
+	var dataColumns []timeplus.Column
+	columns, err := h.Client.ExecuteQuery(ctx, "DESCRIBE "+viewName)
+	require.NoError(t, err)
+	for _, column := range columns {
+		name, _ := column["name"].(string)
+		if name == "" || name == "_tp_time" || name == "_tp_sn" {
+			continue
+		}
+		columnType, _ := column["type"].(string)
+		dataColumns = append(dataColumns, timeplus.Column{Name: name, Type: columnType})
+	}
+	require.NotEmpty(t, dataColumns)
+	entityColumn := dataColumns[0].Name
+	for _, column := range dataColumns {
+		if column.Name == "device_id" || column.Name == "host" {
+			entityColumn = column.Name
+		}
+	}
+
+	dataExpr := timeplus.GetTriggeringDataExpression(dataColumns, tc.redaction)
+
+	execDDL(t, h, timeplus.GetRuleThrottledMaterializedViewQuery(
+		ruleID,
+		viewName,
+		ruleResourceName(ruleID, "mv"),
+		tc.throttleMinutes,
+		entityColumn,
+		dataExpr,
+		acks,
+		tc.severityExpr,
+		tc.eventTimeExpr,
+		stagingStream,
+	), "VIEW", ruleResourceName(ruleID, "mv"))
+
+	execDDL(t, h, timeplus.GetRuleAlertHistoryMaterializedViewQuery(ruleID, ruleResourceName(ruleID, "history_mv"), acks, history),
+		"VIEW", ruleResourceName(ruleID, "history_mv"))
+
+	if tc.encrypted {
+		results, err := h.Client.ExecuteQuery(ctx, fmt.Sprintf("SHOW CREATE VIEW `%s`", ruleResourceName(ruleID, "mv")))
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		for _, statement := range results[0] {
+			assert.NotContains(t, strings.ToLower(fmt.Sprint(statement)), hex.EncodeToString(key), "the key is part of the view's definition")
+			assert.NotContains(t, fmt.Sprint(statement), string(key), "the key is part of the view's definition")
+		}
+	}
+
+	if tc.resolveQuery != "" {
+		execDDL(t, h, fmt.Sprintf("CREATE VIEW %s AS %s",
+			ruleResourceName(ruleID, "resolve_view"), fmt.Sprintf(tc.resolveQuery, source)),
+			"VIEW", ruleResourceName(ruleID, "resolve_view"))
+		execDDL(t, h, timeplus.GetRuleResolveViewQuery(ruleID, ruleResourceName(ruleID, "resolve_view"),
+			ruleResourceName(ruleID, "resolve_mv"), entityColumn, acks),
+			"VIEW", ruleResourceName(ruleID, "resolve_mv"))
+	}
+
+	if tc.row == nil {
+		return
+	}
+
+	var rowColumns []string
+	var rowValues []interface{}
+	for name, value := range tc.row {
+		rowColumns = append(rowColumns, name)
+		rowValues = append(rowValues, value)
+	}
+	require.NoError(t, h.Client.InsertIntoStream(ctx, source, rowColumns, rowValues))
+
+	query := fmt.Sprintf("SELECT entity_id, state, severity, comment, firing_seq FROM table(`%s`) WHERE rule_id = '%s'", acks, ruleID)
+	var results []map[string]interface{}
+	require.Eventually(t, func() bool {
+		results, err = h.Client.ExecuteQuery(ctx, query)
+		return err == nil && len(results) > 0
+	}, 30*time.Second, 500*time.Millisecond, "materialized view did not write an alert to %s", acks)
+
+	alert := results[0]
+	assert.Equal(t, tc.row[entityColumn], alert["entity_id"])
+	assert.Equal(t, timeplus.AlertStateActive, alert["state"])
+	assert.NotEmpty(t, alert["severity"])
+	assert.EqualValues(t, 1, alert["firing_seq"])
+
+	comment, _ := alert["comment"].(string)
+	if tc.encrypted {
+		require.True(t, timeplus.IsEncryptedPayload(comment), "triggering data is not encrypted: %s", comment)
+		comment, err = timeplus.DecryptPayload(comment)
+		require.NoError(t, err)
+	}
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(comment), &data), "triggering data is not valid JSON: %s", comment)
+	if len(tc.dataKeys) > 0 {
+		assert.Len(t, data, len(tc.dataKeys))
+		for _, name := range tc.dataKeys {
+			assert.Contains(t, data, name)
+		}
+		return
+	}
+	for name := range tc.row {
+		if name == entityColumn {
+			continue
+		}
+		assert.Contains(t, data, name)
+	}
+	for name, value := range tc.data {
+		assert.Equal(t, value, data[name])
+	}
+}
+
+// createSchemaStream creates a stream with the DDL the migrator uses for a system stream schema
+func createSchemaStream(t *testing.T, h *harness.Harness, name string, schema timeplus.StreamSchema) {
+	t.Helper()
+	ctx := context.Background()
+
+	if schema.Mutable {
+		require.NoError(t, h.Client.EnsureMutableStream(ctx, name, schema.Columns, schema.PrimaryKeys),
+			"failed to create mutable stream for schema %s", schema.Name)
+	} else {
+		require.NoError(t, h.Client.CreateStream(ctx, name, schema.Columns),
+			"failed to create stream for schema %s", schema.Name)
+	}
+	t.Cleanup(func() {
+		h.Client.ExecuteDDL(context.Background(), fmt.Sprintf("DROP STREAM IF EXISTS `%s`", name))
+	})
+}
+
+// execDDL executes generated DDL and drops what it created when the test ends. Cleanups run last-in
+// first-out, so materialized views are dropped before the views and streams they read from.
+func execDDL(t *testing.T, h *harness.Harness, query, kind, name string) {
+	t.Helper()
+	require.NoError(t, h.Client.ExecuteDDL(context.Background(), query), "generated SQL failed:\n%s", query)
+	t.Cleanup(func() {
+		h.Client.ExecuteDDL(context.Background(), fmt.Sprintf("DROP %s IF EXISTS `%s`", kind, name))
+	})
+}
+
+// ruleResourceName returns the name of one of a rule's views, as the schema builders name them
+func ruleResourceName(ruleID, suffix string) string {
+	return fmt.Sprintf("rule_%s_%s", strings.ReplaceAll(ruleID, "-", "_"), suffix)
+}
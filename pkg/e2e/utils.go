@@ -10,7 +10,7 @@ import (
 )
 
 // WaitForRule waits for a rule to be available
-func WaitForRule(ctx context.Context, client timeplus.TimeplusClient, ruleID string) error {
+func WaitForRule(ctx context.Context, client timeplus.StreamStore, ruleID string) error {
 	// Wait for materialized view to be available
 	viewName := fmt.Sprintf("rule_%s_view", ruleID)
 	for i := 0; i < 10; i++ {
@@ -26,7 +26,7 @@ func WaitForRule(ctx context.Context, client timeplus.TimeplusClient, ruleID str
 }
 
 // DropExistingViews drops any existing views for the given rule ID
-func DropExistingViews(ctx context.Context, client timeplus.TimeplusClient, formattedRuleID string) error {
+func DropExistingViews(ctx context.Context, client timeplus.StreamStore, formattedRuleID string) error {
 	viewNames := []string{
 		fmt.Sprintf("rule_%s_view", formattedRuleID),
 		fmt.Sprintf("rule_%s_acks_view", formattedRuleID),
@@ -42,7 +42,7 @@ func DropExistingViews(ctx context.Context, client timeplus.TimeplusClient, form
 }
 
 // SetupTestStream creates a test stream with the specified columns
-func SetupTestStream(ctx context.Context, client timeplus.TimeplusClient, streamName string) error {
+func SetupTestStream(ctx context.Context, client timeplus.StreamStore, streamName string) error {
 	// Drop stream if it exists
 	_, err := client.ExecuteQuery(ctx, fmt.Sprintf("DROP STREAM IF EXISTS `%s`", streamName))
 	if err != nil {
@@ -64,7 +64,7 @@ func SetupTestStream(ctx context.Context, client timeplus.TimeplusClient, stream
 }
 
 // GenerateTestData inserts test data into the specified stream
-func GenerateTestData(ctx context.Context, client timeplus.TimeplusClient, streamName string, deviceID string, value float64) error {
+func GenerateTestData(ctx context.Context, client timeplus.StreamStore, streamName string, deviceID string, value float64) error {
 	columns := []string{"device_id", "value", "_tp_time"}
 	values := []interface{}{deviceID, value, time.Now()}
 
@@ -76,7 +76,7 @@ func GenerateTestData(ctx context.Context, client timeplus.TimeplusClient, strea
 }
 
 // TestTimeplusConnection tests the connection to Timeplus and reports diagnostic information
-func TestTimeplusConnection(ctx context.Context, client timeplus.TimeplusClient) error {
+func TestTimeplusConnection(ctx context.Context, client timeplus.StreamStore) error {
 	logrus.Info("Testing Timeplus connection...")
 
 	// Test 1: Check if we can execute a simple query
@@ -0,0 +1,348 @@
+// Package federation aggregates the alerts and rules of remote gateways into one read-only view,
+// so a central NOC can watch several gateways from one place
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Defaults of the federation options
+const (
+	DefaultCacheTTL  = 15 * time.Second
+	DefaultTimeout   = 5 * time.Second
+	DefaultLocalName = "local"
+)
+
+// maxResponseBytes bounds the response of a remote gateway read into memory
+const maxResponseBytes = 64 << 20
+
+// Remote is a gateway whose alerts and rules are aggregated
+type Remote struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`             // Base URL of the gateway, e.g. https://gateway.eu.example.com
+	Token string `json:"token,omitempty"` // Sent as a bearer token, e.g. for a gateway behind an authenticating proxy
+}
+
+// Options configures how remote gateways are queried
+type Options struct {
+	CacheTTL  time.Duration // How long responses of a remote are served before it is queried again
+	Timeout   time.Duration // Time allowed to each request to a remote
+	LocalName string        // Gateway name of this gateway's own alerts and rules
+}
+
+// LocalSource provides this gateway's own alerts and rules, included next to the remotes'
+type LocalSource interface {
+	GetAlerts(ctx context.Context, ruleID string) ([]*models.Alert, error)
+	GetRules(ctx context.Context) ([]*models.Rule, error)
+}
+
+// GatewayStatus is the health of a gateway as seen by the last request to it
+type GatewayStatus struct {
+	Name        string     `json:"name"`
+	URL         string     `json:"url,omitempty"` // Empty for this gateway
+	Healthy     bool       `json:"healthy"`
+	Stale       bool       `json:"stale"` // The response is served from the cache because the gateway couldn't be reached
+	LastError   string     `json:"lastError,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+	LatencyMs   int64      `json:"latencyMs"` // Duration of the last request
+	Count       int        `json:"count"`     // Number of alerts or rules the gateway contributed
+}
+
+// Alert is an alert of a federated gateway
+type Alert struct {
+	Gateway string `json:"gateway"`
+	models.Alert
+}
+
+// Rule is a rule of a federated gateway
+type Rule struct {
+	Gateway string `json:"gateway"`
+	models.Rule
+}
+
+// AlertsView is the combined alerts of all gateways with the status of each
+type AlertsView struct {
+	Alerts   []Alert         `json:"alerts"`
+	Gateways []GatewayStatus `json:"gateways"`
+}
+
+// RulesView is the combined rules of all gateways with the status of each
+type RulesView struct {
+	Rules    []Rule          `json:"rules"`
+	Gateways []GatewayStatus `json:"gateways"`
+}
+
+// Federation queries remote gateways and caches their responses
+type Federation struct {
+	local     LocalSource
+	localName string
+	client    *http.Client
+	cacheTTL  time.Duration
+	remotes   []*remote
+}
+
+// remote is a registered gateway with its cached responses. mu serializes requests to it, so
+// concurrent views share one request instead of each querying the gateway.
+type remote struct {
+	Remote
+	mu     sync.Mutex
+	cache  map[string]*cacheEntry
+	status GatewayStatus
+}
+
+// cacheEntry is a response of a remote, by path
+type cacheEntry struct {
+	body      []byte
+	fetchedAt time.Time
+}
+
+// New creates a federation of the given remotes and this gateway's own source, which may be nil
+func New(local LocalSource, remotes []Remote, opts Options) (*Federation, error) {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.LocalName == "" {
+		opts.LocalName = DefaultLocalName
+	}
+
+	f := &Federation{
+		local:     local,
+		localName: opts.LocalName,
+		client:    &http.Client{Timeout: opts.Timeout},
+		cacheTTL:  opts.CacheTTL,
+	}
+	names := map[string]bool{opts.LocalName: true}
+	for i, r := range remotes {
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name == "" {
+			return nil, fmt.Errorf("remotes[%d]: name is required", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("remotes[%d]: duplicate gateway name %q", i, r.Name)
+		}
+		names[r.Name] = true
+
+		base, err := url.Parse(strings.TrimRight(r.URL, "/"))
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return nil, fmt.Errorf("remote %s: url must be an http or https URL", r.Name)
+		}
+		r.URL = base.String()
+		f.remotes = append(f.remotes, &remote{
+			Remote: r,
+			cache:  make(map[string]*cacheEntry),
+			status: GatewayStatus{Name: r.Name, URL: r.URL},
+		})
+	}
+	return f, nil
+}
+
+// Alerts returns the alerts of all gateways, optionally only those of a rule ID, newest first.
+// Gateways that can't be reached contribute their last response, flagged as stale, or nothing.
+func (f *Federation) Alerts(ctx context.Context, ruleID string) *AlertsView {
+	path := "/api/alerts"
+	if ruleID != "" {
+		path += "?rule_id=" + url.QueryEscape(ruleID)
+	}
+
+	view := &AlertsView{Alerts: []Alert{}}
+	if f.local != nil {
+		status := f.localStatus()
+		alerts, err := f.local.GetAlerts(ctx, ruleID)
+		if err != nil {
+			status.Healthy, status.LastError = false, err.Error()
+		}
+		for _, alert := range alerts {
+			view.Alerts = append(view.Alerts, Alert{Gateway: f.localName, Alert: *alert})
+		}
+		status.Count = len(alerts)
+		view.Gateways = append(view.Gateways, status)
+	}
+
+	results := f.fetchAll(ctx, path)
+	for i, r := range f.remotes {
+		result := results[i]
+		var alerts []models.Alert
+		if result.body != nil {
+			if err := json.Unmarshal(result.body, &alerts); err != nil {
+				result.status.Healthy, result.status.LastError = false, fmt.Sprintf("invalid alerts response: %v", err)
+			}
+		}
+		for _, alert := range alerts {
+			view.Alerts = append(view.Alerts, Alert{Gateway: r.Name, Alert: alert})
+		}
+		result.status.Count = len(alerts)
+		view.Gateways = append(view.Gateways, result.status)
+	}
+
+	sort.SliceStable(view.Alerts, func(i, j int) bool {
+		return view.Alerts[i].TriggeredAt.After(view.Alerts[j].TriggeredAt)
+	})
+	return view
+}
+
+// Rules returns the rules of all gateways, sorted by gateway and rule name
+func (f *Federation) Rules(ctx context.Context) *RulesView {
+	view := &RulesView{Rules: []Rule{}}
+	if f.local != nil {
+		status := f.localStatus()
+		rules, err := f.local.GetRules(ctx)
+		if err != nil {
+			status.Healthy, status.LastError = false, err.Error()
+		}
+		for _, rule := range rules {
+			view.Rules = append(view.Rules, Rule{Gateway: f.localName, Rule: *rule})
+		}
+		status.Count = len(rules)
+		view.Gateways = append(view.Gateways, status)
+	}
+
+	results := f.fetchAll(ctx, "/api/rules")
+	for i, r := range f.remotes {
+		result := results[i]
+		var rules []models.Rule
+		if result.body != nil {
+			if err := json.Unmarshal(result.body, &rules); err != nil {
+				result.status.Healthy, result.status.LastError = false, fmt.Sprintf("invalid rules response: %v", err)
+			}
+		}
+		for _, rule := range rules {
+			view.Rules = append(view.Rules, Rule{Gateway: r.Name, Rule: rule})
+		}
+		result.status.Count = len(rules)
+		view.Gateways = append(view.Gateways, result.status)
+	}
+
+	sort.SliceStable(view.Rules, func(i, j int) bool {
+		if view.Rules[i].Gateway != view.Rules[j].Gateway {
+			return view.Rules[i].Gateway < view.Rules[j].Gateway
+		}
+		return view.Rules[i].Name < view.Rules[j].Name
+	})
+	return view
+}
+
+// Gateways returns the status of each remote as of its last request. With refresh, each remote's
+// health endpoint is queried first.
+func (f *Federation) Gateways(ctx context.Context, refresh bool) []GatewayStatus {
+	statuses := make([]GatewayStatus, 0, len(f.remotes)+1)
+	if f.local != nil {
+		statuses = append(statuses, f.localStatus())
+	}
+	if refresh {
+		for _, result := range f.fetchAll(ctx, "/api/health") {
+			statuses = append(statuses, result.status)
+		}
+		return statuses
+	}
+	for _, r := range f.remotes {
+		r.mu.Lock()
+		statuses = append(statuses, r.status)
+		r.mu.Unlock()
+	}
+	return statuses
+}
+
+// localStatus is the status of this gateway, which is always reachable
+func (f *Federation) localStatus() GatewayStatus {
+	now := time.Now()
+	return GatewayStatus{Name: f.localName, Healthy: true, LastSuccess: &now, LastAttempt: &now}
+}
+
+// fetchResult is the response of a remote to a request, with the remote's status
+type fetchResult struct {
+	body   []byte
+	status GatewayStatus
+}
+
+// fetchAll requests a path from every remote at once, returning the results in remote order
+func (f *Federation) fetchAll(ctx context.Context, path string) []fetchResult {
+	results := make([]fetchResult, len(f.remotes))
+	var wg sync.WaitGroup
+	for i, r := range f.remotes {
+		wg.Add(1)
+		go func(i int, r *remote) {
+			defer wg.Done()
+			results[i] = f.fetch(ctx, r, path)
+		}(i, r)
+	}
+	wg.Wait()
+	return results
+}
+
+// fetch returns a remote's response to a path, from the cache while it is fresh. When the remote
+// fails, its last response is returned as stale.
+func (f *Federation) fetch(ctx context.Context, r *remote, path string) fetchResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := r.cache[path]
+	if entry != nil && time.Since(entry.fetchedAt) < f.cacheTTL {
+		return fetchResult{body: entry.body, status: r.status}
+	}
+
+	started := time.Now()
+	body, err := f.get(ctx, r, path)
+	r.status.LastAttempt = &started
+	r.status.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		logrus.Warnf("Federation: gateway %s: %v", r.Name, err)
+		r.status.Healthy = false
+		r.status.LastError = err.Error()
+		status := r.status
+		if entry == nil {
+			return fetchResult{status: status}
+		}
+		status.Stale = true
+		return fetchResult{body: entry.body, status: status}
+	}
+
+	r.status.Healthy = true
+	r.status.LastError = ""
+	r.status.LastSuccess = &started
+	r.cache[path] = &cacheEntry{body: body, fetchedAt: started}
+	return fetchResult{body: body, status: r.status}
+}
+
+// get requests a path from a remote
+func (f *Federation) get(ctx context.Context, r *remote, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return body, nil
+}
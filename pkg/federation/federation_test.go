@@ -0,0 +1,142 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+type staticSource struct {
+	alerts []*models.Alert
+	rules  []*models.Rule
+	err    error
+}
+
+func (s *staticSource) GetAlerts(ctx context.Context, ruleID string) ([]*models.Alert, error) {
+	return s.alerts, s.err
+}
+
+func (s *staticSource) GetRules(ctx context.Context) ([]*models.Rule, error) {
+	return s.rules, s.err
+}
+
+// fakeGateway serves alerts and rules like a gateway, counting the requests it gets
+type fakeGateway struct {
+	*httptest.Server
+	requests atomic.Int64
+	down     atomic.Bool
+	auth     atomic.Value
+}
+
+func newFakeGateway(t *testing.T, alerts []models.Alert, rules []models.Rule) *fakeGateway {
+	g := &fakeGateway{}
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.requests.Add(1)
+		g.auth.Store(r.Header.Get("Authorization"))
+		if g.down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/alerts":
+			json.NewEncoder(w).Encode(alerts)
+		case "/api/rules":
+			json.NewEncoder(w).Encode(rules)
+		case "/api/health":
+			w.Write([]byte(`{"status":"ok"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+func TestNewValidatesRemotes(t *testing.T) {
+	for name, remotes := range map[string][]Remote{
+		"no name":         {{URL: "http://eu.example.com"}},
+		"duplicate name":  {{Name: "eu", URL: "http://eu.example.com"}, {Name: "eu", URL: "http://eu2.example.com"}},
+		"local name":      {{Name: "local", URL: "http://eu.example.com"}},
+		"no scheme":       {{Name: "eu", URL: "eu.example.com"}},
+		"unsupported url": {{Name: "eu", URL: "ftp://eu.example.com"}},
+	} {
+		_, err := New(nil, remotes, Options{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestFederationAggregatesGateways(t *testing.T) {
+	now := time.Now()
+	eu := newFakeGateway(t,
+		[]models.Alert{{ID: "cpu:host1:1", RuleID: "cpu", TriggeredAt: now.Add(-time.Minute)}},
+		[]models.Rule{{ID: "cpu", Name: "CPU high"}})
+	us := newFakeGateway(t, nil, nil)
+	us.down.Store(true)
+	local := &staticSource{
+		alerts: []*models.Alert{{ID: "disk:host2:1", RuleID: "disk", TriggeredAt: now}},
+		rules:  []*models.Rule{{ID: "disk", Name: "Disk full"}},
+	}
+
+	f, err := New(local, []Remote{{Name: "eu", URL: eu.URL + "/", Token: "secret"}, {Name: "us", URL: us.URL}}, Options{LocalName: "central"})
+	require.NoError(t, err)
+
+	view := f.Alerts(context.Background(), "")
+	require.Len(t, view.Alerts, 2)
+	assert.Equal(t, "central", view.Alerts[0].Gateway, "alerts are sorted newest first")
+	assert.Equal(t, "eu", view.Alerts[1].Gateway)
+	assert.Equal(t, "cpu:host1:1", view.Alerts[1].ID)
+	assert.Equal(t, "Bearer secret", eu.auth.Load())
+
+	require.Len(t, view.Gateways, 3)
+	assert.True(t, view.Gateways[1].Healthy)
+	assert.Equal(t, 1, view.Gateways[1].Count)
+	assert.False(t, view.Gateways[2].Healthy, "a gateway that can't be reached is reported, not fatal")
+	assert.Contains(t, view.Gateways[2].LastError, "502")
+
+	rules := f.Rules(context.Background())
+	require.Len(t, rules.Rules, 2)
+	assert.Equal(t, "central", rules.Rules[0].Gateway)
+	assert.Equal(t, "CPU high", rules.Rules[1].Name)
+
+	// The local source failing marks this gateway unhealthy
+	local.err = errors.New("timeplus unavailable")
+	view = f.Alerts(context.Background(), "")
+	assert.False(t, view.Gateways[0].Healthy)
+}
+
+func TestFederationCachesResponses(t *testing.T) {
+	eu := newFakeGateway(t, []models.Alert{{ID: "cpu:host1:1", RuleID: "cpu"}}, nil)
+	f, err := New(nil, []Remote{{Name: "eu", URL: eu.URL}}, Options{CacheTTL: time.Hour})
+	require.NoError(t, err)
+
+	f.Alerts(context.Background(), "")
+	f.Alerts(context.Background(), "")
+	assert.Equal(t, int64(1), eu.requests.Load(), "fresh responses are served from the cache")
+
+	// Once the cache expires, a failing gateway's last response is served as stale
+	f.remotes[0].cache["/api/alerts"].fetchedAt = time.Now().Add(-2 * time.Hour)
+	eu.down.Store(true)
+	view := f.Alerts(context.Background(), "")
+	assert.Equal(t, int64(2), eu.requests.Load())
+	require.Len(t, view.Alerts, 1)
+	assert.True(t, view.Gateways[0].Stale)
+	assert.False(t, view.Gateways[0].Healthy)
+	require.NotNil(t, view.Gateways[0].LastSuccess)
+
+	// Health checks are reported by gateway
+	eu.down.Store(false)
+	statuses := f.Gateways(context.Background(), true)
+	require.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Healthy)
+	assert.Empty(t, statuses[0].LastError)
+}
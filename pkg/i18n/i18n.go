@@ -0,0 +1,166 @@
+// Package i18n holds the translations notifications are localized with
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale notifications fall back to
+const DefaultLocale = "en"
+
+// Locale is the catalog of a language notifications can be localized into
+type Locale struct {
+	Tag        string            // Language tag, e.g. "de" or "pt"
+	TimeLayout string            // Go layout timestamps are formatted with
+	Severities map[string]string // Names of the severity levels
+	Events     map[string]string // Names of the notification event types
+	Labels     map[string]string // Labels of the default notification text
+}
+
+// locales are the built-in catalogs, by language tag
+var locales = map[string]*Locale{
+	"en": {
+		Tag:        "en",
+		TimeLayout: "Jan 2, 2006 15:04 MST",
+		Severities: map[string]string{"info": "Info", "warning": "Warning", "critical": "Critical"},
+		Events:     map[string]string{"fired": "fired", "replay": "replay", "escalated": "escalated", "degraded": "degraded", "acknowledged": "acknowledged", "snoozed": "snoozed", "resolved": "resolved", "reopened": "reopened", "gateway_problem": "gateway problem", "gateway_recovered": "gateway recovered"},
+		Labels:     map[string]string{"alert": "alert", "owner": "owner", "team": "team", "runbook": "Runbook", "acknowledge": "Acknowledge", "resolve": "Resolve", "onCall": "on call"},
+	},
+	"de": {
+		Tag:        "de",
+		TimeLayout: "02.01.2006 15:04 MST",
+		Severities: map[string]string{"info": "Info", "warning": "Warnung", "critical": "Kritisch"},
+		Events:     map[string]string{"fired": "ausgelöst", "replay": "erneut gesendet", "escalated": "eskaliert", "degraded": "gedrosselt", "acknowledged": "bestätigt", "snoozed": "pausiert", "resolved": "behoben", "reopened": "wieder geöffnet", "gateway_problem": "Gateway-Problem", "gateway_recovered": "Gateway wiederhergestellt"},
+		Labels:     map[string]string{"alert": "Alarm", "owner": "Verantwortlich", "team": "Team", "runbook": "Runbook", "acknowledge": "Bestätigen", "resolve": "Beheben", "onCall": "Bereitschaft"},
+	},
+	"fr": {
+		Tag:        "fr",
+		TimeLayout: "02/01/2006 15:04 MST",
+		Severities: map[string]string{"info": "Info", "warning": "Avertissement", "critical": "Critique"},
+		Events:     map[string]string{"fired": "déclenchée", "replay": "rejouée", "escalated": "escaladée", "degraded": "bridée", "acknowledged": "prise en compte", "snoozed": "mise en sourdine", "resolved": "résolue", "reopened": "rouverte", "gateway_problem": "problème de passerelle", "gateway_recovered": "passerelle rétablie"},
+		Labels:     map[string]string{"alert": "alerte", "owner": "responsable", "team": "équipe", "runbook": "Runbook", "acknowledge": "Prendre en compte", "resolve": "Résoudre", "onCall": "astreinte"},
+	},
+	"es": {
+		Tag:        "es",
+		TimeLayout: "02/01/2006 15:04 MST",
+		Severities: map[string]string{"info": "Información", "warning": "Advertencia", "critical": "Crítico"},
+		Events:     map[string]string{"fired": "disparada", "replay": "reenviada", "escalated": "escalada", "degraded": "limitada", "acknowledged": "reconocida", "snoozed": "pospuesta", "resolved": "resuelta", "reopened": "reabierta", "gateway_problem": "problema de la pasarela", "gateway_recovered": "pasarela recuperada"},
+		Labels:     map[string]string{"alert": "alerta", "owner": "responsable", "team": "equipo", "runbook": "Runbook", "acknowledge": "Reconocer", "resolve": "Resolver", "onCall": "guardia"},
+	},
+	"pt": {
+		Tag:        "pt",
+		TimeLayout: "02/01/2006 15:04 MST",
+		Severities: map[string]string{"info": "Informação", "warning": "Aviso", "critical": "Crítico"},
+		Events:     map[string]string{"fired": "disparado", "replay": "reenviado", "escalated": "escalado", "degraded": "limitado", "acknowledged": "reconhecido", "snoozed": "adiado", "resolved": "resolvido", "reopened": "reaberto", "gateway_problem": "problema do gateway", "gateway_recovered": "gateway recuperado"},
+		Labels:     map[string]string{"alert": "alerta", "owner": "responsável", "team": "equipe", "runbook": "Runbook", "acknowledge": "Reconhecer", "resolve": "Resolver", "onCall": "plantão"},
+	},
+	"ja": {
+		Tag:        "ja",
+		TimeLayout: "2006/01/02 15:04 MST",
+		Severities: map[string]string{"info": "情報", "warning": "警告", "critical": "重大"},
+		Events:     map[string]string{"fired": "発生", "replay": "再送", "escalated": "エスカレーション", "degraded": "抑制", "acknowledged": "確認済み", "snoozed": "スヌーズ", "resolved": "解決", "reopened": "再オープン", "gateway_problem": "ゲートウェイ障害", "gateway_recovered": "ゲートウェイ復旧"},
+		Labels:     map[string]string{"alert": "アラート", "owner": "担当者", "team": "チーム", "runbook": "Runbook", "acknowledge": "確認", "onCall": "当番"},
+	},
+}
+
+// tagPattern matches a normalized language tag: a language with an optional region
+var tagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2}|-[0-9]{3})?$`)
+
+// Normalize returns a language tag in its canonical form, e.g. "pt_br" becomes "pt-BR"
+func Normalize(tag string) string {
+	parts := strings.SplitN(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-", 2)
+	normalized := strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		normalized += "-" + strings.ToUpper(parts[1])
+	}
+	return normalized
+}
+
+// Validate checks that a language tag is a language with an optional region, e.g. "de" or "pt-BR"
+func Validate(tag string) error {
+	if !tagPattern.MatchString(Normalize(tag)) {
+		return fmt.Errorf("invalid locale %q, expected a language tag such as \"de\" or \"pt-BR\"", tag)
+	}
+	return nil
+}
+
+// language returns the language of a normalized tag, "pt" for "pt-BR"
+func language(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// Match returns the key of available that best serves a locale: the locale itself, then its
+// language. It reports false when neither is available.
+func Match[V any](tag string, available map[string]V) (string, bool) {
+	if tag == "" || len(available) == 0 {
+		return "", false
+	}
+	tag = Normalize(tag)
+	if _, ok := available[tag]; ok {
+		return tag, true
+	}
+	if _, ok := available[language(tag)]; ok {
+		return language(tag), true
+	}
+	return "", false
+}
+
+// Lookup returns the catalog of a locale, or of its language, falling back to English
+func Lookup(tag string) *Locale {
+	if key, ok := Match(tag, locales); ok {
+		return locales[key]
+	}
+	return locales[DefaultLocale]
+}
+
+// Supported returns the tags of the built-in catalogs
+func Supported() []string {
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Severity returns the name of a severity level. Levels without a translation, such as custom
+// ones, are returned in English or as-is.
+func (l *Locale) Severity(severity string) string {
+	return translate(l.Severities, locales[DefaultLocale].Severities, severity)
+}
+
+// Event returns the name of a notification event type
+func (l *Locale) Event(eventType string) string {
+	return translate(l.Events, locales[DefaultLocale].Events, eventType)
+}
+
+// Label returns a label of the default notification text
+func (l *Locale) Label(key string) string {
+	return translate(l.Labels, locales[DefaultLocale].Labels, key)
+}
+
+// FormatTime formats a time in the locale's layout and the given timezone
+func (l *Locale) FormatTime(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(l.TimeLayout)
+}
+
+// translate looks a key up in a catalog, then the English one, and returns the key when neither has it
+func translate(catalog, fallback map[string]string, key string) string {
+	if value, ok := catalog[strings.ToLower(key)]; ok {
+		return value
+	}
+	if value, ok := fallback[strings.ToLower(key)]; ok {
+		return value
+	}
+	return key
+}
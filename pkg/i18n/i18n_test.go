@@ -0,0 +1,57 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupFallsBackToLanguageThenEnglish(t *testing.T) {
+	assert.Equal(t, "de", Lookup("de").Tag)
+	assert.Equal(t, "pt", Lookup("pt_BR").Tag)
+	assert.Equal(t, "en", Lookup("sv").Tag)
+	assert.Equal(t, "en", Lookup("").Tag)
+}
+
+func TestLocaleNames(t *testing.T) {
+	de := Lookup("de")
+	assert.Equal(t, "Kritisch", de.Severity("critical"))
+	assert.Equal(t, "Kritisch", de.Severity("CRITICAL"))
+	// Custom severity levels aren't translated
+	assert.Equal(t, "p1", de.Severity("p1"))
+	assert.Equal(t, "eskaliert", de.Event("escalated"))
+	assert.Equal(t, "Verantwortlich", de.Label("owner"))
+
+	berlin := time.FixedZone("CET", 3600)
+	at := time.Date(2026, 3, 4, 12, 30, 0, 0, time.UTC)
+	assert.Equal(t, "04.03.2026 13:30 CET", de.FormatTime(at, berlin))
+	assert.Equal(t, "Mar 4, 2026 12:30 UTC", Lookup("en").FormatTime(at, nil))
+}
+
+func TestNormalizeAndValidate(t *testing.T) {
+	assert.Equal(t, "pt-BR", Normalize(" pt_br "))
+	assert.Equal(t, "es-419", Normalize("ES-419"))
+
+	for _, tag := range []string{"de", "pt-BR", "zh_tw", "es-419"} {
+		assert.NoError(t, Validate(tag), tag)
+	}
+	for _, tag := range []string{"", "german", "de-", "en-US-x-private"} {
+		assert.Error(t, Validate(tag), tag)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	available := map[string]string{"de": "", "pt-BR": ""}
+
+	key, ok := Match("de-AT", available)
+	assert.True(t, ok)
+	assert.Equal(t, "de", key)
+
+	key, ok = Match("pt_br", available)
+	assert.True(t, ok)
+	assert.Equal(t, "pt-BR", key)
+
+	_, ok = Match("pt", available)
+	assert.False(t, ok)
+}
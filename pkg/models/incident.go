@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// Incident statuses
+const (
+	IncidentStatusOpen         = "open"
+	IncidentStatusAcknowledged = "acknowledged" // Someone is working on it, new alerts still join it
+	IncidentStatusResolved     = "resolved"     // Every alert resolved, or resolved by hand; new alerts open a new incident
+)
+
+// Incident groups alerts sharing a correlation key that fire close together, e.g. every alert of a
+// team during an outage, so responders get one notification instead of one per alert
+type Incident struct {
+	ID             string          `json:"id"`
+	CorrelationKey string          `json:"correlationKey"` // Values of the grouping labels, e.g. "team=payments"
+	Status         string          `json:"status"`
+	Title          string          `json:"title"`    // Named after the alert that opened the incident
+	Summary        string          `json:"summary"`  // Rolling summary of the member alerts
+	Severity       RuleSeverity    `json:"severity"` // Most severe member alert
+	Alerts         []IncidentAlert `json:"alerts"`
+	OpenedAt       time.Time       `json:"openedAt"`
+	LastAlertAt    time.Time       `json:"lastAlertAt"` // When the latest member alert joined
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	AcknowledgedBy string          `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time      `json:"acknowledgedAt,omitempty"`
+	ResolvedBy     string          `json:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time      `json:"resolvedAt,omitempty"`
+}
+
+// IncidentAlert is a member alert of an incident
+type IncidentAlert struct {
+	AlertID     string       `json:"alertId"`
+	RuleID      string       `json:"ruleId"`
+	RuleName    string       `json:"ruleName,omitempty"`
+	EntityID    string       `json:"entityId"`
+	Severity    RuleSeverity `json:"severity"`
+	State       string       `json:"state"` // Latest state of the alert, e.g. "active" or "resolved"
+	TriggeredAt time.Time    `json:"triggeredAt"`
+}
+
+// IncidentActionRequest is the body of incident acknowledge and resolve requests
+type IncidentActionRequest struct {
+	By string `json:"by"` // Who acknowledged or resolved the incident
+}
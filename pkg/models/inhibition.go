@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Inhibition labels compared besides the entity, other names compare columns of the triggering rows
+const (
+	InhibitionLabelRule  = "ruleId"
+	InhibitionLabelOwner = "owner"
+	InhibitionLabelTeam  = "team"
+)
+
+// Inhibition suppresses notifications of less severe alerts while a more severe alert is active for
+// the same entity, e.g. warnings about a host that is already down
+type Inhibition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Severity of the active alerts that inhibit others, defaults to critical
+	SourceSeverity RuleSeverity `json:"sourceSeverity,omitempty"`
+	// Severities of the inhibited alerts, defaults to every severity below SourceSeverity
+	TargetSeverities []RuleSeverity `json:"targetSeverities,omitempty"`
+	// Labels that must be equal on both alerts besides the entity, e.g. ["team", "datacenter"]
+	Equal     []string  `json:"equal,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
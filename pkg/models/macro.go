@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// SQLMacro is a named SQL snippet that rule queries reference as {{macro:name}}, so common filters
+// and joins are defined once. Each update adds a version; rules keep the version they were saved with.
+type SQLMacro struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	SQL         string    `json:"sql"` // Inserted in place of each reference as it is
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"` // When this version was saved
+}
+
+// SQLMacroUsage is a rule whose query references a macro, and the version it was expanded with
+type SQLMacroUsage struct {
+	RuleID   string `json:"ruleId"`
+	RuleName string `json:"ruleName"`
+	Version  int    `json:"version"`
+	Latest   bool   `json:"latest"` // Whether the version is the macro's latest
+}
+
+// SQLMacroExpansion is a query with its macro references expanded, as previewed by the expand API
+type SQLMacroExpansion struct {
+	Query  string         `json:"query"`
+	Macros map[string]int `json:"macros,omitempty"` // Versions of the macros expanded, by name
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultOnCallShiftHours is the length of an on-call shift when a schedule doesn't set one
+const DefaultOnCallShiftHours = 7 * 24
+
+// OnCallSchedule rotates who is on call for the alerts of the rules that reference it. Users take
+// shifts of ShiftHours in turn, starting with the first user at RotationStart; overrides hand a
+// time window to someone else, e.g. to cover a holiday.
+type OnCallSchedule struct {
+	Name          string           `json:"name"`
+	Description   string           `json:"description,omitempty"`
+	Users         []string         `json:"users"`
+	RotationStart time.Time        `json:"rotationStart"`
+	ShiftHours    int              `json:"shiftHours,omitempty"` // Defaults to a week
+	Overrides     []OnCallOverride `json:"overrides,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	UpdatedAt     time.Time        `json:"updatedAt"`
+}
+
+// OnCallOverride puts a user on call from Start until End instead of the rotation
+type OnCallOverride struct {
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// OnCallShift is who is on call at a point in time and until when
+type OnCallShift struct {
+	Schedule string    `json:"schedule"`
+	User     string    `json:"user"`
+	Override bool      `json:"override,omitempty"` // Whether an override rather than the rotation applies
+	Until    time.Time `json:"until"`
+}
+
+// ShiftAt returns who is on call at a time. The first override covering the time wins, otherwise the
+// rotation applies, also before RotationStart.
+func (s *OnCallSchedule) ShiftAt(at time.Time) OnCallShift {
+	for _, override := range s.Overrides {
+		if !at.Before(override.Start) && at.Before(override.End) {
+			return OnCallShift{Schedule: s.Name, User: override.User, Override: true, Until: override.End}
+		}
+	}
+	if len(s.Users) == 0 {
+		return OnCallShift{Schedule: s.Name}
+	}
+
+	hours := s.ShiftHours
+	if hours <= 0 {
+		hours = DefaultOnCallShiftHours
+	}
+	shift := time.Duration(hours) * time.Hour
+	elapsed := at.Sub(s.RotationStart)
+	n := int64(elapsed / shift)
+	if elapsed < 0 && elapsed%shift != 0 {
+		n--
+	}
+	user := s.Users[((n%int64(len(s.Users)))+int64(len(s.Users)))%int64(len(s.Users))]
+	until := s.RotationStart.Add(time.Duration(n+1) * shift)
+
+	// An override starting during the shift cuts it short
+	for _, override := range s.Overrides {
+		if override.Start.After(at) && override.Start.Before(until) {
+			until = override.Start
+		}
+	}
+	return OnCallShift{Schedule: s.Name, User: user, Until: until}
+}
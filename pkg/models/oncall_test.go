@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnCallShiftAt(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	schedule := &OnCallSchedule{
+		Name:          "payments",
+		Users:         []string{"alice", "bob", "carol"},
+		RotationStart: start,
+		ShiftHours:    24,
+		Overrides:     []OnCallOverride{{User: "dave", Start: start.Add(50 * time.Hour), End: start.Add(60 * time.Hour)}},
+	}
+
+	assert.Equal(t, OnCallShift{Schedule: "payments", User: "alice", Until: start.Add(24 * time.Hour)}, schedule.ShiftAt(start))
+	assert.Equal(t, "bob", schedule.ShiftAt(start.Add(30*time.Hour)).User)
+	assert.Equal(t, "alice", schedule.ShiftAt(start.Add(80*time.Hour)).User)
+
+	// Shifts before the rotation start continue the rotation backwards
+	assert.Equal(t, "carol", schedule.ShiftAt(start.Add(-time.Hour)).User)
+	assert.Equal(t, start, schedule.ShiftAt(start.Add(-time.Hour)).Until)
+
+	// Overrides win and cut the shift they start in short
+	assert.Equal(t, OnCallShift{Schedule: "payments", User: "dave", Override: true, Until: start.Add(60 * time.Hour)},
+		schedule.ShiftAt(start.Add(55*time.Hour)))
+	assert.Equal(t, OnCallShift{Schedule: "payments", User: "carol", Until: start.Add(50 * time.Hour)},
+		schedule.ShiftAt(start.Add(49*time.Hour)))
+
+	// A week is the default shift
+	schedule.ShiftHours = 0
+	assert.Equal(t, "alice", schedule.ShiftAt(start.Add(6*24*time.Hour)).User)
+}
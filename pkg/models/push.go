@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Platforms push notifications are delivered through
+const (
+	PushPlatformFCM  = "fcm"  // Firebase Cloud Messaging, for Android, web and PWAs
+	PushPlatformAPNs = "apns" // Apple Push Notification service, for iOS
+)
+
+// PushDevice is a device registered to receive alerts as push notifications
+type PushDevice struct {
+	Token     string    `json:"token"`          // Registration token of the device on its platform
+	Platform  string    `json:"platform"`       // PushPlatformFCM or PushPlatformAPNs
+	User      string    `json:"user,omitempty"` // Who the device belongs to
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"` // When the device was last registered
+}
@@ -14,6 +14,7 @@ const (
 	RuleStatusStopping RuleStatus = "stopping"
 	RuleStatusStopped  RuleStatus = "stopped"
 	RuleStatusFailed   RuleStatus = "failed"
+	RuleStatusDegraded RuleStatus = "degraded" // Alerting, but components in FailedComponents aren't running
 )
 
 // RuleSeverity represents the severity level of a rule
@@ -27,18 +28,64 @@ const (
 
 // Rule represents an alert rule definition
 type Rule struct {
-	ID              string       `json:"id"`
-	Name            string       `json:"name"`
-	Description     string       `json:"description"`
-	Query           string       `json:"query"`
-	ResolveQuery    string       `json:"resolveQuery,omitempty"` // Query to auto-resolve alerts
-	Status          RuleStatus   `json:"status"`
-	Severity        RuleSeverity `json:"severity"`
-	ThrottleMinutes int          `json:"throttleMinutes"` // 0 means no throttling
-	EntityIDColumns string       `json:"entityIdColumns"` // Comma-separated list of columns to use as entity_id
-	CreatedAt       time.Time    `json:"createdAt"`
-	UpdatedAt       time.Time    `json:"updatedAt"`
-	LastTriggeredAt *time.Time   `json:"lastTriggeredAt,omitempty"`
+	ID                 string       `json:"id"`
+	Name               string       `json:"name"`
+	Description        string       `json:"description"`
+	Type               string       `json:"type,omitempty"` // Rule type, defaults to a hand-written query
+	Spec               *RuleSpec    `json:"spec,omitempty"` // Definition of generated rule types
+	Query              string       `json:"query"`
+	ResolveQuery       string       `json:"resolveQuery,omitempty"` // Query to auto-resolve alerts
+	Status             RuleStatus   `json:"status"`
+	Severity           RuleSeverity `json:"severity"`
+	SeverityExpression string       `json:"severityExpression,omitempty"` // SQL expression computing severity per alert, overrides Severity
+	ThrottleMinutes    int          `json:"throttleMinutes"`              // 0 means no throttling
+	EntityIDColumns    string       `json:"entityIdColumns"`              // Comma-separated list of columns to use as entity_id
+	EntityIDPriority   []string     `json:"entityIdPriority,omitempty"`   // Columns tried in order when EntityIDColumns doesn't match, overrides the configured list
+	RequireEntityID    bool         `json:"requireEntityId,omitempty"`    // Fail to start rather than guess an entity ID column
+	Shadow             bool         `json:"shadow,omitempty"`             // Record would-be alerts in the result stream without alerting
+
+	// Rules whose active alerts suppress this rule's notifications
+	DependsOn []RuleDependency `json:"dependsOn,omitempty"`
+	// Alerts per minute the rule may fire before it's throttled harder, overrides the configured quota
+	MaxAlertsPerMinute int `json:"maxAlertsPerMinute,omitempty"`
+	// Set while the rule is throttled harder for exceeding its alert volume quota
+	Degraded *RuleDegradation `json:"degraded,omitempty"`
+	// On-call schedule whose current user notifications and escalations target
+	OnCallSchedule string `json:"onCallSchedule,omitempty"`
+
+	EntityIDColumn  string     `json:"entityIdColumn,omitempty"` // Column the gateway resolved as entity_id when the rule was started
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	LastTriggeredAt *time.Time `json:"lastTriggeredAt,omitempty"`
+
+	// Dimension streams joined into the rule view so alerts carry their columns
+	Lookups []RuleLookup `json:"lookups,omitempty"`
+	// Hooks adding context to each new alert before it's notified, e.g. where its IP address is
+	Enrichments []RuleEnrichment `json:"enrichments,omitempty"`
+	// Expressions evaluated by the gateway against each new alert, to suppress or modify it
+	Script *AlertScript `json:"script,omitempty"`
+	// Sensitive values masked in the triggering row before alerts are written or notified
+	Redaction *RuleRedaction `json:"redaction,omitempty"`
+	// Encrypt the triggering row of the rule's alerts at rest with the configured key
+	EncryptData bool `json:"encryptData,omitempty"`
+	// The query as written when it references SQL macros; Query is its expansion
+	QueryTemplate string `json:"queryTemplate,omitempty"`
+	// Versions of the macros Query was expanded with, by macro name
+	Macros map[string]int `json:"macros,omitempty"`
+
+	// Ownership, used for filtering and notification routing
+	Owner string `json:"owner,omitempty"`
+	Team  string `json:"team,omitempty"`
+	// Rule group the rule is filed under, whose notification settings it inherits
+	Group string `json:"group,omitempty"`
+
+	// Alert enrichment, rendered as Go templates against the triggering row (e.g. "{{.device_id}} is at {{.temperature}}")
+	RunbookURL          string `json:"runbookUrl,omitempty"`
+	SummaryTemplate     string `json:"summaryTemplate,omitempty"`
+	DescriptionTemplate string `json:"descriptionTemplate,omitempty"`
+
+	// Name of the notification template used for this rule's notification messages
+	NotificationTemplate string `json:"notificationTemplate,omitempty"`
 
 	// Configuration for Alert Acks Stream
 	DedicatedAlertAcksStream *bool  `json:"dedicatedAlertAcksStream,omitempty"` // Use rule-specific stream if true
@@ -49,8 +96,98 @@ type Rule struct {
 	ViewName        string `json:"viewName,omitempty"`
 	ResolveViewName string `json:"resolveViewName,omitempty"` // View name for resolve query
 
+	// Names of the Timeplus objects generated for the rule, recorded when it's created. Nil for rules
+	// created before names were configurable, which keep the default names.
+	Objects *RuleObjects `json:"objects,omitempty"`
+
 	// Error information if status is failed
 	LastError string `json:"lastError,omitempty"`
+
+	// Components of a degraded rule that failed to start, see RuleComponentResolve
+	FailedComponents []string `json:"failedComponents,omitempty"`
+
+	// Recent failures of the rule, oldest first, served by GET /api/rules/:id/errors
+	ErrorHistory []RuleError `json:"-"`
+
+	// Lint warnings found when the rule was created, not persisted
+	Warnings []RuleWarning `json:"warnings,omitempty"`
+}
+
+// RuleObjects holds the names of the Timeplus objects generated for a rule
+type RuleObjects struct {
+	View                    string `json:"view"`
+	MaterializedView        string `json:"materializedView"`
+	ResolveView             string `json:"resolveView"`
+	ResolveMaterializedView string `json:"resolveMaterializedView"`
+	ResultStream            string `json:"resultStream"`
+	AlertAcksStream         string `json:"alertAcksStream"` // Used when the rule has a dedicated alert acks stream without an explicit name
+	AlertHistoryStream      string `json:"alertHistoryStream"`
+	AlertHistoryMV          string `json:"alertHistoryMv"`
+}
+
+// Components of a rule that can fail without stopping its alerts, leaving the rule degraded
+const (
+	RuleComponentResolve      = "resolve"       // Resolve views, resolving alerts automatically
+	RuleComponentAlertHistory = "alert_history" // Materialized view recording each firing in the alert history
+)
+
+// MaxRuleErrorHistory is the number of failures kept in a rule's error history
+const MaxRuleErrorHistory = 20
+
+// Phases of a rule in which a failure can happen
+const (
+	RulePhaseCostCheck               = "cost_check"
+	RulePhaseEncryption              = "encryption"
+	RulePhaseAlertAcksStream         = "alert_acks_stream"
+	RulePhaseResultStream            = "result_stream"
+	RulePhasePlainView               = "plain_view"
+	RulePhaseResolveView             = "resolve_view"
+	RulePhaseViewColumns             = "view_columns"
+	RulePhaseEntityID                = "entity_id"
+	RulePhaseMaterializedView        = "materialized_view"
+	RulePhaseResolveMaterializedView = "resolve_materialized_view"
+	RulePhaseAlertHistory            = "alert_history"
+	RulePhaseThrottle                = "throttle"
+	RulePhaseReconcile               = "reconcile"
+)
+
+// RuleError is a failure of a rule, with the statement that failed when there is one
+type RuleError struct {
+	At      time.Time `json:"at"`
+	Phase   string    `json:"phase"`
+	Message string    `json:"message"`
+	SQL     string    `json:"sql,omitempty"`
+}
+
+// RuleWarning is a pattern in a rule that is valid but known to cause trouble once the rule runs
+type RuleWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AlertHistoryEntry is one firing of a rule for an entity, as recorded in the rule's alert history stream
+type AlertHistoryEntry struct {
+	AlertID     string     `json:"alertId"` // ID of the alert the firing belongs to
+	RuleID      string     `json:"ruleId"`
+	EntityID    string     `json:"entityId"`
+	Severity    string     `json:"severity,omitempty"`
+	TriggeredAt time.Time  `json:"triggeredAt"`
+	EventTime   *time.Time `json:"eventTime,omitempty"`   // Time of the triggering event, when known
+	TriggeredBy string     `json:"triggeredBy,omitempty"` // Empty for streaming evaluation, e.g. "backfill" otherwise
+	Data        string     `json:"data"`                  // Triggering row as JSON
+}
+
+// AlertAuditEntry records a manual change to an alert's state
+type AlertAuditEntry struct {
+	AlertID   string    `json:"alertId"`
+	RuleID    string    `json:"ruleId"`
+	EntityID  string    `json:"entityId"`
+	Action    string    `json:"action"` // "acknowledged", "reopened" or "escalated"
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+	Reference string    `json:"reference,omitempty"` // Ticket ID or URL of a bulk acknowledgment
+	At        time.Time `json:"at"`
 }
 
 // Alert represents a triggered alert instance
@@ -64,32 +201,186 @@ type Alert struct {
 	Acknowledged   bool         `json:"acknowledged"`
 	AcknowledgedAt *time.Time   `json:"acknowledgedAt,omitempty"`
 	AcknowledgedBy string       `json:"acknowledgedBy,omitempty"`
+	AckReference   string       `json:"ackReference,omitempty"` // Ticket ID or URL the alert was acknowledged under
+	Owner          string       `json:"owner,omitempty"`        // Owner of the rule that triggered the alert
+	Team           string       `json:"team,omitempty"`         // Team of the rule that triggered the alert
+	OnCall         string       `json:"onCall,omitempty"`       // Who was on call for the rule when the alert was notified
+	RunbookURL     string       `json:"runbookUrl,omitempty"`
+	Summary        string       `json:"summary,omitempty"`     // Rendered summary template
+	Description    string       `json:"description,omitempty"` // Rendered description template
+	SLADeadline    *time.Time   `json:"slaDeadline,omitempty"` // When the alert must be acknowledged by, if its severity has an SLA
+	SLAStatus      string       `json:"slaStatus,omitempty"`   // "pending", "met" or "breached"
+	// What the rule's enrichment hooks found when the alert fired, by hook name
+	Enrichment map[string]interface{} `json:"enrichment,omitempty"`
+	// Incident the alert was grouped into, when incidents are enabled
+	IncidentID string `json:"incidentId,omitempty"`
+}
+
+// ReplayAlertsRequest represents the request payload for re-emitting historical alerts
+type ReplayAlertsRequest struct {
+	RuleID    string      `json:"ruleId,omitempty"` // Optional, replays alerts of all rules when empty
+	StartTime time.Time   `json:"startTime"`
+	EndTime   time.Time   `json:"endTime"`
+	Sink      *ReplaySink `json:"sink,omitempty"` // Optional, defaults to the notification pipeline
+}
+
+// PauseRequest represents the request payload for pausing the gateway
+type PauseRequest struct {
+	By        string `json:"by,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	StopRules bool   `json:"stopRules,omitempty"` // Also stop the materialized views of running rules
+}
+
+// ResumeRequest represents the request payload for resuming a paused gateway
+type ResumeRequest struct {
+	By string `json:"by,omitempty"`
+}
+
+// BulkAcknowledgeRequest selects active alerts to acknowledge in one call. Filters are combined with AND.
+type BulkAcknowledgeRequest struct {
+	RuleID         string   `json:"ruleId,omitempty"`
+	Severity       string   `json:"severity,omitempty"`  // Matches the alert's fired severity, falling back to the rule severity
+	EntityIDs      []string `json:"entityIds,omitempty"` // Acknowledges only these entities
+	AcknowledgedBy string   `json:"acknowledgedBy,omitempty"`
+	Comment        string   `json:"comment,omitempty"`
+	Reference      string   `json:"reference,omitempty"` // Ticket ID or URL recorded on each acknowledgment, e.g. a maintenance ticket
+}
+
+// ReplaySink selects a one-off destination for replayed alerts
+type ReplaySink struct {
+	Type    string `json:"type"`              // "webhook" or "kafka"
+	URL     string `json:"url,omitempty"`     // Webhook URL
+	Brokers string `json:"brokers,omitempty"` // Kafka brokers, comma-separated
+	Topic   string `json:"topic,omitempty"`   // Kafka topic
+}
+
+// RuleLookup joins a dimension stream into a rule's view, e.g. devices on device_id for location and site.
+// The stream should be a mutable or versioned_kv stream so the latest row per key is joined.
+type RuleLookup struct {
+	Stream    string   `json:"stream"`              // Dimension stream to join
+	Key       string   `json:"key"`                 // Column of the rule query to join on
+	LookupKey string   `json:"lookupKey,omitempty"` // Column of the dimension stream, defaults to Key
+	Columns   []string `json:"columns"`             // Dimension columns added to the alert data
+}
+
+// RuleEnrichment configures an enrichment hook of a rule, e.g. {"type": "geoip", "field": "client_ip"}
+type RuleEnrichment struct {
+	Type  string `json:"type"`            // geoip, reverse_dns, http, or a hook registered by the gateway
+	Name  string `json:"name,omitempty"`  // Key of the result in the alert's enrichment, defaults to Type
+	Field string `json:"field,omitempty"` // Column of the triggering row the hook looks up, e.g. an IP address
+	URL   string `json:"url,omitempty"`   // Endpoint of http hooks
+}
+
+// AlertScript holds the expressions a rule evaluates against each new alert, with the triggering row
+// as data and the rule's rule_id, rule_name and severity, e.g. {"suppress": "data.env != 'prod'"}.
+// Each expression is optional.
+type AlertScript struct {
+	Suppress string `json:"suppress,omitempty"` // Boolean, the alert isn't notified when true
+	Severity string `json:"severity,omitempty"` // Severity level replacing the alert's
+	Summary  string `json:"summary,omitempty"`  // String replacing the alert's summary
+}
+
+// RuleRedaction masks sensitive values, such as emails or card numbers, in the triggering row of a
+// rule's alerts, e.g. {"columns": ["email"], "patterns": ["\\d{4}-\\d{4}-\\d{4}-\\d{4}"]}
+type RuleRedaction struct {
+	Columns  []string `json:"columns,omitempty"`  // Columns whose values are replaced whole
+	Patterns []string `json:"patterns,omitempty"` // Regular expressions whose matches are replaced in string values
+}
+
+// RuleDegradation records why a rule was throttled harder for firing too many alerts
+type RuleDegradation struct {
+	Since           time.Time `json:"since"`
+	Reason          string    `json:"reason"`
+	AlertsPerMinute int64     `json:"alertsPerMinute"` // Alerts fired in the minute that exceeded the quota
+	Limit           int64     `json:"limit"`
+	ThrottleMinutes int       `json:"throttleMinutes"` // Throttle before degradation, restored on recovery
+}
+
+// Scopes of a rule dependency
+const (
+	DependencyScopeEntity = "entity" // Suppress while the dependency has an active alert for the same entity
+	DependencyScopeGlobal = "global" // Suppress while the dependency has any active alert
+)
+
+// RuleDependency is a rule whose active alerts suppress another rule's notifications, e.g. a
+// gateway-down rule that device rules behind the gateway depend on
+type RuleDependency struct {
+	RuleID string `json:"ruleId"`
+	Scope  string `json:"scope,omitempty"` // DependencyScopeEntity (default) or DependencyScopeGlobal
 }
 
 // CreateRuleRequest represents the request payload for creating a rule
 type CreateRuleRequest struct {
-	Name                     string       `json:"name"`
-	Description              string       `json:"description"`
-	Query                    string       `json:"query"`
-	ResolveQuery             string       `json:"resolveQuery,omitempty"`
-	Severity                 RuleSeverity `json:"severity"`
-	ThrottleMinutes          int          `json:"throttleMinutes"`
-	EntityIDColumns          string       `json:"entityIdColumns"`                    // Comma-separated list of columns to use as entity_id
-	DedicatedAlertAcksStream *bool        `json:"dedicatedAlertAcksStream,omitempty"` // Optional
-	AlertAcksStreamName      string       `json:"alertAcksStreamName,omitempty"`      // Optional
+	Name                     string           `json:"name"`
+	Description              string           `json:"description"`
+	Type                     string           `json:"type,omitempty"`         // Optional: generated rule type, see RuleSpec
+	Spec                     *RuleSpec        `json:"spec,omitempty"`         // Required for generated rule types
+	Query                    string           `json:"query"`                  // Required for query rules, may reference SQL macros as {{macro:name}}
+	SourceStream             string           `json:"sourceStream,omitempty"` // Optional: stream a query rule must read from, checked at creation
+	ResolveQuery             string           `json:"resolveQuery,omitempty"`
+	Severity                 RuleSeverity     `json:"severity"`
+	SeverityExpression       string           `json:"severityExpression,omitempty"` // Optional: SQL expression computing severity per alert
+	ThrottleMinutes          int              `json:"throttleMinutes"`
+	EntityIDColumns          string           `json:"entityIdColumns"`                    // Comma-separated list of columns to use as entity_id
+	EntityIDPriority         []string         `json:"entityIdPriority,omitempty"`         // Optional: columns tried in order when EntityIDColumns doesn't match
+	RequireEntityID          bool             `json:"requireEntityId,omitempty"`          // Optional: fail to start rather than guess an entity ID column
+	Shadow                   bool             `json:"shadow,omitempty"`                   // Optional: record would-be alerts without alerting, to tune the rule
+	DependsOn                []RuleDependency `json:"dependsOn,omitempty"`                // Optional: rules whose active alerts suppress this rule's notifications
+	MaxAlertsPerMinute       int              `json:"maxAlertsPerMinute,omitempty"`       // Optional: overrides the configured alert volume quota
+	OnCallSchedule           string           `json:"onCallSchedule,omitempty"`           // Optional: notify whoever is on call in this schedule
+	DedicatedAlertAcksStream *bool            `json:"dedicatedAlertAcksStream,omitempty"` // Optional
+	AlertAcksStreamName      string           `json:"alertAcksStreamName,omitempty"`      // Optional
+	BackfillMinutes          int              `json:"backfillMinutes,omitempty"`          // Optional: evaluate the rule over this many minutes of history once started
+	Owner                    string           `json:"owner,omitempty"`
+	Team                     string           `json:"team,omitempty"`
+	RunbookURL               string           `json:"runbookUrl,omitempty"`
+	SummaryTemplate          string           `json:"summaryTemplate,omitempty"`
+	DescriptionTemplate      string           `json:"descriptionTemplate,omitempty"`
+	Lookups                  []RuleLookup     `json:"lookups,omitempty"`              // Optional: dimension streams joined into the alert data
+	NotificationTemplate     string           `json:"notificationTemplate,omitempty"` // Optional: name of the notification template
+	Enrichments              []RuleEnrichment `json:"enrichments,omitempty"`          // Optional: hooks adding context to new alerts
+	Script                   *AlertScript     `json:"script,omitempty"`               // Optional: expressions suppressing or modifying new alerts
+	Redaction                *RuleRedaction   `json:"redaction,omitempty"`            // Optional: sensitive values masked in alert data
+	EncryptData              bool             `json:"encryptData,omitempty"`          // Optional: encrypt alert data at rest, needs an encryption key
+	Group                    string           `json:"group,omitempty"`                // Optional: rule group to file the rule under
+}
+
+// ResolveQueryRequest sets the resolve query of a rule on its own
+type ResolveQueryRequest struct {
+	ResolveQuery string `json:"resolveQuery"`
 }
 
 // UpdateRuleRequest represents the request payload for updating a rule
 type UpdateRuleRequest struct {
-	Name                     *string       `json:"name,omitempty"`
-	Description              *string       `json:"description,omitempty"`
-	Query                    *string       `json:"query,omitempty"`
-	ResolveQuery             *string       `json:"resolveQuery,omitempty"`
-	Severity                 *RuleSeverity `json:"severity,omitempty"`
-	ThrottleMinutes          *int          `json:"throttleMinutes,omitempty"`
-	EntityIDColumns          *string       `json:"entityIdColumns,omitempty"`          // Comma-separated list of columns to use as entity_id
-	DedicatedAlertAcksStream *bool         `json:"dedicatedAlertAcksStream,omitempty"` // Optional
-	AlertAcksStreamName      *string       `json:"alertAcksStreamName,omitempty"`      // Optional
+	Name                     *string           `json:"name,omitempty"`
+	Description              *string           `json:"description,omitempty"`
+	Query                    *string           `json:"query,omitempty"` // Expanded with the latest versions of the macros it references
+	Spec                     *RuleSpec         `json:"spec,omitempty"`  // Regenerates the query of generated rule types
+	ResolveQuery             *string           `json:"resolveQuery,omitempty"`
+	Severity                 *RuleSeverity     `json:"severity,omitempty"`
+	SeverityExpression       *string           `json:"severityExpression,omitempty"`
+	ThrottleMinutes          *int              `json:"throttleMinutes,omitempty"`
+	EntityIDColumns          *string           `json:"entityIdColumns,omitempty"`          // Comma-separated list of columns to use as entity_id
+	EntityIDPriority         *[]string         `json:"entityIdPriority,omitempty"`         // Columns tried in order when EntityIDColumns doesn't match
+	RequireEntityID          *bool             `json:"requireEntityId,omitempty"`          // Fail to start rather than guess an entity ID column
+	Shadow                   *bool             `json:"shadow,omitempty"`                   // Record would-be alerts without alerting
+	DependsOn                *[]RuleDependency `json:"dependsOn,omitempty"`                // Rules whose active alerts suppress this rule's notifications
+	MaxAlertsPerMinute       *int              `json:"maxAlertsPerMinute,omitempty"`       // Overrides the configured alert volume quota, 0 restores it
+	OnCallSchedule           *string           `json:"onCallSchedule,omitempty"`           // On-call schedule notified, empty to stop using one
+	DedicatedAlertAcksStream *bool             `json:"dedicatedAlertAcksStream,omitempty"` // Optional
+	AlertAcksStreamName      *string           `json:"alertAcksStreamName,omitempty"`      // Optional
+	Owner                    *string           `json:"owner,omitempty"`
+	Team                     *string           `json:"team,omitempty"`
+	RunbookURL               *string           `json:"runbookUrl,omitempty"`
+	SummaryTemplate          *string           `json:"summaryTemplate,omitempty"`
+	DescriptionTemplate      *string           `json:"descriptionTemplate,omitempty"`
+	Lookups                  *[]RuleLookup     `json:"lookups,omitempty"`
+	NotificationTemplate     *string           `json:"notificationTemplate,omitempty"`
+	Enrichments              *[]RuleEnrichment `json:"enrichments,omitempty"`
+	Script                   *AlertScript      `json:"script,omitempty"`      // An empty script removes it
+	Redaction                *RuleRedaction    `json:"redaction,omitempty"`   // An empty redaction removes it
+	EncryptData              *bool             `json:"encryptData,omitempty"` // Alerts fired earlier keep their data as it was written
+	Group                    *string           `json:"group,omitempty"`       // Empty to take the rule out of its group
 }
 
 // AcknowledgeAlertRequest represents the request payload for acknowledging an alert
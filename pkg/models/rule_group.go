@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// RuleGroup organizes rules into folders, so large installations can start, stop and export them
+// together and share notification settings between them
+type RuleGroup struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Slash-separated folder the group is filed under, e.g. "payments/databases"
+	Folder string `json:"folder,omitempty"`
+	// Notification settings of the group's rules that don't set their own
+	NotificationTemplate string    `json:"notificationTemplate,omitempty"`
+	OnCallSchedule       string    `json:"onCallSchedule,omitempty"`
+	RuleCount            int       `json:"ruleCount"` // Number of rules in the group, set when listing groups
+	CreatedAt            time.Time `json:"createdAt"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+}
+
+// RuleGroupOperation is the outcome of starting or stopping the rules of a group
+type RuleGroupOperation struct {
+	Group     string            `json:"group"`
+	Succeeded []string          `json:"succeeded"`        // IDs of the rules started or stopped
+	Skipped   []string          `json:"skipped"`          // IDs of the rules already running or stopped
+	Failed    map[string]string `json:"failed,omitempty"` // Errors by rule ID
+}
@@ -0,0 +1,78 @@
+package models
+
+// Rule types. Rules other than RuleTypeQuery are defined by a RuleSpec and the gateway
+// generates their query.
+const (
+	RuleTypeQuery   = "query"   // Hand-written query (default)
+	RuleTypeWindow  = "window"  // Aggregate per entity over a tumbling or hopping window
+	RuleTypeAbsence = "absence" // Entity stopped reporting for longer than a maximum silence
+	RuleTypeRate    = "rate"    // Numeric field of an entity changes faster than a threshold per time unit
+	RuleTypeOutlier = "outlier" // Entity ranks in the top N or deviates from the fleet within a window
+)
+
+// RuleSpec holds the structured definition of a generated rule; the field matching the rule type is set
+type RuleSpec struct {
+	Window  *WindowSpec  `json:"window,omitempty"`
+	Absence *AbsenceSpec `json:"absence,omitempty"`
+	Rate    *RateSpec    `json:"rate,omitempty"`
+	Outlier *OutlierSpec `json:"outlier,omitempty"`
+}
+
+// WindowSpec describes a rule that alerts when an aggregate per entity over a window crosses a threshold,
+// e.g. avg(temperature) over 5m per device_id > 30
+type WindowSpec struct {
+	SourceStream string  `json:"sourceStream"`
+	EntityColumn string  `json:"entityColumn"`
+	WindowType   string  `json:"windowType"`    // "tumble" (default) or "hop"
+	Size         string  `json:"size"`          // Window size, e.g. "5m"
+	Hop          string  `json:"hop,omitempty"` // Hop interval for hopping windows, e.g. "1m"
+	Aggregation  string  `json:"aggregation"`   // avg, min, max, sum or count
+	Column       string  `json:"column"`        // Aggregated column, not needed for count
+	Operator     string  `json:"operator"`      // >, >=, <, <=, = or !=
+	Threshold    float64 `json:"threshold"`
+	Filter       string  `json:"filter,omitempty"` // Optional WHERE condition applied before aggregating
+}
+
+// AbsenceSpec describes a heartbeat rule that alerts when an entity has not reported for longer than
+// MaxSilence, e.g. no rows per device_id in device_heartbeats for 5m. The alert resolves when data resumes.
+type AbsenceSpec struct {
+	SourceStream  string `json:"sourceStream"`
+	EntityColumn  string `json:"entityColumn"`
+	MaxSilence    string `json:"maxSilence"`              // Longest allowed gap between rows, e.g. "5m"
+	CheckInterval string `json:"checkInterval,omitempty"` // How often silence is evaluated, defaults to 30s
+	Filter        string `json:"filter,omitempty"`        // Optional WHERE condition selecting heartbeat rows
+}
+
+// RateSpec describes a rule that alerts when a numeric column changes faster than Threshold per Per
+// between consecutive rows of an entity, e.g. temperature rising more than 5 per 1m per device_id
+type RateSpec struct {
+	SourceStream string  `json:"sourceStream"`
+	EntityColumn string  `json:"entityColumn"`
+	Column       string  `json:"column"`              // Numeric column whose rate of change is measured
+	Per          string  `json:"per"`                 // Time unit of the rate, e.g. "1m"
+	Direction    string  `json:"direction,omitempty"` // "rising" (default), "falling" or "either"
+	Threshold    float64 `json:"threshold"`           // Positive change per time unit that triggers an alert
+	Filter       string  `json:"filter,omitempty"`    // Optional WHERE condition applied to source rows
+}
+
+// Outlier detection methods
+const (
+	OutlierMethodTopN   = "topN"   // The N entities with the highest (or lowest) value
+	OutlierMethodStdDev = "stddev" // Entities more than StdDevs standard deviations from the fleet median
+)
+
+// OutlierSpec describes a rule that compares each entity's aggregate over a tumbling window with the
+// rest of the fleet in the same window, e.g. devices whose avg(temperature) is 3 standard deviations
+// from the fleet median
+type OutlierSpec struct {
+	SourceStream string  `json:"sourceStream"`
+	EntityColumn string  `json:"entityColumn"`
+	Size         string  `json:"size"`              // Window size, e.g. "5m"
+	Aggregation  string  `json:"aggregation"`       // avg, min, max, sum or count per entity
+	Column       string  `json:"column"`            // Aggregated column, not needed for count
+	Method       string  `json:"method"`            // "topN" or "stddev"
+	TopN         int     `json:"topN,omitempty"`    // Number of entities to alert on for topN
+	Lowest       bool    `json:"lowest,omitempty"`  // Rank the lowest values instead of the highest for topN
+	StdDevs      float64 `json:"stdDevs,omitempty"` // Deviation from the fleet median, in standard deviations, for stddev
+	Filter       string  `json:"filter,omitempty"`  // Optional WHERE condition applied before aggregating
+}
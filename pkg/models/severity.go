@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultSeverities are the severity levels used when none are configured, lowest first
+var DefaultSeverities = []RuleSeverity{RuleSeverityInfo, RuleSeverityWarning, RuleSeverityCritical}
+
+// SeverityLevel is a severity with its rank, higher ranks are more severe
+type SeverityLevel struct {
+	Name RuleSeverity `json:"name"`
+	Rank int          `json:"rank"`
+}
+
+// SeverityLevels is an ordered set of severities, so severities can be validated and compared
+type SeverityLevels struct {
+	levels []RuleSeverity
+	ranks  map[RuleSeverity]int
+}
+
+// NewSeverityLevels creates severity levels from names ordered lowest first. Names are lowercased
+// and must be unique. An empty list gives DefaultSeverities.
+func NewSeverityLevels(names []string) (*SeverityLevels, error) {
+	if len(names) == 0 {
+		names = make([]string, len(DefaultSeverities))
+		for i, severity := range DefaultSeverities {
+			names[i] = string(severity)
+		}
+	}
+
+	l := &SeverityLevels{ranks: make(map[RuleSeverity]int, len(names))}
+	for _, name := range names {
+		severity := RuleSeverity(strings.ToLower(strings.TrimSpace(name)))
+		if severity == "" {
+			return nil, fmt.Errorf("severity names can't be empty")
+		}
+		if _, ok := l.ranks[severity]; ok {
+			return nil, fmt.Errorf("severity %q is listed more than once", severity)
+		}
+		l.ranks[severity] = len(l.levels)
+		l.levels = append(l.levels, severity)
+	}
+	return l, nil
+}
+
+// Levels returns the severities with their ranks, lowest first
+func (l *SeverityLevels) Levels() []SeverityLevel {
+	levels := make([]SeverityLevel, len(l.levels))
+	for i, severity := range l.levels {
+		levels[i] = SeverityLevel{Name: severity, Rank: i}
+	}
+	return levels
+}
+
+// Valid reports whether a severity is one of the levels
+func (l *SeverityLevels) Valid(severity RuleSeverity) bool {
+	_, ok := l.ranks[severity]
+	return ok
+}
+
+// Rank returns the rank of a severity, or -1 for unknown severities so they compare below every level
+func (l *SeverityLevels) Rank(severity RuleSeverity) int {
+	if rank, ok := l.ranks[severity]; ok {
+		return rank
+	}
+	return -1
+}
+
+// Compare returns a negative number when a is less severe than b, 0 when they rank the same and a
+// positive number when a is more severe
+func (l *SeverityLevels) Compare(a, b RuleSeverity) int {
+	return l.Rank(a) - l.Rank(b)
+}
+
+// AtLeast reports whether a severity is at least as severe as min
+func (l *SeverityLevels) AtLeast(severity, min RuleSeverity) bool {
+	return l.Valid(severity) && l.Compare(severity, min) >= 0
+}
+
+// Validate returns an error naming the allowed levels if a severity isn't one of them
+func (l *SeverityLevels) Validate(severity RuleSeverity) error {
+	if l.Valid(severity) {
+		return nil
+	}
+	names := make([]string, len(l.levels))
+	for i, level := range l.levels {
+		names[i] = string(level)
+	}
+	return fmt.Errorf("invalid severity %q, expected one of %s", severity, strings.Join(names, ", "))
+}
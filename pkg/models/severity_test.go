@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSeverityLevels(t *testing.T) {
+	levels, err := NewSeverityLevels(nil)
+	require.NoError(t, err)
+
+	assert.True(t, levels.Valid(RuleSeverityWarning))
+	assert.False(t, levels.Valid("urgent"))
+	assert.Positive(t, levels.Compare(RuleSeverityCritical, RuleSeverityWarning))
+	assert.Negative(t, levels.Compare(RuleSeverityInfo, RuleSeverityWarning))
+	assert.True(t, levels.AtLeast(RuleSeverityCritical, RuleSeverityWarning))
+	assert.False(t, levels.AtLeast("urgent", RuleSeverityInfo))
+	assert.EqualError(t, levels.Validate("urgent"), `invalid severity "urgent", expected one of info, warning, critical`)
+}
+
+func TestCustomSeverityLevels(t *testing.T) {
+	levels, err := NewSeverityLevels([]string{"low", " Medium ", "high", "page"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []SeverityLevel{{"low", 0}, {"medium", 1}, {"high", 2}, {"page", 3}}, levels.Levels())
+	assert.False(t, levels.Valid(RuleSeverityCritical))
+	assert.True(t, levels.AtLeast("page", "high"))
+	assert.Equal(t, -1, levels.Rank(RuleSeverityCritical))
+
+	_, err = NewSeverityLevels([]string{"low", "LOW"})
+	assert.Error(t, err)
+	_, err = NewSeverityLevels([]string{"low", ""})
+	assert.Error(t, err)
+}
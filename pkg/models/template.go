@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// NotificationTemplate is a named Go template for notification message bodies. Rules reference
+// templates by name.
+type NotificationTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Body        string `json:"body"` // Go template rendered against the alert, e.g. "{{.Alert.RuleName}} fired at {{formatTime .Alert.TriggeredAt}}"
+	// Bodies for other locales by language tag, e.g. {"de": "..."}. Body is the English fallback.
+	Translations map[string]string `json:"translations,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+// TemplatePreviewRequest is the sample a template is rendered against by the preview API
+type TemplatePreviewRequest struct {
+	Body   string `json:"body,omitempty"`   // Optional: preview this body instead of the stored one
+	Event  string `json:"event,omitempty"`  // Optional: event type, defaults to "fired"
+	Locale string `json:"locale,omitempty"` // Optional: render the translation for this locale
+	Alert  *Alert `json:"alert,omitempty"`  // Optional: defaults to a built-in sample alert
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionLinks(t *testing.T) {
+	links, err := NewActionLinks("https://alerts.example.com/", "secret", time.Hour)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	link, err := url.Parse(links.URL(ActionResolve, "rule1:dev1:4", "alice@example.com", now))
+	require.NoError(t, err)
+	assert.Equal(t, "https://alerts.example.com"+ActionLinkPath, link.Scheme+"://"+link.Host+link.Path)
+	token := link.Query().Get("token")
+
+	claims, err := links.Verify(token, now.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, &ActionClaims{Action: ActionResolve, AlertID: "rule1:dev1:4", Recipient: "alice@example.com",
+		ExpiresAt: now.Add(time.Hour).Unix()}, claims)
+
+	_, err = links.Verify(token, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrActionTokenExpired)
+
+	// Tokens signed with another secret, or with changed claims, are rejected
+	other, err := NewActionLinks("https://alerts.example.com", "other", time.Hour)
+	require.NoError(t, err)
+	_, err = links.Verify(other.Token(ActionClaims{Action: ActionAcknowledge, AlertID: "rule1:dev1:4", ExpiresAt: now.Add(time.Hour).Unix()}), now)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+	encoded, signature, _ := strings.Cut(links.Token(ActionClaims{Action: ActionAcknowledge, AlertID: "rule1:dev1:4", ExpiresAt: now.Add(time.Hour).Unix()}), ".")
+	_, err = links.Verify(strings.ToUpper(encoded[:1])+encoded[1:]+"."+signature, now)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+	_, err = links.Verify("garbage", now)
+	assert.ErrorIs(t, err, ErrInvalidActionToken)
+
+	_, err = NewActionLinks("https://alerts.example.com", "", time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// APNs endpoints of production apps and of apps built for development
+const (
+	apnsEndpoint        = "https://api.push.apple.com"
+	apnsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is reused. APNs rejects tokens older than an hour
+// and refreshing them more often than every 20 minutes.
+const apnsTokenLifetime = 50 * time.Minute
+
+// APNsOptions configures the key and app an APNs sender pushes for
+type APNsOptions struct {
+	KeyFile string // The .p8 signing key of the Apple developer account
+	KeyID   string
+	TeamID  string
+	Topic   string // Bundle ID of the app
+	Sandbox bool   // Push to development builds of the app
+	Proxy   string // Proxy URL for requests to APNs, or ProxyDirect; the environment's proxy when empty
+}
+
+// APNsSender sends push messages through the Apple Push Notification service, authenticating with
+// provider tokens signed by the account's key
+type APNsSender struct {
+	key      *ecdsa.PrivateKey
+	keyID    string
+	teamID   string
+	topic    string
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+// NewAPNsSender creates an APNs sender
+func NewAPNsSender(opts APNsOptions) (*APNsSender, error) {
+	if opts.KeyID == "" || opts.TeamID == "" || opts.Topic == "" {
+		return nil, fmt.Errorf("apns: keyId, teamId and topic are required")
+	}
+	data, err := os.ReadFile(opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("apns: failed to read key: %w", err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("apns: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("apns: key is not an EC key")
+	}
+
+	a := &APNsSender{
+		key:      ecKey,
+		keyID:    opts.KeyID,
+		teamID:   opts.TeamID,
+		topic:    opts.Topic,
+		endpoint: apnsEndpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+	}
+	if opts.Sandbox {
+		a.endpoint = apnsSandboxEndpoint
+	}
+	transport, err := httpTransport(opts.Proxy, nil)
+	if err != nil {
+		return nil, fmt.Errorf("apns: %w", err)
+	}
+	if transport != nil {
+		a.client.Transport = transport
+	}
+	return a, nil
+}
+
+// Send pushes a message to a device. Tokens APNs reports as unregistered or invalid return
+// ErrPushTokenUnregistered.
+func (a *APNsSender) Send(ctx context.Context, token string, msg PushMessage) error {
+	jwt, err := a.token()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for key, value := range msg.Data {
+		payload[key] = value
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal apns payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create apns request: %w", err)
+	}
+	req.Header.Set("Authorization", "bearer "+jwt)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call apns: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(data, &failure)
+	if resp.StatusCode == http.StatusGone || failure.Reason == "BadDeviceToken" || failure.Reason == "Unregistered" {
+		return fmt.Errorf("%w: %s", ErrPushTokenUnregistered, failure.Reason)
+	}
+	return fmt.Errorf("apns returned status %d: %s", resp.StatusCode, failure.Reason)
+}
+
+// token returns the provider token, signing a new one once it is apnsTokenLifetime old
+func (a *APNsSender) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if a.jwt != "" && now.Sub(a.issuedAt) < apnsTokenLifetime {
+		return a.jwt, nil
+	}
+
+	jwt, err := signJWT(map[string]interface{}{"alg": "ES256", "kid": a.keyID},
+		map[string]interface{}{"iss": a.teamID, "iat": now.Unix()},
+		func(signingInput []byte) ([]byte, error) {
+			digest := sha256.Sum256(signingInput)
+			r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+			if err != nil {
+				return nil, err
+			}
+			// ES256 signatures are r and s as 32 byte big-endian integers
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+			return signature, nil
+		})
+	if err != nil {
+		return "", fmt.Errorf("apns: %w", err)
+	}
+	a.jwt, a.issuedAt = jwt, now
+	return jwt, nil
+}
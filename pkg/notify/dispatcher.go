@@ -0,0 +1,344 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults of the retries of events a notifier failed to deliver
+const (
+	DefaultDeliveryAttempts     = 3
+	DefaultDeliveryRetryBackoff = time.Second
+)
+
+var (
+	// ErrQueueFull is returned when the dispatch queue has no room for another event
+	ErrQueueFull = errors.New("notification queue is full")
+	// ErrDispatcherClosed is returned when events are dispatched after Drain has been called
+	ErrDispatcherClosed = errors.New("notification dispatcher is closed")
+)
+
+// Dispatcher fans events out to a set of notifiers from a bounded in-memory queue
+type Dispatcher struct {
+	notifiers []Notifier
+	queue     chan queuedEvent
+	wg        sync.WaitGroup
+
+	// Sequence numbers of queued events, so callers can tell when what they queued was delivered
+	seqMu    sync.Mutex
+	lastSeq  uint64
+	inFlight map[uint64]struct{} // Queued events whose delivery hasn't finished
+
+	// Notifiers that fail an event are retried after a backoff doubling with each attempt
+	attempts     int
+	retryBackoff time.Duration
+
+	mu      sync.RWMutex
+	closed  bool
+	drained chan struct{} // Closed by Drain, cutting retries short
+
+	// Paused dispatchers drop events instead of delivering them
+	paused atomic.Bool
+
+	// Deliveries to single notifiers since the dispatcher started
+	delivered atomic.Int64
+	failed    atomic.Int64
+	// Events dropped while the dispatcher was paused
+	suppressed atomic.Int64
+	// Events given up on after a notifier failed every attempt
+	givenUp atomic.Int64
+}
+
+// queuedEvent is an event waiting for delivery and its sequence number
+type queuedEvent struct {
+	event Event
+	seq   uint64
+}
+
+// DispatcherStats counts the deliveries of a dispatcher, one per event and notifier
+type DispatcherStats struct {
+	Delivered  int64 `json:"delivered"`
+	Failed     int64 `json:"failed"`
+	Suppressed int64 `json:"suppressed"` // Events dropped while paused
+	GivenUp    int64 `json:"givenUp"`    // Events a notifier failed to deliver in every attempt
+	Queued     int   `json:"queued"`
+	Paused     bool  `json:"paused"`
+}
+
+// NewDispatcher creates a dispatcher and starts its workers
+func NewDispatcher(queueSize, workers int, notifiers ...Notifier) *Dispatcher {
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	d := &Dispatcher{
+		notifiers:    notifiers,
+		queue:        make(chan queuedEvent, queueSize),
+		inFlight:     make(map[uint64]struct{}),
+		attempts:     DefaultDeliveryAttempts,
+		retryBackoff: DefaultDeliveryRetryBackoff,
+		drained:      make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.run()
+	}
+
+	return d
+}
+
+// Name returns the notifier name
+func (d *Dispatcher) Name() string {
+	return "pipeline"
+}
+
+// Notify queues an event for delivery, waiting for room in the queue until ctx is done, so a
+// Dispatcher can be used wherever a Notifier is expected
+func (d *Dispatcher) Notify(ctx context.Context, event Event) error {
+	return d.Enqueue(ctx, event)
+}
+
+// SetRetry sets how many times a notifier is asked to deliver an event before it's given up on,
+// and the backoff before the first retry. Must be called before events are dispatched.
+func (d *Dispatcher) SetRetry(attempts int, backoff time.Duration) {
+	if attempts > 0 {
+		d.attempts = attempts
+	}
+	if backoff > 0 {
+		d.retryBackoff = backoff
+	}
+}
+
+// SetPaused pauses or resumes the dispatcher. A paused dispatcher drops the events dispatched to
+// it; events already queued are still delivered.
+func (d *Dispatcher) SetPaused(paused bool) {
+	d.paused.Store(paused)
+}
+
+// Paused reports whether the dispatcher drops the events dispatched to it
+func (d *Dispatcher) Paused() bool {
+	return d.paused.Load()
+}
+
+// Dispatch queues an event for delivery to every notifier without blocking. Events dispatched while
+// the dispatcher is paused are dropped.
+func (d *Dispatcher) Dispatch(event Event) error {
+	return d.enqueue(context.Background(), event, false)
+}
+
+// Enqueue queues an event for delivery to every notifier, waiting for room in the queue until ctx
+// is done. Bulk senders such as replays use it so they aren't limited by the queue size.
+func (d *Dispatcher) Enqueue(ctx context.Context, event Event) error {
+	return d.enqueue(ctx, event, true)
+}
+
+// enqueue queues an event, waiting for room in the queue until ctx is done if wait is set
+func (d *Dispatcher) enqueue(ctx context.Context, event Event, wait bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+	if d.paused.Load() {
+		d.suppressed.Add(1)
+		return nil
+	}
+
+	d.seqMu.Lock()
+	d.lastSeq++
+	seq := d.lastSeq
+	d.inFlight[seq] = struct{}{}
+	d.seqMu.Unlock()
+
+	queued := queuedEvent{event: event, seq: seq}
+	if !wait {
+		select {
+		case d.queue <- queued:
+			return nil
+		default:
+			d.finished(seq)
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case d.queue <- queued:
+		return nil
+	case <-ctx.Done():
+		d.finished(seq)
+		return fmt.Errorf("%w while waiting for room", ErrQueueFull)
+	}
+}
+
+// LastQueued returns the sequence number of the latest event queued, zero if none was
+func (d *Dispatcher) LastQueued() uint64 {
+	d.seqMu.Lock()
+	defer d.seqMu.Unlock()
+	return d.lastSeq
+}
+
+// Delivered returns the sequence number up to which every queued event has been delivered by all
+// notifiers or given up on after every attempt. Events are delivered concurrently by the workers, so
+// this trails events delivered out of order until the ones before them are delivered too. Events
+// still being retried when the dispatcher is drained are never delivered, so whatever queued them is
+// redone after a restart. Events that weren't queued aren't waited for: their caller got an error.
+func (d *Dispatcher) Delivered() uint64 {
+	d.seqMu.Lock()
+	defer d.seqMu.Unlock()
+
+	delivered := d.lastSeq
+	for seq := range d.inFlight {
+		if seq <= delivered {
+			delivered = seq - 1
+		}
+	}
+	return delivered
+}
+
+// finished records that an event is no longer waiting for delivery
+func (d *Dispatcher) finished(seq uint64) {
+	d.seqMu.Lock()
+	defer d.seqMu.Unlock()
+	delete(d.inFlight, seq)
+}
+
+// Stats returns how many deliveries succeeded and failed, and how many events are queued
+func (d *Dispatcher) Stats() DispatcherStats {
+	return DispatcherStats{
+		Delivered:  d.delivered.Load(),
+		Failed:     d.failed.Load(),
+		Suppressed: d.suppressed.Load(),
+		GivenUp:    d.givenUp.Load(),
+		Queued:     len(d.queue),
+		Paused:     d.paused.Load(),
+	}
+}
+
+// Route is where a notifier delivers an event
+type Route struct {
+	Notifier string `json:"notifier"`
+	Channel  string `json:"channel,omitempty"` // Channel the event is routed to, empty for the notifier's only destination
+}
+
+// channelRouter is implemented by notifiers that route events between channels
+type channelRouter interface {
+	Channel(event Event) string
+}
+
+// Routes returns where each notifier would deliver an event, without delivering it
+func (d *Dispatcher) Routes(event Event) []Route {
+	routes := make([]Route, 0, len(d.notifiers))
+	for _, n := range d.notifiers {
+		route := Route{Notifier: n.Name()}
+		if router, ok := n.(channelRouter); ok {
+			route.Channel = router.Channel(event)
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// run delivers queued events until the queue is closed
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+
+	for queued := range d.queue {
+		if d.deliverWithRetries(queued.event) {
+			d.finished(queued.seq)
+		}
+	}
+}
+
+// deliverWithRetries delivers an event to every notifier, retrying those that fail with a backoff
+// until they deliver it or run out of attempts. It returns false when the dispatcher was drained
+// while the event was being retried, leaving it undelivered.
+func (d *Dispatcher) deliverWithRetries(event Event) bool {
+	pending := d.notifiers
+	backoff := d.retryBackoff
+	for attempt := 1; ; attempt++ {
+		var failed []Notifier
+		for _, n := range pending {
+			if err := n.Notify(context.Background(), event); err != nil {
+				d.failed.Add(1)
+				failed = append(failed, n)
+				logrus.Errorf("Notifier %s failed to deliver %s event for rule %s (attempt %d of %d): %v",
+					n.Name(), event.Type, event.Alert.RuleID, attempt, d.attempts, err)
+			} else {
+				d.delivered.Add(1)
+			}
+		}
+		if len(failed) == 0 {
+			return true
+		}
+		if attempt >= d.attempts {
+			d.givenUp.Add(1)
+			logrus.Errorf("Giving up on %s event of alert %s after %d attempts", event.Type, event.Alert.ID, attempt)
+			return true
+		}
+
+		select {
+		case <-d.drained:
+			return false
+		case <-time.After(backoff):
+		}
+		pending = failed
+		backoff *= 2
+	}
+}
+
+// Deliver delivers an event to every notifier but those in skip, waiting for them. It returns the
+// names of the notifiers that delivered it, and the error of each that failed.
+func (d *Dispatcher) Deliver(ctx context.Context, event Event, skip map[string]bool) ([]string, error) {
+	var delivered []string
+	var errs []error
+	for _, n := range d.notifiers {
+		if skip[n.Name()] {
+			continue
+		}
+		if err := n.Notify(ctx, event); err != nil {
+			d.failed.Add(1)
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+			continue
+		}
+		d.delivered.Add(1)
+		delivered = append(delivered, n.Name())
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// Drain stops accepting events and waits for queued ones to be delivered until ctx is done. Events
+// a notifier failed aren't retried anymore.
+// It returns the number of events still queued when it gave up.
+func (d *Dispatcher) Drain(ctx context.Context) int {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+		close(d.drained)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return len(d.queue)
+	}
+}
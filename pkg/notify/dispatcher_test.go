@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestDispatcherDeliversToWebhookBeforeDrain(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(10, 1, NewWebhookNotifier(server.URL))
+	for _, id := range []string{"rule1:dev1", "rule1:dev2"} {
+		require.NoError(t, d.Dispatch(NewEvent(EventReplay, &models.Alert{ID: id, RuleID: "rule1"})))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, 0, d.Drain(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	assert.Equal(t, EventReplay, received[0].Type)
+	assert.Equal(t, "rule1:dev1", received[0].Alert.ID)
+
+	// No new events are accepted once drained
+	assert.ErrorIs(t, d.Dispatch(NewEvent(EventFired, &models.Alert{})), ErrDispatcherClosed)
+}
+
+// gatedNotifier delivers an event each time its gate is opened
+type gatedNotifier struct {
+	gate chan struct{}
+}
+
+func (n *gatedNotifier) Name() string { return "gated" }
+
+func (n *gatedNotifier) Notify(ctx context.Context, event Event) error {
+	<-n.gate
+	return nil
+}
+
+func TestDispatcherTracksDeliveredSequence(t *testing.T) {
+	notifier := &gatedNotifier{gate: make(chan struct{})}
+	d := NewDispatcher(10, 1, notifier)
+	assert.Equal(t, uint64(0), d.Delivered())
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{RuleID: "rule1"})))
+	}
+	assert.Equal(t, uint64(2), d.LastQueued())
+	assert.Equal(t, uint64(0), d.Delivered())
+
+	notifier.gate <- struct{}{}
+	require.Eventually(t, func() bool { return d.Delivered() == 1 }, 5*time.Second, time.Millisecond)
+	notifier.gate <- struct{}{}
+	require.Eventually(t, func() bool { return d.Delivered() == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 0, d.Drain(context.Background()))
+}
+
+// flakyNotifier fails the first deliveries, or every one when failures is negative
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (n *flakyNotifier) Name() string { return "flaky" }
+
+func (n *flakyNotifier) Notify(ctx context.Context, event Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if n.failures < 0 || n.calls <= n.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	// A dropped event doesn't hold back the ones after it: its caller handles it again
+	notifier := &gatedNotifier{gate: make(chan struct{})}
+	d := NewDispatcher(1, 1, notifier)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a1"})))
+	require.Eventually(t, func() bool { return d.Stats().Queued == 0 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a2"})))
+	assert.ErrorIs(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a3"})), ErrQueueFull)
+	notifier.gate <- struct{}{}
+	notifier.gate <- struct{}{}
+	require.Eventually(t, func() bool { return d.Delivered() == 3 }, 5*time.Second, time.Millisecond)
+
+	// A transient failure is retried, and later events are delivered once it's delivered
+	flaky := &flakyNotifier{failures: 2}
+	d = NewDispatcher(10, 1, flaky)
+	d.SetRetry(3, time.Millisecond)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a1"})))
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a2"})))
+	require.Eventually(t, func() bool { return d.Delivered() == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), d.Stats().Delivered)
+	assert.Equal(t, int64(2), d.Stats().Failed)
+	assert.Zero(t, d.Stats().GivenUp)
+
+	// An event failing every attempt is given up on rather than holding back the rest for good
+	failing := &flakyNotifier{failures: -1}
+	d = NewDispatcher(10, 1, failing)
+	d.SetRetry(2, time.Millisecond)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a1"})))
+	require.Eventually(t, func() bool { return d.Delivered() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int64(1), d.Stats().GivenUp)
+	assert.Equal(t, 2, failing.calls)
+
+	// Events still retried when the dispatcher is drained stay undelivered
+	d = NewDispatcher(10, 1, &flakyNotifier{failures: -1})
+	d.SetRetry(5, time.Hour)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a1"})))
+	require.Eventually(t, func() bool { return d.Stats().Failed == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, 0, d.Drain(context.Background()))
+	assert.Equal(t, uint64(0), d.Delivered())
+}
+
+func TestDispatcherEnqueueWaitsForRoom(t *testing.T) {
+	notifier := &gatedNotifier{gate: make(chan struct{})}
+	d := NewDispatcher(1, 1, notifier)
+
+	// One event is being delivered and another fills the queue
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a1"})))
+	require.Eventually(t, func() bool { return d.Stats().Queued == 0 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a2"})))
+	assert.ErrorIs(t, d.Dispatch(NewEvent(EventFired, &models.Alert{ID: "a3"})), ErrQueueFull)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Enqueue(ctx, NewEvent(EventFired, &models.Alert{ID: "a3"})), ErrQueueFull)
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			notifier.gate <- struct{}{}
+		}
+	}()
+	require.NoError(t, d.Enqueue(context.Background(), NewEvent(EventFired, &models.Alert{ID: "a3"})))
+	require.Equal(t, 0, d.Drain(context.Background()))
+	assert.Equal(t, int64(3), d.Stats().Delivered)
+}
+
+func TestWebhookNotifierReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), NewEvent(EventFired, &models.Alert{}))
+	assert.ErrorContains(t, err, "status 502")
+}
+
+func TestEventLocalized(t *testing.T) {
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1"})
+	event.Message = "dev1 is overheating"
+	event.Messages = map[string]string{"de": "dev1 überhitzt", "pt-BR": "dev1 está superaquecendo"}
+
+	assert.Equal(t, "dev1 überhitzt", event.Localized("de-CH").Message)
+	assert.Equal(t, "de-CH", event.Localized("de_ch").Locale)
+	assert.Equal(t, "dev1 está superaquecendo", event.Localized("pt-br").Message)
+	// Locales without a translation fall back to English
+	assert.Equal(t, "dev1 is overheating", event.Localized("pt").Message)
+	assert.Equal(t, "dev1 is overheating", event.Localized("ja").Message)
+	assert.Equal(t, "", event.Localized("").Locale)
+}
+
+func TestDispatcherRoutes(t *testing.T) {
+	slack := NewSlackNotifier("https://hooks.slack.test", "#alerts", true, "#team-")
+	d := NewDispatcher(10, 1, NewWebhookNotifier("https://hooks.test/alerts"), slack)
+	defer d.Drain(context.Background())
+
+	assert.Equal(t, []Route{
+		{Notifier: "webhook:https://hooks.test/alerts"},
+		{Notifier: "slack", Channel: "#team-payments"},
+	}, d.Routes(NewEvent(EventFired, &models.Alert{RuleID: "rule1", Team: "payments"})))
+	assert.Equal(t, "#alerts", d.Routes(NewEvent(EventFired, &models.Alert{RuleID: "rule1"}))[1].Channel)
+}
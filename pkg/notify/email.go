@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+)
+
+// EmailOptions configures the SMTP server an email notifier sends through and its recipients
+type EmailOptions struct {
+	Host     string
+	Port     int // 587 when zero
+	Username string
+	Password string // Authenticates with PLAIN auth when a username is set
+	From     string
+	To       []string
+	Locale   string // Locale messages are sent in, English when empty
+}
+
+// EmailNotifier sends events as plain text emails, one per recipient so each gets action links
+// signed for them
+type EmailNotifier struct {
+	addr   string
+	auth   smtp.Auth
+	from   string
+	to     []string
+	locale string
+	links  *ActionLinks // Acknowledge and resolve links added to alerts, none when nil
+	send   func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	now    func() time.Time
+}
+
+// NewEmailNotifier creates an email notifier
+func NewEmailNotifier(opts EmailOptions) (*EmailNotifier, error) {
+	if opts.Host == "" {
+		return nil, fmt.Errorf("email: host is required")
+	}
+	if opts.From == "" {
+		return nil, fmt.Errorf("email: from address is required")
+	}
+	if len(opts.To) == 0 {
+		return nil, fmt.Errorf("email: at least one recipient is required")
+	}
+	port := opts.Port
+	if port == 0 {
+		port = 587
+	}
+
+	e := &EmailNotifier{
+		addr:   net.JoinHostPort(opts.Host, strconv.Itoa(port)),
+		from:   opts.From,
+		to:     opts.To,
+		locale: opts.Locale,
+		send:   smtp.SendMail,
+		now:    time.Now,
+	}
+	if opts.Username != "" {
+		e.auth = smtp.PlainAuth("", opts.Username, opts.Password, opts.Host)
+	}
+	return e, nil
+}
+
+// SetActionLinks adds one-click acknowledge and resolve links to emails of alerts that need
+// attention, signed for each recipient
+func (e *EmailNotifier) SetActionLinks(links *ActionLinks) {
+	e.links = links
+}
+
+// Name returns the notifier name
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify emails the event to each recipient
+func (e *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	event = event.Localized(e.locale)
+	locale := i18n.Lookup(e.locale)
+	text := alertText(event, locale)
+
+	var failed []string
+	for _, recipient := range e.to {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.send(e.addr, e.auth, e.from, []string{recipient}, e.message(event, text, recipient, locale)); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", recipient, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to email %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// message builds the email sent to a recipient: the first line of text as the subject, and text
+// followed by the recipient's action links as the body
+func (e *EmailNotifier) message(event Event, text, recipient string, locale *i18n.Locale) []byte {
+	subject, _, _ := strings.Cut(text, "\n")
+	body := text
+	if e.links != nil && acknowledgeable(event) {
+		now := e.now()
+		body += "\n\n" + locale.Label("acknowledge") + ": " + e.links.URL(ActionAcknowledge, event.Alert.ID, recipient, now)
+		body += "\n" + locale.Label("resolve") + ": " + e.links.URL(ActionResolve, event.Alert.ID, recipient, now)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", e.now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
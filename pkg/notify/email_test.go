@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestEmailNotifierSendsSignedLinksPerRecipient(t *testing.T) {
+	email, err := NewEmailNotifier(EmailOptions{Host: "smtp.example.com", From: "alerts@example.com",
+		To: []string{"alice@example.com", "bob@example.com"}})
+	require.NoError(t, err)
+	links, err := NewActionLinks("https://alerts.example.com", "secret", time.Hour)
+	require.NoError(t, err)
+	email.SetActionLinks(links)
+	now := time.Now()
+	email.now = func() time.Time { return now }
+
+	sent := map[string]string{}
+	email.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.Nil(t, auth)
+		sent[to[0]] = string(msg)
+		return nil
+	}
+
+	alert := &models.Alert{ID: "rule1:dev1:4", RuleName: "High temp", Severity: models.RuleSeverityCritical}
+	require.NoError(t, email.Notify(context.Background(), NewEvent(EventFired, alert)))
+	require.Len(t, sent, 2)
+
+	msg := sent["alice@example.com"]
+	assert.Contains(t, msg, "To: alice@example.com\r\n")
+	assert.Contains(t, msg, "Subject: [CRITICAL] High temp (fired): alert rule1:dev1:4\r\n")
+	for _, action := range []string{ActionAcknowledge, ActionResolve} {
+		link := links.URL(action, alert.ID, "alice@example.com", now)
+		assert.Contains(t, msg, link)
+		assert.NotContains(t, sent["bob@example.com"], link)
+	}
+
+	// Acknowledged alerts need no links
+	sent = map[string]string{}
+	alert.Acknowledged = true
+	require.NoError(t, email.Notify(context.Background(), NewEvent(EventEscalated, alert)))
+	assert.NotContains(t, sent["alice@example.com"], ActionLinkPath)
+}
+
+func TestEmailNotifierReportsFailedRecipients(t *testing.T) {
+	email, err := NewEmailNotifier(EmailOptions{Host: "smtp.example.com", Port: 25, Username: "gateway", Password: "pw",
+		From: "alerts@example.com", To: []string{"alice@example.com", "bob@example.com"}})
+	require.NoError(t, err)
+	var attempts int
+	email.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		attempts++
+		assert.NotNil(t, auth)
+		if to[0] == "alice@example.com" {
+			return errors.New("mailbox unavailable")
+		}
+		return nil
+	}
+
+	err = email.Notify(context.Background(), NewEvent(EventFired, &models.Alert{ID: "rule1:dev1:4"}))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "alice@example.com: mailbox unavailable"))
+	assert.Equal(t, 2, attempts)
+
+	_, err = NewEmailNotifier(EmailOptions{Host: "smtp.example.com", From: "alerts@example.com"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fcmScope is the OAuth scope of the FCM HTTP v1 API
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcmEndpoint is the base URL of the FCM HTTP v1 API
+const fcmEndpoint = "https://fcm.googleapis.com"
+
+// FCMSender sends push messages through the Firebase Cloud Messaging HTTP v1 API, authenticating
+// as a service account with short-lived OAuth access tokens
+type FCMSender struct {
+	projectID   string
+	clientEmail string
+	key         *rsa.PrivateKey
+	tokenURL    string
+	endpoint    string
+	client      *http.Client
+	now         func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// fcmServiceAccount is the part of a Firebase service account key file the sender uses
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCMSender creates an FCM sender from a service account key file, connecting through proxy
+// like the other notifiers
+func NewFCMSender(credentialsFile, proxy string) (*FCMSender, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: failed to read credentials: %w", err)
+	}
+	f, err := newFCMSender(data)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := httpTransport(proxy, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: %w", err)
+	}
+	if transport != nil {
+		f.client.Transport = transport
+	}
+	return f, nil
+}
+
+// newFCMSender creates an FCM sender from the contents of a service account key file
+func newFCMSender(credentials []byte) (*FCMSender, error) {
+	var account fcmServiceAccount
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, fmt.Errorf("fcm: invalid credentials: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, fmt.Errorf("fcm: credentials need project_id, client_email and token_uri")
+	}
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("fcm: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("fcm: private key is not an RSA key")
+	}
+	return &FCMSender{
+		projectID:   account.ProjectID,
+		clientEmail: account.ClientEmail,
+		key:         rsaKey,
+		tokenURL:    account.TokenURI,
+		endpoint:    fcmEndpoint,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+	}, nil
+}
+
+// Send pushes a message to a device. Tokens FCM reports as unregistered return ErrPushTokenUnregistered.
+func (f *FCMSender) Send(ctx context.Context, token string, msg PushMessage) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+			"android":      map[string]string{"priority": "high"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal fcm message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/v1/projects/%s/messages:send", f.endpoint, url.PathEscape(f.projectID)), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create fcm request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call fcm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(data, &failure)
+	for _, detail := range failure.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return fmt.Errorf("%w: %s", ErrPushTokenUnregistered, failure.Error.Message)
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrPushTokenUnregistered, failure.Error.Message)
+	}
+	return fmt.Errorf("fcm returned status %d: %s %s", resp.StatusCode, failure.Error.Status, failure.Error.Message)
+}
+
+// token returns an OAuth access token for the FCM scope, exchanging a signed assertion for a new one
+// shortly before the current one expires
+func (f *FCMSender) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if f.accessToken != "" && now.Add(time.Minute).Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := signJWT(map[string]interface{}{"alg": "RS256", "typ": "JWT"}, map[string]interface{}{
+		"iss":   f.clientEmail,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}, func(signingInput []byte) ([]byte, error) {
+		digest := sha256.Sum256(signingInput)
+		return rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	})
+	if err != nil {
+		return "", fmt.Errorf("fcm: %w", err)
+	}
+
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create fcm token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get fcm access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("fcm token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var grant struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil || grant.AccessToken == "" {
+		return "", fmt.Errorf("fcm token endpoint returned no access token")
+	}
+	f.accessToken = grant.AccessToken
+	f.expiresAt = now.Add(time.Duration(grant.ExpiresIn) * time.Second)
+	return f.accessToken, nil
+}
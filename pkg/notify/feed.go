@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Feed fans events out to live subscribers, such as dashboards following alerts as they fire.
+// Replayed alerts are historical and not sent to subscribers.
+type Feed struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	dropped     int64
+}
+
+// NewFeed creates a feed whose subscribers buffer up to buffer events each
+func NewFeed(buffer int) *Feed {
+	if buffer <= 0 {
+		buffer = 100
+	}
+	return &Feed{buffer: buffer, subscribers: make(map[chan Event]struct{})}
+}
+
+// Name returns the notifier name
+func (f *Feed) Name() string {
+	return "feed"
+}
+
+// Notify sends an event to every subscriber without blocking. Subscribers too slow to keep up
+// miss the event rather than holding up the notification pipeline.
+func (f *Feed) Notify(ctx context.Context, event Event) error {
+	if event.Type == EventReplay {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+			f.dropped++
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the events sent from now on, and a function ending the
+// subscription that closes the channel
+func (f *Feed) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, f.buffer)
+
+	f.mu.Lock()
+	f.subscribers[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subscribers, ch)
+			f.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Subscribers returns the number of current subscribers
+func (f *Feed) Subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers)
+}
+
+// Dropped returns the number of events slow subscribers missed
+func (f *Feed) Dropped() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dropped
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestFeedFansOutToSubscribers(t *testing.T) {
+	feed := NewFeed(1)
+	first, unsubscribeFirst := feed.Subscribe()
+	second, unsubscribeSecond := feed.Subscribe()
+	defer unsubscribeSecond()
+	assert.Equal(t, 2, feed.Subscribers())
+
+	alert := &models.Alert{ID: "rule1:dev1", RuleID: "rule1"}
+	require.NoError(t, feed.Notify(context.Background(), NewEvent(EventReplay, alert)))
+	require.NoError(t, feed.Notify(context.Background(), NewEvent(EventFired, alert)))
+
+	for _, ch := range []<-chan Event{first, second} {
+		event := <-ch
+		assert.Equal(t, EventFired, event.Type)
+		assert.Equal(t, "rule1:dev1", event.Alert.ID)
+	}
+
+	// A full subscriber misses events instead of blocking the pipeline
+	require.NoError(t, feed.Notify(context.Background(), NewEvent(EventEscalated, alert)))
+	require.NoError(t, feed.Notify(context.Background(), NewEvent(EventEscalated, alert)))
+	assert.Equal(t, int64(2), feed.Dropped())
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	assert.Equal(t, 1, feed.Subscribers())
+	<-first
+	_, open := <-first
+	assert.False(t, open)
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// KafkaNotifier writes events as JSON messages to a Kafka topic.
+// It goes through a Timeplus external stream so the gateway doesn't need its own Kafka client.
+type KafkaNotifier struct {
+	tpClient timeplus.StreamStore
+	brokers  string
+	topic    string
+	stream   string
+}
+
+// NewKafkaNotifier creates the external stream for the topic if needed and returns a notifier writing to it
+func NewKafkaNotifier(ctx context.Context, tpClient timeplus.StreamStore, brokers, topic string) (*KafkaNotifier, error) {
+	if brokers == "" || topic == "" {
+		return nil, fmt.Errorf("kafka sink requires brokers and topic")
+	}
+
+	k := &KafkaNotifier{
+		tpClient: tpClient,
+		brokers:  brokers,
+		topic:    topic,
+		stream:   timeplus.EnvironmentPrefix() + "tp_notify_kafka_" + nonIdentifierChars.ReplaceAllString(topic, "_"),
+	}
+
+	ddl := fmt.Sprintf("CREATE EXTERNAL STREAM IF NOT EXISTS `%s` (raw string) SETTINGS type='kafka', brokers='%s', topic='%s'",
+		k.stream, brokers, topic)
+	if err := tpClient.ExecuteDDL(ctx, ddl); err != nil {
+		return nil, fmt.Errorf("failed to create kafka external stream %s: %w", k.stream, err)
+	}
+
+	return k, nil
+}
+
+// Name returns the notifier name
+func (k *KafkaNotifier) Name() string {
+	return "kafka:" + k.topic
+}
+
+// Notify writes the event to the Kafka topic
+func (k *KafkaNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := k.tpClient.InsertIntoStream(ctx, k.stream, []string{"raw"}, []interface{}{string(body)}); err != nil {
+		return fmt.Errorf("failed to write to kafka topic %s: %w", k.topic, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Delivery statuses recorded by the gateway. Providers' status updates are recorded as they
+// report them, e.g. "delivered", "undelivered", "completed" or "no-answer".
+const (
+	DeliveryQueued      = "queued"       // The provider accepted the message or call
+	DeliveryFailed      = "failed"       // The provider rejected it, or couldn't be reached
+	DeliverySuppressed  = "suppressed"   // Not sent during the recipient's quiet hours
+	DeliveryRateLimited = "rate_limited" // Not sent, the recipient had been sent too many already
+)
+
+// DeliveryRecord is a delivery attempt or status update of a notification sent to a person
+type DeliveryRecord struct {
+	Notifier  string    `json:"notifier"`
+	Channel   string    `json:"channel"` // sms or voice
+	Recipient string    `json:"recipient"`
+	AlertID   string    `json:"alertId"`
+	Event     string    `json:"event"`
+	Status    string    `json:"status"`
+	MessageID string    `json:"messageId,omitempty"` // The provider's ID of the message or call
+	Detail    string    `json:"detail,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// NotificationLog records the delivery status of notifications in the notification log stream
+type NotificationLog struct {
+	client timeplus.StreamStore
+}
+
+// NewNotificationLog creates the notification log stream if needed
+func NewNotificationLog(ctx context.Context, client timeplus.StreamStore) (*NotificationLog, error) {
+	if err := client.CreateStream(ctx, timeplus.NotificationLogStream, timeplus.GetNotificationLogSchema()); err != nil {
+		return nil, fmt.Errorf("failed to ensure notification log stream: %w", err)
+	}
+	return &NotificationLog{client: client}, nil
+}
+
+// Record writes a delivery record, timestamped now unless it has a time
+func (l *NotificationLog) Record(ctx context.Context, record DeliveryRecord) error {
+	if record.At.IsZero() {
+		record.At = time.Now()
+	}
+	columns := []string{"notifier", "channel", "recipient", "alert_id", "event_type", "status", "message_id", "detail", "at"}
+	values := []interface{}{record.Notifier, record.Channel, record.Recipient, record.AlertID, record.Event,
+		record.Status, record.MessageID, record.Detail, record.At}
+	if err := l.client.InsertIntoStream(ctx, timeplus.NotificationLogStream, columns, values); err != nil {
+		return fmt.Errorf("failed to record delivery: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit delivery records, newest first, of an alert or of all alerts when
+// alertID is empty
+func (l *NotificationLog) List(ctx context.Context, alertID string, limit int) ([]DeliveryRecord, error) {
+	where := ""
+	if alertID != "" {
+		where = fmt.Sprintf(" WHERE alert_id = '%s'", strings.ReplaceAll(alertID, "'", "''"))
+	}
+	rows, err := l.client.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT notifier, channel, recipient, alert_id, event_type, status, message_id, detail, at FROM table(%s)%s ORDER BY at DESC LIMIT %d",
+		timeplus.NotificationLogStream, where, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification log: %w", err)
+	}
+
+	records := make([]DeliveryRecord, 0, len(rows))
+	for _, row := range rows {
+		record := DeliveryRecord{
+			Notifier:  rowString(row, "notifier"),
+			Channel:   rowString(row, "channel"),
+			Recipient: rowString(row, "recipient"),
+			AlertID:   rowString(row, "alert_id"),
+			Event:     rowString(row, "event_type"),
+			Status:    rowString(row, "status"),
+			MessageID: rowString(row, "message_id"),
+			Detail:    rowString(row, "detail"),
+		}
+		if at, ok := row["at"].(time.Time); ok {
+			record.At = at
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// rowString returns a string column of a query row, empty when it's null or missing
+func rowString(row map[string]interface{}, column string) string {
+	switch v := row[column].(type) {
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+	}
+	return ""
+}
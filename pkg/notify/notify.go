@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Event types
+const (
+	EventFired     = "fired"     // A rule triggered a new alert
+	EventReplay    = "replay"    // A historical alert re-emitted on request
+	EventEscalated = "escalated" // An alert was not acknowledged within its SLA
+	EventDegraded  = "degraded"  // A rule exceeded its alert volume quota and was throttled harder
+
+	// Problems of the gateway itself, such as failed rules or failing notifiers
+	EventGatewayProblem   = "gateway_problem"   // A self-alert check found a problem
+	EventGatewayRecovered = "gateway_recovered" // The problem of an earlier gateway_problem event cleared
+
+	// State changes of a fired alert, carrying a Transition
+	EventAcknowledged = "acknowledged" // Someone acknowledged the alert
+	EventSnoozed      = "snoozed"      // The alert was silenced for a while
+	EventResolved     = "resolved"     // The rule's resolve query found the condition cleared
+	EventReopened     = "reopened"     // An acknowledged alert was reopened
+)
+
+// Transition describes the state change of a state change event
+type Transition struct {
+	From string    `json:"from,omitempty"` // State before the change, when the gateway saw it
+	To   string    `json:"to"`             // State in the alert acks stream, e.g. "acknowledged"
+	By   string    `json:"by,omitempty"`   // Who changed it, e.g. the acknowledging user or "auto-resolver"
+	At   time.Time `json:"at"`
+}
+
+// Event is a single notification sent to downstream consumers
+type Event struct {
+	ID      string        `json:"id,omitempty"` // Set for events recorded in the notification outbox
+	Type    string        `json:"type"`
+	Alert   *models.Alert `json:"alert"`
+	Message string        `json:"message,omitempty"` // Rendered from the rule's notification template, if any
+	Locale  string        `json:"locale,omitempty"`  // Locale the event was localized into for its recipient
+	SentAt  time.Time     `json:"sentAt"`
+
+	Transition *Transition `json:"transition,omitempty"` // Set for state changes, such as acknowledgements
+
+	// Incident the alert opened, with the alerts that joined it until it was notified
+	Incident *models.Incident `json:"incident,omitempty"`
+
+	// Messages rendered from the template's translations, by locale
+	Messages map[string]string `json:"-"`
+}
+
+// NewEvent creates an event for an alert stamped with the current time
+func NewEvent(eventType string, alert *models.Alert) Event {
+	return Event{Type: eventType, Alert: alert, SentAt: time.Now().UTC()}
+}
+
+// Localized returns the event as sent to recipients of a locale, with the message rendered from
+// the template's translation for the locale or its language. Without one, the English message is kept.
+func (e Event) Localized(locale string) Event {
+	if locale == "" {
+		return e
+	}
+	e.Locale = i18n.Normalize(locale)
+	if key, ok := i18n.Match(locale, e.Messages); ok {
+		e.Message = e.Messages[key]
+	}
+	return e
+}
+
+// Notifier delivers events to a downstream sink
+type Notifier interface {
+	// Name identifies the notifier in logs and results
+	Name() string
+	// Notify delivers a single event
+	Notify(ctx context.Context, event Event) error
+}
+
+// acknowledgeable reports whether an event is about an alert someone may still acknowledge
+func acknowledgeable(event Event) bool {
+	if event.Alert == nil || event.Alert.Acknowledged {
+		return false
+	}
+	return event.Type == EventFired || event.Type == EventEscalated || event.Type == EventReopened
+}
+
+// alertText renders the plain text message of an event, with the default text in the given locale
+func alertText(event Event, locale *i18n.Locale) string {
+	// A message rendered from the rule's notification template replaces the default text
+	if event.Message != "" {
+		return event.Message
+	}
+
+	alert := event.Alert
+	text := fmt.Sprintf("[%s] %s (%s): %s %s", strings.ToUpper(locale.Severity(string(alert.Severity))), alert.RuleName,
+		locale.Event(event.Type), locale.Label("alert"), alert.ID)
+
+	var ownership []string
+	if alert.Owner != "" {
+		ownership = append(ownership, locale.Label("owner")+": "+alert.Owner)
+	}
+	if alert.Team != "" {
+		ownership = append(ownership, locale.Label("team")+": "+alert.Team)
+	}
+	if alert.OnCall != "" {
+		ownership = append(ownership, locale.Label("onCall")+": "+alert.OnCall)
+	}
+	if len(ownership) > 0 {
+		text += " — " + strings.Join(ownership, ", ")
+	}
+	if alert.Summary != "" {
+		text += "\n" + alert.Summary
+	}
+	if alert.Description != "" {
+		text += "\n" + alert.Description
+	}
+	if alert.RunbookURL != "" {
+		text += "\n" + locale.Label("runbook") + ": " + alert.RunbookURL
+	}
+
+	return text
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ProxyDirect as a notifier's proxy connects directly, ignoring the global proxy and the
+// HTTP_PROXY/HTTPS_PROXY environment variables
+const ProxyDirect = "direct"
+
+// ResolveProxy returns the proxy a notifier uses: its own if set, otherwise the global one
+func ResolveProxy(notifierProxy, globalProxy string) string {
+	if notifierProxy != "" {
+		return notifierProxy
+	}
+	return globalProxy
+}
+
+// httpTransport returns a transport sending requests through a proxy with the given TLS config, or
+// nil when neither is set so the default transport is used. An empty proxy falls back to the
+// HTTP_PROXY/HTTPS_PROXY environment variables like the default transport.
+func httpTransport(proxy string, tlsConfig *tls.Config) (*http.Transport, error) {
+	if proxy == "" && tlsConfig == nil {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	switch proxy {
+	case "":
+	case ProxyDirect:
+		transport.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", proxyURL.Redacted())
+		}
+		if proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxyURL.Redacted())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport, nil
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestResolveProxy(t *testing.T) {
+	assert.Equal(t, "http://global:3128", ResolveProxy("", "http://global:3128"))
+	assert.Equal(t, "http://slack-proxy:3128", ResolveProxy("http://slack-proxy:3128", "http://global:3128"))
+	assert.Equal(t, ProxyDirect, ResolveProxy(ProxyDirect, "http://global:3128"))
+}
+
+func TestNotifiersSendThroughProxy(t *testing.T) {
+	// A plain HTTP proxy receives the absolute target URL in the request line
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1"})
+
+	webhook, err := NewWebhookNotifierWithOptions("http://alerts.example.invalid/hook", WebhookOptions{Proxy: proxy.URL})
+	require.NoError(t, err)
+	require.NoError(t, webhook.Notify(context.Background(), event))
+
+	slack := NewSlackNotifier("http://hooks.slack.example.invalid/services/T000", "", false, "")
+	require.NoError(t, slack.SetProxy(proxy.URL))
+	require.NoError(t, slack.Notify(context.Background(), event))
+
+	assert.Equal(t, []string{"http://alerts.example.invalid/hook", "http://hooks.slack.example.invalid/services/T000"}, proxied)
+}
+
+func TestHTTPTransportProxy(t *testing.T) {
+	transport, err := httpTransport("", nil)
+	require.NoError(t, err)
+	assert.Nil(t, transport)
+
+	transport, err = httpTransport(ProxyDirect, nil)
+	require.NoError(t, err)
+	assert.Nil(t, transport.Proxy)
+
+	_, err = httpTransport("ftp://proxy:21", nil)
+	assert.ErrorContains(t, err, "scheme must be http, https or socks5")
+
+	_, err = httpTransport("http://user:pass@", nil)
+	assert.ErrorContains(t, err, "missing host")
+	assert.NotContains(t, err.Error(), "pass")
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// ErrPushTokenUnregistered is returned by push senders for device tokens their platform no longer
+// accepts, e.g. because the app was uninstalled
+var ErrPushTokenUnregistered = errors.New("push token is no longer registered")
+
+// PushDevices lists the devices alerts are pushed to, and unregisters those their platform rejects
+type PushDevices interface {
+	List() []*models.PushDevice
+	Unregister(ctx context.Context, token string) error
+}
+
+// PushMessage is the content of a push notification
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string // Lets the app open the alert: alertId, ruleId, severity and event
+}
+
+// PushSender delivers push messages to the devices of one platform
+type PushSender interface {
+	Send(ctx context.Context, token string, msg PushMessage) error
+}
+
+// PushNotifier pushes alerts that need attention to the registered devices, through the sender of
+// each device's platform. Devices whose platform has no sender are skipped.
+type PushNotifier struct {
+	devices    PushDevices
+	senders    map[string]PushSender // By platform
+	severities map[string]bool       // Severities pushed
+	locale     string
+}
+
+// NewPushNotifier creates a push notifier for alerts of the given severities, sending messages in
+// locale, English when empty
+func NewPushNotifier(devices PushDevices, severities []string, locale string) *PushNotifier {
+	p := &PushNotifier{devices: devices, senders: map[string]PushSender{}, severities: map[string]bool{}, locale: locale}
+	for _, severity := range severities {
+		p.severities[strings.ToLower(severity)] = true
+	}
+	return p
+}
+
+// SetSender delivers pushes to devices of a platform, such as models.PushPlatformFCM, through sender
+func (p *PushNotifier) SetSender(platform string, sender PushSender) {
+	p.senders[platform] = sender
+}
+
+// Name returns the notifier name
+func (p *PushNotifier) Name() string {
+	return "push"
+}
+
+// Notify pushes the event to every registered device, if its alert needs attention and has a pushed
+// severity. Devices their platform no longer accepts are unregistered.
+func (p *PushNotifier) Notify(ctx context.Context, event Event) error {
+	if !acknowledgeable(event) || !p.severities[strings.ToLower(string(event.Alert.Severity))] {
+		return nil
+	}
+	msg := pushMessage(event.Localized(p.locale), i18n.Lookup(p.locale))
+
+	var failed []string
+	for _, device := range p.devices.List() {
+		sender := p.senders[device.Platform]
+		if sender == nil {
+			continue
+		}
+		err := sender.Send(ctx, device.Token, msg)
+		if errors.Is(err, ErrPushTokenUnregistered) {
+			logrus.Infof("Unregistering %s push device of %q: %v", device.Platform, device.User, err)
+			if err := p.devices.Unregister(ctx, device.Token); err != nil {
+				logrus.Warnf("Failed to unregister push device: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s device of %q: %v", device.Platform, device.User, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to push to %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// pushMessage renders the notification of an event: the severity and rule as the title, and the
+// message of the rule's template, the alert's summary, or the default text as the body
+func pushMessage(event Event, locale *i18n.Locale) PushMessage {
+	alert := event.Alert
+	body := event.Message
+	if body == "" {
+		body = alert.Summary
+	}
+	if body == "" {
+		body = fmt.Sprintf("%s %s (%s)", locale.Label("alert"), alert.ID, locale.Event(event.Type))
+	}
+	return PushMessage{
+		Title: fmt.Sprintf("[%s] %s", strings.ToUpper(locale.Severity(string(alert.Severity))), alert.RuleName),
+		Body:  body,
+		Data: map[string]string{
+			"alertId":  alert.ID,
+			"ruleId":   alert.RuleID,
+			"severity": string(alert.Severity),
+			"event":    event.Type,
+		},
+	}
+}
+
+// signJWT returns a compact JWT of header and claims, signed by sign over the encoded header and claims
+func signJWT(header, claims map[string]interface{}, sign func(signingInput []byte) ([]byte, error)) (string, error) {
+	encode := func(part map[string]interface{}) (string, error) {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	}
+	encodedHeader, err := encode(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encode(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+	signature, err := sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey reads a PEM encoded PKCS#8 private key, as in Firebase service account files
+// and APNs .p8 keys
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return key, nil
+}
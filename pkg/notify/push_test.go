@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+type fakePushDevices struct {
+	devices      []*models.PushDevice
+	unregistered []string
+}
+
+func (f *fakePushDevices) List() []*models.PushDevice {
+	return f.devices
+}
+
+func (f *fakePushDevices) Unregister(ctx context.Context, token string) error {
+	f.unregistered = append(f.unregistered, token)
+	return nil
+}
+
+type pushSenderFunc func(ctx context.Context, token string, msg PushMessage) error
+
+func (f pushSenderFunc) Send(ctx context.Context, token string, msg PushMessage) error {
+	return f(ctx, token, msg)
+}
+
+func TestPushNotifierPushesAttentionAlertsOfItsSeverities(t *testing.T) {
+	devices := &fakePushDevices{devices: []*models.PushDevice{
+		{Token: "web-1", Platform: models.PushPlatformFCM, User: "alice"},
+		{Token: "web-gone", Platform: models.PushPlatformFCM, User: "alice"},
+		{Token: "ios-1", Platform: models.PushPlatformAPNs, User: "bob"},
+	}}
+	push := NewPushNotifier(devices, []string{"Critical"}, "")
+	var sent []string
+	push.SetSender(models.PushPlatformFCM, pushSenderFunc(func(ctx context.Context, token string, msg PushMessage) error {
+		if token == "web-gone" {
+			return ErrPushTokenUnregistered
+		}
+		sent = append(sent, token)
+		assert.Equal(t, "[CRITICAL] High temp", msg.Title)
+		assert.Equal(t, "rule1:dev1:4", msg.Data["alertId"])
+		return nil
+	}))
+
+	alert := &models.Alert{ID: "rule1:dev1:4", RuleID: "rule1", RuleName: "High temp", Severity: models.RuleSeverityCritical}
+	require.NoError(t, push.Notify(context.Background(), NewEvent(EventFired, alert)))
+	// Devices without a sender for their platform are skipped, rejected tokens are unregistered
+	assert.Equal(t, []string{"web-1"}, sent)
+	assert.Equal(t, []string{"web-gone"}, devices.unregistered)
+
+	sent = nil
+	alert.Severity = models.RuleSeverityWarning
+	require.NoError(t, push.Notify(context.Background(), NewEvent(EventFired, alert)))
+	alert.Severity, alert.Acknowledged = models.RuleSeverityCritical, true
+	require.NoError(t, push.Notify(context.Background(), NewEvent(EventEscalated, alert)))
+	assert.Empty(t, sent)
+
+	alert.Acknowledged = false
+	push.SetSender(models.PushPlatformAPNs, pushSenderFunc(func(ctx context.Context, token string, msg PushMessage) error {
+		return errors.New("connection refused")
+	}))
+	err := push.Notify(context.Background(), NewEvent(EventFired, alert))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `apns device of "bob": connection refused`)
+}
+
+func TestFCMSenderAuthenticatesAndDetectsUnregisteredTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	var tokenRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+			assert.Len(t, strings.Split(r.Form.Get("assertion"), "."), 3)
+			_, _ = w.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+			return
+		}
+		assert.Equal(t, "/v1/projects/alerts-app/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+		var body struct {
+			Message struct {
+				Token string `json:"token"`
+			} `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Message.Token == "gone" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","message":"Requested entity was not found.",
+				"details":[{"errorCode":"UNREGISTERED"}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"projects/alerts-app/messages/1"}`))
+	}))
+	defer server.Close()
+
+	credentials, err := json.Marshal(map[string]string{
+		"project_id":   "alerts-app",
+		"client_email": "gateway@alerts-app.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	require.NoError(t, err)
+	fcm, err := newFCMSender(credentials)
+	require.NoError(t, err)
+	fcm.endpoint = server.URL
+
+	msg := PushMessage{Title: "[CRITICAL] High temp", Body: "Too hot"}
+	require.NoError(t, fcm.Send(context.Background(), "web-1", msg))
+	assert.ErrorIs(t, fcm.Send(context.Background(), "gone", msg), ErrPushTokenUnregistered)
+	// The access token is reused until it nearly expires
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestAPNsSenderSignsRequestsAndDetectsUnregisteredTokens(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "AuthKey.p8")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "com.example.alerts", r.Header.Get("apns-topic"))
+		assert.Equal(t, "alert", r.Header.Get("apns-push-type"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "bearer "))
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `"alertId":"rule1:dev1:4"`)
+		if r.URL.Path == "/3/device/gone" {
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered"}`))
+			return
+		}
+		assert.Equal(t, "/3/device/ios-1", r.URL.Path)
+	}))
+	defer server.Close()
+
+	_, err = NewAPNsSender(APNsOptions{KeyFile: keyFile, KeyID: "KEY123"})
+	assert.Error(t, err)
+	apns, err := NewAPNsSender(APNsOptions{KeyFile: keyFile, KeyID: "KEY123", TeamID: "TEAM123", Topic: "com.example.alerts"})
+	require.NoError(t, err)
+	apns.endpoint = server.URL
+
+	msg := PushMessage{Title: "[CRITICAL] High temp", Body: "Too hot", Data: map[string]string{"alertId": "rule1:dev1:4"}}
+	require.NoError(t, apns.Send(context.Background(), "ios-1", msg))
+	assert.ErrorIs(t, apns.Send(context.Background(), "gone", msg), ErrPushTokenUnregistered)
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+)
+
+// Headers Slack signs interactivity requests with
+const (
+	SlackSignatureHeader = "X-Slack-Signature"         // "v0=" + hex HMAC-SHA256 of "v0:" + timestamp + ":" + body
+	SlackTimestampHeader = "X-Slack-Request-Timestamp" // Unix seconds the request was signed at
+)
+
+// SlackAcknowledgeAction is the action ID of the acknowledge button of interactive messages
+const SlackAcknowledgeAction = "acknowledge"
+
+// slackSignatureMaxAge is how old a signed Slack request may be, so captured requests can't be replayed
+const slackSignatureMaxAge = 5 * time.Minute
+
+// ErrInvalidSlackSignature is returned for Slack requests without a valid, recent signature
+var ErrInvalidSlackSignature = errors.New("invalid Slack signature")
+
+// SlackNotifier posts events to a Slack incoming webhook.
+// With owner routing enabled, alerts go to their rule's team channel (TeamChannelPrefix + team),
+// or as a direct message to the rule owner, before falling back to the default channel.
+// Messages are localized for the channel they are sent to, or the notifier's locale.
+type SlackNotifier struct {
+	webhookURL        string
+	channel           string
+	routeToOwner      bool
+	teamChannelPrefix string
+	locale            string
+	channelLocales    map[string]string // By lowercased channel
+	interactive       bool              // Whether alerts carry an acknowledge button
+	client            *http.Client
+}
+
+// NewSlackNotifier creates a Slack notifier. teamChannelPrefix defaults to "#".
+func NewSlackNotifier(webhookURL, channel string, routeToOwner bool, teamChannelPrefix string) *SlackNotifier {
+	if teamChannelPrefix == "" {
+		teamChannelPrefix = "#"
+	}
+	return &SlackNotifier{
+		webhookURL:        webhookURL,
+		channel:           channel,
+		routeToOwner:      routeToOwner,
+		teamChannelPrefix: teamChannelPrefix,
+		client:            &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetProxy sends requests to Slack through a proxy URL, or directly with ProxyDirect. An empty
+// proxy keeps using the environment's proxy.
+func (s *SlackNotifier) SetProxy(proxy string) error {
+	transport, err := httpTransport(proxy, nil)
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	if transport != nil {
+		s.client.Transport = transport
+	}
+	return nil
+}
+
+// SetLocales sets the locale messages are sent in, English when empty, and the locales of
+// channels or users whose recipients read another language, e.g. {"#ops-berlin": "de"}
+func (s *SlackNotifier) SetLocales(locale string, channelLocales map[string]string) {
+	s.locale = locale
+	s.channelLocales = make(map[string]string, len(channelLocales))
+	for channel, channelLocale := range channelLocales {
+		s.channelLocales[strings.ToLower(channel)] = channelLocale
+	}
+}
+
+// SetInteractive adds an acknowledge button to messages of alerts that need attention. The Slack
+// app of the webhook must send its interactivity requests to the gateway.
+func (s *SlackNotifier) SetInteractive(interactive bool) {
+	s.interactive = interactive
+}
+
+// Locale returns the locale of messages sent to a channel
+func (s *SlackNotifier) Locale(channel string) string {
+	if locale, ok := s.channelLocales[strings.ToLower(channel)]; ok {
+		return locale
+	}
+	return s.locale
+}
+
+// Name returns the notifier name
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Channel returns the Slack channel an event is routed to, empty for the webhook's own channel.
+// Routed alerts go to whoever is on call for the rule before the rule's team or owner.
+func (s *SlackNotifier) Channel(event Event) string {
+	if s.routeToOwner && event.Alert != nil {
+		if event.Alert.OnCall != "" {
+			return "@" + strings.TrimPrefix(event.Alert.OnCall, "@")
+		}
+		if event.Alert.Team != "" {
+			return s.teamChannelPrefix + event.Alert.Team
+		}
+		if event.Alert.Owner != "" {
+			return "@" + strings.TrimPrefix(event.Alert.Owner, "@")
+		}
+	}
+	return s.channel
+}
+
+// Notify posts the event to Slack
+func (s *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	channel := s.Channel(event)
+	locale := s.Locale(channel)
+	text := alertText(event.Localized(locale), i18n.Lookup(locale))
+	payload := map[string]interface{}{"text": text}
+	if channel != "" {
+		payload["channel"] = channel
+	}
+	if s.interactive && acknowledgeable(event) {
+		payload["blocks"] = slackBlocks(text, event.Alert.ID, i18n.Lookup(locale))
+	}
+	return s.post(ctx, s.webhookURL, payload)
+}
+
+// Respond updates the message an interactivity request came from through its response URL,
+// replacing the message with text
+func (s *SlackNotifier) Respond(ctx context.Context, responseURL, text string) error {
+	return s.post(ctx, responseURL, map[string]interface{}{"replace_original": true, "text": text})
+}
+
+// post sends a message payload to a Slack URL
+func (s *SlackNotifier) post(ctx context.Context, url string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call slack webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// slackBlocks lays a message out as Block Kit blocks with an acknowledge button for an alert
+func slackBlocks(text, alertID string, locale *i18n.Locale) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+		{"type": "actions", "elements": []map[string]interface{}{{
+			"type":      "button",
+			"action_id": SlackAcknowledgeAction,
+			"text":      map[string]string{"type": "plain_text", "text": locale.Label("acknowledge")},
+			"value":     alertID,
+			"style":     "primary",
+		}}},
+	}
+}
+
+// VerifySlackSignature checks that a Slack request was signed with the app's signing secret within
+// the last five minutes. timestamp and signature are the values of the Slack headers.
+func VerifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidSlackSignature)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return fmt.Errorf("%w: request is too old", ErrInvalidSlackSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSlackSignature)
+	}
+	return nil
+}
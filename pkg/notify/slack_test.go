@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestSlackChannelRouting(t *testing.T) {
+	routed := NewSlackNotifier("http://example.invalid", "#alerts", true, "#team-")
+	unrouted := NewSlackNotifier("http://example.invalid", "#alerts", false, "")
+
+	teamAlert := NewEvent(EventFired, &models.Alert{Owner: "alice", Team: "payments"})
+	ownerAlert := NewEvent(EventFired, &models.Alert{Owner: "alice"})
+	orphanAlert := NewEvent(EventFired, &models.Alert{})
+
+	assert.Equal(t, "#team-payments", routed.Channel(teamAlert))
+	assert.Equal(t, "@alice", routed.Channel(ownerAlert))
+	assert.Equal(t, "#alerts", routed.Channel(orphanAlert))
+	assert.Equal(t, "#alerts", unrouted.Channel(teamAlert))
+
+	onCallAlert := NewEvent(EventEscalated, &models.Alert{Owner: "alice", Team: "payments", OnCall: "bob"})
+	assert.Equal(t, "@bob", routed.Channel(onCallAlert))
+	assert.Equal(t, "#alerts", unrouted.Channel(onCallAlert))
+}
+
+func TestSlackTextIncludesOwnership(t *testing.T) {
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1", RuleName: "High temp", Severity: "critical", Owner: "alice", Team: "payments"})
+	assert.Equal(t, "[CRITICAL] High temp (fired): alert rule1:dev1 — owner: alice, team: payments", alertText(event, i18n.Lookup("")))
+}
+
+func TestSlackTextUsesTemplateMessage(t *testing.T) {
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1", RuleName: "High temp", Severity: "critical"})
+	event.Message = "dev1 is overheating"
+	assert.Equal(t, "dev1 is overheating", alertText(event, i18n.Lookup("")))
+}
+
+func TestSlackTextLocalized(t *testing.T) {
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1", RuleName: "High temp", Severity: "critical", Owner: "alice", RunbookURL: "https://runbooks.example.com/temp"})
+	assert.Equal(t, "[KRITISCH] High temp (ausgelöst): Alarm rule1:dev1 — Verantwortlich: alice\nRunbook: https://runbooks.example.com/temp",
+		alertText(event, i18n.Lookup("de-AT")))
+}
+
+func TestSlackLocalePerChannel(t *testing.T) {
+	slack := NewSlackNotifier("http://example.invalid", "#alerts", true, "#team-")
+	slack.SetLocales("fr", map[string]string{"#team-Berlin": "de"})
+
+	assert.Equal(t, "de", slack.Locale("#team-berlin"))
+	assert.Equal(t, "fr", slack.Locale("#alerts"))
+}
+
+func TestSlackAcknowledgeButton(t *testing.T) {
+	var payloads []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	slack := NewSlackNotifier(server.URL, "#alerts", false, "")
+	slack.SetInteractive(true)
+	require.NoError(t, slack.Notify(context.Background(), NewEvent(EventFired, &models.Alert{ID: "rule1:dev1"})))
+	require.NoError(t, slack.Notify(context.Background(), NewEvent(EventFired, &models.Alert{ID: "rule1:dev2", Acknowledged: true})))
+	require.NoError(t, slack.Notify(context.Background(), NewEvent(EventResolved, &models.Alert{ID: "rule1:dev3"})))
+
+	require.Len(t, payloads, 3)
+	blocks, ok := payloads[0]["blocks"].([]interface{})
+	require.True(t, ok)
+	button := blocks[1].(map[string]interface{})["elements"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, SlackAcknowledgeAction, button["action_id"])
+	assert.Equal(t, "rule1:dev1", button["value"])
+	assert.NotContains(t, payloads[1], "blocks")
+	assert.NotContains(t, payloads[2], "blocks")
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload=%7B%7D")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	signature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.NoError(t, VerifySlackSignature("secret", timestamp, signature, body, now))
+	assert.ErrorIs(t, VerifySlackSignature("other", timestamp, signature, body, now), ErrInvalidSlackSignature)
+	assert.ErrorIs(t, VerifySlackSignature("secret", timestamp, signature, []byte("payload=x"), now), ErrInvalidSlackSignature)
+	assert.ErrorIs(t, VerifySlackSignature("secret", timestamp, signature, body, now.Add(10*time.Minute)), ErrInvalidSlackSignature)
+	assert.ErrorIs(t, VerifySlackSignature("secret", "yesterday", signature, body, now), ErrInvalidSlackSignature)
+}
@@ -0,0 +1,399 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+)
+
+// TwilioStatusPath is the path Twilio reports the delivery status of messages and calls to
+const TwilioStatusPath = "/api/integrations/twilio/status"
+
+// TwilioSignatureHeader is the header carrying the signature of Twilio requests
+const TwilioSignatureHeader = "X-Twilio-Signature"
+
+// Channels of the Twilio notifier
+const (
+	ChannelSMS   = "sms"
+	ChannelVoice = "voice"
+)
+
+// DefaultTwilioMaxPerHour is how many messages and calls a recipient is sent per hour by default
+const DefaultTwilioMaxPerHour = 10
+
+// twilioEndpoint is the base URL of the Twilio REST API
+const twilioEndpoint = "https://api.twilio.com"
+
+// maxSMSLength is the longest body Twilio accepts for a message
+const maxSMSLength = 1600
+
+// ErrInvalidTwilioSignature is returned for status callbacks that weren't signed with the account's auth token
+var ErrInvalidTwilioSignature = errors.New("invalid Twilio signature")
+
+// TwilioRecipient is a person alerts are texted and called at
+type TwilioRecipient struct {
+	Name       string
+	Phone      string      // E.164, e.g. +4915112345678
+	QuietHours *QuietHours // Nothing is sent during quiet hours, none when nil
+}
+
+// QuietHours is the time of day a recipient isn't texted or called, e.g. 22:00 to 07:00
+type QuietHours struct {
+	Start    string // HH:MM
+	End      string // HH:MM, before Start for quiet hours spanning midnight
+	Timezone string // IANA timezone, UTC when empty
+
+	start, end int // Minutes after midnight
+	location   *time.Location
+}
+
+// TwilioOptions configures the Twilio account and recipients of a Twilio notifier
+type TwilioOptions struct {
+	AccountSID string
+	AuthToken  string
+	From       string // Twilio phone number messages and calls come from
+	Recipients []TwilioRecipient
+	Severities []string // Severities of the alerts texted
+	CallEvents []string // Events recipients are also called for, e.g. "escalated"
+	MaxPerHour int      // Messages and calls per recipient and hour, DefaultTwilioMaxPerHour when zero
+	BaseURL    string   // URL Twilio reaches the gateway at for status callbacks, none when empty
+	Locale     string   // Locale messages are sent in, English when empty
+	Proxy      string   // Proxy URL for requests to Twilio, or ProxyDirect; the environment's proxy when empty
+}
+
+// TwilioNotifier texts alerts that need attention to its recipients, and calls them for the
+// configured events, such as escalations. Every attempt is recorded in the notification log, and
+// so are the status updates Twilio reports to TwilioStatusPath.
+type TwilioNotifier struct {
+	accountSID string
+	authToken  string
+	from       string
+	recipients []TwilioRecipient
+	severities map[string]bool
+	callEvents map[string]bool
+	maxPerHour int
+	baseURL    string
+	locale     string
+	log        *NotificationLog // Nil when deliveries aren't recorded
+	endpoint   string
+	client     *http.Client
+	now        func() time.Time
+
+	mu   sync.Mutex
+	sent map[string][]time.Time // Messages and calls of the last hour, by recipient phone
+}
+
+// NewTwilioNotifier creates a Twilio notifier
+func NewTwilioNotifier(opts TwilioOptions) (*TwilioNotifier, error) {
+	if opts.AccountSID == "" || opts.AuthToken == "" || opts.From == "" {
+		return nil, fmt.Errorf("twilio: accountSid, authToken and from are required")
+	}
+	if len(opts.Recipients) == 0 {
+		return nil, fmt.Errorf("twilio: at least one recipient is required")
+	}
+	recipients := make([]TwilioRecipient, len(opts.Recipients))
+	for i, recipient := range opts.Recipients {
+		if recipient.Phone == "" {
+			return nil, fmt.Errorf("twilio: recipient %q has no phone number", recipient.Name)
+		}
+		if recipient.QuietHours != nil {
+			quiet := *recipient.QuietHours
+			if err := quiet.parse(); err != nil {
+				return nil, fmt.Errorf("twilio: quiet hours of %q: %w", recipient.Name, err)
+			}
+			recipient.QuietHours = &quiet
+		}
+		recipients[i] = recipient
+	}
+	maxPerHour := opts.MaxPerHour
+	if maxPerHour == 0 {
+		maxPerHour = DefaultTwilioMaxPerHour
+	}
+
+	t := &TwilioNotifier{
+		accountSID: opts.AccountSID,
+		authToken:  opts.AuthToken,
+		from:       opts.From,
+		recipients: recipients,
+		severities: map[string]bool{},
+		callEvents: map[string]bool{},
+		maxPerHour: maxPerHour,
+		baseURL:    strings.TrimRight(opts.BaseURL, "/"),
+		locale:     opts.Locale,
+		endpoint:   twilioEndpoint,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		sent:       map[string][]time.Time{},
+	}
+	for _, severity := range opts.Severities {
+		t.severities[strings.ToLower(severity)] = true
+	}
+	for _, event := range opts.CallEvents {
+		t.callEvents[event] = true
+	}
+	transport, err := httpTransport(opts.Proxy, nil)
+	if err != nil {
+		return nil, fmt.Errorf("twilio: %w", err)
+	}
+	if transport != nil {
+		t.client.Transport = transport
+	}
+	return t, nil
+}
+
+// SetNotificationLog records each message and call, and the status updates Twilio reports, in log
+func (t *TwilioNotifier) SetNotificationLog(log *NotificationLog) {
+	t.log = log
+}
+
+// Name returns the notifier name
+func (t *TwilioNotifier) Name() string {
+	return "twilio"
+}
+
+// Notify texts the event to each recipient outside their quiet hours and below their hourly limit,
+// if its alert needs attention and has a texted severity, and calls them for the call events
+func (t *TwilioNotifier) Notify(ctx context.Context, event Event) error {
+	if !acknowledgeable(event) || !t.severities[strings.ToLower(string(event.Alert.Severity))] {
+		return nil
+	}
+	text := alertText(event.Localized(t.locale), i18n.Lookup(t.locale))
+	channels := []string{ChannelSMS}
+	if t.callEvents[event.Type] {
+		channels = append(channels, ChannelVoice)
+	}
+
+	var failed []string
+	for _, recipient := range t.recipients {
+		for _, channel := range channels {
+			record := DeliveryRecord{Notifier: t.Name(), Channel: channel, Recipient: recipient.label(),
+				AlertID: event.Alert.ID, Event: event.Type}
+			now := t.now()
+			switch {
+			case recipient.QuietHours != nil && recipient.QuietHours.contains(now):
+				record.Status, record.Detail = DeliverySuppressed, "quiet hours"
+			case !t.allow(recipient.Phone, now):
+				record.Status, record.Detail = DeliveryRateLimited, fmt.Sprintf("more than %d per hour", t.maxPerHour)
+			default:
+				sid, err := t.send(ctx, channel, recipient, record, text)
+				record.MessageID = sid
+				record.Status = DeliveryQueued
+				if err != nil {
+					record.Status, record.Detail = DeliveryFailed, err.Error()
+					failed = append(failed, fmt.Sprintf("%s to %s: %v", channel, recipient.label(), err))
+				}
+			}
+			t.record(ctx, record)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("twilio failed to notify %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// allow counts a message or call to a phone, unless it has been sent maxPerHour in the last hour
+func (t *TwilioNotifier) allow(phone string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recent := t.sent[phone][:0]
+	for _, at := range t.sent[phone] {
+		if now.Sub(at) < time.Hour {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= t.maxPerHour {
+		t.sent[phone] = recent
+		return false
+	}
+	t.sent[phone] = append(recent, now)
+	return true
+}
+
+// send texts or calls a recipient, returning the SID Twilio gave the message or call
+func (t *TwilioNotifier) send(ctx context.Context, channel string, recipient TwilioRecipient, record DeliveryRecord, text string) (string, error) {
+	form := url.Values{"To": {recipient.Phone}, "From": {t.from}}
+	resource := "Messages"
+	if channel == ChannelVoice {
+		resource = "Calls"
+		var say strings.Builder
+		_ = xml.EscapeText(&say, []byte(text))
+		form.Set("Twiml", fmt.Sprintf(`<Response><Say loop="2">%s</Say></Response>`, say.String()))
+	} else {
+		if runes := []rune(text); len(runes) > maxSMSLength {
+			text = string(runes[:maxSMSLength-1]) + "…"
+		}
+		form.Set("Body", text)
+	}
+	if t.baseURL != "" {
+		form.Set("StatusCallback", t.statusCallbackURL(record))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s.json", t.endpoint, url.PathEscape(t.accountSID), resource),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(data, &result)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("twilio returned status %d: %d %s", resp.StatusCode, result.Code, result.Message)
+	}
+	return result.SID, nil
+}
+
+// statusCallbackURL returns the URL Twilio reports the status of a message or call to, naming
+// what it was sent for so the status can be recorded against it
+func (t *TwilioNotifier) statusCallbackURL(record DeliveryRecord) string {
+	query := url.Values{
+		"alert_id":  {record.AlertID},
+		"event":     {record.Event},
+		"recipient": {record.Recipient},
+		"channel":   {record.Channel},
+	}
+	return t.baseURL + TwilioStatusPath + "?" + query.Encode()
+}
+
+// HandleStatusCallback records the status Twilio reports for a message or call. rawQuery is the
+// query of the callback URL, params its form, and signature the value of TwilioSignatureHeader.
+func (t *TwilioNotifier) HandleStatusCallback(ctx context.Context, rawQuery string, params url.Values, signature string) error {
+	if t.baseURL == "" {
+		return fmt.Errorf("%w: status callbacks aren't configured", ErrInvalidTwilioSignature)
+	}
+	callbackURL := t.baseURL + TwilioStatusPath
+	if rawQuery != "" {
+		callbackURL += "?" + rawQuery
+	}
+	if err := VerifyTwilioSignature(t.authToken, callbackURL, params, signature); err != nil {
+		return err
+	}
+
+	query, _ := url.ParseQuery(rawQuery)
+	record := DeliveryRecord{
+		Notifier:  t.Name(),
+		Channel:   query.Get("channel"),
+		Recipient: query.Get("recipient"),
+		AlertID:   query.Get("alert_id"),
+		Event:     query.Get("event"),
+		Status:    params.Get("MessageStatus"),
+		MessageID: params.Get("MessageSid"),
+	}
+	if record.Status == "" {
+		record.Status, record.MessageID = params.Get("CallStatus"), params.Get("CallSid")
+	}
+	if code := params.Get("ErrorCode"); code != "" {
+		record.Detail = "error " + code
+	}
+	t.record(ctx, record)
+	return nil
+}
+
+// record writes a delivery record to the notification log, if there is one
+func (t *TwilioNotifier) record(ctx context.Context, record DeliveryRecord) {
+	if t.log == nil {
+		return
+	}
+	if err := t.log.Record(ctx, record); err != nil {
+		logrus.Warnf("Failed to record %s to %s: %v", record.Channel, record.Recipient, err)
+	}
+}
+
+// VerifyTwilioSignature checks that a Twilio request to url with the form params was signed with
+// the account's auth token
+func VerifyTwilioSignature(authToken, url string, params url.Values, signature string) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(url))
+	for _, key := range keys {
+		for _, value := range params[key] {
+			mac.Write([]byte(key + value))
+		}
+	}
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidTwilioSignature)
+	}
+	return nil
+}
+
+// label returns how a recipient is named in the notification log, the phone number when unnamed
+func (r TwilioRecipient) label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Phone
+}
+
+// parse reads the start, end and timezone of quiet hours
+func (q *QuietHours) parse() error {
+	var err error
+	if q.start, err = minuteOfDay(q.Start); err != nil {
+		return err
+	}
+	if q.end, err = minuteOfDay(q.End); err != nil {
+		return err
+	}
+	q.location = time.UTC
+	if q.Timezone != "" {
+		if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", q.Timezone, err)
+		}
+	}
+	return nil
+}
+
+// contains reports whether t falls in the quiet hours
+func (q *QuietHours) contains(t time.Time) bool {
+	local := t.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// minuteOfDay parses an HH:MM time of day into minutes after midnight
+func minuteOfDay(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
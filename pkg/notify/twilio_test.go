@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// recordingStore keeps the rows inserted into streams
+type recordingStore struct {
+	timeplus.StreamStore
+	mu   sync.Mutex
+	rows []map[string]interface{}
+}
+
+func (s *recordingStore) CreateStream(ctx context.Context, name string, schema []timeplus.Column) error {
+	return nil
+}
+
+func (s *recordingStore) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := map[string]interface{}{}
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	s.rows = append(s.rows, row)
+	return nil
+}
+
+func (s *recordingStore) statuses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var statuses []string
+	for _, row := range s.rows {
+		statuses = append(statuses, row["recipient"].(string)+" "+row["channel"].(string)+" "+row["status"].(string))
+	}
+	return statuses
+}
+
+func TestTwilioNotifierTextsCallsAndRecordsDeliveries(t *testing.T) {
+	var requests []url.Values
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "token", password)
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		requests = append(requests, r.PostForm)
+		mu.Unlock()
+		if r.PostForm.Get("To") == "+15550000003" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/Calls.json") {
+			_, _ = w.Write([]byte(`{"sid":"CA1","status":"queued"}`))
+			return
+		}
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		_, _ = w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+	}))
+	defer server.Close()
+
+	// 23:30 in Berlin, during Bob's quiet hours
+	now := time.Date(2026, 3, 2, 22, 30, 0, 0, time.UTC)
+	twilio, err := NewTwilioNotifier(TwilioOptions{
+		AccountSID: "AC123", AuthToken: "token", From: "+15551234567",
+		Recipients: []TwilioRecipient{
+			{Name: "alice", Phone: "+15550000001"},
+			{Name: "bob", Phone: "+15550000002", QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}},
+			{Phone: "+15550000003"},
+		},
+		Severities: []string{"critical"},
+		CallEvents: []string{EventEscalated},
+		MaxPerHour: 2,
+		BaseURL:    "https://alerts.example.com/",
+	})
+	require.NoError(t, err)
+	store := &recordingStore{}
+	log, err := NewNotificationLog(context.Background(), store)
+	require.NoError(t, err)
+	twilio.SetNotificationLog(log)
+	twilio.endpoint = server.URL
+	twilio.now = func() time.Time { return now }
+
+	alert := &models.Alert{ID: "rule1:dev1:4", RuleName: "High temp", Severity: models.RuleSeverityCritical}
+	err = twilio.Notify(context.Background(), NewEvent(EventFired, alert))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid 'To' Phone Number")
+	assert.Equal(t, []string{"alice sms queued", "bob sms suppressed", "+15550000003 sms failed"}, store.statuses())
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[0].Get("Body"), "[CRITICAL] High temp (fired)")
+	callback, err := url.Parse(requests[0].Get("StatusCallback"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://alerts.example.com"+TwilioStatusPath, callback.Scheme+"://"+callback.Host+callback.Path)
+	assert.Equal(t, "rule1:dev1:4", callback.Query().Get("alert_id"))
+
+	// Escalations also call; the third message or call of the hour is rate limited, failed ones count
+	store.rows, requests = nil, nil
+	_ = twilio.Notify(context.Background(), NewEvent(EventEscalated, alert))
+	assert.Equal(t, []string{"alice sms queued", "alice voice rate_limited", "bob sms suppressed", "bob voice suppressed",
+		"+15550000003 sms failed", "+15550000003 voice rate_limited"}, store.statuses())
+	assert.Contains(t, requests[0].Get("Body"), "escalated")
+
+	// Warnings aren't texted
+	store.rows = nil
+	alert.Severity = models.RuleSeverityWarning
+	require.NoError(t, twilio.Notify(context.Background(), NewEvent(EventFired, alert)))
+	assert.Empty(t, store.statuses())
+}
+
+func TestTwilioStatusCallbackIsVerifiedAndRecorded(t *testing.T) {
+	twilio, err := NewTwilioNotifier(TwilioOptions{AccountSID: "AC123", AuthToken: "token", From: "+15551234567",
+		Recipients: []TwilioRecipient{{Name: "alice", Phone: "+15550000001"}}, BaseURL: "https://alerts.example.com"})
+	require.NoError(t, err)
+	store := &recordingStore{}
+	log, err := NewNotificationLog(context.Background(), store)
+	require.NoError(t, err)
+	twilio.SetNotificationLog(log)
+
+	rawQuery := "alert_id=rule1%3Adev1%3A4&channel=sms&event=fired&recipient=alice"
+	params := url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}, "AccountSid": {"AC123"}}
+	// Signed as Twilio documents it: the URL followed by each parameter, sorted by name
+	mac := hmac.New(sha1.New, []byte("token"))
+	mac.Write([]byte("https://alerts.example.com" + TwilioStatusPath + "?" + rawQuery +
+		"AccountSidAC123MessageSidSM1MessageStatusdelivered"))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	assert.ErrorIs(t, twilio.HandleStatusCallback(context.Background(), rawQuery, params, "bogus"), ErrInvalidTwilioSignature)
+	assert.ErrorIs(t, twilio.HandleStatusCallback(context.Background(), "alert_id=other", params, signature), ErrInvalidTwilioSignature)
+	assert.Empty(t, store.rows)
+
+	require.NoError(t, twilio.HandleStatusCallback(context.Background(), rawQuery, params, signature))
+	require.Len(t, store.rows, 1)
+	assert.Equal(t, "rule1:dev1:4", store.rows[0]["alert_id"])
+	assert.Equal(t, "delivered", store.rows[0]["status"])
+	assert.Equal(t, "SM1", store.rows[0]["message_id"])
+	assert.Equal(t, "alice", store.rows[0]["recipient"])
+}
+
+func TestQuietHours(t *testing.T) {
+	overnight := &QuietHours{Start: "22:00", End: "07:00"}
+	require.NoError(t, overnight.parse())
+	assert.True(t, overnight.contains(time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, overnight.contains(time.Date(2026, 3, 2, 6, 59, 0, 0, time.UTC)))
+	assert.False(t, overnight.contains(time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)))
+
+	lunch := &QuietHours{Start: "12:00", End: "13:00", Timezone: "Asia/Tokyo"}
+	require.NoError(t, lunch.parse())
+	assert.True(t, lunch.contains(time.Date(2026, 3, 2, 3, 30, 0, 0, time.UTC)))
+	assert.False(t, lunch.contains(time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)))
+
+	assert.Error(t, (&QuietHours{Start: "25:00", End: "07:00"}).parse())
+	assert.Error(t, (&QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}).parse())
+}
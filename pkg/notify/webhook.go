@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Headers set on signed webhook requests
+const (
+	SignatureHeader = "X-Alert-Gateway-Signature" // "sha256=" + hex HMAC-SHA256 of timestamp + "." + body
+	TimestampHeader = "X-Alert-Gateway-Timestamp" // Unix seconds the request was signed at
+)
+
+// EventIDHeader carries the ID of events recorded in the notification outbox, so receivers can drop
+// an event delivered again
+const EventIDHeader = "X-Alert-Gateway-Event-ID"
+
+// WebhookOptions configures how a webhook notifier authenticates to its target
+type WebhookOptions struct {
+	Secret   string // Shared secret signing each payload with HMAC-SHA256, unsigned when empty
+	CertFile string // Client certificate presented for mutual TLS, with KeyFile
+	KeyFile  string
+	CAFile   string // CA bundle verifying the target's certificate, system roots when empty
+	Proxy    string // Proxy URL for requests to the target, or ProxyDirect; the environment's proxy when empty
+	Locale   string // Locale messages are sent in, English when empty
+}
+
+// WebhookNotifier posts events as JSON to an HTTP endpoint
+type WebhookNotifier struct {
+	url    string
+	secret string
+	locale string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a webhook notifier for the given URL
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewWebhookNotifierWithOptions creates a webhook notifier that signs its payloads and presents a
+// client certificate as configured, so the target can authenticate the gateway, and that connects
+// through the configured proxy
+func NewWebhookNotifierWithOptions(url string, opts WebhookOptions) (*WebhookNotifier, error) {
+	w := NewWebhookNotifier(url)
+	w.secret = opts.Secret
+	w.locale = opts.Locale
+
+	tlsConfig, err := webhookTLSConfig(opts)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", url, err)
+	}
+	transport, err := httpTransport(opts.Proxy, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", url, err)
+	}
+	if transport != nil {
+		w.client.Transport = transport
+	}
+	return w, nil
+}
+
+// webhookTLSConfig loads the client certificate and CA bundle of a webhook, nil when it has neither
+func webhookTLSConfig(opts WebhookOptions) (*tls.Config, error) {
+	if opts.CertFile == "" && opts.KeyFile == "" && opts.CAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate requires both certFile and keyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// SignPayload returns the signature header value of a webhook body signed at timestamp (Unix
+// seconds). Receivers recompute it with their copy of the secret to authenticate a request.
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Name returns the notifier name
+func (w *WebhookNotifier) Name() string {
+	return "webhook:" + w.url
+}
+
+// Notify posts the event to the webhook URL
+func (w *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event.Localized(w.locale))
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if event.ID != "" {
+		req.Header.Set(EventIDHeader, event.ID)
+	}
+	if w.secret != "" {
+		// The timestamp is signed too, so receivers can reject replayed requests
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, SignPayload(w.secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook %s: %w", w.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", w.url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestWebhookSignsPayload(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhookNotifierWithOptions(server.URL, WebhookOptions{Secret: "s3cret"})
+	require.NoError(t, err)
+	require.NoError(t, webhook.Notify(context.Background(), NewEvent(EventFired, &models.Alert{ID: "rule1:dev1"})))
+
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, SignPayload("s3cret", timestamp, body), header.Get(SignatureHeader))
+	assert.NotEqual(t, SignPayload("other", timestamp, body), header.Get(SignatureHeader))
+}
+
+func TestWebhookUnsignedWithoutSecret(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewWebhookNotifier(server.URL).Notify(context.Background(), NewEvent(EventFired, &models.Alert{})))
+	assert.Empty(t, header.Get(SignatureHeader))
+	assert.Empty(t, header.Get(TimestampHeader))
+}
+
+func TestSignPayload(t *testing.T) {
+	// HMAC-SHA256 of "1700000000.{}" with key "key", as computed by openssl dgst -sha256 -hmac key
+	assert.Equal(t, "sha256=9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae", SignPayload("key", 1700000000, []byte("{}")))
+}
+
+// writeCert creates a self-signed certificate usable by both servers and clients, returning the
+// paths of its PEM certificate and key
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return certFile, keyFile, cert
+}
+
+func TestWebhookPresentsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	serverCertFile, _, serverCert := writeCert(t, dir, "server")
+	clientCertFile, clientKeyFile, clientCert := writeCert(t, dir, "gateway")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	var clientName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // The refused handshake below is expected
+	server.StartTLS()
+	defer server.Close()
+
+	event := NewEvent(EventFired, &models.Alert{ID: "rule1:dev1"})
+
+	webhook, err := NewWebhookNotifierWithOptions(server.URL, WebhookOptions{
+		CertFile: clientCertFile,
+		KeyFile:  clientKeyFile,
+		CAFile:   serverCertFile,
+	})
+	require.NoError(t, err)
+	require.NoError(t, webhook.Notify(context.Background(), event))
+	assert.Equal(t, "gateway", clientName)
+
+	// Without a client certificate the server refuses the connection
+	anonymous, err := NewWebhookNotifierWithOptions(server.URL, WebhookOptions{CAFile: serverCertFile})
+	require.NoError(t, err)
+	assert.Error(t, anonymous.Notify(context.Background(), event))
+}
+
+func TestWebhookOptionsErrors(t *testing.T) {
+	_, err := NewWebhookNotifierWithOptions("https://example.invalid", WebhookOptions{CertFile: "client.crt"})
+	assert.ErrorContains(t, err, "requires both certFile and keyFile")
+
+	_, err = NewWebhookNotifierWithOptions("https://example.invalid", WebhookOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.ErrorContains(t, err, "failed to read CA file")
+}
@@ -0,0 +1,155 @@
+// Package script evaluates the expressions rules filter and modify their alerts with in the gateway.
+// Expressions are written in expr-lang (https://expr-lang.org): variables and their fields
+// (data.host or data["host"]), arithmetic, comparisons, && || ! (or and, or, not), in, contains,
+// startsWith, endsWith, matches, cond ? a : b, and its builtin functions such as lower(), len() and
+// string(). Programs are compiled once and reused for every alert.
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Program is a compiled expression, safe for concurrent use
+type Program struct {
+	source  string
+	program *vm.Program
+}
+
+// Compile parses an expression, checking its syntax and the functions it calls
+func Compile(source string) (*Program, error) {
+	calls := &callFinder{}
+	program, err := expr.Compile(source, expr.AllowUndefinedVariables(), expr.Patch(calls))
+	if err != nil {
+		return nil, err
+	}
+	if calls.unknown != "" {
+		return nil, fmt.Errorf("unknown function %s()", calls.unknown)
+	}
+	return &Program{source: source, program: program}, nil
+}
+
+// String returns the source of the expression
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the expression. Variables missing from env are nil.
+func (p *Program) Eval(env map[string]interface{}) (interface{}, error) {
+	if env == nil {
+		env = map[string]interface{}{}
+	}
+	return expr.Run(p.program, normalize(env))
+}
+
+// EvalBool evaluates an expression that must return a boolean
+func (p *Program) EvalBool(env map[string]interface{}) (bool, error) {
+	value, err := p.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, expected a boolean", typeName(value))
+	}
+	return b, nil
+}
+
+// EvalString evaluates an expression that must return a string
+func (p *Program) EvalString(env map[string]interface{}) (string, error) {
+	value, err := p.Eval(env)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expression returned %s, expected a string", typeName(value))
+	}
+	return s, nil
+}
+
+// callFinder records the first call to something other than a builtin function. expr-lang parses
+// builtins into their own nodes and would only fail on other calls when they run.
+type callFinder struct {
+	unknown string
+}
+
+func (f *callFinder) Visit(node *ast.Node) {
+	if call, ok := (*node).(*ast.CallNode); ok && f.unknown == "" {
+		f.unknown = call.Callee.String()
+	}
+}
+
+// normalize converts the values found in alert data to the types expressions work with:
+// json.Number becomes an int when it is whole, a float64 otherwise. Maps and lists holding one are
+// copied, so the alert's data is left as it is.
+func normalize(env map[string]interface{}) map[string]interface{} {
+	normalized, _ := normalizeValue(env)
+	return normalized.(map[string]interface{})
+}
+
+// normalizeValue returns value normalized, and whether that changed it
+func normalizeValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i), true
+		}
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+		return v.String(), true
+	case map[string]interface{}:
+		var copied map[string]interface{}
+		for k, item := range v {
+			if n, changed := normalizeValue(item); changed {
+				if copied == nil {
+					copied = make(map[string]interface{}, len(v))
+					for key, original := range v {
+						copied[key] = original
+					}
+				}
+				copied[k] = n
+			}
+		}
+		if copied != nil {
+			return copied, true
+		}
+	case []interface{}:
+		var copied []interface{}
+		for i, item := range v {
+			if n, changed := normalizeValue(item); changed {
+				if copied == nil {
+					copied = append([]interface{}(nil), v...)
+				}
+				copied[i] = n
+			}
+		}
+		if copied != nil {
+			return copied, true
+		}
+	}
+	return value, false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "a boolean"
+	case int, float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,115 @@
+package script
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	env := map[string]interface{}{
+		"severity": "critical",
+		"data": map[string]interface{}{
+			"host":  "db-01.prod",
+			"cpu":   json.Number("97.5"),
+			"count": 3,
+			"tags":  []interface{}{"db", "primary"},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		want       interface{}
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"-data.count + 10 % 4", -1},
+		{"'a' + \"b\"", "ab"},
+		{"data.cpu > 90 && severity == 'critical'", true},
+		{"data.cpu > 90 and not (data.count >= 3)", false},
+		{"data.missing == nil || false", true},
+		{"data.missing != nil && data.missing.field > 1", false},
+		{"data['host'] in ['db-01.prod', 'db-02.prod']", true},
+		{"'primary' in data.tags", true},
+		{"'replica' not in data.tags", true},
+		{"data.host contains 'prod'", true},
+		{"'host' in data", true},
+		{"data.tags[1]", "primary"},
+		{"data.cpu / 2", 48.75},
+		{"data.host endsWith '.prod' ? 'production' : 'other'", "production"},
+		{"data.host matches '^db-[0-9]+'", true},
+		{"upper(trim(' x ')) + string(len(data.tags))", "X2"},
+		{"float('4.5') + abs(-1)", 5.5},
+		{"lower('ABC') startsWith 'a' && 'abc' contains 'b'", true},
+		{"'b' < 'c' && 2 <= 2 && 3 != 4", true},
+	}
+	for _, tt := range tests {
+		program, err := Compile(tt.expression)
+		require.NoError(t, err, tt.expression)
+		got, err := program.Eval(env)
+		require.NoError(t, err, tt.expression)
+		assert.Equal(t, tt.want, got, tt.expression)
+	}
+	assert.Equal(t, json.Number("97.5"), env["data"].(map[string]interface{})["cpu"], "alert data isn't modified")
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"1 +",
+		"(1",
+		"'unterminated",
+		"a ? b",
+		"data.",
+		"unknown(1)",
+		"lower('a', 'b')",
+		"1 2",
+		"a # b",
+		"name matches '['",
+		"contains(name, 'x')",
+		"data.host.startsWith('x')",
+	} {
+		_, err := Compile(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := map[string]interface{}{"name": "x", "n": 1, "pattern": "[", "tags": []interface{}{"db"}}
+	for _, expression := range []string{
+		"tags[5]",
+		"name - 1",
+		"n % 0",
+		"name < 1",
+		"n.field",
+		"name matches pattern",
+		"n matches 'x'",
+		"float(name)",
+	} {
+		program, err := Compile(expression)
+		require.NoError(t, err, expression)
+		_, err = program.Eval(env)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestEvalBoolAndString(t *testing.T) {
+	program, err := Compile("n > 1")
+	require.NoError(t, err)
+	matched, err := program.EvalBool(map[string]interface{}{"n": int64(2)})
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	_, err = program.EvalString(nil)
+	assert.Error(t, err, "nil > 1 isn't a valid comparison")
+
+	program, err = Compile("'x'")
+	require.NoError(t, err)
+	_, err = program.EvalBool(nil)
+	assert.Error(t, err)
+	s, err := program.EvalString(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "x", s)
+}
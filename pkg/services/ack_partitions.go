@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// viewTargetPattern finds the stream a CREATE MATERIALIZED VIEW statement writes into
+var viewTargetPattern = regexp.MustCompile("(?i)\\bINTO\\s+(?:`?[A-Za-z0-9_]+`?\\.)?`?([A-Za-z0-9_]+)`?")
+
+// AckPartitionMove is a rule moved to the alert acks partition it is routed to
+type AckPartitionMove struct {
+	RuleID    string `json:"ruleId"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Restarted bool   `json:"restarted,omitempty"` // The rule's views were recreated against the new partition
+	Error     string `json:"error,omitempty"`
+}
+
+// AckPartitionRebalance is the result of rebalancing the partitions of the shared alert acks stream
+type AckPartitionRebalance struct {
+	Partitions int                `json:"partitions"`
+	Moved      []AckPartitionMove `json:"moved"`
+	Dropped    []string           `json:"dropped,omitempty"` // Partitions beyond the configured number, dropped once empty
+}
+
+// RebalanceAckPartitions moves the alerts of rules on the shared alert acks stream to the partition
+// they are routed to, after the number of partitions changed. Running rules whose views write to
+// another partition are restarted against theirs. Partitions beyond the configured number are
+// dropped once no alerts are left in them; alerts of deleted rules keep them.
+func (s *RuleService) RebalanceAckPartitions(ctx context.Context) (*AckPartitionRebalance, error) {
+	done, err := s.trackTask("rebalance alert acks partitions")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := s.tpClient.ListStreams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+	var partitions []string
+	for _, stream := range streams {
+		if timeplus.IsAlertAcksPartition(stream) {
+			partitions = append(partitions, stream)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return timeplus.AlertAcksPartitionIndex(partitions[i]) < timeplus.AlertAcksPartitionIndex(partitions[j])
+	})
+
+	// The partitions each rule has alerts in
+	found := make(map[string][]string)
+	for _, stream := range partitions {
+		rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT DISTINCT rule_id FROM table(`%s`)", stream))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules in alert acks partition %s: %w", stream, err)
+		}
+		for _, row := range rows {
+			ruleID := getString(row, "rule_id")
+			found[ruleID] = append(found[ruleID], stream)
+		}
+	}
+
+	result := &AckPartitionRebalance{Partitions: timeplus.AlertAcksPartitions(), Moved: []AckPartitionMove{}}
+	for _, rule := range rules {
+		res := getRuleResources(rule)
+		if res.DedicatedAcksStream {
+			continue
+		}
+
+		var misplaced []string
+		for _, stream := range found[rule.ID] {
+			if stream != res.AlertAcksStream {
+				misplaced = append(misplaced, stream)
+			}
+		}
+		viewTarget := ""
+		if ruleEvaluating(rule) {
+			if target := s.ruleViewTarget(ctx, res); timeplus.IsAlertAcksPartition(target) && target != res.AlertAcksStream {
+				viewTarget = target
+			}
+		}
+		if len(misplaced) == 0 && viewTarget == "" {
+			continue
+		}
+
+		result.Moved = append(result.Moved, s.moveRuleAckPartition(ctx, rule, res.AlertAcksStream, misplaced, viewTarget)...)
+	}
+
+	for _, stream := range partitions {
+		if timeplus.AlertAcksPartitionIndex(stream) < timeplus.AlertAcksPartitions() {
+			continue
+		}
+		rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS count FROM table(`%s`)", stream))
+		if err != nil {
+			logrus.Warnf("ACK_PARTITIONS: Failed to count alerts left in %s: %v", stream, err)
+			continue
+		}
+		if len(rows) > 0 && getInt64(rows[0], "count") > 0 {
+			logrus.Warnf("ACK_PARTITIONS: Keeping %s, it still holds %d alerts", stream, getInt64(rows[0], "count"))
+			continue
+		}
+		if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DROP STREAM IF EXISTS `%s`", stream)); err != nil {
+			logrus.Warnf("ACK_PARTITIONS: Failed to drop %s: %v", stream, err)
+			continue
+		}
+		result.Dropped = append(result.Dropped, stream)
+	}
+
+	logrus.Infof("ACK_PARTITIONS: Rebalanced %d partitions, moved %d rule partitions, dropped %d streams",
+		result.Partitions, len(result.Moved), len(result.Dropped))
+	return result, nil
+}
+
+// ruleViewTarget returns the stream a rule's materialized view writes its alerts into, or "" when
+// the view can't be read
+func (s *RuleService) ruleViewTarget(ctx context.Context, res ruleResources) string {
+	ddl, err := s.showCreate(ctx, RuleArtifact{Kind: "materialized_view", Name: res.MaterializedView})
+	if err != nil {
+		logrus.Warnf("ACK_PARTITIONS: Failed to read materialized view %s: %v", res.MaterializedView, err)
+		return ""
+	}
+	if match := viewTargetPattern.FindStringSubmatch(ddl); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// moveRuleAckPartition copies a rule's alerts from the partitions they're misplaced in to the one
+// it is routed to and removes them from the old ones. When the rule's views write to another
+// partition, they are dropped while the alerts are copied and recreated by restarting the rule.
+func (s *RuleService) moveRuleAckPartition(ctx context.Context, rule *models.Rule, target string, misplaced []string, viewTarget string) []AckPartitionMove {
+	sources := misplaced
+	if viewTarget != "" && !slices.Contains(misplaced, viewTarget) {
+		sources = append(sources, viewTarget)
+	}
+	moves := make([]AckPartitionMove, len(sources))
+	for i, source := range sources {
+		moves[i] = AckPartitionMove{RuleID: rule.ID, From: source, To: target}
+	}
+	fail := func(err error) []AckPartitionMove {
+		for i := range moves {
+			if moves[i].Error == "" {
+				moves[i].Error = err.Error()
+			}
+		}
+		return moves
+	}
+
+	logrus.Infof("ACK_PARTITIONS: Moving rule %s from %s to %s", rule.ID, strings.Join(sources, ", "), target)
+
+	if viewTarget != "" {
+		s.monitorRuleStopped(rule.ID)
+		for _, drop := range ruleDropStatements(rule, false) {
+			if err := s.tpClient.ExecuteDDL(ctx, drop); err != nil {
+				return fail(s.restartAfterFailedMigration(ctx, rule, fmt.Errorf("failed to drop views of rule %s: %w", rule.ID, err)))
+			}
+		}
+	}
+
+	for i := range moves {
+		if !slices.Contains(misplaced, moves[i].From) {
+			continue
+		}
+		if err := s.tpClient.ExecuteDDL(ctx, copyAlertAcksStatement(rule.ID, moves[i].From, target)); err != nil {
+			moves[i].Error = fmt.Sprintf("failed to copy alerts: %v", err)
+			continue
+		}
+		cleanup := fmt.Sprintf("DELETE FROM `%s` WHERE rule_id = '%s'", moves[i].From, strings.ReplaceAll(rule.ID, "'", "''"))
+		if err := s.tpClient.ExecuteDDL(ctx, cleanup); err != nil {
+			moves[i].Error = fmt.Sprintf("alerts were copied but not removed from %s: %v", moves[i].From, err)
+		}
+	}
+
+	if viewTarget != "" {
+		rule.Status = models.RuleStatusStarting
+		rule.LastError = "Rebalancing alert acks partitions"
+		rule.UpdatedAt = time.Now()
+		if err := s.persistRule(ctx, rule, true); err != nil {
+			return fail(fmt.Errorf("failed to update rule %s: %w", rule.ID, err))
+		}
+		if err := s.StartRule(ctx, rule.ID); err != nil {
+			return fail(fmt.Errorf("failed to restart rule %s on %s: %w", rule.ID, target, err))
+		}
+		for i := range moves {
+			moves[i].Restarted = true
+		}
+	}
+	return moves
+}
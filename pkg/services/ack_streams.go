@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// AckStreamInfo describes an alert acks stream and the alerts in it
+type AckStreamInfo struct {
+	Name      string           `json:"name"`
+	Dedicated bool             `json:"dedicated"`
+	Exists    bool             `json:"exists"`
+	RuleIDs   []string         `json:"ruleIds"`          // Rules writing their alerts to the stream
+	Alerts    int64            `json:"alerts"`           // Alert rows, of the inspected rule only when inspecting a rule
+	States    map[string]int64 `json:"states,omitempty"` // Alert rows by state
+	Oldest    *time.Time       `json:"oldestUpdate,omitempty"`
+	Newest    *time.Time       `json:"newestUpdate,omitempty"`
+	DDL       string           `json:"ddl,omitempty"`
+	Error     string           `json:"error,omitempty"` // Why the alerts couldn't be counted
+}
+
+// AckStreamMigration moves a rule between the shared alert acks stream and a dedicated one
+type AckStreamMigration struct {
+	Dedicated  bool   `json:"dedicated"`            // Move to a dedicated stream, or back to the shared one
+	StreamName string `json:"streamName,omitempty"` // Name of the dedicated stream, generated when empty
+	KeepSource bool   `json:"keepSource,omitempty"` // Leave the rule's alerts in the stream it moves from
+}
+
+// AckStreamCompaction is the result of compacting a rule's alerts
+type AckStreamCompaction struct {
+	RuleID  string    `json:"ruleId"`
+	Stream  string    `json:"stream"`
+	Removed int64     `json:"removed"` // Resolved alerts deleted
+	Before  time.Time `json:"before"`  // Only alerts resolved before this time were deleted
+}
+
+// ListAckStreams returns the partitions of the shared alert acks stream and every dedicated one,
+// with the rules writing to each and their alert counts
+func (s *RuleService) ListAckStreams(ctx context.Context) ([]AckStreamInfo, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.loadTimeplusInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*AckStreamInfo{}
+	for _, stream := range timeplus.AlertAcksStreams() {
+		byName[stream] = &AckStreamInfo{Name: stream, RuleIDs: []string{}}
+	}
+	for _, rule := range rules {
+		res := getRuleResources(rule)
+		info, ok := byName[res.AlertAcksStream]
+		if !ok {
+			info = &AckStreamInfo{Name: res.AlertAcksStream, Dedicated: res.DedicatedAcksStream, RuleIDs: []string{}}
+			byName[res.AlertAcksStream] = info
+		}
+		info.RuleIDs = append(info.RuleIDs, rule.ID)
+	}
+
+	streams := make([]AckStreamInfo, 0, len(byName))
+	for _, info := range byName {
+		info.Exists = inv.streams[info.Name]
+		if info.Exists {
+			s.countAckStreamAlerts(ctx, info, "")
+		}
+		streams = append(streams, *info)
+	}
+	// Shared partitions first, then dedicated streams by name
+	sort.Slice(streams, func(i, j int) bool {
+		if streams[i].Dedicated != streams[j].Dedicated {
+			return !streams[i].Dedicated
+		}
+		return streams[i].Name < streams[j].Name
+	})
+	return streams, nil
+}
+
+// GetRuleAckStream returns the alert acks stream a rule writes to, with the rule's alerts in it
+// and the stream's DDL
+func (s *RuleService) GetRuleAckStream(ctx context.Context, ruleID string) (*AckStreamInfo, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	res := getRuleResources(rule)
+
+	info := &AckStreamInfo{Name: res.AlertAcksStream, Dedicated: res.DedicatedAcksStream, RuleIDs: []string{}}
+	if info.Exists, err = s.tpClient.StreamExists(ctx, info.Name); err != nil {
+		return nil, fmt.Errorf("failed to check alert acks stream %s: %w", info.Name, err)
+	}
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if getRuleResources(r).AlertAcksStream == info.Name {
+			info.RuleIDs = append(info.RuleIDs, r.ID)
+		}
+	}
+
+	if info.Exists {
+		s.countAckStreamAlerts(ctx, info, rule.ID)
+		if info.DDL, err = s.showCreate(ctx, RuleArtifact{Kind: "stream", Name: info.Name}); err != nil {
+			logrus.Warnf("Failed to read DDL of alert acks stream %s: %v", info.Name, err)
+		}
+	}
+	return info, nil
+}
+
+// countAckStreamAlerts fills in the alert counts of a stream, limited to one rule unless ruleID is
+// empty. Failures are recorded on the info rather than returned, so listings still show the stream.
+func (s *RuleService) countAckStreamAlerts(ctx context.Context, info *AckStreamInfo, ruleID string) {
+	where := ""
+	if ruleID != "" {
+		where = fmt.Sprintf("WHERE rule_id = '%s'", strings.ReplaceAll(ruleID, "'", "''"))
+	}
+	results, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT state, count() AS alerts, min(updated_at) AS oldest, max(updated_at) AS newest FROM table(`%s`) %s GROUP BY state",
+		info.Name, where))
+	if err != nil {
+		logrus.Warnf("Failed to count alerts in %s: %v", info.Name, err)
+		info.Error = err.Error()
+		return
+	}
+
+	info.States = make(map[string]int64, len(results))
+	for _, row := range results {
+		count := getInt64(row, "alerts")
+		info.States[getString(row, "state")] = count
+		info.Alerts += count
+		if oldest := getTime(row, "oldest"); !oldest.IsZero() && (info.Oldest == nil || oldest.Before(*info.Oldest)) {
+			info.Oldest = &oldest
+		}
+		if newest := getTime(row, "newest"); !newest.IsZero() && (info.Newest == nil || newest.After(*info.Newest)) {
+			info.Newest = &newest
+		}
+	}
+}
+
+// CompactRuleAckStream deletes a rule's alerts that were resolved longer than olderThan ago from its
+// alert acks stream. Active, acknowledged and silenced alerts are kept.
+func (s *RuleService) CompactRuleAckStream(ctx context.Context, ruleID string, olderThan time.Duration) (*AckStreamCompaction, error) {
+	if olderThan <= 0 {
+		return nil, fmt.Errorf("%w: olderThan must be positive", ErrInvalidRule)
+	}
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	res := getRuleResources(rule)
+
+	result := &AckStreamCompaction{RuleID: rule.ID, Stream: res.AlertAcksStream, Before: time.Now().Add(-olderThan).UTC()}
+	where := fmt.Sprintf("rule_id = '%s' AND state = '%s' AND updated_at < %s",
+		strings.ReplaceAll(rule.ID, "'", "''"), timeplus.AlertStateResolved, timeplus.DateTime64(result.Before))
+
+	results, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS alerts FROM table(`%s`) WHERE %s", res.AlertAcksStream, where))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count resolved alerts of rule %s: %w", rule.ID, err)
+	}
+	if len(results) > 0 {
+		result.Removed = getInt64(results[0], "alerts")
+	}
+	if result.Removed == 0 {
+		return result, nil
+	}
+
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE %s", res.AlertAcksStream, where)); err != nil {
+		return nil, fmt.Errorf("failed to delete resolved alerts of rule %s: %w", rule.ID, err)
+	}
+	logrus.Infof("Compacted %d resolved alerts of rule %s from %s", result.Removed, rule.ID, res.AlertAcksStream)
+	return result, nil
+}
+
+// MigrateRuleAckStream moves a rule to a dedicated alert acks stream or back to the shared one,
+// copying its alerts so their acknowledgements are kept. A running rule's materialized views are
+// dropped while the alerts are copied and recreated against the new stream. Unless KeepSource is
+// set, the rule's alerts are then removed from the old stream, and a dedicated one is dropped.
+func (s *RuleService) MigrateRuleAckStream(ctx context.Context, ruleID string, migration AckStreamMigration) (*AckStreamInfo, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	source := getRuleResources(rule)
+
+	migrated := *rule
+	migrated.DedicatedAlertAcksStream = &migration.Dedicated
+	migrated.AlertAcksStreamName = ""
+	if migration.Dedicated {
+		name := strings.TrimSpace(migration.StreamName)
+		if name != "" && (!identifierPattern.MatchString(name) || timeplus.IsAlertAcksPartition(name)) {
+			return nil, fmt.Errorf("%w: invalid dedicated alert acks stream name %q", ErrInvalidRule, name)
+		}
+		migrated.AlertAcksStreamName = name
+	}
+	target := getRuleResources(&migrated)
+	if target.AlertAcksStream == source.AlertAcksStream {
+		return nil, fmt.Errorf("%w: rule %s already uses alert acks stream %s", ErrInvalidRule, rule.ID, source.AlertAcksStream)
+	}
+
+	logrus.Infof("ACK_STREAM_MIGRATION: Moving rule %s from %s to %s", rule.ID, source.AlertAcksStream, target.AlertAcksStream)
+
+	// Stop the rule's materialized views writing to the old stream while its alerts are copied
+	running := ruleEvaluating(rule)
+	if running {
+		s.monitorRuleStopped(rule.ID)
+		for _, drop := range ruleDropStatements(rule, false) {
+			if err := s.tpClient.ExecuteDDL(ctx, drop); err != nil {
+				return nil, s.restartAfterFailedMigration(ctx, rule, fmt.Errorf("failed to drop views of rule %s: %w", rule.ID, err))
+			}
+		}
+	}
+
+	if target.DedicatedAcksStream {
+		if err := s.ensureDedicatedAcksStream(ctx, target.AlertAcksStream); err != nil {
+			return nil, s.restartAfterFailedMigration(ctx, rule, err)
+		}
+	}
+
+	sourceExists, err := s.tpClient.StreamExists(ctx, source.AlertAcksStream)
+	if err != nil {
+		return nil, s.restartAfterFailedMigration(ctx, rule, fmt.Errorf("failed to check alert acks stream %s: %w", source.AlertAcksStream, err))
+	}
+	if sourceExists {
+		if err := s.tpClient.ExecuteDDL(ctx, copyAlertAcksStatement(rule.ID, source.AlertAcksStream, target.AlertAcksStream)); err != nil {
+			return nil, s.restartAfterFailedMigration(ctx, rule, fmt.Errorf("failed to copy alerts of rule %s: %w", rule.ID, err))
+		}
+	}
+
+	// StartRule only recreates the views of a rule that isn't running
+	if running {
+		migrated.Status = models.RuleStatusStarting
+		migrated.LastError = "Migrating alert acks stream"
+	}
+	migrated.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, &migrated, true); err != nil {
+		return nil, s.restartAfterFailedMigration(ctx, rule, fmt.Errorf("failed to update rule %s: %w", rule.ID, err))
+	}
+	if running {
+		if err := s.StartRule(ctx, rule.ID); err != nil {
+			return nil, fmt.Errorf("failed to restart rule %s on alert acks stream %s: %w", rule.ID, target.AlertAcksStream, err)
+		}
+	}
+
+	if !migration.KeepSource && sourceExists {
+		cleanup := fmt.Sprintf("DELETE FROM `%s` WHERE rule_id = '%s'", source.AlertAcksStream, strings.ReplaceAll(rule.ID, "'", "''"))
+		if source.DedicatedAcksStream {
+			cleanup = fmt.Sprintf("DROP STREAM IF EXISTS `%s`", source.AlertAcksStream)
+		}
+		// The move itself succeeded, so a failed cleanup only leaves stale rows behind
+		if err := s.tpClient.ExecuteDDL(ctx, cleanup); err != nil {
+			logrus.Warnf("ACK_STREAM_MIGRATION: Failed to clean up %s after moving rule %s: %v", source.AlertAcksStream, rule.ID, err)
+		}
+	}
+
+	logrus.Infof("ACK_STREAM_MIGRATION: Moved rule %s to %s", rule.ID, target.AlertAcksStream)
+	return s.GetRuleAckStream(ctx, rule.ID)
+}
+
+// restartAfterFailedMigration restarts a running rule on its original alert acks stream after a
+// migration failed part way, and returns the migration error
+func (s *RuleService) restartAfterFailedMigration(ctx context.Context, rule *models.Rule, migrationErr error) error {
+	if !ruleEvaluating(rule) {
+		return migrationErr
+	}
+	rule.Status = models.RuleStatusStarting
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		logrus.Errorf("ACK_STREAM_MIGRATION: Failed to reset rule %s after a failed migration: %v", rule.ID, err)
+		return migrationErr
+	}
+	if err := s.StartRule(ctx, rule.ID); err != nil {
+		logrus.Errorf("ACK_STREAM_MIGRATION: Failed to restart rule %s after a failed migration: %v", rule.ID, err)
+	}
+	return migrationErr
+}
+
+// ensureDedicatedAcksStream creates a rule's dedicated alert acks stream if it doesn't exist and
+// adds columns missing from streams created by older versions
+func (s *RuleService) ensureDedicatedAcksStream(ctx context.Context, streamName string) error {
+	logrus.Infof("Ensuring dedicated alert acks stream exists: %s", streamName)
+	if err := s.tpClient.EnsureMutableStream(ctx, streamName, timeplus.GetMutableAlertAcksSchema(), []string{"rule_id", "entity_id"}); err != nil {
+		return fmt.Errorf("failed to ensure dedicated mutable alert acks stream %s: %w", streamName, err)
+	}
+	// Streams created by older versions may lack columns the materialized view writes
+	if _, err := timeplus.MigrateStream(ctx, s.tpClient, timeplus.AlertAcksStreamSchema(streamName)); err != nil {
+		return fmt.Errorf("failed to migrate dedicated alert acks stream %s: %w", streamName, err)
+	}
+	return nil
+}
+
+// copyAlertAcksStatement returns the statement copying a rule's alerts between alert acks streams
+func copyAlertAcksStatement(ruleID, source, target string) string {
+	var columns []string
+	for _, column := range timeplus.GetMutableAlertAcksSchema() {
+		columns = append(columns, column.Name)
+	}
+	list := strings.Join(columns, ", ")
+	return fmt.Sprintf("INSERT INTO `%s` (%s) SELECT %s FROM table(`%s`) WHERE rule_id = '%s'",
+		target, list, list, source, strings.ReplaceAll(ruleID, "'", "''"))
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ruleQuery matches queries reading the rules stream
+var ruleQuery = mock.MatchedBy(func(query string) bool { return strings.Contains(query, "tp_rules") })
+
+func TestCopyAlertAcksStatement(t *testing.T) {
+	assert.Equal(t,
+		"INSERT INTO `rule_r1_alert_acks` (rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq, reference) "+
+			"SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq, reference "+
+			"FROM table(`tp_alert_acks_mutable`) WHERE rule_id = 'r1'",
+		copyAlertAcksStatement("r1", "tp_alert_acks_mutable", "rule_r1_alert_acks"))
+}
+
+func TestListAckStreamsGroupsRules(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{
+		{"id": "r1", "status": "running"},
+		{"id": "r2", "status": "running", "dedicated_alert_acks_stream": true, "alert_acks_stream_name": "rule_r2_alert_acks"},
+		{"id": "r3", "status": "stopped"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"tp_alert_acks_mutable"}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(`tp_alert_acks_mutable`)")
+	})).Return([]map[string]interface{}{
+		{"state": "active", "alerts": uint64(3)},
+		{"state": "resolved", "alerts": uint64(5)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	streams, err := service.ListAckStreams(context.Background())
+	require.NoError(t, err)
+	require.Len(t, streams, 2)
+
+	assert.Equal(t, "tp_alert_acks_mutable", streams[0].Name)
+	assert.False(t, streams[0].Dedicated)
+	assert.True(t, streams[0].Exists)
+	assert.Equal(t, []string{"r1", "r3"}, streams[0].RuleIDs)
+	assert.Equal(t, int64(8), streams[0].Alerts)
+	assert.Equal(t, map[string]int64{"active": 3, "resolved": 5}, streams[0].States)
+
+	// The dedicated stream is missing, so its alerts aren't counted
+	assert.Equal(t, AckStreamInfo{Name: "rule_r2_alert_acks", Dedicated: true, RuleIDs: []string{"r2"}}, streams[1])
+}
+
+func TestCompactRuleAckStreamDeletesResolvedAlerts(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{{"id": "r1", "status": "running"}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT count() AS alerts FROM table(`tp_alert_acks_mutable`) WHERE rule_id = 'r1' AND state = 'resolved' AND updated_at < ")
+	})).Return([]map[string]interface{}{{"alerts": uint64(4)}}, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "DELETE FROM `tp_alert_acks_mutable` WHERE rule_id = 'r1' AND state = 'resolved' AND updated_at < ")
+	})).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	result, err := service.CompactRuleAckStream(context.Background(), "r1", 7*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), result.Removed)
+	assert.Equal(t, "tp_alert_acks_mutable", result.Stream)
+	assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), result.Before, time.Minute)
+	mockClient.AssertExpectations(t)
+}
+
+func TestMigrateRuleAckStreamRejectsInvalidTargets(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{{"id": "r1", "status": "running"}}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	_, err := service.MigrateRuleAckStream(context.Background(), "r1", AckStreamMigration{Dedicated: false})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.ErrorContains(t, err, "already uses alert acks stream tp_alert_acks_mutable")
+
+	_, err = service.MigrateRuleAckStream(context.Background(), "r1", AckStreamMigration{Dedicated: true, StreamName: "acks; DROP STREAM x"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+
+	// Nothing is dropped before the target is known to be valid
+	mockClient.AssertNotCalled(t, "ExecuteDDL", mock.Anything, mock.Anything)
+}
+
+func TestMigrateStoppedRuleCopiesAlerts(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{{"id": "r1", "status": "stopped"}}, nil)
+	mockClient.On("EnsureMutableStream", mock.Anything, "r1_acks", mock.Anything, []string{"rule_id", "entity_id"}).Return(nil)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.SchemaVersionsStream, mock.Anything, []string{"stream_name"}).Return(nil)
+	mockClient.On("StreamExists", mock.Anything, mock.Anything).Return(true, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.SchemaVersionsStream, mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	_, err := service.MigrateRuleAckStream(context.Background(), "r1", AckStreamMigration{Dedicated: true, StreamName: "r1_acks"})
+	require.NoError(t, err)
+
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, copyAlertAcksStatement("r1", "tp_alert_acks_mutable", "r1_acks"))
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, "DELETE FROM `tp_alert_acks_mutable` WHERE rule_id = 'r1'")
+	// A stopped rule has no views to drop
+	mockClient.AssertNotCalled(t, "ExecuteDDL", mock.Anything, "DROP VIEW IF EXISTS `rule_r1_mv`")
+}
+
+func TestRebalanceAckPartitionsMovesMisplacedAlerts(t *testing.T) {
+	timeplus.SetAlertAcksPartitions(2)
+	t.Cleanup(func() { timeplus.SetAlertAcksPartitions(1) })
+
+	// r1 has alerts left in a partition from a larger setting, r2 writes to a dedicated stream
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{
+		{"id": "r1", "status": "stopped"},
+		{"id": "r2", "status": "stopped", "dedicated_alert_acks_stream": true, "alert_acks_stream_name": "rule_r2_alert_acks"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{
+		"tp_alert_acks_mutable_p2", "tp_alert_acks_mutable", "rule_r2_alert_acks", "tp_alert_acks_mutable_p1",
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, "SELECT DISTINCT rule_id FROM table(`tp_alert_acks_mutable_p2`)").
+		Return([]map[string]interface{}{{"rule_id": "r1"}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT DISTINCT rule_id")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, "SELECT count() AS count FROM table(`tp_alert_acks_mutable_p2`)").
+		Return([]map[string]interface{}{{"count": uint64(0)}}, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	result, err := service.RebalanceAckPartitions(context.Background())
+	require.NoError(t, err)
+
+	target := timeplus.AlertAcksStreamFor("r1")
+	assert.Equal(t, 2, result.Partitions)
+	assert.Equal(t, []AckPartitionMove{{RuleID: "r1", From: "tp_alert_acks_mutable_p2", To: target}}, result.Moved)
+	assert.Equal(t, []string{"tp_alert_acks_mutable_p2"}, result.Dropped)
+
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, copyAlertAcksStatement("r1", "tp_alert_acks_mutable_p2", target))
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, "DELETE FROM `tp_alert_acks_mutable_p2` WHERE rule_id = 'r1'")
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, "DROP STREAM IF EXISTS `tp_alert_acks_mutable_p2`")
+	mockClient.AssertNotCalled(t, "ExecuteQuery", mock.Anything, "SELECT count() AS count FROM table(`tp_alert_acks_mutable_p1`)")
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ActiveAlertsCacheTTL is how long a snapshot of the active alerts is served before it's queried
+// again, so any number of dashboards polling every few seconds share one query
+const ActiveAlertsCacheTTL = 2 * time.Second
+
+// ActiveAlerts is what is firing right now, per rule
+type ActiveAlerts struct {
+	Total       int64               `json:"total"`
+	Rules       []*ActiveRuleAlerts `json:"rules"` // Most recently fired first
+	GeneratedAt time.Time           `json:"generatedAt"`
+}
+
+// ActiveRuleAlerts counts a rule's active alerts and shows the one that fired last
+type ActiveRuleAlerts struct {
+	RuleID   string            `json:"ruleId"`
+	RuleName string            `json:"ruleName,omitempty"` // Empty when the rule no longer exists
+	Count    int64             `json:"count"`
+	Latest   LatestActiveAlert `json:"latest"`
+}
+
+// LatestActiveAlert is the most recently fired active alert of a rule
+type LatestActiveAlert struct {
+	AlertID     string                 `json:"alertId"`
+	EntityID    string                 `json:"entityId"`
+	Severity    string                 `json:"severity,omitempty"`
+	TriggeredAt time.Time              `json:"triggeredAt"`
+	Data        map[string]interface{} `json:"data"` // The triggering row
+}
+
+// GetActiveAlerts returns the active alerts of every rule, or of one rule when ruleID is set. A
+// single aggregate over the alert acks stream returns one row per rule, and the result is reused for
+// ActiveAlertsCacheTTL.
+func (s *RuleService) GetActiveAlerts(ctx context.Context, ruleID string) (*ActiveAlerts, error) {
+	s.activeAlertsMutex.Lock()
+	defer s.activeAlertsMutex.Unlock()
+
+	if s.activeAlerts == nil || time.Since(s.activeAlerts.GeneratedAt) >= ActiveAlertsCacheTTL {
+		active, err := s.queryActiveAlerts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.activeAlerts = active
+	}
+
+	if ruleID == "" {
+		return s.activeAlerts, nil
+	}
+	filtered := &ActiveAlerts{Rules: []*ActiveRuleAlerts{}, GeneratedAt: s.activeAlerts.GeneratedAt}
+	for _, rule := range s.activeAlerts.Rules {
+		if rule.RuleID == ruleID {
+			filtered.Rules = append(filtered.Rules, rule)
+			filtered.Total += rule.Count
+		}
+	}
+	return filtered, nil
+}
+
+func (s *RuleService) queryActiveAlerts(ctx context.Context) (*ActiveAlerts, error) {
+	// Only the latest version of each rule is joined, for its name and its severity when the alert
+	// didn't compute one
+	query := fmt.Sprintf(`SELECT
+    a.rule_id AS rule_id,
+    any(r.name) AS rule_name,
+    count() AS count,
+    max(a.created_at) AS created_at,
+    arg_max(a.entity_id, a.created_at) AS entity_id,
+    arg_max(a.firing_seq, a.created_at) AS firing_seq,
+    arg_max(coalesce(nullif(a.severity, ''), r.severity), a.created_at) AS severity,
+    arg_max(a.comment, a.created_at) AS comment
+FROM %s AS a
+LEFT JOIN (
+    SELECT id, arg_max(name, _tp_time) AS name, arg_max(severity, _tp_time) AS severity
+    FROM table(%s) WHERE active = true GROUP BY id
+) AS r ON a.rule_id = r.id
+WHERE a.state = '%s'
+GROUP BY a.rule_id
+ORDER BY created_at DESC`, timeplus.AlertAcksTable(), s.ruleStream, timeplus.AlertStateActive)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active alerts: %w", err)
+	}
+
+	active := &ActiveAlerts{Rules: make([]*ActiveRuleAlerts, 0, len(rows)), GeneratedAt: time.Now()}
+	for _, row := range rows {
+		rule := &ActiveRuleAlerts{
+			RuleID:   getString(row, "rule_id"),
+			RuleName: getString(row, "rule_name"),
+			Count:    getInt64(row, "count"),
+		}
+		rule.Latest.AlertID = FormatAlertID(rule.RuleID, getString(row, "entity_id"), getInt64(row, "firing_seq"))
+		rule.Latest.EntityID = getString(row, "entity_id")
+		rule.Latest.Severity = getString(row, "severity")
+		if createdAt, ok := row["created_at"].(time.Time); ok {
+			rule.Latest.TriggeredAt = createdAt
+		}
+		row["state"] = timeplus.AlertStateActive
+		rule.Latest.Data = alertRowData(ctx, row)
+
+		active.Rules = append(active.Rules, rule)
+		active.Total += rule.Count
+	}
+	return active, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetActiveAlertsIsSharedByPollers(t *testing.T) {
+	firedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "WHERE a.state = 'active'") && strings.Contains(query, "GROUP BY a.rule_id")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "r1", "rule_name": "Hot", "count": uint64(3), "created_at": firedAt, "entity_id": "dev-7",
+			"firing_seq": uint64(2), "severity": "critical", "comment": `{"temperature": 41.5}`},
+		{"rule_id": "r2", "rule_name": "", "count": uint64(1), "created_at": firedAt.Add(-time.Hour), "entity_id": "dev-1",
+			"firing_seq": uint64(1), "severity": "warning", "comment": ""},
+	}, nil).Once()
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	active, err := service.GetActiveAlerts(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), active.Total)
+	require.Len(t, active.Rules, 2)
+
+	hot := active.Rules[0]
+	assert.Equal(t, "Hot", hot.RuleName)
+	assert.Equal(t, int64(3), hot.Count)
+	assert.Equal(t, "r1:dev-7:2", hot.Latest.AlertID)
+	assert.Equal(t, "critical", hot.Latest.Severity)
+	assert.Equal(t, firedAt, hot.Latest.TriggeredAt)
+	assert.Equal(t, json.Number("41.5"), hot.Latest.Data["temperature"])
+	assert.Equal(t, "dev-7", hot.Latest.Data["entity_id"])
+
+	// Polling again within the TTL reuses the snapshot, filtered to a rule on request
+	filtered, err := service.GetActiveAlerts(context.Background(), "r2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), filtered.Total)
+	require.Len(t, filtered.Rules, 1)
+	assert.Equal(t, "dev-1", filtered.Rules[0].Latest.EntityID)
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
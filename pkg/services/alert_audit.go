@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ErrAlertNotAcknowledged is returned when reopening an alert that isn't acknowledged
+var ErrAlertNotAcknowledged = errors.New("alert is not acknowledged")
+
+// ErrAlertNotFound is returned when no alert exists for an alert ID
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrAlertResolved is returned when resolving an alert that is already resolved
+var ErrAlertResolved = errors.New("alert is already resolved")
+
+// UnacknowledgeAlert reopens an acknowledged alert, flipping it back to active. The alert keeps its ID,
+// triggering data and creation time, so once the rule's throttle window has passed since it fired the
+// entity alerts again. Who reopened it and why is recorded in the alert audit stream.
+func (s *RuleService) UnacknowledgeAlert(ctx context.Context, id string, reopenedBy string, reason string) error {
+	ruleID, entityID, firingSeq, hasSeq, err := s.resolveAlertID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	done, err := s.trackTask(fmt.Sprintf("unacknowledge %s:%s", ruleID, entityID))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	match := alertMatch(ruleID, entityID)
+	stream := timeplus.AlertAcksStreamFor(ruleID)
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT state, firing_seq FROM table(%s) WHERE %s",
+		stream, match))
+	if err != nil {
+		return fmt.Errorf("failed to look up alert: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%w: %s", ErrAlertNotFound, id)
+	}
+
+	currentSeq := getInt64(rows[0], "firing_seq")
+	if hasSeq && firingSeq != currentSeq {
+		return fmt.Errorf("%w: latest alert is %s", ErrAlertSuperseded, FormatAlertID(ruleID, entityID, currentSeq))
+	}
+	if state := getString(rows[0], "state"); state != timeplus.AlertStateAcknowledged {
+		return fmt.Errorf("%w: alert %s is %s", ErrAlertNotAcknowledged, FormatAlertID(ruleID, entityID, currentSeq), state)
+	}
+
+	if reopenedBy == "" {
+		reopenedBy = "api"
+	}
+
+	// Copy the row back as active so the triggering data, severity and firing sequence are kept
+	query := fmt.Sprintf(`
+		INSERT INTO %s (rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq)
+		SELECT rule_id, entity_id, '%s', created_at, now(), %s, comment, event_time, severity, firing_seq
+		FROM table(%s)
+		WHERE %s AND state = '%s' AND firing_seq = %d
+	`,
+		stream,
+		timeplus.AlertStateActive,
+		timeplus.QuoteString(reopenedBy),
+		stream,
+		match, timeplus.AlertStateAcknowledged, currentSeq)
+
+	if _, err := s.tpClient.ExecuteQuery(ctx, query); err != nil {
+		return fmt.Errorf("failed to reopen alert: %w", err)
+	}
+
+	s.recordAlertAudit(ctx, ruleID, entityID, currentSeq, timeplus.AlertAuditActionReopened, reopenedBy, reason)
+	logrus.Infof("Alert %s reopened by %s", FormatAlertID(ruleID, entityID, currentSeq), reopenedBy)
+	return nil
+}
+
+// ResolveAlert resolves an active or acknowledged alert by hand, as the rule's resolve query would once
+// the condition clears. The alert keeps its ID, triggering data and creation time, and who resolved
+// it and why is recorded in the alert audit stream.
+func (s *RuleService) ResolveAlert(ctx context.Context, id string, resolvedBy string, reason string) error {
+	ruleID, entityID, firingSeq, hasSeq, err := s.resolveAlertID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	done, err := s.trackTask(fmt.Sprintf("resolve %s:%s", ruleID, entityID))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	match := alertMatch(ruleID, entityID)
+	stream := timeplus.AlertAcksStreamFor(ruleID)
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT state, firing_seq FROM table(%s) WHERE %s",
+		stream, match))
+	if err != nil {
+		return fmt.Errorf("failed to look up alert: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%w: %s", ErrAlertNotFound, id)
+	}
+
+	currentSeq := getInt64(rows[0], "firing_seq")
+	if hasSeq && firingSeq != currentSeq {
+		return fmt.Errorf("%w: latest alert is %s", ErrAlertSuperseded, FormatAlertID(ruleID, entityID, currentSeq))
+	}
+	state := getString(rows[0], "state")
+	if state == timeplus.AlertStateResolved {
+		return fmt.Errorf("%w: %s", ErrAlertResolved, FormatAlertID(ruleID, entityID, currentSeq))
+	}
+
+	if resolvedBy == "" {
+		resolvedBy = "api"
+	}
+
+	// Copy the row as resolved so the triggering data, severity and firing sequence are kept
+	query := fmt.Sprintf(`
+		INSERT INTO %s (rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq)
+		SELECT rule_id, entity_id, '%s', created_at, now(), %s, %s, event_time, severity, firing_seq
+		FROM table(%s)
+		WHERE %s AND state = %s AND firing_seq = %d
+	`,
+		stream,
+		timeplus.AlertStateResolved,
+		timeplus.QuoteString(resolvedBy),
+		timeplus.QuoteString(reason),
+		stream,
+		match, timeplus.QuoteString(state), currentSeq)
+
+	if _, err := s.tpClient.ExecuteQuery(ctx, query); err != nil {
+		return fmt.Errorf("failed to resolve alert: %w", err)
+	}
+
+	s.recordAlertAudit(ctx, ruleID, entityID, currentSeq, timeplus.AlertAuditActionResolved, resolvedBy, reason)
+	logrus.Infof("Alert %s resolved by %s", FormatAlertID(ruleID, entityID, currentSeq), resolvedBy)
+	return nil
+}
+
+// recordAlertAudit appends an entry to the alert audit stream. Failures are logged rather than
+// returned, since the state change itself has already been applied.
+func (s *RuleService) recordAlertAudit(ctx context.Context, ruleID, entityID string, firingSeq int64, action, actor, reason string) {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (rule_id, entity_id, firing_seq, action, actor, reason, at)
+		VALUES (%s, %s, %d, '%s', %s, %s, now64(3))
+	`,
+		timeplus.AlertAuditStream,
+		timeplus.QuoteString(ruleID),
+		timeplus.QuoteString(entityID),
+		firingSeq,
+		action,
+		timeplus.QuoteString(actor),
+		timeplus.QuoteString(reason))
+
+	if _, err := s.tpClient.ExecuteQuery(ctx, query); err != nil {
+		logrus.Warnf("Failed to record %s audit entry for %s: %v", action, FormatAlertID(ruleID, entityID, firingSeq), err)
+	}
+}
+
+// GetAlertAudit returns the audit trail of an alert's entity, oldest first. The firing sequence of
+// the alert ID is ignored so the trail covers every firing of the entity.
+func (s *RuleService) GetAlertAudit(ctx context.Context, id string) ([]models.AlertAuditEntry, error) {
+	ruleID, entityID, _, _, err := s.resolveAlertID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.queryAlertAudit(ctx, alertMatch(ruleID, entityID))
+}
+
+// GetReferenceAudit returns the audit entries of every acknowledgment made under a reference, such
+// as a maintenance ticket, oldest first. Entries are kept after the entities fire again.
+func (s *RuleService) GetReferenceAudit(ctx context.Context, reference string) ([]models.AlertAuditEntry, error) {
+	return s.queryAlertAudit(ctx, "reference = "+timeplus.QuoteString(reference))
+}
+
+// alertMatch returns the condition matching an alert's rule and entity
+func alertMatch(ruleID, entityID string) string {
+	return fmt.Sprintf("rule_id = %s AND entity_id = %s", timeplus.QuoteString(ruleID), timeplus.QuoteString(entityID))
+}
+
+// queryAlertAudit returns the audit entries matching a condition, oldest first
+func (s *RuleService) queryAlertAudit(ctx context.Context, where string) ([]models.AlertAuditEntry, error) {
+	query := fmt.Sprintf(`SELECT rule_id, entity_id, firing_seq, action, actor, reason, reference, at
+		FROM table(%s)
+		WHERE %s
+		ORDER BY at ASC`,
+		timeplus.AlertAuditStream, where)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert audit: %w", err)
+	}
+
+	entries := make([]models.AlertAuditEntry, 0, len(rows))
+	for _, row := range rows {
+		ruleID, entityID := getString(row, "rule_id"), getString(row, "entity_id")
+		entries = append(entries, models.AlertAuditEntry{
+			AlertID:   FormatAlertID(ruleID, entityID, getInt64(row, "firing_seq")),
+			RuleID:    ruleID,
+			EntityID:  entityID,
+			Action:    getString(row, "action"),
+			Actor:     getString(row, "actor"),
+			Reason:    getString(row, "reason"),
+			Reference: getString(row, "reference"),
+			At:        getTime(row, "at"),
+		})
+	}
+	return entries, nil
+}
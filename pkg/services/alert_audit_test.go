@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestUnacknowledgeAlertReopensAndAudits(t *testing.T) {
+	mockClient := new(MockClient)
+	expectAlertIDLookup(mockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT state, firing_seq")
+	})).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateAcknowledged, "firing_seq": uint64(4)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAcksMutableStream) &&
+			strings.Contains(query, "'active', created_at, now(), 'alice', comment") &&
+			strings.Contains(query, "state = 'acknowledged' AND firing_seq = 4")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAuditStream) &&
+			strings.Contains(query, "'rule1', 'dev1', 4, 'reopened', 'alice', 'acked the wrong device'")
+	})).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	require.NoError(t, service.UnacknowledgeAlert(context.Background(), "rule1:dev1:4", "alice", "acked the wrong device"))
+	mockClient.AssertExpectations(t)
+}
+
+func TestUnacknowledgeAlertRejectsActiveOrStaleAlerts(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateActive, "firing_seq": uint64(4)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	err := service.UnacknowledgeAlert(context.Background(), "rule1:dev1:4", "alice", "")
+	assert.ErrorIs(t, err, ErrAlertNotAcknowledged)
+
+	err = service.UnacknowledgeAlert(context.Background(), "rule1:dev1:3", "alice", "")
+	assert.ErrorIs(t, err, ErrAlertSuperseded)
+
+	// Only the lookups ran
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 4)
+}
+
+func TestUnacknowledgeAlertEscapesBackslashes(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT state, firing_seq")
+	})).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateAcknowledged, "firing_seq": uint64(4)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	// A backslash before a quote must not end the literal
+	require.NoError(t, service.UnacknowledgeAlert(context.Background(), `rule1:dev1\' OR 1=1 --:4`, `alice\'`, `oops\'`))
+	_, err := service.GetReferenceAudit(context.Background(), `OPS-1\' OR 1=1 --`)
+	require.NoError(t, err)
+
+	queries := make([]string, 0, len(mockClient.Calls))
+	for _, call := range mockClient.Calls {
+		queries = append(queries, call.Arguments.String(1))
+	}
+	require.Len(t, queries, 5)
+	assert.Contains(t, queries[0], `entity_id IN ('dev1\\'' OR 1=1 --', 'dev1\\'' OR 1=1 --:4')`)
+	assert.Contains(t, queries[1], `entity_id = 'dev1\\'' OR 1=1 --'`)
+	assert.Contains(t, queries[2], `now(), 'alice\\''', comment`)
+	assert.Contains(t, queries[2], `entity_id = 'dev1\\'' OR 1=1 --'`)
+	assert.Contains(t, queries[3], `'rule1', 'dev1\\'' OR 1=1 --', 4, 'reopened', 'alice\\''', 'oops\\'''`)
+	assert.Contains(t, queries[4], `reference = 'OPS-1\\'' OR 1=1 --'`)
+}
+
+func TestResolveAlertResolvesAndAudits(t *testing.T) {
+	mockClient := new(MockClient)
+	expectAlertIDLookup(mockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT state, firing_seq")
+	})).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateAcknowledged, "firing_seq": uint64(4)},
+	}, nil).Once()
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAcksMutableStream) &&
+			strings.Contains(query, "'resolved', created_at, now(), 'alice@example.com', 'Resolved via email link'") &&
+			strings.Contains(query, "state = 'acknowledged' AND firing_seq = 4")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAuditStream) &&
+			strings.Contains(query, "'rule1', 'dev1', 4, 'resolved', 'alice@example.com'")
+	})).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	require.NoError(t, service.ResolveAlert(context.Background(), "rule1:dev1:4", "alice@example.com", "Resolved via email link"))
+	mockClient.AssertExpectations(t)
+
+	// Resolving it again is refused
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT state, firing_seq")
+	})).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateResolved, "firing_seq": uint64(4)},
+	}, nil)
+	err := service.ResolveAlert(context.Background(), "rule1:dev1:4", "alice@example.com", "")
+	assert.ErrorIs(t, err, ErrAlertResolved)
+}
+
+func TestResolveAlertEscapesBackslashes(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT state, firing_seq")
+	})).Return([]map[string]interface{}{
+		{"state": timeplus.AlertStateActive, "firing_seq": uint64(4)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	// A backslash before a quote must not end the literal
+	require.NoError(t, service.ResolveAlert(context.Background(), `rule1:dev1\':4`, `bob\' OR 1=1 --`, `fixed\'`))
+
+	require.Len(t, mockClient.Calls, 4)
+	query := mockClient.Calls[2].Arguments.String(1)
+	assert.Contains(t, query, `now(), 'bob\\'' OR 1=1 --', 'fixed\\''', event_time`)
+	assert.Contains(t, query, `entity_id = 'dev1\\''' AND state = 'active'`)
+}
+
+func TestGetAlertAuditCoversEveryFiring(t *testing.T) {
+	mockClient := new(MockClient)
+	expectAlertIDLookup(mockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_alert_audit)") &&
+			strings.Contains(query, "rule_id = 'rule1' AND entity_id = 'dev1'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "dev1", "firing_seq": uint64(3), "action": "acknowledged", "actor": "bob", "reason": "known issue"},
+		{"rule_id": "rule1", "entity_id": "dev1", "firing_seq": uint64(3), "action": "reopened", "actor": "alice"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	entries, err := service.GetAlertAudit(context.Background(), "rule1:dev1:4")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "rule1:dev1:3", entries[0].AlertID)
+	assert.Equal(t, "known issue", entries[0].Reason)
+	assert.Equal(t, "reopened", entries[1].Action)
+}
+
+func TestGetReferenceAuditListsEveryAcknowledgedAlert(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_alert_audit)") && strings.Contains(query, "reference = 'OPS-''12'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "dev1", "firing_seq": uint64(2), "action": "acknowledged", "actor": "alice", "reference": "OPS-'12"},
+		{"rule_id": "rule2", "entity_id": "dev9", "firing_seq": uint64(1), "action": "acknowledged", "actor": "alice", "reference": "OPS-'12"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	entries, err := service.GetReferenceAudit(context.Background(), "OPS-'12")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "rule2:dev9:1", entries[1].AlertID)
+	assert.Equal(t, "OPS-'12", entries[0].Reference)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Alert count groupings
+const (
+	AlertCountGroupNone     = ""
+	AlertCountGroupSeverity = "severity"
+	AlertCountGroupState    = "state"
+	AlertCountGroupRule     = "rule"
+)
+
+// ErrInvalidAlertCountQuery is returned for unsupported groupBy or state values
+var ErrInvalidAlertCountQuery = errors.New("invalid alert count query")
+
+// AlertCounts holds alert totals, optionally broken down by a grouping key
+type AlertCounts struct {
+	GroupBy string           `json:"groupBy,omitempty"`
+	State   string           `json:"state,omitempty"`
+	RuleID  string           `json:"ruleId,omitempty"`
+	Total   int64            `json:"total"`
+	Counts  map[string]int64 `json:"counts,omitempty"`
+}
+
+// GetAlertCounts counts alerts with a single aggregate query so dashboards can show badge
+// numbers without fetching the alerts themselves. state and ruleID are optional filters.
+func (s *RuleService) GetAlertCounts(ctx context.Context, groupBy, state, ruleID string) (*AlertCounts, error) {
+	var keyExpr string
+	join := ""
+	switch groupBy {
+	case AlertCountGroupNone:
+		keyExpr = "''"
+	case AlertCountGroupSeverity:
+		// Alerts carry the severity computed when they fired; fall back to the rule's severity,
+		// joining the latest version of each active rule
+		keyExpr = "coalesce(nullif(a.severity, ''), r.severity)"
+		join = fmt.Sprintf("LEFT JOIN (SELECT id, severity FROM table(%s) WHERE active = true) AS r ON a.rule_id = r.id", s.ruleStream)
+	case AlertCountGroupState:
+		keyExpr = "a.state"
+	case AlertCountGroupRule:
+		keyExpr = "a.rule_id"
+	default:
+		return nil, fmt.Errorf("%w: unsupported groupBy %q, expected severity, state or rule", ErrInvalidAlertCountQuery, groupBy)
+	}
+
+	var conditions []string
+	if state != "" {
+		switch state {
+		case timeplus.AlertStateActive, timeplus.AlertStateAcknowledged, timeplus.AlertStateSilenced, timeplus.AlertStateResolved:
+			conditions = append(conditions, fmt.Sprintf("a.state = '%s'", state))
+		default:
+			return nil, fmt.Errorf("%w: unsupported state %q", ErrInvalidAlertCountQuery, state)
+		}
+	}
+	if ruleID != "" {
+		conditions = append(conditions, fmt.Sprintf("a.rule_id = '%s'", strings.ReplaceAll(ruleID, "'", "''")))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf("SELECT %s AS key, count() AS count FROM %s AS a %s %s GROUP BY key",
+		keyExpr, timeplus.AlertAcksTable(), join, where)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+
+	counts := &AlertCounts{GroupBy: groupBy, State: state, RuleID: ruleID}
+	if groupBy != AlertCountGroupNone {
+		counts.Counts = make(map[string]int64, len(rows))
+	}
+	for _, row := range rows {
+		count := getInt64(row, "count")
+		counts.Total += count
+
+		if counts.Counts != nil {
+			key := getString(row, "key")
+			if key == "" {
+				key = "unknown" // Alerts whose rule no longer exists
+			}
+			counts.Counts[key] += count
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAlertCountsBySeverity(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "r.severity) AS key") &&
+			strings.Contains(query, "a.state = 'active'") &&
+			strings.Contains(query, "GROUP BY key")
+	})).Return([]map[string]interface{}{
+		{"key": "critical", "count": uint64(3)},
+		{"key": "warning", "count": uint64(5)},
+		{"key": "", "count": uint64(1)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	counts, err := service.GetAlertCounts(context.Background(), AlertCountGroupSeverity, "active", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), counts.Total)
+	assert.Equal(t, map[string]int64{"critical": 3, "warning": 5, "unknown": 1}, counts.Counts)
+
+	// A single aggregate query, no alert rows fetched
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
+
+func TestGetAlertCountsRejectsInvalidInput(t *testing.T) {
+	service := &RuleService{tpClient: new(MockClient), ruleStream: "tp_rules"}
+
+	_, err := service.GetAlertCounts(context.Background(), "entity", "", "")
+	assert.ErrorIs(t, err, ErrInvalidAlertCountQuery)
+
+	_, err = service.GetAlertCounts(context.Background(), AlertCountGroupState, "firing", "")
+	assert.ErrorIs(t, err, ErrInvalidAlertCountQuery)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+const (
+	// DefaultAlertHistoryLimit is the number of history entries returned when no limit is given
+	DefaultAlertHistoryLimit = 1000
+	// maxAlertHistoryLimit caps how many history entries a single request can return
+	maxAlertHistoryLimit = 10000
+)
+
+// setupAlertHistory creates a rule's alert history stream if needed and (re)creates the materialized
+// view that appends every firing written to the rule's alert acks stream
+func (s *RuleService) setupAlertHistory(ctx context.Context, rule *models.Rule, alertAcksStream string) error {
+	res := getRuleResources(rule)
+
+	if err := s.tpClient.CreateStream(ctx, res.AlertHistoryStream, timeplus.GetAlertHistorySchema()); err != nil {
+		return fmt.Errorf("failed to create alert history stream %s: %w", res.AlertHistoryStream, err)
+	}
+	if _, err := timeplus.MigrateStream(ctx, s.tpClient, timeplus.AlertHistoryStreamSchema(res.AlertHistoryStream)); err != nil {
+		return fmt.Errorf("failed to migrate alert history stream %s: %w", res.AlertHistoryStream, err)
+	}
+
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.AlertHistoryMV)); err != nil {
+		logrus.Warnf("Error dropping alert history materialized view %s: %v", res.AlertHistoryMV, err)
+	}
+
+	query := timeplus.GetRuleAlertHistoryMaterializedViewQuery(rule.ID, res.AlertHistoryMV, alertAcksStream, res.AlertHistoryStream)
+	if err := s.tpClient.ExecuteDDL(ctx, query); err != nil {
+		return fmt.Errorf("failed to create alert history materialized view %s: %w", res.AlertHistoryMV, err)
+	}
+	return nil
+}
+
+// GetAlertHistory returns the firings of a rule between start and end, newest first.
+// Unlike GetAlerts, which returns the latest state per entity, every firing is returned.
+func (s *RuleService) GetAlertHistory(ctx context.Context, ruleID string, start, end time.Time, entityID string, limit int) ([]*models.AlertHistoryEntry, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultAlertHistoryLimit
+	}
+	if limit > maxAlertHistoryLimit {
+		limit = maxAlertHistoryLimit
+	}
+
+	res := getRuleResources(rule)
+	entries := make([]*models.AlertHistoryEntry, 0)
+
+	// Rules that have never been started have no history yet
+	exists, err := s.tpClient.StreamExists(ctx, res.AlertHistoryStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check alert history stream: %w", err)
+	}
+	if !exists {
+		return entries, nil
+	}
+
+	conditions := []string{
+		fmt.Sprintf("triggered_at >= %s", timeplus.DateTime64(start)),
+		fmt.Sprintf("triggered_at <= %s", timeplus.DateTime64(end)),
+	}
+	if entityID != "" {
+		conditions = append(conditions, fmt.Sprintf("entity_id = '%s'", strings.ReplaceAll(entityID, "'", "''")))
+	}
+
+	query := fmt.Sprintf(`SELECT rule_id, entity_id, severity, triggered_at, event_time, triggered_by, data, firing_seq
+		FROM table(`+"`%s`"+`)
+		WHERE %s
+		ORDER BY triggered_at DESC
+		LIMIT %d`, res.AlertHistoryStream, strings.Join(conditions, " AND "), limit)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert history: %w", err)
+	}
+
+	for _, row := range rows {
+		entry := &models.AlertHistoryEntry{
+			AlertID:     FormatAlertID(getString(row, "rule_id"), getString(row, "entity_id"), getInt64(row, "firing_seq")),
+			RuleID:      getString(row, "rule_id"),
+			EntityID:    getString(row, "entity_id"),
+			Severity:    getString(row, "severity"),
+			TriggeredAt: getTime(row, "triggered_at"),
+			TriggeredBy: getString(row, "triggered_by"),
+			Data:        getString(row, "data"),
+		}
+		if data, encrypted := decryptedPayload(ctx, entry.Data); encrypted {
+			entry.Data = `{"_encrypted": true}`
+		} else {
+			entry.Data = data
+		}
+		if eventTime := getTime(row, "event_time"); !eventTime.IsZero() {
+			entry.EventTime = &eventTime
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
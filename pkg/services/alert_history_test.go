@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAlertHistory(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{{"id": "rule-1", "name": "High Temperature", "status": "running"}}, nil)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule_1_alert_history").Return(true, nil)
+
+	triggeredAt := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	eventTime := triggeredAt.Add(-2 * time.Second)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(`rule_rule_1_alert_history`)") &&
+			strings.Contains(query, "triggered_at >= to_datetime64('2026-01-02 00:00:00.000', 3, 'UTC')") &&
+			strings.Contains(query, "triggered_at <= to_datetime64('2026-01-03 00:00:00.000', 3, 'UTC')") &&
+			strings.Contains(query, "entity_id = 'device''s'") &&
+			strings.Contains(query, "LIMIT 50")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule-1", "entity_id": "device's", "severity": "critical", "triggered_at": triggeredAt,
+			"event_time": &eventTime, "triggered_by": "", "data": `{"temperature": 42.5}`},
+		{"rule_id": "rule-1", "entity_id": "device's", "severity": nil, "triggered_at": triggeredAt.Add(-time.Hour),
+			"event_time": (*time.Time)(nil), "triggered_by": "backfill", "data": `{"temperature": 40}`},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	entries, err := service.GetAlertHistory(context.Background(), "rule-1", start, start.Add(24*time.Hour), "device's", 50)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "critical", entries[0].Severity)
+	assert.Equal(t, triggeredAt, entries[0].TriggeredAt)
+	require.NotNil(t, entries[0].EventTime)
+	assert.Equal(t, eventTime, *entries[0].EventTime)
+	assert.Equal(t, `{"temperature": 42.5}`, entries[0].Data)
+
+	assert.Nil(t, entries[1].EventTime)
+	assert.Equal(t, "backfill", entries[1].TriggeredBy)
+}
+
+func TestGetAlertHistoryWithoutStream(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).
+		Return([]map[string]interface{}{{"id": "rule-1", "name": "New Rule", "status": "created"}}, nil)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule_1_alert_history").Return(false, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	entries, err := service.GetAlertHistory(context.Background(), "rule-1", time.Now().Add(-time.Hour), time.Now(), "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
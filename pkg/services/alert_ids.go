@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ErrInvalidAlertID is returned when an alert ID can't be parsed
+var ErrInvalidAlertID = errors.New("invalid alert ID format, expected 'rule_id:entity_id:firing_seq'")
+
+// ErrAlertSuperseded is returned when an alert ID refers to a firing that has been replaced by a newer one
+var ErrAlertSuperseded = errors.New("alert has been superseded by a newer firing")
+
+// FormatAlertID builds the stable ID of an alert from its rule, entity and firing sequence.
+// The firing sequence is written by the rule's materialized view and increments each time the
+// entity starts a new alert, so the same alert keeps its ID across reads and acknowledgments.
+func FormatAlertID(ruleID, entityID string, firingSeq int64) string {
+	return fmt.Sprintf("%s:%s:%d", ruleID, entityID, firingSeq)
+}
+
+// parseAlertID splits an alert ID into its rule ID, entity ID and firing sequence.
+// IDs without a firing sequence (rule_id:entity_id) refer to the entity's latest alert, in which
+// case hasSeq is false. Rule IDs never contain a colon, so entity IDs may. An ID ending in a number
+// is read as having a firing sequence; resolveAlertID settles those that could be either form.
+func parseAlertID(id string) (ruleID, entityID string, firingSeq int64, hasSeq bool, err error) {
+	ruleID, rest, found := strings.Cut(id, ":")
+	if !found || ruleID == "" || rest == "" {
+		return "", "", 0, false, ErrInvalidAlertID
+	}
+
+	if i := strings.LastIndex(rest, ":"); i > 0 {
+		if seq, parseErr := strconv.ParseInt(rest[i+1:], 10, 64); parseErr == nil && seq >= 0 {
+			return ruleID, rest[:i], seq, true, nil
+		}
+	}
+	return ruleID, rest, 0, false, nil
+}
+
+// resolveAlertID parses an alert ID like parseAlertID, looking up the alerts it could refer to when
+// it reads both ways. rule1:10.0.0.1:8080 is either firing 8080 of entity 10.0.0.1, or the latest
+// alert of entity 10.0.0.1:8080 without a firing sequence. It's taken as the latter when only that
+// entity has an alert, or both have and 8080 isn't the current firing of 10.0.0.1.
+func (s *RuleService) resolveAlertID(ctx context.Context, id string) (ruleID, entityID string, firingSeq int64, hasSeq bool, err error) {
+	ruleID, entityID, firingSeq, hasSeq, err = parseAlertID(id)
+	if err != nil || !hasSeq {
+		return ruleID, entityID, firingSeq, hasSeq, err
+	}
+
+	wholeEntityID := strings.TrimPrefix(id, ruleID+":")
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT entity_id, firing_seq FROM table(%s) WHERE rule_id = %s AND entity_id IN (%s, %s)",
+		timeplus.AlertAcksStreamFor(ruleID), timeplus.QuoteString(ruleID), timeplus.QuoteString(entityID), timeplus.QuoteString(wholeEntityID)))
+	if err != nil {
+		return "", "", 0, false, fmt.Errorf("failed to look up alert: %w", err)
+	}
+
+	currentSeqs := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		currentSeqs[getString(row, "entity_id")] = getInt64(row, "firing_seq")
+	}
+	currentSeq, firing := currentSeqs[entityID]
+	if _, whole := currentSeqs[wholeEntityID]; whole && (!firing || currentSeq != firingSeq) {
+		return ruleID, wholeEntityID, 0, false, nil
+	}
+	return ruleID, entityID, firingSeq, true, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestParseAlertID(t *testing.T) {
+	cases := []struct {
+		id        string
+		ruleID    string
+		entityID  string
+		firingSeq int64
+		hasSeq    bool
+	}{
+		{"rule1:device_1:4", "rule1", "device_1", 4, true},
+		{"rule1:device_1", "rule1", "device_1", 0, false},
+		{"rule1:10.0.0.1:web:2", "rule1", "10.0.0.1:web", 2, true},
+		{"rule1:host:db", "rule1", "host:db", 0, false},
+	}
+	for _, tc := range cases {
+		ruleID, entityID, firingSeq, hasSeq, err := parseAlertID(tc.id)
+		require.NoError(t, err, tc.id)
+		assert.Equal(t, tc.ruleID, ruleID, tc.id)
+		assert.Equal(t, tc.entityID, entityID, tc.id)
+		assert.Equal(t, tc.firingSeq, firingSeq, tc.id)
+		assert.Equal(t, tc.hasSeq, hasSeq, tc.id)
+	}
+
+	for _, id := range []string{"", "rule1", ":device_1", "rule1:"} {
+		_, _, _, _, err := parseAlertID(id)
+		assert.ErrorIs(t, err, ErrInvalidAlertID, id)
+	}
+}
+
+func TestFormatAlertIDRoundTrip(t *testing.T) {
+	id := FormatAlertID("rule1", "site:a", 7)
+	assert.Equal(t, "rule1:site:a:7", id)
+
+	ruleID, entityID, firingSeq, hasSeq, err := parseAlertID(id)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"rule1", "site:a", int64(7), true}, []interface{}{ruleID, entityID, firingSeq, hasSeq})
+}
+
+func TestResolveAlertIDSettlesLegacyIDs(t *testing.T) {
+	cases := []struct {
+		name      string
+		rows      []map[string]interface{}
+		entityID  string
+		firingSeq int64
+		hasSeq    bool
+	}{
+		{"no alert either way", nil, "10.0.0.1", 8080, true},
+		{"firing of the shorter entity", []map[string]interface{}{
+			{"entity_id": "10.0.0.1", "firing_seq": uint64(3)},
+		}, "10.0.0.1", 8080, true},
+		{"latest alert of the whole entity", []map[string]interface{}{
+			{"entity_id": "10.0.0.1:8080", "firing_seq": uint64(2)},
+		}, "10.0.0.1:8080", 0, false},
+		{"both, current firing of the shorter entity", []map[string]interface{}{
+			{"entity_id": "10.0.0.1", "firing_seq": uint64(8080)},
+			{"entity_id": "10.0.0.1:8080", "firing_seq": uint64(2)},
+		}, "10.0.0.1", 8080, true},
+		{"both, not a firing of the shorter entity", []map[string]interface{}{
+			{"entity_id": "10.0.0.1", "firing_seq": uint64(3)},
+			{"entity_id": "10.0.0.1:8080", "firing_seq": uint64(2)},
+		}, "10.0.0.1:8080", 0, false},
+	}
+	for _, tc := range cases {
+		mockClient := new(MockClient)
+		expectAlertIDLookup(mockClient, tc.rows...)
+		service := &RuleService{tpClient: mockClient}
+
+		ruleID, entityID, firingSeq, hasSeq, err := service.resolveAlertID(context.Background(), "rule1:10.0.0.1:8080")
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, []interface{}{"rule1", tc.entityID, tc.firingSeq, tc.hasSeq}, []interface{}{ruleID, entityID, firingSeq, hasSeq}, tc.name)
+		mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+			return strings.Contains(query, "rule_id = 'rule1' AND entity_id IN ('10.0.0.1', '10.0.0.1:8080')")
+		}))
+	}
+
+	// IDs without a firing sequence need no lookup
+	mockClient := new(MockClient)
+	service := &RuleService{tpClient: mockClient}
+	_, entityID, _, hasSeq, err := service.resolveAlertID(context.Background(), "rule1:host:db")
+	require.NoError(t, err)
+	assert.Equal(t, "host:db", entityID)
+	assert.False(t, hasSeq)
+	mockClient.AssertNotCalled(t, "ExecuteQuery", mock.Anything, mock.Anything)
+}
+
+// expectAlertIDLookup answers the lookup resolveAlertID makes for alert IDs with a firing sequence
+func expectAlertIDLookup(mockClient *MockClient, rows ...map[string]interface{}) {
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT entity_id, firing_seq FROM")
+	})).Return(rows, nil)
+}
+
+func TestAcknowledgeAlertRejectsSupersededFiring(t *testing.T) {
+	mockClient := new(MockClient)
+	expectAlertIDLookup(mockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "state = '"+timeplus.AlertStateActive+"'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "entity123", "state": timeplus.AlertStateActive, "firing_seq": uint64(3)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	err := service.AcknowledgeAlert(context.Background(), "rule1:entity123:2", "test-user")
+	assert.ErrorIs(t, err, ErrAlertSuperseded)
+	assert.Contains(t, err.Error(), "rule1:entity123:3")
+
+	// Nothing was written for the stale firing
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 2)
+}
+
+func TestAcknowledgeAlertKeepsFiringSequence(t *testing.T) {
+	mockClient := new(MockClient)
+	expectAlertIDLookup(mockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "state = '"+timeplus.AlertStateActive+"'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "entity123", "state": timeplus.AlertStateActive, "firing_seq": uint64(3)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAcksMutableStream) &&
+			strings.Contains(query, "firing_seq") &&
+			strings.Contains(query, "'test-user', 'Acknowledged via API', 3)")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAuditStream) &&
+			strings.Contains(query, "'rule1', 'entity123', 3, 'acknowledged', 'test-user'")
+	})).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	require.NoError(t, service.AcknowledgeAlert(context.Background(), "rule1:entity123:3", "test-user"))
+	mockClient.AssertExpectations(t)
+}
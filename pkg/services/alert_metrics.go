@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Alert metric event types besides the alert state changes, which are recorded under their
+// notification event type: acknowledged, snoozed, resolved and reopened
+const (
+	AlertMetricFired        = "fired"         // A rule started a new firing; latency from the triggering event
+	AlertMetricNotified     = "notified"      // The firing was dispatched; latency from the firing
+	AlertMetricNotifyFailed = "notify_failed" // The firing couldn't be dispatched
+	AlertMetricFiltered     = "filtered"      // The rule's script filtered the firing
+	AlertMetricSuppressed   = "suppressed"    // A rule the firing's rule depends on was active
+	AlertMetricInhibited    = "inhibited"     // A more severe alert was active for the entity
+	AlertMetricCorrelated   = "correlated"    // The firing joined an incident notified by another alert
+)
+
+const (
+	maxPendingAlertMetrics = 10000 // Metrics kept while Timeplus can't be written, the oldest are dropped
+	alertMetricsBatchSize  = 500
+)
+
+// alertMetric is an alert lifecycle event as written to AlertMetricsStream
+type alertMetric struct {
+	ruleID    string
+	entityID  string
+	firingSeq int64
+	eventType string
+	severity  string
+	latency   *time.Duration // Nil when unknown
+	at        time.Time
+}
+
+// AlertMetricsStatus counts the alert metrics written since the gateway started
+type AlertMetricsStatus struct {
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"` // Not written because too many were waiting while Timeplus failed
+	Pending int   `json:"pending"`
+}
+
+// AlertMetrics records the alert monitor's lifecycle events in AlertMetricsStream, so dashboards of
+// the gateway's behavior can be built in Timeplus. Events are buffered in memory and written in
+// batches by Flush; those that fail to be written are kept for the next flush.
+type AlertMetrics struct {
+	client timeplus.StreamStore
+
+	mu      sync.Mutex
+	pending []alertMetric
+	written int64
+	dropped int64
+}
+
+// NewAlertMetrics creates alert metrics written through client
+func NewAlertMetrics(client timeplus.StreamStore) *AlertMetrics {
+	return &AlertMetrics{client: client}
+}
+
+// Ensure creates the alert metrics stream if needed
+func (m *AlertMetrics) Ensure(ctx context.Context) error {
+	if err := m.client.CreateStream(ctx, timeplus.AlertMetricsStream, timeplus.GetAlertMetricsSchema()); err != nil {
+		return fmt.Errorf("failed to ensure alert metrics stream: %w", err)
+	}
+	return nil
+}
+
+// Record records an event, to be written by the next Flush
+func (m *AlertMetrics) Record(metric alertMetric) {
+	if metric.at.IsZero() {
+		metric.at = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, metric)
+	m.trim()
+}
+
+// Flush writes the events recorded since the last flush
+func (m *AlertMetrics) Flush(ctx context.Context) {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for start := 0; start < len(pending); start += alertMetricsBatchSize {
+		batch := pending[start:min(start+alertMetricsBatchSize, len(pending))]
+		if _, err := m.client.ExecuteQuery(ctx, alertMetricsInsertQuery(batch)); err != nil {
+			logrus.Warnf("Failed to write %d alert metrics: %v", len(pending)-start, err)
+			m.mu.Lock()
+			m.pending = append(append([]alertMetric(nil), pending[start:]...), m.pending...)
+			m.trim()
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Lock()
+		m.written += int64(len(batch))
+		m.mu.Unlock()
+	}
+}
+
+// Status returns how many events were written and dropped
+func (m *AlertMetrics) Status() AlertMetricsStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return AlertMetricsStatus{Written: m.written, Dropped: m.dropped, Pending: len(m.pending)}
+}
+
+// trim drops the oldest pending events past the limit. Must be called with mu held.
+func (m *AlertMetrics) trim() {
+	if over := len(m.pending) - maxPendingAlertMetrics; over > 0 {
+		m.pending = m.pending[over:]
+		m.dropped += int64(over)
+	}
+}
+
+// alertMetricsInsertQuery returns the query writing a batch of events
+func alertMetricsInsertQuery(batch []alertMetric) string {
+	values := make([]string, len(batch))
+	for i, metric := range batch {
+		latency := "NULL"
+		if metric.latency != nil {
+			latency = fmt.Sprintf("%d", metric.latency.Milliseconds())
+		}
+		values[i] = fmt.Sprintf("('%s', '%s', %d, '%s', '%s', %s, %s)",
+			strings.ReplaceAll(metric.ruleID, "'", "''"),
+			strings.ReplaceAll(metric.entityID, "'", "''"),
+			metric.firingSeq,
+			metric.eventType,
+			strings.ReplaceAll(metric.severity, "'", "''"),
+			latency,
+			timeplus.DateTime64(metric.at))
+	}
+	return fmt.Sprintf("INSERT INTO %s (rule_id, entity_id, firing_seq, event_type, severity, latency_ms, at) VALUES %s",
+		timeplus.AlertMetricsStream, strings.Join(values, ", "))
+}
+
+// latencyBetween returns the time from start to end, nil when either is unknown
+func latencyBetween(start, end time.Time) *time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return nil
+	}
+	latency := end.Sub(start)
+	if latency < 0 {
+		latency = 0
+	}
+	return &latency
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestAlertMetricsInsertQuery(t *testing.T) {
+	latency := 1500 * time.Millisecond
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	query := alertMetricsInsertQuery([]alertMetric{
+		{ruleID: "rule1", entityID: "it's", firingSeq: 3, eventType: AlertMetricFired, severity: "critical", latency: &latency, at: at},
+		{ruleID: "rule1", entityID: "dev2", firingSeq: 1, eventType: AlertMetricSuppressed, severity: "warning", at: at},
+	})
+
+	assert.Equal(t, "INSERT INTO tp_alert_metrics (rule_id, entity_id, firing_seq, event_type, severity, latency_ms, at) VALUES "+
+		"('rule1', 'it''s', 3, 'fired', 'critical', 1500, to_datetime64('2024-05-01 10:00:00.000', 3, 'UTC')), "+
+		"('rule1', 'dev2', 1, 'suppressed', 'warning', NULL, to_datetime64('2024-05-01 10:00:00.000', 3, 'UTC'))", query)
+}
+
+func TestAlertMetricsFlushKeepsFailedWrites(t *testing.T) {
+	mockClient := new(MockClient)
+	metrics := NewAlertMetrics(mockClient)
+	metrics.Record(alertMetric{ruleID: "rule1", entityID: "dev1", firingSeq: 1, eventType: AlertMetricFired})
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), errors.New("timeplus unavailable")).Once()
+	metrics.Flush(context.Background())
+	assert.Equal(t, AlertMetricsStatus{Pending: 1}, metrics.Status())
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), nil)
+	metrics.Record(alertMetric{ruleID: "rule1", entityID: "dev1", firingSeq: 1, eventType: AlertMetricNotified})
+	metrics.Flush(context.Background())
+	assert.Equal(t, AlertMetricsStatus{Written: 2}, metrics.Status())
+
+	// Both rows are written in one insert, oldest first
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		fired, notified := strings.Index(query, "'fired'"), strings.Index(query, "'notified'")
+		return fired > 0 && notified > fired
+	}))
+}
+
+func TestAlertMetricsDropsOldestPastLimit(t *testing.T) {
+	metrics := NewAlertMetrics(new(MockClient))
+	for i := 0; i < maxPendingAlertMetrics+5; i++ {
+		metrics.Record(alertMetric{ruleID: "rule1", entityID: "dev1", firingSeq: int64(i), eventType: AlertMetricFired})
+	}
+
+	assert.Equal(t, AlertMetricsStatus{Dropped: 5, Pending: maxPendingAlertMetrics}, metrics.Status())
+	assert.Equal(t, int64(5), metrics.pending[0].firingSeq)
+}
+
+func TestAlertMonitorRecordsMetrics(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "severity": "critical"},
+	}, nil)
+
+	dispatcher := notify.NewDispatcher(10, 1, &recordingNotifier{})
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+	monitor.SetMetrics(NewAlertMetrics(mockClient))
+
+	firedAt := time.Now().Add(-time.Minute)
+	ctx := context.Background()
+	require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+		"rule_id": "rule1", "entity_id": "dev1", "state": timeplus.AlertStateActive, "firing_seq": uint64(1),
+		"created_at": firedAt, "updated_at": firedAt, "event_time": firedAt.Add(-2 * time.Second),
+	}))
+	require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+		"rule_id": "rule1", "entity_id": "dev1", "state": timeplus.AlertStateAcknowledged, "firing_seq": uint64(1),
+		"created_at": firedAt, "updated_at": firedAt.Add(30 * time.Second), "updated_by": "ops",
+	}))
+	dispatcher.Drain(ctx)
+
+	metrics := monitor.metrics.pending
+	require.Len(t, metrics, 3)
+	assert.Equal(t, AlertMetricFired, metrics[0].eventType)
+	assert.Equal(t, "critical", metrics[0].severity)
+	assert.Equal(t, 2*time.Second, *metrics[0].latency)
+	assert.Equal(t, AlertMetricNotified, metrics[1].eventType)
+	assert.GreaterOrEqual(t, *metrics[1].latency, time.Minute)
+	assert.Equal(t, notify.EventAcknowledged, metrics[2].eventType)
+	assert.Equal(t, 30*time.Second, *metrics[2].latency)
+	for _, metric := range metrics {
+		assert.Equal(t, "rule1", metric.ruleID)
+		assert.Equal(t, "dev1", metric.entityID)
+		assert.Equal(t, int64(1), metric.firingSeq)
+	}
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "INSERT INTO "+timeplus.AlertMetricsStream)
+	})).Return([]map[string]interface{}(nil), nil)
+	monitor.flushCheckpoints(ctx)
+	assert.Equal(t, int64(3), monitor.Status().Metrics.Written)
+}
@@ -2,140 +2,763 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	proton "github.com/timeplus-io/proton-go-driver/v2"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
 )
 
-// AlertMonitor manages connection to Timeplus for alerts
-// This is a simplified version that no longer uses polling Go routines.
-// Instead, we use materialized views that write directly to the alert acks stream.
-// This approach has several advantages:
-// 1. It's more efficient - no need for constant polling
-// 2. It's event-driven - updates happen in real-time
-// 3. It's more reliable - if the gateway is restarted, all state is preserved in Timeplus
-// 4. It's more scalable - we can handle many more rules without increasing load
+// AlertMonitor pushes alerts to the notification pipeline as rules fire. Rules' materialized views
+// write alerts to the alert acks streams; the monitor subscribes to those streams with streaming
+// queries, so each new firing is dispatched as a "fired" event without polling. Unless disabled with
+// SetStateChanges, later state changes of an alert are dispatched too: acknowledgements, silences
+// ("snoozed"), resolutions and reopenings, so external systems such as ticketing can follow an alert.
+//
+// The global acks stream is always watched, and the dedicated acks stream of each running rule that
+// has one. How far each stream has been read is checkpointed in MonitorCheckpointsStream, so alerts
+// that fire while the gateway is down are dispatched after a restart. A checkpoint only moves past a
+// row once the events dispatched for it were delivered, so alerts still queued when the gateway stops
+// aren't skipped. Delivery is at-least-once: an alert may be dispatched again after a restart, unless
+// events are recorded in the notification outbox, which delivers each of them once. With SetMetrics,
+// what happens to each alert is also recorded in AlertMetricsStream.
 type AlertMonitor struct {
-	conn          proton.Conn
-	ruleService   *RuleService
-	alertStream   string
-	tpAddress     string
-	tpUsername    string
-	tpPassword    string
-	tpDatabase    string
-	tpClient      timeplus.TimeplusClient
-	serverAddress string
+	ruleService *RuleService
+	tpClient    timeplus.MonitorStore
+	streamer    *timeplus.Streamer
+
+	checkpointInterval time.Duration // Time between checkpoint writes
+	ruleCacheTTL       time.Duration // How long rule details are reused for dispatched alerts
+	stateChanges       bool          // Whether state changes are dispatched, not only firings
+	metrics            *AlertMetrics // Records lifecycle events in AlertMetricsStream, nil when disabled
+
+	mu          sync.Mutex
+	ruleStreams map[string]string // Dedicated acks stream watched for each rule
+	lastFiring  map[string]int64  // Latest firing handled, by rule and entity
+	// Firings whose dispatch failed and that the streamer handles again, by rule and entity
+	failedFiring map[string]int64
+	lastState    map[string]seenState // Latest state seen, by rule and entity
+	// Checkpoints by acks stream, and those waiting for the events dispatched before them to be delivered
+	checkpoints *timeplus.CheckpointStore
+	awaiting    map[string][]awaitingCheckpoint
+	rules       map[string]cachedRule
+	dispatched  int64
+	failed      int64
+	suppressed  int64
+	inhibited   int64
+	filtered    int64
+	correlated  int64
+	// Notifications of new incidents waiting for more alerts to join, by incident ID
+	pendingIncidents map[string]*pendingIncident
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// seenState is the state of an entity's latest firing as the monitor last saw it
+type seenState struct {
+	firingSeq int64
+	eventType string // The event the state was dispatched as, e.g. "fired" or "acknowledged"
+	state     string
+	notified  bool // Whether the firing was notified, rather than suppressed or inhibited
+}
+
+// awaitingCheckpoint is a checkpoint that can be recorded once the dispatcher delivered every event
+// queued up to seq
+type awaitingCheckpoint struct {
+	checkpoint timeplus.Checkpoint
+	seq        uint64
+}
+
+// pendingIncident is the notification of a new incident, sent when its group wait is over
+type pendingIncident struct {
+	timer *time.Timer
+	event notify.Event
+}
+
+type cachedRule struct {
+	rule      *models.Rule
+	fetchedAt time.Time
+}
+
+// AlertMonitorStatus describes the monitor's subscriptions and what it has dispatched
+type AlertMonitorStatus struct {
+	Streams        []timeplus.StreamStatus `json:"streams"`
+	Dispatched     int64                   `json:"dispatched"`
+	DispatchErrors int64                   `json:"dispatchErrors"`
+	Suppressed     int64                   `json:"suppressed"` // Not notified while a rule they depend on was active
+	Inhibited      int64                   `json:"inhibited"`  // Not notified while a more severe alert was active for the entity
+	Filtered       int64                   `json:"filtered"`   // Not notified because their rule's suppress expression matched
+	Correlated     int64                   `json:"correlated"` // Not notified on their own, they joined a notified incident
+	Metrics        *AlertMetricsStatus     `json:"metrics,omitempty"`
 }
 
 // NewAlertMonitor creates a new alert monitor
-func NewAlertMonitor(ruleService *RuleService, alertStream, tpAddress, tpUsername, tpPassword, tpDatabase string, tpClient timeplus.TimeplusClient, serverAddress string) *AlertMonitor {
+func NewAlertMonitor(ruleService *RuleService, tpClient timeplus.MonitorStore) *AlertMonitor {
 	return &AlertMonitor{
-		ruleService:   ruleService,
-		alertStream:   alertStream,
-		tpAddress:     tpAddress,
-		tpUsername:    tpUsername,
-		tpPassword:    tpPassword,
-		tpDatabase:    tpDatabase,
-		tpClient:      tpClient,
-		serverAddress: serverAddress,
+		ruleService:        ruleService,
+		tpClient:           tpClient,
+		streamer:           timeplus.NewStreamer(tpClient),
+		checkpointInterval: 5 * time.Second,
+		ruleCacheTTL:       time.Minute,
+		stateChanges:       true,
+		ruleStreams:        make(map[string]string),
+		lastFiring:         make(map[string]int64),
+		failedFiring:       make(map[string]int64),
+		lastState:          make(map[string]seenState),
+		checkpoints:        timeplus.NewCheckpointStore(tpClient),
+		awaiting:           make(map[string][]awaitingCheckpoint),
+		rules:              make(map[string]cachedRule),
+		pendingIncidents:   make(map[string]*pendingIncident),
 	}
 }
 
-// Start initializes the alert monitor
+// SetStateChanges sets whether state changes of alerts are dispatched, not only firings. It must be
+// called before Start.
+func (am *AlertMonitor) SetStateChanges(enabled bool) {
+	am.stateChanges = enabled
+}
+
+// SetMetrics makes the monitor record alert lifecycle events in AlertMetricsStream. It must be
+// called before Start.
+func (am *AlertMonitor) SetMetrics(metrics *AlertMetrics) {
+	am.metrics = metrics
+}
+
+// Start subscribes to the alert acks streams. Nothing is subscribed when no notifiers are configured.
 func (am *AlertMonitor) Start(ctx context.Context) error {
-	logrus.Info("Starting Alert Monitor service")
-	logrus.Info("Note: This is now using materialized views to write directly to tp_alert_acks_mutable - no polling is performed")
-
-	// Parse address to separate host and port
-	hostPort := am.tpAddress
-
-	// Connect to Timeplus using direct proton driver with more robust settings
-	opts := &proton.Options{
-		Addr: []string{hostPort},
-		Auth: proton.Auth{
-			Database: am.tpDatabase,
-			Username: am.tpUsername,
-			Password: am.tpPassword,
-		},
-		// More robust connection settings
-		DialTimeout:     10 * time.Second,
-		MaxOpenConns:    10,
-		MaxIdleConns:    5,
-		ConnMaxLifetime: time.Hour,
-		Compression: &proton.Compression{
-			Method: proton.CompressionLZ4,
-		},
+	if am.ruleService.dispatcher == nil {
+		logrus.Info("Alert monitor: no notifiers are configured, alerts won't be pushed")
+		return nil
 	}
 
-	// Create connection
-	conn, err := proton.Open(opts)
-	if err != nil {
-		return fmt.Errorf("failed to connect to Timeplus: %w", err)
+	if err := am.checkpoints.Load(ctx); err != nil {
+		return fmt.Errorf("alert monitor: %w", err)
 	}
-
-	// Test connection with multiple retries
-	var pingErr error
-	for i := 0; i < 5; i++ {
-		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		pingErr = conn.Ping(pingCtx)
-		cancel() // Always cancel context to prevent leaks
-
-		if pingErr == nil {
-			break // Success
+	if am.metrics != nil {
+		if err := am.metrics.Ensure(ctx); err != nil {
+			return fmt.Errorf("alert monitor: %w", err)
 		}
+	}
 
-		logrus.Warnf("Failed to ping Timeplus (attempt %d/5): %v", i+1, pingErr)
-		time.Sleep(2 * time.Second)
+	for _, stream := range timeplus.AlertAcksStreams() {
+		if err := am.watch(stream); err != nil {
+			return err
+		}
 	}
 
-	if pingErr != nil {
-		conn.Close() // Clean up the connection
-		return fmt.Errorf("failed to ping Timeplus after multiple attempts: %w", pingErr)
+	rules, err := am.ruleService.GetRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %w", err)
 	}
+	for _, rule := range rules {
+		if ruleEvaluating(rule) {
+			am.watchRule(rule)
+		}
+	}
+
+	// Rules started and stopped from now on are watched through the rule service
+	am.ruleService.alertMonitor.Store(am)
 
-	am.conn = conn
-	logrus.Info("Alert Monitor successfully connected to Timeplus")
+	loopCtx, cancel := context.WithCancel(context.Background())
+	am.cancel = cancel
+	am.done = make(chan struct{})
+	go am.checkpointLoop(loopCtx)
 
+	logrus.Infof("Alert monitor started, watching %d alert acks stream(s)", len(am.streamer.Status()))
 	return nil
 }
 
-// Shutdown stops the monitor and closes connections
+// Shutdown stops the subscriptions and writes their checkpoints
 func (am *AlertMonitor) Shutdown() {
 	logrus.Info("Shutting down Alert Monitor service")
+	if am.cancel == nil {
+		return
+	}
+
+	am.ruleService.alertMonitor.Store(nil)
+	am.cancel()
+	<-am.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := am.streamer.Shutdown(ctx); err != nil {
+		logrus.Warnf("Alert monitor: streams did not stop: %v", err)
+	}
+	am.flushIncidents()
+	am.awaitDelivery(ctx)
+	am.flushCheckpoints(ctx)
+}
 
-	if am.conn != nil {
-		am.conn.Close()
+// Status returns the monitor's subscriptions and dispatch counts
+func (am *AlertMonitor) Status() AlertMonitorStatus {
+	streams := am.streamer.Status()
+
+	var metrics *AlertMetricsStatus
+	if am.metrics != nil {
+		status := am.metrics.Status()
+		metrics = &status
+	}
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return AlertMonitorStatus{
+		Streams:        streams,
+		Dispatched:     am.dispatched,
+		DispatchErrors: am.failed,
+		Suppressed:     am.suppressed,
+		Inhibited:      am.inhibited,
+		Filtered:       am.filtered,
+		Correlated:     am.correlated,
+		Metrics:        metrics,
 	}
 }
 
-// StartMonitoringRule is now a no-op since we use materialized views
-// When a rule is created, a materialized view is automatically set up that:
-// 1. Reads from the rule's result stream
-// 2. Writes to the tp_alert_acks_mutable stream
-// 3. Updates in real-time whenever new alerts are triggered
-// This approach eliminates the need for polling and scales better for many rules
+// StartMonitoringRule watches the dedicated alert acks stream of a rule, if it has one
 func (am *AlertMonitor) StartMonitoringRule(ctx context.Context, ruleID string) error {
-	logrus.Infof("Rule monitoring for %s is now handled by materialized views (no-op)", ruleID)
+	rule, err := am.ruleService.GetRule(ctx, ruleID)
+	if err != nil {
+		return err
+	}
+	am.watchRule(rule)
 	return nil
 }
 
-// StopMonitoringRule is now a no-op since we use materialized views
-// When a rule is stopped, the corresponding materialized view is dropped
+// StopMonitoringRule stops watching the dedicated alert acks stream of a rule
 func (am *AlertMonitor) StopMonitoringRule(ruleID string) {
-	logrus.Infof("Stopping rule monitoring for %s is now handled by materialized views (no-op)", ruleID)
+	am.mu.Lock()
+	stream, ok := am.ruleStreams[ruleID]
+	delete(am.ruleStreams, ruleID)
+	delete(am.rules, ruleID)
+	am.mu.Unlock()
+
+	if ok && am.streamer.Stop(stream) {
+		logrus.Infof("Alert monitor: stopped watching %s of rule %s", stream, ruleID)
+	}
+}
+
+// forgetRule drops a rule's cached details, so the next alert of the rule reads it again
+func (am *AlertMonitor) forgetRule(ruleID string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	delete(am.rules, ruleID)
+}
+
+// watchRule watches a rule's dedicated acks stream. Rules using the global stream are already covered.
+func (am *AlertMonitor) watchRule(rule *models.Rule) {
+	res := getRuleResources(rule)
+	am.mu.Lock()
+	delete(am.rules, rule.ID) // The rule may have changed
+	am.mu.Unlock()
+	// Shadow rules write no alerts to their acks stream
+	if !res.DedicatedAcksStream || rule.Shadow {
+		return
+	}
+
+	if err := am.watch(res.AlertAcksStream); err != nil {
+		logrus.Warnf("Alert monitor: failed to watch %s of rule %s: %v", res.AlertAcksStream, rule.ID, err)
+		return
+	}
+	am.mu.Lock()
+	am.ruleStreams[rule.ID] = res.AlertAcksStream
+	am.mu.Unlock()
+}
+
+// watch subscribes to an alert acks stream, resuming from its checkpoint
+func (am *AlertMonitor) watch(stream string) error {
+	spec := timeplus.StreamSpec{
+		Name:    stream,
+		Query:   am.query(stream),
+		Handler: am.handleAckRow,
+		OnCheckpoint: func(checkpoint timeplus.Checkpoint) {
+			am.checkpointHandled(stream, checkpoint)
+		},
+	}
+	if checkpoint, ok := am.checkpoints.Get(stream); ok {
+		spec.Checkpoint = &checkpoint.Time
+		spec.CheckpointRows = checkpoint.Rows
+	}
+
+	err := am.streamer.Start(spec)
+	if err != nil && !errors.Is(err, timeplus.ErrStreamExists) {
+		return fmt.Errorf("failed to watch %s: %w", stream, err)
+	}
+	return nil
+}
+
+// firedAlertsQuery returns the streaming query for the alerts a rule's materialized view writes to an
+// acks stream. Rows written by the API, such as acknowledgements, have updated_by set.
+func firedAlertsQuery(stream string) string {
+	return fmt.Sprintf(`SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, severity, firing_seq, _tp_time
+FROM `+"`%s`"+`
+WHERE state = '%s' AND updated_by = ''`, stream, timeplus.AlertStateActive)
+}
+
+// query returns the streaming query of an acks stream for the events the monitor dispatches
+func (am *AlertMonitor) query(stream string) string {
+	if am.stateChanges {
+		return alertStatesQuery(stream)
+	}
+	return firedAlertsQuery(stream)
+}
+
+// alertStatesQuery returns the streaming query for fired alerts and their state changes. Backfilled
+// alerts are the only rows left out: they are recorded but never notified.
+func alertStatesQuery(stream string) string {
+	return fmt.Sprintf(`SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, severity, firing_seq, reference, _tp_time
+FROM `+"`%s`"+`
+WHERE state != '%s' OR updated_by != '%s'`, stream, timeplus.AlertStateActive, backfillActor)
+}
+
+// transitionEvent returns the state change event type of an acks row, or "" for rows written by a
+// rule's materialized view as it fires
+func transitionEvent(row map[string]interface{}) string {
+	switch getString(row, "state") {
+	case timeplus.AlertStateAcknowledged:
+		return notify.EventAcknowledged
+	case timeplus.AlertStateSilenced:
+		return notify.EventSnoozed
+	case timeplus.AlertStateResolved:
+		return notify.EventResolved
+	case timeplus.AlertStateActive:
+		// UnacknowledgeAlert copies the alert back as active with who reopened it
+		if updatedBy := getString(row, "updated_by"); updatedBy != "" && updatedBy != backfillActor {
+			return notify.EventReopened
+		}
+	}
+	return ""
 }
 
-// ensureConnection ensures we have a valid connection to Timeplus
-func (am *AlertMonitor) ensureConnection(ctx context.Context) error {
-	// Test connection by running a simple query
-	_, err := am.tpClient.ExecuteQuery(ctx, "SELECT 1")
+// handleAckRow dispatches a fired event for a new firing. The materialized view writes an active row
+// again when an alert keeps firing past its throttle window; those rows have the same firing_seq and
+// aren't dispatched again. A firing is only marked handled once it was dispatched or filtered, so the
+// row of a firing whose dispatch failed is dispatched when the streamer handles it again.
+func (am *AlertMonitor) handleAckRow(ctx context.Context, row map[string]interface{}) error {
+	if eventType := transitionEvent(row); eventType != "" {
+		return am.handleTransition(ctx, row, eventType)
+	}
+
+	ruleID := getString(row, "rule_id")
+	key := ruleID + ":" + getString(row, "entity_id")
+	firingSeq := getInt64(row, "firing_seq")
+
+	am.mu.Lock()
+	if last, ok := am.lastFiring[key]; ok && firingSeq <= last {
+		am.mu.Unlock()
+		return nil
+	}
+	failed, retried := am.failedFiring[key]
+	retried = retried && failed == firingSeq
+	am.mu.Unlock()
+
+	rule := am.rule(ctx, ruleID)
+	alert := am.ruleService.alertFromAckRow(ctx, row, rule)
+	if !retried {
+		am.recordMetric(alert.ID, AlertMetricFired, alert.Severity, latencyBetween(getTime(row, "event_time"), getTime(row, "updated_at")))
+	}
+
+	// The rule's script may filter the alert, or change the severity inhibitions compare
+	if am.ruleService.applyAlertScript(ctx, alert, rule, getString(row, "entity_id"), firingSeq, alertRowData(ctx, row)) {
+		am.mu.Lock()
+		am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive}
+		am.firingHandled(key, firingSeq)
+		am.filtered++
+		am.mu.Unlock()
+		am.recordMetric(alert.ID, AlertMetricFiltered, alert.Severity, nil)
+		return nil
+	}
+
+	// Alerts of rules depending on an active rule are recorded but not notified
+	if rule != nil && len(rule.DependsOn) > 0 {
+		entityID := getString(row, "entity_id")
+		reason, err := am.ruleService.suppressingDependency(ctx, rule, entityID)
+		if err != nil {
+			// Notifying too much beats missing an alert
+			logrus.Warnf("Alert monitor: failed to check dependencies of alert %s, notifying: %v", alert.ID, err)
+		} else if reason != "" {
+			am.ruleService.recordAlertAudit(ctx, ruleID, entityID, firingSeq, timeplus.AlertAuditActionSuppressed, "dependency", reason)
+			am.mu.Lock()
+			am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive}
+			am.firingHandled(key, firingSeq)
+			am.suppressed++
+			am.mu.Unlock()
+			am.recordMetric(alert.ID, AlertMetricSuppressed, alert.Severity, nil)
+			return nil
+		}
+	}
+	if reason, err := am.ruleService.inhibitingAlert(ctx, alert, getString(row, "entity_id")); err != nil {
+		logrus.Warnf("Alert monitor: failed to check inhibitions of alert %s, notifying: %v", alert.ID, err)
+	} else if reason != "" {
+		am.ruleService.recordAlertAudit(ctx, ruleID, getString(row, "entity_id"), firingSeq, timeplus.AlertAuditActionInhibited, "inhibition", reason)
+		am.mu.Lock()
+		am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive}
+		am.firingHandled(key, firingSeq)
+		am.inhibited++
+		am.mu.Unlock()
+		am.recordMetric(alert.ID, AlertMetricInhibited, alert.Severity, nil)
+		return nil
+	}
+
+	// An incident is notified once, by the alert that opened it; the alerts joining it are only recorded
+	incident, opened := am.correlate(ctx, alert, getString(row, "entity_id"))
+	if incident != nil && !opened {
+		am.ruleService.recordAlertAudit(ctx, ruleID, getString(row, "entity_id"), firingSeq, timeplus.AlertAuditActionCorrelated, incidentActor,
+			fmt.Sprintf("Grouped into incident %s", incident.ID))
+		am.mu.Lock()
+		am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive}
+		am.firingHandled(key, firingSeq)
+		am.correlated++
+		am.mu.Unlock()
+		am.recordMetric(alert.ID, AlertMetricCorrelated, alert.Severity, nil)
+		return nil
+	}
+
+	// Hooks add context only to alerts that are notified
+	am.ruleService.runEnrichmentHooks(ctx, alert, rule, getString(row, "entity_id"), firingSeq, alertRowData(ctx, row))
+
+	event := am.ruleService.notificationEvent(notify.EventFired, alert, rule)
+	if incident != nil {
+		event.Incident = incident
+		if wait := am.ruleService.incidents.Config().GroupWait; wait > 0 {
+			// Sent once the group wait is over, with the alerts that joined the incident meanwhile
+			am.mu.Lock()
+			defer am.mu.Unlock()
+			am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive, notified: true}
+			am.firingHandled(key, firingSeq)
+			incidentID := incident.ID
+			am.pendingIncidents[incidentID] = &pendingIncident{
+				event: event,
+				timer: time.AfterFunc(wait, func() { am.dispatchIncident(incidentID) }),
+			}
+			return nil
+		}
+	}
+	err := am.dispatch(ctx, event)
+	am.recordDispatchMetric(alert, err)
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.lastState[key] = seenState{firingSeq: firingSeq, eventType: notify.EventFired, state: timeplus.AlertStateActive, notified: err == nil}
 	if err != nil {
-		logrus.Errorf("Failed to connect to Timeplus: %v", err)
-		return err
+		am.failedFiring[key] = firingSeq
+		am.failed++
+		return fmt.Errorf("failed to dispatch alert %s: %w", alert.ID, err)
+	}
+	am.firingHandled(key, firingSeq)
+	am.dispatched++
+	return nil
+}
+
+// firingHandled records that a firing was dispatched or filtered, so rows repeating it are skipped.
+// Must be called with mu held.
+func (am *AlertMonitor) firingHandled(key string, firingSeq int64) {
+	am.lastFiring[key] = firingSeq
+	delete(am.failedFiring, key)
+}
+
+// handleTransition dispatches a state change of an alert. Changes of older firings than the latest
+// seen, changes already dispatched, and changes of firings that weren't notified are skipped.
+func (am *AlertMonitor) handleTransition(ctx context.Context, row map[string]interface{}, eventType string) error {
+	ruleID := getString(row, "rule_id")
+	key := ruleID + ":" + getString(row, "entity_id")
+	firingSeq := getInt64(row, "firing_seq")
+	state := getString(row, "state")
+
+	if incidents := am.ruleService.incidents; incidents != nil {
+		incidents.AlertChanged(ctx, FormatAlertID(ruleID, getString(row, "entity_id"), firingSeq), state)
+	}
+
+	// Changes are recorded as metrics whether or not their firing was notified
+	transitionLatency := latencyBetween(getTime(row, "created_at"), getTime(row, "updated_at"))
+
+	am.mu.Lock()
+	last, seen := am.lastState[key]
+	if seen && (firingSeq < last.firingSeq || (firingSeq == last.firingSeq && last.eventType == eventType)) {
+		am.mu.Unlock()
+		return nil
+	}
+	if seen && firingSeq == last.firingSeq && !last.notified {
+		am.lastState[key] = seenState{firingSeq: firingSeq, eventType: eventType, state: state}
+		am.mu.Unlock()
+		severity := models.RuleSeverity(getString(row, "severity"))
+		if rule := am.rule(ctx, ruleID); severity == "" && rule != nil {
+			severity = rule.Severity
+		}
+		am.recordMetric(FormatAlertID(ruleID, getString(row, "entity_id"), firingSeq), eventType, severity, transitionLatency)
+		return nil
+	}
+	from := ""
+	if seen && firingSeq == last.firingSeq {
+		from = last.state
 	}
-	logrus.Info("Successfully connected to Timeplus")
+	am.lastState[key] = seenState{firingSeq: firingSeq, eventType: eventType, state: state, notified: true}
+	am.mu.Unlock()
+
+	rule := am.rule(ctx, ruleID)
+	alert := am.ruleService.alertFromAckRow(ctx, row, rule)
+	am.recordMetric(alert.ID, eventType, alert.Severity, transitionLatency)
+	event := am.ruleService.notificationEvent(eventType, alert, rule)
+	event.Transition = &notify.Transition{From: from, To: state, By: getString(row, "updated_by"), At: event.SentAt}
+	if updatedAt, ok := row["updated_at"].(time.Time); ok {
+		event.Transition.At = updatedAt
+	}
+	err := am.dispatch(ctx, event)
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	if err != nil {
+		// Forget the change unless a later one was seen meanwhile, so it's dispatched when handled again
+		if current := am.lastState[key]; current.firingSeq == firingSeq && current.eventType == eventType {
+			if seen {
+				am.lastState[key] = last
+			} else {
+				delete(am.lastState, key)
+			}
+		}
+		am.failed++
+		return fmt.Errorf("failed to dispatch %s event of alert %s: %w", eventType, alert.ID, err)
+	}
+	am.dispatched++
 	return nil
 }
+
+// recordDispatchMetric records whether a firing was dispatched, with the time it took since it fired
+func (am *AlertMonitor) recordDispatchMetric(alert *models.Alert, err error) {
+	if err != nil {
+		am.recordMetric(alert.ID, AlertMetricNotifyFailed, alert.Severity, nil)
+		return
+	}
+	am.recordMetric(alert.ID, AlertMetricNotified, alert.Severity, latencyBetween(alert.TriggeredAt, time.Now()))
+}
+
+// correlate groups a notified alert into an incident, returning the incident and whether the alert
+// opened it. It returns nil when incidents aren't enabled or the alert couldn't be grouped.
+func (am *AlertMonitor) correlate(ctx context.Context, alert *models.Alert, entityID string) (*models.Incident, bool) {
+	incidents := am.ruleService.incidents
+	if incidents == nil {
+		return nil, false
+	}
+	incident, opened, err := incidents.Correlate(ctx, alert, entityID)
+	if err != nil {
+		// Notifying on its own beats missing an alert
+		logrus.Warnf("Alert monitor: failed to group alert %s into an incident, notifying: %v", alert.ID, err)
+		return nil, false
+	}
+	if incident != nil {
+		alert.IncidentID = incident.ID
+	}
+	return incident, opened
+}
+
+// dispatchIncident sends the notification of a new incident, with the incident as it is now
+func (am *AlertMonitor) dispatchIncident(incidentID string) {
+	am.mu.Lock()
+	pending, ok := am.pendingIncidents[incidentID]
+	delete(am.pendingIncidents, incidentID)
+	am.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	event := pending.event
+	if incident, err := am.ruleService.incidents.Get(context.Background(), incidentID); err == nil {
+		event.Incident = incident
+	}
+	err := am.dispatch(context.Background(), event)
+	am.recordDispatchMetric(event.Alert, err)
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	if err != nil {
+		am.failed++
+		logrus.Errorf("Alert monitor: failed to dispatch incident %s: %v", incidentID, err)
+		return
+	}
+	am.dispatched++
+}
+
+// dispatch records an event in the notification outbox when it's enabled, and queues it in the
+// dispatcher otherwise
+func (am *AlertMonitor) dispatch(ctx context.Context, event notify.Event) error {
+	if outbox := am.ruleService.outbox; outbox != nil {
+		return outbox.Record(ctx, event)
+	}
+	return am.ruleService.dispatcher.Dispatch(event)
+}
+
+// flushIncidents sends the notifications of new incidents still in their group wait
+func (am *AlertMonitor) flushIncidents() {
+	am.mu.Lock()
+	var waiting []string
+	for incidentID, pending := range am.pendingIncidents {
+		if pending.timer.Stop() {
+			waiting = append(waiting, incidentID)
+		}
+	}
+	am.mu.Unlock()
+
+	for _, incidentID := range waiting {
+		am.dispatchIncident(incidentID)
+	}
+}
+
+// rule returns a rule's details, reusing them for ruleCacheTTL so a burst of alerts doesn't query
+// the rules stream for each one
+func (am *AlertMonitor) rule(ctx context.Context, ruleID string) *models.Rule {
+	am.mu.Lock()
+	cached, ok := am.rules[ruleID]
+	am.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < am.ruleCacheTTL {
+		return cached.rule
+	}
+
+	rule, err := am.ruleService.GetRule(ctx, ruleID)
+	if err != nil {
+		logrus.Warnf("Alert monitor: failed to get rule %s: %v", ruleID, err)
+		rule = nil
+	}
+	am.mu.Lock()
+	am.rules[ruleID] = cachedRule{rule: rule, fetchedAt: time.Now()}
+	am.mu.Unlock()
+	return rule
+}
+
+// checkpointLoop writes checkpoints periodically rather than after every alert
+func (am *AlertMonitor) checkpointLoop(ctx context.Context) {
+	defer close(am.done)
+
+	ticker := time.NewTicker(am.checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			am.flushCheckpoints(ctx)
+		}
+	}
+}
+
+// checkpointHandled records the checkpoint of a handled row, once the events its handler queued
+// are delivered. Consecutive rows that queued nothing new only keep the latest checkpoint. Events
+// recorded in the notification outbox are kept until delivered, so those rows are checkpointed
+// right away.
+func (am *AlertMonitor) checkpointHandled(stream string, checkpoint timeplus.Checkpoint) {
+	if am.ruleService.dispatcher == nil || am.ruleService.outbox != nil {
+		am.checkpoints.Record(stream, checkpoint)
+		return
+	}
+	seq := am.ruleService.dispatcher.LastQueued()
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	awaiting := am.awaiting[stream]
+	if n := len(awaiting); n > 0 && awaiting[n-1].seq == seq {
+		awaiting[n-1].checkpoint = checkpoint
+		return
+	}
+	am.awaiting[stream] = append(awaiting, awaitingCheckpoint{checkpoint: checkpoint, seq: seq})
+}
+
+// recordDeliveredCheckpoints records the latest checkpoint of each stream whose events were delivered
+func (am *AlertMonitor) recordDeliveredCheckpoints() {
+	if am.ruleService.dispatcher == nil {
+		return
+	}
+	delivered := am.ruleService.dispatcher.Delivered()
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	for stream, awaiting := range am.awaiting {
+		ready := sort.Search(len(awaiting), func(i int) bool { return awaiting[i].seq > delivered })
+		if ready == 0 {
+			continue
+		}
+		am.checkpoints.Record(stream, awaiting[ready-1].checkpoint)
+		if ready == len(awaiting) {
+			delete(am.awaiting, stream)
+		} else {
+			am.awaiting[stream] = awaiting[ready:]
+		}
+	}
+}
+
+// awaitDelivery waits until the events queued so far are delivered or ctx is done, so the final
+// checkpoints cover as much as possible
+func (am *AlertMonitor) awaitDelivery(ctx context.Context) {
+	dispatcher := am.ruleService.dispatcher
+	if dispatcher == nil {
+		return
+	}
+	queued := dispatcher.LastQueued()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for dispatcher.Delivered() < queued {
+		select {
+		case <-ctx.Done():
+			logrus.Warnf("Alert monitor: queued alerts weren't delivered before shutdown, they will be dispatched again after a restart")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushCheckpoints writes the checkpoints that advanced since the last write, and the alert metrics
+// recorded meanwhile
+func (am *AlertMonitor) flushCheckpoints(ctx context.Context) {
+	am.recordDeliveredCheckpoints()
+	am.checkpoints.Flush(ctx)
+	if am.metrics != nil {
+		am.metrics.Flush(ctx)
+	}
+}
+
+// recordMetric records a lifecycle event of an alert when alert metrics are enabled
+func (am *AlertMonitor) recordMetric(alertID, eventType string, severity models.RuleSeverity, latency *time.Duration) {
+	if am.metrics == nil {
+		return
+	}
+	ruleID, entityID, firingSeq, _, err := parseAlertID(alertID)
+	if err != nil {
+		return
+	}
+	am.metrics.Record(alertMetric{
+		ruleID:    ruleID,
+		entityID:  entityID,
+		firingSeq: firingSeq,
+		eventType: eventType,
+		severity:  string(severity),
+		latency:   latency,
+	})
+}
+
+// monitorRuleStarted starts watching a started rule's dedicated acks stream, if the monitor is running
+func (s *RuleService) monitorRuleStarted(rule *models.Rule) {
+	if am := s.alertMonitor.Load(); am != nil {
+		am.watchRule(rule)
+	}
+}
+
+// monitorRuleStopped stops watching a stopped rule's dedicated acks stream, if the monitor is running
+func (s *RuleService) monitorRuleStopped(ruleID string) {
+	if am := s.alertMonitor.Load(); am != nil {
+		am.StopMonitoringRule(ruleID)
+	}
+}
+
+// alertMonitorStatus returns the status of the alert monitor, nil if it isn't running
+func (s *RuleService) alertMonitorStatus() *AlertMonitorStatus {
+	am := s.alertMonitor.Load()
+	if am == nil {
+		return nil
+	}
+	status := am.Status()
+	return &status
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestAlertMonitorDispatchesNewFirings(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "severity": "critical"},
+	}, nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+
+	row := func(firingSeq uint64) map[string]interface{} {
+		return map[string]interface{}{
+			"rule_id": "rule1", "entity_id": "dev1", "state": timeplus.AlertStateActive, "firing_seq": firingSeq,
+			"comment": `{"temperature": 35.5}`, "created_at": time.Now(), "_tp_time": time.Now(),
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, monitor.handleAckRow(ctx, row(1)))
+	// Still firing past the throttle window, or delivered again after resuming
+	require.NoError(t, monitor.handleAckRow(ctx, row(1)))
+	require.NoError(t, monitor.handleAckRow(ctx, row(2)))
+
+	require.Equal(t, 0, dispatcher.Drain(ctx))
+	require.Len(t, recorder.events, 2)
+	assert.Equal(t, notify.EventFired, recorder.events[0].Type)
+	assert.Equal(t, "rule1:dev1:1", recorder.events[0].Alert.ID)
+	assert.Equal(t, "High temp", recorder.events[0].Alert.RuleName)
+	assert.Equal(t, "rule1:dev1:2", recorder.events[1].Alert.ID)
+	assert.Equal(t, int64(2), monitor.Status().Dispatched)
+
+	// Rule details are cached between alerts
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
+
+func TestAlertMonitorCountsDispatchErrors(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), nil)
+
+	dispatcher := notify.NewDispatcher(10, 1)
+	dispatcher.Drain(context.Background())
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+
+	err := monitor.handleAckRow(context.Background(), map[string]interface{}{"rule_id": "rule1", "entity_id": "dev1", "firing_seq": uint64(1)})
+	assert.ErrorIs(t, err, notify.ErrDispatcherClosed)
+	assert.Equal(t, int64(1), monitor.Status().DispatchErrors)
+}
+
+func TestAlertMonitorIdleWithoutNotifiers(t *testing.T) {
+	mockClient := new(MockClient)
+	monitor := NewAlertMonitor(&RuleService{tpClient: mockClient}, mockClient)
+
+	require.NoError(t, monitor.Start(context.Background()))
+	monitor.Shutdown()
+	mockClient.AssertNotCalled(t, "EnsureMutableStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFiredAlertsQuery(t *testing.T) {
+	query := firedAlertsQuery("rule_abc_alert_acks")
+	assert.Contains(t, query, "FROM `rule_abc_alert_acks`")
+	assert.Contains(t, query, "_tp_time")
+	assert.Contains(t, query, "WHERE state = 'active' AND updated_by = ''")
+}
+
+func TestAlertMonitorDispatchesStateChanges(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "severity": "critical"},
+	}, nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+
+	ackedAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	row := func(firingSeq uint64, state, updatedBy string) map[string]interface{} {
+		return map[string]interface{}{
+			"rule_id": "rule1", "entity_id": "dev1", "state": state, "updated_by": updatedBy, "firing_seq": firingSeq,
+			"created_at": time.Now(), "updated_at": ackedAt, "_tp_time": time.Now(),
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, monitor.handleAckRow(ctx, row(1, timeplus.AlertStateActive, "")))
+	require.NoError(t, monitor.handleAckRow(ctx, row(1, timeplus.AlertStateAcknowledged, "alice")))
+	// Delivered again after resuming, or copied by a migration
+	require.NoError(t, monitor.handleAckRow(ctx, row(1, timeplus.AlertStateAcknowledged, "alice")))
+	require.NoError(t, monitor.handleAckRow(ctx, row(1, timeplus.AlertStateActive, "bob")))
+	require.NoError(t, monitor.handleAckRow(ctx, row(1, timeplus.AlertStateResolved, "auto-resolver")))
+	require.NoError(t, monitor.handleAckRow(ctx, row(3, timeplus.AlertStateSilenced, "ops")))
+	// Changes of older firings than the latest seen aren't notified
+	require.NoError(t, monitor.handleAckRow(ctx, row(2, timeplus.AlertStateAcknowledged, "alice")))
+
+	require.Equal(t, 0, dispatcher.Drain(ctx))
+	types := make([]string, len(recorder.events))
+	for i, event := range recorder.events {
+		types[i] = event.Type
+	}
+	assert.Equal(t, []string{notify.EventFired, notify.EventAcknowledged, notify.EventReopened, notify.EventResolved, notify.EventSnoozed}, types)
+
+	assert.Nil(t, recorder.events[0].Transition)
+	assert.Equal(t, &notify.Transition{From: timeplus.AlertStateActive, To: timeplus.AlertStateAcknowledged, By: "alice", At: ackedAt},
+		recorder.events[1].Transition)
+	assert.Equal(t, "rule1:dev1:1", recorder.events[1].Alert.ID)
+	assert.Equal(t, timeplus.AlertStateAcknowledged, recorder.events[2].Transition.From)
+	assert.Equal(t, "rule1:dev1:3", recorder.events[4].Alert.ID)
+	// The monitor never saw the third firing fire
+	assert.Empty(t, recorder.events[4].Transition.From)
+}
+
+func TestAlertStatesQuery(t *testing.T) {
+	monitor := NewAlertMonitor(&RuleService{}, nil)
+	assert.Contains(t, monitor.query("tp_alert_acks_mutable"), "WHERE state != 'active' OR updated_by != 'backfill'")
+
+	monitor.SetStateChanges(false)
+	assert.Equal(t, firedAlertsQuery("tp_alert_acks_mutable"), monitor.query("tp_alert_acks_mutable"))
+}
+
+func TestAlertMonitorFlushCheckpointsRetriesFailedWrites(t *testing.T) {
+	checkpoint := timeplus.Checkpoint{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Rows: 2}
+	columns := []string{"stream", "checkpoint", "rows", "updated_at"}
+	mockClient := new(MockClient)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.MonitorCheckpointsStream, columns, mock.Anything).Return(errors.New("EOF")).Once()
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.MonitorCheckpointsStream,
+		columns, mock.MatchedBy(func(values []interface{}) bool {
+			return values[0] == timeplus.AlertAcksMutableStream && values[1] == checkpoint.Time && values[2] == checkpoint.Rows
+		})).Return(nil).Once()
+
+	monitor := NewAlertMonitor(&RuleService{}, mockClient)
+	monitor.checkpointHandled(timeplus.AlertAcksMutableStream, checkpoint)
+
+	monitor.flushCheckpoints(context.Background())
+	assert.Equal(t, 1, monitor.checkpoints.Pending(), "failed write is kept for the next flush")
+	monitor.flushCheckpoints(context.Background())
+	assert.Equal(t, 0, monitor.checkpoints.Pending())
+	mockClient.AssertExpectations(t)
+}
+
+// gatedNotifier delivers an event each time its gate is opened
+type gatedNotifier struct {
+	gate chan struct{}
+}
+
+func (n *gatedNotifier) Name() string { return "gated" }
+
+func (n *gatedNotifier) Notify(ctx context.Context, event notify.Event) error {
+	<-n.gate
+	return nil
+}
+
+func TestAlertMonitorCheckpointsAfterDelivery(t *testing.T) {
+	first := timeplus.Checkpoint{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Rows: 1}
+	second := timeplus.Checkpoint{Time: first.Time.Add(time.Second), Rows: 1}
+	mockClient := new(MockClient)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.MonitorCheckpointsStream, mock.Anything, mock.Anything).Return(nil)
+
+	notifier := &gatedNotifier{gate: make(chan struct{})}
+	dispatcher := notify.NewDispatcher(10, 1, notifier)
+	service := &RuleService{}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+	stream := timeplus.AlertAcksMutableStream
+
+	// Each row queued an event that the notifier is still delivering
+	for _, checkpoint := range []timeplus.Checkpoint{first, second} {
+		require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{RuleID: "rule1"})))
+		monitor.checkpointHandled(stream, checkpoint)
+	}
+	monitor.flushCheckpoints(context.Background())
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	_, ok := monitor.checkpoints.Get(stream)
+	assert.False(t, ok, "nothing was delivered yet")
+
+	notifier.gate <- struct{}{}
+	require.Eventually(t, func() bool { return dispatcher.Delivered() == 1 }, 5*time.Second, time.Millisecond)
+	monitor.flushCheckpoints(context.Background())
+	checkpoint, _ := monitor.checkpoints.Get(stream)
+	assert.Equal(t, first, checkpoint, "the checkpoint stops before the undelivered alert")
+
+	notifier.gate <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	monitor.awaitDelivery(ctx)
+	monitor.flushCheckpoints(ctx)
+	checkpoint, _ = monitor.checkpoints.Get(stream)
+	assert.Equal(t, second, checkpoint)
+	assert.Empty(t, monitor.awaiting)
+	mockClient.AssertNumberOfCalls(t, "InsertIntoStream", 2)
+}
+
+// replayingAckStore serves an alert acks stream of fixed rows, resuming at seek_to like Timeplus,
+// and keeps the monitor's checkpoints
+type replayingAckStore struct {
+	timeplus.RuleStore
+	rows []map[string]interface{}
+
+	mu          sync.Mutex
+	checkpoints []map[string]interface{}
+}
+
+func (s *replayingAckStore) EnsureMutableStream(ctx context.Context, streamName string, schema []timeplus.Column, primaryKeys []string) error {
+	return nil
+}
+
+func (s *replayingAckStore) ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.Contains(query, timeplus.MonitorCheckpointsStream) {
+		return s.checkpoints, nil
+	}
+	return nil, nil
+}
+
+func (s *replayingAckStore) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	s.checkpoints = append(s.checkpoints, row)
+	return nil
+}
+
+func (s *replayingAckStore) StreamQuery(ctx context.Context, query string, callback func(row interface{})) error {
+	var seek time.Time
+	if i := strings.Index(query, "seek_to='"); i >= 0 {
+		seek, _ = time.Parse("2006-01-02 15:04:05.000", query[i+len("seek_to='"):len(query)-1])
+	}
+	for _, row := range s.rows {
+		if !row["_tp_time"].(time.Time).Before(seek) {
+			callback(row)
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAlertMonitorRedispatchesDroppedAlertAfterRestart(t *testing.T) {
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := func(entityID string, at time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"rule_id": "rule1", "entity_id": entityID, "state": timeplus.AlertStateActive, "firing_seq": uint64(1),
+			"created_at": at, "_tp_time": at,
+		}
+	}
+	store := &replayingAckStore{rows: []map[string]interface{}{row("dev1", first), row("dev2", first.Add(time.Second))}}
+	stream := timeplus.AlertAcksMutableStream
+
+	// The notifier is stuck on an earlier event, so dev1's alert takes the last room in the queue
+	// and dev2's is dropped
+	gate := make(chan struct{})
+	dispatcher := notify.NewDispatcher(1, 1, &gatedNotifier{gate: gate})
+	require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{ID: "earlier"})))
+	require.Eventually(t, func() bool { return dispatcher.Stats().Queued == 0 }, 5*time.Second, time.Millisecond)
+
+	service := &RuleService{tpClient: store, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, store)
+	monitor.SetStateChanges(false)
+	require.NoError(t, monitor.Start(context.Background()))
+	require.Eventually(t, func() bool { return monitor.Status().DispatchErrors == 1 }, 5*time.Second, time.Millisecond)
+
+	close(gate)
+	monitor.Shutdown()
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	checkpoint, _ := monitor.checkpoints.Get(stream)
+	assert.Equal(t, timeplus.Checkpoint{Time: first, Rows: 1}, checkpoint, "the checkpoint stops before the dropped alert")
+
+	// After a restart the dropped alert is dispatched again, and the delivered one isn't
+	recorder := &recordingNotifier{}
+	dispatcher = notify.NewDispatcher(10, 1, recorder)
+	service = &RuleService{tpClient: store, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor = NewAlertMonitor(service, store)
+	monitor.SetStateChanges(false)
+	require.NoError(t, monitor.Start(context.Background()))
+	require.Eventually(t, func() bool { return monitor.Status().Dispatched == 1 }, 5*time.Second, time.Millisecond)
+	monitor.Shutdown()
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, "rule1:dev2:1", recorder.events[0].Alert.ID)
+}
+
+func TestAlertMonitorRetriesDroppedAlert(t *testing.T) {
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := func(entityID string, at time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"rule_id": "rule1", "entity_id": entityID, "state": timeplus.AlertStateActive, "firing_seq": uint64(1),
+			"created_at": at, "_tp_time": at,
+		}
+	}
+	store := &replayingAckStore{rows: []map[string]interface{}{row("dev1", first), row("dev2", first.Add(time.Second))}}
+
+	// dev2's alert is dropped while the queue is full, then retried once there's room
+	gate := make(chan struct{})
+	dispatcher := notify.NewDispatcher(1, 1, &gatedNotifier{gate: gate})
+	require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{ID: "earlier"})))
+	require.Eventually(t, func() bool { return dispatcher.Stats().Queued == 0 }, 5*time.Second, time.Millisecond)
+
+	service := &RuleService{tpClient: store, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, store)
+	monitor.SetStateChanges(false)
+	require.NoError(t, monitor.Start(context.Background()))
+	require.Eventually(t, func() bool { return monitor.Status().DispatchErrors == 1 }, 5*time.Second, time.Millisecond)
+
+	close(gate)
+	require.Eventually(t, func() bool { return monitor.Status().Dispatched == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return dispatcher.Delivered() == dispatcher.LastQueued() }, 5*time.Second, time.Millisecond)
+	monitor.Shutdown()
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+
+	checkpoint, _ := monitor.checkpoints.Get(timeplus.AlertAcksMutableStream)
+	assert.Equal(t, timeplus.Checkpoint{Time: first.Add(time.Second), Rows: 1}, checkpoint, "the retried alert releases the checkpoint")
+}
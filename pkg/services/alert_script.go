@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/script"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// scriptActor records alerts filtered by a rule's script in the alert audit trail
+const scriptActor = "script"
+
+// validateAlertScript checks that the expressions of a rule's script compile
+func validateAlertScript(alertScript *models.AlertScript) error {
+	if alertScript == nil {
+		return nil
+	}
+	expressions := []struct{ field, source string }{
+		{"script.suppress", alertScript.Suppress},
+		{"script.severity", alertScript.Severity},
+		{"script.summary", alertScript.Summary},
+	}
+	for _, expression := range expressions {
+		if expression.source == "" {
+			continue
+		}
+		if _, err := script.Compile(expression.source); err != nil {
+			return fmt.Errorf("%w: invalid %s: %v", ErrInvalidRule, expression.field, err)
+		}
+	}
+	return nil
+}
+
+// compiledAlertScript is a rule's script compiled once for the version of the rule it came from.
+// Expressions that don't compile are nil.
+type compiledAlertScript struct {
+	source   models.AlertScript
+	suppress *script.Program
+	severity *script.Program
+	summary  *script.Program
+}
+
+// compiledAlertScript returns the compiled script of a rule, compiling it when the rule is new or
+// its script changed
+func (s *RuleService) compiledAlertScript(rule *models.Rule) *compiledAlertScript {
+	s.alertScriptsMutex.Lock()
+	defer s.alertScriptsMutex.Unlock()
+
+	if compiled, ok := s.alertScripts[rule.ID]; ok && compiled.source == *rule.Script {
+		return compiled
+	}
+
+	compile := func(field, source string) *script.Program {
+		if source == "" {
+			return nil
+		}
+		program, err := script.Compile(source)
+		if err != nil {
+			logrus.Warnf("Invalid %s of rule %s: %v", field, rule.ID, err)
+			return nil
+		}
+		return program
+	}
+	compiled := &compiledAlertScript{
+		source:   *rule.Script,
+		suppress: compile("script.suppress", rule.Script.Suppress),
+		severity: compile("script.severity", rule.Script.Severity),
+		summary:  compile("script.summary", rule.Script.Summary),
+	}
+	if s.alertScripts == nil {
+		s.alertScripts = make(map[string]*compiledAlertScript)
+	}
+	s.alertScripts[rule.ID] = compiled
+	return compiled
+}
+
+// forgetAlertScript drops the compiled script of a deleted rule
+func (s *RuleService) forgetAlertScript(ruleID string) {
+	s.alertScriptsMutex.Lock()
+	defer s.alertScriptsMutex.Unlock()
+	delete(s.alertScripts, ruleID)
+}
+
+// applyAlertScript evaluates a rule's script against a new alert. It reports whether the suppress
+// expression matched, recording the alert in its audit trail; otherwise the severity and summary
+// expressions modify the alert. An expression that fails is logged and ignored, so a broken script
+// never drops an alert.
+func (s *RuleService) applyAlertScript(ctx context.Context, alert *models.Alert, rule *models.Rule, entityID string, firingSeq int64, data map[string]interface{}) bool {
+	if rule == nil || rule.Script == nil {
+		return false
+	}
+
+	// Expressions see the same fields as templates, with the triggering row under data too
+	env := make(map[string]interface{}, len(data)+4)
+	for k, v := range data {
+		env[k] = v
+	}
+	env["data"] = data
+	env["rule_id"] = rule.ID
+	env["rule_name"] = rule.Name
+	env["severity"] = string(alert.Severity)
+
+	compiled := s.compiledAlertScript(rule)
+
+	if program := compiled.suppress; program != nil {
+		suppress, err := program.EvalBool(env)
+		if err != nil {
+			logrus.Warnf("Failed to evaluate script.suppress for alert %s, notifying: %v", alert.ID, err)
+		} else if suppress {
+			s.recordAlertAudit(ctx, rule.ID, entityID, firingSeq, timeplus.AlertAuditActionFiltered, scriptActor, rule.Script.Suppress)
+			return true
+		}
+	}
+
+	if program := compiled.severity; program != nil {
+		severity, err := program.EvalString(env)
+		switch {
+		case err != nil:
+			logrus.Warnf("Failed to evaluate script.severity for alert %s: %v", alert.ID, err)
+		case severity == "":
+			// Keeps the alert's severity
+		case !s.SeverityLevels().Valid(models.RuleSeverity(severity)):
+			logrus.Warnf("script.severity of rule %s returned unknown severity %q", rule.ID, severity)
+		default:
+			alert.Severity = models.RuleSeverity(severity)
+			env["severity"] = severity
+		}
+	}
+
+	if program := compiled.summary; program != nil {
+		summary, err := program.EvalString(env)
+		if err != nil {
+			logrus.Warnf("Failed to evaluate script.summary for alert %s: %v", alert.ID, err)
+		} else if summary != "" {
+			alert.Summary = summary
+		}
+	}
+	return false
+}
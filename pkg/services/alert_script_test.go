@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestValidateAlertScript(t *testing.T) {
+	assert.NoError(t, validateAlertScript(nil))
+	assert.NoError(t, validateAlertScript(&models.AlertScript{
+		Suppress: "data.env != 'prod'",
+		Severity: "data.cpu > 95 ? 'critical' : ''",
+		Summary:  "rule_name + ' on ' + data.host",
+	}))
+
+	err := validateAlertScript(&models.AlertScript{Severity: "data.cpu >"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Contains(t, err.Error(), "script.severity")
+}
+
+func TestApplyAlertScript(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+	service := &RuleService{tpClient: mockClient}
+
+	rule := &models.Rule{ID: "cpu-high", Name: "CPU high", Script: &models.AlertScript{
+		Suppress: "data.host startsWith 'test-'",
+		Severity: "cpu > 95 ? 'critical' : ''",
+		Summary:  "rule_name + ' on ' + host + ' (' + severity + ')'",
+	}}
+	ctx := context.Background()
+
+	alert := &models.Alert{ID: "cpu-high:db-1:1", Severity: models.RuleSeverity("warning")}
+	filtered := service.applyAlertScript(ctx, alert, rule, "db-1", 1, map[string]interface{}{"host": "db-1", "cpu": "97"})
+	assert.False(t, filtered)
+	assert.Equal(t, models.RuleSeverity("warning"), alert.Severity, "a failing expression leaves the alert alone")
+	assert.Equal(t, "CPU high on db-1 (warning)", alert.Summary)
+
+	alert = &models.Alert{ID: "cpu-high:db-1:2", Severity: models.RuleSeverity("warning")}
+	filtered = service.applyAlertScript(ctx, alert, rule, "db-1", 2, map[string]interface{}{"host": "db-1", "cpu": 97})
+	assert.False(t, filtered)
+	assert.Equal(t, models.RuleSeverity("critical"), alert.Severity)
+	assert.Equal(t, "CPU high on db-1 (critical)", alert.Summary)
+	mockClient.AssertNotCalled(t, "ExecuteQuery", mock.Anything, mock.Anything)
+
+	alert = &models.Alert{ID: "cpu-high:test-1:1"}
+	assert.True(t, service.applyAlertScript(ctx, alert, rule, "test-1", 1, map[string]interface{}{"host": "test-1"}))
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "'"+timeplus.AlertAuditActionFiltered+"', 'script'")
+	}))
+}
+
+func TestAlertScriptCompiledOncePerVersion(t *testing.T) {
+	service := &RuleService{}
+	rule := &models.Rule{ID: "cpu-high", Script: &models.AlertScript{Summary: "'v1'"}}
+
+	compiled := service.compiledAlertScript(rule)
+	assert.Same(t, compiled, service.compiledAlertScript(&models.Rule{ID: "cpu-high", Script: &models.AlertScript{Summary: "'v1'"}}),
+		"the same script is compiled once")
+
+	// An updated rule's script is compiled again
+	rule.Script = &models.AlertScript{Summary: "'v2'"}
+	alert := &models.Alert{ID: "cpu-high:db-1:1"}
+	service.applyAlertScript(context.Background(), alert, rule, "db-1", 1, nil)
+	assert.Equal(t, "v2", alert.Summary)
+	assert.NotSame(t, compiled, service.compiledAlertScript(rule))
+
+	service.forgetAlertScript(rule.ID)
+	assert.Empty(t, service.alertScripts)
+}
+
+func TestAlertMonitorFiltersAlertsWithScript(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "id = 'cpu-high'")
+	})).Return([]map[string]interface{}{
+		{"id": "cpu-high", "name": "CPU high", "script": `{"suppress":"data.env != 'prod'"}`},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+
+	ctx := context.Background()
+	for i, env := range []string{"staging", "prod"} {
+		require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+			"rule_id": "cpu-high", "entity_id": "host" + env, "state": timeplus.AlertStateActive, "firing_seq": uint64(i + 1),
+			"comment": `{"env":"` + env + `"}`, "created_at": time.Now(), "_tp_time": time.Now(),
+		}))
+	}
+
+	require.Equal(t, 0, dispatcher.Drain(ctx))
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, "cpu-high:hostprod:2", recorder.events[0].Alert.ID)
+	assert.Equal(t, int64(1), monitor.Status().Filtered)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// BenchmarkGetAlerts measures mapping 10k alert acks spread over 20 rules into alerts
+func BenchmarkGetAlerts(b *testing.B) {
+	out := logrus.StandardLogger().Out
+	logrus.SetOutput(io.Discard)
+	b.Cleanup(func() { logrus.SetOutput(out) })
+
+	now := time.Now()
+	acks := make([]map[string]interface{}, 10000)
+	for i := range acks {
+		severity := "warning"
+		acks[i] = map[string]interface{}{
+			"rule_id":    fmt.Sprintf("rule%d", i%20),
+			"entity_id":  fmt.Sprintf("device_%d", i),
+			"state":      timeplus.AlertStateActive,
+			"created_at": now.Add(-time.Duration(i) * time.Second),
+			"updated_at": now,
+			"updated_by": "",
+			"comment":    fmt.Sprintf(`{"device_id": "device_%d", "temperature": 35.5}`, i),
+			"severity":   &severity,
+			"firing_seq": uint64(1),
+		}
+	}
+
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table("+timeplus.AlertAcksMutableStream+")")
+	})).Return(acks, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Temperature Alert", "severity": "warning", "status": "running"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		alerts, err := service.GetAlerts(context.Background(), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(alerts) != len(acks) {
+			b.Fatalf("expected %d alerts, got %d", len(acks), len(alerts))
+		}
+	}
+}
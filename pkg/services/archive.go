@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/archive"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// archiveCheckpointPrefix prefixes the alert acks stream in the archiver's checkpoints, which share
+// MonitorCheckpointsStream with the alert monitor's
+const archiveCheckpointPrefix = "archive:"
+
+// AlertArchiveOptions configures what the alert archiver exports and where
+type AlertArchiveOptions struct {
+	OlderThan time.Duration  // Alerts resolved or acknowledged longer ago are archived
+	Format    archive.Format // File format of the archive objects
+	Prefix    string         // Key prefix of the archive objects
+	BatchSize int            // Alerts per archive object
+	Delete    bool           // Delete archived alerts from Timeplus
+}
+
+// AlertArchiveStatus reports the archiver's configuration and the progress of its runs
+type AlertArchiveStatus struct {
+	Enabled         bool       `json:"enabled"`
+	Destination     string     `json:"destination,omitempty"`
+	Format          string     `json:"format,omitempty"`
+	OlderThanDays   float64    `json:"olderThanDays,omitempty"`
+	Delete          bool       `json:"delete"`
+	Running         bool       `json:"running"`
+	Stream          string     `json:"stream,omitempty"` // Alert acks stream being archived
+	Pending         int64      `json:"pending"`          // Alerts to archive found by the current or last run
+	Archived        int64      `json:"archived"`         // Alerts archived by the current or last run
+	Deleted         int64      `json:"deleted"`          // Alerts deleted by the current or last run
+	LastObject      string     `json:"lastObject,omitempty"`
+	LastRunStarted  *time.Time `json:"lastRunStarted,omitempty"`
+	LastRunFinished *time.Time `json:"lastRunFinished,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	NextRun         *time.Time `json:"nextRun,omitempty"`
+	Runs            int64      `json:"runs"`
+	TotalArchived   int64      `json:"totalArchived"`
+	TotalDeleted    int64      `json:"totalDeleted"`
+}
+
+// AlertArchiver periodically exports resolved and acknowledged alerts older than a threshold from
+// the alert acks streams to an object store, optionally deleting them from Timeplus.
+//
+// Each stream is archived up to a cutoff, which is then checkpointed in MonitorCheckpointsStream so
+// the next run only exports alerts updated since. Alerts are exported at least once: a run
+// interrupted before its checkpoint is written exports the same alerts again.
+type AlertArchiver struct {
+	ruleService *RuleService
+	tpClient    timeplus.StreamStore
+	store       archive.Store
+	opts        AlertArchiveOptions
+
+	runMu  sync.Mutex // Serializes runs
+	mu     sync.Mutex
+	status AlertArchiveStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewAlertArchiver creates a new alert archiver
+func NewAlertArchiver(ruleService *RuleService, tpClient timeplus.StreamStore, store archive.Store, opts AlertArchiveOptions) *AlertArchiver {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10000
+	}
+	if opts.Format == "" {
+		opts.Format = archive.FormatJSONL
+	}
+	return &AlertArchiver{
+		ruleService: ruleService,
+		tpClient:    tpClient,
+		store:       store,
+		opts:        opts,
+		status: AlertArchiveStatus{
+			Enabled:       true,
+			Destination:   strings.TrimSuffix(store.Location()+"/"+strings.Trim(opts.Prefix, "/"), "/"),
+			Format:        string(opts.Format),
+			OlderThanDays: opts.OlderThan.Hours() / 24,
+			Delete:        opts.Delete,
+		},
+	}
+}
+
+// Start archives alerts every interval until Shutdown
+func (aa *AlertArchiver) Start(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if err := aa.tpClient.EnsureMutableStream(ctx, timeplus.MonitorCheckpointsStream,
+		timeplus.GetMonitorCheckpointsSchema(), []string{"stream"}); err != nil {
+		return fmt.Errorf("failed to ensure checkpoints stream: %w", err)
+	}
+
+	aa.ruleService.alertArchiver.Store(aa)
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	aa.cancel = cancel
+	aa.done = make(chan struct{})
+	aa.setNextRun(time.Now().Add(interval))
+
+	go func() {
+		defer close(aa.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-loopCtx.Done():
+				return
+			case <-ticker.C:
+				if err := aa.Run(loopCtx); err != nil {
+					logrus.Warnf("Alert archive run failed: %v", err)
+				}
+				aa.setNextRun(time.Now().Add(interval))
+			}
+		}
+	}()
+
+	logrus.Infof("Alert archiver started, exporting to %s every %s", aa.status.Destination, interval)
+	return nil
+}
+
+// Shutdown stops the archiver, waiting for a run in progress to stop
+func (aa *AlertArchiver) Shutdown() {
+	if aa.cancel == nil {
+		return
+	}
+	aa.ruleService.alertArchiver.Store(nil)
+	aa.cancel()
+	<-aa.done
+}
+
+// Status returns the archiver's configuration and progress
+func (aa *AlertArchiver) Status() AlertArchiveStatus {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	return aa.status
+}
+
+// Run archives the alerts of every alert acks stream that are due
+func (aa *AlertArchiver) Run(ctx context.Context) error {
+	aa.runMu.Lock()
+	defer aa.runMu.Unlock()
+
+	done, err := aa.ruleService.trackTask("archive alerts")
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	started := time.Now().UTC()
+	aa.update(func(status *AlertArchiveStatus) {
+		status.Running = true
+		status.Pending, status.Archived, status.Deleted = 0, 0, 0
+		status.LastRunStarted = &started
+		status.LastError = ""
+	})
+
+	streams, err := aa.streams(ctx)
+	if err == nil {
+		cutoff := started.Add(-aa.opts.OlderThan)
+		for _, stream := range streams {
+			if err = aa.archiveStream(ctx, stream, cutoff, started); err != nil {
+				break
+			}
+		}
+	}
+
+	finished := time.Now().UTC()
+	aa.update(func(status *AlertArchiveStatus) {
+		status.Running = false
+		status.Stream = ""
+		status.LastRunFinished = &finished
+		status.Runs++
+		if err != nil {
+			status.LastError = err.Error()
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	status := aa.Status()
+	if status.Archived > 0 {
+		logrus.Infof("Archived %d alert(s) to %s, deleted %d", status.Archived, status.Destination, status.Deleted)
+	}
+	return nil
+}
+
+// streams returns the partitions of the shared alert acks stream and the dedicated streams of rules
+func (aa *AlertArchiver) streams(ctx context.Context) ([]string, error) {
+	existing, err := aa.tpClient.ListStreams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+	rules, err := aa.ruleService.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := timeplus.AlertAcksStreams()
+	for _, rule := range rules {
+		res := getRuleResources(rule)
+		if res.DedicatedAcksStream && slices.Contains(existing, res.AlertAcksStream) && !slices.Contains(streams, res.AlertAcksStream) {
+			streams = append(streams, res.AlertAcksStream)
+		}
+	}
+	return streams, nil
+}
+
+// archiveStream exports the alerts of a stream updated between its checkpoint and the cutoff, a
+// batch per object, and checkpoints the cutoff
+func (aa *AlertArchiver) archiveStream(ctx context.Context, stream string, cutoff, started time.Time) error {
+	aa.update(func(status *AlertArchiveStatus) { status.Stream = stream })
+
+	where := fmt.Sprintf("state IN ('%s', '%s') AND updated_at < %s",
+		timeplus.AlertStateResolved, timeplus.AlertStateAcknowledged, timeplus.DateTime64(cutoff))
+	since, err := aa.checkpoint(ctx, stream)
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		where += fmt.Sprintf(" AND updated_at >= %s", timeplus.DateTime64(since))
+	}
+
+	rows, err := aa.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS count FROM table(`%s`) WHERE %s", stream, where))
+	if err != nil {
+		return fmt.Errorf("failed to count alerts to archive in %s: %w", stream, err)
+	}
+	if len(rows) > 0 {
+		pending := getInt64(rows[0], "count")
+		aa.update(func(status *AlertArchiveStatus) { status.Pending += pending })
+	}
+
+	// Page on the sort key, so rows deleted by earlier batches don't shift the pages
+	after := ""
+	for batch := 1; ; batch++ {
+		query := fmt.Sprintf(`SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq
+		FROM table(`+"`%s`"+`)
+		WHERE %s%s
+		ORDER BY updated_at, rule_id, entity_id
+		LIMIT %d`, stream, where, after, aa.opts.BatchSize)
+		rows, err := aa.tpClient.ExecuteQuery(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to read alerts to archive from %s: %w", stream, err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		records := make([]archive.Record, len(rows))
+		for i, row := range rows {
+			records[i] = archiveRecord(stream, row)
+		}
+		var buf bytes.Buffer
+		if err := archive.Encode(&buf, aa.opts.Format, records); err != nil {
+			return fmt.Errorf("failed to encode alerts of %s: %w", stream, err)
+		}
+		key := path.Join(aa.opts.Prefix, stream, fmt.Sprintf("%s-%04d.%s", started.Format("20060102T150405Z"), batch, aa.opts.Format.Extension()))
+		if err := aa.store.Put(ctx, key, buf.Bytes(), aa.opts.Format.ContentType()); err != nil {
+			return err
+		}
+		aa.update(func(status *AlertArchiveStatus) {
+			status.Archived += int64(len(records))
+			status.TotalArchived += int64(len(records))
+			status.LastObject = key
+		})
+
+		if aa.opts.Delete {
+			if err := aa.deleteArchived(ctx, stream, where, records); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < aa.opts.BatchSize {
+			break
+		}
+		last := records[len(records)-1]
+		after = fmt.Sprintf(" AND (updated_at, rule_id, entity_id) > (%s, '%s', '%s')",
+			timeplus.DateTime64(last.UpdatedAt),
+			strings.ReplaceAll(last.RuleID, "'", "''"), strings.ReplaceAll(last.EntityID, "'", "''"))
+	}
+
+	return aa.saveCheckpoint(ctx, stream, cutoff)
+}
+
+// deleteArchived deletes archived alerts from a stream. The archive filter is kept, so alerts that
+// fired again since they were read are not deleted.
+func (aa *AlertArchiver) deleteArchived(ctx context.Context, stream, where string, records []archive.Record) error {
+	keys := make([]string, len(records))
+	for i, record := range records {
+		keys[i] = fmt.Sprintf("('%s', '%s', %d)",
+			strings.ReplaceAll(record.RuleID, "'", "''"), strings.ReplaceAll(record.EntityID, "'", "''"), record.FiringSeq)
+	}
+	query := fmt.Sprintf("DELETE FROM `%s` WHERE %s AND (rule_id, entity_id, firing_seq) IN (%s)", stream, where, strings.Join(keys, ", "))
+	if err := aa.tpClient.ExecuteDDL(ctx, query); err != nil {
+		return fmt.Errorf("failed to delete archived alerts from %s: %w", stream, err)
+	}
+	aa.update(func(status *AlertArchiveStatus) {
+		status.Deleted += int64(len(records))
+		status.TotalDeleted += int64(len(records))
+	})
+	return nil
+}
+
+// checkpoint returns the cutoff a stream was last archived up to, zero if it never was
+func (aa *AlertArchiver) checkpoint(ctx context.Context, stream string) (time.Time, error) {
+	rows, err := aa.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT checkpoint FROM table(%s) WHERE stream = '%s'",
+		timeplus.MonitorCheckpointsStream, archiveCheckpointPrefix+stream))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read archive checkpoint of %s: %w", stream, err)
+	}
+	if len(rows) == 0 {
+		return time.Time{}, nil
+	}
+	return getTime(rows[0], "checkpoint"), nil
+}
+
+// saveCheckpoint records that a stream was archived up to the cutoff
+func (aa *AlertArchiver) saveCheckpoint(ctx context.Context, stream string, cutoff time.Time) error {
+	err := aa.tpClient.InsertIntoStream(ctx, timeplus.MonitorCheckpointsStream,
+		[]string{"stream", "checkpoint", "updated_at"}, []interface{}{archiveCheckpointPrefix + stream, cutoff, time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to write archive checkpoint of %s: %w", stream, err)
+	}
+	return nil
+}
+
+func (aa *AlertArchiver) update(change func(status *AlertArchiveStatus)) {
+	aa.mu.Lock()
+	defer aa.mu.Unlock()
+	change(&aa.status)
+}
+
+func (aa *AlertArchiver) setNextRun(at time.Time) {
+	aa.update(func(status *AlertArchiveStatus) { status.NextRun = &at })
+}
+
+// archiveRecord converts an alert acks row to an archive record
+func archiveRecord(stream string, row map[string]interface{}) archive.Record {
+	record := archive.Record{
+		RuleID:    getString(row, "rule_id"),
+		EntityID:  getString(row, "entity_id"),
+		FiringSeq: getInt64(row, "firing_seq"),
+		State:     getString(row, "state"),
+		Severity:  getString(row, "severity"),
+		CreatedAt: getTime(row, "created_at").UTC(),
+		UpdatedAt: getTime(row, "updated_at").UTC(),
+		UpdatedBy: getString(row, "updated_by"),
+		Comment:   getString(row, "comment"),
+		Stream:    stream,
+	}
+	record.AlertID = FormatAlertID(record.RuleID, record.EntityID, record.FiringSeq)
+	if eventTime := getTime(row, "event_time"); !eventTime.IsZero() {
+		eventTime = eventTime.UTC()
+		record.EventTime = &eventTime
+	}
+	return record
+}
+
+// AlertArchiveStatus returns the alert archiver's status, disabled when it isn't running
+func (s *RuleService) AlertArchiveStatus() AlertArchiveStatus {
+	if aa := s.alertArchiver.Load(); aa != nil {
+		return aa.Status()
+	}
+	return AlertArchiveStatus{}
+}
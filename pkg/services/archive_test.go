@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/archive"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// memoryStore keeps uploaded archive objects in memory
+type memoryStore struct {
+	objects map[string]string
+}
+
+func (m *memoryStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	m.objects[key] = string(data)
+	return nil
+}
+
+func (m *memoryStore) Location() string { return "s3://alerts" }
+
+func TestAlertArchiverExportsAndDeletesOldAlerts(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockClient := new(MockClient)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{timeplus.AlertAcksMutableStream}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{{"id": "r1", "status": "running"}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_monitor_checkpoints) WHERE stream = 'archive:tp_alert_acks_mutable'")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT count() AS count FROM table(`tp_alert_acks_mutable`) WHERE state IN ('resolved', 'acknowledged')")
+	})).Return([]map[string]interface{}{{"count": uint64(1)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT rule_id, entity_id, state")
+	})).Return([]map[string]interface{}{{
+		"rule_id": "r1", "entity_id": "host-1", "state": "resolved", "firing_seq": uint64(3),
+		"created_at": updatedAt.Add(-time.Hour), "updated_at": updatedAt,
+	}}, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.MonitorCheckpointsStream, mock.Anything, mock.Anything).Return(nil)
+
+	store := &memoryStore{objects: map[string]string{}}
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	archiver := NewAlertArchiver(service, mockClient, store, AlertArchiveOptions{
+		OlderThan: 7 * 24 * time.Hour, Format: archive.FormatJSONL, Prefix: "alerts/", BatchSize: 100, Delete: true,
+	})
+	require.NoError(t, archiver.Run(context.Background()))
+
+	status := archiver.Status()
+	assert.Equal(t, "s3://alerts/alerts", status.Destination)
+	assert.False(t, status.Running)
+	assert.Equal(t, int64(1), status.Pending)
+	assert.Equal(t, int64(1), status.Archived)
+	assert.Equal(t, int64(1), status.Deleted)
+	assert.Equal(t, int64(1), status.Runs)
+	assert.Empty(t, status.LastError)
+
+	require.Len(t, store.objects, 1)
+	assert.True(t, strings.HasPrefix(status.LastObject, "alerts/tp_alert_acks_mutable/"))
+	assert.Contains(t, store.objects[status.LastObject], `"alertId":"r1:host-1:3"`)
+
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "DELETE FROM `tp_alert_acks_mutable` WHERE state IN ('resolved', 'acknowledged')") &&
+			strings.HasSuffix(query, "AND (rule_id, entity_id, firing_seq) IN (('r1', 'host-1', 3))")
+	}))
+	mockClient.AssertCalled(t, "InsertIntoStream", mock.Anything, timeplus.MonitorCheckpointsStream, mock.Anything,
+		mock.MatchedBy(func(values []interface{}) bool { return values[0] == "archive:tp_alert_acks_mutable" }))
+}
+
+func TestAlertArchiveStatusDisabled(t *testing.T) {
+	assert.Equal(t, AlertArchiveStatus{}, (&RuleService{}).AlertArchiveStatus())
+}
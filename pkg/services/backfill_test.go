@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestBackfillRuleSkipsExistingAlerts(t *testing.T) {
+	mockClient := new(MockClient)
+
+	// GetRule
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "running", "entity_id_column": "device_id"},
+	}, nil)
+
+	// Historical evaluation, newest rows first
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "table(`rule_rule1_view`)")
+	})).Return([]map[string]interface{}{
+		{"device_id": "dev1", "temperature": 95.0},
+		{"device_id": "dev2", "temperature": 91.0},
+		{"device_id": "dev1", "temperature": 90.0},
+	}, nil)
+
+	// dev2 already has alert state
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "SELECT entity_id FROM table(`"+timeplus.AlertAcksMutableStream+"`)")
+	})).Return([]map[string]interface{}{
+		{"entity_id": "dev2"},
+	}, nil)
+
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.AlertAcksMutableStream, mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{
+		tpClient:    mockClient,
+		ruleStream:  "tp_rules",
+		alertStream: "tp_alerts",
+	}
+
+	result, err := service.BackfillRule(context.Background(), "rule1", 60)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.RowsScanned)
+	assert.Equal(t, 1, result.AlertsCreated)
+	assert.Equal(t, 1, result.SkippedExisting)
+
+	mockClient.AssertNumberOfCalls(t, "InsertIntoStream", 1)
+	mockClient.AssertCalled(t, "InsertIntoStream", mock.Anything, timeplus.AlertAcksMutableStream, mock.Anything,
+		mock.MatchedBy(func(values []interface{}) bool {
+			return values[1] == "dev1" && values[2] == timeplus.AlertStateActive &&
+				strings.Contains(values[6].(string), "95")
+		}))
+}
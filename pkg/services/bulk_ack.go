@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ErrInvalidBulkAcknowledge is returned when a bulk acknowledgment has no filter
+var ErrInvalidBulkAcknowledge = errors.New("invalid bulk acknowledgment")
+
+// AcknowledgeAlerts acknowledges every active alert matching the request's filters and returns how
+// many were acknowledged. The acknowledgments are written with one INSERT ... SELECT per alert acks
+// partition, so the cost doesn't grow with the number of alerts. At least one filter is required.
+// The request's reference, such as a maintenance ticket, is recorded on every acknowledgment and
+// audit entry, so a cleanup can be traced back with GetReferenceAudit.
+func (s *RuleService) AcknowledgeAlerts(ctx context.Context, req models.BulkAcknowledgeRequest) (int64, error) {
+	if req.RuleID == "" && req.Severity == "" && len(req.EntityIDs) == 0 {
+		return 0, fmt.Errorf("%w: at least one of ruleId, severity or entityIds is required", ErrInvalidBulkAcknowledge)
+	}
+
+	done, err := s.trackTask("bulk acknowledge")
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	conditions := []string{fmt.Sprintf("a.state = '%s'", timeplus.AlertStateActive)}
+	join := ""
+	if req.RuleID != "" {
+		conditions = append(conditions, fmt.Sprintf("a.rule_id = %s", timeplus.QuoteString(req.RuleID)))
+	}
+	if req.Severity != "" {
+		// Same severity resolution as the alert counts: the fired severity, else the rule's
+		join = fmt.Sprintf("LEFT JOIN (SELECT id, severity FROM table(%s) WHERE active = true) AS r ON a.rule_id = r.id", s.ruleStream)
+		conditions = append(conditions, fmt.Sprintf("coalesce(nullif(a.severity, ''), r.severity) = %s", timeplus.QuoteString(req.Severity)))
+	}
+	if len(req.EntityIDs) > 0 {
+		quoted := make([]string, len(req.EntityIDs))
+		for i, entityID := range req.EntityIDs {
+			quoted[i] = timeplus.QuoteString(entityID)
+		}
+		conditions = append(conditions, fmt.Sprintf("a.entity_id IN (%s)", strings.Join(quoted, ", ")))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	// Each partition of the shared alert acks stream is acknowledged on its own, in place
+	streams := timeplus.AlertAcksStreams()
+	if req.RuleID != "" {
+		streams = []string{timeplus.AlertAcksStreamFor(req.RuleID)}
+	}
+
+	acknowledgedBy := req.AcknowledgedBy
+	if acknowledgedBy == "" {
+		acknowledgedBy = "api"
+	}
+	comment := req.Comment
+	if comment == "" {
+		comment = "Bulk acknowledged via API"
+	}
+
+	var total int64
+	for _, stream := range streams {
+		count, err := s.acknowledgeAlertsIn(ctx, stream, join, where, acknowledgedBy, comment, req.Reference)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if total > 0 {
+		logrus.Infof("Bulk acknowledged %d alerts by %s (reference %q)", total, acknowledgedBy, req.Reference)
+	}
+	return total, nil
+}
+
+// acknowledgeAlertsIn acknowledges the active alerts of one alert acks stream matching a filter
+func (s *RuleService) acknowledgeAlertsIn(ctx context.Context, stream, join, where, acknowledgedBy, comment, reference string) (int64, error) {
+	countRows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS count FROM table(%s) AS a %s WHERE %s",
+		stream, join, where))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count matching alerts: %w", err)
+	}
+	var count int64
+	if len(countRows) > 0 {
+		count = getInt64(countRows[0], "count")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	// Audit first, while the rows still match the active filter
+	auditQuery := fmt.Sprintf(`
+		INSERT INTO %s (rule_id, entity_id, firing_seq, action, actor, reason, reference, at)
+		SELECT a.rule_id, a.entity_id, a.firing_seq, '%s', %s, %s, %s, now64(3)
+		FROM table(%s) AS a %s
+		WHERE %s
+	`,
+		timeplus.AlertAuditStream,
+		timeplus.AlertAuditActionAcknowledged,
+		timeplus.QuoteString(acknowledgedBy),
+		timeplus.QuoteString(comment),
+		timeplus.QuoteString(reference),
+		stream, join,
+		where)
+	if _, err := s.tpClient.ExecuteQuery(ctx, auditQuery); err != nil {
+		logrus.Warnf("Failed to record bulk acknowledgment audit entries: %v", err)
+	}
+
+	// Rewrite the matching rows in place, keeping created_at and the firing sequence so alert IDs don't change
+	query := fmt.Sprintf(`
+		INSERT INTO %s (rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq, reference)
+		SELECT a.rule_id, a.entity_id, '%s', a.created_at, now(), %s, %s, a.event_time, a.severity, a.firing_seq, %s
+		FROM table(%s) AS a %s
+		WHERE %s
+	`,
+		stream,
+		timeplus.AlertStateAcknowledged,
+		timeplus.QuoteString(acknowledgedBy),
+		timeplus.QuoteString(comment),
+		timeplus.QuoteString(reference),
+		stream, join,
+		where)
+
+	if _, err := s.tpClient.ExecuteQuery(ctx, query); err != nil {
+		return 0, fmt.Errorf("failed to acknowledge alerts in %s: %w", stream, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestAcknowledgeAlertsSingleMutation(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT count() AS count")
+	})).Return([]map[string]interface{}{{"count": uint64(2)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO tp_alert_acks_mutable") &&
+			strings.Contains(query, "a.firing_seq") &&
+			strings.Contains(query, "a.state = 'active'") &&
+			strings.Contains(query, "a.rule_id = 'rule1'") &&
+			strings.Contains(query, "r.severity) = 'critical'") &&
+			strings.Contains(query, "a.entity_id IN ('dev1', 'o''brien')") &&
+			strings.Contains(query, "'ops'")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO tp_alert_audit") && strings.Contains(query, "'acknowledged', 'ops'")
+	})).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	count, err := service.AcknowledgeAlerts(context.Background(), models.BulkAcknowledgeRequest{
+		RuleID:         "rule1",
+		Severity:       "critical",
+		EntityIDs:      []string{"dev1", "o'brien"},
+		AcknowledgedBy: "ops",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// A count, the audit entries and the acknowledgments, regardless of how many alerts match
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 3)
+}
+
+func TestAcknowledgeAlertsRecordsReference(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT count() AS count")
+	})).Return([]map[string]interface{}{{"count": uint64(3)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	count, err := service.AcknowledgeAlerts(context.Background(), models.BulkAcknowledgeRequest{
+		RuleID:         "rule1",
+		AcknowledgedBy: "alice",
+		Reference:      "https://tickets.example.com/OPS-1234",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	var inserts []string
+	for _, call := range mockClient.Calls {
+		if query := call.Arguments.String(1); strings.Contains(query, "INSERT INTO") {
+			inserts = append(inserts, query)
+		}
+	}
+	require.Len(t, inserts, 2)
+	// Both the audit entries and the acknowledgments carry the reference
+	for _, insert := range inserts {
+		assert.Contains(t, insert, "reference")
+		assert.Contains(t, insert, "'https://tickets.example.com/OPS-1234'")
+	}
+}
+
+func TestAcknowledgeAlertsEscapesBackslashes(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "SELECT count() AS count")
+	})).Return([]map[string]interface{}{{"count": uint64(1)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	// A backslash before a quote must not end the literal
+	_, err := service.AcknowledgeAlerts(context.Background(), models.BulkAcknowledgeRequest{
+		RuleID:         `rule1\' OR 1=1 --`,
+		Severity:       `x\'`,
+		EntityIDs:      []string{`dev1\'`},
+		AcknowledgedBy: `ops\'`,
+		Comment:        `done\'`,
+		Reference:      `OPS-1\'`,
+	})
+	require.NoError(t, err)
+
+	queries := make([]string, 0, len(mockClient.Calls))
+	for _, call := range mockClient.Calls {
+		queries = append(queries, call.Arguments.String(1))
+	}
+	require.Len(t, queries, 3)
+	assert.Contains(t, queries[0], `a.rule_id = 'rule1\\'' OR 1=1 --'`)
+	assert.Contains(t, queries[0], `r.severity) = 'x\\'''`)
+	assert.Contains(t, queries[0], `a.entity_id IN ('dev1\\''')`)
+	for _, query := range queries[1:] {
+		assert.Contains(t, query, `'ops\\'''`)
+		assert.Contains(t, query, `'done\\'''`)
+		assert.Contains(t, query, `'OPS-1\\'''`)
+	}
+}
+
+func TestAcknowledgeAlertsNothingMatched(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{{"count": uint64(0)}}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	count, err := service.AcknowledgeAlerts(context.Background(), models.BulkAcknowledgeRequest{RuleID: "rule1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
+
+func TestAcknowledgeAlertsRequiresFilter(t *testing.T) {
+	service := &RuleService{tpClient: new(MockClient), ruleStream: "tp_rules"}
+
+	_, err := service.AcknowledgeAlerts(context.Background(), models.BulkAcknowledgeRequest{AcknowledgedBy: "ops"})
+	assert.ErrorIs(t, err, ErrInvalidBulkAcknowledge)
+}
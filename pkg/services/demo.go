@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// DemoStream is the stream the demo mode creates and fills with device temperature readings
+const DemoStream = "device_temperatures"
+
+// DefaultDemoInterval is how often the demo generator sends readings when no interval is given
+const DefaultDemoInterval = time.Second
+
+// Devices the demo generator reports readings of, and the range their temperatures wander in
+const (
+	demoDevices     = 5
+	demoMin         = 19.5
+	demoMax         = 24.5
+	demoStep        = 0.5
+	demoAnomalyRate = 0.02 // Chance of each reading being a spike or drop that trips a demo rule
+)
+
+// demoSchema is the schema of DemoStream, matching the simulator's temperature scenario
+var demoSchema = []timeplus.Column{
+	{Name: "device_id", Type: "string"},
+	{Name: "temperature", Type: "float64"},
+	{Name: "timestamp", Type: "datetime64"},
+}
+
+// demoRules are the sample rules the demo mode creates, matching the simulator's temperature scenario
+var demoRules = []models.CreateRuleRequest{
+	{
+		Name:            "High Temperature Alert",
+		Description:     "Alert when any device temperature exceeds 30°C",
+		Query:           "SELECT * FROM " + DemoStream + " WHERE temperature > 30",
+		SourceStream:    DemoStream,
+		Severity:        models.RuleSeverityCritical,
+		ThrottleMinutes: 1,
+	},
+	{
+		Name:            "Device 1 Temperature Alert",
+		Description:     "Alert when device_1 temperature exceeds 25°C",
+		Query:           "SELECT * FROM " + DemoStream + " WHERE device_id = 'device_1' AND temperature > 25",
+		SourceStream:    DemoStream,
+		Severity:        models.RuleSeverityWarning,
+		ThrottleMinutes: 2,
+	},
+	{
+		Name:            "Low Temperature Alert",
+		Description:     "Alert when any device temperature drops below 19°C",
+		Query:           "SELECT * FROM " + DemoStream + " WHERE temperature < 19",
+		SourceStream:    DemoStream,
+		Severity:        models.RuleSeverityInfo,
+		ThrottleMinutes: 5,
+	},
+}
+
+// SeedDemo creates DemoStream and the sample rules reading it, and starts the rules that aren't
+// running. Rules already present by name are kept as they are, so restarting in demo mode doesn't
+// duplicate them.
+func (s *RuleService) SeedDemo(ctx context.Context) error {
+	exists, err := s.tpClient.StreamExists(ctx, DemoStream)
+	if err != nil {
+		return fmt.Errorf("failed to check demo stream: %w", err)
+	}
+	if !exists {
+		if err := s.tpClient.CreateStream(ctx, DemoStream, demoSchema); err != nil {
+			return fmt.Errorf("failed to create demo stream: %w", err)
+		}
+		logrus.Infof("Created demo stream %s", DemoStream)
+	}
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %w", err)
+	}
+	byName := make(map[string]*models.Rule, len(rules))
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+	}
+
+	for i := range demoRules {
+		req := demoRules[i]
+		rule, ok := byName[req.Name]
+		if !ok {
+			if rule, err = s.CreateRule(ctx, &req); err != nil {
+				return fmt.Errorf("failed to create demo rule %q: %w", req.Name, err)
+			}
+			logrus.Infof("Created demo rule %q (%s)", rule.Name, rule.ID)
+		}
+		if ruleEvaluating(rule) {
+			continue
+		}
+		if err := s.StartRule(ctx, rule.ID); err != nil {
+			return fmt.Errorf("failed to start demo rule %q: %w", req.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartDemoGenerator inserts a temperature reading of each demo device into DemoStream every
+// interval until the rule service shuts down. Readings wander within a normal range, with
+// occasional spikes and drops for the demo rules to alert on.
+func (s *RuleService) StartDemoGenerator(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultDemoInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopDemoGenerator = cancel
+
+	generator := newDemoGenerator(rand.New(rand.NewSource(time.Now().UnixNano())))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for device := range generator.temperatures {
+					deviceID := fmt.Sprintf("device_%d", device+1)
+					err := s.tpClient.InsertIntoStream(ctx, DemoStream, []string{"device_id", "temperature", "timestamp"},
+						[]interface{}{deviceID, generator.next(device), now.UTC()})
+					if err != nil && ctx.Err() == nil {
+						logrus.Warnf("Failed to insert demo reading of %s: %v", deviceID, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// demoGenerator produces the temperatures of the demo devices
+type demoGenerator struct {
+	rand         *rand.Rand
+	temperatures []float64 // Latest normal reading of each device
+}
+
+func newDemoGenerator(r *rand.Rand) *demoGenerator {
+	g := &demoGenerator{rand: r, temperatures: make([]float64, demoDevices)}
+	for i := range g.temperatures {
+		g.temperatures[i] = demoMin + r.Float64()*(demoMax-demoMin)
+	}
+	return g
+}
+
+// next returns the next temperature of a device: a step of its walk, or now and then a spike above
+// 30°C, a rise above 25°C or a drop below 19°C, which leave the walk where it was
+func (g *demoGenerator) next(device int) float64 {
+	if g.rand.Float64() < demoAnomalyRate {
+		switch g.rand.Intn(3) {
+		case 0:
+			return 31 + g.rand.Float64()*4
+		case 1:
+			return 26 + g.rand.Float64()*4
+		default:
+			return 16 + g.rand.Float64()*2.5
+		}
+	}
+	current := g.temperatures[device] + (g.rand.Float64()*2-1)*demoStep
+	g.temperatures[device] = math.Max(demoMin, math.Min(demoMax, current))
+	return g.temperatures[device]
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedDemoKeepsExistingRules(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, DemoStream).Return(false, nil)
+	mockClient.On("CreateStream", mock.Anything, DemoStream, demoSchema).Return(nil)
+	rows := make([]map[string]interface{}, 0, len(demoRules))
+	for i, req := range demoRules {
+		rows = append(rows, map[string]interface{}{"id": string(rune('a' + i)), "name": req.Name, "status": "running",
+			"query": req.Query})
+	}
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return(rows, nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	// Running rules of an earlier demo are neither created again nor restarted
+	require.NoError(t, service.SeedDemo(context.Background()))
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDemoGenerator(t *testing.T) {
+	generator := newDemoGenerator(rand.New(rand.NewSource(1)))
+
+	anomalies := 0
+	for i := 0; i < 5000; i++ {
+		temperature := generator.next(i % demoDevices)
+		if temperature < demoMin || temperature > demoMax {
+			anomalies++
+			// Anomalies trip one of the demo rules
+			assert.True(t, temperature > 25 || temperature < 19, "temperature %f", temperature)
+		}
+	}
+	assert.InDelta(t, 5000*demoAnomalyRate, anomalies, 50)
+	for _, temperature := range generator.temperatures {
+		assert.GreaterOrEqual(t, temperature, demoMin)
+		assert.LessOrEqual(t, temperature, demoMax)
+	}
+}
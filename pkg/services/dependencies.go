@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// validateRuleDependencies checks that a rule depends on existing rules with a known scope and that
+// the dependencies don't form a cycle, which would let rules suppress each other indefinitely.
+// Scopes default to the same entity.
+func (s *RuleService) validateRuleDependencies(ctx context.Context, rule *models.Rule) error {
+	if len(rule.DependsOn) == 0 {
+		return nil
+	}
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to look up rule dependencies: %w", err)
+	}
+	dependencies := make(map[string][]models.RuleDependency, len(rules)+1)
+	for _, r := range rules {
+		dependencies[r.ID] = r.DependsOn
+	}
+	dependencies[rule.ID] = rule.DependsOn
+
+	seen := make(map[string]bool, len(rule.DependsOn))
+	for i := range rule.DependsOn {
+		dependency := &rule.DependsOn[i]
+		if dependency.Scope == "" {
+			dependency.Scope = models.DependencyScopeEntity
+		}
+		if dependency.Scope != models.DependencyScopeEntity && dependency.Scope != models.DependencyScopeGlobal {
+			return fmt.Errorf("%w: dependsOn[%d].scope must be %q or %q, got %q", ErrInvalidRule, i,
+				models.DependencyScopeEntity, models.DependencyScopeGlobal, dependency.Scope)
+		}
+		if dependency.RuleID == rule.ID {
+			return fmt.Errorf("%w: dependsOn[%d] is the rule itself", ErrInvalidRule, i)
+		}
+		if _, ok := dependencies[dependency.RuleID]; !ok {
+			return fmt.Errorf("%w: dependsOn[%d] references unknown rule %q", ErrInvalidRule, i, dependency.RuleID)
+		}
+		if seen[dependency.RuleID] {
+			return fmt.Errorf("%w: dependsOn lists rule %q more than once", ErrInvalidRule, dependency.RuleID)
+		}
+		seen[dependency.RuleID] = true
+	}
+
+	if path := dependencyCycle(rule.ID, dependencies); path != nil {
+		return fmt.Errorf("%w: dependsOn creates a cycle: %s", ErrInvalidRule, strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// dependencyCycle returns the rules on a dependency path leading from ruleID back to it, nil when
+// there is none
+func dependencyCycle(ruleID string, dependencies map[string][]models.RuleDependency) []string {
+	visited := make(map[string]bool)
+	var walk func(id string, path []string) []string
+	walk = func(id string, path []string) []string {
+		for _, dependency := range dependencies[id] {
+			next := append(append([]string{}, path...), dependency.RuleID)
+			if dependency.RuleID == ruleID {
+				return next
+			}
+			if visited[dependency.RuleID] {
+				continue
+			}
+			visited[dependency.RuleID] = true
+			if cycle := walk(dependency.RuleID, next); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return walk(ruleID, []string{ruleID})
+}
+
+// suppressingDependency returns why a rule's alert for an entity is suppressed: a rule it depends on
+// has an active alert for the same entity, or any active alert for global dependencies. It returns
+// an empty string when no dependency is active.
+func (s *RuleService) suppressingDependency(ctx context.Context, rule *models.Rule, entityID string) (string, error) {
+	for _, dependency := range rule.DependsOn {
+		parent, err := s.GetRule(ctx, dependency.RuleID)
+		if err != nil {
+			// A deleted dependency no longer suppresses anything
+			continue
+		}
+
+		where := fmt.Sprintf("rule_id = '%s' AND state = '%s'", strings.ReplaceAll(parent.ID, "'", "''"), timeplus.AlertStateActive)
+		if dependency.Scope != models.DependencyScopeGlobal {
+			where += fmt.Sprintf(" AND entity_id = '%s'", strings.ReplaceAll(entityID, "'", "''"))
+		}
+		query := fmt.Sprintf("SELECT count() AS active FROM table(`%s`) WHERE %s", getRuleResources(parent).AlertAcksStream, where)
+		rows, err := s.tpClient.ExecuteQuery(ctx, query)
+		if err != nil {
+			return "", fmt.Errorf("failed to check dependency %s: %w", parent.ID, err)
+		}
+		if len(rows) == 0 || getInt64(rows[0], "active") == 0 {
+			continue
+		}
+
+		if dependency.Scope == models.DependencyScopeGlobal {
+			return fmt.Sprintf("Rule %s (%s) it depends on has active alerts", parent.Name, parent.ID), nil
+		}
+		return fmt.Sprintf("Rule %s (%s) it depends on is active for %s", parent.Name, parent.ID, entityID), nil
+	}
+	return "", nil
+}
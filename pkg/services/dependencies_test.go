@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestValidateRuleDependencies(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "host-down", "name": "Host down"},
+		{"id": "disk-full", "name": "Disk full", "depends_on": `[{"ruleId":"cpu-high","scope":"entity"}]`},
+	}, nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	rule := &models.Rule{ID: "cpu-high", DependsOn: []models.RuleDependency{{RuleID: "host-down"}}}
+	require.NoError(t, service.validateRuleDependencies(context.Background(), rule))
+	assert.Equal(t, models.DependencyScopeEntity, rule.DependsOn[0].Scope)
+
+	for name, tc := range map[string]struct {
+		dependsOn []models.RuleDependency
+		err       string
+	}{
+		"unknown scope": {[]models.RuleDependency{{RuleID: "host-down", Scope: "cluster"}}, "scope must be"},
+		"itself":        {[]models.RuleDependency{{RuleID: "cpu-high"}}, "is the rule itself"},
+		"unknown rule":  {[]models.RuleDependency{{RuleID: "missing"}}, `unknown rule "missing"`},
+		"duplicate":     {[]models.RuleDependency{{RuleID: "host-down"}, {RuleID: "host-down", Scope: "global"}}, "more than once"},
+		"cycle":         {[]models.RuleDependency{{RuleID: "disk-full"}}, "cycle: cpu-high -> disk-full -> cpu-high"},
+	} {
+		err := service.validateRuleDependencies(context.Background(), &models.Rule{ID: "cpu-high", DependsOn: tc.dependsOn})
+		assert.ErrorIs(t, err, ErrInvalidRule, name)
+		assert.ErrorContains(t, err, tc.err, name)
+	}
+}
+
+func TestSuppressingDependency(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "AS active") && strings.Contains(query, "entity_id = 'host1'")
+	})).Return([]map[string]interface{}{{"active": uint64(1)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "AS active")
+	})).Return([]map[string]interface{}{{"active": uint64(0)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "host-down", "name": "Host down"},
+	}, nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	rule := &models.Rule{ID: "cpu-high", DependsOn: []models.RuleDependency{{RuleID: "host-down", Scope: models.DependencyScopeEntity}}}
+	reason, err := service.suppressingDependency(context.Background(), rule, "host1")
+	require.NoError(t, err)
+	assert.Equal(t, "Rule Host down (host-down) it depends on is active for host1", reason)
+
+	reason, err = service.suppressingDependency(context.Background(), rule, "host2")
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Global dependencies don't filter on the entity
+	rule.DependsOn[0].Scope = models.DependencyScopeGlobal
+	_, err = service.suppressingDependency(context.Background(), rule, "host2")
+	require.NoError(t, err)
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "AS active") && !strings.Contains(query, "entity_id")
+	}))
+}
+
+func TestAlertMonitorSuppressesDependentAlerts(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "AS active")
+	})).Return([]map[string]interface{}{{"active": uint64(1)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "id = 'cpu-high'")
+	})).Return([]map[string]interface{}{
+		{"id": "cpu-high", "name": "CPU high", "depends_on": `[{"ruleId":"host-down","scope":"entity"}]`},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "id = 'host-down'")
+	})).Return([]map[string]interface{}{{"id": "host-down", "name": "Host down"}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	monitor := NewAlertMonitor(service, mockClient)
+
+	ctx := context.Background()
+	require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+		"rule_id": "cpu-high", "entity_id": "host1", "state": timeplus.AlertStateActive, "firing_seq": uint64(1),
+		"created_at": time.Now(), "_tp_time": time.Now(),
+	}))
+
+	require.Equal(t, 0, dispatcher.Drain(ctx))
+	assert.Empty(t, recorder.events)
+	assert.Equal(t, int64(1), monitor.Status().Suppressed)
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "'"+timeplus.AlertAuditActionSuppressed+"', 'dependency'")
+	}))
+}
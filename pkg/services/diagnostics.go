@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// BuildInfo identifies the running gateway binary
+type BuildInfo struct {
+	Version   string `json:"version"`            // Module version, "(devel)" for local builds
+	Revision  string `json:"revision,omitempty"` // VCS revision the binary was built from
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+	GoVersion string `json:"goVersion"`
+}
+
+// RuleDiagnostics is the state of a rule in a diagnostics bundle
+type RuleDiagnostics struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type,omitempty"`
+	Status         string    `json:"status"`
+	LastError      string    `json:"lastError,omitempty"`
+	EntityIDColumn string    `json:"entityIdColumn,omitempty"`
+	AlertAcks      string    `json:"alertAcksStream"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// TimeplusInventory lists the streams and views in the workspace
+type TimeplusInventory struct {
+	Streams           []string `json:"streams"` // Streams and views alike, as SHOW STREAMS lists them
+	Views             []string `json:"views"`
+	MaterializedViews []string `json:"materializedViews"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// Diagnostics gathers what support needs to look into a problem with the gateway. Each section
+// is collected independently, so a failing one doesn't hide the others.
+type Diagnostics struct {
+	GeneratedAt time.Time                 `json:"generatedAt"`
+	Build       BuildInfo                 `json:"build"`
+	Config      interface{}               `json:"config,omitempty"` // Redacted by the caller
+	Rules       []RuleDiagnostics         `json:"rules"`
+	RulesError  string                    `json:"rulesError,omitempty"`
+	Inventory   TimeplusInventory         `json:"inventory"`
+	Timeplus    *timeplus.ConnectionStats `json:"timeplus,omitempty"` // Nil when the client doesn't keep stats
+	Health      *HealthReport             `json:"health,omitempty"`   // Latest health check, nil before the first one
+	Monitor     *AlertMonitorStatus       `json:"monitor,omitempty"`
+}
+
+// connectionStatser is implemented by clients that keep connection stats
+type connectionStatser interface {
+	ConnectionStats() timeplus.ConnectionStats
+}
+
+// Diagnostics collects a diagnostics bundle. config is included as given, so secrets must be
+// redacted by the caller.
+func (s *RuleService) Diagnostics(ctx context.Context, config interface{}) *Diagnostics {
+	d := &Diagnostics{
+		GeneratedAt: time.Now(),
+		Build:       buildInfo(),
+		Config:      config,
+		Rules:       []RuleDiagnostics{},
+		Monitor:     s.alertMonitorStatus(),
+	}
+
+	if rules, err := s.GetRules(ctx); err != nil {
+		d.RulesError = err.Error()
+	} else {
+		for _, rule := range rules {
+			d.Rules = append(d.Rules, RuleDiagnostics{
+				ID:             rule.ID,
+				Name:           rule.Name,
+				Type:           rule.Type,
+				Status:         string(rule.Status),
+				LastError:      rule.LastError,
+				EntityIDColumn: rule.EntityIDColumn,
+				AlertAcks:      getRuleResources(rule).AlertAcksStream,
+				UpdatedAt:      rule.UpdatedAt,
+			})
+		}
+	}
+
+	d.Inventory = s.timeplusInventory(ctx)
+
+	if client, ok := s.tpClient.(connectionStatser); ok {
+		stats := client.ConnectionStats()
+		d.Timeplus = &stats
+	}
+
+	s.healthMutex.RLock()
+	if s.lastHealth != nil {
+		health := *s.lastHealth
+		d.Health = &health
+	}
+	s.healthMutex.RUnlock()
+
+	return d
+}
+
+// timeplusInventory lists the workspace's streams and views, keeping the first error
+func (s *RuleService) timeplusInventory(ctx context.Context) TimeplusInventory {
+	var inv TimeplusInventory
+	var err error
+
+	if inv.Streams, err = s.tpClient.ListStreams(ctx); err != nil && inv.Error == "" {
+		inv.Error = err.Error()
+	}
+	if inv.Views, err = s.tpClient.ListViews(ctx); err != nil && inv.Error == "" {
+		inv.Error = err.Error()
+	}
+	if inv.MaterializedViews, err = s.tpClient.ListMaterializedViews(ctx); err != nil && inv.Error == "" {
+		inv.Error = err.Error()
+	}
+	return inv
+}
+
+// buildInfo reads the version of the running binary from its embedded build information
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: "unknown", GoVersion: runtime.Version()}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Version = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDiagnostics(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Hot devices", "status": "failed", "last_error": "failed to create plain view"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"devices", "rule_rule1_view"}, nil)
+	mockClient.On("ListViews", mock.Anything).Return([]string{"rule_rule1_view"}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string(nil), assert.AnError)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	d := service.Diagnostics(context.Background(), map[string]string{"server": "redacted"})
+	assert.NotEmpty(t, d.Build.GoVersion)
+	assert.Equal(t, map[string]string{"server": "redacted"}, d.Config)
+
+	assert.Len(t, d.Rules, 1)
+	assert.Equal(t, "failed", d.Rules[0].Status)
+	assert.Equal(t, "failed to create plain view", d.Rules[0].LastError)
+	assert.Equal(t, "tp_alert_acks_mutable", d.Rules[0].AlertAcks)
+
+	assert.Equal(t, []string{"devices", "rule_rule1_view"}, d.Inventory.Streams)
+	assert.Equal(t, assert.AnError.Error(), d.Inventory.Error)
+
+	// MockClient keeps no connection stats, and no health check has run
+	assert.Nil(t, d.Timeplus)
+	assert.Nil(t, d.Health)
+}
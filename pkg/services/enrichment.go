@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// validateRuleTemplates checks that a rule's runbook URL and text templates parse
+func validateRuleTemplates(rule *models.Rule) error {
+	templates := map[string]string{
+		"runbookUrl":          rule.RunbookURL,
+		"summaryTemplate":     rule.SummaryTemplate,
+		"descriptionTemplate": rule.DescriptionTemplate,
+	}
+	for field, text := range templates {
+		if text == "" {
+			continue
+		}
+		if _, err := template.New(field).Parse(text); err != nil {
+			return fmt.Errorf("%w: invalid %s: %v", ErrInvalidRule, field, err)
+		}
+	}
+	return nil
+}
+
+// renderAlertTemplate renders a rule template against an alert's data
+func renderAlertTemplate(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("alert").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// alertRowData returns the fields of an alert acks row available to templates: the entity ID,
+// the alert state, and the triggering row captured in the comment column. An encrypted row the
+// reader of ctx can't read is left out and flagged with _encrypted.
+func alertRowData(ctx context.Context, row map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+
+	comment, encrypted := decryptedPayload(ctx, getString(row, "comment"))
+	if encrypted {
+		data["_encrypted"] = true
+	}
+
+	// Numbers are kept as json.Number so integers survive without float rounding
+	var triggering map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(timeplus.TruncatePayload(comment)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&triggering); err == nil {
+		for k, v := range triggering {
+			data[k] = v
+		}
+	}
+
+	data["entity_id"] = getString(row, "entity_id")
+	data["state"] = getString(row, "state")
+	return data
+}
+
+// alertDataJSON encodes an alert's row data as the JSON document exposed as Alert.Data
+func alertDataJSON(data map[string]interface{}) string {
+	encoded, err := timeplus.MarshalRowData(data)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+// enrichAlert renders the rule's runbook URL, summary and description templates for an alert.
+// Templates see the triggering row's columns plus rule_id, rule_name and the alert's severity.
+func enrichAlert(alert *models.Alert, rule *models.Rule, data map[string]interface{}) {
+	if rule == nil {
+		return
+	}
+
+	templateData := make(map[string]interface{}, len(data)+3)
+	for k, v := range data {
+		templateData[k] = v
+	}
+	templateData["rule_id"] = rule.ID
+	templateData["rule_name"] = rule.Name
+	templateData["severity"] = string(alert.Severity)
+
+	render := func(field, text string) string {
+		if text == "" {
+			return ""
+		}
+		rendered, err := renderAlertTemplate(text, templateData)
+		if err != nil {
+			logrus.Warnf("Failed to render %s for alert %s of rule %s: %v", field, alert.ID, rule.ID, err)
+			return ""
+		}
+		return rendered
+	}
+
+	alert.RunbookURL = render("runbookUrl", rule.RunbookURL)
+	alert.Summary = render("summaryTemplate", rule.SummaryTemplate)
+	alert.Description = render("descriptionTemplate", rule.DescriptionTemplate)
+}
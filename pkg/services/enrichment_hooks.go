@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Built-in enrichment hook types
+const (
+	EnrichmentGeoIP      = "geoip"       // Location of an IP address, from the configured GeoIP service
+	EnrichmentReverseDNS = "reverse_dns" // Host names of an IP address
+	EnrichmentHTTP       = "http"        // Whatever an HTTP endpoint returns for the alert
+)
+
+// DefaultEnrichmentTimeout is the time allowed to each enrichment hook of an alert
+const DefaultEnrichmentTimeout = 5 * time.Second
+
+// enrichmentActor records enrichment in the alert audit trail
+const enrichmentActor = "enrichment"
+
+// EnrichmentHook adds context to a new alert before it's notified. It's given the rule's
+// configuration of the hook, the alert and its triggering row, and returns what it found, or nil
+// when there is nothing to add.
+type EnrichmentHook interface {
+	Enrich(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error)
+}
+
+// EnrichmentHookFunc adapts a function to an EnrichmentHook
+type EnrichmentHookFunc func(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error)
+
+// Enrich calls the function
+func (f EnrichmentHookFunc) Enrich(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error) {
+	return f(ctx, config, alert, data)
+}
+
+// EnrichmentConfig configures the built-in enrichment hooks
+type EnrichmentConfig struct {
+	// URL of a GeoIP service returning a JSON object, with {ip} replaced by the address, e.g.
+	// "https://geoip.example.com/json/{ip}". Rules can only use geoip hooks when it's set.
+	GeoIPURL string
+	// Time allowed to each hook of an alert, DefaultEnrichmentTimeout when zero
+	Timeout time.Duration
+}
+
+// lookupAddr resolves the host names of an IP address, replaced in tests
+var lookupAddr = net.DefaultResolver.LookupAddr
+
+// SetEnrichmentConfig configures the built-in enrichment hooks
+func (s *RuleService) SetEnrichmentConfig(config EnrichmentConfig) {
+	s.enrichmentMutex.Lock()
+	defer s.enrichmentMutex.Unlock()
+	s.enrichmentConfig = config
+}
+
+// RegisterEnrichmentHook makes a hook available to rules as an enrichment type, replacing a
+// built-in hook of the same type
+func (s *RuleService) RegisterEnrichmentHook(hookType string, hook EnrichmentHook) {
+	s.enrichmentMutex.Lock()
+	defer s.enrichmentMutex.Unlock()
+	if s.enrichmentHooks == nil {
+		s.enrichmentHooks = make(map[string]EnrichmentHook)
+	}
+	s.enrichmentHooks[hookType] = hook
+}
+
+// enrichmentHook returns the hook of an enrichment type, nil for unknown types
+func (s *RuleService) enrichmentHook(hookType string) EnrichmentHook {
+	s.enrichmentMutex.RLock()
+	hook, ok := s.enrichmentHooks[hookType]
+	s.enrichmentMutex.RUnlock()
+	if ok {
+		return hook
+	}
+
+	switch hookType {
+	case EnrichmentGeoIP:
+		return EnrichmentHookFunc(s.geoIPEnrichment)
+	case EnrichmentReverseDNS:
+		return EnrichmentHookFunc(reverseDNSEnrichment)
+	case EnrichmentHTTP:
+		return EnrichmentHookFunc(httpEnrichment)
+	}
+	return nil
+}
+
+// validateRuleEnrichments checks that a rule's enrichment hooks exist and have what they need
+func (s *RuleService) validateRuleEnrichments(enrichments []models.RuleEnrichment) error {
+	s.enrichmentMutex.RLock()
+	geoIPURL := s.enrichmentConfig.GeoIPURL
+	s.enrichmentMutex.RUnlock()
+
+	names := make(map[string]bool, len(enrichments))
+	for i, enrichment := range enrichments {
+		if s.enrichmentHook(enrichment.Type) == nil {
+			return fmt.Errorf("%w: enrichments[%d]: unknown type %q", ErrInvalidRule, i, enrichment.Type)
+		}
+
+		name := enrichmentName(enrichment)
+		if names[name] {
+			return fmt.Errorf("%w: enrichments[%d]: duplicate name %q", ErrInvalidRule, i, name)
+		}
+		names[name] = true
+
+		switch enrichment.Type {
+		case EnrichmentGeoIP, EnrichmentReverseDNS:
+			if enrichment.Field == "" {
+				return fmt.Errorf("%w: enrichments[%d]: field is required", ErrInvalidRule, i)
+			}
+			if enrichment.Type == EnrichmentGeoIP && geoIPURL == "" {
+				return fmt.Errorf("%w: enrichments[%d]: geoip enrichment needs enrichment.geoipUrl to be configured", ErrInvalidRule, i)
+			}
+		case EnrichmentHTTP:
+			endpoint, err := url.Parse(enrichment.URL)
+			if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+				return fmt.Errorf("%w: enrichments[%d]: url must be an http or https URL", ErrInvalidRule, i)
+			}
+		}
+	}
+	return nil
+}
+
+// enrichmentName returns the key of an enrichment hook's result in the alert's enrichment
+func enrichmentName(enrichment models.RuleEnrichment) string {
+	if enrichment.Name != "" {
+		return enrichment.Name
+	}
+	return enrichment.Type
+}
+
+// runEnrichmentHooks runs a rule's enrichment hooks for a new alert and records what they found in
+// the alert's audit trail. A failing hook is logged and skipped, the alert is notified regardless.
+func (s *RuleService) runEnrichmentHooks(ctx context.Context, alert *models.Alert, rule *models.Rule, entityID string, firingSeq int64, data map[string]interface{}) {
+	if rule == nil || len(rule.Enrichments) == 0 {
+		return
+	}
+
+	s.enrichmentMutex.RLock()
+	timeout := s.enrichmentConfig.Timeout
+	s.enrichmentMutex.RUnlock()
+	if timeout <= 0 {
+		timeout = DefaultEnrichmentTimeout
+	}
+
+	for _, enrichment := range rule.Enrichments {
+		hook := s.enrichmentHook(enrichment.Type)
+		if hook == nil {
+			logrus.Warnf("Rule %s uses unknown enrichment type %q", rule.ID, enrichment.Type)
+			continue
+		}
+
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err := hook.Enrich(hookCtx, enrichment, alert, data)
+		cancel()
+		if err != nil {
+			logrus.Warnf("Enrichment %s of alert %s failed: %v", enrichmentName(enrichment), alert.ID, err)
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		if alert.Enrichment == nil {
+			alert.Enrichment = make(map[string]interface{}, len(rule.Enrichments))
+		}
+		alert.Enrichment[enrichmentName(enrichment)] = result
+	}
+
+	if len(alert.Enrichment) > 0 {
+		encoded, err := json.Marshal(alert.Enrichment)
+		if err != nil {
+			logrus.Warnf("Failed to encode enrichment of alert %s: %v", alert.ID, err)
+			return
+		}
+		s.recordAlertAudit(ctx, rule.ID, entityID, firingSeq, timeplus.AlertAuditActionEnriched, enrichmentActor, string(encoded))
+	}
+}
+
+// enrichmentAddress returns the IP address in a hook's field of the triggering row, "" when the
+// field is empty or isn't an IP address
+func enrichmentAddress(config models.RuleEnrichment, data map[string]interface{}) string {
+	value, ok := data[config.Field]
+	if !ok || value == nil {
+		return ""
+	}
+	address := strings.TrimSpace(fmt.Sprint(value))
+	if net.ParseIP(address) == nil {
+		return ""
+	}
+	return address
+}
+
+// geoIPEnrichment looks up the location of an IP address in the configured GeoIP service
+func (s *RuleService) geoIPEnrichment(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error) {
+	address := enrichmentAddress(config, data)
+	if address == "" {
+		return nil, nil
+	}
+
+	s.enrichmentMutex.RLock()
+	geoIPURL := s.enrichmentConfig.GeoIPURL
+	s.enrichmentMutex.RUnlock()
+	if geoIPURL == "" {
+		return nil, fmt.Errorf("no GeoIP service configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(geoIPURL, "{ip}", url.PathEscape(address)), nil)
+	if err != nil {
+		return nil, err
+	}
+	return enrichmentResponse(req)
+}
+
+// reverseDNSEnrichment looks up the host names of an IP address
+func reverseDNSEnrichment(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error) {
+	address := enrichmentAddress(config, data)
+	if address == "" {
+		return nil, nil
+	}
+
+	names, err := lookupAddr(ctx, address)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	hosts := make([]string, 0, len(names))
+	for _, name := range names {
+		hosts = append(hosts, strings.TrimSuffix(name, "."))
+	}
+	return hosts, nil
+}
+
+// httpEnrichment posts the alert and its triggering row to an endpoint and adds the JSON it returns
+func httpEnrichment(ctx context.Context, config models.RuleEnrichment, alert *models.Alert, data map[string]interface{}) (interface{}, error) {
+	body, err := json.Marshal(map[string]interface{}{"alert": alert, "data": data})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return enrichmentResponse(req)
+}
+
+// enrichmentResponse sends an enrichment request and decodes the JSON it returns, nil for an empty body
+func enrichmentResponse(req *http.Request) (interface{}, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("%s returned invalid JSON: %w", req.URL.Redacted(), err)
+	}
+	return result, nil
+}
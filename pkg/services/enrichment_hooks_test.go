@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestValidateRuleEnrichments(t *testing.T) {
+	service := &RuleService{}
+	service.RegisterEnrichmentHook("cmdb", EnrichmentHookFunc(func(context.Context, models.RuleEnrichment, *models.Alert, map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	}))
+
+	valid := []models.RuleEnrichment{
+		{Type: EnrichmentReverseDNS, Field: "client_ip"},
+		{Type: EnrichmentHTTP, URL: "https://inventory.example.com/lookup"},
+		{Type: "cmdb"},
+	}
+	require.NoError(t, service.validateRuleEnrichments(valid))
+
+	tests := map[string]models.RuleEnrichment{
+		"unknown type":        {Type: "whois", Field: "client_ip"},
+		"missing field":       {Type: EnrichmentReverseDNS},
+		"geoip not set up":    {Type: EnrichmentGeoIP, Field: "client_ip"},
+		"http without an url": {Type: EnrichmentHTTP, URL: "inventory.example.com"},
+		"duplicate name":      {Type: EnrichmentHTTP, Name: "cmdb", URL: "https://inventory.example.com"},
+	}
+	for name, enrichment := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := service.validateRuleEnrichments(append(valid, enrichment))
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+
+	service.SetEnrichmentConfig(EnrichmentConfig{GeoIPURL: "https://geoip.example.com/{ip}"})
+	assert.NoError(t, service.validateRuleEnrichments([]models.RuleEnrichment{{Type: EnrichmentGeoIP, Field: "client_ip"}}))
+}
+
+func TestRunEnrichmentHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/geoip/203.0.113.7":
+			w.Write([]byte(`{"country": "NL", "city": "Amsterdam"}`))
+		case r.URL.Path == "/owner" && r.Method == http.MethodPost:
+			var body struct {
+				Alert *models.Alert          `json:"alert"`
+				Data  map[string]interface{} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"owner": "edge-team", "alert": "` + body.Alert.ID + `", "host": "` + body.Data["host"].(string) + `"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	previousLookup := lookupAddr
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		return []string{"edge-7.example.com."}, nil
+	}
+	defer func() { lookupAddr = previousLookup }()
+
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+	service := &RuleService{tpClient: mockClient}
+	service.SetEnrichmentConfig(EnrichmentConfig{GeoIPURL: server.URL + "/geoip/{ip}"})
+
+	rule := &models.Rule{ID: "r1", Enrichments: []models.RuleEnrichment{
+		{Type: EnrichmentGeoIP, Field: "client_ip"},
+		{Type: EnrichmentReverseDNS, Name: "hostnames", Field: "client_ip"},
+		{Type: EnrichmentHTTP, Name: "inventory", URL: server.URL + "/owner"},
+		{Type: EnrichmentHTTP, Name: "broken", URL: server.URL + "/broken"},
+		{Type: EnrichmentReverseDNS, Name: "not an address", Field: "host"},
+	}}
+	alert := &models.Alert{ID: "r1:edge-7:1", RuleID: "r1"}
+	data := map[string]interface{}{"client_ip": "203.0.113.7", "host": "edge-7"}
+
+	service.runEnrichmentHooks(context.Background(), alert, rule, "edge-7", 1, data)
+
+	assert.Equal(t, map[string]interface{}{"country": "NL", "city": "Amsterdam"}, alert.Enrichment["geoip"])
+	assert.Equal(t, []string{"edge-7.example.com"}, alert.Enrichment["hostnames"])
+	assert.Equal(t, map[string]interface{}{"owner": "edge-team", "alert": "r1:edge-7:1", "host": "edge-7"}, alert.Enrichment["inventory"])
+	assert.NotContains(t, alert.Enrichment, "broken", "a failing hook is skipped")
+	assert.NotContains(t, alert.Enrichment, "not an address")
+
+	// What the hooks found is kept in the alert's audit trail
+	require.Len(t, mockClient.Calls, 1)
+	audit := mockClient.Calls[0].Arguments.String(1)
+	assert.Contains(t, audit, "'enriched', 'enrichment'")
+	assert.Contains(t, audit, `"owner":"edge-team"`)
+}
+
+func TestRunEnrichmentHooksWithoutFindings(t *testing.T) {
+	mockClient := new(MockClient)
+	service := &RuleService{tpClient: mockClient}
+	service.RegisterEnrichmentHook("cmdb", EnrichmentHookFunc(func(context.Context, models.RuleEnrichment, *models.Alert, map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("cmdb is down")
+	}))
+
+	alert := &models.Alert{ID: "r1:edge-7:1"}
+	service.runEnrichmentHooks(context.Background(), alert, &models.Rule{ID: "r1", Enrichments: []models.RuleEnrichment{{Type: "cmdb"}}}, "edge-7", 1, map[string]interface{}{})
+
+	assert.Nil(t, alert.Enrichment)
+	mockClient.AssertNotCalled(t, "ExecuteQuery", mock.Anything, mock.Anything)
+}
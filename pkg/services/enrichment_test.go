@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestEnrichAlertRendersTemplates(t *testing.T) {
+	rule := &models.Rule{
+		ID:                  "rule1",
+		Name:                "High temp",
+		Severity:            models.RuleSeverityCritical,
+		RunbookURL:          "https://runbooks.example.com/temperature?device={{.entity_id}}",
+		SummaryTemplate:     "{{.entity_id}} is at {{.temperature}}°C",
+		DescriptionTemplate: "{{.rule_name}} ({{.severity}}) triggered in {{.location}}",
+	}
+	row := map[string]interface{}{
+		"entity_id": "dev1",
+		"state":     "active",
+		"comment":   `{"temperature": "42.5", "location": "lab"}`,
+	}
+
+	alert := &models.Alert{ID: "rule1:dev1"}
+	setAlertRuleDetails(alert, rule)
+	enrichAlert(alert, rule, alertRowData(context.Background(), row))
+
+	assert.Equal(t, "https://runbooks.example.com/temperature?device=dev1", alert.RunbookURL)
+	assert.Equal(t, "dev1 is at 42.5°C", alert.Summary)
+	assert.Equal(t, "High temp (critical) triggered in lab", alert.Description)
+}
+
+func TestValidateRuleTemplates(t *testing.T) {
+	assert.NoError(t, validateRuleTemplates(&models.Rule{SummaryTemplate: "{{.device_id}}"}))
+	assert.ErrorContains(t, validateRuleTemplates(&models.Rule{SummaryTemplate: "{{.device_id"}), "invalid summaryTemplate")
+}
+
+func TestAlertDataJSONKeepsTypes(t *testing.T) {
+	data := alertRowData(context.Background(), map[string]interface{}{
+		"entity_id": "device-1",
+		"state":     "active",
+		"comment":   `{"temperature": 42.5, "reading_count": 9007199254740993, "online": true, "location": "rack \"A\""}`,
+	})
+
+	assert.JSONEq(t, `{"entity_id": "device-1", "state": "active", "temperature": 42.5, "reading_count": 9007199254740993, "online": true, "location": "rack \"A\""}`,
+		alertDataJSON(data))
+	assert.Contains(t, alertDataJSON(data), "9007199254740993")
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// DefaultEntityIDPriority is the list of columns tried in order as a rule's entity ID when the rule
+// names no entity ID columns, unless it is overridden in the configuration or on the rule
+var DefaultEntityIDPriority = []string{"entity_id", "device_id", "id", "host", "ip", "user_id"}
+
+// SetEntityIDPriority sets the columns tried in order as the entity ID of rules without entity ID
+// columns. An empty list restores DefaultEntityIDPriority.
+func (s *RuleService) SetEntityIDPriority(columns []string) {
+	s.entityIDPriority = cleanColumnList(columns)
+}
+
+// entityIDPriorityFor returns the priority columns used for a rule: its own list, the configured
+// list, or DefaultEntityIDPriority
+func (s *RuleService) entityIDPriorityFor(rule *models.Rule) []string {
+	if priority := cleanColumnList(rule.EntityIDPriority); len(priority) > 0 {
+		return priority
+	}
+	if len(s.entityIDPriority) > 0 {
+		return s.entityIDPriority
+	}
+	return DefaultEntityIDPriority
+}
+
+// priorityEntityColumn returns the first priority column present in the DESCRIBE results of a
+// view, or "" when none of them are
+func priorityEntityColumn(columnResults []map[string]interface{}, priority []string) string {
+	available := make(map[string]bool, len(columnResults))
+	for _, column := range columnResults {
+		if name, ok := column["name"].(string); ok {
+			available[name] = true
+		}
+	}
+
+	for _, name := range priority {
+		if available[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// cleanColumnList trims column names and drops empty ones
+func cleanColumnList(columns []string) []string {
+	var cleaned []string
+	for _, column := range columns {
+		if column = strings.TrimSpace(column); column != "" {
+			cleaned = append(cleaned, column)
+		}
+	}
+	return cleaned
+}
+
+// entityIDUnresolvedError describes why no entity ID column was found for a rule, listing the
+// columns of its view so the rule can be corrected
+func entityIDUnresolvedError(rule *models.Rule, priority []string, columnResults []map[string]interface{}) error {
+	var available []string
+	for _, column := range columnResults {
+		if name, ok := column["name"].(string); ok && !strings.HasPrefix(name, "_tp_") {
+			available = append(available, name)
+		}
+	}
+
+	tried := priority
+	if columns := cleanColumnList(strings.Split(rule.EntityIDColumns, ",")); len(columns) > 0 {
+		tried = append(columns, priority...)
+	}
+	return fmt.Errorf("%w: no entity ID column found for rule %s (tried %s), available columns: %s. Set entityIdColumns or entityIdPriority to one of them",
+		ErrInvalidRule, rule.ID, strings.Join(tried, ", "), strings.Join(available, ", "))
+}
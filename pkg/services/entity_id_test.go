@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestPriorityEntityColumnFollowsPriorityOrder(t *testing.T) {
+	columns := []map[string]interface{}{
+		{"name": "host", "type": "string"},
+		{"name": "device_id", "type": "string"},
+		{"name": "temperature", "type": "float64"},
+	}
+
+	assert.Equal(t, "device_id", priorityEntityColumn(columns, DefaultEntityIDPriority))
+	assert.Equal(t, "host", priorityEntityColumn(columns, []string{"serial", "host"}))
+	assert.Equal(t, "", priorityEntityColumn(columns, []string{"serial"}))
+}
+
+func TestEntityIDPriorityFor(t *testing.T) {
+	s := &RuleService{}
+	assert.Equal(t, DefaultEntityIDPriority, s.entityIDPriorityFor(&models.Rule{}))
+
+	s.SetEntityIDPriority([]string{" serial ", ""})
+	assert.Equal(t, []string{"serial"}, s.entityIDPriorityFor(&models.Rule{}))
+
+	rule := &models.Rule{EntityIDPriority: []string{"hostname", "ip"}}
+	assert.Equal(t, []string{"hostname", "ip"}, s.entityIDPriorityFor(rule))
+
+	s.SetEntityIDPriority(nil)
+	assert.Equal(t, DefaultEntityIDPriority, s.entityIDPriorityFor(&models.Rule{}))
+}
+
+func TestMapToRuleParsesEntityIDPriority(t *testing.T) {
+	rule := mapToRule(map[string]interface{}{
+		"id":                 "r1",
+		"entity_id_priority": "serial, hostname",
+		"entity_id_column":   "hostname",
+	})
+	assert.Equal(t, []string{"serial", "hostname"}, rule.EntityIDPriority)
+	assert.Equal(t, "hostname", rule.EntityIDColumn)
+}
+
+func TestEntityIDUnresolvedErrorListsColumns(t *testing.T) {
+	columns := []map[string]interface{}{
+		{"name": "temperature", "type": "float64"},
+		{"name": "reading_count", "type": "int64"},
+		{"name": "_tp_time", "type": "datetime64(3, 'UTC')"},
+	}
+	rule := &models.Rule{ID: "r1", EntityIDColumns: "serial", RequireEntityID: true}
+
+	err := entityIDUnresolvedError(rule, []string{"device_id", "host"}, columns)
+	assert.True(t, errors.Is(err, ErrInvalidRule))
+	assert.Contains(t, err.Error(), "tried serial, device_id, host")
+	assert.Contains(t, err.Error(), "available columns: temperature, reading_count.")
+}
+
+// persistedRuleRow returns the row persistRule writes for a rule, cut down to the columns
+// GetRules selects, as loading the rule reads it back
+func persistedRuleRow(t *testing.T, rule *models.Rule) map[string]interface{} {
+	t.Helper()
+	var written map[string]interface{}
+	mockClient := new(MockClient)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		columns := args.Get(2).([]string)
+		values := args.Get(3).([]interface{})
+		written = make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			written[column] = values[i]
+		}
+	}).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	require.NoError(t, service.persistRule(context.Background(), rule, true))
+
+	row := make(map[string]interface{})
+	for _, column := range strings.Split(ruleSelectColumns, ",") {
+		column = strings.TrimSpace(column)
+		if value, ok := written[column]; ok {
+			row[column] = value
+		}
+	}
+	return row
+}
+
+func TestEntityIDPriorityRoundTrip(t *testing.T) {
+	rule := mapToRule(persistedRuleRow(t, &models.Rule{ID: "r1", EntityIDPriority: []string{"serial", "hostname"}}))
+	assert.Equal(t, []string{"serial", "hostname"}, rule.EntityIDPriority)
+}
+
+func TestRequireEntityIDRoundTrip(t *testing.T) {
+	rule := mapToRule(persistedRuleRow(t, &models.Rule{ID: "r1", RequireEntityID: true}))
+	assert.True(t, rule.RequireEntityID)
+}
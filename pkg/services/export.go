@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ExportedAlert is an alert as exported for reports, with the entity and state of its alert acks row
+type ExportedAlert struct {
+	*models.Alert
+	EntityID string `json:"entityId"`
+	State    string `json:"state"`
+}
+
+// ExportAlerts streams the alerts that fired between start and end to fn, oldest first, without
+// holding them in memory. An empty ruleID exports the alerts of all rules. Exporting stops at the
+// first error returned by fn, which is returned.
+func (s *RuleService) ExportAlerts(ctx context.Context, ruleID string, start, end time.Time, fn func(*ExportedAlert) error) error {
+	source := timeplus.AlertAcksTable()
+	where := fmt.Sprintf("created_at >= %s AND created_at <= %s", timeplus.DateTime64(start), timeplus.DateTime64(end))
+	if ruleID != "" {
+		source = fmt.Sprintf("table(`%s`)", timeplus.AlertAcksStreamFor(ruleID))
+		where = fmt.Sprintf("rule_id = '%s' AND %s", strings.ReplaceAll(ruleID, "'", "''"), where)
+	}
+	query := fmt.Sprintf(`
+		SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, severity, firing_seq
+		FROM %s
+		WHERE %s
+		ORDER BY created_at
+	`, source, where)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Rules are looked up once per export; deleted rules are exported without their details
+	rules := make(map[string]*models.Rule)
+	var fnErr error
+	err := s.tpClient.StreamQuery(ctx, query, func(row interface{}) {
+		result, ok := row.(map[string]interface{})
+		if !ok || fnErr != nil {
+			return
+		}
+		id := getString(result, "rule_id")
+		rule, cached := rules[id]
+		if !cached {
+			rule, _ = s.GetRule(ctx, id)
+			rules[id] = rule
+		}
+		alert := &ExportedAlert{
+			Alert:    s.alertFromAckRow(ctx, result, rule),
+			EntityID: getString(result, "entity_id"),
+			State:    getString(result, "state"),
+		}
+		if err := fn(alert); err != nil {
+			fnErr = err
+			cancel()
+		}
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export alerts: %w", err)
+	}
+	return nil
+}
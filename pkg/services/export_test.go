@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportAlertsStreamsRows(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{{"id": "rule-1", "name": "High Temperature", "status": "running", "severity": "warning"}}, nil)
+
+	triggeredAt := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	mockClient.On("StreamQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "created_at >= to_datetime64('2026-01-02 00:00:00.000', 3, 'UTC')") &&
+			strings.Contains(query, "created_at <= to_datetime64('2026-01-03 00:00:00.000', 3, 'UTC')") &&
+			strings.Contains(query, "ORDER BY created_at")
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		callback := args.Get(2).(func(row interface{}))
+		for i := 0; i < 3; i++ {
+			callback(map[string]interface{}{
+				"rule_id": "rule-1", "entity_id": "device-1", "state": "active", "created_at": triggeredAt,
+				"updated_at": triggeredAt, "firing_seq": int64(i), "comment": `{"temperature": 42.5}`,
+			})
+		}
+	}).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	var exported []*ExportedAlert
+	err := service.ExportAlerts(context.Background(), "", start, start.Add(24*time.Hour), func(alert *ExportedAlert) error {
+		exported = append(exported, alert)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 3)
+
+	assert.Equal(t, "High Temperature", exported[0].RuleName)
+	assert.Equal(t, "device-1", exported[0].EntityID)
+	assert.Equal(t, "active", exported[0].State)
+	assert.Equal(t, triggeredAt, exported[0].TriggeredAt)
+	assert.NotEqual(t, exported[0].ID, exported[1].ID)
+
+	// The rule is looked up once for the whole export
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
+
+func TestExportAlertsStopsOnCallbackError(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+	mockClient.On("StreamQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "rule_id = 'rule''s'")
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		callback := args.Get(2).(func(row interface{}))
+		for i := 0; i < 3 && ctx.Err() == nil; i++ {
+			callback(map[string]interface{}{"rule_id": "rule's", "entity_id": "device-1", "state": "active", "firing_seq": int64(i)})
+		}
+	}).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	clientGone := errors.New("client went away")
+	calls := 0
+	err := service.ExportAlerts(context.Background(), "rule's", time.Now().Add(-time.Hour), time.Now(), func(*ExportedAlert) error {
+		calls++
+		return clientGone
+	})
+	assert.ErrorIs(t, err, clientGone)
+	assert.Equal(t, 1, calls)
+}
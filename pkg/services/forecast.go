@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// DefaultForecastLookbackDays is the firing history alert volume is forecast from
+const DefaultForecastLookbackDays = 14
+
+// MaxForecastLookbackDays caps the firing history a forecast reads
+const MaxForecastLookbackDays = 90
+
+// Thresholds of the alert volume spike detection
+const (
+	forecastHorizon         = 24 * time.Hour
+	spikeStdDevs            = 3.0 // Standard deviations above the usual volume of the hour that make a spike
+	spikeMinFirings         = 10  // Firings in an hour below which nothing is a spike
+	forecastUpperBoundWidth = 2.0 // Standard deviations between the expected and upper bound of an hour
+)
+
+// HourlyForecast is the alert volume expected of a rule in one hour
+type HourlyForecast struct {
+	Hour     time.Time `json:"hour"`
+	Expected float64   `json:"expected"`
+	Upper    float64   `json:"upper"` // Volume above which the hour would be unusual
+}
+
+// RuleForecast projects a rule's alert volume over the next 24 hours from the firings in its alert
+// history at the same hours of the day, and flags whether its latest hour was a spike
+type RuleForecast struct {
+	RuleID          string           `json:"ruleId"`
+	RuleName        string           `json:"ruleName"`
+	HistoryFirings  int64            `json:"historyFirings"` // Firings in the lookback window
+	ExpectedNext24h float64          `json:"expectedNext24h"`
+	Hourly          []HourlyForecast `json:"hourly"`
+	LastHour        time.Time        `json:"lastHour"`        // Latest complete hour, checked for a spike
+	LastHourFirings int64            `json:"lastHourFirings"` // Firings in the latest complete hour
+	UsualFirings    float64          `json:"usualFirings"`    // Average firings at that hour of the day before it
+	Spike           bool             `json:"spike"`
+	SpikeMessage    string           `json:"spikeMessage,omitempty"`
+}
+
+// AlertForecast is the alert volume forecast of every rule
+type AlertForecast struct {
+	GeneratedAt     time.Time       `json:"generatedAt"`
+	LookbackDays    int             `json:"lookbackDays"`
+	ExpectedNext24h float64         `json:"expectedNext24h"`
+	Spikes          int             `json:"spikes"` // Rules whose latest hour was a spike
+	Rules           []*RuleForecast `json:"rules"`
+}
+
+// ForecastAlertVolume forecasts the alert volume of every rule, or of one rule when ruleID is set,
+// from the last lookbackDays of firing history
+func (s *RuleService) ForecastAlertVolume(ctx context.Context, ruleID string, lookbackDays int) (*AlertForecast, error) {
+	if lookbackDays <= 0 {
+		lookbackDays = DefaultForecastLookbackDays
+	}
+	if lookbackDays > MaxForecastLookbackDays {
+		return nil, fmt.Errorf("lookback must be at most %d days", MaxForecastLookbackDays)
+	}
+
+	var rules []*models.Rule
+	if ruleID != "" {
+		rule, err := s.GetRule(ctx, ruleID)
+		if err != nil {
+			return nil, err
+		}
+		rules = []*models.Rule{rule}
+	} else {
+		var err error
+		if rules, err = s.GetRules(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	forecast := &AlertForecast{GeneratedAt: now, LookbackDays: lookbackDays, Rules: make([]*RuleForecast, 0, len(rules))}
+	for _, rule := range rules {
+		hourly, err := s.ruleHourlyFirings(ctx, rule, now, lookbackDays)
+		if err != nil {
+			return nil, err
+		}
+		ruleForecast := forecastRule(hourly, now, lookbackDays)
+		ruleForecast.RuleID = rule.ID
+		ruleForecast.RuleName = rule.Name
+
+		forecast.ExpectedNext24h += ruleForecast.ExpectedNext24h
+		if ruleForecast.Spike {
+			forecast.Spikes++
+		}
+		forecast.Rules = append(forecast.Rules, ruleForecast)
+	}
+	return forecast, nil
+}
+
+// ruleHourlyFirings counts a rule's firings per hour over the lookback window, by the start of the
+// hour. Rules that have never been started have no history.
+func (s *RuleService) ruleHourlyFirings(ctx context.Context, rule *models.Rule, now time.Time, lookbackDays int) (map[time.Time]int64, error) {
+	historyStream := getRuleResources(rule).AlertHistoryStream
+	exists, err := s.tpClient.StreamExists(ctx, historyStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check alert history stream: %w", err)
+	}
+	if !exists {
+		return map[time.Time]int64{}, nil
+	}
+
+	start := now.Truncate(time.Hour).Add(-time.Duration(lookbackDays) * 24 * time.Hour)
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT to_start_of_hour(triggered_at) AS hour, count() AS firings FROM table(`%s`) WHERE triggered_at >= %s GROUP BY hour",
+		historyStream, timeplus.DateTime64(start)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count hourly firings of rule %s: %w", rule.ID, err)
+	}
+
+	hourly := make(map[time.Time]int64, len(rows))
+	for _, row := range rows {
+		hourly[getTime(row, "hour").Truncate(time.Hour)] = getInt64(row, "firings")
+	}
+	return hourly, nil
+}
+
+// forecastRule forecasts each of the next 24 hours as the average firings at that hour of the day
+// over the lookback window, and compares the latest complete hour with the same hour on the days
+// before it
+func forecastRule(hourly map[time.Time]int64, now time.Time, lookbackDays int) *RuleForecast {
+	current := now.Truncate(time.Hour)
+	lastHour := current.Add(-time.Hour)
+	forecast := &RuleForecast{Hourly: make([]HourlyForecast, 0, int(forecastHorizon.Hours())), LastHour: lastHour}
+
+	start := current.Add(-time.Duration(lookbackDays) * 24 * time.Hour)
+	for hour, firings := range hourly {
+		if !hour.Before(start) && hour.Before(current) {
+			forecast.HistoryFirings += firings
+		}
+	}
+
+	// Firings at the same hour of the day on each day of the window, zero when the rule didn't fire
+	sameHour := func(hour time.Time, days int) []float64 {
+		counts := make([]float64, 0, days)
+		for day := 1; day <= days; day++ {
+			counts = append(counts, float64(hourly[hour.Add(-time.Duration(day)*24*time.Hour)]))
+		}
+		return counts
+	}
+
+	for hour := current; hour.Before(current.Add(forecastHorizon)); hour = hour.Add(time.Hour) {
+		// The hours ahead repeat the hours of the day already seen, nearest first
+		mean, stdDev := meanStdDev(sameHour(hour, lookbackDays))
+		expected := math.Round(mean*100) / 100
+		forecast.Hourly = append(forecast.Hourly, HourlyForecast{
+			Hour:     hour,
+			Expected: expected,
+			Upper:    math.Round((mean+forecastUpperBoundWidth*stdDev)*100) / 100,
+		})
+		forecast.ExpectedNext24h += expected
+	}
+	forecast.ExpectedNext24h = math.Round(forecast.ExpectedNext24h*100) / 100
+
+	forecast.LastHourFirings = hourly[lastHour]
+	mean, stdDev := meanStdDev(sameHour(lastHour, lookbackDays))
+	forecast.UsualFirings = math.Round(mean*100) / 100
+	if forecast.LastHourFirings >= spikeMinFirings && float64(forecast.LastHourFirings) > mean+spikeStdDevs*stdDev {
+		forecast.Spike = true
+		forecast.SpikeMessage = fmt.Sprintf("The rule fired %d times in the hour from %s, usually %.1f times at that hour",
+			forecast.LastHourFirings, lastHour.Format(time.RFC3339), mean)
+	}
+	return forecast
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
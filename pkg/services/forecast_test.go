@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecastRule(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 30, 0, 0, time.UTC)
+	current := now.Truncate(time.Hour)
+
+	// Every day the rule fires 4 times at 10:00 and 2 times at 11:00, 20 in total in the 09:00 hour
+	hourly := map[time.Time]int64{}
+	for day := 1; day <= 7; day++ {
+		hourly[current.Add(-time.Duration(day)*24*time.Hour)] = 4
+		hourly[current.Add(time.Hour-time.Duration(day)*24*time.Hour)] = 2
+	}
+	for day := 1; day <= 6; day++ {
+		hourly[current.Add(-time.Hour-time.Duration(day)*24*time.Hour)] = 3
+	}
+	hourly[current.Add(-time.Hour)] = 20
+
+	forecast := forecastRule(hourly, now, 7)
+	require.Len(t, forecast.Hourly, 24)
+	assert.Equal(t, HourlyForecast{Hour: current, Expected: 4, Upper: 4}, forecast.Hourly[0])
+	assert.Equal(t, 2.0, forecast.Hourly[1].Expected)
+	assert.Equal(t, 0.0, forecast.Hourly[2].Expected)
+	// Tomorrow's 09:00 hour averages the latest hour's 20 firings with 3 on each of the 6 days before
+	assert.InDelta(t, 5.43, forecast.Hourly[23].Expected, 0.01)
+	assert.Greater(t, forecast.Hourly[23].Upper, forecast.Hourly[23].Expected)
+	assert.InDelta(t, 11.43, forecast.ExpectedNext24h, 0.01)
+	assert.Equal(t, int64(7*4+7*2+6*3+20), forecast.HistoryFirings)
+
+	assert.Equal(t, current.Add(-time.Hour), forecast.LastHour)
+	assert.Equal(t, int64(20), forecast.LastHourFirings)
+	assert.True(t, forecast.Spike)
+	assert.Contains(t, forecast.SpikeMessage, "fired 20 times")
+
+	// Too few firings to be a spike, however unusual
+	hourly[current.Add(-time.Hour)] = 9
+	assert.False(t, forecastRule(hourly, now, 7).Spike)
+
+	// No history, no forecast
+	empty := forecastRule(map[time.Time]int64{}, now, 7)
+	assert.Zero(t, empty.ExpectedNext24h)
+	assert.False(t, empty.Spike)
+}
+
+func TestForecastAlertVolume(t *testing.T) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-24 * time.Hour)
+
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule1_alert_history").Return(true, nil)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule2_alert_history").Return(false, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "to_start_of_hour(triggered_at)") && strings.Contains(query, "`rule_rule1_alert_history`")
+	})).Return([]map[string]interface{}{{"hour": hour, "firings": uint64(14)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "running"},
+		{"id": "rule2", "name": "Never started", "status": "created"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	forecast, err := service.ForecastAlertVolume(context.Background(), "", 7)
+	require.NoError(t, err)
+	require.Len(t, forecast.Rules, 2)
+	assert.Equal(t, 7, forecast.LookbackDays)
+	assert.Equal(t, int64(14), forecast.Rules[0].HistoryFirings)
+	assert.Equal(t, 2.0, forecast.Rules[0].ExpectedNext24h)
+	assert.Zero(t, forecast.Rules[1].HistoryFirings)
+	assert.Equal(t, 2.0, forecast.ExpectedNext24h)
+	assert.Zero(t, forecast.Spikes)
+
+	_, err = service.ForecastAlertVolume(context.Background(), "", MaxForecastLookbackDays+1)
+	assert.Error(t, err)
+}
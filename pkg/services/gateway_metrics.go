@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Gateway metrics written to GatewayMetricsStream. Gauges are their value when written; counters
+// are their increase since the previous write, so a rule can compare single rows.
+const (
+	GatewayMetricRulesTotal             = "rules_total"             // Gauge
+	GatewayMetricRulesRunning           = "rules_running"           // Gauge
+	GatewayMetricRulesFailed            = "rules_failed"            // Gauge
+	GatewayMetricNotificationsQueued    = "notifications_queued"    // Gauge, events waiting for a notifier
+	GatewayMetricNotificationsDelivered = "notifications_delivered" // Counter, one per event and notifier
+	GatewayMetricNotificationFailures   = "notification_failures"   // Counter, one per event and notifier
+	GatewayMetricTimeplusRetries        = "timeplus_retries"        // Counter, queries and inserts tried again
+	GatewayMetricTimeplusErrors         = "timeplus_errors"         // Counter, failed Timeplus operations
+	GatewayMetricTimeplusReconnects     = "timeplus_reconnects"     // Counter
+	GatewayMetricCircuitOpen            = "timeplus_circuit_open"   // Gauge, 1 while the circuit breaker fails operations fast
+)
+
+// DefaultGatewayMetricsInterval is how often gateway metrics are written by default
+const DefaultGatewayMetricsInterval = time.Minute
+
+// StartGatewayMetrics creates the gateway metrics stream if needed and writes the gateway's
+// metrics to it every interval. Shutdown stops it.
+func (s *RuleService) StartGatewayMetrics(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultGatewayMetricsInterval
+	}
+	if err := s.tpClient.CreateStream(ctx, timeplus.GatewayMetricsStream, timeplus.GetGatewayMetricsSchema()); err != nil {
+		return fmt.Errorf("failed to ensure gateway metrics stream: %w", err)
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	s.stopGatewayMetrics = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-loopCtx.Done():
+				return
+			case <-ticker.C:
+				if err := s.WriteGatewayMetrics(loopCtx); err != nil {
+					logrus.Warnf("Failed to write gateway metrics: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// WriteGatewayMetrics writes the gateway's current metrics to the gateway metrics stream. Metrics
+// that can't be collected, e.g. rule counts while Timeplus is unreachable, are left out.
+func (s *RuleService) WriteGatewayMetrics(ctx context.Context) error {
+	metrics := s.collectGatewayMetrics(ctx)
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	instance = strings.ReplaceAll(instance, "'", "''")
+	at := timeplus.DateTime64(time.Now())
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = fmt.Sprintf("('%s', '%s', %g, %s)", instance, name, metrics[name], at)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (instance, metric, value, at) VALUES %s",
+		timeplus.GatewayMetricsStream, strings.Join(values, ", "))
+	if _, err := s.tpClient.ExecuteQuery(ctx, query); err != nil {
+		return fmt.Errorf("failed to write gateway metrics: %w", err)
+	}
+	return nil
+}
+
+// collectGatewayMetrics gathers the gauges and the increase of the counters since the previous
+// collection. Counters aren't reported by the first collection, which only sets their baseline.
+func (s *RuleService) collectGatewayMetrics(ctx context.Context) map[string]float64 {
+	metrics := make(map[string]float64)
+
+	if rules, err := s.GetRules(ctx); err != nil {
+		logrus.Debugf("Gateway metrics: failed to list rules: %v", err)
+	} else {
+		var running, failed int
+		for _, rule := range rules {
+			switch rule.Status {
+			case models.RuleStatusRunning:
+				running++
+			case models.RuleStatusFailed:
+				failed++
+			}
+		}
+		metrics[GatewayMetricRulesTotal] = float64(len(rules))
+		metrics[GatewayMetricRulesRunning] = float64(running)
+		metrics[GatewayMetricRulesFailed] = float64(failed)
+	}
+
+	counters := make(map[string]int64)
+	if s.dispatcher != nil {
+		stats := s.dispatcher.Stats()
+		metrics[GatewayMetricNotificationsQueued] = float64(stats.Queued)
+		counters[GatewayMetricNotificationsDelivered] = stats.Delivered
+		counters[GatewayMetricNotificationFailures] = stats.Failed
+	}
+	if client, ok := s.tpClient.(connectionStatser); ok {
+		stats := client.ConnectionStats()
+		counters[GatewayMetricTimeplusRetries] = stats.Retries
+		counters[GatewayMetricTimeplusErrors] = stats.Errors
+		counters[GatewayMetricTimeplusReconnects] = stats.Reconnects
+		if stats.Circuit != nil {
+			metrics[GatewayMetricCircuitOpen] = 0
+			if stats.Circuit.State == timeplus.CircuitOpen {
+				metrics[GatewayMetricCircuitOpen] = 1
+			}
+		}
+	}
+
+	s.gatewayMetricsMutex.Lock()
+	defer s.gatewayMetricsMutex.Unlock()
+	for name, total := range counters {
+		if previous, ok := s.gatewayMetricsBaseline[name]; ok {
+			metrics[name] = float64(total - previous)
+		}
+	}
+	s.gatewayMetricsBaseline = counters
+	return metrics
+}
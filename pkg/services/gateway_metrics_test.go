@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// statsMockClient is a mock client keeping connection stats
+type statsMockClient struct {
+	*MockClient
+	stats timeplus.ConnectionStats
+}
+
+func (c *statsMockClient) ConnectionStats() timeplus.ConnectionStats {
+	return c.stats
+}
+
+func TestWriteGatewayMetrics(t *testing.T) {
+	var inserts []string
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "INSERT INTO "+timeplus.GatewayMetricsStream)
+	})).Run(func(args mock.Arguments) {
+		inserts = append(inserts, args.String(1))
+	}).Return([]map[string]interface{}(nil), nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Broken", "status": "failed"},
+		{"id": "r2", "name": "Fine", "status": "running"},
+		{"id": "r3", "name": "Idle", "status": "stopped"},
+	}, nil)
+	client := &statsMockClient{MockClient: mockClient, stats: timeplus.ConnectionStats{Retries: 4, Errors: 2,
+		Circuit: &timeplus.CircuitStatus{State: timeplus.CircuitOpen}}}
+
+	dispatcher := notify.NewDispatcher(10, 1, failingNotifier{})
+	service := &RuleService{tpClient: client, ruleStream: "tp_rules"}
+	service.SetNotificationDispatcher(dispatcher)
+
+	// The first write only sets the baseline of counters
+	require.NoError(t, service.WriteGatewayMetrics(context.Background()))
+	require.Len(t, inserts, 1)
+	assert.Contains(t, inserts[0], "'rules_total', 3,")
+	assert.Contains(t, inserts[0], "'rules_running', 1,")
+	assert.Contains(t, inserts[0], "'rules_failed', 1,")
+	assert.Contains(t, inserts[0], "'timeplus_circuit_open', 1,")
+	assert.NotContains(t, inserts[0], "timeplus_retries")
+
+	require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{RuleID: "r1"})))
+	require.Eventually(t, func() bool { return dispatcher.Stats().Failed == 1 }, time.Second, 10*time.Millisecond)
+	client.stats.Retries = 7
+
+	// Counters are written as their increase since the previous write
+	require.NoError(t, service.WriteGatewayMetrics(context.Background()))
+	require.Len(t, inserts, 2)
+	assert.Contains(t, inserts[1], "'timeplus_retries', 3,")
+	assert.Contains(t, inserts[1], "'timeplus_errors', 0,")
+	assert.Contains(t, inserts[1], "'notification_failures', 1,")
+	assert.Contains(t, inserts[1], "'notifications_delivered', 0,")
+}
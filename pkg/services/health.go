@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Health statuses of the gateway
+const (
+	HealthStatusOK          = "ok"          // Timeplus is reachable and every running rule has its resources
+	HealthStatusDegraded    = "degraded"    // Timeplus is reachable but some rules could not be recovered
+	HealthStatusUnavailable = "unavailable" // Timeplus can't be reached
+)
+
+// HealthReport is the outcome of a health check
+type HealthReport struct {
+	Status        string            `json:"status"`
+	TimeplusError string            `json:"timeplusError,omitempty"`
+	CheckedAt     time.Time         `json:"checkedAt"`
+	Rules         []ReconcileResult `json:"rules"`     // Running rules checked, with what was done for each
+	Recovered     int64             `json:"recovered"` // Rules recreated by health checks since startup
+	LastRecovery  *time.Time        `json:"lastRecovery,omitempty"`
+	// Subscriptions pushing alerts to the notification pipeline, nil when the alert monitor isn't running
+	Monitor *AlertMonitorStatus `json:"monitor,omitempty"`
+	// Subscription following rule changes made through other replicas, nil when it isn't running
+	RuleChanges *RuleChangeFeedStatus `json:"ruleChanges,omitempty"`
+	// Notifications recorded and delivered through the outbox, nil when it isn't enabled
+	Outbox *OutboxStatus `json:"outbox,omitempty"`
+	// Set while the gateway is paused
+	Pause *PauseState `json:"pause,omitempty"`
+}
+
+// CheckHealth checks that Timeplus is reachable and reconciles running rules with what exists in
+// Timeplus, recreating the views of rules that lost them. The result is kept as the latest health report.
+func (s *RuleService) CheckHealth(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthStatusOK, CheckedAt: time.Now(), Rules: []ReconcileResult{}}
+
+	if _, err := s.tpClient.ExecuteQuery(ctx, "SELECT 1"); err != nil {
+		report.Status = HealthStatusUnavailable
+		report.TimeplusError = err.Error()
+	} else if results, err := s.ReconcileRules(ctx); err != nil {
+		report.Status = HealthStatusUnavailable
+		report.TimeplusError = err.Error()
+	} else {
+		report.Rules = results
+	}
+
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+
+	for _, result := range report.Rules {
+		switch result.Action {
+		case ReconcileActionRecreated:
+			s.recovered++
+			s.lastRecovery = &report.CheckedAt
+		case ReconcileActionFailed:
+			report.Status = HealthStatusDegraded
+		}
+	}
+	report.Recovered = s.recovered
+	report.LastRecovery = s.lastRecovery
+	s.lastHealth = &report
+
+	report.Monitor = s.alertMonitorStatus()
+	report.RuleChanges = s.ruleChangeFeedStatus()
+	report.Outbox = s.outboxStatus()
+	report.Pause = s.pauseReport()
+	return report
+}
+
+// Health returns the latest health report, running a check if there hasn't been one yet
+func (s *RuleService) Health(ctx context.Context) HealthReport {
+	s.healthMutex.RLock()
+	last := s.lastHealth
+	s.healthMutex.RUnlock()
+
+	if last == nil {
+		return s.CheckHealth(ctx)
+	}
+	report := *last
+	report.Monitor = s.alertMonitorStatus()
+	report.RuleChanges = s.ruleChangeFeedStatus()
+	report.Outbox = s.outboxStatus()
+	report.Pause = s.pauseReport()
+	return report
+}
+
+// StartHealthMonitor periodically checks health, so rules whose views were dropped while the gateway
+// is running are recreated without waiting for a restart
+func (s *RuleService) StartHealthMonitor(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopHealthMonitor = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report := s.CheckHealth(ctx)
+				if report.Status != HealthStatusOK {
+					logrus.Warnf("Health check: %s %s", report.Status, report.TimeplusError)
+				}
+			}
+		}
+	}()
+}
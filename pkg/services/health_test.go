@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestCheckHealthHealthy(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Healthy", "status": "running"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"rule_rule1_view", timeplus.AlertAcksMutableStream}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{"rule_rule1_mv"}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	report := service.CheckHealth(context.Background())
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Len(t, report.Rules, 1)
+	assert.Equal(t, ReconcileActionNone, report.Rules[0].Action)
+	assert.Zero(t, report.Recovered)
+
+	// The latest report is served without checking again
+	cached := service.Health(context.Background())
+	assert.Equal(t, report.CheckedAt, cached.CheckedAt)
+	mockClient.AssertNumberOfCalls(t, "ListStreams", 1)
+}
+
+func TestCheckHealthTimeplusUnavailable(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, "SELECT 1").Return([]map[string]interface{}(nil), errors.New("connection refused"))
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	report := service.CheckHealth(context.Background())
+	assert.Equal(t, HealthStatusUnavailable, report.Status)
+	assert.Contains(t, report.TimeplusError, "connection refused")
+	assert.Empty(t, report.Rules)
+	mockClient.AssertNotCalled(t, "ListStreams", mock.Anything)
+}
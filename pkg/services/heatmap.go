@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Heatmap ranges
+const (
+	DefaultHeatmapDays = 14
+	MaxHeatmapDays     = 90
+)
+
+// heatmapWeekdays labels the rows of a heatmap, Monday first
+var heatmapWeekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// AlertHeatmap counts alert firings by day of the week and time of day, showing when alerts cluster
+type AlertHeatmap struct {
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Days        int           `json:"days"`
+	BucketHours int           `json:"bucketHours"`
+	Timezone    string        `json:"timezone"` // Timezone the days and hours are in
+	RuleID      string        `json:"ruleId,omitempty"`
+	Weekdays    []string      `json:"weekdays"` // Row labels, Monday first
+	Buckets     []string      `json:"buckets"`  // Column labels, the start of each bucket, e.g. "06:00"
+	Total       int64         `json:"total"`
+	Max         int64         `json:"max"`             // Highest count of a cell, to scale colors by
+	Counts      [][]int64     `json:"counts"`          // Firings by weekday row and time-of-day bucket column
+	Rules       []RuleHeatmap `json:"rules,omitempty"` // Heatmap of each rule with firings, with groupBy=rule
+}
+
+// RuleHeatmap is the heatmap of one rule's firings
+type RuleHeatmap struct {
+	RuleID   string    `json:"ruleId"`
+	RuleName string    `json:"ruleName"`
+	Total    int64     `json:"total"`
+	Max      int64     `json:"max"`
+	Counts   [][]int64 `json:"counts"`
+}
+
+// ParseHeatmapBucket parses the size of a heatmap's time-of-day buckets, a whole number of hours
+// that divides a day, e.g. "1h" or "6h"
+func ParseHeatmapBucket(value string) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+	bucket, err := time.ParseDuration(value)
+	if err != nil || bucket <= 0 || bucket%time.Hour != 0 || (24*time.Hour)%bucket != 0 {
+		return 0, fmt.Errorf("%w: bucket must be a whole number of hours dividing a day, e.g. 1h, 3h or 6h", ErrInvalidReportQuery)
+	}
+	return int(bucket / time.Hour), nil
+}
+
+// GetAlertHeatmap counts the firings of the last days by day of the week and time of day in the
+// display timezone, over every rule or only ruleID. With perRule, each rule's heatmap is included.
+// Firings are counted per hour in Timeplus from the rules' alert history; hours are attributed to
+// the display hour they start in.
+func (s *RuleService) GetAlertHeatmap(ctx context.Context, days, bucketHours int, ruleID string, perRule bool) (*AlertHeatmap, error) {
+	if days <= 0 || days > MaxHeatmapDays {
+		return nil, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidReportQuery, MaxHeatmapDays)
+	}
+	if bucketHours <= 0 || 24%bucketHours != 0 {
+		return nil, fmt.Errorf("%w: bucket must divide a day", ErrInvalidReportQuery)
+	}
+
+	var rules []*models.Rule
+	if ruleID != "" {
+		rule, err := s.GetRule(ctx, ruleID)
+		if err != nil {
+			return nil, err
+		}
+		rules = []*models.Rule{rule}
+	} else {
+		var err error
+		if rules, err = s.GetRules(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	loc := DisplayTimezone()
+	heatmap := &AlertHeatmap{
+		Start:       now.Truncate(time.Hour).Add(-time.Duration(days) * 24 * time.Hour),
+		End:         now,
+		Days:        days,
+		BucketHours: bucketHours,
+		Timezone:    loc.String(),
+		RuleID:      ruleID,
+		Weekdays:    heatmapWeekdays,
+		Counts:      newHeatmapCounts(bucketHours),
+	}
+	for hour := 0; hour < 24; hour += bucketHours {
+		heatmap.Buckets = append(heatmap.Buckets, fmt.Sprintf("%02d:00", hour))
+	}
+
+	for _, rule := range rules {
+		hourly, err := s.ruleHourlyFirings(ctx, rule, now, days)
+		if err != nil {
+			return nil, err
+		}
+		ruleHeatmap := RuleHeatmap{RuleID: rule.ID, RuleName: rule.Name, Counts: newHeatmapCounts(bucketHours)}
+		for hour, firings := range hourly {
+			local := hour.In(loc)
+			// time.Weekday starts on Sunday, rows start on Monday
+			row := (int(local.Weekday()) + 6) % 7
+			column := local.Hour() / bucketHours
+			ruleHeatmap.Counts[row][column] += firings
+			ruleHeatmap.Total += firings
+			heatmap.Counts[row][column] += firings
+		}
+		heatmap.Total += ruleHeatmap.Total
+		if perRule && ruleHeatmap.Total > 0 {
+			ruleHeatmap.Max = heatmapMax(ruleHeatmap.Counts)
+			heatmap.Rules = append(heatmap.Rules, ruleHeatmap)
+		}
+	}
+	heatmap.Max = heatmapMax(heatmap.Counts)
+	return heatmap, nil
+}
+
+// newHeatmapCounts returns an empty weekday by bucket matrix
+func newHeatmapCounts(bucketHours int) [][]int64 {
+	counts := make([][]int64, len(heatmapWeekdays))
+	for i := range counts {
+		counts[i] = make([]int64, 24/bucketHours)
+	}
+	return counts
+}
+
+// heatmapMax returns the highest count of a heatmap
+func heatmapMax(counts [][]int64) int64 {
+	var max int64
+	for _, row := range counts {
+		for _, count := range row {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	return max
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeatmapBucket(t *testing.T) {
+	for value, expected := range map[string]int{"": 1, "1h": 1, "3h": 3, "6h": 6, "24h": 24} {
+		bucket, err := ParseHeatmapBucket(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, bucket, value)
+	}
+	for _, value := range []string{"30m", "5h", "90m", "-1h", "48h", "hourly"} {
+		_, err := ParseHeatmapBucket(value)
+		assert.ErrorIs(t, err, ErrInvalidReportQuery, value)
+	}
+}
+
+func TestGetAlertHeatmap(t *testing.T) {
+	berlin, err := LoadDisplayTimezone("Europe/Berlin")
+	require.NoError(t, err)
+	SetDisplayTimezone(berlin)
+	t.Cleanup(func() { SetDisplayTimezone(time.UTC) })
+
+	// Monday 2026-10-12, two hours ahead of UTC in Berlin
+	mondayMorning := time.Date(2026, 10, 12, 7, 0, 0, 0, time.UTC)
+	mondayNight := time.Date(2026, 10, 12, 23, 0, 0, 0, time.UTC)
+
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule1_alert_history").Return(true, nil)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule2_alert_history").Return(true, nil)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule3_alert_history").Return(false, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "`rule_rule1_alert_history`")
+	})).Return([]map[string]interface{}{
+		{"hour": mondayMorning, "firings": uint64(5)},
+		{"hour": mondayNight, "firings": uint64(2)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "`rule_rule2_alert_history`")
+	})).Return([]map[string]interface{}{{"hour": mondayMorning.Add(2 * time.Hour), "firings": uint64(3)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "running"},
+		{"id": "rule2", "name": "Disk full", "status": "running"},
+		{"id": "rule3", "name": "Never started", "status": "created"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	heatmap, err := service.GetAlertHeatmap(context.Background(), 14, 6, "", true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Europe/Berlin", heatmap.Timezone)
+	assert.Equal(t, []string{"00:00", "06:00", "12:00", "18:00"}, heatmap.Buckets)
+	require.Len(t, heatmap.Counts, 7)
+	assert.Equal(t, []int64{0, 8, 0, 0}, heatmap.Counts[0], "Monday 09:00 and 11:00 in Berlin")
+	assert.Equal(t, []int64{2, 0, 0, 0}, heatmap.Counts[1], "Monday 23:00 UTC is Tuesday in Berlin")
+	assert.Equal(t, int64(10), heatmap.Total)
+	assert.Equal(t, int64(8), heatmap.Max)
+
+	// Rules without firings are left out of the per-rule heatmaps
+	require.Len(t, heatmap.Rules, 2)
+	assert.Equal(t, "rule1", heatmap.Rules[0].RuleID)
+	assert.Equal(t, int64(7), heatmap.Rules[0].Total)
+	assert.Equal(t, int64(5), heatmap.Rules[0].Max)
+
+	_, err = service.GetAlertHeatmap(context.Background(), MaxHeatmapDays+1, 1, "", false)
+	assert.ErrorIs(t, err, ErrInvalidReportQuery)
+}
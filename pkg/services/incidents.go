@@ -0,0 +1,463 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// DefaultIncidentWindow is how long after an incident's latest alert new alerts still join it
+const DefaultIncidentWindow = 10 * time.Minute
+
+// maxIncidents caps the incidents returned by a list request
+const maxIncidents = 500
+
+// incidentActor records alerts grouped into incidents in the alert audit trail
+const incidentActor = "incident"
+
+var (
+	// ErrIncidentNotFound is returned when no incident has the given ID
+	ErrIncidentNotFound = errors.New("incident not found")
+	// ErrIncidentResolved is returned when acknowledging or resolving a resolved incident
+	ErrIncidentResolved = errors.New("incident already resolved")
+	// ErrInvalidIncidentQuery is returned for unknown incident statuses
+	ErrInvalidIncidentQuery = errors.New("invalid incident query")
+)
+
+// IncidentConfig configures how alerts are grouped into incidents
+type IncidentConfig struct {
+	// Labels alerts of an incident share: ruleId, owner, team, or columns of the triggering rows
+	GroupBy []string
+	// An alert joins an incident whose latest alert fired at most this long ago, DefaultIncidentWindow when zero
+	Window time.Duration
+	// How long an incident's notification waits for more alerts to join it, sent right away when zero
+	GroupWait time.Duration
+}
+
+// IncidentStore groups alerts into incidents. Unresolved incidents are kept in memory, all of them
+// in a mutable stream so they survive restarts and can be listed.
+type IncidentStore struct {
+	tpClient   timeplus.StreamStore
+	config     IncidentConfig
+	severities func() *models.SeverityLevels
+	mu         sync.Mutex
+	open       map[string]*models.Incident // Unresolved incidents by ID
+}
+
+// NewIncidentStore ensures the incidents stream exists and loads the unresolved incidents.
+// severities returns the levels an incident's severity is picked by.
+func NewIncidentStore(ctx context.Context, tpClient timeplus.StreamStore, config IncidentConfig, severities func() *models.SeverityLevels) (*IncidentStore, error) {
+	if len(config.GroupBy) == 0 {
+		return nil, fmt.Errorf("incidents need at least one groupBy label")
+	}
+	for i, label := range config.GroupBy {
+		if strings.TrimSpace(label) == "" {
+			return nil, fmt.Errorf("incident groupBy[%d] is empty", i)
+		}
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultIncidentWindow
+	}
+
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.IncidentsStream,
+		timeplus.GetIncidentsSchema(), []string{"id"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure incidents stream: %w", err)
+	}
+
+	store := &IncidentStore{tpClient: tpClient, config: config, severities: severities, open: make(map[string]*models.Incident)}
+	incidents, err := store.query(ctx, fmt.Sprintf("status != '%s'", models.IncidentStatusResolved))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load incidents: %w", err)
+	}
+	for _, incident := range incidents {
+		store.open[incident.ID] = incident
+	}
+
+	logrus.Infof("Loaded %d unresolved incident(s)", len(store.open))
+	return store, nil
+}
+
+// Config returns how the store groups alerts
+func (st *IncidentStore) Config() IncidentConfig {
+	return st.config
+}
+
+// List returns the incidents with a status, or all of them when status is empty, latest first
+func (st *IncidentStore) List(ctx context.Context, status string) ([]*models.Incident, error) {
+	condition := "1 = 1"
+	switch status {
+	case "":
+	case models.IncidentStatusOpen, models.IncidentStatusAcknowledged, models.IncidentStatusResolved:
+		condition = fmt.Sprintf("status = '%s'", status)
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q, expected open, acknowledged or resolved", ErrInvalidIncidentQuery, status)
+	}
+	return st.query(ctx, condition)
+}
+
+// Get returns an incident by ID
+func (st *IncidentStore) Get(ctx context.Context, id string) (*models.Incident, error) {
+	st.mu.Lock()
+	incident, ok := st.open[id]
+	if ok {
+		copied := copyIncident(incident)
+		st.mu.Unlock()
+		return copied, nil
+	}
+	st.mu.Unlock()
+
+	incidents, err := st.query(ctx, fmt.Sprintf("id = '%s'", strings.ReplaceAll(id, "'", "''")))
+	if err != nil {
+		return nil, err
+	}
+	if len(incidents) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIncidentNotFound, id)
+	}
+	return incidents[0], nil
+}
+
+// Acknowledge marks an incident as being worked on. New alerts keep joining it.
+func (st *IncidentStore) Acknowledge(ctx context.Context, id, by string) (*models.Incident, error) {
+	return st.update(ctx, id, func(incident *models.Incident, now time.Time) {
+		incident.Status = models.IncidentStatusAcknowledged
+		incident.AcknowledgedBy = by
+		incident.AcknowledgedAt = &now
+	})
+}
+
+// Resolve closes an incident, so new alerts open a new one. Its alerts keep their state.
+func (st *IncidentStore) Resolve(ctx context.Context, id, by string) (*models.Incident, error) {
+	return st.update(ctx, id, func(incident *models.Incident, now time.Time) {
+		resolveIncident(incident, by, now)
+	})
+}
+
+// update changes an unresolved incident and persists it
+func (st *IncidentStore) update(ctx context.Context, id string, change func(*models.Incident, time.Time)) (*models.Incident, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	incident, ok := st.open[id]
+	if !ok {
+		incidents, err := st.query(ctx, fmt.Sprintf("id = '%s'", strings.ReplaceAll(id, "'", "''")))
+		if err != nil {
+			return nil, err
+		}
+		if len(incidents) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrIncidentNotFound, id)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrIncidentResolved, id)
+	}
+
+	updated := copyIncident(incident)
+	now := time.Now()
+	change(updated, now)
+	updated.UpdatedAt = now
+	if err := st.persist(ctx, updated); err != nil {
+		return nil, err
+	}
+	st.store(updated)
+	return copyIncident(updated), nil
+}
+
+// Correlate adds a notified alert to the unresolved incident with its correlation key whose latest
+// alert is within the window, or opens a new incident. It returns the incident and whether the alert
+// opened it, or nil when the alert has none of the grouping labels. The alert that opened an incident
+// still opens it when correlated again, e.g. when its notification is retried.
+func (st *IncidentStore) Correlate(ctx context.Context, alert *models.Alert, entityID string) (*models.Incident, bool, error) {
+	key := st.correlationKey(alert)
+	if key == "" {
+		return nil, false, nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	var incident *models.Incident
+	for _, candidate := range st.open {
+		if candidate.CorrelationKey == key && now.Sub(candidate.LastAlertAt) <= st.config.Window &&
+			(incident == nil || candidate.LastAlertAt.After(incident.LastAlertAt)) {
+			incident = candidate
+		}
+	}
+
+	opened := incident == nil || (len(incident.Alerts) > 0 && incident.Alerts[0].AlertID == alert.ID)
+	if incident == nil {
+		incident = &models.Incident{
+			ID:             uuid.New().String(),
+			CorrelationKey: key,
+			Status:         models.IncidentStatusOpen,
+			Title:          incidentTitle(alert, key),
+			OpenedAt:       now,
+		}
+	}
+
+	updated := copyIncident(incident)
+	member := models.IncidentAlert{
+		AlertID:     alert.ID,
+		RuleID:      alert.RuleID,
+		RuleName:    alert.RuleName,
+		EntityID:    entityID,
+		Severity:    alert.Severity,
+		State:       timeplus.AlertStateActive,
+		TriggeredAt: alert.TriggeredAt,
+	}
+	if member.TriggeredAt.IsZero() {
+		member.TriggeredAt = now
+	}
+	joined := false
+	for i := range updated.Alerts {
+		if updated.Alerts[i].AlertID == alert.ID {
+			updated.Alerts[i] = member
+			joined = true
+		}
+	}
+	if !joined {
+		updated.Alerts = append(updated.Alerts, member)
+	}
+	if updated.Severity == "" || st.severities().Compare(alert.Severity, updated.Severity) > 0 {
+		updated.Severity = alert.Severity
+	}
+	updated.Summary = incidentSummary(updated.Alerts)
+	updated.LastAlertAt = now
+	updated.UpdatedAt = now
+
+	if err := st.persist(ctx, updated); err != nil {
+		return nil, false, err
+	}
+	st.store(updated)
+	return copyIncident(updated), opened, nil
+}
+
+// AlertChanged records the new state of a member alert. An incident whose alerts are all resolved
+// is resolved too.
+func (st *IncidentStore) AlertChanged(ctx context.Context, alertID, state string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, incident := range st.open {
+		index := -1
+		for i, member := range incident.Alerts {
+			if member.AlertID == alertID {
+				index = i
+				break
+			}
+		}
+		if index < 0 || incident.Alerts[index].State == state {
+			continue
+		}
+
+		updated := copyIncident(incident)
+		now := time.Now()
+		updated.Alerts[index].State = state
+		updated.Summary = incidentSummary(updated.Alerts)
+		updated.UpdatedAt = now
+		if incidentAlertsResolved(updated.Alerts) {
+			resolveIncident(updated, incidentActor, now)
+		}
+		if err := st.persist(ctx, updated); err != nil {
+			logrus.Warnf("Failed to record state of alert %s in incident %s: %v", alertID, incident.ID, err)
+			continue
+		}
+		st.store(updated)
+	}
+}
+
+// store keeps an incident in memory while it's unresolved. The caller must hold st.mu.
+func (st *IncidentStore) store(incident *models.Incident) {
+	if incident.Status == models.IncidentStatusResolved {
+		delete(st.open, incident.ID)
+		return
+	}
+	st.open[incident.ID] = incident
+}
+
+// correlationKey returns the values of an alert's grouping labels, e.g. "team=payments,env=prod",
+// or an empty string when it has none of them
+func (st *IncidentStore) correlationKey(alert *models.Alert) string {
+	parts := make([]string, len(st.config.GroupBy))
+	found := false
+	for i, label := range st.config.GroupBy {
+		value := inhibitionLabel(alert, label)
+		if value != "" {
+			found = true
+		}
+		parts[i] = label + "=" + value
+	}
+	if !found {
+		return ""
+	}
+	return strings.Join(parts, ",")
+}
+
+// persist writes an incident to the incidents stream
+func (st *IncidentStore) persist(ctx context.Context, incident *models.Incident) error {
+	alerts, err := json.Marshal(incident.Alerts)
+	if err != nil {
+		return fmt.Errorf("failed to encode alerts of incident %s: %w", incident.ID, err)
+	}
+	var acknowledgedBy, acknowledgedAt, resolvedBy, resolvedAt interface{}
+	if incident.AcknowledgedAt != nil {
+		acknowledgedBy, acknowledgedAt = incident.AcknowledgedBy, *incident.AcknowledgedAt
+	}
+	if incident.ResolvedAt != nil {
+		resolvedBy, resolvedAt = incident.ResolvedBy, *incident.ResolvedAt
+	}
+
+	columns := []string{"id", "correlation_key", "status", "title", "summary", "severity", "alerts",
+		"opened_at", "last_alert_at", "updated_at", "acknowledged_by", "acknowledged_at", "resolved_by", "resolved_at"}
+	values := []interface{}{incident.ID, incident.CorrelationKey, incident.Status, incident.Title, incident.Summary,
+		string(incident.Severity), string(alerts), incident.OpenedAt, incident.LastAlertAt, incident.UpdatedAt,
+		acknowledgedBy, acknowledgedAt, resolvedBy, resolvedAt}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.IncidentsStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist incident %s: %w", incident.ID, err)
+	}
+	return nil
+}
+
+// query reads the incidents matching a condition from the incidents stream, latest first
+func (st *IncidentStore) query(ctx context.Context, condition string) ([]*models.Incident, error) {
+	rows, err := st.tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT id, correlation_key, status, title, summary, severity, alerts, opened_at, last_alert_at, updated_at, "+
+			"acknowledged_by, acknowledged_at, resolved_by, resolved_at FROM table(%s) WHERE %s ORDER BY opened_at DESC LIMIT %d",
+		timeplus.IncidentsStream, condition, maxIncidents))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+
+	incidents := make([]*models.Incident, 0, len(rows))
+	for _, row := range rows {
+		incident := &models.Incident{
+			ID:             getString(row, "id"),
+			CorrelationKey: getString(row, "correlation_key"),
+			Status:         getString(row, "status"),
+			Title:          getString(row, "title"),
+			Summary:        getString(row, "summary"),
+			Severity:       models.RuleSeverity(getString(row, "severity")),
+			OpenedAt:       getTime(row, "opened_at"),
+			LastAlertAt:    getTime(row, "last_alert_at"),
+			UpdatedAt:      getTime(row, "updated_at"),
+			AcknowledgedBy: getString(row, "acknowledged_by"),
+			ResolvedBy:     getString(row, "resolved_by"),
+		}
+		if at := getTime(row, "acknowledged_at"); !at.IsZero() {
+			incident.AcknowledgedAt = &at
+		}
+		if at := getTime(row, "resolved_at"); !at.IsZero() {
+			incident.ResolvedAt = &at
+		}
+		if err := json.Unmarshal([]byte(getString(row, "alerts")), &incident.Alerts); err != nil {
+			logrus.Warnf("Ignoring unreadable alerts of incident %s: %v", incident.ID, err)
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, nil
+}
+
+// resolveIncident marks an incident resolved
+func resolveIncident(incident *models.Incident, by string, now time.Time) {
+	incident.Status = models.IncidentStatusResolved
+	incident.ResolvedBy = by
+	incident.ResolvedAt = &now
+}
+
+// incidentAlertsResolved reports whether every member alert of an incident is resolved
+func incidentAlertsResolved(alerts []models.IncidentAlert) bool {
+	for _, member := range alerts {
+		if member.State != timeplus.AlertStateResolved {
+			return false
+		}
+	}
+	return len(alerts) > 0
+}
+
+// incidentTitle names an incident after the alert that opened it
+func incidentTitle(alert *models.Alert, key string) string {
+	name := alert.RuleName
+	if name == "" {
+		name = alert.RuleID
+	}
+	return fmt.Sprintf("%s (%s)", name, key)
+}
+
+// incidentSummary summarizes the member alerts of an incident, e.g. "3 alerts from 2 rules on
+// 3 entities, 2 active: CPU high (2), Disk full (1)"
+func incidentSummary(alerts []models.IncidentAlert) string {
+	byRule := make(map[string]int)
+	entities := make(map[string]bool)
+	active := 0
+	for _, member := range alerts {
+		name := member.RuleName
+		if name == "" {
+			name = member.RuleID
+		}
+		byRule[name]++
+		entities[member.EntityID] = true
+		if member.State == timeplus.AlertStateActive {
+			active++
+		}
+	}
+
+	names := make([]string, 0, len(byRule))
+	for name := range byRule {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if byRule[names[i]] != byRule[names[j]] {
+			return byRule[names[i]] > byRule[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	counts := make([]string, len(names))
+	for i, name := range names {
+		counts[i] = fmt.Sprintf("%s (%d)", name, byRule[name])
+	}
+
+	return fmt.Sprintf("%s from %s on %s, %d active: %s",
+		plural(len(alerts), "alert"), plural(len(byRule), "rule"), plural(len(entities), "entity"), active, strings.Join(counts, ", "))
+}
+
+// plural formats a count with a noun, e.g. "1 rule" or "2 entities"
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", count, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// copyIncident copies an incident, including its member alerts
+func copyIncident(incident *models.Incident) *models.Incident {
+	copied := *incident
+	copied.Alerts = append([]models.IncidentAlert(nil), incident.Alerts...)
+	return &copied
+}
+
+// EnableIncidents groups the alerts the alert monitor notifies into incidents
+func (s *RuleService) EnableIncidents(ctx context.Context, config IncidentConfig) error {
+	store, err := NewIncidentStore(ctx, s.tpClient, config, s.SeverityLevels)
+	if err != nil {
+		return err
+	}
+	s.incidents = store
+	return nil
+}
+
+// Incidents returns the incident store, nil when incidents aren't enabled
+func (s *RuleService) Incidents() *IncidentStore {
+	return s.incidents
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func newTestIncidentStore(t *testing.T, config IncidentConfig) (*IncidentStore, *MockClient) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.IncidentsStream, mock.Anything, []string{"id"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.IncidentsStream, mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{}
+	store, err := NewIncidentStore(context.Background(), mockClient, config, service.SeverityLevels)
+	require.NoError(t, err)
+	return store, mockClient
+}
+
+func TestNewIncidentStoreValidatesConfig(t *testing.T) {
+	service := &RuleService{}
+	_, err := NewIncidentStore(context.Background(), new(MockClient), IncidentConfig{}, service.SeverityLevels)
+	assert.Error(t, err)
+	_, err = NewIncidentStore(context.Background(), new(MockClient), IncidentConfig{GroupBy: []string{" "}}, service.SeverityLevels)
+	assert.Error(t, err)
+}
+
+func TestIncidentStoreCorrelatesAlerts(t *testing.T) {
+	store, _ := newTestIncidentStore(t, IncidentConfig{GroupBy: []string{"team", "datacenter"}})
+	ctx := context.Background()
+
+	cpu := &models.Alert{ID: "cpu:host1:1", RuleID: "cpu", RuleName: "CPU high", Team: "payments", Severity: "warning", Data: `{"datacenter":"ams"}`}
+	incident, opened, err := store.Correlate(ctx, cpu, "host1")
+	require.NoError(t, err)
+	require.True(t, opened)
+	assert.Equal(t, "team=payments,datacenter=ams", incident.CorrelationKey)
+	assert.Equal(t, "CPU high (team=payments,datacenter=ams)", incident.Title)
+
+	disk := &models.Alert{ID: "disk:host2:1", RuleID: "disk", RuleName: "Disk full", Team: "payments", Severity: "critical", Data: `{"datacenter":"ams"}`}
+	joined, opened, err := store.Correlate(ctx, disk, "host2")
+	require.NoError(t, err)
+	assert.False(t, opened)
+	assert.Equal(t, incident.ID, joined.ID)
+	assert.Equal(t, models.RuleSeverityCritical, joined.Severity, "the most severe member sets the severity")
+	cpu2 := &models.Alert{ID: "cpu:host3:1", RuleID: "cpu", RuleName: "CPU high", Team: "payments", Severity: "warning", Data: `{"datacenter":"ams"}`}
+	joined, _, err = store.Correlate(ctx, cpu2, "host3")
+	require.NoError(t, err)
+	assert.Equal(t, "3 alerts from 2 rules on 3 entities, 3 active: CPU high (2), Disk full (1)", joined.Summary)
+
+	// Correlating the opening alert again, e.g. retrying its notification, still opens the incident
+	again, opened, err := store.Correlate(ctx, cpu, "host1")
+	require.NoError(t, err)
+	assert.True(t, opened)
+	assert.Equal(t, incident.ID, again.ID)
+	assert.Len(t, again.Alerts, 3)
+
+	// Other labels open their own incident, alerts with none of them aren't grouped
+	other, opened, err := store.Correlate(ctx, &models.Alert{ID: "cpu:host9:1", RuleID: "cpu", Team: "search", Data: `{}`}, "host9")
+	require.NoError(t, err)
+	assert.True(t, opened)
+	assert.NotEqual(t, incident.ID, other.ID)
+	none, _, err := store.Correlate(ctx, &models.Alert{ID: "cpu:host8:1", RuleID: "cpu", Data: `{}`}, "host8")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	// The incident resolves with its last alert
+	store.AlertChanged(ctx, "cpu:host1:1", timeplus.AlertStateResolved)
+	store.AlertChanged(ctx, "disk:host2:1", timeplus.AlertStateResolved)
+	current, err := store.Get(ctx, incident.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.IncidentStatusOpen, current.Status)
+	assert.Equal(t, "3 alerts from 2 rules on 3 entities, 1 active: CPU high (2), Disk full (1)", current.Summary)
+
+	store.AlertChanged(ctx, "cpu:host3:1", timeplus.AlertStateResolved)
+	_, err = store.Acknowledge(ctx, incident.ID, "alice")
+	assert.ErrorIs(t, err, ErrIncidentNotFound, "resolved incidents are read from the stream, which the mock leaves empty")
+
+	// New alerts open a new incident once the previous one is resolved
+	next, opened, err := store.Correlate(ctx, cpu, "host1")
+	require.NoError(t, err)
+	assert.True(t, opened)
+	assert.NotEqual(t, incident.ID, next.ID)
+}
+
+func TestIncidentStoreWindow(t *testing.T) {
+	store, _ := newTestIncidentStore(t, IncidentConfig{GroupBy: []string{"team"}, Window: time.Minute})
+	ctx := context.Background()
+
+	first, _, err := store.Correlate(ctx, &models.Alert{ID: "cpu:host1:1", RuleID: "cpu", Team: "payments"}, "host1")
+	require.NoError(t, err)
+	store.open[first.ID].LastAlertAt = time.Now().Add(-2 * time.Minute)
+
+	second, opened, err := store.Correlate(ctx, &models.Alert{ID: "cpu:host2:1", RuleID: "cpu", Team: "payments"}, "host2")
+	require.NoError(t, err)
+	assert.True(t, opened, "alerts after the window open a new incident")
+	assert.NotEqual(t, first.ID, second.ID)
+}
+
+func TestIncidentStoreLifecycle(t *testing.T) {
+	store, mockClient := newTestIncidentStore(t, IncidentConfig{GroupBy: []string{"team"}})
+	ctx := context.Background()
+
+	incident, _, err := store.Correlate(ctx, &models.Alert{ID: "cpu:host1:1", RuleID: "cpu", Team: "payments"}, "host1")
+	require.NoError(t, err)
+
+	acknowledged, err := store.Acknowledge(ctx, incident.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.IncidentStatusAcknowledged, acknowledged.Status)
+	assert.Equal(t, "alice", acknowledged.AcknowledgedBy)
+
+	resolved, err := store.Resolve(ctx, incident.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.IncidentStatusResolved, resolved.Status)
+	require.NotNil(t, resolved.ResolvedAt)
+	assert.NotContains(t, store.open, incident.ID)
+
+	// The resolution is persisted
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	values := lastInsert.Arguments.Get(3).([]interface{})
+	assert.Equal(t, models.IncidentStatusResolved, values[2])
+	assert.Equal(t, "alice", values[12])
+
+	_, err = store.List(ctx, "closed")
+	assert.ErrorIs(t, err, ErrInvalidIncidentQuery)
+	_, err = store.List(ctx, models.IncidentStatusResolved)
+	require.NoError(t, err)
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "status = 'resolved'")
+	}))
+}
+
+func TestAlertMonitorNotifiesIncidentsOnce(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.IncidentsStream, mock.Anything, []string{"id"}).Return(nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.IncidentsStream, mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "id = 'cpu-high'")
+	})).Return([]map[string]interface{}{{"id": "cpu-high", "name": "CPU high", "team": "payments"}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}(nil), nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	require.NoError(t, service.EnableIncidents(context.Background(), IncidentConfig{GroupBy: []string{"team"}, GroupWait: time.Hour}))
+	monitor := NewAlertMonitor(service, mockClient)
+
+	ctx := context.Background()
+	for i, host := range []string{"host1", "host2", "host3"} {
+		require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+			"rule_id": "cpu-high", "entity_id": host, "state": timeplus.AlertStateActive, "firing_seq": uint64(i + 1),
+			"created_at": time.Now(), "_tp_time": time.Now(),
+		}))
+	}
+	assert.Equal(t, int64(2), monitor.Status().Correlated)
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "'"+timeplus.AlertAuditActionCorrelated+"', 'incident'")
+	}))
+
+	// The group wait is cut short on shutdown, sending the incident with every alert that joined it
+	monitor.flushIncidents()
+	require.Equal(t, 0, dispatcher.Drain(ctx))
+	require.Len(t, recorder.events, 1)
+	event := recorder.events[0]
+	assert.Equal(t, "cpu-high:host1:1", event.Alert.ID)
+	require.NotNil(t, event.Incident)
+	assert.Equal(t, event.Incident.ID, event.Alert.IncidentID)
+	assert.Len(t, event.Incident.Alerts, 3)
+	assert.Equal(t, "3 alerts from 1 rule on 3 entities, 3 active: CPU high (3)", event.Incident.Summary)
+
+	// State changes of the alerts update the incident, those of correlated alerts aren't notified
+	require.NoError(t, monitor.handleAckRow(ctx, map[string]interface{}{
+		"rule_id": "cpu-high", "entity_id": "host2", "state": timeplus.AlertStateResolved, "firing_seq": uint64(2),
+		"updated_by": "auto-resolver", "updated_at": time.Now(), "_tp_time": time.Now(),
+	}))
+	incident, err := service.Incidents().Get(ctx, event.Incident.ID)
+	require.NoError(t, err)
+	assert.Equal(t, timeplus.AlertStateResolved, incident.Alerts[1].State)
+	assert.Len(t, recorder.events, 1)
+}
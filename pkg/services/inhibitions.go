@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var (
+	// ErrInhibitionNotFound is returned when no inhibition has the given name
+	ErrInhibitionNotFound = errors.New("inhibition not found")
+	// ErrInhibitionExists is returned when creating an inhibition whose name is taken
+	ErrInhibitionExists = errors.New("inhibition already exists")
+	// ErrInvalidInhibition is returned for inhibitions without a name or with unknown severities
+	ErrInvalidInhibition = errors.New("invalid inhibition")
+)
+
+// InhibitionStore keeps inhibitions in memory, backed by a mutable stream so they survive restarts
+type InhibitionStore struct {
+	tpClient    timeplus.StreamStore
+	severities  func() *models.SeverityLevels
+	mu          sync.RWMutex
+	inhibitions map[string]*models.Inhibition
+}
+
+// NewInhibitionStore ensures the inhibitions stream exists and loads the stored inhibitions.
+// severities returns the levels inhibitions are validated against.
+func NewInhibitionStore(ctx context.Context, tpClient timeplus.StreamStore, severities func() *models.SeverityLevels) (*InhibitionStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.InhibitionsStream,
+		timeplus.GetInhibitionsSchema(), []string{"name"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure inhibitions stream: %w", err)
+	}
+
+	store := &InhibitionStore{tpClient: tpClient, severities: severities, inhibitions: make(map[string]*models.Inhibition)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, description, source_severity, target_severities, equal, created_at, updated_at FROM table(%s) WHERE active = true",
+		timeplus.InhibitionsStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inhibitions: %w", err)
+	}
+	for _, row := range rows {
+		inhibition := &models.Inhibition{
+			Name:           getString(row, "name"),
+			Description:    getString(row, "description"),
+			SourceSeverity: models.RuleSeverity(getString(row, "source_severity")),
+			CreatedAt:      getTime(row, "created_at"),
+			UpdatedAt:      getTime(row, "updated_at"),
+		}
+		if err := json.Unmarshal([]byte(getString(row, "target_severities")), &inhibition.TargetSeverities); err != nil {
+			logrus.Warnf("Ignoring inhibition %s with unreadable target severities: %v", inhibition.Name, err)
+			continue
+		}
+		if equal := getString(row, "equal"); equal != "" {
+			if err := json.Unmarshal([]byte(equal), &inhibition.Equal); err != nil {
+				logrus.Warnf("Ignoring unreadable labels of inhibition %s: %v", inhibition.Name, err)
+			}
+		}
+		store.inhibitions[inhibition.Name] = inhibition
+	}
+
+	logrus.Infof("Loaded %d inhibition(s)", len(store.inhibitions))
+	return store, nil
+}
+
+// List returns all inhibitions sorted by name
+func (st *InhibitionStore) List() []*models.Inhibition {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	inhibitions := make([]*models.Inhibition, 0, len(st.inhibitions))
+	for _, inhibition := range st.inhibitions {
+		copied := *inhibition
+		inhibitions = append(inhibitions, &copied)
+	}
+	sort.Slice(inhibitions, func(i, j int) bool { return inhibitions[i].Name < inhibitions[j].Name })
+	return inhibitions
+}
+
+// Get returns the inhibition with the given name
+func (st *InhibitionStore) Get(name string) (*models.Inhibition, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	inhibition, ok := st.inhibitions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInhibitionNotFound, name)
+	}
+	copied := *inhibition
+	return &copied, nil
+}
+
+// Create stores a new inhibition
+func (st *InhibitionStore) Create(ctx context.Context, inhibition *models.Inhibition) (*models.Inhibition, error) {
+	now := time.Now()
+	stored := &models.Inhibition{
+		Name:             inhibition.Name,
+		Description:      inhibition.Description,
+		SourceSeverity:   inhibition.SourceSeverity,
+		TargetSeverities: inhibition.TargetSeverities,
+		Equal:            inhibition.Equal,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := st.validate(stored); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.inhibitions[stored.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrInhibitionExists, stored.Name)
+	}
+	if err := st.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	st.inhibitions[stored.Name] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Update replaces the severities, labels and description of an existing inhibition
+func (st *InhibitionStore) Update(ctx context.Context, name string, inhibition *models.Inhibition) (*models.Inhibition, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.inhibitions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInhibitionNotFound, name)
+	}
+
+	updated := &models.Inhibition{
+		Name:             name,
+		Description:      inhibition.Description,
+		SourceSeverity:   inhibition.SourceSeverity,
+		TargetSeverities: inhibition.TargetSeverities,
+		Equal:            inhibition.Equal,
+		CreatedAt:        existing.CreatedAt,
+		UpdatedAt:        time.Now(),
+	}
+	if err := st.validate(updated); err != nil {
+		return nil, err
+	}
+	if err := st.persist(ctx, updated, true); err != nil {
+		return nil, err
+	}
+	st.inhibitions[name] = updated
+
+	copied := *updated
+	return &copied, nil
+}
+
+// Delete removes an inhibition
+func (st *InhibitionStore) Delete(ctx context.Context, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.inhibitions[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInhibitionNotFound, name)
+	}
+
+	deleted := *existing
+	deleted.UpdatedAt = time.Now()
+	if err := st.persist(ctx, &deleted, false); err != nil {
+		return err
+	}
+	delete(st.inhibitions, name)
+	return nil
+}
+
+// persist writes an inhibition to the inhibitions stream
+func (st *InhibitionStore) persist(ctx context.Context, inhibition *models.Inhibition, active bool) error {
+	targets, err := json.Marshal(inhibition.TargetSeverities)
+	if err != nil {
+		return fmt.Errorf("failed to encode target severities of inhibition %s: %w", inhibition.Name, err)
+	}
+	equal, err := json.Marshal(inhibition.Equal)
+	if err != nil {
+		return fmt.Errorf("failed to encode labels of inhibition %s: %w", inhibition.Name, err)
+	}
+	columns := []string{"name", "description", "source_severity", "target_severities", "equal", "created_at", "updated_at", "active"}
+	values := []interface{}{inhibition.Name, inhibition.Description, string(inhibition.SourceSeverity), string(targets), string(equal),
+		inhibition.CreatedAt, inhibition.UpdatedAt, active}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.InhibitionsStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist inhibition %s: %w", inhibition.Name, err)
+	}
+	return nil
+}
+
+// validate checks that an inhibition has a name, known severities and only inhibits less severe
+// alerts, so two inhibitions can't silence each other's alerts. The source severity defaults to
+// critical and the targets to every severity below it.
+func (st *InhibitionStore) validate(inhibition *models.Inhibition) error {
+	if inhibition.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidInhibition)
+	}
+
+	levels := st.severities()
+	if inhibition.SourceSeverity == "" {
+		inhibition.SourceSeverity = models.RuleSeverityCritical
+	}
+	if !levels.Valid(inhibition.SourceSeverity) {
+		return fmt.Errorf("%w: unknown sourceSeverity %q", ErrInvalidInhibition, inhibition.SourceSeverity)
+	}
+
+	if len(inhibition.TargetSeverities) == 0 {
+		inhibition.TargetSeverities = nil
+		for _, level := range levels.Levels() {
+			if levels.Compare(level.Name, inhibition.SourceSeverity) < 0 {
+				inhibition.TargetSeverities = append(inhibition.TargetSeverities, level.Name)
+			}
+		}
+		if len(inhibition.TargetSeverities) == 0 {
+			return fmt.Errorf("%w: no severity is below %q", ErrInvalidInhibition, inhibition.SourceSeverity)
+		}
+	}
+	for _, target := range inhibition.TargetSeverities {
+		if !levels.Valid(target) {
+			return fmt.Errorf("%w: unknown target severity %q", ErrInvalidInhibition, target)
+		}
+		if levels.Compare(target, inhibition.SourceSeverity) >= 0 {
+			return fmt.Errorf("%w: target severity %q must be below sourceSeverity %q", ErrInvalidInhibition, target, inhibition.SourceSeverity)
+		}
+	}
+
+	for i, label := range inhibition.Equal {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("%w: equal[%d] is empty", ErrInvalidInhibition, i)
+		}
+	}
+	return nil
+}
+
+// Inhibitions returns the inhibition store, nil when it isn't available
+func (s *RuleService) Inhibitions() *InhibitionStore {
+	return s.inhibitions
+}
+
+// inhibitingAlert returns why an alert for an entity is inhibited: a more severe alert of another
+// rule is active for the same entity with the labels an inhibition compares equal. It returns an
+// empty string when the alert isn't inhibited.
+func (s *RuleService) inhibitingAlert(ctx context.Context, alert *models.Alert, entityID string) (string, error) {
+	if s.inhibitions == nil {
+		return "", nil
+	}
+	var applicable []*models.Inhibition
+	for _, inhibition := range s.inhibitions.List() {
+		for _, target := range inhibition.TargetSeverities {
+			if target == alert.Severity {
+				applicable = append(applicable, inhibition)
+				break
+			}
+		}
+	}
+	if len(applicable) == 0 {
+		return "", nil
+	}
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return "", err
+	}
+	byID := make(map[string]*models.Rule, len(rules))
+	streams := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.ID == alert.RuleID || rule.Shadow {
+			continue
+		}
+		byID[rule.ID] = rule
+		streams[getRuleResources(rule).AlertAcksStream] = true
+	}
+
+	for stream := range streams {
+		query := fmt.Sprintf("SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, severity, firing_seq "+
+			"FROM table(`%s`) WHERE entity_id = '%s' AND state = '%s' AND rule_id != '%s'",
+			stream, strings.ReplaceAll(entityID, "'", "''"), timeplus.AlertStateActive, strings.ReplaceAll(alert.RuleID, "'", "''"))
+		rows, err := s.tpClient.ExecuteQuery(ctx, query)
+		if err != nil {
+			return "", fmt.Errorf("failed to find active alerts of %s: %w", entityID, err)
+		}
+
+		for _, row := range rows {
+			rule, ok := byID[getString(row, "rule_id")]
+			if !ok {
+				continue
+			}
+			source := s.alertFromAckRow(ctx, row, rule)
+			for _, inhibition := range applicable {
+				if source.Severity == inhibition.SourceSeverity && inhibitionLabelsEqual(inhibition.Equal, alert, source) {
+					return fmt.Sprintf("Inhibited by %s alert %s (inhibition %s)", source.Severity, source.ID, inhibition.Name), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// inhibitionLabelsEqual reports whether two alerts have the same value for each label. Labels
+// missing from both alerts are equal.
+func inhibitionLabelsEqual(labels []string, a, b *models.Alert) bool {
+	for _, label := range labels {
+		if inhibitionLabel(a, label) != inhibitionLabel(b, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// inhibitionLabel returns the value of a label of an alert: its rule, owner or team, or a column of
+// the triggering row
+func inhibitionLabel(alert *models.Alert, label string) string {
+	switch label {
+	case models.InhibitionLabelRule:
+		return alert.RuleID
+	case models.InhibitionLabelOwner:
+		return alert.Owner
+	case models.InhibitionLabelTeam:
+		return alert.Team
+	}
+
+	var data map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(alert.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil || data[label] == nil {
+		return ""
+	}
+	return fmt.Sprint(data[label])
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestInhibitionStoreLifecycle(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.InhibitionsStream, mock.Anything, []string{"name"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "host-down", "source_severity": "critical", "target_severities": `["warning"]`, "equal": `["team"]`},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.InhibitionsStream, mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{}
+	store, err := NewInhibitionStore(context.Background(), mockClient, service.SeverityLevels)
+	require.NoError(t, err)
+	require.Len(t, store.List(), 1)
+	assert.Equal(t, []string{"team"}, store.List()[0].Equal)
+
+	_, err = store.Create(context.Background(), &models.Inhibition{Name: "host-down"})
+	assert.ErrorIs(t, err, ErrInhibitionExists)
+
+	for name, inhibition := range map[string]*models.Inhibition{
+		"no name":            {},
+		"unknown source":     {Name: "x", SourceSeverity: "fatal"},
+		"unknown target":     {Name: "x", TargetSeverities: []models.RuleSeverity{"minor"}},
+		"target not below":   {Name: "x", SourceSeverity: "warning", TargetSeverities: []models.RuleSeverity{"critical"}},
+		"nothing below":      {Name: "x", SourceSeverity: "info"},
+		"empty equal labels": {Name: "x", Equal: []string{" "}},
+	} {
+		_, err = store.Create(context.Background(), inhibition)
+		assert.ErrorIs(t, err, ErrInvalidInhibition, name)
+	}
+
+	created, err := store.Create(context.Background(), &models.Inhibition{Name: "rack-down"})
+	require.NoError(t, err)
+	assert.Equal(t, models.RuleSeverityCritical, created.SourceSeverity)
+	assert.Equal(t, []models.RuleSeverity{models.RuleSeverityInfo, models.RuleSeverityWarning}, created.TargetSeverities)
+
+	updated, err := store.Update(context.Background(), "rack-down", &models.Inhibition{SourceSeverity: "warning"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.RuleSeverity{models.RuleSeverityInfo}, updated.TargetSeverities)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	require.NoError(t, store.Delete(context.Background(), "rack-down"))
+	_, err = store.Get("rack-down")
+	assert.ErrorIs(t, err, ErrInhibitionNotFound)
+
+	// The delete is persisted as an inactive row
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, false, lastInsert.Arguments.Get(3).([]interface{})[7])
+}
+
+func TestInhibitingAlert(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "entity_id = 'host1'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "host-down", "entity_id": "host1", "state": timeplus.AlertStateActive, "firing_seq": uint64(3),
+			"severity": "critical", "comment": `{"datacenter":"eu-1"}`},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "entity_id = 'host2'")
+	})).Return([]map[string]interface{}(nil), nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "host-down", "name": "Host down", "severity": "critical", "team": "infra"},
+		{"id": "disk-usage", "name": "Disk usage", "severity": "warning", "team": "infra"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", inhibitions: &InhibitionStore{inhibitions: map[string]*models.Inhibition{
+		"host-down": {
+			Name:             "host-down",
+			SourceSeverity:   models.RuleSeverityCritical,
+			TargetSeverities: []models.RuleSeverity{models.RuleSeverityWarning},
+			Equal:            []string{"team", "datacenter"},
+		},
+	}}}
+	ctx := context.Background()
+
+	warning := &models.Alert{ID: "disk-usage:host1:1", RuleID: "disk-usage", Severity: models.RuleSeverityWarning, Team: "infra",
+		Data: `{"datacenter":"eu-1","entity_id":"host1"}`}
+	reason, err := service.inhibitingAlert(ctx, warning, "host1")
+	require.NoError(t, err)
+	assert.Equal(t, "Inhibited by critical alert host-down:host1:3 (inhibition host-down)", reason)
+
+	// Labels must be equal
+	warning.Data = `{"datacenter":"us-2"}`
+	reason, err = service.inhibitingAlert(ctx, warning, "host1")
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Other entities aren't inhibited
+	warning.Data = `{"datacenter":"eu-1"}`
+	reason, err = service.inhibitingAlert(ctx, warning, "host2")
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Severities that aren't targets aren't checked at all
+	calls := len(mockClient.Calls)
+	reason, err = service.inhibitingAlert(ctx, &models.Alert{RuleID: "disk-usage", Severity: models.RuleSeverityInfo}, "host1")
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Len(t, mockClient.Calls, calls)
+}
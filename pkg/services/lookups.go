@@ -0,0 +1,58 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// validateRuleLookups checks that lookups only reference plain stream and column names, since they are
+// interpolated into the rule view
+func validateRuleLookups(lookups []models.RuleLookup) error {
+	for i, lookup := range lookups {
+		names := map[string]string{"stream": lookup.Stream, "key": lookup.Key}
+		if lookup.LookupKey != "" {
+			names["lookupKey"] = lookup.LookupKey
+		}
+		for field, name := range names {
+			if !identifierPattern.MatchString(name) {
+				return fmt.Errorf("%w: lookups[%d].%s must be a column or stream name, got %q", ErrInvalidRule, i, field, name)
+			}
+		}
+		if len(lookup.Columns) == 0 {
+			return fmt.Errorf("%w: lookups[%d] must select at least one column", ErrInvalidRule, i)
+		}
+		for _, column := range lookup.Columns {
+			if !identifierPattern.MatchString(column) {
+				return fmt.Errorf("%w: lookups[%d].columns must be column names, got %q", ErrInvalidRule, i, column)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleViewQuery returns the query of a rule's plain view. Lookups are LEFT JOINed onto the rule query,
+// so rows without a matching dimension row still alert with empty lookup columns.
+func ruleViewQuery(rule *models.Rule) string {
+	if len(rule.Lookups) == 0 {
+		return rule.Query
+	}
+
+	var columns, joins []string
+	for i, lookup := range rule.Lookups {
+		alias := fmt.Sprintf("lookup_%d", i)
+		lookupKey := lookup.LookupKey
+		if lookupKey == "" {
+			lookupKey = lookup.Key
+		}
+		for _, column := range lookup.Columns {
+			columns = append(columns, fmt.Sprintf("%s.`%s` AS `%s`", alias, column, column))
+		}
+		joins = append(joins, fmt.Sprintf("LEFT JOIN `%s` AS %s ON rule_query.`%s` = %s.`%s`",
+			lookup.Stream, alias, lookup.Key, alias, lookupKey))
+	}
+
+	return fmt.Sprintf("SELECT rule_query.*, %s FROM (%s) AS rule_query %s",
+		strings.Join(columns, ", "), rule.Query, strings.Join(joins, " "))
+}
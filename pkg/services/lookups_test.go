@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestRuleViewQueryWithoutLookups(t *testing.T) {
+	rule := &models.Rule{Query: "SELECT * FROM device_temperatures WHERE temperature > 30"}
+	assert.Equal(t, rule.Query, ruleViewQuery(rule))
+}
+
+func TestRuleViewQueryJoinsLookups(t *testing.T) {
+	rule := &models.Rule{
+		Query: "SELECT * FROM device_temperatures WHERE temperature > 30",
+		Lookups: []models.RuleLookup{
+			{Stream: "devices", Key: "device_id", Columns: []string{"location", "model"}},
+			{Stream: "sites", Key: "site_id", LookupKey: "id", Columns: []string{"site_name"}},
+		},
+	}
+
+	assert.Equal(t, "SELECT rule_query.*, lookup_0.`location` AS `location`, lookup_0.`model` AS `model`, lookup_1.`site_name` AS `site_name` "+
+		"FROM (SELECT * FROM device_temperatures WHERE temperature > 30) AS rule_query "+
+		"LEFT JOIN `devices` AS lookup_0 ON rule_query.`device_id` = lookup_0.`device_id` "+
+		"LEFT JOIN `sites` AS lookup_1 ON rule_query.`site_id` = lookup_1.`id`", ruleViewQuery(rule))
+}
+
+func TestValidateRuleLookups(t *testing.T) {
+	assert.NoError(t, validateRuleLookups(nil))
+	assert.NoError(t, validateRuleLookups([]models.RuleLookup{{Stream: "devices", Key: "device_id", Columns: []string{"location"}}}))
+
+	invalid := []models.RuleLookup{
+		{Stream: "devices; DROP", Key: "device_id", Columns: []string{"location"}},
+		{Stream: "devices", Key: "", Columns: []string{"location"}},
+		{Stream: "devices", Key: "device_id", LookupKey: "id = 1", Columns: []string{"location"}},
+		{Stream: "devices", Key: "device_id"},
+		{Stream: "devices", Key: "device_id", Columns: []string{"location, secret"}},
+	}
+	for _, lookup := range invalid {
+		assert.ErrorIs(t, validateRuleLookups([]models.RuleLookup{lookup}), ErrInvalidRule, "%+v", lookup)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// DefaultObjectPrefix prefixes the names of generated Timeplus objects unless configured otherwise
+const DefaultObjectPrefix = "rule_"
+
+// objectNamePartPattern matches the characters allowed in object name prefixes and suffixes
+var objectNamePartPattern = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+// ObjectNaming is the naming convention of the Timeplus objects generated for rules, which are
+// named Prefix + rule ID + "_" + kind + Suffix, e.g. "rule_<id>_view". Gateways sharing a
+// workspace use different conventions so their objects don't collide.
+type ObjectNaming struct {
+	Prefix string
+	Suffix string
+}
+
+// DefaultObjectNaming returns the naming convention rules used before it was configurable
+func DefaultObjectNaming() ObjectNaming {
+	return ObjectNaming{Prefix: DefaultObjectPrefix}
+}
+
+// Validate checks that names following the convention are valid Timeplus identifiers
+func (n ObjectNaming) Validate() error {
+	if n.Prefix == "" {
+		return fmt.Errorf("object name prefix must not be empty")
+	}
+	if !objectNamePartPattern.MatchString(n.Prefix) {
+		return fmt.Errorf("object name prefix %q may only contain letters, digits and underscores", n.Prefix)
+	}
+	if !objectNamePartPattern.MatchString(n.Suffix) {
+		return fmt.Errorf("object name suffix %q may only contain letters, digits and underscores", n.Suffix)
+	}
+	return nil
+}
+
+// name returns the name of a kind of object generated for a rule
+func (n ObjectNaming) name(ruleID, kind string) string {
+	return n.Prefix + GetFormattedRuleID(ruleID) + "_" + kind + n.Suffix
+}
+
+// RuleObjects returns the names of the objects generated for a rule
+func (n ObjectNaming) RuleObjects(ruleID string) *models.RuleObjects {
+	return &models.RuleObjects{
+		View:                    n.name(ruleID, "view"),
+		MaterializedView:        n.name(ruleID, "mv"),
+		ResolveView:             n.name(ruleID, "resolve_view"),
+		ResolveMaterializedView: n.name(ruleID, "resolve_mv"),
+		ResultStream:            n.name(ruleID, "results"),
+		AlertAcksStream:         n.name(ruleID, "alert_acks"),
+		AlertHistoryStream:      n.name(ruleID, "alert_history"),
+		AlertHistoryMV:          n.name(ruleID, "history_mv"),
+	}
+}
+
+// SetObjectNaming sets the naming convention of the objects generated for new rules. Existing
+// rules keep the names recorded when they were created.
+func (s *RuleService) SetObjectNaming(naming ObjectNaming) error {
+	if err := naming.Validate(); err != nil {
+		return err
+	}
+	s.objectNaming = &naming
+	return nil
+}
+
+// ObjectNaming returns the naming convention of the objects generated for new rules
+func (s *RuleService) ObjectNaming() ObjectNaming {
+	if s.objectNaming != nil {
+		return *s.objectNaming
+	}
+	return DefaultObjectNaming()
+}
+
+// ruleObjects returns the names of the objects generated for a rule: the names recorded on it, or
+// the default names for rules created before names were recorded
+func ruleObjects(rule *models.Rule) *models.RuleObjects {
+	if rule.Objects != nil {
+		return rule.Objects
+	}
+	return DefaultObjectNaming().RuleObjects(rule.ID)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestObjectNamingValidate(t *testing.T) {
+	assert.NoError(t, DefaultObjectNaming().Validate())
+	assert.NoError(t, ObjectNaming{Prefix: "alertgw_", Suffix: "_v2"}.Validate())
+	assert.Error(t, ObjectNaming{}.Validate())
+	assert.Error(t, ObjectNaming{Prefix: "alert-gw_"}.Validate())
+	assert.Error(t, ObjectNaming{Prefix: "rule_", Suffix: "`x"}.Validate())
+
+	s := &RuleService{}
+	assert.Error(t, s.SetObjectNaming(ObjectNaming{Prefix: "bad name"}))
+	assert.Equal(t, DefaultObjectNaming(), s.ObjectNaming())
+}
+
+func TestNewRuleRecordsConfiguredObjectNames(t *testing.T) {
+	s := &RuleService{}
+	require.NoError(t, s.SetObjectNaming(ObjectNaming{Prefix: "alertgw_", Suffix: "_prod"}))
+
+	rule := newRuleFromRequest(&models.CreateRuleRequest{Name: "r", Query: "SELECT 1"}, s.ObjectNaming())
+	require.NotNil(t, rule.Objects)
+	id := GetFormattedRuleID(rule.ID)
+	assert.Equal(t, "alertgw_"+id+"_view_prod", rule.Objects.View)
+	assert.Equal(t, "alertgw_"+id+"_resolve_mv_prod", rule.Objects.ResolveMaterializedView)
+	assert.Equal(t, rule.Objects.View, rule.ViewName)
+	assert.Equal(t, rule.Objects.ResultStream, rule.ResultStream)
+
+	dedicated := true
+	rule.DedicatedAlertAcksStream = &dedicated
+	rule.ResolveQuery = "SELECT 1"
+	res := getRuleResources(rule)
+	assert.Equal(t, "alertgw_"+id+"_mv_prod", res.MaterializedView)
+	assert.Equal(t, "alertgw_"+id+"_resolve_view_prod", res.ResolveView)
+	assert.Equal(t, "alertgw_"+id+"_alert_acks_prod", res.AlertAcksStream)
+	assert.Equal(t, "alertgw_"+id+"_history_mv_prod", res.AlertHistoryMV)
+}
+
+func TestRulesWithoutRecordedObjectsKeepDefaultNames(t *testing.T) {
+	res := getRuleResources(&models.Rule{ID: "a-b", ResolveQuery: "SELECT 1"})
+	assert.Equal(t, "rule_a_b_view", res.PlainView)
+	assert.Equal(t, "rule_a_b_mv", res.MaterializedView)
+	assert.Equal(t, "rule_a_b_resolve_mv", res.ResolveMaterialized)
+	assert.Equal(t, "rule_a_b_alert_history", res.AlertHistoryStream)
+}
+
+func TestMapToRuleParsesObjectNames(t *testing.T) {
+	rule := mapToRule(map[string]interface{}{
+		"id":           "r1",
+		"object_names": `{"view":"gw_r1_view","materializedView":"gw_r1_mv"}`,
+	})
+	require.NotNil(t, rule.Objects)
+	assert.Equal(t, "gw_r1_view", rule.Objects.View)
+	assert.Equal(t, "gw_r1_mv", getRuleResources(rule).MaterializedView)
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var (
+	// ErrScheduleNotFound is returned when no on-call schedule has the given name
+	ErrScheduleNotFound = errors.New("on-call schedule not found")
+	// ErrScheduleExists is returned when creating an on-call schedule whose name is taken
+	ErrScheduleExists = errors.New("on-call schedule already exists")
+	// ErrInvalidSchedule is returned for on-call schedules without a name or users, or with bad overrides
+	ErrInvalidSchedule = errors.New("invalid on-call schedule")
+)
+
+// OnCallStore keeps on-call schedules in memory, backed by a mutable stream so they survive restarts
+type OnCallStore struct {
+	tpClient  timeplus.StreamStore
+	mu        sync.RWMutex
+	schedules map[string]*models.OnCallSchedule
+}
+
+// NewOnCallStore ensures the on-call schedules stream exists and loads the stored schedules
+func NewOnCallStore(ctx context.Context, tpClient timeplus.StreamStore) (*OnCallStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.OnCallSchedulesStream,
+		timeplus.GetOnCallSchedulesSchema(), []string{"name"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure on-call schedules stream: %w", err)
+	}
+
+	store := &OnCallStore{tpClient: tpClient, schedules: make(map[string]*models.OnCallSchedule)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, description, users, rotation_start, shift_hours, overrides, created_at, updated_at FROM table(%s) WHERE active = true",
+		timeplus.OnCallSchedulesStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load on-call schedules: %w", err)
+	}
+	for _, row := range rows {
+		schedule := &models.OnCallSchedule{
+			Name:          getString(row, "name"),
+			Description:   getString(row, "description"),
+			RotationStart: getTime(row, "rotation_start"),
+			ShiftHours:    getInt(row, "shift_hours"),
+			CreatedAt:     getTime(row, "created_at"),
+			UpdatedAt:     getTime(row, "updated_at"),
+		}
+		if err := json.Unmarshal([]byte(getString(row, "users")), &schedule.Users); err != nil {
+			logrus.Warnf("Ignoring on-call schedule %s with unreadable users: %v", schedule.Name, err)
+			continue
+		}
+		if overrides := getString(row, "overrides"); overrides != "" {
+			if err := json.Unmarshal([]byte(overrides), &schedule.Overrides); err != nil {
+				logrus.Warnf("Ignoring unreadable overrides of on-call schedule %s: %v", schedule.Name, err)
+			}
+		}
+		store.schedules[schedule.Name] = schedule
+	}
+
+	logrus.Infof("Loaded %d on-call schedule(s)", len(store.schedules))
+	return store, nil
+}
+
+// List returns all on-call schedules sorted by name
+func (st *OnCallStore) List() []*models.OnCallSchedule {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	schedules := make([]*models.OnCallSchedule, 0, len(st.schedules))
+	for _, schedule := range st.schedules {
+		copied := *schedule
+		schedules = append(schedules, &copied)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules
+}
+
+// Get returns the on-call schedule with the given name
+func (st *OnCallStore) Get(name string) (*models.OnCallSchedule, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	schedule, ok := st.schedules[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+	copied := *schedule
+	return &copied, nil
+}
+
+// ShiftAt returns who is on call in a schedule at a time
+func (st *OnCallStore) ShiftAt(name string, at time.Time) (models.OnCallShift, error) {
+	schedule, err := st.Get(name)
+	if err != nil {
+		return models.OnCallShift{}, err
+	}
+	return schedule.ShiftAt(at), nil
+}
+
+// Create stores a new on-call schedule
+func (st *OnCallStore) Create(ctx context.Context, schedule *models.OnCallSchedule) (*models.OnCallSchedule, error) {
+	now := time.Now()
+	stored := &models.OnCallSchedule{
+		Name:          schedule.Name,
+		Description:   schedule.Description,
+		Users:         schedule.Users,
+		RotationStart: schedule.RotationStart,
+		ShiftHours:    schedule.ShiftHours,
+		Overrides:     schedule.Overrides,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := validateOnCallSchedule(stored); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.schedules[stored.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleExists, stored.Name)
+	}
+	if err := st.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	st.schedules[stored.Name] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Update replaces the rotation, overrides and description of an existing on-call schedule
+func (st *OnCallStore) Update(ctx context.Context, name string, schedule *models.OnCallSchedule) (*models.OnCallSchedule, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.schedules[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+
+	updated := &models.OnCallSchedule{
+		Name:          name,
+		Description:   schedule.Description,
+		Users:         schedule.Users,
+		RotationStart: schedule.RotationStart,
+		ShiftHours:    schedule.ShiftHours,
+		Overrides:     schedule.Overrides,
+		CreatedAt:     existing.CreatedAt,
+		UpdatedAt:     time.Now(),
+	}
+	if err := validateOnCallSchedule(updated); err != nil {
+		return nil, err
+	}
+	if err := st.persist(ctx, updated, true); err != nil {
+		return nil, err
+	}
+	st.schedules[name] = updated
+
+	copied := *updated
+	return &copied, nil
+}
+
+// Delete removes an on-call schedule. Rules still referencing it notify without an on-call user.
+func (st *OnCallStore) Delete(ctx context.Context, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.schedules[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+
+	deleted := *existing
+	deleted.UpdatedAt = time.Now()
+	if err := st.persist(ctx, &deleted, false); err != nil {
+		return err
+	}
+	delete(st.schedules, name)
+	return nil
+}
+
+// persist writes an on-call schedule to the on-call schedules stream
+func (st *OnCallStore) persist(ctx context.Context, schedule *models.OnCallSchedule, active bool) error {
+	users, err := json.Marshal(schedule.Users)
+	if err != nil {
+		return fmt.Errorf("failed to encode users of on-call schedule %s: %w", schedule.Name, err)
+	}
+	overrides, err := json.Marshal(schedule.Overrides)
+	if err != nil {
+		return fmt.Errorf("failed to encode overrides of on-call schedule %s: %w", schedule.Name, err)
+	}
+	columns := []string{"name", "description", "users", "rotation_start", "shift_hours", "overrides", "created_at", "updated_at", "active"}
+	values := []interface{}{schedule.Name, schedule.Description, string(users), schedule.RotationStart, schedule.ShiftHours,
+		string(overrides), schedule.CreatedAt, schedule.UpdatedAt, active}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.OnCallSchedulesStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist on-call schedule %s: %w", schedule.Name, err)
+	}
+	return nil
+}
+
+// validateOnCallSchedule checks that a schedule has a name, users and overrides that end after
+// they start. The shift length defaults to a week and the rotation to starting now.
+func validateOnCallSchedule(schedule *models.OnCallSchedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	if len(schedule.Users) == 0 {
+		return fmt.Errorf("%w: at least one user is required", ErrInvalidSchedule)
+	}
+	for i, user := range schedule.Users {
+		if strings.TrimSpace(user) == "" {
+			return fmt.Errorf("%w: users[%d] is empty", ErrInvalidSchedule, i)
+		}
+	}
+	if schedule.ShiftHours < 0 {
+		return fmt.Errorf("%w: shiftHours must not be negative", ErrInvalidSchedule)
+	}
+	if schedule.ShiftHours == 0 {
+		schedule.ShiftHours = models.DefaultOnCallShiftHours
+	}
+	if schedule.RotationStart.IsZero() {
+		schedule.RotationStart = schedule.CreatedAt
+	}
+
+	for i, override := range schedule.Overrides {
+		if strings.TrimSpace(override.User) == "" {
+			return fmt.Errorf("%w: overrides[%d] has no user", ErrInvalidSchedule, i)
+		}
+		if !override.End.After(override.Start) {
+			return fmt.Errorf("%w: overrides[%d] must end after it starts", ErrInvalidSchedule, i)
+		}
+	}
+	return nil
+}
+
+// OnCallSchedules returns the on-call schedule store, nil when it isn't available
+func (s *RuleService) OnCallSchedules() *OnCallStore {
+	return s.onCall
+}
+
+// validateRuleOnCallSchedule checks that the on-call schedule a rule references exists
+func (s *RuleService) validateRuleOnCallSchedule(rule *models.Rule) error {
+	if rule.OnCallSchedule == "" {
+		return nil
+	}
+	if s.onCall == nil {
+		return fmt.Errorf("%w: on-call schedules are not available", ErrInvalidRule)
+	}
+	if _, err := s.onCall.Get(rule.OnCallSchedule); err != nil {
+		return fmt.Errorf("%w: unknown onCallSchedule %q", ErrInvalidRule, rule.OnCallSchedule)
+	}
+	return nil
+}
+
+// setAlertOnCall sets who is currently on call for the rule of an alert, if the rule has a schedule
+func (s *RuleService) setAlertOnCall(alert *models.Alert, rule *models.Rule) {
+	if rule == nil || rule.OnCallSchedule == "" || s.onCall == nil {
+		return
+	}
+	shift, err := s.onCall.ShiftAt(rule.OnCallSchedule, time.Now())
+	if err != nil {
+		logrus.Warnf("Rule %s references missing on-call schedule %q, notifying without it", rule.ID, rule.OnCallSchedule)
+		return
+	}
+	alert.OnCall = shift.User
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestOnCallStoreLifecycle(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.OnCallSchedulesStream, mock.Anything, []string{"name"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "payments", "users": `["alice","bob"]`, "rotation_start": start, "shift_hours": 24, "overrides": `null`},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.OnCallSchedulesStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewOnCallStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	shift, err := store.ShiftAt("payments", start.Add(25*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", shift.User)
+
+	_, err = store.Create(context.Background(), &models.OnCallSchedule{Name: "payments", Users: []string{"carol"}})
+	assert.ErrorIs(t, err, ErrScheduleExists)
+
+	for name, schedule := range map[string]*models.OnCallSchedule{
+		"no name":               {Users: []string{"alice"}},
+		"no users":              {Name: "x"},
+		"empty user":            {Name: "x", Users: []string{" "}},
+		"negative shift":        {Name: "x", Users: []string{"alice"}, ShiftHours: -1},
+		"override without user": {Name: "x", Users: []string{"alice"}, Overrides: []models.OnCallOverride{{Start: start, End: start.Add(time.Hour)}}},
+		"override ends early":   {Name: "x", Users: []string{"alice"}, Overrides: []models.OnCallOverride{{User: "bob", Start: start, End: start}}},
+	} {
+		_, err = store.Create(context.Background(), schedule)
+		assert.ErrorIs(t, err, ErrInvalidSchedule, name)
+	}
+
+	created, err := store.Create(context.Background(), &models.OnCallSchedule{Name: "infra", Users: []string{"carol"}})
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultOnCallShiftHours, created.ShiftHours)
+	assert.Equal(t, created.CreatedAt, created.RotationStart)
+
+	updated, err := store.Update(context.Background(), "infra", &models.OnCallSchedule{Users: []string{"carol", "dave"}, RotationStart: start})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol", "dave"}, updated.Users)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	require.NoError(t, store.Delete(context.Background(), "infra"))
+	_, err = store.Get("infra")
+	assert.ErrorIs(t, err, ErrScheduleNotFound)
+
+	// The delete is persisted as an inactive row
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, false, lastInsert.Arguments.Get(3).([]interface{})[8])
+}
+
+func TestNotificationEventTargetsOnCall(t *testing.T) {
+	service := &RuleService{onCall: &OnCallStore{schedules: map[string]*models.OnCallSchedule{
+		"payments": {Name: "payments", Users: []string{"alice"}, RotationStart: time.Now().Add(-time.Hour), ShiftHours: 24},
+	}}}
+
+	event := service.notificationEvent("escalated", &models.Alert{ID: "r1:dev1:1"}, &models.Rule{ID: "r1", OnCallSchedule: "payments"})
+	assert.Equal(t, "alice", event.Alert.OnCall)
+
+	// Rules referencing a deleted schedule notify without an on-call user
+	event = service.notificationEvent("fired", &models.Alert{ID: "r2:dev1:1"}, &models.Rule{ID: "r2", OnCallSchedule: "gone"})
+	assert.Empty(t, event.Alert.OnCall)
+
+	assert.ErrorIs(t, service.validateRuleOnCallSchedule(&models.Rule{OnCallSchedule: "gone"}), ErrInvalidRule)
+	assert.NoError(t, service.validateRuleOnCallSchedule(&models.Rule{OnCallSchedule: "payments"}))
+}
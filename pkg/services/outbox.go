@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Outbox entry statuses
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusFailed  = "failed" // Not delivered to every notifier within the allowed attempts
+)
+
+// ErrOutboxEntryNotFound is returned when no outbox entry has the given ID
+var ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+
+// Defaults of the notification outbox
+const (
+	DefaultOutboxMaxAttempts  = 10
+	DefaultOutboxPollInterval = time.Second
+	DefaultOutboxMaxBackoff   = 5 * time.Minute
+	DefaultOutboxRetention    = 7 * 24 * time.Hour
+	outboxBatchSize           = 100
+	outboxPruneInterval       = time.Hour
+)
+
+// OutboxEntry is a notification recorded in the outbox
+type OutboxEntry struct {
+	ID            string       `json:"id"`
+	Event         notify.Event `json:"event"`
+	Status        string       `json:"status"`
+	DeliveredTo   []string     `json:"deliveredTo,omitempty"` // Notifiers that delivered the event
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"lastError,omitempty"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+	NextAttemptAt time.Time    `json:"nextAttemptAt"` // When a pending entry is delivered next
+}
+
+// OutboxStatus counts what the outbox recorded and delivered since the gateway started
+type OutboxStatus struct {
+	Recorded   int64 `json:"recorded"`
+	Duplicates int64 `json:"duplicates"` // Events not recorded again because they already were, e.g. after a restart
+	Sent       int64 `json:"sent"`
+	Failed     int64 `json:"failed"`  // Entries given up on after the allowed attempts
+	Pending    int   `json:"pending"` // Entries waiting for delivery as of the latest poll
+}
+
+// outboxEvent is an event as stored in the outbox, with the translations Event doesn't serialize
+type outboxEvent struct {
+	notify.Event
+	Messages map[string]string `json:"messages,omitempty"`
+}
+
+// NotificationOutbox makes the alert monitor's notifications durable. Each event is recorded in
+// NotificationOutboxStream under an ID derived from the alert, so recording it again, e.g. when its
+// row is read again after a restart, is a no-op. A relay delivers pending entries to the notifiers in
+// the order they were recorded and marks them sent once every notifier delivered them; a notifier
+// that failed is retried, after a backoff that doubles with each attempt, without delivering to the
+// others again. Entries left pending by a restart are delivered after it, and sent entries are
+// deleted once older than the retention. An event is only delivered twice if the gateway stops between a notifier
+// delivering it and the entry being updated; webhooks carry the ID in X-Alert-Gateway-Event-ID so
+// receivers can drop such duplicates.
+type NotificationOutbox struct {
+	tpClient    timeplus.StreamStore
+	dispatcher  *notify.Dispatcher
+	maxAttempts int
+	interval    time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	recorded   atomic.Int64
+	duplicates atomic.Int64
+	sent       atomic.Int64
+	failed     atomic.Int64
+	pending    atomic.Int64
+}
+
+// NewNotificationOutbox creates an outbox delivering through the dispatcher's notifiers. Entries
+// are given up on after maxAttempts, and pending entries are polled for every interval, which is also
+// the first retry's backoff.
+func NewNotificationOutbox(tpClient timeplus.StreamStore, dispatcher *notify.Dispatcher, maxAttempts int, interval time.Duration) *NotificationOutbox {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultOutboxMaxAttempts
+	}
+	if interval <= 0 {
+		interval = DefaultOutboxPollInterval
+	}
+	return &NotificationOutbox{
+		tpClient:    tpClient,
+		dispatcher:  dispatcher,
+		maxAttempts: maxAttempts,
+		interval:    interval,
+		maxBackoff:  DefaultOutboxMaxBackoff,
+		retention:   DefaultOutboxRetention,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// SetMaxBackoff sets the longest wait between deliveries of an entry, DefaultOutboxMaxBackoff when
+// not positive
+func (o *NotificationOutbox) SetMaxBackoff(maxBackoff time.Duration) {
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultOutboxMaxBackoff
+	}
+	o.maxBackoff = maxBackoff
+}
+
+// SetRetention sets how long sent entries are kept; 0 keeps them
+func (o *NotificationOutbox) SetRetention(retention time.Duration) {
+	o.retention = retention
+}
+
+// SetNotificationOutbox makes the alert monitor record its notifications in the outbox rather than
+// queue them in the dispatcher
+func (s *RuleService) SetNotificationOutbox(outbox *NotificationOutbox) {
+	s.outbox = outbox
+}
+
+// NotificationOutbox returns the notification outbox, nil when it isn't enabled
+func (s *RuleService) NotificationOutbox() *NotificationOutbox {
+	return s.outbox
+}
+
+// Start ensures the outbox stream exists and starts relaying pending entries, including those left
+// by the last shutdown
+func (o *NotificationOutbox) Start(ctx context.Context) error {
+	if err := o.tpClient.EnsureMutableStream(ctx, timeplus.NotificationOutboxStream,
+		timeplus.GetNotificationOutboxSchema(), []string{"id"}); err != nil {
+		return fmt.Errorf("failed to ensure notification outbox stream: %w", err)
+	}
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go o.relayLoop(loopCtx)
+	return nil
+}
+
+// Stop stops relaying once the delivery in progress finishes, or ctx is done. Undelivered entries
+// stay pending for the next start.
+func (o *NotificationOutbox) Stop(ctx context.Context) {
+	if o.cancel == nil {
+		return
+	}
+	o.cancel()
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		logrus.Warn("Notification outbox: delivery in progress did not finish before shutdown")
+	}
+}
+
+// Record records an event for delivery. Events already recorded are skipped, and events recorded
+// while the dispatcher is paused are dropped like those dispatched to it.
+func (o *NotificationOutbox) Record(ctx context.Context, event notify.Event) error {
+	if o.dispatcher.Paused() {
+		return o.dispatcher.Dispatch(event)
+	}
+
+	event.ID = OutboxEventID(event)
+	rows, err := o.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT id FROM table(%s) WHERE id = '%s' LIMIT 1",
+		timeplus.NotificationOutboxStream, strings.ReplaceAll(event.ID, "'", "''")))
+	if err != nil {
+		return fmt.Errorf("failed to look up outbox entry %s: %w", event.ID, err)
+	}
+	if len(rows) > 0 {
+		o.duplicates.Add(1)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	entry := &OutboxEntry{ID: event.ID, Event: event, Status: OutboxStatusPending, CreatedAt: now, UpdatedAt: now, NextAttemptAt: now}
+	if err := o.write(ctx, entry, event.Messages); err != nil {
+		return err
+	}
+	o.recorded.Add(1)
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// OutboxEventID returns the ID an event is recorded under: its type and alert ID, and the time of
+// the change for state changes, since an alert can be acknowledged more than once
+func OutboxEventID(event notify.Event) string {
+	id := event.Type
+	if event.Alert != nil {
+		id += ":" + event.Alert.ID
+	}
+	if event.Transition != nil {
+		id += ":" + fmt.Sprint(event.Transition.At.UnixMilli())
+	}
+	return id
+}
+
+// Entries returns the entries with a status, or all of them for an empty status, newest first
+func (o *NotificationOutbox) Entries(ctx context.Context, status string, limit int) ([]*OutboxEntry, error) {
+	where := ""
+	if status != "" {
+		where = fmt.Sprintf(" WHERE status = '%s'", strings.ReplaceAll(status, "'", "''"))
+	}
+	return o.query(ctx, fmt.Sprintf("%s%s ORDER BY created_at DESC LIMIT %d", o.selectEntries(), where, limit))
+}
+
+// Retry makes a failed entry pending again, with its attempts reset. Notifiers that delivered it
+// aren't delivered to again.
+func (o *NotificationOutbox) Retry(ctx context.Context, id string) (*OutboxEntry, error) {
+	entries, err := o.query(ctx, fmt.Sprintf("%s WHERE id = '%s'", o.selectEntries(), strings.ReplaceAll(id, "'", "''")))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+	}
+
+	entry := entries[0]
+	entry.Status = OutboxStatusPending
+	entry.Attempts = 0
+	entry.UpdatedAt = time.Now().UTC()
+	entry.NextAttemptAt = entry.UpdatedAt
+	if err := o.write(ctx, entry, entry.Event.Messages); err != nil {
+		return nil, err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return entry, nil
+}
+
+// Status returns the outbox's counts
+func (o *NotificationOutbox) Status() OutboxStatus {
+	return OutboxStatus{
+		Recorded:   o.recorded.Load(),
+		Duplicates: o.duplicates.Load(),
+		Sent:       o.sent.Load(),
+		Failed:     o.failed.Load(),
+		Pending:    int(o.pending.Load()),
+	}
+}
+
+// outboxStatus returns the outbox's counts, nil when it isn't enabled
+func (s *RuleService) outboxStatus() *OutboxStatus {
+	if s.outbox == nil {
+		return nil
+	}
+	status := s.outbox.Status()
+	return &status
+}
+
+// relayLoop delivers pending entries as they are recorded, and every interval those due for a retry.
+// Sent entries past the retention are pruned every outboxPruneInterval.
+func (o *NotificationOutbox) relayLoop(ctx context.Context) {
+	defer close(o.done)
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		o.relay(ctx)
+		if o.retention > 0 && time.Since(pruned) >= outboxPruneInterval {
+			o.prune(ctx)
+			pruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay delivers a batch of the pending entries due, oldest first
+func (o *NotificationOutbox) relay(ctx context.Context) {
+	entries, err := o.query(ctx, fmt.Sprintf("%s WHERE status = '%s' AND next_attempt_at <= %s ORDER BY created_at LIMIT %d",
+		o.selectEntries(), OutboxStatusPending, timeplus.DateTime64(time.Now()), outboxBatchSize))
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.Warnf("Notification outbox: failed to read pending entries: %v", err)
+		}
+		return
+	}
+	o.pending.Store(int64(len(entries)))
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		o.deliver(ctx, entry)
+		o.pending.Add(-1)
+	}
+}
+
+// deliver delivers an entry to the notifiers that haven't delivered it yet and records the outcome
+func (o *NotificationOutbox) deliver(ctx context.Context, entry *OutboxEntry) {
+	skip := make(map[string]bool, len(entry.DeliveredTo))
+	for _, name := range entry.DeliveredTo {
+		skip[name] = true
+	}
+
+	delivered, err := o.dispatcher.Deliver(ctx, entry.Event, skip)
+	entry.DeliveredTo = append(entry.DeliveredTo, delivered...)
+	entry.Attempts++
+	entry.UpdatedAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		entry.Status = OutboxStatusSent
+		entry.LastError = ""
+		o.sent.Add(1)
+	case entry.Attempts >= o.maxAttempts:
+		entry.Status = OutboxStatusFailed
+		entry.LastError = err.Error()
+		o.failed.Add(1)
+		logrus.Errorf("Notification outbox: giving up on %s after %d attempts: %v", entry.ID, entry.Attempts, err)
+	default:
+		entry.LastError = err.Error()
+		entry.NextAttemptAt = entry.UpdatedAt.Add(o.backoff(entry.Attempts))
+		logrus.Warnf("Notification outbox: delivery of %s failed, retrying at %s: %v",
+			entry.ID, entry.NextAttemptAt.Format(time.RFC3339), err)
+	}
+
+	// Written even when the caller is stopping, so a delivered event isn't delivered again
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := o.write(writeCtx, entry, entry.Event.Messages); err != nil {
+		logrus.Errorf("Notification outbox: %v", err)
+	}
+}
+
+// backoff returns the wait before the next delivery of an entry that failed attempts times: the poll
+// interval, doubled for each further attempt, up to maxBackoff
+func (o *NotificationOutbox) backoff(attempts int) time.Duration {
+	backoff := o.interval
+	for i := 1; i < attempts && backoff < o.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, o.maxBackoff)
+}
+
+// prune deletes the sent entries last updated before the retention
+func (o *NotificationOutbox) prune(ctx context.Context) {
+	err := o.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DELETE FROM %s WHERE status = '%s' AND updated_at < %s",
+		timeplus.NotificationOutboxStream, OutboxStatusSent, timeplus.DateTime64(time.Now().Add(-o.retention))))
+	if err != nil && ctx.Err() == nil {
+		logrus.Warnf("Notification outbox: failed to prune sent entries: %v", err)
+	}
+}
+
+// write upserts an entry
+func (o *NotificationOutbox) write(ctx context.Context, entry *OutboxEntry, messages map[string]string) error {
+	event, err := json.Marshal(outboxEvent{Event: entry.Event, Messages: messages})
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox entry %s: %w", entry.ID, err)
+	}
+	deliveredTo, err := json.Marshal(entry.DeliveredTo)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox entry %s: %w", entry.ID, err)
+	}
+
+	// Events carry alert data and messages rendered from it, so they are encrypted like alert data
+	stored := string(event)
+	if timeplus.PayloadEncryptionEnabled() {
+		if stored, err = timeplus.EncryptPayload(stored); err != nil {
+			return fmt.Errorf("failed to encrypt outbox entry %s: %w", entry.ID, err)
+		}
+	}
+
+	columns := []string{"id", "event", "status", "delivered_to", "attempts", "last_error", "created_at", "updated_at", "next_attempt_at"}
+	values := []interface{}{entry.ID, stored, entry.Status, string(deliveredTo), int32(entry.Attempts),
+		entry.LastError, entry.CreatedAt, entry.UpdatedAt, entry.NextAttemptAt}
+	if err := o.tpClient.InsertIntoStream(ctx, timeplus.NotificationOutboxStream, columns, values); err != nil {
+		return fmt.Errorf("failed to write outbox entry %s: %w", entry.ID, err)
+	}
+	return nil
+}
+
+func (o *NotificationOutbox) selectEntries() string {
+	return fmt.Sprintf("SELECT id, event, status, delivered_to, attempts, last_error, created_at, updated_at, next_attempt_at FROM table(%s)",
+		timeplus.NotificationOutboxStream)
+}
+
+// query reads outbox entries, skipping unreadable ones
+func (o *NotificationOutbox) query(ctx context.Context, query string) ([]*OutboxEntry, error) {
+	rows, err := o.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification outbox: %w", err)
+	}
+
+	entries := make([]*OutboxEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := &OutboxEntry{
+			ID:            getString(row, "id"),
+			Status:        getString(row, "status"),
+			Attempts:      getInt(row, "attempts"),
+			LastError:     getString(row, "last_error"),
+			CreatedAt:     getTime(row, "created_at"),
+			UpdatedAt:     getTime(row, "updated_at"),
+			NextAttemptAt: getTime(row, "next_attempt_at"),
+		}
+		stored := getString(row, "event")
+		raw, err := timeplus.DecryptPayload(stored)
+		if err != nil {
+			logrus.Warnf("Notification outbox: ignoring unreadable entry %s: %v", entry.ID, err)
+			continue
+		}
+		var event outboxEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			logrus.Warnf("Notification outbox: ignoring unreadable entry %s: %v", entry.ID, err)
+			continue
+		}
+		entry.Event = event.Event
+		entry.Event.Messages = event.Messages
+		if timeplus.IsEncryptedPayload(stored) && encryptedDataWithheld(ctx) {
+			withholdEventData(&entry.Event)
+		}
+		if deliveredTo := getString(row, "delivered_to"); deliveredTo != "" {
+			if err := json.Unmarshal([]byte(deliveredTo), &entry.DeliveredTo); err != nil {
+				logrus.Warnf("Notification outbox: unreadable notifiers of entry %s: %v", entry.ID, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// withholdEventData strips the alert data of an event, and the messages rendered from it, for
+// readers not allowed to read encrypted alert data
+func withholdEventData(event *notify.Event) {
+	if event.Alert != nil {
+		alert := *event.Alert
+		alert.Data = `{"_encrypted": true}`
+		event.Alert = &alert
+	}
+	event.Message = ""
+	event.Messages = nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestNotificationOutboxRecordsEventsOnce(t *testing.T) {
+	mockClient := new(MockClient)
+	lookup := mockClient.On("ExecuteQuery", mock.Anything,
+		"SELECT id FROM table(tp_notification_outbox) WHERE id = 'fired:rule1:dev1:1' LIMIT 1")
+	lookup.Return([]map[string]interface{}(nil), nil).Once()
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.NotificationOutboxStream, mock.Anything,
+		mock.MatchedBy(func(values []interface{}) bool {
+			return values[0] == "fired:rule1:dev1:1" && values[2] == OutboxStatusPending
+		})).Return(nil).Once()
+
+	outbox := NewNotificationOutbox(mockClient, notify.NewDispatcher(10, 1), 0, 0)
+	event := notify.NewEvent(notify.EventFired, &models.Alert{ID: "rule1:dev1:1", RuleID: "rule1"})
+	require.NoError(t, outbox.Record(context.Background(), event))
+
+	// Read again after a restart
+	mockClient.On("ExecuteQuery", mock.Anything,
+		"SELECT id FROM table(tp_notification_outbox) WHERE id = 'fired:rule1:dev1:1' LIMIT 1").
+		Return([]map[string]interface{}{{"id": "fired:rule1:dev1:1"}}, nil).Once()
+	require.NoError(t, outbox.Record(context.Background(), event))
+
+	status := outbox.Status()
+	assert.Equal(t, int64(1), status.Recorded)
+	assert.Equal(t, int64(1), status.Duplicates)
+	mockClient.AssertExpectations(t)
+
+	// Each change of an alert's state is an event of its own
+	acked := notify.NewEvent(notify.EventAcknowledged, &models.Alert{ID: "rule1:dev1:1"})
+	acked.Transition = &notify.Transition{To: timeplus.AlertStateAcknowledged, At: time.UnixMilli(1767323045000)}
+	assert.Equal(t, "acknowledged:rule1:dev1:1:1767323045000", OutboxEventID(acked))
+}
+
+// flakyNotifier fails its first deliveries
+type flakyNotifier struct {
+	failures int
+	recordingNotifier
+}
+
+func (f *flakyNotifier) Name() string { return "flaky" }
+
+func (f *flakyNotifier) Notify(ctx context.Context, event notify.Event) error {
+	if f.failures > 0 {
+		f.failures--
+		return assert.AnError
+	}
+	return f.recordingNotifier.Notify(ctx, event)
+}
+
+func TestNotificationOutboxRetriesFailedNotifiersOnly(t *testing.T) {
+	var written []map[string]interface{}
+	mockClient := new(MockClient)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.NotificationOutboxStream, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			row := make(map[string]interface{})
+			for i, column := range args.Get(2).([]string) {
+				row[column] = args.Get(3).([]interface{})[i]
+			}
+			written = append(written, row)
+		}).Return(nil)
+	// Pending entries are read back as the mutable stream keeps them: the latest version only
+	pending := func() {
+		var rows []map[string]interface{}
+		if latest := written[len(written)-1]; latest["status"] == OutboxStatusPending {
+			rows = append(rows, latest)
+		}
+		mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+			return strings.Contains(query, "WHERE status = 'pending'")
+		})).Return(rows, nil).Once()
+	}
+
+	recorder := &recordingNotifier{}
+	flaky := &flakyNotifier{failures: 1}
+	outbox := NewNotificationOutbox(mockClient, notify.NewDispatcher(10, 1, recorder, flaky), 2, 0)
+	ctx := context.Background()
+
+	event := notify.NewEvent(notify.EventFired, &models.Alert{ID: "rule1:dev1:1", RuleID: "rule1"})
+	event.ID = OutboxEventID(event)
+	event.Messages = map[string]string{"de": "Hohe Temperatur"}
+	require.NoError(t, outbox.write(ctx, &OutboxEntry{ID: event.ID, Event: event, Status: OutboxStatusPending}, event.Messages))
+
+	pending()
+	outbox.relay(ctx)
+	assert.Equal(t, OutboxStatusPending, written[1]["status"], "the flaky notifier is retried")
+	assert.Equal(t, `["recording"]`, written[1]["delivered_to"])
+	assert.Equal(t, written[1]["updated_at"].(time.Time).Add(DefaultOutboxPollInterval), written[1]["next_attempt_at"],
+		"the first retry waits a poll interval")
+
+	pending()
+	outbox.relay(ctx)
+	assert.Equal(t, OutboxStatusSent, written[2]["status"])
+	assert.Equal(t, `["recording","flaky"]`, written[2]["delivered_to"])
+	assert.Len(t, recorder.events, 1, "notifiers that delivered aren't delivered to again")
+	require.Len(t, flaky.events, 1)
+	assert.Equal(t, "fired:rule1:dev1:1", flaky.events[0].ID)
+	assert.Equal(t, "Hohe Temperatur", flaky.events[0].Messages["de"], "translations survive the outbox")
+
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(written[2]["event"].(string)), &stored))
+	assert.Equal(t, "fired:rule1:dev1:1", stored["id"])
+	assert.Equal(t, int64(1), outbox.Status().Sent)
+
+	pending()
+	outbox.relay(ctx)
+	assert.Len(t, written, 3, "sent entries aren't delivered again")
+}
+
+func TestNotificationOutboxBacksOffAndPrunesSentEntries(t *testing.T) {
+	mockClient := new(MockClient)
+	outbox := NewNotificationOutbox(mockClient, notify.NewDispatcher(10, 1), 0, 2*time.Second)
+	outbox.SetMaxBackoff(10 * time.Second)
+
+	var backoffs []time.Duration
+	for attempts := 1; attempts <= 5; attempts++ {
+		backoffs = append(backoffs, outbox.backoff(attempts))
+	}
+	assert.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}, backoffs)
+
+	mockClient.On("ExecuteDDL", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "DELETE FROM tp_notification_outbox WHERE status = 'sent' AND updated_at < to_datetime64(")
+	})).Return(nil).Once()
+	outbox.prune(context.Background())
+	mockClient.AssertExpectations(t)
+}
+
+func TestNotificationOutboxEncryptsEvents(t *testing.T) {
+	t.Cleanup(func() { timeplus.SetPayloadKey(nil) })
+	require.NoError(t, timeplus.SetPayloadKey(bytes.Repeat([]byte{4}, 32)))
+
+	var stored string
+	mockClient := new(MockClient)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.NotificationOutboxStream, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(3).([]interface{})[1].(string)
+		}).Return(nil)
+
+	outbox := NewNotificationOutbox(mockClient, notify.NewDispatcher(10, 1), 0, 0)
+	event := notify.NewEvent(notify.EventFired, &models.Alert{ID: "rule1:acc1:1", RuleID: "rule1", Data: `{"email": "jo@example.com"}`})
+	event.ID = OutboxEventID(event)
+	event.Message = "Payment by jo@example.com"
+	require.NoError(t, outbox.write(context.Background(), &OutboxEntry{ID: event.ID, Event: event, Status: OutboxStatusPending}, nil))
+	assert.True(t, timeplus.IsEncryptedPayload(stored))
+	assert.NotContains(t, stored, "jo@example.com")
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": event.ID, "event": stored, "status": OutboxStatusPending},
+	}, nil)
+
+	// Decrypted for delivery and readers allowed to read alert data
+	entries, err := outbox.Entries(context.Background(), "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"email": "jo@example.com"}`, entries[0].Event.Alert.Data)
+	assert.Equal(t, "Payment by jo@example.com", entries[0].Event.Message)
+
+	entries, err = outbox.Entries(WithEncryptedDataWithheld(context.Background()), "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, `{"_encrypted": true}`, entries[0].Event.Alert.Data)
+	assert.Empty(t, entries[0].Event.Message)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ErrGatewayPaused is returned for work that would notify while the gateway is paused
+var ErrGatewayPaused = errors.New("alert gateway is paused")
+
+// gatewayStatePauseKey is the key of the pause state in the gateway state stream
+const gatewayStatePauseKey = "pause"
+
+// PauseState is the gateway-wide emergency switch. While paused no notifications are dispatched,
+// and rules stopped by the pause don't evaluate until the gateway is resumed.
+type PauseState struct {
+	Paused       bool       `json:"paused"`
+	PausedAt     *time.Time `json:"pausedAt,omitempty"`
+	PausedBy     string     `json:"pausedBy,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	StoppedRules []string   `json:"stoppedRules,omitempty"` // Rules stopped by the pause, started again on resume
+}
+
+// loadPauseState ensures the gateway state stream exists and restores the pause state stored in it
+func (s *RuleService) loadPauseState(ctx context.Context) error {
+	if err := s.tpClient.EnsureMutableStream(ctx, timeplus.GatewayStateStream,
+		timeplus.GetGatewayStateSchema(), []string{"key"}); err != nil {
+		return fmt.Errorf("failed to ensure gateway state stream: %w", err)
+	}
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT value FROM table(%s) WHERE key = '%s'",
+		timeplus.GatewayStateStream, gatewayStatePauseKey))
+	if err != nil {
+		return fmt.Errorf("failed to load pause state: %w", err)
+	}
+
+	var state PauseState
+	for _, row := range rows {
+		if err := json.Unmarshal([]byte(getString(row, "value")), &state); err != nil {
+			return fmt.Errorf("failed to parse pause state: %w", err)
+		}
+	}
+
+	s.pauseMutex.Lock()
+	s.pause = state
+	s.pauseMutex.Unlock()
+	if state.Paused {
+		logrus.Warnf("Alert gateway is paused since %v by %s: %s", state.PausedAt, state.PausedBy, state.Reason)
+	}
+	return nil
+}
+
+// PauseState returns whether the gateway is paused, and by whom
+func (s *RuleService) PauseState() PauseState {
+	s.pauseMutex.RLock()
+	defer s.pauseMutex.RUnlock()
+
+	state := s.pause
+	state.StoppedRules = append([]string(nil), s.pause.StoppedRules...)
+	return state
+}
+
+// Paused reports whether the gateway is paused
+func (s *RuleService) Paused() bool {
+	s.pauseMutex.RLock()
+	defer s.pauseMutex.RUnlock()
+	return s.pause.Paused
+}
+
+// pauseReport returns the pause state for reports, nil unless the gateway is paused
+func (s *RuleService) pauseReport() *PauseState {
+	state := s.PauseState()
+	if !state.Paused {
+		return nil
+	}
+	return &state
+}
+
+// Pause stops notification dispatch gateway-wide, and with StopRules also stops every running rule
+// so their materialized views stop evaluating. The pause survives restarts until Resume. Pausing a
+// paused gateway keeps it paused, stopping the rules started since if requested.
+func (s *RuleService) Pause(ctx context.Context, req *models.PauseRequest) (PauseState, error) {
+	done, err := s.trackTask("pause gateway")
+	if err != nil {
+		return PauseState{}, err
+	}
+	defer done()
+
+	state := s.PauseState()
+	if !state.Paused {
+		now := time.Now()
+		state = PauseState{Paused: true, PausedAt: &now, PausedBy: req.By}
+	}
+	if req.Reason != "" {
+		state.Reason = req.Reason
+	}
+
+	// Notifications stop before the rules so nothing is notified while they're being stopped
+	if err := s.setPauseState(ctx, state); err != nil {
+		return s.PauseState(), err
+	}
+	logrus.Warnf("Alert gateway paused by %s: %s", state.PausedBy, state.Reason)
+
+	if !req.StopRules {
+		return state, nil
+	}
+
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return state, fmt.Errorf("failed to list rules to stop: %w", err)
+	}
+	stopped := make(map[string]bool, len(state.StoppedRules))
+	for _, id := range state.StoppedRules {
+		stopped[id] = true
+	}
+	for _, rule := range rules {
+		if !ruleEvaluating(rule) || stopped[rule.ID] {
+			continue
+		}
+		if err := s.StopRule(ctx, rule.ID); err != nil {
+			logrus.Warnf("Failed to stop rule %s while pausing: %v", rule.ID, err)
+			continue
+		}
+		state.StoppedRules = append(state.StoppedRules, rule.ID)
+	}
+
+	if err := s.setPauseState(ctx, state); err != nil {
+		return state, err
+	}
+	logrus.Infof("Stopped %d rule(s) while pausing", len(state.StoppedRules))
+	return state, nil
+}
+
+// Resume restarts notification dispatch and starts the rules the pause stopped again. Rules are
+// started in the background, since each start takes a while.
+func (s *RuleService) Resume(ctx context.Context, req *models.ResumeRequest) (PauseState, error) {
+	state := s.PauseState()
+	if !state.Paused {
+		return state, nil
+	}
+
+	if err := s.setPauseState(ctx, PauseState{}); err != nil {
+		return state, err
+	}
+	logrus.Infof("Alert gateway resumed by %s after pause by %s", req.By, state.PausedBy)
+
+	if len(state.StoppedRules) > 0 {
+		go func(ruleIDs []string) {
+			// The request context ends with the response, so the rules are started in the background
+			startCtx := context.Background()
+			for _, id := range ruleIDs {
+				if err := s.StartRule(startCtx, id); err != nil {
+					logrus.Errorf("Failed to start rule %s stopped by the pause: %v", id, err)
+				}
+			}
+		}(state.StoppedRules)
+	}
+	return PauseState{}, nil
+}
+
+// setPauseState persists a pause state and applies it to the notification pipeline
+func (s *RuleService) setPauseState(ctx context.Context, state PauseState) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode pause state: %w", err)
+	}
+	if err := s.tpClient.InsertIntoStream(ctx, timeplus.GatewayStateStream, []string{"key", "value", "updated_at"},
+		[]interface{}{gatewayStatePauseKey, string(value), time.Now()}); err != nil {
+		return fmt.Errorf("failed to persist pause state: %w", err)
+	}
+
+	s.pauseMutex.Lock()
+	s.pause = state
+	s.pauseMutex.Unlock()
+	if s.dispatcher != nil {
+		s.dispatcher.SetPaused(state.Paused)
+	}
+	return nil
+}
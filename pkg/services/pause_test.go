@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestPauseStopsNotificationsUntilResumed(t *testing.T) {
+	mockClient := new(MockClient)
+	var persisted []PauseState
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.GatewayStateStream, []string{"key", "value", "updated_at"}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			var state PauseState
+			require.NoError(t, json.Unmarshal([]byte(args.Get(3).([]interface{})[1].(string)), &state))
+			persisted = append(persisted, state)
+		}).Return(nil)
+
+	dispatcher := notify.NewDispatcher(10, 1)
+	s := &RuleService{tpClient: mockClient}
+	s.SetNotificationDispatcher(dispatcher)
+
+	state, err := s.Pause(context.Background(), &models.PauseRequest{By: "alice", Reason: "datacenter failover"})
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.Equal(t, "alice", state.PausedBy)
+	assert.True(t, s.Paused())
+	assert.Equal(t, &state, s.pauseReport())
+
+	require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{RuleID: "r1"})))
+	assert.Equal(t, int64(1), dispatcher.Stats().Suppressed)
+	_, err = s.ReplayAlerts(context.Background(), &models.ReplayAlertsRequest{StartTime: time.Now().Add(-time.Hour), EndTime: time.Now()})
+	assert.ErrorIs(t, err, ErrGatewayPaused)
+
+	// Pausing again keeps when and by whom the gateway was paused
+	again, err := s.Pause(context.Background(), &models.PauseRequest{By: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", again.PausedBy)
+	assert.Equal(t, "datacenter failover", again.Reason)
+
+	state, err = s.Resume(context.Background(), &models.ResumeRequest{By: "bob"})
+	require.NoError(t, err)
+	assert.False(t, state.Paused)
+	assert.False(t, dispatcher.Paused())
+	assert.Nil(t, s.pauseReport())
+	require.Len(t, persisted, 3)
+	assert.False(t, persisted[2].Paused)
+}
+
+func TestPauseStateSurvivesRestarts(t *testing.T) {
+	pausedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	stored, err := json.Marshal(PauseState{Paused: true, PausedAt: &pausedAt, PausedBy: "alice", StoppedRules: []string{"r1"}})
+	require.NoError(t, err)
+
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.GatewayStateStream, mock.Anything, []string{"key"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{{"value": string(stored)}}, nil)
+
+	s := &RuleService{tpClient: mockClient}
+	require.NoError(t, s.loadPauseState(context.Background()))
+	assert.True(t, s.Paused())
+	assert.Equal(t, []string{"r1"}, s.PauseState().StoppedRules)
+
+	// A dispatcher set up after the state was loaded starts paused
+	dispatcher := notify.NewDispatcher(10, 1)
+	s.SetNotificationDispatcher(dispatcher)
+	assert.True(t, dispatcher.Paused())
+}
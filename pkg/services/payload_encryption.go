@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// encryptedDataWithheldKey marks contexts of readers not allowed to read encrypted alert data
+type encryptedDataWithheldKey struct{}
+
+// WithEncryptedDataWithheld returns a context whose reads leave encrypted alert data encrypted, for
+// API readers that aren't allowed to read it. Alerts read otherwise are decrypted.
+func WithEncryptedDataWithheld(ctx context.Context) context.Context {
+	return context.WithValue(ctx, encryptedDataWithheldKey{}, true)
+}
+
+// encryptedDataWithheld reports whether ctx is of a reader not allowed to read encrypted alert data
+func encryptedDataWithheld(ctx context.Context) bool {
+	withheld, _ := ctx.Value(encryptedDataWithheldKey{}).(bool)
+	return withheld
+}
+
+// validateRuleEncryption checks that alert data of a rule encrypting it can be encrypted
+func validateRuleEncryption(rule *models.Rule) error {
+	if rule.EncryptData && !timeplus.PayloadEncryptionEnabled() {
+		return fmt.Errorf("%w: encryptData needs an encryption key, set encryption.key or encryption.keyFile", ErrInvalidRule)
+	}
+	return nil
+}
+
+// ruleDataExpression returns the expression capturing the triggering row of a rule's alerts from
+// its plain view's columns: redacted and bounded by the payload limits. Rows of rules with
+// encryptData are encrypted by the PayloadEncryptor once staged, see ruleStagingStream.
+func ruleDataExpression(rule *models.Rule, viewColumns []map[string]interface{}, idColumnName string) (string, error) {
+	if rule.EncryptData && !timeplus.PayloadEncryptionEnabled() {
+		return "", fmt.Errorf("failed to encrypt alert data of rule %s: %w", rule.ID, timeplus.ErrPayloadKeyMissing)
+	}
+	return timeplus.GetTriggeringDataExpression(triggeringDataColumns(viewColumns, idColumnName), ruleRedaction(rule)), nil
+}
+
+// ruleStagingStream returns the stream a rule's materialized view stages its alerts in for the
+// PayloadEncryptor, or an empty string for rules whose alerts are written straight to their acks stream
+func ruleStagingStream(rule *models.Rule) string {
+	if !rule.EncryptData {
+		return ""
+	}
+	return timeplus.AlertPayloadStagingStream
+}
+
+// decryptedPayload returns a captured row readable by the reader of ctx, and whether it was left
+// encrypted because the reader isn't allowed to read it or it couldn't be decrypted
+func decryptedPayload(ctx context.Context, data string) (string, bool) {
+	if !timeplus.IsEncryptedPayload(data) {
+		return data, false
+	}
+	if encryptedDataWithheld(ctx) {
+		return "", true
+	}
+	plain, err := timeplus.DecryptPayload(data)
+	if err != nil {
+		logrus.Warnf("Failed to decrypt alert data: %v", err)
+		return "", true
+	}
+	return plain, false
+}
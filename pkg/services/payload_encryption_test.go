@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestAlertRowDataDecryptsForReaders(t *testing.T) {
+	t.Cleanup(func() { timeplus.SetPayloadKey(nil) })
+	require.NoError(t, timeplus.SetPayloadKey(bytes.Repeat([]byte{7}, 32)))
+
+	encrypted, err := timeplus.EncryptPayload(`{"email": "jo@example.com"}`)
+	require.NoError(t, err)
+	row := map[string]interface{}{"entity_id": "acc1", "state": "active", "comment": encrypted}
+
+	data := alertRowData(context.Background(), row)
+	assert.Equal(t, "jo@example.com", data["email"])
+	assert.NotContains(t, data, "_encrypted")
+
+	data = alertRowData(WithEncryptedDataWithheld(context.Background()), row)
+	assert.Equal(t, map[string]interface{}{"entity_id": "acc1", "state": "active", "_encrypted": true}, data)
+
+	// Without the key the data can't be read by anyone
+	timeplus.SetPayloadKey(nil)
+	data = alertRowData(context.Background(), row)
+	assert.Equal(t, true, data["_encrypted"])
+	assert.NotContains(t, data, "email")
+}
+
+func TestRuleDataExpressionStagesEncryptedRules(t *testing.T) {
+	t.Cleanup(func() { timeplus.SetPayloadKey(nil) })
+	rule := &models.Rule{ID: "rule1", EncryptData: true}
+	columns := []map[string]interface{}{{"name": "account", "type": "string"}, {"name": "email", "type": "string"}}
+
+	assert.ErrorIs(t, validateRuleEncryption(rule), ErrInvalidRule)
+	_, err := ruleDataExpression(rule, columns, "account")
+	assert.ErrorIs(t, err, timeplus.ErrPayloadKeyMissing)
+
+	require.NoError(t, timeplus.SetPayloadKey(bytes.Repeat([]byte{7}, 32)))
+	assert.NoError(t, validateRuleEncryption(rule))
+	expr, err := ruleDataExpression(rule, columns, "account")
+	require.NoError(t, err)
+	assert.Contains(t, expr, `"email": `)
+	assert.Equal(t, timeplus.AlertPayloadStagingStream, ruleStagingStream(rule))
+
+	rule.EncryptData = false
+	assert.Empty(t, ruleStagingStream(rule))
+}
+
+func TestEncryptedRuleSQLHoldsNoKey(t *testing.T) {
+	t.Cleanup(func() { timeplus.SetPayloadKey(nil) })
+	key := bytes.Repeat([]byte{0x5c}, 32)
+	require.NoError(t, timeplus.SetPayloadKey(key))
+
+	mockClient := new(MockClient)
+	var ddl []string
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		ddl = append(ddl, args.String(1))
+	}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.HasPrefix(q, "DESCRIBE")
+	})).Return([]map[string]interface{}{
+		{"name": "account", "type": "string"}, {"name": "email", "type": "string"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	rule := &models.Rule{ID: "rule1", Status: models.RuleStatusRunning, EntityIDColumn: "account", EncryptData: true, ThrottleMinutes: 5}
+	require.NoError(t, service.applyRuleThrottle(context.Background(), rule))
+	require.Len(t, ddl, 2, "the materialized view is dropped and created again")
+	assert.Contains(t, ddl[1], "INTO `"+timeplus.AlertPayloadStagingStream+"`", "alerts are staged for the gateway to encrypt")
+
+	for _, statement := range ddl {
+		assert.NotContains(t, strings.ToLower(statement), hex.EncodeToString(key))
+		assert.NotContains(t, statement, base64.StdEncoding.EncodeToString(key))
+		assert.NotContains(t, statement, string(key))
+	}
+}
+
+func TestPayloadEncryptorMovesStagedAlerts(t *testing.T) {
+	t.Cleanup(func() { timeplus.SetPayloadKey(nil) })
+	require.NoError(t, timeplus.SetPayloadKey(bytes.Repeat([]byte{9}, 32)))
+
+	updatedAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	staged := map[string]interface{}{
+		"rule_id": "rule1", "entity_id": "acc1", "state": timeplus.AlertStateActive,
+		"created_at": updatedAt, "updated_at": updatedAt, "updated_by": "",
+		"comment": `{"email": "jo@example.com"}`, "event_time": updatedAt, "severity": "critical",
+		"firing_seq": uint64(2), "target_stream": "tp_alert_acks_rule1",
+	}
+	match := "rule_id = 'rule1' AND entity_id = 'acc1' AND updated_at = " + timeplus.DateTime64(updatedAt)
+
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.HasPrefix(q, "SELECT count() AS count") && strings.Contains(q, match)
+	})).Return([]map[string]interface{}{{"count": uint64(1)}}, nil).Once()
+	var moved []interface{}
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_alert_acks_rule1", stagedAlertColumns, mock.Anything).Run(func(args mock.Arguments) {
+		moved = args.Get(3).([]interface{})
+	}).Return(nil).Once()
+	mockClient.On("ExecuteDDL", mock.Anything, "DELETE FROM `"+timeplus.AlertPayloadStagingStream+"` WHERE "+match).Return(nil).Once()
+
+	encryptor := NewPayloadEncryptor(mockClient)
+	require.NoError(t, encryptor.move(context.Background(), staged))
+	mockClient.AssertExpectations(t)
+
+	require.Len(t, moved, len(stagedAlertColumns))
+	comment := moved[6].(string)
+	require.True(t, timeplus.IsEncryptedPayload(comment), "the triggering row is encrypted: %s", comment)
+	plain, err := timeplus.DecryptPayload(comment)
+	require.NoError(t, err)
+	assert.Equal(t, `{"email": "jo@example.com"}`, plain)
+	assert.Equal(t, uint64(2), moved[9])
+
+	// An alert moved already, e.g. seen again after a restart, is skipped
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{{"count": uint64(0)}}, nil)
+	require.NoError(t, encryptor.move(context.Background(), staged))
+	mockClient.AssertNumberOfCalls(t, "InsertIntoStream", 1)
+}
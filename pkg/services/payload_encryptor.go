@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// stagedAlertColumns are the columns of a staged alert copied to its alert acks stream
+var stagedAlertColumns = []string{"rule_id", "entity_id", "state", "created_at", "updated_at", "updated_by", "comment", "event_time", "severity", "firing_seq"}
+
+// PayloadEncryptor moves the alerts of rules with encryptData from the payload staging stream to
+// their alert acks streams, encrypting the triggering row on the way. Materialized views can't
+// encrypt without the key, which stays in the gateway, so they stage their alerts as they are and
+// the encryptor deletes each once it's moved. Alerts staged while the gateway is down are moved when
+// it starts again, so capturing alerts doesn't depend on the gateway being up.
+type PayloadEncryptor struct {
+	tpClient timeplus.MonitorStore
+	streamer *timeplus.Streamer
+
+	// Serializes moves between the sweep at start and the stream
+	mu sync.Mutex
+}
+
+// NewPayloadEncryptor creates a payload encryptor reading the staging stream through tpClient
+func NewPayloadEncryptor(tpClient timeplus.MonitorStore) *PayloadEncryptor {
+	return &PayloadEncryptor{
+		tpClient: tpClient,
+		streamer: timeplus.NewStreamer(tpClient),
+	}
+}
+
+// Start creates the staging stream if needed, subscribes to it and moves the alerts staged before
+func (pe *PayloadEncryptor) Start(ctx context.Context) error {
+	if err := pe.tpClient.EnsureMutableStream(ctx, timeplus.AlertPayloadStagingStream,
+		timeplus.GetAlertPayloadStagingSchema(), []string{"rule_id", "entity_id"}); err != nil {
+		return fmt.Errorf("failed to ensure payload staging stream: %w", err)
+	}
+
+	// Subscribe before sweeping so no alert is staged in between unseen
+	err := pe.streamer.Start(timeplus.StreamSpec{
+		Name:    timeplus.AlertPayloadStagingStream,
+		Query:   stagedAlertsQuery("`" + timeplus.AlertPayloadStagingStream + "`"),
+		Handler: pe.move,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", timeplus.AlertPayloadStagingStream, err)
+	}
+
+	rows, err := pe.tpClient.ExecuteQuery(ctx, stagedAlertsQuery("table(`"+timeplus.AlertPayloadStagingStream+"`)"))
+	if err != nil {
+		return fmt.Errorf("failed to read staged alerts: %w", err)
+	}
+	for _, row := range rows {
+		if err := pe.move(ctx, row); err != nil {
+			logrus.Warnf("Payload encryptor: %v", err)
+		}
+	}
+
+	logrus.Infof("Payload encryptor started, moved %d staged alert(s)", len(rows))
+	return nil
+}
+
+// Shutdown stops the subscription. Alerts staged from now on are moved at the next start.
+func (pe *PayloadEncryptor) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := pe.streamer.Shutdown(ctx); err != nil {
+		logrus.Warnf("Payload encryptor: stream did not stop: %v", err)
+	}
+}
+
+// Status returns the state of the subscription to the staging stream
+func (pe *PayloadEncryptor) Status() (timeplus.StreamStatus, bool) {
+	return pe.streamer.StreamStatus(timeplus.AlertPayloadStagingStream)
+}
+
+// stagedAlertsQuery returns the query for the staged alerts of from, a stream or table() of one
+func stagedAlertsQuery(from string) string {
+	return fmt.Sprintf(`SELECT rule_id, entity_id, state, created_at, updated_at, updated_by, comment, event_time, severity, firing_seq, target_stream, _tp_time
+FROM %s`, from)
+}
+
+// move encrypts the triggering row of a staged alert, writes the alert to its acks stream and
+// deletes it from the staging stream. Alerts that were moved already, or staged again since, are
+// skipped, so rows seen twice are harmless.
+func (pe *PayloadEncryptor) move(ctx context.Context, row map[string]interface{}) error {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	ruleID, entityID := getString(row, "rule_id"), getString(row, "entity_id")
+	target := getString(row, "target_stream")
+	if target == "" {
+		return fmt.Errorf("staged alert %s names no acks stream", FormatAlertID(ruleID, entityID, getInt64(row, "firing_seq")))
+	}
+	match := fmt.Sprintf("%s AND updated_at = %s", alertMatch(ruleID, entityID), timeplus.DateTime64(getTime(row, "updated_at")))
+
+	staged, err := pe.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS count FROM table(`%s`) WHERE %s",
+		timeplus.AlertPayloadStagingStream, match))
+	if err != nil {
+		return fmt.Errorf("failed to look up staged alert: %w", err)
+	}
+	if len(staged) == 0 || getInt64(staged[0], "count") == 0 {
+		return nil
+	}
+
+	comment := getString(row, "comment")
+	if !timeplus.IsEncryptedPayload(comment) {
+		if comment, err = timeplus.EncryptPayload(comment); err != nil {
+			return fmt.Errorf("failed to encrypt alert data of rule %s: %w", ruleID, err)
+		}
+	}
+	values := make([]interface{}, len(stagedAlertColumns))
+	for i, column := range stagedAlertColumns {
+		values[i] = row[column]
+		if column == "comment" {
+			values[i] = comment
+		}
+	}
+
+	if err := pe.tpClient.InsertIntoStream(ctx, target, stagedAlertColumns, values); err != nil {
+		return fmt.Errorf("failed to move staged alert to %s: %w", target, err)
+	}
+	if err := pe.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE %s", timeplus.AlertPayloadStagingStream, match)); err != nil {
+		return fmt.Errorf("failed to delete staged alert: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var (
+	// ErrPushDeviceNotFound is returned when no device is registered under a token
+	ErrPushDeviceNotFound = errors.New("push device not found")
+	// ErrInvalidPushDevice is returned for devices without a token or with an unknown platform
+	ErrInvalidPushDevice = errors.New("invalid push device")
+)
+
+// PushDeviceStore keeps the devices registered for push notifications in memory, backed by a
+// mutable stream so they survive restarts
+type PushDeviceStore struct {
+	tpClient timeplus.StreamStore
+	mu       sync.RWMutex
+	devices  map[string]*models.PushDevice
+}
+
+// NewPushDeviceStore ensures the push devices stream exists and loads the registered devices
+func NewPushDeviceStore(ctx context.Context, tpClient timeplus.StreamStore) (*PushDeviceStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.PushDevicesStream,
+		timeplus.GetPushDevicesSchema(), []string{"token"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure push devices stream: %w", err)
+	}
+
+	store := &PushDeviceStore{tpClient: tpClient, devices: make(map[string]*models.PushDevice)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT token, platform, user_name, created_at, updated_at FROM table(%s) WHERE active = true",
+		timeplus.PushDevicesStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load push devices: %w", err)
+	}
+	for _, row := range rows {
+		device := &models.PushDevice{
+			Token:     getString(row, "token"),
+			Platform:  getString(row, "platform"),
+			User:      getString(row, "user_name"),
+			CreatedAt: getTime(row, "created_at"),
+			UpdatedAt: getTime(row, "updated_at"),
+		}
+		store.devices[device.Token] = device
+	}
+
+	logrus.Infof("Loaded %d push device(s)", len(store.devices))
+	return store, nil
+}
+
+// List returns the registered devices, sorted by user and token
+func (st *PushDeviceStore) List() []*models.PushDevice {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	devices := make([]*models.PushDevice, 0, len(st.devices))
+	for _, device := range st.devices {
+		copied := *device
+		devices = append(devices, &copied)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].User != devices[j].User {
+			return devices[i].User < devices[j].User
+		}
+		return devices[i].Token < devices[j].Token
+	})
+	return devices
+}
+
+// Register adds a device, or refreshes the platform and user of a device registered before, as
+// apps do each time they start
+func (st *PushDeviceStore) Register(ctx context.Context, device *models.PushDevice) (*models.PushDevice, error) {
+	now := time.Now()
+	stored := &models.PushDevice{
+		Token:     strings.TrimSpace(device.Token),
+		Platform:  strings.ToLower(strings.TrimSpace(device.Platform)),
+		User:      device.User,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if stored.Token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidPushDevice)
+	}
+	if stored.Platform != models.PushPlatformFCM && stored.Platform != models.PushPlatformAPNs {
+		return nil, fmt.Errorf("%w: platform must be %q or %q", ErrInvalidPushDevice, models.PushPlatformFCM, models.PushPlatformAPNs)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if existing, ok := st.devices[stored.Token]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	if err := st.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	st.devices[stored.Token] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Unregister removes a device, e.g. when the user signs out or its platform rejects the token
+func (st *PushDeviceStore) Unregister(ctx context.Context, token string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.devices[token]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPushDeviceNotFound, token)
+	}
+
+	removed := *existing
+	removed.UpdatedAt = time.Now()
+	if err := st.persist(ctx, &removed, false); err != nil {
+		return err
+	}
+	delete(st.devices, token)
+	return nil
+}
+
+// persist writes a device to the push devices stream
+func (st *PushDeviceStore) persist(ctx context.Context, device *models.PushDevice, active bool) error {
+	columns := []string{"token", "platform", "user_name", "created_at", "updated_at", "active"}
+	values := []interface{}{device.Token, device.Platform, device.User, device.CreatedAt, device.UpdatedAt, active}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.PushDevicesStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist push device: %w", err)
+	}
+	return nil
+}
+
+// EnablePushDevices loads the devices registered for push notifications, so devices can register
+// and the push notifier can reach them
+func (s *RuleService) EnablePushDevices(ctx context.Context) error {
+	store, err := NewPushDeviceStore(ctx, s.tpClient)
+	if err != nil {
+		return err
+	}
+	s.pushDevices = store
+	return nil
+}
+
+// PushDevices returns the push device store, nil when push notifications aren't enabled
+func (s *RuleService) PushDevices() *PushDeviceStore {
+	return s.pushDevices
+}
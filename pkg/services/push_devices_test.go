@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestPushDeviceStoreLifecycle(t *testing.T) {
+	registered := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.PushDevicesStream, mock.Anything, []string{"token"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"token": "ios-1", "platform": "apns", "user_name": "bob", "created_at": registered, "updated_at": registered},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.PushDevicesStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewPushDeviceStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	require.Len(t, store.List(), 1)
+
+	for name, device := range map[string]*models.PushDevice{
+		"no token":         {Platform: models.PushPlatformFCM},
+		"unknown platform": {Token: "x", Platform: "sms"},
+	} {
+		_, err = store.Register(context.Background(), device)
+		assert.ErrorIs(t, err, ErrInvalidPushDevice, name)
+	}
+
+	// Registering again refreshes the device but keeps when it was first registered
+	refreshed, err := store.Register(context.Background(), &models.PushDevice{Token: " ios-1 ", Platform: "APNS", User: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, registered, refreshed.CreatedAt)
+	assert.True(t, refreshed.UpdatedAt.After(registered))
+
+	_, err = store.Register(context.Background(), &models.PushDevice{Token: "web-1", Platform: models.PushPlatformFCM, User: "alice"})
+	require.NoError(t, err)
+	devices := store.List()
+	require.Len(t, devices, 2)
+	assert.Equal(t, "web-1", devices[0].Token)
+
+	require.NoError(t, store.Unregister(context.Background(), "web-1"))
+	assert.ErrorIs(t, store.Unregister(context.Background(), "web-1"), ErrPushDeviceNotFound)
+	assert.Len(t, store.List(), 1)
+
+	// The removal is persisted as an inactive row
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, false, lastInsert.Arguments.Get(3).([]interface{})[5])
+}
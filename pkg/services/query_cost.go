@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Cost levels of a rule's queries, from cheapest
+const (
+	QueryCostLow    = "low"
+	QueryCostMedium = "medium"
+	QueryCostHigh   = "high"
+)
+
+// Codes of the expensive constructs found in a rule's queries
+const (
+	CostCrossJoin         = "cross_join"
+	CostGlobalAggregation = "global_aggregation"
+)
+
+var (
+	crossJoinPattern = regexp.MustCompile(`(?i)\bcross\s+join\b`)
+	// FROM a, b: an implicit cross join, optionally with an alias on the first source
+	commaJoinPattern = regexp.MustCompile("(?i)\\bfrom\\s+`?[A-Za-z_][A-Za-z0-9_.]*`?(\\s+(as\\s+)?[A-Za-z_][A-Za-z0-9_]*)?\\s*,")
+	groupByPattern   = regexp.MustCompile(`(?i)\bgroup\s+by\b`)
+	windowPattern    = regexp.MustCompile(`(?i)\b(tumble|hop|session)\s*\(`)
+	// Aggregate functions whose state grows with every distinct value they see
+	accumulatingPattern = regexp.MustCompile(`(?i)\b(group_array|group_uniq_array|count_distinct|uniq|uniq_exact|top_k)\s*\(`)
+	// A processor line of EXPLAIN PIPELINE, e.g. "AggregatingTransform × 8"
+	pipelineProcessorPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_]*)(?:\s+(?:×|x)\s+([0-9]+))?`)
+)
+
+// QueryCost estimates how expensive a rule's queries are to run as materialized views
+type QueryCost struct {
+	Level    string            `json:"level"` // low, medium or high
+	Factors  []QueryCostFactor `json:"factors,omitempty"`
+	Pipeline *QueryPipeline    `json:"pipeline,omitempty"` // Nil when Timeplus couldn't plan the query
+}
+
+// QueryCostFactor is an expensive construct found in a rule's query
+type QueryCostFactor struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// QueryPipeline summarizes the processors Timeplus plans for a rule's query
+type QueryPipeline struct {
+	Processors   int `json:"processors"`   // Processor instances, counting each parallel copy
+	Joins        int `json:"joins"`        // Join processors
+	Aggregations int `json:"aggregations"` // Aggregating processors
+	Parallelism  int `json:"parallelism"`  // Most copies of any processor
+}
+
+// SetAllowExpensiveQueries sets whether rules with high cost queries, such as cross joins, may be
+// created and started. They're rejected by default.
+func (s *RuleService) SetAllowExpensiveQueries(allow bool) {
+	s.allowExpensiveQueries = allow
+}
+
+// analyzeQueryCost looks for constructs known to be expensive in a rule's own queries. Queries
+// generated for rule types are known to be bounded and aren't analyzed.
+func analyzeQueryCost(rule *models.Rule) *QueryCost {
+	cost := &QueryCost{Level: QueryCostLow}
+	if rule.Spec != nil {
+		return cost
+	}
+
+	queries := map[string]string{"query": rule.Query, "resolveQuery": rule.ResolveQuery}
+	for _, field := range []string{"query", "resolveQuery"} {
+		query := queries[field]
+		if query == "" {
+			continue
+		}
+
+		if crossJoinPattern.MatchString(query) || commaJoinPattern.MatchString(query) {
+			cost.add(QueryCostFactor{
+				Code:    CostCrossJoin,
+				Field:   field,
+				Level:   QueryCostHigh,
+				Message: "cross join pairs every row of one source with every row of the other, use a JOIN with an ON condition instead",
+			})
+		}
+
+		// A snapshot from table() is bounded; a stream aggregated outside a window keeps its state
+		// for as long as the rule runs
+		if windowPattern.MatchString(query) || tableFunctionPattern.MatchString(query) {
+			continue
+		}
+		if groupByPattern.MatchString(query) || accumulatingPattern.MatchString(query) {
+			cost.add(QueryCostFactor{
+				Code:    CostGlobalAggregation,
+				Field:   field,
+				Level:   QueryCostMedium,
+				Message: "aggregation outside a tumble, hop or session window keeps state for every group for as long as the rule runs",
+			})
+		}
+	}
+	return cost
+}
+
+// add records a factor, raising the cost's level to it
+func (c *QueryCost) add(factor QueryCostFactor) {
+	c.Factors = append(c.Factors, factor)
+	if costRank(factor.Level) > costRank(c.Level) {
+		c.Level = factor.Level
+	}
+}
+
+func costRank(level string) int {
+	switch level {
+	case QueryCostHigh:
+		return 2
+	case QueryCostMedium:
+		return 1
+	}
+	return 0
+}
+
+// rejectedByCost reports whether a factor makes its rule invalid rather than just warned about
+func (s *RuleService) rejectedByCost(factor QueryCostFactor) bool {
+	return factor.Level == QueryCostHigh && !s.allowExpensiveQueries
+}
+
+// queryCostProblems returns the expensive constructs a rule is rejected for
+func (s *RuleService) queryCostProblems(rule *models.Rule) []RuleValidationProblem {
+	var problems []RuleValidationProblem
+	for _, factor := range analyzeQueryCost(rule).Factors {
+		if s.rejectedByCost(factor) {
+			problems = append(problems, RuleValidationProblem{Field: factor.Field, Message: factor.Message})
+		}
+	}
+	return problems
+}
+
+// queryCostWarnings returns the expensive constructs of a rule that don't reject it
+func (s *RuleService) queryCostWarnings(rule *models.Rule) []models.RuleWarning {
+	var warnings []models.RuleWarning
+	for _, factor := range analyzeQueryCost(rule).Factors {
+		if !s.rejectedByCost(factor) {
+			warnings = append(warnings, models.RuleWarning{Code: factor.Code, Field: factor.Field, Message: factor.Message})
+		}
+	}
+	return warnings
+}
+
+// explainPipeline has Timeplus plan the pipeline of a rule's query, nil when it can't
+func (s *RuleService) explainPipeline(ctx context.Context, rule *models.Rule) *QueryPipeline {
+	rows, err := s.tpClient.ExecuteQuery(ctx, "EXPLAIN PIPELINE "+ruleViewQuery(rule))
+	if err != nil {
+		logrus.Debugf("Failed to explain the pipeline of rule %s: %v", rule.Name, err)
+		return nil
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, getString(row, "explain"))
+	}
+	return parsePipeline(lines)
+}
+
+// parsePipeline counts the processors of EXPLAIN PIPELINE output. Step names in parentheses and
+// resizes between steps aren't processors.
+func parsePipeline(lines []string) *QueryPipeline {
+	pipeline := &QueryPipeline{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "(") || strings.HasPrefix(line, "Resize") {
+			continue
+		}
+		match := pipelineProcessorPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		copies := 1
+		if match[2] != "" {
+			copies, _ = strconv.Atoi(match[2])
+		}
+
+		pipeline.Processors += copies
+		if copies > pipeline.Parallelism {
+			pipeline.Parallelism = copies
+		}
+		switch name := match[1]; {
+		case strings.Contains(name, "Join"):
+			pipeline.Joins += copies
+		case strings.Contains(name, "Aggregating"):
+			pipeline.Aggregations += copies
+		}
+	}
+	return pipeline
+}
+
+// checkQueryCost fails a rule that is rejected for its cost before its views are created, for rules
+// created before the check or with expensive queries allowed at the time
+func (s *RuleService) checkQueryCost(rule *models.Rule) error {
+	if problems := s.queryCostProblems(rule); len(problems) > 0 {
+		return &RuleValidationError{Problems: problems}
+	}
+	return nil
+}
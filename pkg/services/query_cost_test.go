@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestAnalyzeQueryCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  *models.Rule
+		level string
+		codes []string
+	}{
+		{
+			name:  "filter",
+			rule:  &models.Rule{Query: "SELECT device_id, temperature FROM devices WHERE temperature > 30"},
+			level: QueryCostLow,
+		},
+		{
+			name:  "cross join",
+			rule:  &models.Rule{Query: "SELECT * FROM devices CROSS JOIN sites"},
+			level: QueryCostHigh,
+			codes: []string{CostCrossJoin},
+		},
+		{
+			name:  "comma join",
+			rule:  &models.Rule{Query: "SELECT d.device_id FROM devices AS d, sites WHERE d.site = sites.id"},
+			level: QueryCostHigh,
+			codes: []string{CostCrossJoin},
+		},
+		{
+			name:  "join with condition",
+			rule:  &models.Rule{Query: "SELECT d.device_id FROM devices AS d JOIN sites AS s ON d.site = s.id"},
+			level: QueryCostLow,
+		},
+		{
+			name:  "global aggregation",
+			rule:  &models.Rule{Query: "SELECT device_id, count() AS readings FROM devices GROUP BY device_id HAVING readings > 100"},
+			level: QueryCostMedium,
+			codes: []string{CostGlobalAggregation},
+		},
+		{
+			name:  "accumulating aggregate in the resolve query",
+			rule:  &models.Rule{Query: "SELECT * FROM devices", ResolveQuery: "SELECT uniq(device_id) AS devices FROM devices"},
+			level: QueryCostMedium,
+			codes: []string{CostGlobalAggregation},
+		},
+		{
+			name:  "windowed aggregation",
+			rule:  &models.Rule{Query: "SELECT window_start, device_id, avg(temperature) FROM tumble(devices, 1m) GROUP BY window_start, device_id"},
+			level: QueryCostLow,
+		},
+		{
+			name:  "rule type",
+			rule:  &models.Rule{Spec: &models.RuleSpec{Absence: &models.AbsenceSpec{}}, Query: "SELECT device_id FROM devices GROUP BY device_id"},
+			level: QueryCostLow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost := analyzeQueryCost(tt.rule)
+			assert.Equal(t, tt.level, cost.Level)
+			var codes []string
+			for _, factor := range cost.Factors {
+				codes = append(codes, factor.Code)
+			}
+			assert.Equal(t, tt.codes, codes)
+		})
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	pipeline := parsePipeline([]string{
+		"(Expression)",
+		"ExpressionTransform × 4",
+		"  (Aggregating)",
+		"  Resize 4 → 1",
+		"  AggregatingTransform × 4",
+		"    (Join)",
+		"    JoiningTransform 2 → 1",
+		"      (ReadFromStorage)",
+		"      StreamingSource 0 → 1",
+	})
+	assert.Equal(t, &QueryPipeline{Processors: 10, Joins: 1, Aggregations: 4, Parallelism: 4}, pipeline)
+}
+
+func TestCrossJoinsAreRejectedUnlessAllowed(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{tpClient: mockClient}
+	rule := &models.Rule{Name: "pairs", Query: "SELECT * FROM devices, sites"}
+
+	err := service.validateRuleSources(context.Background(), rule, "")
+	var validationErr *RuleValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Problems, 1)
+	assert.Equal(t, "query", validationErr.Problems[0].Field)
+	assert.Empty(t, service.queryCostWarnings(rule))
+
+	// A rule created before the check is refused when it starts
+	assert.ErrorIs(t, service.checkQueryCost(rule), ErrRuleValidation)
+
+	service.SetAllowExpensiveQueries(true)
+	require.NoError(t, service.validateRuleSources(context.Background(), rule, ""))
+	require.NoError(t, service.checkQueryCost(rule))
+	assert.Equal(t, []string{CostCrossJoin}, lintCodes(service.queryCostWarnings(rule)))
+}
+
+func TestValidateRuleEstimatesCost(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "devices").Return(true, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "EXPLAIN PIPELINE SELECT device_id")
+	})).Return([]map[string]interface{}{
+		{"explain": "(Aggregating)"},
+		{"explain": "AggregatingTransform × 2"},
+		{"explain": "StreamingSource"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient}
+	result, err := service.ValidateRule(context.Background(), &models.CreateRuleRequest{
+		Name:         "chatty devices",
+		Query:        "SELECT device_id, count() AS readings FROM devices GROUP BY device_id",
+		SourceStream: "devices",
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Contains(t, lintCodes(result.Warnings), CostGlobalAggregation)
+	require.NotNil(t, result.Cost)
+	assert.Equal(t, QueryCostMedium, result.Cost.Level)
+	assert.Equal(t, &QueryPipeline{Processors: 3, Aggregations: 2, Parallelism: 2}, result.Cost.Pipeline)
+}
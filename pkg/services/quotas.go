@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// DefaultDegradedThrottleMinutes is the throttle applied to rules exceeding their alert volume quota
+// when none is configured
+const DefaultDegradedThrottleMinutes = 60
+
+// AlertQuotas limit how many alerts rules may fire, so one runaway rule can't flood notifiers and
+// the alert acks stream. Zero limits are disabled.
+type AlertQuotas struct {
+	RulePerMinute   int64 // Alerts per minute of a single rule, unless the rule sets its own
+	TeamPerMinute   int64 // Alerts per minute of all rules of a team
+	ThrottleMinutes int   // Throttle of degraded rules, DefaultDegradedThrottleMinutes when not positive
+}
+
+// SetAlertQuotas sets the alert volume quotas enforced by the quota guard
+func (s *RuleService) SetAlertQuotas(quotas AlertQuotas) {
+	s.alertQuotas = quotas
+}
+
+// StartQuotaGuard periodically degrades rules that fired more alerts in the last minute than their
+// quota allows. Shutdown stops it.
+func (s *RuleService) StartQuotaGuard(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopQuotaGuard = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.enforceAlertQuotas(ctx); err != nil {
+					logrus.Warnf("Alert quota check failed: %v", err)
+				} else if n > 0 {
+					logrus.Warnf("Alert quota check degraded %d rule(s)", n)
+				}
+			}
+		}
+	}()
+}
+
+// validateRuleQuota checks a rule's own alert volume quota
+func validateRuleQuota(rule *models.Rule) error {
+	if rule.MaxAlertsPerMinute < 0 {
+		return fmt.Errorf("%w: maxAlertsPerMinute can't be negative", ErrInvalidRule)
+	}
+	return nil
+}
+
+// enforceAlertQuotas counts the alerts each running rule fired in the last minute and degrades
+// the rules over their quota. A team over its quota has its noisiest rule degraded, one per check
+// until the team is back under it. It returns how many rules were degraded.
+func (s *RuleService) enforceAlertQuotas(ctx context.Context) (int, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	since := time.Now().Add(-time.Minute)
+	counts := make(map[string]int64, len(rules))
+	teamCounts := make(map[string]int64)
+	var counted []*models.Rule
+	for _, rule := range rules {
+		// Shadow rules never notify, so their volume doesn't matter
+		if !ruleEvaluating(rule) || rule.Shadow {
+			continue
+		}
+		rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS alerts FROM table(`%s`) WHERE triggered_at >= %s",
+			getRuleResources(rule).AlertHistoryStream, timeplus.DateTime64(since)))
+		if err != nil {
+			logrus.Warnf("Failed to count recent alerts of rule %s: %v", rule.ID, err)
+			continue
+		}
+		if len(rows) > 0 {
+			counts[rule.ID] = getInt64(rows[0], "alerts")
+		}
+		if rule.Team != "" {
+			teamCounts[rule.Team] += counts[rule.ID]
+		}
+		counted = append(counted, rule)
+	}
+
+	degraded := 0
+	degrade := func(rule *models.Rule, limit int64, reason string) {
+		if err := s.degradeRule(ctx, rule, counts[rule.ID], limit, reason); err != nil {
+			logrus.Errorf("Failed to degrade rule %s: %v", rule.ID, err)
+			return
+		}
+		degraded++
+	}
+
+	// Noisiest rules first, so a team over its quota loses its noisiest rule
+	sort.SliceStable(counted, func(i, j int) bool { return counts[counted[i].ID] > counts[counted[j].ID] })
+	overTeams := make(map[string]bool)
+	for team, count := range teamCounts {
+		if s.alertQuotas.TeamPerMinute > 0 && count > s.alertQuotas.TeamPerMinute {
+			overTeams[team] = true
+		}
+	}
+	for _, rule := range counted {
+		if rule.Degraded != nil || counts[rule.ID] == 0 {
+			continue
+		}
+		limit := s.alertQuotas.RulePerMinute
+		if rule.MaxAlertsPerMinute > 0 {
+			limit = int64(rule.MaxAlertsPerMinute)
+		}
+		if limit > 0 && counts[rule.ID] > limit {
+			degrade(rule, limit, fmt.Sprintf("Fired %d alerts in a minute, over its quota of %d", counts[rule.ID], limit))
+			delete(overTeams, rule.Team)
+			continue
+		}
+		if overTeams[rule.Team] {
+			degrade(rule, s.alertQuotas.TeamPerMinute, fmt.Sprintf("Team %s fired %d alerts in a minute, over its quota of %d",
+				rule.Team, teamCounts[rule.Team], s.alertQuotas.TeamPerMinute))
+			delete(overTeams, rule.Team)
+		}
+	}
+	return degraded, nil
+}
+
+// degradeRule throttles a rule harder, records why and notifies its owner
+func (s *RuleService) degradeRule(ctx context.Context, rule *models.Rule, alerts, limit int64, reason string) error {
+	throttle := s.alertQuotas.ThrottleMinutes
+	if throttle <= 0 {
+		throttle = DefaultDegradedThrottleMinutes
+	}
+
+	rule.Degraded = &models.RuleDegradation{
+		Since:           time.Now(),
+		Reason:          reason,
+		AlertsPerMinute: alerts,
+		Limit:           limit,
+		ThrottleMinutes: rule.ThrottleMinutes,
+	}
+	rebuild := rule.ThrottleMinutes < throttle
+	if rebuild {
+		rule.ThrottleMinutes = throttle
+	}
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return fmt.Errorf("failed to mark rule degraded: %w", err)
+	}
+	logrus.Warnf("Degraded rule %s (%s): %s; throttled to %d minute(s)", rule.Name, rule.ID, reason, rule.ThrottleMinutes)
+
+	// The materialized view applies the throttle, so it's recreated with the new one
+	if rebuild {
+		if err := s.applyRuleThrottle(ctx, rule); err != nil {
+			return fmt.Errorf("failed to apply the degraded throttle: %w", err)
+		}
+	}
+
+	if s.dispatcher != nil {
+		alert := &models.Alert{
+			ID:          rule.ID,
+			RuleID:      rule.ID,
+			TriggeredAt: rule.Degraded.Since,
+			Summary:     fmt.Sprintf("%s; throttled to one alert per entity every %d minute(s)", reason, rule.ThrottleMinutes),
+		}
+		setAlertRuleDetails(alert, rule)
+		if err := s.dispatcher.Dispatch(notify.NewEvent(notify.EventDegraded, alert)); err != nil {
+			logrus.Warnf("Failed to notify the owner of degraded rule %s: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// RecoverRule restores the throttle a degraded rule had before exceeding its alert volume quota
+func (s *RuleService) RecoverRule(ctx context.Context, ruleID string) (*models.Rule, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Degraded == nil {
+		return nil, fmt.Errorf("%w: rule %s is not degraded", ErrInvalidRule, ruleID)
+	}
+
+	rebuild := ruleEvaluating(rule) && rule.ThrottleMinutes != rule.Degraded.ThrottleMinutes
+	rule.ThrottleMinutes = rule.Degraded.ThrottleMinutes
+	rule.Degraded = nil
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return nil, fmt.Errorf("failed to recover rule: %w", err)
+	}
+	if rebuild {
+		if err := s.applyRuleThrottle(ctx, rule); err != nil {
+			return nil, fmt.Errorf("failed to restore the throttle: %w", err)
+		}
+	}
+
+	logrus.Infof("Recovered degraded rule %s (%s), throttle restored to %d minute(s)", rule.Name, rule.ID, rule.ThrottleMinutes)
+	return s.GetRule(ctx, rule.ID)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// quotaMockClient returns the given rules and the alerts each fired in the last minute
+func quotaMockClient(rules []map[string]interface{}, alerts map[string]int64) *MockClient {
+	mockClient := new(MockClient)
+	for ruleID, count := range alerts {
+		stream := "rule_" + ruleID + "_alert_history"
+		mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+			return strings.Contains(query, stream)
+		})).Return([]map[string]interface{}{{"alerts": uint64(count)}}, nil)
+	}
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return(rules, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Return(nil)
+	return mockClient
+}
+
+// persistedRule returns the column values of the last rule written
+func persistedRule(t *testing.T, mockClient *MockClient) map[string]interface{} {
+	for i := len(mockClient.Calls) - 1; i >= 0; i-- {
+		call := mockClient.Calls[i]
+		if call.Method != "InsertIntoStream" {
+			continue
+		}
+		columns, values := call.Arguments.Get(2).([]string), call.Arguments.Get(3).([]interface{})
+		row := make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			row[column] = values[j]
+		}
+		return row
+	}
+	t.Fatal("no rule was persisted")
+	return nil
+}
+
+func TestEnforceAlertQuotasDegradesRunawayRule(t *testing.T) {
+	mockClient := quotaMockClient([]map[string]interface{}{
+		{"id": "r1", "name": "Runaway", "status": "running", "severity": "warning", "throttle_minutes": 120, "owner": "alice"},
+		{"id": "r2", "name": "Allowed", "status": "running", "max_alerts_per_minute": 500},
+		{"id": "r3", "name": "Stopped", "status": "stopped"},
+	}, map[string]int64{"r1": 150, "r2": 150, "r3": 1000})
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	service.SetNotificationDispatcher(dispatcher)
+	service.SetAlertQuotas(AlertQuotas{RulePerMinute: 100})
+
+	degraded, err := service.enforceAlertQuotas(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, degraded)
+
+	row := persistedRule(t, mockClient)
+	assert.Equal(t, "r1", row["id"])
+	// Already throttled harder than degraded rules are, so its views are left alone
+	assert.Equal(t, 120, row["throttle_minutes"])
+	assert.Contains(t, row["degraded"], `"alertsPerMinute":150,"limit":100,"throttleMinutes":120`)
+	mockClient.AssertNotCalled(t, "ExecuteDDL", mock.Anything, mock.Anything)
+
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, notify.EventDegraded, recorder.events[0].Type)
+	assert.Equal(t, "alice", recorder.events[0].Alert.Owner)
+	assert.Contains(t, recorder.events[0].Alert.Summary, "Fired 150 alerts in a minute, over its quota of 100")
+}
+
+func TestEnforceAlertQuotasDegradesNoisiestRuleOfTeam(t *testing.T) {
+	mockClient := quotaMockClient([]map[string]interface{}{
+		{"id": "r1", "status": "running", "team": "infra", "throttle_minutes": 90},
+		{"id": "r2", "status": "running", "team": "infra", "throttle_minutes": 90},
+		{"id": "r3", "status": "running", "team": "payments", "throttle_minutes": 90},
+	}, map[string]int64{"r1": 90, "r2": 150, "r3": 190})
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	service.SetAlertQuotas(AlertQuotas{TeamPerMinute: 200})
+
+	degraded, err := service.enforceAlertQuotas(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, degraded)
+
+	row := persistedRule(t, mockClient)
+	assert.Equal(t, "r2", row["id"])
+	assert.Contains(t, row["degraded"], "Team infra fired 240 alerts in a minute, over its quota of 200")
+}
+
+func TestRecoverRule(t *testing.T) {
+	mockClient := quotaMockClient([]map[string]interface{}{
+		{"id": "r1", "status": "stopped", "throttle_minutes": 60, "degraded": `{"reason":"too loud","throttleMinutes":5}`},
+	}, nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	_, err := service.RecoverRule(context.Background(), "r1")
+	require.NoError(t, err)
+
+	row := persistedRule(t, mockClient)
+	assert.Equal(t, 5, row["throttle_minutes"])
+	assert.Nil(t, row["degraded"])
+
+	mockClient = quotaMockClient([]map[string]interface{}{{"id": "r1", "status": "running"}}, nil)
+	service = &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	_, err = service.RecoverRule(context.Background(), "r1")
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestValidateRuleQuota(t *testing.T) {
+	assert.NoError(t, validateRuleQuota(&models.Rule{MaxAlertsPerMinute: 10}))
+	assert.ErrorIs(t, validateRuleQuota(&models.Rule{MaxAlertsPerMinute: -1}), ErrInvalidRule)
+}
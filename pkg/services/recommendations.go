@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// DefaultRecommendationWindow is the firing history rules are reviewed over
+const DefaultRecommendationWindow = 7 * 24 * time.Hour
+
+// Thresholds of the tuning recommendations
+const (
+	recommendationMinAlerts    = 10               // Alerts needed before outcomes are judged
+	quickResolveWindow         = 2 * time.Minute  // Alerts resolved this fast were likely noise
+	quickResolveRatio          = 0.8              // Share of quickly resolved alerts that makes a rule noisy
+	unacknowledgedRatio        = 0.1              // Share of handled alerts below which a rule is ignored
+	flappingEntityFirings      = 10               // Firings of one entity that make it flap
+	highVolumeFiringsPerDay    = 100.0            // Firings per day that make a rule too loud
+	autoResolverName           = "auto-resolver"  // updated_by of alerts resolved by a resolve query
+	recommendationRefreshAge   = 24 * time.Hour   // Reports older than this are recomputed on request
+	recommendationCheckTimeout = 30 * time.Second // Time allowed to analyze one rule in the background
+)
+
+// Recommendation codes
+const (
+	RecommendationQuickAutoResolve = "quick_auto_resolve"
+	RecommendationUnacknowledged   = "unacknowledged"
+	RecommendationFlapping         = "flapping"
+	RecommendationHighVolume       = "high_volume"
+	RecommendationSilent           = "silent"
+)
+
+// Recommendation is a suggestion to tune a rule, backed by its firing and acknowledgment history
+type Recommendation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RuleRecommendations is a noise report of a rule's firings over a window with tuning suggestions
+type RuleRecommendations struct {
+	RuleID           string           `json:"ruleId"`
+	RuleName         string           `json:"ruleName"`
+	WindowStart      time.Time        `json:"windowStart"`
+	WindowEnd        time.Time        `json:"windowEnd"`
+	Firings          int64            `json:"firings"`  // Every firing recorded in the rule's alert history
+	Entities         int64            `json:"entities"` // Entities that fired
+	TopEntity        string           `json:"topEntity,omitempty"`
+	TopEntityFirings int64            `json:"topEntityFirings"`
+	Alerts           int64            `json:"alerts"`        // Latest alert of each entity that fired in the window
+	AutoResolved     int64            `json:"autoResolved"`  // Resolved by the rule's resolve query
+	QuickResolved    int64            `json:"quickResolved"` // Auto-resolved within two minutes of firing
+	Acknowledged     int64            `json:"acknowledged"`  // Acknowledged by a person or integration
+	Open             int64            `json:"open"`          // Still active
+	AvgAckSeconds    float64          `json:"avgAckSeconds"` // Average time to a manual acknowledgment
+	Recommendations  []Recommendation `json:"recommendations"`
+	GeneratedAt      time.Time        `json:"generatedAt"`
+}
+
+// SetRecommendationWindow sets the firing history rules are reviewed over, DefaultRecommendationWindow when not positive
+func (s *RuleService) SetRecommendationWindow(window time.Duration) {
+	s.recommendationWindow = window
+}
+
+// GetRuleRecommendations returns the latest noise report of a rule, analyzing its history when there
+// is no report yet, the last one is more than a day old, or refresh is set
+func (s *RuleService) GetRuleRecommendations(ctx context.Context, ruleID string, refresh bool) (*RuleRecommendations, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !refresh {
+		s.recommendationsMutex.RLock()
+		report, ok := s.recommendations[ruleID]
+		s.recommendationsMutex.RUnlock()
+		if ok && time.Since(report.GeneratedAt) < recommendationRefreshAge {
+			return report, nil
+		}
+	}
+	return s.analyzeRule(ctx, rule)
+}
+
+// StartRecommendationAnalysis reviews the firing and acknowledgment history of every rule at each
+// interval, weekly by default, and keeps the reports for GetRuleRecommendations
+func (s *RuleService) StartRecommendationAnalysis(interval time.Duration) {
+	if interval <= 0 {
+		interval = 7 * 24 * time.Hour
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopRecommendations = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.analyzeRules(ctx); err != nil {
+					logrus.Warnf("Rule recommendation analysis failed: %v", err)
+				} else {
+					logrus.Infof("Rule recommendation analysis suggested tuning %d rule(s)", n)
+				}
+			}
+		}
+	}()
+}
+
+// analyzeRules analyzes every rule and returns how many have recommendations
+func (s *RuleService) analyzeRules(ctx context.Context) (int, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tuned := 0
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			return tuned, ctx.Err()
+		}
+		ruleCtx, cancel := context.WithTimeout(ctx, recommendationCheckTimeout)
+		report, err := s.analyzeRule(ruleCtx, rule)
+		cancel()
+		if err != nil {
+			logrus.Warnf("Failed to analyze the history of rule %s: %v", rule.ID, err)
+			continue
+		}
+		if len(report.Recommendations) > 0 {
+			tuned++
+		}
+	}
+	return tuned, nil
+}
+
+// analyzeRule builds the noise report of a rule from its alert history and its alerts' latest
+// states, and keeps it as the rule's latest report
+func (s *RuleService) analyzeRule(ctx context.Context, rule *models.Rule) (*RuleRecommendations, error) {
+	window := s.recommendationWindow
+	if window <= 0 {
+		window = DefaultRecommendationWindow
+	}
+	end := time.Now().UTC()
+	start := end.Add(-window)
+
+	report := &RuleRecommendations{
+		RuleID:          rule.ID,
+		RuleName:        rule.Name,
+		WindowStart:     start,
+		WindowEnd:       end,
+		Recommendations: []Recommendation{},
+		GeneratedAt:     end,
+	}
+	res := getRuleResources(rule)
+
+	// Rules that have never been started have no history yet
+	exists, err := s.tpClient.StreamExists(ctx, res.AlertHistoryStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check alert history stream: %w", err)
+	}
+	if exists {
+		if err := s.countRuleFirings(ctx, report, res.AlertHistoryStream, start, end); err != nil {
+			return nil, err
+		}
+		if err := s.countRuleAlertOutcomes(ctx, report, rule, res.AlertsStream, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Recommendations = recommendTuning(rule, report, window)
+
+	s.recommendationsMutex.Lock()
+	if s.recommendations == nil {
+		s.recommendations = make(map[string]*RuleRecommendations)
+	}
+	s.recommendations[rule.ID] = report
+	s.recommendationsMutex.Unlock()
+	return report, nil
+}
+
+// countRuleFirings counts the firings in a rule's alert history and the entity that fired most
+func (s *RuleService) countRuleFirings(ctx context.Context, report *RuleRecommendations, historyStream string, start, end time.Time) error {
+	where := fmt.Sprintf("triggered_at >= %s AND triggered_at < %s", timeplus.DateTime64(start), timeplus.DateTime64(end))
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT count() AS firings, count_distinct(entity_id) AS entities FROM table(`%s`) WHERE %s", historyStream, where))
+	if err != nil {
+		return fmt.Errorf("failed to count rule firings: %w", err)
+	}
+	if len(rows) > 0 {
+		report.Firings = getInt64(rows[0], "firings")
+		report.Entities = getInt64(rows[0], "entities")
+	}
+	if report.Firings == 0 {
+		return nil
+	}
+
+	rows, err = s.tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT entity_id, count() AS firings FROM table(`%s`) WHERE %s GROUP BY entity_id ORDER BY firings DESC LIMIT 1", historyStream, where))
+	if err != nil {
+		return fmt.Errorf("failed to find the most firing entity: %w", err)
+	}
+	if len(rows) > 0 {
+		report.TopEntity = getString(rows[0], "entity_id")
+		report.TopEntityFirings = getInt64(rows[0], "firings")
+	}
+	return nil
+}
+
+// countRuleAlertOutcomes counts how the latest alert of each entity that fired in the window ended:
+// resolved by the rule's resolve query, acknowledged, or still open
+func (s *RuleService) countRuleAlertOutcomes(ctx context.Context, report *RuleRecommendations, rule *models.Rule, alertsStream string, start, end time.Time) error {
+	acknowledged := fmt.Sprintf("state = '%s'", timeplus.AlertStateAcknowledged)
+	autoResolved := fmt.Sprintf("coalesce(updated_by, '') = '%s'", autoResolverName)
+	handledIn := "date_diff('second', created_at, updated_at)"
+
+	query := fmt.Sprintf(`SELECT count() AS alerts,
+		count_if(%[1]s AND %[2]s) AS auto_resolved,
+		count_if(%[1]s AND %[2]s AND %[3]s <= %[4]d) AS quick_resolved,
+		count_if(%[1]s AND NOT %[2]s) AS acknowledged,
+		count_if(state = '%[5]s') AS open,
+		avg_if(%[3]s, %[1]s AND NOT %[2]s) AS avg_ack_seconds
+	FROM table(`+"`%[6]s`"+`)
+	WHERE rule_id = '%[7]s' AND created_at >= %[8]s AND created_at < %[9]s`,
+		acknowledged, autoResolved, handledIn, int(quickResolveWindow.Seconds()), timeplus.AlertStateActive,
+		alertsStream, strings.ReplaceAll(rule.ID, "'", "''"), timeplus.DateTime64(start), timeplus.DateTime64(end))
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to count alert outcomes: %w", err)
+	}
+	if len(rows) > 0 {
+		report.Alerts = getInt64(rows[0], "alerts")
+		report.AutoResolved = getInt64(rows[0], "auto_resolved")
+		report.QuickResolved = getInt64(rows[0], "quick_resolved")
+		report.Acknowledged = getInt64(rows[0], "acknowledged")
+		report.Open = getInt64(rows[0], "open")
+		if report.Acknowledged > 0 {
+			report.AvgAckSeconds = getFloat64(rows[0], "avg_ack_seconds")
+		}
+	}
+	return nil
+}
+
+// recommendTuning derives tuning suggestions from a rule's noise report
+func recommendTuning(rule *models.Rule, report *RuleRecommendations, window time.Duration) []Recommendation {
+	recommendations := []Recommendation{}
+	days := window.Hours() / 24
+
+	if report.Alerts >= recommendationMinAlerts {
+		if quick := float64(report.QuickResolved) / float64(report.Alerts); quick >= quickResolveRatio {
+			recommendations = append(recommendations, Recommendation{
+				Code: RecommendationQuickAutoResolve,
+				Message: fmt.Sprintf("%.0f%% of alerts auto-resolve within %g minutes — consider raising the threshold or adding a duration condition",
+					quick*100, quickResolveWindow.Minutes()),
+			})
+		}
+		if handled := float64(report.Acknowledged+report.AutoResolved) / float64(report.Alerts); handled < unacknowledgedRatio {
+			recommendations = append(recommendations, Recommendation{
+				Code: RecommendationUnacknowledged,
+				Message: fmt.Sprintf("%.0f%% of %d alerts were acknowledged or resolved — consider lowering the severity, adding a resolve query or running the rule in shadow mode",
+					handled*100, report.Alerts),
+			})
+		}
+	}
+
+	if report.TopEntityFirings >= flappingEntityFirings {
+		recommendations = append(recommendations, Recommendation{
+			Code: RecommendationFlapping,
+			Message: fmt.Sprintf("%s fired %d times in %g days — consider raising throttleMinutes (currently %d) or adding a resolve query",
+				report.TopEntity, report.TopEntityFirings, days, rule.ThrottleMinutes),
+		})
+	}
+
+	if perDay := float64(report.Firings) / days; perDay >= highVolumeFiringsPerDay {
+		recommendations = append(recommendations, Recommendation{
+			Code: RecommendationHighVolume,
+			Message: fmt.Sprintf("The rule fires %.0f times a day across %d entities — consider raising the threshold or aggregating over a window",
+				perDay, report.Entities),
+		})
+	}
+
+	// Rules created during the window haven't had the chance to fire for all of it
+	if report.Firings == 0 && ruleEvaluating(rule) && rule.CreatedAt.Before(report.WindowStart) {
+		recommendations = append(recommendations, Recommendation{
+			Code:    RecommendationSilent,
+			Message: fmt.Sprintf("The rule did not fire in %g days — check that its query still matches the source data", days),
+		})
+	}
+
+	return recommendations
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestRecommendTuning(t *testing.T) {
+	rule := &models.Rule{ID: "rule1", Status: models.RuleStatusRunning, ThrottleMinutes: 5}
+	report := &RuleRecommendations{
+		Firings:          1400,
+		Entities:         3,
+		TopEntity:        "dev1",
+		TopEntityFirings: 900,
+		Alerts:           40,
+		AutoResolved:     39,
+		QuickResolved:    38,
+	}
+
+	codes := func(recommendations []Recommendation) []string {
+		var result []string
+		for _, r := range recommendations {
+			result = append(result, r.Code)
+		}
+		return result
+	}
+
+	recommendations := recommendTuning(rule, report, DefaultRecommendationWindow)
+	assert.Equal(t, []string{RecommendationQuickAutoResolve, RecommendationFlapping, RecommendationHighVolume}, codes(recommendations))
+	assert.Equal(t, "95% of alerts auto-resolve within 2 minutes — consider raising the threshold or adding a duration condition", recommendations[0].Message)
+	assert.Contains(t, recommendations[1].Message, "dev1 fired 900 times in 7 days")
+	assert.Contains(t, recommendations[1].Message, "(currently 5)")
+
+	// Alerts nobody handles
+	ignored := &RuleRecommendations{Firings: 20, Alerts: 20, Acknowledged: 1, Open: 19}
+	assert.Equal(t, []string{RecommendationUnacknowledged}, codes(recommendTuning(rule, ignored, DefaultRecommendationWindow)))
+
+	// Too few alerts to judge
+	assert.Empty(t, recommendTuning(rule, &RuleRecommendations{Firings: 5, Alerts: 5, Open: 5}, DefaultRecommendationWindow))
+
+	// Silent only once the rule has been around for the whole window
+	silent := &RuleRecommendations{WindowStart: time.Now().Add(-DefaultRecommendationWindow)}
+	rule.CreatedAt = time.Now().Add(-30 * 24 * time.Hour)
+	assert.Equal(t, []string{RecommendationSilent}, codes(recommendTuning(rule, silent, DefaultRecommendationWindow)))
+	rule.CreatedAt = time.Now().Add(-time.Hour)
+	assert.Empty(t, recommendTuning(rule, silent, DefaultRecommendationWindow))
+}
+
+func TestGetRuleRecommendations(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "rule_rule1_alert_history").Return(true, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "count_distinct(entity_id)")
+	})).Return([]map[string]interface{}{{"firings": uint64(30), "entities": uint64(2)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "GROUP BY entity_id")
+	})).Return([]map[string]interface{}{{"entity_id": "dev1", "firings": uint64(25)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "quick_resolved") && strings.Contains(query, "rule_id = 'rule1'") &&
+			strings.Contains(query, "coalesce(updated_by, '') = 'auto-resolver'")
+	})).Return([]map[string]interface{}{
+		{"alerts": uint64(2), "auto_resolved": uint64(1), "quick_resolved": uint64(1), "acknowledged": uint64(1), "open": uint64(0), "avg_ack_seconds": 90.0},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "running", "throttle_minutes": int32(1)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	report, err := service.GetRuleRecommendations(context.Background(), "rule1", false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), report.Firings)
+	assert.Equal(t, "dev1", report.TopEntity)
+	assert.Equal(t, int64(25), report.TopEntityFirings)
+	assert.Equal(t, int64(1), report.AutoResolved)
+	assert.Equal(t, 90.0, report.AvgAckSeconds)
+	require.Len(t, report.Recommendations, 1)
+	assert.Equal(t, RecommendationFlapping, report.Recommendations[0].Code)
+
+	// The report is kept until it's refreshed
+	again, err := service.GetRuleRecommendations(context.Background(), "rule1", false)
+	require.NoError(t, err)
+	assert.Same(t, report, again)
+	mockClient.AssertNumberOfCalls(t, "StreamExists", 1)
+
+	refreshed, err := service.GetRuleRecommendations(context.Background(), "rule1", true)
+	require.NoError(t, err)
+	assert.NotSame(t, report, refreshed)
+	mockClient.AssertNumberOfCalls(t, "StreamExists", 2)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Reconciliation actions
+const (
+	ReconcileActionNone      = "none"      // Everything the rule needs exists
+	ReconcileActionRecreated = "recreated" // Missing resources were recreated
+	ReconcileActionFailed    = "failed"    // Resources could not be recreated, rule marked failed
+)
+
+// ReconcileResult describes what startup reconciliation did for a single rule
+type ReconcileResult struct {
+	RuleID  string   `json:"ruleId"`
+	Action  string   `json:"action"`
+	Missing []string `json:"missing,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// timeplusInventory is a snapshot of the streams and materialized views that exist in Timeplus
+type timeplusInventory struct {
+	streams           map[string]bool // SHOW STREAMS lists streams and views alike
+	materializedViews map[string]bool
+}
+
+// loadTimeplusInventory fetches the stream and materialized view lists once for all rules
+func (s *RuleService) loadTimeplusInventory(ctx context.Context) (*timeplusInventory, error) {
+	streams, err := s.tpClient.ListStreams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+
+	mvs, err := s.tpClient.ListMaterializedViews(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list materialized views: %w", err)
+	}
+
+	inv := &timeplusInventory{
+		streams:           make(map[string]bool, len(streams)),
+		materializedViews: make(map[string]bool, len(mvs)),
+	}
+	for _, name := range streams {
+		inv.streams[name] = true
+	}
+	for _, name := range mvs {
+		inv.materializedViews[name] = true
+	}
+	return inv, nil
+}
+
+// missingResources returns the resources a running rule needs that are not present in Timeplus:
+// its views, the alert acks stream its materialized views write into and its result stream. Resolve
+// views of a rule degraded by their failure are known to be missing and aren't reported.
+func (inv *timeplusInventory) missingResources(rule *models.Rule) []string {
+	res := getRuleResources(rule)
+	var missing []string
+
+	if !inv.streams[res.PlainView] {
+		missing = append(missing, res.PlainView)
+	}
+	if !inv.materializedViews[res.MaterializedView] {
+		missing = append(missing, res.MaterializedView)
+	}
+	if res.ResolveView != "" && !slices.Contains(rule.FailedComponents, models.RuleComponentResolve) {
+		if !inv.streams[res.ResolveView] {
+			missing = append(missing, res.ResolveView)
+		}
+		if !inv.materializedViews[res.ResolveMaterialized] {
+			missing = append(missing, res.ResolveMaterialized)
+		}
+	}
+	if !inv.streams[res.AlertsStream] {
+		missing = append(missing, res.AlertsStream)
+	}
+	// Shadow rules write into their result stream, which was checked as their alerts stream
+	if res.ResultStream != "" && res.ResultStream != res.AlertsStream && !inv.streams[res.ResultStream] {
+		missing = append(missing, res.ResultStream)
+	}
+
+	return missing
+}
+
+// ReconcileRules compares every rule marked running with the views and streams that actually exist
+// in Timeplus. Rules whose resources are intact are left alone; rules with missing resources are
+// restarted, which recreates their views, and are marked failed with a clear error if that fails.
+func (s *RuleService) ReconcileRules(ctx context.Context) ([]ReconcileResult, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.loadTimeplusInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReconcileResult, 0)
+	for _, rule := range rules {
+		if !ruleEvaluating(rule) {
+			continue
+		}
+		results = append(results, s.reconcileRule(ctx, rule, inv))
+	}
+
+	return results, nil
+}
+
+// reconcileRule brings a single running rule back in line with Timeplus state
+func (s *RuleService) reconcileRule(ctx context.Context, rule *models.Rule, inv *timeplusInventory) ReconcileResult {
+	result := ReconcileResult{RuleID: rule.ID, Action: ReconcileActionNone}
+
+	result.Missing = inv.missingResources(rule)
+	if len(result.Missing) == 0 {
+		logrus.Infof("Reconcile: rule %s (%s) is healthy", rule.Name, rule.ID)
+		return result
+	}
+
+	logrus.Warnf("Reconcile: rule %s (%s) is marked running but is missing %s, recreating",
+		rule.Name, rule.ID, strings.Join(result.Missing, ", "))
+
+	// Move the rule out of the running state so StartRule rebuilds its views
+	rule.Status = models.RuleStatusStarting
+	rule.LastError = fmt.Sprintf("Reconciling: missing %s", strings.Join(result.Missing, ", "))
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		result.Action = ReconcileActionFailed
+		result.Error = fmt.Sprintf("failed to update rule before reconciliation: %v", err)
+		return result
+	}
+
+	if err := s.StartRule(ctx, rule.ID); err != nil {
+		result.Action = ReconcileActionFailed
+		result.Error = fmt.Sprintf("rule was marked running but %s did not exist in Timeplus and could not be recreated: %v",
+			strings.Join(result.Missing, ", "), err)
+
+		// StartRule records its own error; replace it with one that explains the discrepancy
+		if failed, getErr := s.GetRule(ctx, rule.ID); getErr == nil {
+			failed.Status = models.RuleStatusFailed
+			recordRuleError(failed, models.RulePhaseReconcile, "", result.Error)
+			failed.UpdatedAt = time.Now()
+			if err := s.persistRule(ctx, failed, true); err != nil {
+				logrus.Errorf("Reconcile: failed to mark rule %s as failed: %v", rule.ID, err)
+			}
+		}
+
+		logrus.Errorf("Reconcile: %s", result.Error)
+		return result
+	}
+
+	result.Action = ReconcileActionRecreated
+	logrus.Infof("Reconcile: recreated resources for rule %s (%s)", rule.Name, rule.ID)
+	return result
+}
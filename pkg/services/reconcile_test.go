@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestMissingResources(t *testing.T) {
+	dedicated := true
+	rule := &models.Rule{
+		ID:                       "abc-123",
+		ResolveQuery:             "SELECT * FROM s WHERE v < 10",
+		DedicatedAlertAcksStream: &dedicated,
+	}
+
+	inv := &timeplusInventory{
+		streams: map[string]bool{
+			"rule_abc_123_view":         true,
+			"rule_abc_123_resolve_view": true,
+		},
+		materializedViews: map[string]bool{
+			"rule_abc_123_mv": true,
+		},
+	}
+
+	assert.Equal(t, []string{"rule_abc_123_resolve_mv", "rule_abc_123_alert_acks"}, inv.missingResources(rule))
+}
+
+func TestMissingResourcesResultStream(t *testing.T) {
+	rule := &models.Rule{ID: "abc-123", ResultStream: "rule_abc_123_results"}
+	inv := &timeplusInventory{
+		streams: map[string]bool{
+			"rule_abc_123_view":             true,
+			timeplus.AlertAcksMutableStream: true,
+		},
+		materializedViews: map[string]bool{"rule_abc_123_mv": true},
+	}
+	assert.Equal(t, []string{"rule_abc_123_results"}, inv.missingResources(rule))
+
+	// A shadow rule's result stream is its alerts stream and is reported once
+	rule.Shadow = true
+	assert.Equal(t, []string{"rule_abc_123_results"}, inv.missingResources(rule))
+
+	inv.streams["rule_abc_123_results"] = true
+	assert.Empty(t, inv.missingResources(rule))
+}
+
+func TestReconcileRulesHealthy(t *testing.T) {
+	mockClient := new(MockClient)
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Healthy", "status": "running"},
+		{"id": "rule2", "name": "Stopped", "status": "stopped"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"rule_rule1_view", timeplus.AlertAcksMutableStream}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{"rule_rule1_mv"}, nil)
+
+	service := &RuleService{
+		tpClient:    mockClient,
+		ruleStream:  "tp_rules",
+		alertStream: "tp_alerts",
+	}
+
+	results, err := service.ReconcileRules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "rule1", results[0].RuleID)
+	assert.Equal(t, ReconcileActionNone, results[0].Action)
+	assert.Empty(t, results[0].Missing)
+
+	// No rule was persisted or restarted
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
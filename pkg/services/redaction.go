@@ -0,0 +1,39 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// validateRuleRedaction checks that a rule's redaction names plain columns and compiles its patterns,
+// which Timeplus evaluates as RE2 like Go does
+func validateRuleRedaction(redaction *models.RuleRedaction) error {
+	if redaction == nil {
+		return nil
+	}
+	for _, column := range redaction.Columns {
+		if !identifierPattern.MatchString(column) {
+			return fmt.Errorf("%w: redaction.columns must be column names, got %q", ErrInvalidRule, column)
+		}
+	}
+	for i, pattern := range redaction.Patterns {
+		if pattern == "" {
+			return fmt.Errorf("%w: redaction.patterns[%d] is empty", ErrInvalidRule, i)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%w: invalid redaction.patterns[%d]: %v", ErrInvalidRule, i, err)
+		}
+	}
+	return nil
+}
+
+// ruleRedaction returns what the rule masks in the triggering rows of its alerts
+func ruleRedaction(rule *models.Rule) timeplus.Redaction {
+	if rule.Redaction == nil {
+		return timeplus.Redaction{}
+	}
+	return timeplus.Redaction{Columns: rule.Redaction.Columns, Patterns: rule.Redaction.Patterns}
+}
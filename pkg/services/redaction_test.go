@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestValidateRuleRedaction(t *testing.T) {
+	assert.NoError(t, validateRuleRedaction(nil))
+	assert.NoError(t, validateRuleRedaction(&models.RuleRedaction{
+		Columns:  []string{"email", "card_number"},
+		Patterns: []string{`[\w.+-]+@[\w-]+\.[\w.]+`},
+	}))
+
+	err := validateRuleRedaction(&models.RuleRedaction{Columns: []string{"email, phone"}})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Contains(t, err.Error(), "redaction.columns")
+
+	err = validateRuleRedaction(&models.RuleRedaction{Patterns: []string{`\d{4}`, `(unclosed`}})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.Contains(t, err.Error(), "redaction.patterns[1]")
+}
+
+func TestBackfillRuleRedactsAlertData(t *testing.T) {
+	mockClient := new(MockClient)
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Card fraud", "status": "running", "entity_id_column": "account_id",
+			"redaction": `{"columns": ["email"], "patterns": ["\\d{4}-\\d{4}-\\d{4}-\\d{4}"]}`},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "table(`rule_rule1_view`)")
+	})).Return([]map[string]interface{}{
+		{"account_id": "acc1", "email": "jo@example.com", "note": "paid with 4111-1111-1111-1111", "amount": 950.0},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "SELECT entity_id FROM")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.AlertAcksMutableStream, mock.Anything, mock.Anything).Return(nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	_, err := service.BackfillRule(context.Background(), "rule1", 60)
+	require.NoError(t, err)
+
+	mockClient.AssertCalled(t, "InsertIntoStream", mock.Anything, timeplus.AlertAcksMutableStream, mock.Anything,
+		mock.MatchedBy(func(values []interface{}) bool {
+			data := values[6].(string)
+			return strings.Contains(data, `"email":"[REDACTED]"`) &&
+				strings.Contains(data, `"note":"paid with [REDACTED]"`) &&
+				strings.Contains(data, `"amount":950`)
+		}))
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// ReplayResult summarizes an alert replay
+type ReplayResult struct {
+	Target   string `json:"target"`
+	Total    int    `json:"total"`
+	Replayed int    `json:"replayed"`
+	Failed   int    `json:"failed"`
+}
+
+// SetNotificationDispatcher sets the pipeline that alert notifications are sent through, paused
+// if the gateway is
+func (s *RuleService) SetNotificationDispatcher(dispatcher *notify.Dispatcher) {
+	s.dispatcher = dispatcher
+	if dispatcher != nil {
+		dispatcher.SetPaused(s.Paused())
+	}
+}
+
+// ReplayAlerts re-emits the alerts triggered within a time range, oldest first, to the notification
+// pipeline or to the sink given in the request. This lets downstream consumers recover notifications
+// that were lost during an outage.
+func (s *RuleService) ReplayAlerts(ctx context.Context, req *models.ReplayAlertsRequest) (*ReplayResult, error) {
+	if !req.EndTime.After(req.StartTime) {
+		return nil, fmt.Errorf("endTime must be after startTime")
+	}
+
+	done, err := s.trackTask("replay alerts")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	target, err := s.replayTarget(ctx, req.Sink)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := s.GetAlertsByTimeRange(ctx, req.RuleID, req.StartTime, req.EndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replay in the order the alerts originally fired
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].TriggeredAt.Before(alerts[j].TriggeredAt)
+	})
+
+	result := &ReplayResult{Target: target.Name(), Total: len(alerts)}
+	rules := make(map[string]*models.Rule)
+	for _, alert := range alerts {
+		rule, ok := rules[alert.RuleID]
+		if !ok {
+			rule, _ = s.GetRule(ctx, alert.RuleID)
+			rules[alert.RuleID] = rule
+		}
+		if err := target.Notify(ctx, s.notificationEvent(notify.EventReplay, alert, rule)); err != nil {
+			logrus.Warnf("Failed to replay alert %s of rule %s to %s: %v", alert.ID, alert.RuleID, target.Name(), err)
+			result.Failed++
+			continue
+		}
+		result.Replayed++
+	}
+
+	logrus.Infof("Replayed %d of %d alert(s) to %s (%d failed)", result.Replayed, result.Total, result.Target, result.Failed)
+	return result, nil
+}
+
+// replayTarget returns the notifier replayed alerts are sent to
+func (s *RuleService) replayTarget(ctx context.Context, sink *models.ReplaySink) (notify.Notifier, error) {
+	if sink == nil {
+		if s.dispatcher == nil {
+			return nil, fmt.Errorf("no notification pipeline is configured, specify a sink")
+		}
+		if s.Paused() {
+			return nil, fmt.Errorf("%w: the notification pipeline doesn't deliver replays, specify a sink", ErrGatewayPaused)
+		}
+		return s.dispatcher, nil
+	}
+
+	switch sink.Type {
+	case "webhook":
+		if sink.URL == "" {
+			return nil, fmt.Errorf("webhook sink requires a url")
+		}
+		return notify.NewWebhookNotifier(sink.URL), nil
+	case "kafka":
+		return notify.NewKafkaNotifier(ctx, s.tpClient, sink.Brokers, sink.Topic)
+	default:
+		return nil, fmt.Errorf("unsupported sink type %q, expected webhook or kafka", sink.Type)
+	}
+}
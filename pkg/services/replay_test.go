@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// recordingNotifier collects the events it is asked to deliver
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (r *recordingNotifier) Name() string { return "recording" }
+
+func (r *recordingNotifier) Notify(ctx context.Context, event notify.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestReplayAlertsToPipelineOldestFirst(t *testing.T) {
+	mockClient := new(MockClient)
+	now := time.Now()
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "created_at >=")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "dev2", "state": "active", "created_at": now, "firing_seq": uint64(1)},
+		{"rule_id": "rule1", "entity_id": "dev1", "state": "active", "created_at": now.Add(-time.Minute), "firing_seq": uint64(3)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "severity": "critical"},
+	}, nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+
+	result, err := service.ReplayAlerts(context.Background(), &models.ReplayAlertsRequest{
+		RuleID:    "rule1",
+		StartTime: now.Add(-time.Hour),
+		EndTime:   now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &ReplayResult{Target: "pipeline", Total: 2, Replayed: 2}, result)
+
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	require.Len(t, recorder.events, 2)
+	assert.Equal(t, "rule1:dev1:3", recorder.events[0].Alert.ID)
+	assert.Equal(t, notify.EventReplay, recorder.events[0].Type)
+	assert.Equal(t, "High temp", recorder.events[0].Alert.RuleName)
+}
+
+func TestReplayAlertsLargerThanQueue(t *testing.T) {
+	mockClient := new(MockClient)
+	now := time.Now()
+
+	var rows []map[string]interface{}
+	for i := 0; i < 20; i++ {
+		rows = append(rows, map[string]interface{}{
+			"rule_id": "rule1", "entity_id": fmt.Sprintf("dev%d", i), "state": "active",
+			"created_at": now.Add(time.Duration(i) * time.Second), "firing_seq": uint64(1),
+		})
+	}
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "created_at >=")
+	})).Return(rows, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp"},
+	}, nil)
+
+	// The queue holds fewer alerts than are replayed, so replaying waits for room
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(2, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+
+	result, err := service.ReplayAlerts(context.Background(), &models.ReplayAlertsRequest{
+		RuleID:    "rule1",
+		StartTime: now.Add(-time.Hour),
+		EndTime:   now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &ReplayResult{Target: "pipeline", Total: 20, Replayed: 20}, result)
+
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	assert.Len(t, recorder.events, 20)
+}
+
+func TestReplayAlertsRejectsUnknownSink(t *testing.T) {
+	service := &RuleService{tpClient: new(MockClient)}
+
+	_, err := service.ReplayAlerts(context.Background(), &models.ReplayAlertsRequest{
+		StartTime: time.Now().Add(-time.Hour),
+		EndTime:   time.Now(),
+		Sink:      &models.ReplaySink{Type: "smtp"},
+	})
+	assert.ErrorContains(t, err, "unsupported sink type")
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// SetResolveQuery adds or replaces the resolve query of a rule, leaving its other fields alone. The
+// resolve views of a running rule are replaced without stopping it; if the new views can't be
+// created, the previous ones are restored and the rule keeps its previous resolve query.
+func (s *RuleService) SetResolveQuery(ctx context.Context, ruleID, query string) (*models.Rule, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: resolveQuery is required, remove the resolve query instead", ErrInvalidRule)
+	}
+	return s.changeResolveQuery(ctx, ruleID, query)
+}
+
+// RemoveResolveQuery removes the resolve query of a rule, dropping the resolve views of a running rule.
+// Its alerts are then only resolved by acknowledging them.
+func (s *RuleService) RemoveResolveQuery(ctx context.Context, ruleID string) (*models.Rule, error) {
+	return s.changeResolveQuery(ctx, ruleID, "")
+}
+
+func (s *RuleService) changeResolveQuery(ctx context.Context, ruleID, query string) (*models.Rule, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Spec != nil {
+		return nil, fmt.Errorf("%w: the resolve query of %s rules is generated from their spec", ErrInvalidRule, rule.Type)
+	}
+	if rule.Status == models.RuleStatusStarting || rule.Status == models.RuleStatusStopping {
+		return nil, fmt.Errorf("cannot change the resolve query of a rule in %s state", rule.Status)
+	}
+	if query == rule.ResolveQuery {
+		return rule, nil
+	}
+
+	if query != "" {
+		if err := s.validateResolveQuery(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	// A rule that isn't running creates its resolve views, and checks the entity column, when it starts
+	if !ruleEvaluating(rule) {
+		if err := s.persistResolveQuery(ctx, rule, query); err != nil {
+			return nil, err
+		}
+		logrus.Infof("Changed resolve query of rule %s (%s)", rule.Name, rule.ID)
+		return rule, nil
+	}
+	return s.replaceResolveViews(ctx, rule, query)
+}
+
+// validateResolveQuery has Timeplus check a resolve query and rejects one too expensive to run
+func (s *RuleService) validateResolveQuery(ctx context.Context, query string) error {
+	var problems []RuleValidationProblem
+	if err := s.tpClient.ExecuteDDL(ctx, "EXPLAIN "+query); err != nil {
+		exception, ok := timeplus.ServerError(err)
+		if !ok {
+			return fmt.Errorf("failed to validate resolveQuery: %w", err)
+		}
+		problems = append(problems, RuleValidationProblem{Field: "resolveQuery", Message: exception.Message})
+	}
+	problems = append(problems, s.queryCostProblems(&models.Rule{ResolveQuery: query})...)
+
+	if len(problems) > 0 {
+		return &RuleValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// replaceResolveViews swaps the resolve views of a running rule for ones reading the new query, or
+// drops them when the query is empty
+func (s *RuleService) replaceResolveViews(ctx context.Context, rule *models.Rule, query string) (*models.Rule, error) {
+	objects := ruleObjects(rule)
+	previous := rule.ResolveQuery
+
+	if query != "" && rule.EntityIDColumn != "" {
+		columns, err := s.resolveQueryColumns(ctx, objects.ResolveView+"_check", query)
+		if err != nil {
+			return nil, err
+		}
+		if !hasColumn(columns, rule.EntityIDColumn) && rule.EntityIDColumn != "entity_id" {
+			return nil, &RuleValidationError{Problems: []RuleValidationProblem{{
+				Field:   "resolveQuery",
+				Message: fmt.Sprintf("entity ID column '%s' not found in resolveQuery results, the resolveQuery must return the same entity ID column as the rule's query", rule.EntityIDColumn),
+			}}}
+		}
+	}
+
+	if err := s.dropResolveViews(ctx, objects); err != nil {
+		return nil, err
+	}
+
+	// Rules started before the entity ID column was recorded, or with an entity ID the gateway
+	// generated, have the generated column added to the resolve view when they start
+	if query != "" && (rule.EntityIDColumn == "" || rule.EntityIDColumn == "entity_id") {
+		if err := s.persistResolveQuery(ctx, rule, query); err != nil {
+			return nil, err
+		}
+		if _, err := s.RebuildRule(ctx, rule.ID, false); err != nil {
+			return nil, fmt.Errorf("failed to apply the resolve query: %w", err)
+		}
+		return s.GetRule(ctx, rule.ID)
+	}
+
+	if query != "" {
+		if err := s.createResolveViews(ctx, rule, query); err != nil {
+			s.restoreResolveViews(ctx, rule, previous)
+			return nil, fmt.Errorf("failed to create resolve views of rule %s: %w", rule.ID, err)
+		}
+	}
+
+	if err := s.persistResolveQuery(ctx, rule, query); err != nil {
+		return nil, err
+	}
+	logrus.Infof("Replaced resolve views of running rule %s (%s)", rule.Name, rule.ID)
+	return rule, nil
+}
+
+// resolveQueryColumns returns the columns of a resolve query, through a view created and dropped
+// for the purpose
+func (s *RuleService) resolveQueryColumns(ctx context.Context, viewName, query string) ([]map[string]interface{}, error) {
+	drop := fmt.Sprintf("DROP VIEW IF EXISTS `%s`", viewName)
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("CREATE VIEW `%s` AS %s", viewName, query)); err != nil {
+		return nil, fmt.Errorf("failed to create view to check resolveQuery: %w", err)
+	}
+	defer func() {
+		if err := s.tpClient.ExecuteDDL(ctx, drop); err != nil {
+			logrus.Warnf("Error dropping view %s: %v", viewName, err)
+		}
+	}()
+
+	columns, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("DESCRIBE `%s`", viewName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resolveQuery columns: %w", err)
+	}
+	return columns, nil
+}
+
+// createResolveViews creates the resolve view of a rule and the materialized view acknowledging
+// its alerts
+func (s *RuleService) createResolveViews(ctx context.Context, rule *models.Rule, query string) error {
+	objects := ruleObjects(rule)
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("CREATE VIEW `%s` AS %s", objects.ResolveView, query)); err != nil {
+		return err
+	}
+	return s.tpClient.ExecuteDDL(ctx, timeplus.GetRuleResolveViewQuery(
+		rule.ID,
+		objects.ResolveView,
+		objects.ResolveMaterializedView,
+		rule.EntityIDColumn,
+		getRuleResources(rule).AlertsStream,
+	))
+}
+
+// dropResolveViews drops the resolve materialized view of a rule before the view it reads
+func (s *RuleService) dropResolveViews(ctx context.Context, objects *models.RuleObjects) error {
+	for _, view := range []string{objects.ResolveMaterializedView, objects.ResolveView} {
+		if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", view)); err != nil {
+			return fmt.Errorf("failed to drop resolve view %s: %w", view, err)
+		}
+	}
+	return nil
+}
+
+// restoreResolveViews recreates the resolve views of a rule's previous resolve query after the new
+// ones failed. The rule keeps running either way; without them its alerts aren't resolved automatically.
+func (s *RuleService) restoreResolveViews(ctx context.Context, rule *models.Rule, previous string) {
+	objects := ruleObjects(rule)
+	if err := s.dropResolveViews(ctx, objects); err != nil {
+		logrus.Warnf("Error dropping resolve views of rule %s: %v", rule.ID, err)
+	}
+	if previous == "" {
+		return
+	}
+	if err := s.createResolveViews(ctx, rule, previous); err != nil {
+		logrus.Errorf("Failed to restore resolve views of rule %s: %v", rule.ID, err)
+		recordRuleError(rule, models.RulePhaseResolveView, "", fmt.Sprintf("Failed to restore resolve views: %v", err))
+		rule.UpdatedAt = time.Now()
+		s.persistRule(ctx, rule, true)
+	}
+}
+
+// persistResolveQuery stores a rule's resolve query along with the name of its resolve view
+func (s *RuleService) persistResolveQuery(ctx context.Context, rule *models.Rule, query string) error {
+	rule.ResolveQuery = query
+	rule.ResolveViewName = ""
+	if query != "" {
+		rule.ResolveViewName = ruleObjects(rule).ResolveView
+	}
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return fmt.Errorf("failed to persist updated rule: %w", err)
+	}
+	return nil
+}
+
+// hasColumn reports whether DESCRIBE results include a column
+func hasColumn(columns []map[string]interface{}, name string) bool {
+	for _, column := range columns {
+		if getString(column, "name") == name {
+			return true
+		}
+	}
+	return false
+}
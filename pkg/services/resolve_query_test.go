@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+const previousResolveQuery = "SELECT device_id FROM devices WHERE temperature < 25"
+
+func resolveQueryMockClient(status models.RuleStatus, resolveColumn string, createErr error) *MockClient {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, "DESCRIBE `rule_r1_resolve_view_check`").Return([]map[string]interface{}{
+		{"name": resolveColumn, "type": "string"},
+		{"name": "temperature", "type": "float64"},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Hot", "status": string(status), "severity": "warning", "entity_id_column": "device_id",
+			"resolve_query": previousResolveQuery, "resolve_view_name": "rule_r1_resolve_view"},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.HasPrefix(query, "CREATE VIEW `rule_r1_resolve_view` AS SELECT device_id FROM devices WHERE temperature < 20")
+	})).Return(createErr)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+	return mockClient
+}
+
+func ddlStatements(mockClient *MockClient) []string {
+	var ddl []string
+	for _, call := range mockClient.Calls {
+		if call.Method == "ExecuteDDL" {
+			ddl = append(ddl, call.Arguments.String(1))
+		}
+	}
+	return ddl
+}
+
+func TestSetResolveQueryReplacesResolveViewsOfRunningRule(t *testing.T) {
+	mockClient := resolveQueryMockClient(models.RuleStatusRunning, "device_id", nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	query := "SELECT device_id FROM devices WHERE temperature < 20"
+	rule, err := service.SetResolveQuery(context.Background(), "r1", query)
+	require.NoError(t, err)
+	assert.Equal(t, query, rule.ResolveQuery)
+	assert.Equal(t, models.RuleStatusRunning, rule.Status)
+	assert.Equal(t, query, persistedRule(t, mockClient)["resolve_query"])
+
+	ddl := ddlStatements(mockClient)
+	require.Len(t, ddl, 7)
+	assert.Equal(t, "EXPLAIN "+query, ddl[0])
+	assert.Equal(t, "CREATE VIEW `rule_r1_resolve_view_check` AS "+query, ddl[1])
+	assert.Equal(t, "DROP VIEW IF EXISTS `rule_r1_resolve_view_check`", ddl[2])
+	assert.Equal(t, "DROP VIEW IF EXISTS `rule_r1_resolve_mv`", ddl[3])
+	assert.Equal(t, "DROP VIEW IF EXISTS `rule_r1_resolve_view`", ddl[4])
+	assert.Equal(t, "CREATE VIEW `rule_r1_resolve_view` AS "+query, ddl[5])
+	assert.Contains(t, ddl[6], "CREATE MATERIALIZED VIEW `rule_r1_resolve_mv`")
+	assert.Contains(t, ddl[6], "view.`device_id` AS entity_id")
+}
+
+func TestSetResolveQueryRequiresEntityColumn(t *testing.T) {
+	mockClient := resolveQueryMockClient(models.RuleStatusRunning, "sensor", nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	_, err := service.SetResolveQuery(context.Background(), "r1", "SELECT sensor FROM devices WHERE temperature < 20")
+	var validationErr *RuleValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "resolveQuery", validationErr.Problems[0].Field)
+	assert.Contains(t, validationErr.Problems[0].Message, "device_id")
+
+	// The running rule's resolve views are left alone
+	for _, ddl := range ddlStatements(mockClient) {
+		assert.NotContains(t, ddl, "`rule_r1_resolve_mv`")
+	}
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSetResolveQueryRestoresPreviousViewsOnFailure(t *testing.T) {
+	mockClient := resolveQueryMockClient(models.RuleStatusRunning, "device_id", assert.AnError)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	_, err := service.SetResolveQuery(context.Background(), "r1", "SELECT device_id FROM devices WHERE temperature < 20")
+	require.ErrorIs(t, err, assert.AnError)
+
+	ddl := ddlStatements(mockClient)
+	assert.Equal(t, "CREATE VIEW `rule_r1_resolve_view` AS "+previousResolveQuery, ddl[len(ddl)-2])
+	assert.Contains(t, ddl[len(ddl)-1], "CREATE MATERIALIZED VIEW `rule_r1_resolve_mv`")
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRemoveResolveQueryOfStoppedRule(t *testing.T) {
+	mockClient := resolveQueryMockClient(models.RuleStatusStopped, "device_id", nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	rule, err := service.RemoveResolveQuery(context.Background(), "r1")
+	require.NoError(t, err)
+	assert.Empty(t, rule.ResolveQuery)
+	assert.Empty(t, rule.ResolveViewName)
+
+	row := persistedRule(t, mockClient)
+	assert.Equal(t, "", row["resolve_query"])
+	assert.Empty(t, ddlStatements(mockClient), "a stopped rule has no resolve views")
+}
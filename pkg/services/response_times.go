@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Response time report groupings
+const (
+	ResponseTimeGroupNone = ""
+	ResponseTimeGroupRule = "rule"
+	ResponseTimeGroupTeam = "team"
+)
+
+// ErrInvalidReportQuery is returned for reports with unsupported parameters
+var ErrInvalidReportQuery = errors.New("invalid report query")
+
+// ResponseTimeStats summarizes how long alerts took to reach a state, in seconds
+type ResponseTimeStats struct {
+	Count       int64   `json:"count"` // Alerts that reached the state
+	MeanSeconds float64 `json:"meanSeconds"`
+	P50Seconds  float64 `json:"p50Seconds"`
+	P90Seconds  float64 `json:"p90Seconds"`
+	P95Seconds  float64 `json:"p95Seconds"`
+	P99Seconds  float64 `json:"p99Seconds"`
+	MaxSeconds  float64 `json:"maxSeconds"`
+}
+
+// ResponseTimeGroup holds the response times of the alerts of one rule or team
+type ResponseTimeGroup struct {
+	Key               string            `json:"key"`               // Rule ID or team, empty for the overall group or alerts of rules without a team
+	Name              string            `json:"name,omitempty"`    // Rule name when grouped by rule
+	Alerts            int64             `json:"alerts"`            // Alerts that fired in the range
+	TimeToAcknowledge ResponseTimeStats `json:"timeToAcknowledge"` // From firing to the first acknowledgement (MTTA)
+	TimeToResolve     ResponseTimeStats `json:"timeToResolve"`     // From firing to resolution (MTTR)
+}
+
+// ResponseTimeReport holds the mean time to acknowledge and resolve alerts that fired in a time range
+type ResponseTimeReport struct {
+	StartTime time.Time           `json:"startTime"`
+	EndTime   time.Time           `json:"endTime"`
+	GroupBy   string              `json:"groupBy,omitempty"`
+	RuleID    string              `json:"ruleId,omitempty"`
+	Team      string              `json:"team,omitempty"`
+	Groups    []ResponseTimeGroup `json:"groups"`
+}
+
+// GetResponseTimeReport aggregates how long alerts that fired between start and end took to be
+// acknowledged and resolved, with percentiles, per rule, per team or overall, in a single query.
+// ruleID and team optionally filter the alerts. Like the SLA report it reads the latest state of
+// each alert; an alert's acknowledgement time is the first acknowledged entry of its audit trail,
+// or its last update while it is still acknowledged.
+func (s *RuleService) GetResponseTimeReport(ctx context.Context, start, end time.Time, groupBy, ruleID, team string) (*ResponseTimeReport, error) {
+	var keyExpr, nameExpr string
+	switch groupBy {
+	case ResponseTimeGroupNone:
+		keyExpr, nameExpr = "''", "''"
+	case ResponseTimeGroupRule:
+		keyExpr, nameExpr = "rule_id", "any(rule_name)"
+	case ResponseTimeGroupTeam:
+		keyExpr, nameExpr = "team", "''"
+	default:
+		return nil, fmt.Errorf("%w: unsupported groupBy %q, expected rule or team", ErrInvalidReportQuery, groupBy)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidReportQuery)
+	}
+
+	conditions := []string{
+		fmt.Sprintf("a.created_at >= %s", timeplus.DateTime64(start)),
+		fmt.Sprintf("a.created_at < %s", timeplus.DateTime64(end)),
+	}
+	if ruleID != "" {
+		conditions = append(conditions, fmt.Sprintf("a.rule_id = '%s'", strings.ReplaceAll(ruleID, "'", "''")))
+	}
+	if team != "" {
+		conditions = append(conditions, fmt.Sprintf("r.team = '%s'", strings.ReplaceAll(team, "'", "''")))
+	}
+
+	// Unmatched rows of the audit join carry the zero time, which is before any firing. Times of
+	// alerts that never reached a state are -1 and left out of its statistics.
+	source := fmt.Sprintf(`(
+		SELECT a.rule_id AS rule_id, coalesce(r.name, '') AS rule_name, coalesce(r.team, '') AS team,
+			multi_if(k.acked_at >= a.created_at, date_diff('second', a.created_at, k.acked_at),
+				a.state = '%[1]s', date_diff('second', a.created_at, a.updated_at), -1) AS tta,
+			if(a.state = '%[2]s', date_diff('second', a.created_at, a.updated_at), -1) AS ttr
+		FROM %[3]s AS a
+		LEFT JOIN (SELECT id, name, team FROM table(%[4]s) WHERE active = true) AS r ON a.rule_id = r.id
+		LEFT JOIN (
+			SELECT rule_id, entity_id, firing_seq, min(at) AS acked_at FROM table(%[5]s)
+			WHERE action = '%[6]s' GROUP BY rule_id, entity_id, firing_seq
+		) AS k ON a.rule_id = k.rule_id AND a.entity_id = k.entity_id AND a.firing_seq = k.firing_seq
+		WHERE %[7]s
+	)`, timeplus.AlertStateAcknowledged, timeplus.AlertStateResolved, timeplus.AlertAcksTable(), s.ruleStream,
+		timeplus.AlertAuditStream, timeplus.AlertAuditActionAcknowledged, strings.Join(conditions, " AND "))
+
+	query := fmt.Sprintf(`SELECT %[1]s AS key, %[2]s AS name, count() AS alerts,
+		%[3]s,
+		%[4]s
+	FROM %[5]s
+	GROUP BY key
+	ORDER BY key`, keyExpr, nameExpr, responseTimeAggregates("tta"), responseTimeAggregates("ttr"), source)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate response times: %w", err)
+	}
+
+	report := &ResponseTimeReport{StartTime: start, EndTime: end, GroupBy: groupBy, RuleID: ruleID, Team: team, Groups: []ResponseTimeGroup{}}
+	for _, row := range rows {
+		report.Groups = append(report.Groups, ResponseTimeGroup{
+			Key:               getString(row, "key"),
+			Name:              getString(row, "name"),
+			Alerts:            getInt64(row, "alerts"),
+			TimeToAcknowledge: responseTimeStats(row, "tta"),
+			TimeToResolve:     responseTimeStats(row, "ttr"),
+		})
+	}
+	return report, nil
+}
+
+// responseTimeAggregates returns the aggregates of a duration column, -1 when the state wasn't
+// reached. Percentiles skip those as NULLs and are coalesced so they aren't returned as nullable.
+func responseTimeAggregates(column string) string {
+	reached := column + " >= 0"
+	value := fmt.Sprintf("if(%s, %s, NULL)", reached, column)
+	return fmt.Sprintf(`count_if(%[1]s) AS %[3]s_count, avg_if(%[3]s, %[1]s) AS %[3]s_mean,
+		coalesce(quantile(0.5)(%[2]s), 0) AS %[3]s_p50, coalesce(quantile(0.9)(%[2]s), 0) AS %[3]s_p90,
+		coalesce(quantile(0.95)(%[2]s), 0) AS %[3]s_p95, coalesce(quantile(0.99)(%[2]s), 0) AS %[3]s_p99,
+		max_if(%[3]s, %[1]s) AS %[3]s_max`, reached, value, column)
+}
+
+// responseTimeStats reads the aggregates of a duration column from a report row
+func responseTimeStats(row map[string]interface{}, column string) ResponseTimeStats {
+	stats := ResponseTimeStats{Count: getInt64(row, column+"_count")}
+	if stats.Count == 0 {
+		return stats
+	}
+	stats.MeanSeconds = getFloat64(row, column+"_mean")
+	stats.P50Seconds = getFloat64(row, column+"_p50")
+	stats.P90Seconds = getFloat64(row, column+"_p90")
+	stats.P95Seconds = getFloat64(row, column+"_p95")
+	stats.P99Seconds = getFloat64(row, column+"_p99")
+	stats.MaxSeconds = getFloat64(row, column+"_max")
+	return stats
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetResponseTimeReport(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "SELECT team AS key") &&
+			strings.Contains(query, "r.team = 'pay''ments'") &&
+			strings.Contains(query, "WHERE action = 'acknowledged' GROUP BY rule_id, entity_id, firing_seq") &&
+			strings.Contains(query, "coalesce(quantile(0.9)(if(tta >= 0, tta, NULL)), 0) AS tta_p90") &&
+			strings.Contains(query, "if(a.state = 'resolved', date_diff('second', a.created_at, a.updated_at), -1) AS ttr")
+	})).Return([]map[string]interface{}{
+		{"key": "pay'ments", "name": "", "alerts": uint64(12),
+			"tta_count": uint64(10), "tta_mean": float64(95.5), "tta_p50": float64(60), "tta_p90": float64(240),
+			"tta_p95": float64(300), "tta_p99": float64(590), "tta_max": int64(600),
+			"ttr_count": uint64(0), "ttr_mean": float64(0)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	end := time.Now()
+	report, err := service.GetResponseTimeReport(context.Background(), end.Add(-7*24*time.Hour), end, ResponseTimeGroupTeam, "", "pay'ments")
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 1)
+
+	group := report.Groups[0]
+	assert.Equal(t, int64(12), group.Alerts)
+	assert.Equal(t, int64(10), group.TimeToAcknowledge.Count)
+	assert.Equal(t, 95.5, group.TimeToAcknowledge.MeanSeconds)
+	assert.Equal(t, float64(240), group.TimeToAcknowledge.P90Seconds)
+	assert.Equal(t, float64(600), group.TimeToAcknowledge.MaxSeconds)
+	assert.Equal(t, ResponseTimeStats{}, group.TimeToResolve, "nothing resolved yet")
+
+	_, err = service.GetResponseTimeReport(context.Background(), end.Add(-time.Hour), end, "severity", "", "")
+	assert.ErrorIs(t, err, ErrInvalidReportQuery)
+	_, err = service.GetResponseTimeReport(context.Background(), end, end.Add(-time.Hour), ResponseTimeGroupRule, "", "")
+	assert.ErrorIs(t, err, ErrInvalidReportQuery)
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
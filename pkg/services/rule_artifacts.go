@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Roles of the Timeplus objects a rule owns
+const (
+	ArtifactPlainView           = "plain_view"
+	ArtifactMaterializedView    = "materialized_view"
+	ArtifactResolveView         = "resolve_view"
+	ArtifactResolveMaterialized = "resolve_materialized_view"
+	ArtifactAlertAcksStream     = "alert_acks_stream"
+	ArtifactResultStream        = "result_stream"
+	ArtifactAlertHistoryStream  = "alert_history_stream"
+	ArtifactAlertHistoryMV      = "alert_history_materialized_view"
+)
+
+// RuleArtifact is a Timeplus object owned by a rule, with the DDL Timeplus holds for it
+type RuleArtifact struct {
+	Role   string `json:"role"`
+	Kind   string `json:"kind"` // "view", "materialized_view" or "stream"
+	Name   string `json:"name"`
+	Exists bool   `json:"exists"`
+	DDL    string `json:"ddl,omitempty"`   // Output of SHOW CREATE, empty when the object doesn't exist
+	Error  string `json:"error,omitempty"` // Why the DDL couldn't be read
+}
+
+// RuleArtifacts lists the Timeplus objects of a rule and whether the rule has everything it needs
+type RuleArtifacts struct {
+	RuleID         string         `json:"ruleId"`
+	Status         string         `json:"status"`
+	EntityIDColumn string         `json:"entityIdColumn,omitempty"`
+	Healthy        bool           `json:"healthy"`           // Running with every required object present
+	Missing        []string       `json:"missing,omitempty"` // Required objects of a running rule that don't exist
+	Artifacts      []RuleArtifact `json:"artifacts"`
+	CheckedAt      time.Time      `json:"checkedAt"`
+}
+
+// GetRuleArtifacts returns the DDL of the views and streams a rule owns as Timeplus currently
+// holds them, along with which of them exist
+func (s *RuleService) GetRuleArtifacts(ctx context.Context, ruleID string) (*RuleArtifacts, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.loadTimeplusInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RuleArtifacts{
+		RuleID:         rule.ID,
+		Status:         string(rule.Status),
+		EntityIDColumn: rule.EntityIDColumn,
+		Artifacts:      []RuleArtifact{},
+		CheckedAt:      time.Now(),
+	}
+
+	for _, artifact := range ruleArtifactList(rule) {
+		if artifact.Kind == "materialized_view" {
+			artifact.Exists = inv.materializedViews[artifact.Name]
+		} else {
+			artifact.Exists = inv.streams[artifact.Name]
+		}
+		if artifact.Exists {
+			artifact.DDL, err = s.showCreate(ctx, artifact)
+			if err != nil {
+				logrus.Warnf("Failed to read DDL of %s for rule %s: %v", artifact.Name, rule.ID, err)
+				artifact.Error = err.Error()
+			}
+		}
+		result.Artifacts = append(result.Artifacts, artifact)
+	}
+
+	if ruleEvaluating(rule) {
+		result.Missing = inv.missingResources(rule)
+		result.Healthy = len(result.Missing) == 0
+	}
+	return result, nil
+}
+
+// ruleArtifactList returns the objects a rule owns. The shared alert acks stream is left out,
+// since it isn't the rule's.
+func ruleArtifactList(rule *models.Rule) []RuleArtifact {
+	res := getRuleResources(rule)
+
+	artifacts := []RuleArtifact{
+		{Role: ArtifactPlainView, Kind: "view", Name: res.PlainView},
+		{Role: ArtifactMaterializedView, Kind: "materialized_view", Name: res.MaterializedView},
+	}
+	if res.ResolveView != "" {
+		artifacts = append(artifacts,
+			RuleArtifact{Role: ArtifactResolveView, Kind: "view", Name: res.ResolveView},
+			RuleArtifact{Role: ArtifactResolveMaterialized, Kind: "materialized_view", Name: res.ResolveMaterialized},
+		)
+	}
+	if res.DedicatedAcksStream {
+		artifacts = append(artifacts, RuleArtifact{Role: ArtifactAlertAcksStream, Kind: "stream", Name: res.AlertAcksStream})
+	}
+	if rule.Shadow {
+		artifacts = append(artifacts, RuleArtifact{Role: ArtifactResultStream, Kind: "stream", Name: res.ResultStream})
+	}
+	return append(artifacts,
+		RuleArtifact{Role: ArtifactAlertHistoryStream, Kind: "stream", Name: res.AlertHistoryStream},
+		RuleArtifact{Role: ArtifactAlertHistoryMV, Kind: "materialized_view", Name: res.AlertHistoryMV},
+	)
+}
+
+// showCreate returns the DDL Timeplus holds for an object
+func (s *RuleService) showCreate(ctx context.Context, artifact RuleArtifact) (string, error) {
+	keyword := "VIEW"
+	if artifact.Kind == "stream" {
+		keyword = "STREAM"
+	}
+
+	results, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("SHOW CREATE %s `%s`", keyword, artifact.Name))
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("SHOW CREATE returned no rows")
+	}
+	// The single column is named "statement", but don't depend on it
+	for _, value := range results[0] {
+		if ddl, ok := value.(string); ok {
+			return ddl, nil
+		}
+	}
+	return "", fmt.Errorf("SHOW CREATE returned no statement")
+}
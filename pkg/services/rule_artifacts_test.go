@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestGetRuleArtifacts(t *testing.T) {
+	mockClient := new(MockClient)
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.HasPrefix(q, "SHOW CREATE VIEW `rule_rule1_view`")
+	})).Return([]map[string]interface{}{
+		{"statement": "CREATE VIEW default.rule_rule1_view AS SELECT * FROM devices"},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+		return strings.HasPrefix(q, "SHOW CREATE")
+	})).Return([]map[string]interface{}(nil), assert.AnError)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Hot devices", "status": "running", "entity_id_column": "device_id",
+			"resolve_query": "SELECT * FROM devices WHERE temperature < 25"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{
+		"rule_rule1_view", "rule_rule1_alert_history", timeplus.AlertAcksMutableStream,
+	}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{"rule_rule1_mv"}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	artifacts, err := service.GetRuleArtifacts(context.Background(), "rule1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "device_id", artifacts.EntityIDColumn)
+	assert.False(t, artifacts.Healthy)
+	assert.Equal(t, []string{"rule_rule1_resolve_view", "rule_rule1_resolve_mv"}, artifacts.Missing)
+
+	byRole := make(map[string]RuleArtifact)
+	for _, artifact := range artifacts.Artifacts {
+		byRole[artifact.Role] = artifact
+	}
+	assert.Len(t, byRole, 6, "the shared alert acks stream isn't listed")
+
+	assert.True(t, byRole[ArtifactPlainView].Exists)
+	assert.Equal(t, "CREATE VIEW default.rule_rule1_view AS SELECT * FROM devices", byRole[ArtifactPlainView].DDL)
+
+	assert.True(t, byRole[ArtifactMaterializedView].Exists)
+	assert.Empty(t, byRole[ArtifactMaterializedView].DDL)
+	assert.NotEmpty(t, byRole[ArtifactMaterializedView].Error)
+
+	assert.False(t, byRole[ArtifactResolveMaterialized].Exists)
+	assert.Empty(t, byRole[ArtifactResolveMaterialized].Error, "missing objects aren't queried")
+}
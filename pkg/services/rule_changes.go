@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ruleChangeFeedName is the name the rule change feed is supervised under
+const ruleChangeFeedName = "rule_changes"
+
+// RuleChangeFeedStatus describes the subscription following changes to the rules stream
+type RuleChangeFeedStatus struct {
+	timeplus.StreamStatus
+	Applied int64 `json:"applied"` // Rule changes applied to this instance's caches and monitor
+}
+
+// StartRuleChangeFeed follows the rules stream with a streaming query, so rules changed through
+// another replica are picked up without waiting for caches to expire: the changed rule is dropped
+// from this instance's caches, and the alert monitor starts or stops watching its dedicated acks
+// stream. Changes made through this instance are seen too and applying them again is harmless.
+// Views are never created or dropped for another replica's change; that replica already did.
+func (s *RuleService) StartRuleChangeFeed() error {
+	streamer := timeplus.NewStreamer(s.tpClient)
+	err := streamer.Start(timeplus.StreamSpec{
+		Name:    ruleChangeFeedName,
+		Query:   fmt.Sprintf("SELECT %s, active, _tp_time FROM `%s`", ruleSelectColumns, s.ruleStream),
+		Handler: s.applyRuleChange,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to follow rule changes: %w", err)
+	}
+	s.ruleChanges.Store(streamer)
+	return nil
+}
+
+// stopRuleChangeFeed stops following the rules stream, if the feed is running
+func (s *RuleService) stopRuleChangeFeed(ctx context.Context) {
+	streamer := s.ruleChanges.Swap(nil)
+	if streamer == nil {
+		return
+	}
+	if err := streamer.Shutdown(ctx); err != nil {
+		logrus.Warnf("Rule change feed did not stop: %v", err)
+	}
+}
+
+// applyRuleChange brings this instance in line with a row written to the rules stream. Rules
+// passing through starting or stopping only have their caches dropped, so the monitor keeps
+// watching a rule being restarted.
+func (s *RuleService) applyRuleChange(ctx context.Context, row map[string]interface{}) error {
+	rule := mapToRule(row)
+	if rule.ID == "" {
+		return nil
+	}
+	deleted := !getBool(row, "active")
+
+	s.invalidateRuleCaches(rule.ID, deleted)
+	switch {
+	case deleted, rule.Status == models.RuleStatusStopped, rule.Status == models.RuleStatusFailed:
+		s.monitorRuleStopped(rule.ID)
+	case ruleEvaluating(rule):
+		s.monitorRuleStarted(rule)
+	}
+
+	s.ruleChangesApplied.Add(1)
+	logrus.Debugf("Rule change feed: applied %s of rule %s (deleted=%t)", rule.Status, rule.ID, deleted)
+	return nil
+}
+
+// invalidateRuleCaches drops what this instance keeps about a rule that changed
+func (s *RuleService) invalidateRuleCaches(ruleID string, deleted bool) {
+	if am := s.alertMonitor.Load(); am != nil {
+		am.forgetRule(ruleID)
+	}
+
+	// The active alerts snapshot includes each rule's details
+	s.activeAlertsMutex.Lock()
+	s.activeAlerts = nil
+	s.activeAlertsMutex.Unlock()
+
+	if deleted {
+		s.recommendationsMutex.Lock()
+		delete(s.recommendations, ruleID)
+		s.recommendationsMutex.Unlock()
+	}
+}
+
+// ruleChangeFeedStatus returns the status of the rule change feed, nil if it isn't running
+func (s *RuleService) ruleChangeFeedStatus() *RuleChangeFeedStatus {
+	streamer := s.ruleChanges.Load()
+	if streamer == nil {
+		return nil
+	}
+	status := &RuleChangeFeedStatus{Applied: s.ruleChangesApplied.Load()}
+	for _, stream := range streamer.Status() {
+		if stream.Name == ruleChangeFeedName {
+			status.StreamStatus = stream
+		}
+	}
+	return status
+}
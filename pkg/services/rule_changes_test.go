@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestApplyRuleChange(t *testing.T) {
+	service := &RuleService{
+		activeAlerts:    &ActiveAlerts{},
+		recommendations: map[string]*RuleRecommendations{"rule1": {}},
+	}
+	monitor := NewAlertMonitor(service, nil)
+	service.alertMonitor.Store(monitor)
+	monitor.rules["rule1"] = cachedRule{rule: &models.Rule{ID: "rule1", Severity: "warning"}}
+	monitor.ruleStreams["rule1"] = "rule_rule1_alert_acks"
+
+	// Another replica restarting the rule only drops what this instance cached
+	require.NoError(t, service.applyRuleChange(context.Background(), map[string]interface{}{
+		"id": "rule1", "status": "starting", "active": true,
+	}))
+	assert.NotContains(t, monitor.rules, "rule1")
+	assert.Nil(t, service.activeAlerts)
+	assert.Equal(t, "rule_rule1_alert_acks", monitor.ruleStreams["rule1"], "the rule is still watched while it restarts")
+	assert.Contains(t, service.recommendations, "rule1")
+
+	require.NoError(t, service.applyRuleChange(context.Background(), map[string]interface{}{
+		"id": "rule1", "status": "stopped", "active": false,
+	}))
+	assert.NotContains(t, monitor.ruleStreams, "rule1", "a deleted rule is no longer watched")
+	assert.NotContains(t, service.recommendations, "rule1")
+	assert.Equal(t, int64(2), service.ruleChangesApplied.Load())
+
+	assert.Nil(t, service.ruleChangeFeedStatus(), "the feed isn't running")
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// ErrRuleComponentHealthy is returned when retrying a component of a rule that didn't fail
+var ErrRuleComponentHealthy = errors.New("rule component has not failed")
+
+// ruleEvaluating reports whether a rule's materialized view is evaluating it, fully or degraded
+func ruleEvaluating(rule *models.Rule) bool {
+	return rule.Status == models.RuleStatusRunning || rule.Status == models.RuleStatusDegraded
+}
+
+// markRuleComponentFailed degrades a rule whose component failed while its alerting keeps running
+func markRuleComponentFailed(rule *models.Rule, component string) {
+	rule.Status = models.RuleStatusDegraded
+	if !slices.Contains(rule.FailedComponents, component) {
+		rule.FailedComponents = append(rule.FailedComponents, component)
+	}
+}
+
+// RetryRuleComponent recreates a failed component of a degraded rule without touching the views
+// that alert. The rule is running again once none of its components have failed.
+func (s *RuleService) RetryRuleComponent(ctx context.Context, ruleID, component string) (*models.Rule, error) {
+	if component != models.RuleComponentResolve && component != models.RuleComponentAlertHistory {
+		return nil, fmt.Errorf("%w: unknown component %q, expected %s or %s", ErrInvalidRule, component,
+			models.RuleComponentResolve, models.RuleComponentAlertHistory)
+	}
+
+	done, err := s.trackTask(fmt.Sprintf("retry %s of rule %s", component, ruleID))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Status != models.RuleStatusDegraded || !slices.Contains(rule.FailedComponents, component) {
+		return nil, fmt.Errorf("%w: %s of rule %s is not failed", ErrRuleComponentHealthy, component, rule.ID)
+	}
+
+	switch component {
+	case models.RuleComponentResolve:
+		if rule.ResolveQuery == "" {
+			break
+		}
+		// A generated entity ID is added to the resolve view by StartRule, which only a rebuild reruns
+		if rule.EntityIDColumn == "" || rule.EntityIDColumn == "entity_id" {
+			if _, err := s.RebuildRule(ctx, rule.ID, false); err != nil {
+				return nil, err
+			}
+			return s.GetRule(ctx, rule.ID)
+		}
+		objects := ruleObjects(rule)
+		if err := s.dropResolveViews(ctx, objects); err != nil {
+			return nil, err
+		}
+		if err := s.createResolveViews(ctx, rule, rule.ResolveQuery); err != nil {
+			return nil, s.componentRetryFailed(ctx, rule, models.RulePhaseResolveMaterializedView,
+				fmt.Errorf("failed to create resolve views of rule %s: %w", rule.ID, err))
+		}
+		rule.ResolveViewName = objects.ResolveView
+
+	case models.RuleComponentAlertHistory:
+		if err := s.setupAlertHistory(ctx, rule, getRuleResources(rule).AlertsStream); err != nil {
+			return nil, s.componentRetryFailed(ctx, rule, models.RulePhaseAlertHistory, err)
+		}
+	}
+
+	rule.FailedComponents = slices.DeleteFunc(rule.FailedComponents, func(c string) bool { return c == component })
+	if len(rule.FailedComponents) == 0 {
+		rule.Status = models.RuleStatusRunning
+		rule.FailedComponents = nil
+		rule.LastError = ""
+	}
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return nil, fmt.Errorf("failed to persist rule: %w", err)
+	}
+	logrus.Infof("Recreated %s of rule %s (%s), status %s", component, rule.Name, rule.ID, rule.Status)
+	return rule, nil
+}
+
+// componentRetryFailed records a failed retry in the rule's error history and returns the error.
+// The rule stays degraded.
+func (s *RuleService) componentRetryFailed(ctx context.Context, rule *models.Rule, phase string, err error) error {
+	recordRuleError(rule, phase, "", err.Error())
+	rule.UpdatedAt = time.Now()
+	if persistErr := s.persistRule(ctx, rule, true); persistErr != nil {
+		logrus.Errorf("Failed to record the failed retry of rule %s: %v", rule.ID, persistErr)
+	}
+	return err
+}
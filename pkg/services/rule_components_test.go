@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestMissingResourcesSkipsFailedResolve(t *testing.T) {
+	rule := &models.Rule{
+		ID:               "abc-123",
+		ResolveQuery:     "SELECT * FROM s WHERE v < 10",
+		Status:           models.RuleStatusDegraded,
+		FailedComponents: []string{models.RuleComponentResolve},
+	}
+
+	inv := &timeplusInventory{
+		streams:           map[string]bool{"rule_abc_123_view": true, timeplus.AlertAcksMutableStream: true},
+		materializedViews: map[string]bool{"rule_abc_123_mv": true},
+	}
+
+	assert.Empty(t, inv.missingResources(rule), "a degraded rule's failed resolve views aren't missing")
+}
+
+func TestRetryRuleComponent(t *testing.T) {
+	newService := func(status, components string, createErr error) (*RuleService, *MockClient) {
+		mockClient := new(MockClient)
+		mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+			{"id": "rule1", "name": "Hot devices", "status": status, "entity_id_column": "device",
+				"resolve_query": "SELECT device FROM devices WHERE temperature < 80", "failed_components": components},
+		}, nil)
+		mockClient.On("ExecuteDDL", mock.Anything, mock.MatchedBy(func(sql string) bool {
+			return strings.HasPrefix(sql, "CREATE")
+		})).Return(createErr)
+		mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(nil)
+		mockClient.On("InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		return &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}, mockClient
+	}
+
+	service, mockClient := newService("degraded", "resolve", nil)
+	rule, err := service.RetryRuleComponent(context.Background(), "rule1", models.RuleComponentResolve)
+	require.NoError(t, err)
+	assert.Equal(t, models.RuleStatusRunning, rule.Status)
+	assert.Empty(t, rule.FailedComponents)
+	mockClient.AssertCalled(t, "ExecuteDDL", mock.Anything, "DROP VIEW IF EXISTS `rule_rule1_resolve_mv`")
+
+	service, _ = newService("degraded", "resolve,alert_history", nil)
+	rule, err = service.RetryRuleComponent(context.Background(), "rule1", models.RuleComponentResolve)
+	require.NoError(t, err)
+	assert.Equal(t, models.RuleStatusDegraded, rule.Status, "the alert history is still failed")
+	assert.Equal(t, []string{models.RuleComponentAlertHistory}, rule.FailedComponents)
+
+	service, _ = newService("degraded", "resolve", errors.New("unknown column device"))
+	_, err = service.RetryRuleComponent(context.Background(), "rule1", models.RuleComponentResolve)
+	require.Error(t, err)
+
+	service, _ = newService("running", "", nil)
+	_, err = service.RetryRuleComponent(context.Background(), "rule1", models.RuleComponentResolve)
+	assert.ErrorIs(t, err, ErrRuleComponentHealthy)
+
+	_, err = service.RetryRuleComponent(context.Background(), "rule1", "plain_view")
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
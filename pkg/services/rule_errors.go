@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// RuleErrors is a rule's current error and its recent failures
+type RuleErrors struct {
+	RuleID    string             `json:"ruleId"`
+	Status    string             `json:"status"`
+	LastError *models.RuleError  `json:"lastError,omitempty"` // The failure behind the rule's current error, if it has one
+	Errors    []models.RuleError `json:"errors"`              // Newest first
+}
+
+// recordRuleError sets a rule's last error and appends the failure to its error history, dropping
+// the oldest entries beyond MaxRuleErrorHistory. The history is persisted with the rule.
+func recordRuleError(rule *models.Rule, phase, sql, message string) {
+	rule.LastError = message
+	rule.ErrorHistory = append(rule.ErrorHistory, models.RuleError{
+		At:      time.Now().UTC(),
+		Phase:   phase,
+		Message: message,
+		SQL:     sql,
+	})
+	if excess := len(rule.ErrorHistory) - models.MaxRuleErrorHistory; excess > 0 {
+		rule.ErrorHistory = append([]models.RuleError(nil), rule.ErrorHistory[excess:]...)
+	}
+}
+
+// GetRuleErrors returns a rule's recent failures, at most limit of them, newest first
+func (s *RuleService) GetRuleErrors(ctx context.Context, ruleID string, limit int) (*RuleErrors, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RuleErrors{RuleID: rule.ID, Status: string(rule.Status), Errors: []models.RuleError{}}
+	for i := len(rule.ErrorHistory) - 1; i >= 0; i-- {
+		if limit > 0 && len(result.Errors) == limit {
+			break
+		}
+		result.Errors = append(result.Errors, rule.ErrorHistory[i])
+	}
+
+	// Progress messages such as "Rebuilding" are set as the last error without being failures
+	if n := len(rule.ErrorHistory); n > 0 && rule.LastError != "" && rule.ErrorHistory[n-1].Message == rule.LastError {
+		last := rule.ErrorHistory[n-1]
+		result.LastError = &last
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestRecordRuleError(t *testing.T) {
+	rule := &models.Rule{ID: "rule1"}
+	for i := 0; i < models.MaxRuleErrorHistory+5; i++ {
+		recordRuleError(rule, models.RulePhasePlainView, "CREATE VIEW v AS SELECT 1", fmt.Sprintf("failure %d", i))
+	}
+
+	require.Len(t, rule.ErrorHistory, models.MaxRuleErrorHistory)
+	assert.Equal(t, "failure 5", rule.ErrorHistory[0].Message, "the oldest failures are dropped")
+	assert.Equal(t, fmt.Sprintf("failure %d", models.MaxRuleErrorHistory+4), rule.LastError)
+	assert.Equal(t, models.RulePhasePlainView, rule.ErrorHistory[0].Phase)
+	assert.Equal(t, "CREATE VIEW v AS SELECT 1", rule.ErrorHistory[0].SQL)
+}
+
+func TestGetRuleErrors(t *testing.T) {
+	history, err := json.Marshal([]models.RuleError{
+		{Phase: models.RulePhasePlainView, Message: "first"},
+		{Phase: models.RulePhaseMaterializedView, Message: "second", SQL: "CREATE MATERIALIZED VIEW mv"},
+		{Phase: models.RulePhaseThrottle, Message: "third"},
+	})
+	require.NoError(t, err)
+
+	newService := func(lastError string) *RuleService {
+		mockClient := new(MockClient)
+		mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+			{"id": "rule1", "name": "Hot devices", "status": "failed", "last_error": lastError, "error_history": string(history)},
+		}, nil)
+		return &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	}
+
+	ruleErrors, err := newService("third").GetRuleErrors(context.Background(), "rule1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", ruleErrors.Status)
+	require.Len(t, ruleErrors.Errors, 2)
+	assert.Equal(t, "third", ruleErrors.Errors[0].Message, "newest first")
+	assert.Equal(t, "CREATE MATERIALIZED VIEW mv", ruleErrors.Errors[1].SQL)
+	require.NotNil(t, ruleErrors.LastError)
+	assert.Equal(t, models.RulePhaseThrottle, ruleErrors.LastError.Phase)
+
+	ruleErrors, err = newService("Rebuilding").GetRuleErrors(context.Background(), "rule1", 0)
+	require.NoError(t, err)
+	assert.Len(t, ruleErrors.Errors, 3)
+	assert.Nil(t, ruleErrors.LastError, "progress messages aren't failures")
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// Kinds of the nodes of a rule graph
+const (
+	GraphNodeRule         = "rule"
+	GraphNodeStream       = "stream"        // A stream or view rules read from
+	GraphNodeAckStream    = "ack_stream"    // An alert acks stream rules write their alerts to
+	GraphNodeResultStream = "result_stream" // The stream a shadow rule records its would-be alerts in
+	GraphNodeRoute        = "route"         // A notifier, and the channel it routes a rule's alerts to
+)
+
+// Kinds of the edges of a rule graph, all leading from a rule
+const (
+	GraphEdgeReads     = "reads"      // The rule's query reads from the stream
+	GraphEdgeLooksUp   = "looks_up"   // The rule enriches its alerts from the stream
+	GraphEdgeWrites    = "writes"     // The rule writes its alerts to the stream
+	GraphEdgeDependsOn = "depends_on" // The rule is suppressed while the other rule is active
+	GraphEdgeNotifies  = "notifies"   // The rule's alerts are delivered through the route
+)
+
+// RuleGraphNode is a rule or something rules read from, write to or notify through
+type RuleGraphNode struct {
+	ID        string `json:"id"` // Kind and name, e.g. "stream:sensors", or the rule ID for rules
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Status    string `json:"status,omitempty"`    // Status of a rule
+	Exists    *bool  `json:"exists,omitempty"`    // Whether a stream exists in Timeplus
+	Dedicated bool   `json:"dedicated,omitempty"` // An alert acks stream owned by a single rule
+	Channel   string `json:"channel,omitempty"`   // Channel of a route, empty for the notifier's only destination
+}
+
+// RuleGraphEdge relates a rule to another node
+type RuleGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// RuleGraphImpact lists what dropping a stream would affect
+type RuleGraphImpact struct {
+	Stream     string   `json:"stream"`
+	Rules      []string `json:"rules"`      // Rules reading, looking up or writing to the stream
+	Dependents []string `json:"dependents"` // Rules depending on an affected rule, directly or not
+	Routes     []string `json:"routes"`     // Routes the affected rules notify through
+}
+
+// RuleGraph describes how rules relate to the streams they read and write and the routes their
+// alerts are delivered through
+type RuleGraph struct {
+	Nodes       []RuleGraphNode  `json:"nodes"`
+	Edges       []RuleGraphEdge  `json:"edges"`
+	Impact      *RuleGraphImpact `json:"impact,omitempty"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+}
+
+// GetRuleGraph returns the graph of every rule. Query rules don't name the streams they read, so
+// they are related to each stream Timeplus holds that their queries mention, other than their own
+// objects. Routes are those a firing of the rule would be delivered through now.
+func (s *RuleService) GetRuleGraph(ctx context.Context) (*RuleGraph, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.loadTimeplusInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := &ruleGraphBuilder{nodes: map[string]*RuleGraphNode{}, edges: map[RuleGraphEdge]bool{}}
+	for _, rule := range rules {
+		ruleNode := builder.node(GraphNodeRule, rule.ID, func(node *RuleGraphNode) {
+			node.Name = rule.Name
+			node.Status = string(rule.Status)
+		})
+		res := getRuleResources(rule)
+		own := map[string]bool{res.PlainView: true, res.MaterializedView: true, res.ResolveView: true,
+			res.ResolveMaterialized: true, res.AlertAcksStream: true, res.ResultStream: true,
+			res.AlertHistoryStream: true, res.AlertHistoryMV: true}
+
+		for _, stream := range ruleSourceStreams(rule, inv, own) {
+			builder.edge(ruleNode, builder.stream(GraphNodeStream, stream, inv), GraphEdgeReads)
+		}
+		for _, lookup := range rule.Lookups {
+			builder.edge(ruleNode, builder.stream(GraphNodeStream, lookup.Stream, inv), GraphEdgeLooksUp)
+		}
+
+		if rule.Shadow {
+			builder.edge(ruleNode, builder.stream(GraphNodeResultStream, res.ResultStream, inv), GraphEdgeWrites)
+		} else {
+			ackStream := builder.stream(GraphNodeAckStream, res.AlertAcksStream, inv)
+			builder.nodes[ackStream].Dedicated = res.DedicatedAcksStream
+			builder.edge(ruleNode, ackStream, GraphEdgeWrites)
+		}
+
+		for _, dependency := range rule.DependsOn {
+			builder.edge(ruleNode, builder.node(GraphNodeRule, dependency.RuleID, nil), GraphEdgeDependsOn)
+		}
+
+		// Shadow rules never notify
+		if s.dispatcher != nil && !rule.Shadow {
+			for _, route := range s.dispatcher.Routes(s.routingEvent(rule)) {
+				name := route.Notifier
+				if route.Channel != "" {
+					name += " " + route.Channel
+				}
+				routeNode := builder.node(GraphNodeRoute, name, func(node *RuleGraphNode) {
+					node.Name = route.Notifier
+					node.Channel = route.Channel
+				})
+				builder.edge(ruleNode, routeNode, GraphEdgeNotifies)
+			}
+		}
+	}
+	return builder.graph(), nil
+}
+
+// routingEvent returns the event a firing of a rule would be notified with, for routing
+func (s *RuleService) routingEvent(rule *models.Rule) notify.Event {
+	alert := &models.Alert{RuleID: rule.ID}
+	setAlertRuleDetails(alert, rule)
+	s.setAlertOnCall(alert, s.withGroupDefaults(rule))
+	return notify.NewEvent(notify.EventFired, alert)
+}
+
+// ruleSourceStreams returns the streams a rule reads from, sorted: the source stream of a generated
+// rule type, or the streams in Timeplus a query rule's queries mention, leaving out the rule's own
+func ruleSourceStreams(rule *models.Rule, inv *timeplusInventory, own map[string]bool) []string {
+	if stream := ruleSpecSourceStream(rule); stream != "" {
+		return []string{stream}
+	}
+	var streams []string
+	for stream := range inv.streams {
+		if own[stream] {
+			continue
+		}
+		if queryReadsFrom(rule.Query, stream) || (rule.ResolveQuery != "" && queryReadsFrom(rule.ResolveQuery, stream)) {
+			streams = append(streams, stream)
+		}
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// ImpactOf returns the rules and routes affected by dropping a stream: the rules reading, looking up
+// or writing to it, the rules depending on those, and the routes they all notify through
+func (g *RuleGraph) ImpactOf(stream string) *RuleGraphImpact {
+	impact := &RuleGraphImpact{Stream: stream, Rules: []string{}, Dependents: []string{}, Routes: []string{}}
+
+	affected := map[string]bool{}
+	dependents := map[string][]string{}
+	for _, edge := range g.Edges {
+		switch edge.Kind {
+		case GraphEdgeDependsOn:
+			dependents[edge.To] = append(dependents[edge.To], edge.From)
+		case GraphEdgeReads, GraphEdgeLooksUp, GraphEdgeWrites:
+			if graphNodeName(edge.To) == stream && !affected[edge.From] {
+				affected[edge.From] = true
+				impact.Rules = append(impact.Rules, graphNodeName(edge.From))
+			}
+		}
+	}
+
+	// Rules depending on an affected rule stop being suppressed by it
+	queue := make([]string, 0, len(affected))
+	for rule := range affected {
+		queue = append(queue, rule)
+	}
+	for len(queue) > 0 {
+		rule := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[rule] {
+			if !affected[dependent] {
+				affected[dependent] = true
+				impact.Dependents = append(impact.Dependents, graphNodeName(dependent))
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	routes := map[string]bool{}
+	for _, edge := range g.Edges {
+		if edge.Kind == GraphEdgeNotifies && affected[edge.From] && !routes[edge.To] {
+			routes[edge.To] = true
+			impact.Routes = append(impact.Routes, edge.To)
+		}
+	}
+
+	sort.Strings(impact.Rules)
+	sort.Strings(impact.Dependents)
+	sort.Strings(impact.Routes)
+	return impact
+}
+
+// ruleGraphBuilder collects the nodes and edges of a rule graph without repeating them
+type ruleGraphBuilder struct {
+	nodes map[string]*RuleGraphNode
+	edges map[RuleGraphEdge]bool
+}
+
+// node returns the ID of a node, adding it if needed. set fills in the node's details the first
+// time it is added.
+func (b *ruleGraphBuilder) node(kind, name string, set func(*RuleGraphNode)) string {
+	id := kind + ":" + name
+	node, ok := b.nodes[id]
+	if !ok {
+		node = &RuleGraphNode{ID: id, Kind: kind, Name: name}
+		b.nodes[id] = node
+	}
+	// Rules referenced by a dependency before their own turn get their details later
+	if set != nil && (!ok || node.Status == "") {
+		set(node)
+	}
+	return id
+}
+
+// stream returns the ID of a stream node, recording whether the stream exists
+func (b *ruleGraphBuilder) stream(kind, name string, inv *timeplusInventory) string {
+	return b.node(kind, name, func(node *RuleGraphNode) {
+		exists := inv.streams[name]
+		node.Exists = &exists
+	})
+}
+
+// edge relates two nodes
+func (b *ruleGraphBuilder) edge(from, to, kind string) {
+	b.edges[RuleGraphEdge{From: from, To: to, Kind: kind}] = true
+}
+
+// graph returns the nodes and edges collected, sorted so the document is stable
+func (b *ruleGraphBuilder) graph() *RuleGraph {
+	graph := &RuleGraph{
+		Nodes:       make([]RuleGraphNode, 0, len(b.nodes)),
+		Edges:       make([]RuleGraphEdge, 0, len(b.edges)),
+		GeneratedAt: time.Now(),
+	}
+	for _, node := range b.nodes {
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	for edge := range b.edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	return graph
+}
+
+// graphNodeName returns the name part of a node ID, the rule ID of rule nodes
+func graphNodeName(id string) string {
+	_, name, _ := strings.Cut(id, ":")
+	return name
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestGetRuleGraph(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Hot", "status": "running", "team": "payments",
+			"query":   "SELECT * FROM sensors WHERE temperature > 90",
+			"lookups": `[{"stream": "devices", "key": "device_id", "columns": ["site"]}]`},
+		{"id": "r2", "name": "Slow", "status": "running", "query": "SELECT * FROM `metrics` WHERE latency > 5",
+			"dedicated_alert_acks_stream": true, "alert_acks_stream_name": "rule_r2_alert_acks",
+			"depends_on": `[{"ruleId": "r1"}]`},
+		{"id": "r3", "name": "Trial", "status": "running", "shadow": true, "result_stream": "r3_results",
+			"query": "SELECT * FROM sensors_v2 WHERE temperature > 80"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"sensors", "sensors_v2", "metrics", timeplus.AlertAcksStreamFor("r1")}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{}, nil)
+
+	dispatcher := notify.NewDispatcher(10, 1, notify.NewSlackNotifier("https://hooks.slack.test", "#alerts", true, "#team-"))
+	defer dispatcher.Drain(context.Background())
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", dispatcher: dispatcher}
+
+	graph, err := service.GetRuleGraph(context.Background())
+	require.NoError(t, err)
+
+	nodes := map[string]RuleGraphNode{}
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+	assert.Equal(t, "Hot", nodes["rule:r1"].Name)
+	assert.Equal(t, "running", nodes["rule:r1"].Status)
+	assert.True(t, *nodes["stream:sensors"].Exists)
+	assert.False(t, *nodes["stream:devices"].Exists)
+	assert.True(t, nodes["ack_stream:rule_r2_alert_acks"].Dedicated)
+	assert.False(t, nodes["ack_stream:"+timeplus.AlertAcksStreamFor("r1")].Dedicated)
+	assert.Equal(t, RuleGraphNode{ID: "route:slack #team-payments", Kind: GraphNodeRoute, Name: "slack", Channel: "#team-payments"},
+		nodes["route:slack #team-payments"])
+
+	assert.Equal(t, []RuleGraphEdge{
+		{From: "rule:r1", To: "ack_stream:" + timeplus.AlertAcksStreamFor("r1"), Kind: GraphEdgeWrites},
+		{From: "rule:r1", To: "route:slack #team-payments", Kind: GraphEdgeNotifies},
+		{From: "rule:r1", To: "stream:devices", Kind: GraphEdgeLooksUp},
+		{From: "rule:r1", To: "stream:sensors", Kind: GraphEdgeReads},
+		{From: "rule:r2", To: "ack_stream:rule_r2_alert_acks", Kind: GraphEdgeWrites},
+		{From: "rule:r2", To: "route:slack #alerts", Kind: GraphEdgeNotifies},
+		{From: "rule:r2", To: "rule:r1", Kind: GraphEdgeDependsOn},
+		{From: "rule:r2", To: "stream:metrics", Kind: GraphEdgeReads},
+		// Shadow rules write to their result stream and notify nobody
+		{From: "rule:r3", To: "result_stream:r3_results", Kind: GraphEdgeWrites},
+		{From: "rule:r3", To: "stream:sensors_v2", Kind: GraphEdgeReads},
+	}, graph.Edges)
+
+	// Dropping sensors stops r1, which no longer suppresses r2
+	assert.Equal(t, &RuleGraphImpact{
+		Stream:     "sensors",
+		Rules:      []string{"r1"},
+		Dependents: []string{"r2"},
+		Routes:     []string{"route:slack #alerts", "route:slack #team-payments"},
+	}, graph.ImpactOf("sensors"))
+	assert.Equal(t, &RuleGraphImpact{Stream: "unused", Rules: []string{}, Dependents: []string{}, Routes: []string{}},
+		graph.ImpactOf("unused"))
+}
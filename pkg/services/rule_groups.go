@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ruleGroupWorkers is the number of rules of a group started or stopped at once. Starting a rule
+// takes a few seconds, so groups of hundreds of rules are worked through in parallel.
+const ruleGroupWorkers = 8
+
+var (
+	// ErrRuleGroupNotFound is returned when no rule group has the given name
+	ErrRuleGroupNotFound = errors.New("rule group not found")
+	// ErrRuleGroupExists is returned when creating a rule group whose name is taken
+	ErrRuleGroupExists = errors.New("rule group already exists")
+	// ErrInvalidRuleGroup is returned for rule groups without a name, with a malformed folder or
+	// referencing missing notification settings
+	ErrInvalidRuleGroup = errors.New("invalid rule group")
+	// ErrRuleGroupInUse is returned when deleting a rule group that still has rules
+	ErrRuleGroupInUse = errors.New("rule group still has rules")
+)
+
+// RuleGroupStore keeps rule groups in memory, backed by a mutable stream so they survive restarts
+type RuleGroupStore struct {
+	tpClient timeplus.StreamStore
+	mu       sync.RWMutex
+	groups   map[string]*models.RuleGroup
+}
+
+// NewRuleGroupStore ensures the rule groups stream exists and loads the stored groups
+func NewRuleGroupStore(ctx context.Context, tpClient timeplus.StreamStore) (*RuleGroupStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.RuleGroupsStream,
+		timeplus.GetRuleGroupsSchema(), []string{"name"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure rule groups stream: %w", err)
+	}
+
+	store := &RuleGroupStore{tpClient: tpClient, groups: make(map[string]*models.RuleGroup)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, description, folder, notification_template, oncall_schedule, created_at, updated_at FROM table(%s) WHERE active = true",
+		timeplus.RuleGroupsStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rule groups: %w", err)
+	}
+	for _, row := range rows {
+		group := &models.RuleGroup{
+			Name:                 getString(row, "name"),
+			Description:          getString(row, "description"),
+			Folder:               getString(row, "folder"),
+			NotificationTemplate: getString(row, "notification_template"),
+			OnCallSchedule:       getString(row, "oncall_schedule"),
+			CreatedAt:            getTime(row, "created_at"),
+			UpdatedAt:            getTime(row, "updated_at"),
+		}
+		store.groups[group.Name] = group
+	}
+
+	logrus.Infof("Loaded %d rule group(s)", len(store.groups))
+	return store, nil
+}
+
+// List returns all rule groups sorted by folder and name
+func (st *RuleGroupStore) List() []*models.RuleGroup {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	groups := make([]*models.RuleGroup, 0, len(st.groups))
+	for _, group := range st.groups {
+		copied := *group
+		groups = append(groups, &copied)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Folder != groups[j].Folder {
+			return groups[i].Folder < groups[j].Folder
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// Get returns the rule group with the given name
+func (st *RuleGroupStore) Get(name string) (*models.RuleGroup, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	group, ok := st.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	copied := *group
+	return &copied, nil
+}
+
+// Create stores a new rule group
+func (st *RuleGroupStore) Create(ctx context.Context, group *models.RuleGroup) (*models.RuleGroup, error) {
+	now := time.Now()
+	stored := &models.RuleGroup{
+		Name:                 strings.TrimSpace(group.Name),
+		Description:          group.Description,
+		Folder:               group.Folder,
+		NotificationTemplate: group.NotificationTemplate,
+		OnCallSchedule:       group.OnCallSchedule,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	if err := validateRuleGroup(stored); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.groups[stored.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupExists, stored.Name)
+	}
+	if err := st.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	st.groups[stored.Name] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Update replaces the folder, description and notification defaults of an existing rule group
+func (st *RuleGroupStore) Update(ctx context.Context, name string, group *models.RuleGroup) (*models.RuleGroup, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+
+	updated := &models.RuleGroup{
+		Name:                 name,
+		Description:          group.Description,
+		Folder:               group.Folder,
+		NotificationTemplate: group.NotificationTemplate,
+		OnCallSchedule:       group.OnCallSchedule,
+		CreatedAt:            existing.CreatedAt,
+		UpdatedAt:            time.Now(),
+	}
+	if err := validateRuleGroup(updated); err != nil {
+		return nil, err
+	}
+	if err := st.persist(ctx, updated, true); err != nil {
+		return nil, err
+	}
+	st.groups[name] = updated
+
+	copied := *updated
+	return &copied, nil
+}
+
+// Delete removes a rule group
+func (st *RuleGroupStore) Delete(ctx context.Context, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, ok := st.groups[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+
+	deleted := *existing
+	deleted.UpdatedAt = time.Now()
+	if err := st.persist(ctx, &deleted, false); err != nil {
+		return err
+	}
+	delete(st.groups, name)
+	return nil
+}
+
+// persist writes a rule group to the rule groups stream
+func (st *RuleGroupStore) persist(ctx context.Context, group *models.RuleGroup, active bool) error {
+	columns := []string{"name", "description", "folder", "notification_template", "oncall_schedule", "created_at", "updated_at", "active"}
+	values := []interface{}{group.Name, group.Description, group.Folder, group.NotificationTemplate, group.OnCallSchedule,
+		group.CreatedAt, group.UpdatedAt, active}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.RuleGroupsStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist rule group %s: %w", group.Name, err)
+	}
+	return nil
+}
+
+// validateRuleGroup checks that a group has a name and a folder path without empty segments. Leading
+// and trailing slashes of the folder are dropped.
+func validateRuleGroup(group *models.RuleGroup) error {
+	if group.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRuleGroup)
+	}
+	if strings.Contains(group.Name, "/") {
+		return fmt.Errorf("%w: name must not contain '/', use folder to nest groups", ErrInvalidRuleGroup)
+	}
+	group.Folder = strings.Trim(strings.TrimSpace(group.Folder), "/")
+	if group.Folder == "" {
+		return nil
+	}
+	for _, segment := range strings.Split(group.Folder, "/") {
+		if strings.TrimSpace(segment) == "" {
+			return fmt.Errorf("%w: folder %q has an empty segment", ErrInvalidRuleGroup, group.Folder)
+		}
+	}
+	return nil
+}
+
+// inFolder reports whether a group's folder is the given folder or one of its subfolders
+func inFolder(groupFolder, folder string) bool {
+	folder = strings.Trim(folder, "/")
+	return groupFolder == folder || strings.HasPrefix(groupFolder, folder+"/")
+}
+
+// RuleGroups returns the rule group store, nil when it isn't available
+func (s *RuleService) RuleGroups() *RuleGroupStore {
+	return s.ruleGroups
+}
+
+// ListRuleGroups returns all rule groups with the number of rules in each, optionally only those
+// in a folder and its subfolders
+func (s *RuleService) ListRuleGroups(ctx context.Context, folder string) ([]*models.RuleGroup, error) {
+	if s.ruleGroups == nil {
+		return nil, fmt.Errorf("%w: rule groups are not available", ErrInvalidRuleGroup)
+	}
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, rule := range rules {
+		if rule.Group != "" {
+			counts[rule.Group]++
+		}
+	}
+
+	groups := s.ruleGroups.List()
+	filtered := groups[:0]
+	for _, group := range groups {
+		if folder != "" && !inFolder(group.Folder, folder) {
+			continue
+		}
+		group.RuleCount = counts[group.Name]
+		filtered = append(filtered, group)
+	}
+	return filtered, nil
+}
+
+// GetRuleGroup returns a rule group with the number of rules in it
+func (s *RuleService) GetRuleGroup(ctx context.Context, name string) (*models.RuleGroup, error) {
+	if s.ruleGroups == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	group, err := s.ruleGroups.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.RuleGroupRules(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	group.RuleCount = len(rules)
+	return group, nil
+}
+
+// CreateRuleGroup creates a rule group after checking its notification defaults exist
+func (s *RuleService) CreateRuleGroup(ctx context.Context, group *models.RuleGroup) (*models.RuleGroup, error) {
+	if s.ruleGroups == nil {
+		return nil, fmt.Errorf("%w: rule groups are not available", ErrInvalidRuleGroup)
+	}
+	if err := s.validateRuleGroupDefaults(group); err != nil {
+		return nil, err
+	}
+	return s.ruleGroups.Create(ctx, group)
+}
+
+// UpdateRuleGroup updates a rule group after checking its notification defaults exist
+func (s *RuleService) UpdateRuleGroup(ctx context.Context, name string, group *models.RuleGroup) (*models.RuleGroup, error) {
+	if s.ruleGroups == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	if err := s.validateRuleGroupDefaults(group); err != nil {
+		return nil, err
+	}
+	return s.ruleGroups.Update(ctx, name, group)
+}
+
+// DeleteRuleGroup deletes a rule group that no rule is filed under anymore
+func (s *RuleService) DeleteRuleGroup(ctx context.Context, name string) error {
+	if s.ruleGroups == nil {
+		return fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	if _, err := s.ruleGroups.Get(name); err != nil {
+		return err
+	}
+	rules, err := s.RuleGroupRules(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		return fmt.Errorf("%w: %s has %d rule(s), move or delete them first", ErrRuleGroupInUse, name, len(rules))
+	}
+	return s.ruleGroups.Delete(ctx, name)
+}
+
+// RuleGroupRules returns the rules filed under a group
+func (s *RuleService) RuleGroupRules(ctx context.Context, name string) ([]*models.Rule, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.FilterRulesByGroup(rules, name, ""), nil
+}
+
+// FilterRulesByGroup returns the rules filed under a group and, when folder is set, under any group
+// in that folder or its subfolders
+func (s *RuleService) FilterRulesByGroup(rules []*models.Rule, group, folder string) []*models.Rule {
+	if group == "" && folder == "" {
+		return rules
+	}
+
+	var folderGroups map[string]bool
+	if folder != "" {
+		folderGroups = make(map[string]bool)
+		if s.ruleGroups != nil {
+			for _, candidate := range s.ruleGroups.List() {
+				if inFolder(candidate.Folder, folder) {
+					folderGroups[candidate.Name] = true
+				}
+			}
+		}
+	}
+
+	filtered := make([]*models.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if group != "" && rule.Group != group {
+			continue
+		}
+		if folderGroups != nil && !folderGroups[rule.Group] {
+			continue
+		}
+		filtered = append(filtered, rule)
+	}
+	return filtered
+}
+
+// StartRuleGroup starts the rules of a group that aren't running yet
+func (s *RuleService) StartRuleGroup(ctx context.Context, name string) (*models.RuleGroupOperation, error) {
+	return s.runRuleGroup(ctx, name, func(rule *models.Rule) bool {
+		return ruleEvaluating(rule)
+	}, s.StartRule)
+}
+
+// StopRuleGroup stops the running rules of a group
+func (s *RuleService) StopRuleGroup(ctx context.Context, name string) (*models.RuleGroupOperation, error) {
+	return s.runRuleGroup(ctx, name, func(rule *models.Rule) bool {
+		return !ruleEvaluating(rule)
+	}, s.StopRule)
+}
+
+// runRuleGroup applies an operation to each rule of a group not skipped, a few rules at a time. One
+// rule failing doesn't stop the others, failures are reported per rule.
+func (s *RuleService) runRuleGroup(ctx context.Context, name string, skip func(*models.Rule) bool,
+	operation func(context.Context, string) error) (*models.RuleGroupOperation, error) {
+	if s.ruleGroups == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	if _, err := s.ruleGroups.Get(name); err != nil {
+		return nil, err
+	}
+	rules, err := s.RuleGroupRules(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.RuleGroupOperation{Group: name, Succeeded: []string{}, Skipped: []string{}}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, ruleGroupWorkers)
+	)
+	for _, rule := range rules {
+		if skip(rule) {
+			result.Skipped = append(result.Skipped, rule.ID)
+			continue
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(ruleID string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			err := operation(ctx, ruleID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logrus.Warnf("Rule group %s: rule %s failed: %v", name, ruleID, err)
+				if result.Failed == nil {
+					result.Failed = make(map[string]string)
+				}
+				result.Failed[ruleID] = err.Error()
+				return
+			}
+			result.Succeeded = append(result.Succeeded, ruleID)
+		}(rule.ID)
+	}
+	wg.Wait()
+
+	sort.Strings(result.Succeeded)
+	return result, nil
+}
+
+// validateRuleGroupDefaults checks that the notification template and on-call schedule a group
+// gives its rules exist
+func (s *RuleService) validateRuleGroupDefaults(group *models.RuleGroup) error {
+	if group.NotificationTemplate != "" {
+		if s.templates == nil {
+			return fmt.Errorf("%w: notification templates are not available", ErrInvalidRuleGroup)
+		}
+		if _, err := s.templates.Get(group.NotificationTemplate); err != nil {
+			return fmt.Errorf("%w: unknown notificationTemplate %q", ErrInvalidRuleGroup, group.NotificationTemplate)
+		}
+	}
+	if group.OnCallSchedule != "" {
+		if s.onCall == nil {
+			return fmt.Errorf("%w: on-call schedules are not available", ErrInvalidRuleGroup)
+		}
+		if _, err := s.onCall.Get(group.OnCallSchedule); err != nil {
+			return fmt.Errorf("%w: unknown onCallSchedule %q", ErrInvalidRuleGroup, group.OnCallSchedule)
+		}
+	}
+	return nil
+}
+
+// validateRuleGroupName checks that the group a rule is filed under exists
+func (s *RuleService) validateRuleGroupName(rule *models.Rule) error {
+	if rule.Group == "" {
+		return nil
+	}
+	if s.ruleGroups == nil {
+		return fmt.Errorf("%w: rule groups are not available", ErrInvalidRule)
+	}
+	if _, err := s.ruleGroups.Get(rule.Group); err != nil {
+		return fmt.Errorf("%w: unknown group %q", ErrInvalidRule, rule.Group)
+	}
+	return nil
+}
+
+// withGroupDefaults returns the rule with the notification template and on-call schedule of its
+// group filled in where the rule doesn't set its own
+func (s *RuleService) withGroupDefaults(rule *models.Rule) *models.Rule {
+	if rule == nil || rule.Group == "" || s.ruleGroups == nil ||
+		(rule.NotificationTemplate != "" && rule.OnCallSchedule != "") {
+		return rule
+	}
+	group, err := s.ruleGroups.Get(rule.Group)
+	if err != nil {
+		return rule
+	}
+	withDefaults := *rule
+	if withDefaults.NotificationTemplate == "" {
+		withDefaults.NotificationTemplate = group.NotificationTemplate
+	}
+	if withDefaults.OnCallSchedule == "" {
+		withDefaults.OnCallSchedule = group.OnCallSchedule
+	}
+	return &withDefaults
+}
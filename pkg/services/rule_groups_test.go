@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestRuleGroupStoreLifecycle(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.RuleGroupsStream, mock.Anything, []string{"name"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "databases", "folder": "payments/storage"},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.RuleGroupsStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewRuleGroupStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	loaded, err := store.Get("databases")
+	require.NoError(t, err)
+	assert.Equal(t, "payments/storage", loaded.Folder)
+
+	_, err = store.Create(context.Background(), &models.RuleGroup{Name: "databases"})
+	assert.ErrorIs(t, err, ErrRuleGroupExists)
+	for name, group := range map[string]*models.RuleGroup{
+		"no name":       {Folder: "payments"},
+		"slash in name": {Name: "payments/api"},
+		"empty segment": {Name: "api", Folder: "payments//api"},
+	} {
+		_, err = store.Create(context.Background(), group)
+		assert.ErrorIs(t, err, ErrInvalidRuleGroup, name)
+	}
+
+	created, err := store.Create(context.Background(), &models.RuleGroup{Name: "api", Folder: "/payments/"})
+	require.NoError(t, err)
+	assert.Equal(t, "payments", created.Folder)
+
+	updated, err := store.Update(context.Background(), "api", &models.RuleGroup{Folder: "payments/web", Description: "Web APIs"})
+	require.NoError(t, err)
+	assert.Equal(t, "payments/web", updated.Folder)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.Equal(t, []string{"databases", "api"}, []string{store.List()[0].Name, store.List()[1].Name}, "groups are sorted by folder")
+
+	require.NoError(t, store.Delete(context.Background(), "api"))
+	_, err = store.Get("api")
+	assert.ErrorIs(t, err, ErrRuleGroupNotFound)
+
+	// The delete is persisted as an inactive row
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, false, lastInsert.Arguments.Get(3).([]interface{})[7])
+}
+
+func TestNotificationEventUsesGroupDefaults(t *testing.T) {
+	service := &RuleService{
+		onCall: &OnCallStore{schedules: map[string]*models.OnCallSchedule{
+			"payments": {Name: "payments", Users: []string{"alice"}, ShiftHours: 24},
+			"dba":      {Name: "dba", Users: []string{"bob"}, ShiftHours: 24},
+		}},
+		ruleGroups: &RuleGroupStore{groups: map[string]*models.RuleGroup{
+			"databases": {Name: "databases", OnCallSchedule: "dba"},
+		}},
+	}
+
+	event := service.notificationEvent("fired", &models.Alert{ID: "r1:db1:1"}, &models.Rule{ID: "r1", Group: "databases"})
+	assert.Equal(t, "bob", event.Alert.OnCall)
+
+	// The rule's own schedule wins over the group's
+	event = service.notificationEvent("fired", &models.Alert{ID: "r2:db1:1"}, &models.Rule{ID: "r2", Group: "databases", OnCallSchedule: "payments"})
+	assert.Equal(t, "alice", event.Alert.OnCall)
+
+	assert.ErrorIs(t, service.validateRuleGroupName(&models.Rule{Group: "gone"}), ErrInvalidRule)
+	assert.NoError(t, service.validateRuleGroupName(&models.Rule{Group: "databases"}))
+	_, err := service.CreateRuleGroup(context.Background(), &models.RuleGroup{Name: "api", OnCallSchedule: "gone"})
+	assert.ErrorIs(t, err, ErrInvalidRuleGroup)
+}
+
+func newTestRuleGroupService(rules []map[string]interface{}) (*RuleService, *MockClient) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "FROM table(tp_rules)")
+	})).Return(rules, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.RuleGroupsStream, mock.Anything, mock.Anything).Return(nil)
+
+	return &RuleService{tpClient: mockClient, ruleStream: "tp_rules", ruleGroups: &RuleGroupStore{
+		tpClient: mockClient,
+		groups: map[string]*models.RuleGroup{
+			"databases": {Name: "databases", Folder: "payments/storage"},
+			"api":       {Name: "api", Folder: "payments"},
+			"search":    {Name: "search", Folder: "paymentsearch"},
+			"empty":     {Name: "empty"},
+		},
+	}}, mockClient
+}
+
+func TestRuleGroupFilters(t *testing.T) {
+	service, _ := newTestRuleGroupService([]map[string]interface{}{
+		{"id": "db-cpu", "name": "DB CPU", "group_name": "databases", "status": "running"},
+		{"id": "db-disk", "name": "DB disk", "group_name": "databases", "status": "stopped"},
+		{"id": "api-errors", "name": "API errors", "group_name": "api", "status": "running"},
+		{"id": "search-latency", "name": "Search latency", "group_name": "search", "status": "running"},
+		{"id": "loose", "name": "Loose", "status": "running"},
+	})
+
+	rules, err := service.GetRules(context.Background())
+	require.NoError(t, err)
+	ids := func(rules []*models.Rule) []string {
+		var ids []string
+		for _, rule := range rules {
+			ids = append(ids, rule.ID)
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []string{"db-cpu", "db-disk"}, ids(service.FilterRulesByGroup(rules, "databases", "")))
+	assert.ElementsMatch(t, []string{"db-cpu", "db-disk", "api-errors"}, ids(service.FilterRulesByGroup(rules, "", "payments")),
+		"folders include their subfolders but not folders sharing a prefix")
+	assert.ElementsMatch(t, []string{"db-cpu", "db-disk"}, ids(service.FilterRulesByGroup(rules, "", "payments/storage/")))
+	assert.Len(t, service.FilterRulesByGroup(rules, "", ""), 5)
+
+	groups, err := service.ListRuleGroups(context.Background(), "payments")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "api", groups[0].Name)
+	assert.Equal(t, 1, groups[0].RuleCount)
+	assert.Equal(t, 2, groups[1].RuleCount)
+
+	// Groups with rules can't be deleted
+	assert.ErrorIs(t, service.DeleteRuleGroup(context.Background(), "databases"), ErrRuleGroupInUse)
+	require.NoError(t, service.DeleteRuleGroup(context.Background(), "empty"))
+	assert.ErrorIs(t, service.DeleteRuleGroup(context.Background(), "empty"), ErrRuleGroupNotFound)
+}
+
+func TestRuleGroupOperations(t *testing.T) {
+	service, _ := newTestRuleGroupService([]map[string]interface{}{
+		{"id": "db-cpu", "name": "DB CPU", "group_name": "databases", "status": "stopped"},
+		{"id": "db-disk", "name": "DB disk", "group_name": "databases", "status": "stopped"},
+		{"id": "db-locks", "name": "DB locks", "group_name": "databases", "status": "failed"},
+		{"id": "db-conns", "name": "DB connections", "group_name": "databases", "status": "running"},
+	})
+
+	result, err := service.runRuleGroup(context.Background(), "databases", func(rule *models.Rule) bool {
+		return rule.Status == models.RuleStatusRunning
+	}, func(ctx context.Context, ruleID string) error {
+		if ruleID == "db-locks" {
+			return errors.New("query failed")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db-cpu", "db-disk"}, result.Succeeded)
+	assert.Equal(t, []string{"db-conns"}, result.Skipped)
+	assert.Equal(t, map[string]string{"db-locks": "query failed"}, result.Failed)
+
+	// Rules that aren't running are skipped when stopping
+	result, err = service.StopRuleGroup(context.Background(), "api")
+	require.NoError(t, err)
+	assert.Empty(t, result.Succeeded)
+	_, err = service.StartRuleGroup(context.Background(), "gone")
+	assert.ErrorIs(t, err, ErrRuleGroupNotFound)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// Codes of the warnings raised by the rule linter
+const (
+	LintTableFunction            = "table_function"
+	LintMissingEntityColumn      = "missing_entity_column"
+	LintSelectStarJoin           = "select_star_join"
+	LintNondeterministicEntityID = "nondeterministic_entity_id"
+)
+
+var (
+	tableFunctionPattern = regexp.MustCompile(`(?i)(^|[^A-Za-z0-9_.])table\s*\(`)
+	selectStarPattern    = regexp.MustCompile(`(?i)\bselect\s+(distinct\s+)?\*`)
+	joinPattern          = regexp.MustCompile(`(?i)\bjoin\b`)
+	// Functions returning a different value on every call, which make a poor throttle key
+	nondeterministicPattern = regexp.MustCompile(`(?i)\b(now|now64|today|rand|rand64|rand_\w+|random\w*|generate_uuid\w*|uuid)\s*\(`)
+)
+
+// RuleValidationResult is the outcome of validating a rule without creating it
+type RuleValidationResult struct {
+	Valid    bool                    `json:"valid"`
+	Problems []RuleValidationProblem `json:"problems,omitempty"`
+	Warnings []models.RuleWarning    `json:"warnings,omitempty"`
+	Cost     *QueryCost              `json:"cost,omitempty"` // Estimated cost of the rule's queries
+}
+
+// ValidateRule runs the checks of CreateRule on a create request without creating the rule, and
+// lints it. Problems make the rule invalid, warnings don't.
+func (s *RuleService) ValidateRule(ctx context.Context, req *models.CreateRuleRequest) (*RuleValidationResult, error) {
+	rule := newRuleFromRequest(req, s.ObjectNaming())
+	result := &RuleValidationResult{Valid: true}
+
+	if err := s.validateNewRule(ctx, rule, req.SourceStream); err != nil {
+		var validationErr *RuleValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			result.Problems = validationErr.Problems
+		case errors.Is(err, ErrInvalidRule):
+			result.Problems = []RuleValidationProblem{{Message: err.Error()}}
+		default:
+			return nil, err
+		}
+		result.Valid = false
+	}
+
+	result.Warnings = s.lintRule(rule)
+	result.Cost = analyzeQueryCost(rule)
+	if result.Valid {
+		// Only a query Timeplus accepted can be planned
+		result.Cost.Pipeline = s.explainPipeline(ctx, rule)
+	}
+	return result, nil
+}
+
+// lintRule looks for patterns in a rule's queries that Timeplus accepts but that are known to break
+// the rule's materialized views or its throttling
+func (s *RuleService) lintRule(rule *models.Rule) []models.RuleWarning {
+	var warnings []models.RuleWarning
+
+	queries := map[string]string{"query": rule.Query, "resolveQuery": rule.ResolveQuery}
+	for _, field := range []string{"query", "resolveQuery"} {
+		if tableFunctionPattern.MatchString(queries[field]) {
+			warnings = append(warnings, models.RuleWarning{
+				Code:    LintTableFunction,
+				Field:   field,
+				Message: "table() reads a snapshot of the stream, a materialized view over it only sees the rows present when the rule starts",
+			})
+		}
+	}
+
+	warnings = append(warnings, s.queryCostWarnings(rule)...)
+
+	query := rule.Query
+	if query == "" {
+		return warnings
+	}
+
+	selectStar := selectStarPattern.MatchString(query)
+	if selectStar && joinPattern.MatchString(query) {
+		warnings = append(warnings, models.RuleWarning{
+			Code:    LintSelectStarJoin,
+			Field:   "query",
+			Message: "SELECT * over a join returns columns of the same name from both sides, which the rule's materialized view can't hold; list the columns instead",
+		})
+	}
+
+	explicit := cleanColumnList(strings.Split(rule.EntityIDColumns, ","))
+	candidates := explicit
+	if len(candidates) == 0 {
+		candidates = s.entityIDPriorityFor(rule)
+	}
+	if !slices.Contains(candidates, "entity_id") {
+		candidates = append([]string{"entity_id"}, candidates...)
+	}
+
+	// With SELECT * the columns depend on the source stream, which isn't known here
+	if !selectStar && !mentionsAny(ruleViewQuery(rule), candidates) {
+		field, message := "entityIdColumns", fmt.Sprintf("query selects none of the entity ID columns %s", strings.Join(explicit, ", "))
+		if len(explicit) == 0 {
+			field, message = "query", fmt.Sprintf("query selects none of the entity ID priority columns (%s), every alert will get the same entity unless another column is guessed", strings.Join(candidates, ", "))
+		}
+		warnings = append(warnings, models.RuleWarning{Code: LintMissingEntityColumn, Field: field, Message: message})
+	}
+
+	for _, column := range candidates {
+		if column == "_tp_time" || column == "_tp_sn" {
+			warnings = append(warnings, models.RuleWarning{
+				Code:    LintNondeterministicEntityID,
+				Field:   "entityIdColumns",
+				Message: fmt.Sprintf("%s changes with every event, so alerts are never throttled or acknowledged together", column),
+			})
+			continue
+		}
+		if expr := aliasedExpression(query, column); expr != "" && nondeterministicPattern.MatchString(expr) {
+			warnings = append(warnings, models.RuleWarning{
+				Code:    LintNondeterministicEntityID,
+				Field:   "query",
+				Message: fmt.Sprintf("entity ID column %s is computed with a non-deterministic function (%s), so alerts are never throttled or acknowledged together", column, strings.TrimSpace(expr)),
+			})
+		}
+	}
+
+	return warnings
+}
+
+// mentionsAny reports whether a query mentions any of the columns as a whole identifier
+func mentionsAny(query string, columns []string) bool {
+	for _, column := range columns {
+		if queryReadsFrom(query, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasedExpression returns the select expression aliased AS column in a query, or "" when the
+// column isn't an alias. The expression is found by scanning back to the enclosing comma or SELECT,
+// which is good enough for linting.
+func aliasedExpression(query, column string) string {
+	alias := regexp.MustCompile("(?i)\\s+as\\s+`?" + regexp.QuoteMeta(column) + "`?([^A-Za-z0-9_]|$)")
+	loc := alias.FindStringIndex(query)
+	if loc == nil {
+		return ""
+	}
+
+	depth := 0
+	for i := loc[0] - 1; i >= 0; i-- {
+		switch query[i] {
+		case ')':
+			depth++
+		case '(':
+			if depth == 0 {
+				return query[i+1 : loc[0]]
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return query[i+1 : loc[0]]
+			}
+		}
+		if depth == 0 && i >= 6 && strings.EqualFold(query[i-6:i], "select") {
+			return query[i:loc[0]]
+		}
+	}
+	return query[:loc[0]]
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func lintCodes(warnings []models.RuleWarning) []string {
+	var codes []string
+	for _, warning := range warnings {
+		codes = append(codes, warning.Code)
+	}
+	return codes
+}
+
+func TestLintRule(t *testing.T) {
+	service := &RuleService{}
+
+	tests := []struct {
+		name  string
+		rule  *models.Rule
+		codes []string
+	}{
+		{
+			name:  "clean query",
+			rule:  &models.Rule{Query: "SELECT device_id, temperature FROM devices WHERE temperature > 30"},
+			codes: nil,
+		},
+		{
+			name:  "table function",
+			rule:  &models.Rule{Query: "SELECT * FROM table(devices) WHERE temperature > 30"},
+			codes: []string{LintTableFunction},
+		},
+		{
+			name:  "table function in resolve query",
+			rule:  &models.Rule{Query: "SELECT * FROM devices", ResolveQuery: "SELECT * FROM table (devices)"},
+			codes: []string{LintTableFunction},
+		},
+		{
+			name:  "missing entity column",
+			rule:  &models.Rule{Query: "SELECT temperature FROM devices WHERE temperature > 30"},
+			codes: []string{LintMissingEntityColumn},
+		},
+		{
+			name:  "missing explicit entity column",
+			rule:  &models.Rule{Query: "SELECT device_id, temperature FROM devices", EntityIDColumns: "serial"},
+			codes: []string{LintMissingEntityColumn},
+		},
+		{
+			name:  "select star over join",
+			rule:  &models.Rule{Query: "SELECT * FROM devices JOIN sites ON devices.site_id = sites.id"},
+			codes: []string{LintSelectStarJoin},
+		},
+		{
+			name:  "random entity id",
+			rule:  &models.Rule{Query: "SELECT to_string(rand()) AS entity_id, temperature FROM devices"},
+			codes: []string{LintNondeterministicEntityID},
+		},
+		{
+			name:  "time based entity id",
+			rule:  &models.Rule{Query: "SELECT temperature, concat(host, to_string(now())) AS host FROM devices"},
+			codes: []string{LintNondeterministicEntityID},
+		},
+		{
+			name:  "event time as entity id",
+			rule:  &models.Rule{Query: "SELECT _tp_time, temperature FROM devices", EntityIDColumns: "_tp_time"},
+			codes: []string{LintNondeterministicEntityID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.codes, lintCodes(service.lintRule(tt.rule)))
+		})
+	}
+}
+
+func TestLintRuleFindsEntityColumnInLookups(t *testing.T) {
+	rule := &models.Rule{
+		Query:   "SELECT site_id, temperature FROM devices",
+		Lookups: []models.RuleLookup{{Stream: "sites", Key: "site_id", Columns: []string{"host"}}},
+	}
+	assert.Empty(t, (&RuleService{}).lintRule(rule))
+}
+
+func TestAliasedExpression(t *testing.T) {
+	query := "SELECT concat(a, b) AS entity_id, now() AS ts FROM devices"
+	assert.Equal(t, " concat(a, b)", aliasedExpression(query, "entity_id"))
+	assert.Equal(t, " now()", aliasedExpression(query, "ts"))
+	assert.Equal(t, "", aliasedExpression(query, "device_id"))
+}
+
+func TestValidateRuleReturnsProblemsAndWarnings(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "devices").Return(false, nil)
+
+	service := &RuleService{tpClient: mockClient}
+	result, err := service.ValidateRule(context.Background(), &models.CreateRuleRequest{
+		Name:         "hot devices",
+		Query:        "SELECT * FROM table(devices)",
+		SourceStream: "devices",
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []RuleValidationProblem{{Field: "sourceStream", Message: "stream devices does not exist"}}, result.Problems)
+	assert.Equal(t, []string{LintTableFunction}, lintCodes(result.Warnings))
+}
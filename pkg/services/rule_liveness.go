@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultLivenessMaxIdle is how recently a rule must have processed data to be live when no
+// threshold is given
+const DefaultLivenessMaxIdle = 5 * time.Minute
+
+// Liveness states of a rule
+const (
+	LivenessLive    = "live"    // The rule's view has processed data recently
+	LivenessIdle    = "idle"    // The rule's views exist but nothing flowed through them recently
+	LivenessDead    = "dead"    // The rule is running but views it needs are missing
+	LivenessStopped = "stopped" // The rule isn't running, so it has no views
+)
+
+// RuleLiveness reports whether a running rule's materialized view is processing data
+type RuleLiveness struct {
+	RuleID         string     `json:"ruleId"`
+	RuleName       string     `json:"ruleName"`
+	Status         string     `json:"status"`
+	State          string     `json:"state"`
+	Live           bool       `json:"live"`
+	Reason         string     `json:"reason,omitempty"`
+	MaxIdleSeconds int        `json:"maxIdleSeconds"`
+	Missing        []string   `json:"missing,omitempty"`     // Views and streams the running rule needs that don't exist
+	LastInputAt    *time.Time `json:"lastInputAt,omitempty"` // Latest event the rule's view saw, query rules only
+	LastEmitAt     *time.Time `json:"lastEmitAt,omitempty"`  // Latest alert the rule's materialized view wrote
+	LastError      string     `json:"lastError,omitempty"`
+	CheckedAt      time.Time  `json:"checkedAt"`
+}
+
+// GetRuleLiveness checks whether a rule has processed data within maxIdle. The rule's views must
+// exist in Timeplus' system tables, and either its view must have seen events or its materialized
+// view must have written alerts within maxIdle. Aggregate views emit rows without _tp_time, so only
+// emitted alerts count for other rule types.
+func (s *RuleService) GetRuleLiveness(ctx context.Context, ruleID string, maxIdle time.Duration) (*RuleLiveness, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if maxIdle <= 0 {
+		maxIdle = DefaultLivenessMaxIdle
+	}
+
+	liveness := &RuleLiveness{
+		RuleID:         rule.ID,
+		RuleName:       rule.Name,
+		Status:         string(rule.Status),
+		MaxIdleSeconds: int(maxIdle.Seconds()),
+		LastError:      rule.LastError,
+		CheckedAt:      time.Now(),
+	}
+	if !ruleEvaluating(rule) {
+		liveness.State = LivenessStopped
+		liveness.Reason = fmt.Sprintf("rule is %s", rule.Status)
+		return liveness, nil
+	}
+
+	inv, err := s.loadTimeplusInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if liveness.Missing = inv.missingResources(rule); len(liveness.Missing) > 0 {
+		liveness.State = LivenessDead
+		liveness.Reason = fmt.Sprintf("missing %s", strings.Join(liveness.Missing, ", "))
+		return liveness, nil
+	}
+
+	res := getRuleResources(rule)
+	if ruleViewSupportsHistory(rule) {
+		query := fmt.Sprintf("SELECT count() AS events, max(_tp_time) AS last_event FROM table(`%s`) WHERE _tp_time >= now() - INTERVAL %d SECOND",
+			res.PlainView, liveness.MaxIdleSeconds)
+		if liveness.LastInputAt, err = s.latestTime(ctx, query, "events", "last_event"); err != nil {
+			return nil, fmt.Errorf("failed to read the latest event of the rule view: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT count() AS alerts, max(_tp_time) AS last_emit FROM table(`%s`) WHERE rule_id = '%s'",
+		res.AlertsStream, strings.ReplaceAll(rule.ID, "'", "''"))
+	if liveness.LastEmitAt, err = s.latestTime(ctx, query, "alerts", "last_emit"); err != nil {
+		return nil, fmt.Errorf("failed to read the latest alert of the rule: %w", err)
+	}
+
+	since := liveness.CheckedAt.Add(-maxIdle)
+	switch {
+	case liveness.LastInputAt != nil && liveness.LastInputAt.After(since):
+		liveness.State, liveness.Live = LivenessLive, true
+	case liveness.LastEmitAt != nil && liveness.LastEmitAt.After(since):
+		liveness.State, liveness.Live = LivenessLive, true
+	default:
+		liveness.State = LivenessIdle
+		liveness.Reason = fmt.Sprintf("no data processed in the last %s", maxIdle)
+	}
+	return liveness, nil
+}
+
+// latestTime runs a query returning a row count and a latest time, nil when no rows matched
+func (s *RuleService) latestTime(ctx context.Context, query, countColumn, timeColumn string) (*time.Time, error) {
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || getInt64(rows[0], countColumn) == 0 {
+		return nil, nil
+	}
+	latest := getTime(rows[0], timeColumn)
+	if latest.IsZero() {
+		return nil, nil
+	}
+	return &latest, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestGetRuleLiveness(t *testing.T) {
+	newService := func(lastInput, lastEmit time.Time, mvs []string) *RuleService {
+		mockClient := new(MockClient)
+		mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+			return strings.Contains(q, "FROM table(`rule_rule1_view`)")
+		})).Return([]map[string]interface{}{{"events": uint64(1), "last_event": lastInput}}, nil)
+		mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(q string) bool {
+			return strings.Contains(q, "last_emit")
+		})).Return([]map[string]interface{}{{"alerts": uint64(1), "last_emit": lastEmit}}, nil)
+		mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+			{"id": "rule1", "name": "Hot devices", "status": "running"},
+		}, nil)
+		mockClient.On("ListStreams", mock.Anything).Return([]string{
+			"rule_rule1_view", "rule_rule1_alert_history", timeplus.AlertAcksMutableStream,
+		}, nil)
+		mockClient.On("ListMaterializedViews", mock.Anything).Return(mvs, nil)
+		return &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	}
+	now := time.Now().UTC()
+
+	t.Run("input", func(t *testing.T) {
+		service := newService(now.Add(-time.Minute), now.Add(-time.Hour), []string{"rule_rule1_mv"})
+		liveness, err := service.GetRuleLiveness(context.Background(), "rule1", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, LivenessLive, liveness.State)
+		assert.True(t, liveness.Live)
+		require.NotNil(t, liveness.LastInputAt)
+		require.NotNil(t, liveness.LastEmitAt)
+	})
+
+	t.Run("emitted", func(t *testing.T) {
+		service := newService(time.Time{}, now.Add(-time.Minute), []string{"rule_rule1_mv"})
+		liveness, err := service.GetRuleLiveness(context.Background(), "rule1", 5*time.Minute)
+		require.NoError(t, err)
+		assert.True(t, liveness.Live)
+		assert.Nil(t, liveness.LastInputAt)
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		service := newService(now.Add(-time.Hour), now.Add(-time.Hour), []string{"rule_rule1_mv"})
+		liveness, err := service.GetRuleLiveness(context.Background(), "rule1", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, LivenessIdle, liveness.State)
+		assert.False(t, liveness.Live)
+		assert.Equal(t, 300, liveness.MaxIdleSeconds)
+	})
+
+	t.Run("missing materialized view", func(t *testing.T) {
+		service := newService(now, now, nil)
+		liveness, err := service.GetRuleLiveness(context.Background(), "rule1", 0)
+		require.NoError(t, err)
+		assert.Equal(t, LivenessDead, liveness.State)
+		assert.False(t, liveness.Live)
+		assert.Equal(t, []string{"rule_rule1_mv"}, liveness.Missing)
+		assert.Equal(t, int(DefaultLivenessMaxIdle.Seconds()), liveness.MaxIdleSeconds)
+	})
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// RebuildRule drops every view a rule owns and recreates them from the stored rule definition by
+// starting the rule, whatever state it was in. Alert state is kept unless resetAlerts is set, which
+// also drops the rule's dedicated alert acks stream and its alert history stream. The shared alert
+// acks stream is never dropped.
+func (s *RuleService) RebuildRule(ctx context.Context, ruleID string, resetAlerts bool) (*RuleArtifacts, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("REBUILD_RULE: Rebuilding rule %s (%s), status %s, resetAlerts=%t", rule.Name, rule.ID, rule.Status, resetAlerts)
+
+	// Stop consuming the rule's alerts before its streams go away
+	s.monitorRuleStopped(rule.ID)
+
+	for _, drop := range ruleDropStatements(rule, resetAlerts) {
+		if err := s.tpClient.ExecuteDDL(ctx, drop); err != nil {
+			return nil, fmt.Errorf("failed to drop resources of rule %s: %w", rule.ID, err)
+		}
+	}
+
+	// Move the rule out of the running state so StartRule recreates its views
+	rule.Status = models.RuleStatusStarting
+	rule.LastError = "Rebuilding"
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return nil, fmt.Errorf("failed to update rule before rebuilding: %w", err)
+	}
+
+	if err := s.StartRule(ctx, rule.ID); err != nil {
+		return nil, fmt.Errorf("failed to recreate resources of rule %s: %w", rule.ID, err)
+	}
+
+	logrus.Infof("REBUILD_RULE: Rebuilt rule %s (%s)", rule.Name, rule.ID)
+	return s.GetRuleArtifacts(ctx, rule.ID)
+}
+
+// ruleDropStatements returns the statements dropping a rule's views, materialized views first so
+// nothing reads from the views while they are dropped, and with resetAlerts the rule's own streams
+func ruleDropStatements(rule *models.Rule, resetAlerts bool) []string {
+	res := getRuleResources(rule)
+
+	drops := []string{
+		fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.MaterializedView),
+		fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.AlertHistoryMV),
+	}
+	if res.ResolveView != "" {
+		drops = append(drops,
+			fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.ResolveMaterialized),
+			fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.ResolveView),
+		)
+	}
+	drops = append(drops, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.PlainView))
+	if resetAlerts {
+		if res.DedicatedAcksStream {
+			drops = append(drops, fmt.Sprintf("DROP STREAM IF EXISTS `%s`", res.AlertAcksStream))
+		}
+		drops = append(drops, fmt.Sprintf("DROP STREAM IF EXISTS `%s`", res.AlertHistoryStream))
+	}
+
+	return drops
+}
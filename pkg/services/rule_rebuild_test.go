@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestRuleDropStatements(t *testing.T) {
+	dedicated := true
+	rule := &models.Rule{
+		ID:                       "abc-123",
+		ResolveQuery:             "SELECT * FROM s WHERE v < 10",
+		DedicatedAlertAcksStream: &dedicated,
+	}
+
+	assert.Equal(t, []string{
+		"DROP VIEW IF EXISTS `rule_abc_123_mv`",
+		"DROP VIEW IF EXISTS `rule_abc_123_history_mv`",
+		"DROP VIEW IF EXISTS `rule_abc_123_resolve_mv`",
+		"DROP VIEW IF EXISTS `rule_abc_123_resolve_view`",
+		"DROP VIEW IF EXISTS `rule_abc_123_view`",
+	}, ruleDropStatements(rule, false))
+
+	reset := ruleDropStatements(rule, true)
+	assert.Equal(t, []string{
+		"DROP STREAM IF EXISTS `rule_abc_123_alert_acks`",
+		"DROP STREAM IF EXISTS `rule_abc_123_alert_history`",
+	}, reset[len(reset)-2:])
+
+	// The shared alert acks stream is never dropped
+	shared := ruleDropStatements(&models.Rule{ID: "abc-123"}, true)
+	assert.Equal(t, "DROP STREAM IF EXISTS `rule_abc_123_alert_history`", shared[len(shared)-1])
+	assert.Len(t, shared, 4)
+}
+
+func TestRebuildRuleStopsWhenDropFails(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Hot devices", "status": "running"},
+	}, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(assert.AnError)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	_, err := service.RebuildRule(context.Background(), "rule1", false)
+	require.ErrorIs(t, err, assert.AnError)
+
+	// The rule isn't marked as rebuilding when its views couldn't be dropped
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ruleResources holds the names of the Timeplus objects generated for a rule
+type ruleResources struct {
+	PlainView           string
+	MaterializedView    string
+	ResolveView         string // Empty if the rule has no resolve query
+	ResolveMaterialized string // Empty if the rule has no resolve query
+	ResultStream        string
+	AlertAcksStream     string
+	DedicatedAcksStream bool
+	AlertsStream        string // Stream the materialized views write alerts to: the alert acks stream, or the result stream of shadow rules
+	AlertHistoryStream  string
+	AlertHistoryMV      string
+}
+
+// getRuleResources returns the names of the Timeplus objects a rule is expected to own
+func getRuleResources(rule *models.Rule) ruleResources {
+	objects := ruleObjects(rule)
+
+	res := ruleResources{
+		PlainView:        objects.View,
+		MaterializedView: objects.MaterializedView,
+		ResultStream:     rule.ResultStream,
+		AlertAcksStream:  timeplus.AlertAcksStreamFor(rule.ID),
+		// History is kept per rule so it can be dropped with the rule
+		AlertHistoryStream: objects.AlertHistoryStream,
+		AlertHistoryMV:     objects.AlertHistoryMV,
+	}
+
+	if rule.ResolveQuery != "" {
+		res.ResolveView = objects.ResolveView
+		res.ResolveMaterialized = objects.ResolveMaterializedView
+	}
+
+	if rule.AlertAcksStreamName != "" {
+		res.AlertAcksStream = rule.AlertAcksStreamName
+		res.DedicatedAcksStream = true
+	} else if rule.DedicatedAlertAcksStream != nil && *rule.DedicatedAlertAcksStream {
+		res.AlertAcksStream = objects.AlertAcksStream
+		res.DedicatedAcksStream = true
+	}
+
+	res.AlertsStream = res.AlertAcksStream
+	if rule.Shadow {
+		if res.ResultStream == "" {
+			res.ResultStream = objects.ResultStream
+		}
+		res.AlertsStream = res.ResultStream
+	}
+
+	return res
+}
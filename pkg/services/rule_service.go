@@ -3,26 +3,23 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
 	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
 )
 
-// Stream names for persistent storage
-const (
-	RuleStreamName  = "tp_rules"
-	AlertStreamName = "tp_alerts"
-)
-
 // RuleService manages the lifecycle of rules and their corresponding Timeplus resources
 type RuleService struct {
-	tpClient    timeplus.TimeplusClient
+	tpClient    timeplus.RuleStore
 	ruleStream  string
 	alertStream string
 	// Map of rule ID to cancellation function for streaming queries
@@ -31,10 +28,99 @@ type RuleService struct {
 	// Map of rule ID to cancel function for rule monitors
 	ruleMonitors     map[string]context.CancelFunc
 	ruleMonitorMutex sync.RWMutex
+	// Tracks in-flight rule starts and alert/ack writes for graceful shutdown
+	tasks *taskTracker
+	// Notification pipeline, nil when no notifiers are configured
+	dispatcher *notify.Dispatcher
+	// Records the alert monitor's notifications until they are delivered, nil when not enabled
+	outbox *NotificationOutbox
+	// Time allowed to acknowledge an alert, by severity
+	slaTargets map[string]time.Duration
+	// Stops the SLA escalation loop, nil when it isn't running
+	stopSLAEscalation context.CancelFunc
+	// Notification templates referenced by rules
+	templates *TemplateStore
+	// Inhibitions suppressing less severe alerts of an entity while a more severe one is active
+	inhibitions *InhibitionStore
+	// Devices registered for push notifications, nil unless push notifications are enabled
+	pushDevices *PushDeviceStore
+	// Named SQL snippets rule queries reference
+	sqlMacros *SQLMacroStore
+	// On-call schedules whose current user rules' notifications target
+	onCall *OnCallStore
+	// Rule groups organizing rules into folders and giving them notification defaults
+	ruleGroups *RuleGroupStore
+	// Incidents grouping correlated alerts, nil unless incidents are enabled
+	incidents *IncidentStore
+	// Latest health check and rules it recovered, guarded by healthMutex
+	healthMutex  sync.RWMutex
+	lastHealth   *HealthReport
+	recovered    int64
+	lastRecovery *time.Time
+	// Stops the health monitor loop, nil when it isn't running
+	stopHealthMonitor context.CancelFunc
+	// Pushes fired alerts to the notification pipeline, nil when it isn't running
+	alertMonitor atomic.Pointer[AlertMonitor]
+	// Exports old alerts to cold storage, nil when it isn't running
+	alertArchiver atomic.Pointer[AlertArchiver]
+	// Follows rule changes made through other replicas, nil when it isn't running
+	ruleChanges        atomic.Pointer[timeplus.Streamer]
+	ruleChangesApplied atomic.Int64
+	// Columns tried in order as the entity ID, DefaultEntityIDPriority when empty
+	entityIDPriority []string
+	// Severities rules may use, lowest first; the default levels when nil
+	severityLevels *models.SeverityLevels
+	// Firing history reviewed for tuning recommendations, DefaultRecommendationWindow when zero
+	recommendationWindow time.Duration
+	// Latest noise report of each rule, guarded by recommendationsMutex
+	recommendationsMutex sync.RWMutex
+	recommendations      map[string]*RuleRecommendations
+	// Stops the recommendation analysis loop, nil when it isn't running
+	stopRecommendations context.CancelFunc
+	// Alert volume quotas rules are degraded for exceeding
+	alertQuotas AlertQuotas
+	// Stops the quota guard loop, nil when it isn't running
+	stopQuotaGuard context.CancelFunc
+	// Thresholds of the self-alert checks watching the gateway itself
+	selfAlertThresholds SelfAlertThresholds
+	// Gateway problems found by the latest self-alert check by alert ID, and the counters it saw,
+	// guarded by selfAlertsMutex
+	selfAlertsMutex   sync.Mutex
+	selfAlerts        map[string]*models.Alert
+	selfAlertBaseline selfAlertBaseline
+	// Stops the self-alert loop, nil when it isn't running
+	stopSelfAlerts context.CancelFunc
+	// Counter totals seen by the previous gateway metrics write, guarded by gatewayMetricsMutex
+	gatewayMetricsMutex    sync.Mutex
+	gatewayMetricsBaseline map[string]int64
+	// Stops writing gateway metrics, nil when it isn't running
+	stopGatewayMetrics context.CancelFunc
+	// Stops the demo data generator, nil when it isn't running
+	stopDemoGenerator context.CancelFunc
+	// Naming convention of the objects generated for new rules, DefaultObjectNaming when nil
+	objectNaming *ObjectNaming
+	// Whether rules with high cost queries, such as cross joins, may be created and started
+	allowExpensiveQueries bool
+	// Time allowed to create a rule's streams and views when it starts, DefaultRuleStartTimeout when zero
+	startTimeout time.Duration
+	// Gateway-wide pause, guarded by pauseMutex
+	pauseMutex sync.RWMutex
+	pause      PauseState
+	// Latest snapshot of the active alerts, reused for ActiveAlertsCacheTTL, guarded by activeAlertsMutex
+	activeAlertsMutex sync.Mutex
+	activeAlerts      *ActiveAlerts
+	// Enrichment hooks registered in addition to the built-in ones and the built-ins' configuration,
+	// guarded by enrichmentMutex
+	enrichmentMutex  sync.RWMutex
+	enrichmentHooks  map[string]EnrichmentHook
+	enrichmentConfig EnrichmentConfig
+	// Compiled alert script of each rule by rule ID, guarded by alertScriptsMutex
+	alertScriptsMutex sync.Mutex
+	alertScripts      map[string]*compiledAlertScript
 }
 
 // NewRuleService creates a new rule service
-func NewRuleService(tpClient timeplus.TimeplusClient) (*RuleService, error) {
+func NewRuleService(tpClient timeplus.RuleStore) (*RuleService, error) {
 	ctx := context.Background()
 
 	// Ensure rule stream exists
@@ -47,53 +133,66 @@ func NewRuleService(tpClient timeplus.TimeplusClient) (*RuleService, error) {
 		return nil, fmt.Errorf("failed to ensure alert stream exists: %w", err)
 	}
 
+	// Ensure alert audit stream exists
+	if err := tpClient.CreateStream(ctx, timeplus.AlertAuditStream, timeplus.GetAlertAuditSchema()); err != nil {
+		return nil, fmt.Errorf("failed to ensure alert audit stream exists: %w", err)
+	}
+
+	// Bring existing system streams up to the current schema
+	migrations, err := timeplus.MigrateSystemStreams(ctx, tpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate system streams: %w", err)
+	}
+	for _, m := range migrations {
+		if len(m.AddedColumns) > 0 {
+			logrus.Infof("Migrated %s to schema v%d (added %s, rebuilt: %t)",
+				m.Stream, m.ToVersion, strings.Join(m.AddedColumns, ", "), m.Rebuilt)
+		}
+	}
+
+	templates, err := NewTemplateStore(ctx, tpClient)
+	if err != nil {
+		return nil, err
+	}
+
 	service := &RuleService{
+		templates:    templates,
 		tpClient:     tpClient,
-		ruleStream:   RuleStreamName,
-		alertStream:  AlertStreamName,
+		ruleStream:   timeplus.RulesStream,
+		alertStream:  timeplus.AlertsStream,
 		ruleContexts: make(map[string]context.CancelFunc),
 		ruleMonitors: make(map[string]context.CancelFunc),
+		tasks:        newTaskTracker(),
 	}
-
-	// Start all rules that were previously in running state
-	if err := service.resumeRunningRules(ctx); err != nil {
-		logrus.Warnf("Error resuming running rules: %v", err)
+	if service.inhibitions, err = NewInhibitionStore(ctx, tpClient, service.SeverityLevels); err != nil {
+		return nil, err
+	}
+	if service.onCall, err = NewOnCallStore(ctx, tpClient); err != nil {
+		return nil, err
+	}
+	if service.ruleGroups, err = NewRuleGroupStore(ctx, tpClient); err != nil {
+		return nil, err
+	}
+	if service.sqlMacros, err = NewSQLMacroStore(ctx, tpClient); err != nil {
+		return nil, err
+	}
+	if err := service.loadPauseState(ctx); err != nil {
+		return nil, err
 	}
 
 	return service, nil
 }
 
 // ensureRuleStream ensures that the rule stream exists and is mutable
-func ensureRuleStream(ctx context.Context, tpClient timeplus.TimeplusClient) error {
-	exists, err := tpClient.StreamExists(ctx, RuleStreamName)
+func ensureRuleStream(ctx context.Context, tpClient timeplus.StreamStore) error {
+	exists, err := tpClient.StreamExists(ctx, timeplus.RulesStream)
 	if err != nil {
 		return err
 	}
 
 	if !exists {
-		logrus.Infof("Creating mutable rule stream: %s", RuleStreamName)
-		ruleSchema := []timeplus.Column{
-			{Name: "id", Type: "string"},
-			{Name: "name", Type: "string"},
-			{Name: "description", Type: "string"},
-			{Name: "query", Type: "string"},
-			{Name: "resolve_query", Type: "string", Nullable: true},
-			{Name: "status", Type: "string"},
-			{Name: "severity", Type: "string"},
-			{Name: "throttle_minutes", Type: "int32"},
-			{Name: "entity_id_columns", Type: "string"},
-			{Name: "created_at", Type: "datetime64"},
-			{Name: "updated_at", Type: "datetime64"},
-			{Name: "last_triggered_at", Type: "datetime64", Nullable: true},
-			{Name: "result_stream", Type: "string"},
-			{Name: "view_name", Type: "string"},
-			{Name: "resolve_view_name", Type: "string", Nullable: true},
-			{Name: "last_error", Type: "string", Nullable: true},
-			{Name: "dedicated_alert_acks_stream", Type: "bool", Nullable: true},
-			{Name: "alert_acks_stream_name", Type: "string", Nullable: true},
-			{Name: "_tp_time", Type: "datetime64"},
-			{Name: "active", Type: "bool"},
-		}
+		logrus.Infof("Creating mutable rule stream: %s", timeplus.RulesStream)
+		ruleSchema := timeplus.GetMutableRulesSchema()
 
 		// Construct the CREATE MUTABLE STREAM query manually
 		columnsStr := ""
@@ -112,77 +211,86 @@ func ensureRuleStream(ctx context.Context, tpClient timeplus.TimeplusClient) err
 		pkStr := fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, ", "))
 
 		createMutableStreamQuery := fmt.Sprintf("CREATE MUTABLE STREAM `%s` (%s) %s",
-			RuleStreamName, columnsStr, pkStr)
+			timeplus.RulesStream, columnsStr, pkStr)
 
 		logrus.Infof("Executing query to create mutable rule stream: %s", createMutableStreamQuery)
 		if err := tpClient.ExecuteDDL(ctx, createMutableStreamQuery); err != nil {
-			return fmt.Errorf("failed to create mutable rule stream %s: %w", RuleStreamName, err)
+			return fmt.Errorf("failed to create mutable rule stream %s: %w", timeplus.RulesStream, err)
 		}
 
-		logrus.Infof("Created mutable rule stream: %s", RuleStreamName)
+		logrus.Infof("Created mutable rule stream: %s", timeplus.RulesStream)
 	}
 
-	// TODO: Handle schema migration if stream exists but schema is outdated?
-	// For now, assume if it exists, it's correct or needs manual intervention.
-	logrus.Infof("Mutable rule stream '%s' exists.", RuleStreamName)
+	// Schema drift on an existing stream is handled by timeplus.MigrateSystemStreams
+	logrus.Infof("Mutable rule stream '%s' exists.", timeplus.RulesStream)
 	return nil
 }
 
 // ensureAlertStream ensures that the alert stream exists
-func ensureAlertStream(ctx context.Context, tpClient timeplus.TimeplusClient) error {
-	exists, err := tpClient.StreamExists(ctx, AlertStreamName)
+func ensureAlertStream(ctx context.Context, tpClient timeplus.StreamStore) error {
+	exists, err := tpClient.StreamExists(ctx, timeplus.AlertsStream)
 	if err != nil {
 		return err
 	}
 
 	if !exists {
-		logrus.Infof("Creating alert stream: %s", AlertStreamName)
+		logrus.Infof("Creating alert stream: %s", timeplus.AlertsStream)
 		// Use the schema from timeplus package
 		alertSchema := timeplus.GetAlertSchema()
 		// Add the Timeplus timestamp column
 		alertSchema = append(alertSchema, timeplus.Column{Name: "_tp_time", Type: "datetime64"})
 
-		if err := tpClient.CreateStream(ctx, AlertStreamName, alertSchema); err != nil {
+		if err := tpClient.CreateStream(ctx, timeplus.AlertsStream, alertSchema); err != nil {
 			return fmt.Errorf("failed to create alert stream: %w", err)
 		}
 	}
 	return nil
 }
 
-// resumeRunningRules starts all rules that were in running state
-func (s *RuleService) resumeRunningRules(ctx context.Context) error {
-	rules, err := s.GetRules()
+// ResumeRunningRules reconciles all rules that were in running state with what exists in Timeplus.
+// Call it once the service is configured, so the rules are started with the configured settings.
+func (s *RuleService) ResumeRunningRules(ctx context.Context) error {
+	results, err := s.ReconcileRules(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, rule := range rules {
-		if rule.Status == models.RuleStatusRunning {
-			logrus.Infof("Resuming rule: %s", rule.Name)
-			if err := s.StartRule(ctx, rule.ID); err != nil {
-				logrus.Errorf("Failed to resume rule %s: %v", rule.ID, err)
-			}
+	recreated, failed := 0, 0
+	for _, result := range results {
+		switch result.Action {
+		case ReconcileActionRecreated:
+			recreated++
+		case ReconcileActionFailed:
+			failed++
 		}
 	}
+	logrus.Infof("Startup reconciliation checked %d running rule(s): %d recreated, %d failed",
+		len(results), recreated, failed)
 	return nil
 }
 
-// GetRules returns all rules
-func (s *RuleService) GetRules() ([]*models.Rule, error) {
-	ctx := context.Background()
+// ruleSelectColumns lists the tp_rules columns read back into a models.Rule
+const ruleSelectColumns = `id, name, description, query, resolve_query, status, severity,
+			   throttle_minutes, entity_id_columns, entity_id_column, created_at, updated_at, last_triggered_at,
+			   result_stream, view_name, resolve_view_name, last_error,
+			   dedicated_alert_acks_stream, alert_acks_stream_name, owner, team,
+			   runbook_url, summary_template, description_template, severity_expression,
+			   rule_type, rule_spec, lookups, notification_template,
+			   entity_id_priority, require_entity_id, shadow, depends_on,
+			   max_alerts_per_minute, degraded, oncall_schedule, object_names, enrichments, script, group_name, error_history, failed_components, redaction, encrypt_data,
+			   query_template, macros`
 
+// GetRules returns all rules
+func (s *RuleService) GetRules(ctx context.Context) ([]*models.Rule, error) {
 	// Query to get the latest version of each active rule - removed source_stream
 	query := fmt.Sprintf(`
-		SELECT id, name, description, query, status, severity, 
-			   throttle_minutes, entity_id_columns, created_at, updated_at, last_triggered_at,
-			   result_stream, view_name, last_error,
-			   dedicated_alert_acks_stream, alert_acks_stream_name
+		SELECT %s
 		FROM (
 			SELECT *, row_number() OVER (PARTITION BY id ORDER BY _tp_time DESC) as row_num
 			FROM table(%s)
 			WHERE active = true
 		) WHERE row_num = 1
-	`, s.ruleStream)
+	`, ruleSelectColumns, s.ruleStream)
 
 	results, err := s.tpClient.ExecuteQuery(ctx, query)
 	if err != nil {
@@ -214,10 +322,100 @@ func mapToRule(data map[string]interface{}) *models.Rule {
 		Severity:        models.RuleSeverity(getString(data, "severity")),
 		ThrottleMinutes: getInt(data, "throttle_minutes"),
 		EntityIDColumns: getString(data, "entity_id_columns"),
+		EntityIDColumn:  getString(data, "entity_id_column"),
 		ResultStream:    getString(data, "result_stream"),
 		ViewName:        getString(data, "view_name"),
 		ResolveViewName: getString(data, "resolve_view_name"),
 		LastError:       getString(data, "last_error"),
+		Owner:           getString(data, "owner"),
+		Team:            getString(data, "team"),
+
+		RunbookURL:           getString(data, "runbook_url"),
+		NotificationTemplate: getString(data, "notification_template"),
+		SummaryTemplate:      getString(data, "summary_template"),
+		DescriptionTemplate:  getString(data, "description_template"),
+		SeverityExpression:   getString(data, "severity_expression"),
+		OnCallSchedule:       getString(data, "oncall_schedule"),
+	}
+
+	if priority := getString(data, "entity_id_priority"); priority != "" {
+		rule.EntityIDPriority = cleanColumnList(strings.Split(priority, ","))
+	}
+	if components := getString(data, "failed_components"); components != "" {
+		rule.FailedComponents = strings.Split(components, ",")
+	}
+	if requireEntityID, ok := data["require_entity_id"].(bool); ok {
+		rule.RequireEntityID = requireEntityID
+	}
+	if shadow, ok := data["shadow"].(bool); ok {
+		rule.Shadow = shadow
+	}
+	if encryptData, ok := data["encrypt_data"].(bool); ok {
+		rule.EncryptData = encryptData
+	}
+
+	rule.Type = getString(data, "rule_type")
+	if spec := getString(data, "rule_spec"); spec != "" {
+		var ruleSpec models.RuleSpec
+		if err := json.Unmarshal([]byte(spec), &ruleSpec); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule spec: %v", rule.ID, err)
+		} else {
+			rule.Spec = &ruleSpec
+		}
+	}
+	if lookups := getString(data, "lookups"); lookups != "" {
+		if err := json.Unmarshal([]byte(lookups), &rule.Lookups); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule lookups: %v", rule.ID, err)
+		}
+	}
+	if dependsOn := getString(data, "depends_on"); dependsOn != "" {
+		if err := json.Unmarshal([]byte(dependsOn), &rule.DependsOn); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule dependencies: %v", rule.ID, err)
+		}
+	}
+	if enrichments := getString(data, "enrichments"); enrichments != "" {
+		if err := json.Unmarshal([]byte(enrichments), &rule.Enrichments); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule enrichments: %v", rule.ID, err)
+		}
+	}
+	rule.Group = getString(data, "group_name")
+	if script := getString(data, "script"); script != "" {
+		if err := json.Unmarshal([]byte(script), &rule.Script); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule script: %v", rule.ID, err)
+		}
+	}
+	if redaction := getString(data, "redaction"); redaction != "" {
+		if err := json.Unmarshal([]byte(redaction), &rule.Redaction); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule redaction: %v", rule.ID, err)
+		}
+	}
+	rule.QueryTemplate = getString(data, "query_template")
+	if macros := getString(data, "macros"); macros != "" {
+		if err := json.Unmarshal([]byte(macros), &rule.Macros); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule macros: %v", rule.ID, err)
+		}
+	}
+	rule.MaxAlertsPerMinute = getInt(data, "max_alerts_per_minute")
+	if degraded := getString(data, "degraded"); degraded != "" {
+		var degradation models.RuleDegradation
+		if err := json.Unmarshal([]byte(degraded), &degradation); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule degradation: %v", rule.ID, err)
+		} else {
+			rule.Degraded = &degradation
+		}
+	}
+	if errorHistory := getString(data, "error_history"); errorHistory != "" {
+		if err := json.Unmarshal([]byte(errorHistory), &rule.ErrorHistory); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule error history: %v", rule.ID, err)
+		}
+	}
+	if objectNames := getString(data, "object_names"); objectNames != "" {
+		var objects models.RuleObjects
+		if err := json.Unmarshal([]byte(objectNames), &objects); err != nil {
+			logrus.Warnf("MAP_TO_RULE [%s]: Failed to parse rule object names: %v", rule.ID, err)
+		} else {
+			rule.Objects = &objects
+		}
 	}
 
 	// Handle special fields: dedicated_alert_acks_stream (pointer to bool)
@@ -251,10 +449,75 @@ func mapToRule(data map[string]interface{}) *models.Rule {
 	return rule
 }
 
+// setAlertRuleDetails copies the details of the rule that triggered an alert onto the alert.
+// rule may be nil if the rule no longer exists.
+func setAlertRuleDetails(alert *models.Alert, rule *models.Rule) {
+	if rule == nil {
+		alert.RuleName = "Unknown Rule"
+		alert.Severity = models.RuleSeverity("info")
+		return
+	}
+
+	alert.RuleName = rule.Name
+	alert.Severity = rule.Severity
+	alert.Owner = rule.Owner
+	alert.Team = rule.Team
+}
+
+// alertFromAckRow builds an alert from a row of an alert acks stream. rule may be nil if the rule
+// no longer exists.
+func (s *RuleService) alertFromAckRow(ctx context.Context, result map[string]interface{}, rule *models.Rule) *models.Alert {
+	alert := &models.Alert{
+		ID:     FormatAlertID(getString(result, "rule_id"), getString(result, "entity_id"), getInt64(result, "firing_seq")),
+		RuleID: getString(result, "rule_id"),
+	}
+
+	// Add rule details if available
+	setAlertRuleDetails(alert, rule)
+
+	// Data carries the triggering row captured by the rule's materialized view
+	state := getString(result, "state")
+	rowData := alertRowData(ctx, result)
+	alert.Data = alertDataJSON(rowData)
+	setAlertRowSeverity(alert, result)
+	enrichAlert(alert, rule, rowData)
+
+	// Set acknowledged status based on state
+	alert.Acknowledged = state != timeplus.AlertStateActive
+	alert.AcknowledgedBy = getString(result, "updated_by")
+	alert.AckReference = getString(result, "reference")
+
+	// Handle dates
+	if createdAt, ok := result["created_at"].(time.Time); ok {
+		alert.TriggeredAt = createdAt
+	}
+
+	// For acknowledged alerts, updated_at represents acknowledged_at
+	if alert.Acknowledged {
+		if updatedAt, ok := result["updated_at"].(time.Time); ok {
+			alert.AcknowledgedAt = &updatedAt
+		}
+	}
+	s.applySLA(alert)
+	return alert
+}
+
+// setAlertRowSeverity overrides the rule severity with the severity computed when the alert fired, if any
+func setAlertRowSeverity(alert *models.Alert, row map[string]interface{}) {
+	if severity := getString(row, "severity"); severity != "" {
+		alert.Severity = models.RuleSeverity(severity)
+	}
+}
+
 // Helper functions to safely get values from map
 func getString(data map[string]interface{}, key string) string {
-	if val, ok := data[key].(string); ok {
+	switch val := data[key].(type) {
+	case string:
 		return val
+	case *string: // Nullable columns
+		if val != nil {
+			return *val
+		}
 	}
 	return ""
 }
@@ -265,6 +528,11 @@ func getInt(data map[string]interface{}, key string) int {
 		return v
 	case int32:
 		return int(v)
+	case *int32: // Nullable columns
+		if v != nil {
+			return int(*v)
+		}
+		return 0
 	case int64:
 		return int(v)
 	case float64:
@@ -275,21 +543,16 @@ func getInt(data map[string]interface{}, key string) int {
 }
 
 // GetRule returns a rule by ID
-func (s *RuleService) GetRule(id string) (*models.Rule, error) {
-	ctx := context.Background()
-
+func (s *RuleService) GetRule(ctx context.Context, id string) (*models.Rule, error) {
 	// Query to get the latest version of the specified rule - removed source_stream
 	query := fmt.Sprintf(`
-		SELECT id, name, description, query, resolve_query, status, severity, 
-			   throttle_minutes, entity_id_columns, created_at, updated_at, last_triggered_at,
-			   result_stream, view_name, resolve_view_name, last_error,
-			   dedicated_alert_acks_stream, alert_acks_stream_name
+		SELECT %s
 		FROM (
 			SELECT *, row_number() OVER (PARTITION BY id ORDER BY _tp_time DESC) as row_num
 			FROM table(%s)
 			WHERE id = '%s' AND active = true
 		) WHERE row_num = 1
-	`, s.ruleStream, id)
+	`, ruleSelectColumns, s.ruleStream, id)
 
 	results, err := s.tpClient.ExecuteQuery(ctx, query)
 	if err != nil {
@@ -305,11 +568,58 @@ func (s *RuleService) GetRule(id string) (*models.Rule, error) {
 
 // CreateRule creates a new rule
 func (s *RuleService) CreateRule(ctx context.Context, req *models.CreateRuleRequest) (*models.Rule, error) {
+	done, err := s.trackTask("create rule " + req.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rule := newRuleFromRequest(req, s.ObjectNaming())
+	if err := s.validateNewRule(ctx, rule, req.SourceStream); err != nil {
+		return nil, err
+	}
+	rule.Warnings = s.lintRule(rule)
+
+	// Only set ResolveViewName if a resolve query is provided or generated
+	if rule.ResolveQuery != "" {
+		rule.ResolveViewName = rule.Objects.ResolveView
+	}
+
+	// Persist the rule to Timeplus
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return nil, fmt.Errorf("failed to persist rule: %w", err)
+	}
+
+	// Automatically start the rule after creation
+	logrus.Infof("Auto-starting newly created rule: %s", rule.Name)
+	go func() {
+		// Use background context to avoid cancellation if the original request context is canceled
+		startCtx := context.Background()
+		if err := s.StartRule(startCtx, rule.ID); err != nil {
+			logrus.Errorf("Failed to auto-start rule %s: %v", rule.ID, err)
+		} else {
+			logrus.Infof("Successfully auto-started rule %s", rule.ID)
+
+			// Evaluate the rule over recent history if requested
+			if req.BackfillMinutes > 0 {
+				if _, err := s.BackfillRule(startCtx, rule.ID, req.BackfillMinutes); err != nil {
+					logrus.Errorf("Failed to backfill rule %s: %v", rule.ID, err)
+				}
+			}
+		}
+	}()
+
+	return rule, nil
+}
+
+// newRuleFromRequest builds a rule in the created state from a create request, naming its objects
+// after naming
+func newRuleFromRequest(req *models.CreateRuleRequest, naming ObjectNaming) *models.Rule {
 	ruleID := uuid.New().String()
 	now := time.Now()
 
-	// Sanitize the rule ID for stream and view names by replacing hyphens with underscores
-	sanitizedRuleID := GetFormattedRuleID(ruleID)
+	// Record the object names so the rule keeps them if the naming convention changes
+	objects := naming.RuleObjects(ruleID)
 
 	// Determine dedicated stream setting
 	dedicatedStream := false // Default to false
@@ -318,47 +628,108 @@ func (s *RuleService) CreateRule(ctx context.Context, req *models.CreateRuleRequ
 	}
 
 	// Create the rule
-	rule := &models.Rule{
+	return &models.Rule{
 		ID:                       ruleID,
 		Name:                     req.Name,
 		Description:              req.Description,
+		Type:                     req.Type,
+		Spec:                     req.Spec,
 		Query:                    req.Query,
 		ResolveQuery:             req.ResolveQuery,
 		Status:                   models.RuleStatusCreated,
 		Severity:                 req.Severity,
 		ThrottleMinutes:          req.ThrottleMinutes,
 		EntityIDColumns:          req.EntityIDColumns,
+		EntityIDPriority:         cleanColumnList(req.EntityIDPriority),
+		RequireEntityID:          req.RequireEntityID,
+		Shadow:                   req.Shadow,
+		DependsOn:                req.DependsOn,
+		MaxAlertsPerMinute:       req.MaxAlertsPerMinute,
+		OnCallSchedule:           req.OnCallSchedule,
+		Owner:                    req.Owner,
+		Team:                     req.Team,
+		RunbookURL:               req.RunbookURL,
+		SummaryTemplate:          req.SummaryTemplate,
+		DescriptionTemplate:      req.DescriptionTemplate,
+		SeverityExpression:       req.SeverityExpression,
+		Lookups:                  req.Lookups,
+		NotificationTemplate:     req.NotificationTemplate,
+		Enrichments:              req.Enrichments,
+		Script:                   req.Script,
+		Redaction:                req.Redaction,
+		EncryptData:              req.EncryptData,
+		Group:                    req.Group,
 		CreatedAt:                now,
 		UpdatedAt:                now,
-		ResultStream:             fmt.Sprintf("rule_%s_results", sanitizedRuleID),
-		ViewName:                 fmt.Sprintf("rule_%s_view", sanitizedRuleID),
+		ResultStream:             objects.ResultStream,
+		ViewName:                 objects.View,
+		Objects:                  objects,
 		DedicatedAlertAcksStream: &dedicatedStream,        // Store the determined value
 		AlertAcksStreamName:      req.AlertAcksStreamName, // Copy optional name
 	}
+}
 
-	// Only set ResolveViewName if ResolveQuery is provided
-	if req.ResolveQuery != "" {
-		rule.ResolveViewName = fmt.Sprintf("rule_%s_resolve_view", sanitizedRuleID)
+// validateNewRule generates the queries of generated rule types and validates a new rule,
+// including its streams and queries against Timeplus
+func (s *RuleService) validateNewRule(ctx context.Context, rule *models.Rule, sourceStream string) error {
+	if err := applyRuleType(rule); err != nil {
+		return err
 	}
 
-	// Persist the rule to Timeplus
-	if err := s.persistRule(ctx, rule, true); err != nil {
-		return nil, fmt.Errorf("failed to persist rule: %w", err)
+	if err := s.expandRuleMacros(rule); err != nil {
+		return err
 	}
 
-	// Automatically start the rule after creation
-	logrus.Infof("Auto-starting newly created rule: %s", rule.Name)
-	go func() {
-		// Use background context to avoid cancellation if the original request context is canceled
-		startCtx := context.Background()
-		if err := s.StartRule(startCtx, rule.ID); err != nil {
-			logrus.Errorf("Failed to auto-start rule %s: %v", rule.ID, err)
-		} else {
-			logrus.Infof("Successfully auto-started rule %s", rule.ID)
-		}
-	}()
+	if err := validateRuleLookups(rule.Lookups); err != nil {
+		return err
+	}
 
-	return rule, nil
+	if err := s.validateRuleEnrichments(rule.Enrichments); err != nil {
+		return err
+	}
+
+	if err := validateAlertScript(rule.Script); err != nil {
+		return err
+	}
+
+	if err := validateRuleRedaction(rule.Redaction); err != nil {
+		return err
+	}
+
+	if err := validateRuleEncryption(rule); err != nil {
+		return err
+	}
+
+	if err := validateRuleTemplates(rule); err != nil {
+		return err
+	}
+
+	if err := s.validateRuleNotificationTemplate(rule); err != nil {
+		return err
+	}
+
+	if err := s.validateRuleGroupName(rule); err != nil {
+		return err
+	}
+
+	if err := s.validateRuleOnCallSchedule(rule); err != nil {
+		return err
+	}
+
+	if err := validateRuleQuota(rule); err != nil {
+		return err
+	}
+
+	if err := s.validateRuleDependencies(ctx, rule); err != nil {
+		return err
+	}
+
+	// Catch missing streams and rejected SQL now rather than when the rule starts
+	if err := s.validateRuleSources(ctx, rule, sourceStream); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 // persistRule persists a rule to the rule stream
@@ -410,13 +781,116 @@ func (s *RuleService) persistRule(ctx context.Context, rule *models.Rule, active
 		alertAcksStreamName = nil // Use nil for database NULL
 	}
 
+	// Structured definition of generated rule types is stored as JSON
+	var ruleSpec interface{}
+	if rule.Spec != nil {
+		specJSON, err := json.Marshal(rule.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule spec: %w", err)
+		}
+		ruleSpec = string(specJSON)
+	}
+	var lookups interface{}
+	if len(rule.Lookups) > 0 {
+		lookupsJSON, err := json.Marshal(rule.Lookups)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule lookups: %w", err)
+		}
+		lookups = string(lookupsJSON)
+	}
+	var dependsOn interface{}
+	if len(rule.DependsOn) > 0 {
+		dependsOnJSON, err := json.Marshal(rule.DependsOn)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule dependencies: %w", err)
+		}
+		dependsOn = string(dependsOnJSON)
+	}
+	var enrichments interface{}
+	if len(rule.Enrichments) > 0 {
+		enrichmentsJSON, err := json.Marshal(rule.Enrichments)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule enrichments: %w", err)
+		}
+		enrichments = string(enrichmentsJSON)
+	}
+	var script interface{}
+	if rule.Script != nil {
+		scriptJSON, err := json.Marshal(rule.Script)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule script: %w", err)
+		}
+		script = string(scriptJSON)
+	}
+	var redaction interface{}
+	if rule.Redaction != nil {
+		redactionJSON, err := json.Marshal(rule.Redaction)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule redaction: %w", err)
+		}
+		redaction = string(redactionJSON)
+	}
+	var queryTemplate, macros interface{}
+	if rule.QueryTemplate != "" {
+		queryTemplate = rule.QueryTemplate
+	}
+	if len(rule.Macros) > 0 {
+		macrosJSON, err := json.Marshal(rule.Macros)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule macros: %w", err)
+		}
+		macros = string(macrosJSON)
+	}
+	var degraded interface{}
+	if rule.Degraded != nil {
+		degradedJSON, err := json.Marshal(rule.Degraded)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule degradation: %w", err)
+		}
+		degraded = string(degradedJSON)
+	}
+	var errorHistory interface{}
+	if len(rule.ErrorHistory) > 0 {
+		errorHistoryJSON, err := json.Marshal(rule.ErrorHistory)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule error history: %w", err)
+		}
+		errorHistory = string(errorHistoryJSON)
+	}
+	var objectNames interface{}
+	if rule.Objects != nil {
+		objectsJSON, err := json.Marshal(rule.Objects)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rule object names: %w", err)
+		}
+		objectNames = string(objectsJSON)
+	}
+
+	var entityIDPriority interface{}
+	if len(rule.EntityIDPriority) > 0 {
+		entityIDPriority = strings.Join(rule.EntityIDPriority, ",")
+	}
+	var failedComponents interface{}
+	if len(rule.FailedComponents) > 0 {
+		failedComponents = strings.Join(rule.FailedComponents, ",")
+	}
+
 	// Define columns for insertion - removed source_stream
 	columns := []string{
 		"id", "name", "description", "query", "resolve_query", "status", "severity", "throttle_minutes",
-		"entity_id_columns", "created_at", "updated_at", "last_triggered_at",
+		"entity_id_columns", "entity_id_column", "created_at", "updated_at", "last_triggered_at",
 		"result_stream", "view_name", "resolve_view_name", "last_error",
 		"dedicated_alert_acks_stream", "alert_acks_stream_name",
+		"owner", "team",
+		"runbook_url", "summary_template", "description_template", "severity_expression",
+		"rule_type", "rule_spec", "lookups", "notification_template",
+		"entity_id_priority", "require_entity_id",
 		"active",
+		"shadow", "depends_on",
+		"max_alerts_per_minute", "degraded",
+		"oncall_schedule", "object_names",
+		"enrichments", "script", "group_name", "error_history", "failed_components", "redaction", "encrypt_data",
+		"query_template", "macros",
 	}
 
 	// Prepare values for insertion - removed source_stream value
@@ -430,6 +904,7 @@ func (s *RuleService) persistRule(ctx context.Context, rule *models.Rule, active
 		string(rule.Severity),
 		rule.ThrottleMinutes,
 		rule.EntityIDColumns,
+		rule.EntityIDColumn,
 		rule.CreatedAt,
 		rule.UpdatedAt,
 		lastTriggeredAt, // Pass directly, InsertIntoStream handles formatting
@@ -439,7 +914,34 @@ func (s *RuleService) persistRule(ctx context.Context, rule *models.Rule, active
 		rule.LastError,
 		dedicatedStreamValue, // Pass the explicitly typed boolean value
 		alertAcksStreamName,  // Pass the interface{} value (string or nil)
+		rule.Owner,
+		rule.Team,
+		rule.RunbookURL,
+		rule.SummaryTemplate,
+		rule.DescriptionTemplate,
+		rule.SeverityExpression,
+		rule.Type,
+		ruleSpec,
+		lookups,
+		rule.NotificationTemplate,
+		entityIDPriority,
+		rule.RequireEntityID,
 		active,
+		rule.Shadow,
+		dependsOn,
+		rule.MaxAlertsPerMinute,
+		degraded,
+		rule.OnCallSchedule,
+		objectNames,
+		enrichments,
+		script,
+		rule.Group,
+		errorHistory,
+		failedComponents,
+		redaction,
+		rule.EncryptData,
+		queryTemplate,
+		macros,
 	}
 
 	// Log the values being inserted for debugging
@@ -460,12 +962,17 @@ func (s *RuleService) persistRule(ctx context.Context, rule *models.Rule, active
 // UpdateRule updates an existing rule
 func (s *RuleService) UpdateRule(ctx context.Context, id string, req *models.UpdateRuleRequest) (*models.Rule, error) {
 	// Get current rule
-	rule, err := s.GetRule(id)
+	rule, err := s.GetRule(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Can only update if rule is in created or stopped state
+	// A running rule's throttle can change without stopping it, only its materialized view is recreated
+	if ruleEvaluating(rule) && throttleOnlyUpdate(req) {
+		return s.updateRunningRuleThrottle(ctx, rule, *req.ThrottleMinutes)
+	}
+
+	// Otherwise a rule can only be updated in the created or stopped state
 	if rule.Status != models.RuleStatusCreated && rule.Status != models.RuleStatusStopped {
 		return nil, fmt.Errorf("cannot update rule in %s state", rule.Status)
 	}
@@ -478,7 +985,11 @@ func (s *RuleService) UpdateRule(ctx context.Context, id string, req *models.Upd
 		rule.Description = *req.Description
 	}
 	if req.Query != nil {
-		rule.Query = *req.Query
+		// A new query is expanded with the latest versions of the macros it references
+		rule.Query, rule.QueryTemplate, rule.Macros = *req.Query, "", nil
+	}
+	if req.Spec != nil {
+		rule.Spec = req.Spec
 	}
 	if req.ResolveQuery != nil {
 		rule.ResolveQuery = *req.ResolveQuery
@@ -492,12 +1003,128 @@ func (s *RuleService) UpdateRule(ctx context.Context, id string, req *models.Upd
 	if req.EntityIDColumns != nil {
 		rule.EntityIDColumns = *req.EntityIDColumns
 	}
+	if req.EntityIDPriority != nil {
+		rule.EntityIDPriority = cleanColumnList(*req.EntityIDPriority)
+	}
+	if req.RequireEntityID != nil {
+		rule.RequireEntityID = *req.RequireEntityID
+	}
+	if req.Shadow != nil {
+		rule.Shadow = *req.Shadow
+	}
+	if req.DependsOn != nil {
+		rule.DependsOn = *req.DependsOn
+	}
+	if req.MaxAlertsPerMinute != nil {
+		rule.MaxAlertsPerMinute = *req.MaxAlertsPerMinute
+	}
+	if req.OnCallSchedule != nil {
+		rule.OnCallSchedule = *req.OnCallSchedule
+	}
 	if req.DedicatedAlertAcksStream != nil {
 		rule.DedicatedAlertAcksStream = req.DedicatedAlertAcksStream
 	}
 	if req.AlertAcksStreamName != nil {
 		rule.AlertAcksStreamName = *req.AlertAcksStreamName // Dereference pointer
 	}
+	if req.Owner != nil {
+		rule.Owner = *req.Owner
+	}
+	if req.Team != nil {
+		rule.Team = *req.Team
+	}
+	if req.RunbookURL != nil {
+		rule.RunbookURL = *req.RunbookURL
+	}
+	if req.SummaryTemplate != nil {
+		rule.SummaryTemplate = *req.SummaryTemplate
+	}
+	if req.DescriptionTemplate != nil {
+		rule.DescriptionTemplate = *req.DescriptionTemplate
+	}
+	if req.SeverityExpression != nil {
+		rule.SeverityExpression = *req.SeverityExpression
+	}
+	if req.Lookups != nil {
+		rule.Lookups = *req.Lookups
+	}
+	if req.NotificationTemplate != nil {
+		rule.NotificationTemplate = *req.NotificationTemplate
+	}
+	if req.Enrichments != nil {
+		rule.Enrichments = *req.Enrichments
+	}
+	if req.Group != nil {
+		rule.Group = *req.Group
+	}
+	if req.Script != nil {
+		rule.Script = req.Script
+		if *req.Script == (models.AlertScript{}) {
+			rule.Script = nil
+		}
+	}
+	if req.Redaction != nil {
+		rule.Redaction = req.Redaction
+		if len(req.Redaction.Columns) == 0 && len(req.Redaction.Patterns) == 0 {
+			rule.Redaction = nil
+		}
+	}
+	if req.EncryptData != nil {
+		rule.EncryptData = *req.EncryptData
+	}
+
+	// Regenerate the query of generated rule types from the (possibly updated) spec
+	if err := applyRuleType(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.expandRuleMacros(rule); err != nil {
+		return nil, err
+	}
+
+	if err := validateRuleLookups(rule.Lookups); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRuleEnrichments(rule.Enrichments); err != nil {
+		return nil, err
+	}
+
+	if err := validateAlertScript(rule.Script); err != nil {
+		return nil, err
+	}
+
+	if err := validateRuleRedaction(rule.Redaction); err != nil {
+		return nil, err
+	}
+
+	if err := validateRuleEncryption(rule); err != nil {
+		return nil, err
+	}
+
+	if err := validateRuleTemplates(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRuleNotificationTemplate(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRuleGroupName(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRuleOnCallSchedule(rule); err != nil {
+		return nil, err
+	}
+
+	if err := validateRuleQuota(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRuleDependencies(ctx, rule); err != nil {
+		return nil, err
+	}
 
 	rule.UpdatedAt = time.Now()
 
@@ -520,7 +1147,7 @@ func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
 	}
 
 	// Get the rule
-	rule, err := s.GetRule(id)
+	rule, err := s.GetRule(ctx, id)
 	if err != nil {
 		logrus.Errorf("DELETE_RULE: Failed to get rule %s: %v", id, err)
 		return err
@@ -548,7 +1175,7 @@ func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
 	// Delete the resolve views if they exist
 	if rule.ResolveViewName != "" {
 		resolveViewName := rule.ResolveViewName
-		resolveMVName := fmt.Sprintf("rule_%s_resolve_mv", GetFormattedRuleID(rule.ID))
+		resolveMVName := ruleObjects(rule).ResolveMaterializedView
 
 		// Try to drop the resolve materialized view
 		if err := s.tpClient.DeleteMaterializedView(ctx, resolveMVName); err != nil {
@@ -572,8 +1199,7 @@ func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
 		if rule.AlertAcksStreamName != "" {
 			dedicatedStreamName = rule.AlertAcksStreamName
 		} else {
-			sanitizedRuleID := GetFormattedRuleID(rule.ID)
-			dedicatedStreamName = fmt.Sprintf("rule_%s_alert_acks", sanitizedRuleID)
+			dedicatedStreamName = ruleObjects(rule).AlertAcksStream
 		}
 
 		if dedicatedStreamName != "" {
@@ -587,6 +1213,11 @@ func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
 		}
 	}
 
+	historyStreamName := getRuleResources(rule).AlertHistoryStream
+	if err := s.tpClient.DeleteStream(ctx, historyStreamName); err != nil {
+		logrus.Warnf("Error deleting alert history stream %s: %v", historyStreamName, err)
+	}
+
 	if err := s.tpClient.DeleteStream(ctx, rule.ResultStream); err != nil {
 		logrus.Warnf("Error deleting result stream %s: %v", rule.ResultStream, err)
 		// Continue with other cleanup operations
@@ -604,6 +1235,7 @@ func (s *RuleService) DeleteRule(ctx context.Context, id string) error {
 		logrus.Errorf("DELETE_RULE: Failed to mark rule as deleted: %v", err)
 		return fmt.Errorf("failed to mark rule as deleted: %w", err)
 	}
+	s.forgetAlertScript(rule.ID)
 
 	logrus.Infof("DELETE_RULE: Successfully deleted rule %s", rule.ID)
 	return nil
@@ -615,16 +1247,38 @@ func (s *RuleService) setupAlertAcksStream(ctx context.Context) error {
 	return s.tpClient.SetupMutableAlertAcksStream(ctx)
 }
 
+// DefaultRuleStartTimeout is the time allowed to create a rule's streams and views when no
+// timeout is set
+const DefaultRuleStartTimeout = 60 * time.Second
+
+// SetRuleStartTimeout sets the time allowed to create a rule's streams and views when it starts
+func (s *RuleService) SetRuleStartTimeout(timeout time.Duration) {
+	s.startTimeout = timeout
+}
+
+// ruleStartTimeout returns the time allowed to start a rule
+func (s *RuleService) ruleStartTimeout() time.Duration {
+	if s.startTimeout <= 0 {
+		return DefaultRuleStartTimeout
+	}
+	return s.startTimeout
+}
+
 // StartRule starts a rule by setting up a materialized view
 func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
-	// Add a timeout to the context
-	timeoutCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	done, err := s.trackTask("start rule " + ruleID)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.ruleStartTimeout())
 	defer cancel()
 
 	// Add a small delay to allow the rule persistence to become consistent
 	time.Sleep(3 * time.Second) // Wait 3s - Increased delay for consistency
 
-	rule, err := s.GetRule(ruleID)
+	rule, err := s.GetRule(ctx, ruleID)
 	if err != nil {
 		return err
 	}
@@ -632,29 +1286,47 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 	logrus.Debugf("START_RULE: Starting rule %s, current state: Status=%s, DedicatedAlertAcksStream=%v",
 		rule.ID, rule.Status, rule.DedicatedAlertAcksStream)
 
-	// Already running
-	if rule.Status == models.RuleStatusRunning {
+	// Already running, degraded rules are repaired with RetryRuleComponent
+	if ruleEvaluating(rule) {
 		return nil
 	}
 
+	// Reject expensive queries before their materialized views start consuming the source streams
+	if err := s.checkQueryCost(rule); err != nil {
+		logrus.Errorf("Refusing to start rule %s: %v", rule.ID, err)
+		rule.Status = models.RuleStatusFailed
+		recordRuleError(rule, models.RulePhaseCostCheck, "", err.Error())
+		s.persistRule(timeoutCtx, rule, true)
+		return err
+	}
+
+	// Rules encrypting their alert data can't start without the key, rather than write it in the clear
+	if err := validateRuleEncryption(rule); err != nil {
+		logrus.Errorf("Refusing to start rule %s: %v", rule.ID, err)
+		rule.Status = models.RuleStatusFailed
+		recordRuleError(rule, models.RulePhaseEncryption, "", err.Error())
+		s.persistRule(timeoutCtx, rule, true)
+		return err
+	}
+
 	// First, ensure the alert acknowledgments stream is set up
 	if err := s.setupAlertAcksStream(timeoutCtx); err != nil {
 		logrus.Errorf("Failed to setup alert acknowledgments stream: %v", err)
 		rule.Status = models.RuleStatusFailed
-		rule.LastError = fmt.Sprintf("Failed to setup alert acknowledgments stream: %v", err)
+		recordRuleError(rule, models.RulePhaseAlertAcksStream, "", fmt.Sprintf("Failed to setup alert acknowledgments stream: %v", err))
 		s.persistRule(timeoutCtx, rule, true)
 		return fmt.Errorf("failed to setup alert acknowledgments stream: %w", err)
 	}
 
 	// We need to create a view name for both regular view and materialized view
-	sanitizedRuleID := GetFormattedRuleID(rule.ID)
-	plainViewName := fmt.Sprintf("rule_%s_view", sanitizedRuleID)
-	materializedViewName := fmt.Sprintf("rule_%s_mv", sanitizedRuleID)
-	resolveViewName := fmt.Sprintf("rule_%s_resolve_view", sanitizedRuleID)
-	resolveMaterializedViewName := fmt.Sprintf("rule_%s_resolve_mv", sanitizedRuleID)
+	objects := ruleObjects(rule)
+	plainViewName := objects.View
+	materializedViewName := objects.MaterializedView
+	resolveViewName := objects.ResolveView
+	resolveMaterializedViewName := objects.ResolveMaterializedView
 
 	// Determine target alert stream name based on rule config
-	targetAlertStreamName := timeplus.AlertAcksMutableStream // Default to global
+	targetAlertStreamName := timeplus.AlertAcksStreamFor(rule.ID) // Default to the rule's shared partition
 	useDedicatedStream := false
 
 	if rule.DedicatedAlertAcksStream != nil {
@@ -668,7 +1340,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 		useDedicatedStream = true
 		logrus.Infof("Using explicitly named alert acks stream: %s", targetAlertStreamName)
 	} else if rule.DedicatedAlertAcksStream != nil && *rule.DedicatedAlertAcksStream { // Dedicated flag is true
-		targetAlertStreamName = fmt.Sprintf("rule_%s_alert_acks", sanitizedRuleID)
+		targetAlertStreamName = objects.AlertAcksStream
 		useDedicatedStream = true
 		logrus.Infof("Using generated dedicated alert acks stream: %s", targetAlertStreamName)
 	} else {
@@ -680,20 +1352,31 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 
 	// Step 0: Ensure the target mutable alert acks stream exists if it's not the global one
 	if useDedicatedStream {
-		logrus.Infof("Ensuring dedicated alert acks stream exists: %s", targetAlertStreamName)
-		ackSchema := timeplus.GetMutableAlertAcksSchema() // Use correct package qualifier
-		primaryKeys := []string{"rule_id", "entity_id"}   // Define the primary key
-		if err := s.tpClient.EnsureMutableStream(timeoutCtx, targetAlertStreamName, ackSchema, primaryKeys); err != nil {
+		if err := s.ensureDedicatedAcksStream(timeoutCtx, targetAlertStreamName); err != nil {
 			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to ensure dedicated mutable alert acks stream %s: %v", targetAlertStreamName, err)
+			recordRuleError(rule, models.RulePhaseAlertAcksStream, "", err.Error())
 			s.persistRule(timeoutCtx, rule, true)
-			return fmt.Errorf("failed to ensure dedicated mutable alert acks stream %s: %w", targetAlertStreamName, err)
+			return err
 		}
-		logrus.Infof("Ensured dedicated mutable alert acks stream exists: %s", targetAlertStreamName)
 	} // else: Don't need to ensure global stream here, assumed to exist
 
+	// Shadow rules write would-be alerts to their result stream instead, so they never notify
+	if resultStream := getRuleResources(rule).ResultStream; resultStream != "" {
+		if err := s.ensureResultStream(timeoutCtx, resultStream); err != nil {
+			rule.Status = models.RuleStatusFailed
+			recordRuleError(rule, models.RulePhaseResultStream, "", err.Error())
+			s.persistRule(timeoutCtx, rule, true)
+			return err
+		}
+	}
+	alertsStreamName := targetAlertStreamName
+	if rule.Shadow {
+		alertsStreamName = getRuleResources(rule).AlertsStream
+		logrus.Infof("Rule %s is in shadow mode, recording would-be alerts in %s", rule.ID, alertsStreamName)
+	}
+
 	// Step 1: Force drop existing views with retries to ensure we're starting clean
-	dropViews := []string{plainViewName, materializedViewName}
+	dropViews := []string{plainViewName, materializedViewName, getRuleResources(rule).AlertHistoryMV}
 	// Add resolve views to drop list if a resolveQuery exists
 	if rule.ResolveQuery != "" {
 		dropViews = append(dropViews, resolveViewName, resolveMaterializedViewName)
@@ -731,8 +1414,9 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 	// Give the system some time to properly release the views
 	time.Sleep(2 * time.Second)
 
-	// Step 2: Create a plain VIEW for the rule query
-	plainViewQuery := timeplus.GetRulePlainViewQuery(rule.ID, rule.Query)
+	// Step 2: Create a plain VIEW for the rule query, joined with any lookup streams
+	viewQuery := ruleViewQuery(rule)
+	plainViewQuery := timeplus.GetRulePlainViewQuery(plainViewName, viewQuery)
 	logrus.Infof("Creating plain view with query: %s", plainViewQuery)
 
 	// Create the plain view with retries
@@ -763,7 +1447,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 	if plainViewErr != nil {
 		logrus.Errorf("Failed to create plain view: %v", plainViewErr)
 		rule.Status = models.RuleStatusFailed
-		rule.LastError = fmt.Sprintf("Failed to create plain view: %v", plainViewErr)
+		recordRuleError(rule, models.RulePhasePlainView, plainViewQuery, fmt.Sprintf("Failed to create plain view: %v", plainViewErr))
 		s.persistRule(timeoutCtx, rule, true)
 		return fmt.Errorf("failed to create plain view: %w", plainViewErr)
 	}
@@ -798,7 +1482,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 		if resolveViewErr != nil {
 			logrus.Errorf("Failed to create resolve plain view: %v", resolveViewErr)
 			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to create resolve plain view: %v", resolveViewErr)
+			recordRuleError(rule, models.RulePhaseResolveView, resolveViewQuery, fmt.Sprintf("Failed to create resolve plain view: %v", resolveViewErr))
 			s.persistRule(timeoutCtx, rule, true)
 			// Clean up the rule view before returning
 			s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
@@ -813,7 +1497,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 	if err != nil {
 		logrus.Errorf("Failed to get view columns: %v", err)
 		rule.Status = models.RuleStatusFailed
-		rule.LastError = fmt.Sprintf("Failed to get view columns: %v", err)
+		recordRuleError(rule, models.RulePhaseViewColumns, columnsQuery, fmt.Sprintf("Failed to get view columns: %v", err))
 		s.persistRule(timeoutCtx, rule, true)
 		// Clean up both views if resolveQuery exists
 		s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
@@ -882,13 +1566,13 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 
 				// Recreate the view with the concatenated entity_id
 				modifiedQuery := fmt.Sprintf("CREATE VIEW %s AS SELECT *, %s AS entity_id FROM (%s)",
-					plainViewName, entityIdExpression, rule.Query)
+					plainViewName, entityIdExpression, viewQuery)
 				// Use ExecuteDDL
 				err = s.tpClient.ExecuteDDL(timeoutCtx, modifiedQuery)
 				if err != nil {
 					logrus.Errorf("Failed to create modified plain view with concatenation: %v", err)
 					rule.Status = models.RuleStatusFailed
-					rule.LastError = fmt.Sprintf("Failed to create modified plain view with concatenation: %v", err)
+					recordRuleError(rule, models.RulePhasePlainView, modifiedQuery, fmt.Sprintf("Failed to create modified plain view with concatenation: %v", err))
 					s.persistRule(timeoutCtx, rule, true)
 					// Clean up both views if resolveQuery exists
 					if rule.ResolveQuery != "" {
@@ -907,28 +1591,24 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 		}
 	}
 
-	// Fall back to the default priority columns if no user columns matched
+	// Fall back to the rule's or the configured priority columns if no user columns matched
 	if idColumnName == "" {
-		priorityColumns := []string{"entity_id", "device_id", "id", "host", "ip", "user_id"}
-
-		// First check for priority columns
-		for _, column := range columnResults {
-			colName := ""
-			if name, ok := column["name"].(string); ok {
-				colName = name
-			}
-
-			for _, priority := range priorityColumns {
-				if colName == priority {
-					idColumnName = colName
-					break
-				}
-			}
+		idColumnName = priorityEntityColumn(columnResults, s.entityIDPriorityFor(rule))
+	}
 
-			if idColumnName != "" {
-				break
-			}
+	// Rules requiring an entity ID fail rather than guess one, since a guessed column or a
+	// per-event hash makes throttling and acknowledgments meaningless
+	if idColumnName == "" && rule.RequireEntityID {
+		err := entityIDUnresolvedError(rule, s.entityIDPriorityFor(rule), columnResults)
+		logrus.Errorf("START_RULE: %v", err)
+		rule.Status = models.RuleStatusFailed
+		recordRuleError(rule, models.RulePhaseEntityID, "", err.Error())
+		s.persistRule(timeoutCtx, rule, true)
+		s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
+		if rule.ResolveQuery != "" {
+			s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", resolveViewName))
 		}
+		return err
 	}
 
 	// If no priority column found, use the first string column
@@ -964,13 +1644,13 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 
 		// Recreate with a hashed _tp_time field
 		modifiedQuery := fmt.Sprintf("CREATE VIEW %s AS SELECT *, %s AS entity_id FROM (%s)",
-			plainViewName, entityIdExpression, rule.Query)
+			plainViewName, entityIdExpression, viewQuery)
 		// Use ExecuteDDL
 		err = s.tpClient.ExecuteDDL(timeoutCtx, modifiedQuery)
 		if err != nil {
 			logrus.Errorf("Failed to create modified plain view: %v", err)
 			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to create modified plain view: %v", err)
+			recordRuleError(rule, models.RulePhasePlainView, modifiedQuery, fmt.Sprintf("Failed to create modified plain view: %v", err))
 			s.persistRule(timeoutCtx, rule, true)
 			// Clean up both views if resolveQuery exists
 			if rule.ResolveQuery != "" {
@@ -1001,7 +1681,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 			if err != nil {
 				logrus.Errorf("Failed to create modified resolve view: %v", err)
 				rule.Status = models.RuleStatusFailed
-				rule.LastError = fmt.Sprintf("Failed to create modified resolve view: %v", err)
+				recordRuleError(rule, models.RulePhaseResolveView, modifiedResolveQuery, fmt.Sprintf("Failed to create modified resolve view: %v", err))
 				s.persistRule(timeoutCtx, rule, true)
 				// Clean up both views
 				s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
@@ -1017,7 +1697,7 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 		if err != nil {
 			logrus.Errorf("Failed to get resolve view columns: %v", err)
 			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to get resolve view columns: %v", err)
+			recordRuleError(rule, models.RulePhaseViewColumns, resolveColumnsQuery, fmt.Sprintf("Failed to get resolve view columns: %v", err))
 			s.persistRule(timeoutCtx, rule, true)
 			// Clean up both views
 			s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
@@ -1041,56 +1721,41 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 
 		if !entityIdExists {
 			errorMsg := fmt.Sprintf("Entity ID column '%s' not found in resolveQuery results. The resolveQuery must return the same entity_id column as the main query.", idColumnName)
-			logrus.Errorf(errorMsg)
+			logrus.Error(errorMsg)
 			rule.Status = models.RuleStatusFailed
-			rule.LastError = errorMsg
+			recordRuleError(rule, models.RulePhaseEntityID, "", errorMsg)
 			s.persistRule(timeoutCtx, rule, true)
 			// Clean up both views
 			s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", plainViewName))
 			s.tpClient.ExecuteDDL(timeoutCtx, fmt.Sprintf("DROP VIEW IF EXISTS %s", resolveViewName))
-			return fmt.Errorf(errorMsg)
+			return errors.New(errorMsg)
 		}
 
 		logrus.Infof("Validated that entity_id column '%s' exists in both the rule query and resolveQuery", idColumnName)
 	}
 
-	// Construct the expression to capture triggering data for the comment field as JSON
-	var dataCaptureParts []string
-	for _, column := range columnResults {
-		colName := ""
-		if name, ok := column["name"].(string); ok {
-			colName = name
-		}
-		// Skip internal columns and the potentially generated entity_id column
-		if colName == "" || colName == "_tp_time" || colName == "_tp_sn" || colName == idColumnName {
-			continue
-		}
-		// Format as '"key": "' || to_string(value) || '"'
-		part := fmt.Sprintf("concat('\"%s\": \"', to_string(`%s`), '\"')", colName, colName)
-		dataCaptureParts = append(dataCaptureParts, part)
-	}
-
-	triggeringDataExpr := "'{}'" // Default to empty JSON object
-	if len(dataCaptureParts) > 0 {
-		// Construct the SQL array content string: [part1_expr, part2_expr, ...]
-		// Each part is already a valid SQL expression producing a string.
-		sqlArrayContent := strings.Join(dataCaptureParts, ", ") // Join the SQL expressions with commas
-
-		// Use this array content in array_string_concat
-		joinedPartsExpr := fmt.Sprintf("array_string_concat([%s], ', ')", sqlArrayContent)
-
-		// Wrap with {} using SQL concat
-		triggeringDataExpr = fmt.Sprintf("concat('{', %s, '}')", joinedPartsExpr)
+	// Construct the expression that captures the triggering row as typed JSON for the comment field
+	triggeringDataExpr, err := ruleDataExpression(rule, columnResults, idColumnName)
+	if err != nil {
+		rule.Status = models.RuleStatusFailed
+		recordRuleError(rule, models.RulePhaseEncryption, "", err.Error())
+		s.persistRule(timeoutCtx, rule, true)
+		return err
 	}
 	logrus.Infof("Built triggering JSON expression: %s", triggeringDataExpr)
 
 	// Step 4: Create a materialized view that joins with the target alert acks stream
 	materializedViewQuery := timeplus.GetRuleThrottledMaterializedViewQuery(
 		rule.ID,
+		plainViewName,
+		materializedViewName,
 		rule.ThrottleMinutes,
 		idColumnName,
 		triggeringDataExpr,
-		targetAlertStreamName, // Pass the determined target stream name
+		alertsStreamName, // The determined target stream, or the result stream of shadow rules
+		ruleSeverityExpression(rule),
+		eventTimeExpression(columnResults),
+		ruleStagingStream(rule),
 	)
 
 	logrus.Infof("Creating materialized view with query: %s", materializedViewQuery)
@@ -1113,16 +1778,26 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 	if createErr != nil {
 		logrus.Errorf("Failed to create materialized view: %v", createErr)
 		rule.Status = models.RuleStatusFailed
-		rule.LastError = fmt.Sprintf("Failed to create materialized view: %v", createErr)
+		recordRuleError(rule, models.RulePhaseMaterializedView, materializedViewQuery, fmt.Sprintf("Failed to create materialized view: %v", createErr))
 		s.persistRule(timeoutCtx, rule, true)
 		return fmt.Errorf("failed to create throttled materialized view: %w", createErr)
 	}
 
 	// Step 5: Update rule status to running
 	rule.Status = models.RuleStatusRunning
+	rule.EntityIDColumn = idColumnName
 	rule.LastError = "" // Clear last error on success
+	rule.FailedComponents = nil
 	rule.UpdatedAt = time.Now()
 
+	// Record every firing in the rule's alert history stream. History is auxiliary, so
+	// failing to set it up only degrades the rule.
+	if err := s.setupAlertHistory(timeoutCtx, rule, alertsStreamName); err != nil {
+		logrus.Warnf("START_RULE: Alert history is unavailable for rule %s: %v", rule.ID, err)
+		recordRuleError(rule, models.RulePhaseAlertHistory, "", err.Error())
+		markRuleComponentFailed(rule, models.RuleComponentAlertHistory)
+	}
+
 	// Explicitly set the pointer value based on the determined logic
 	// This ensures the correct value is persisted even if the original pointer was lost/overwritten.
 	trueValue := useDedicatedStream // Create a copy to avoid potential issues with the reference
@@ -1151,40 +1826,18 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 
 	logrus.Infof("START_RULE: Successfully started rule %s with dedicated stream flag: %v", rule.ID, dedicatedFlagValue)
 
-	// Step 6: Create the resolve query view and materialized view if provided
+	// Step 6: Create the resolve materialized view if a resolve query is provided.
+	// The resolve plain view was already created and validated in step 2.
 	if rule.ResolveQuery != "" {
-		logrus.Infof("Creating resolve query view for rule %s", rule.ID)
-
-		// Create the plain view with the resolve query
-		resolveViewQuery := fmt.Sprintf("CREATE VIEW %s AS %s", resolveViewName, rule.ResolveQuery)
-
-		logrus.Infof("Creating resolve plain view with query: %s", resolveViewQuery)
-
-		var resolveViewErr error
-		for attempt := 1; attempt <= maxAttempts; attempt++ {
-			resolveViewErr = s.tpClient.ExecuteDDL(timeoutCtx, resolveViewQuery)
-			if resolveViewErr == nil {
-				break
-			}
-			logrus.Warnf("Attempt %d to create resolve plain view failed: %v", attempt, resolveViewErr)
-			if attempt < maxAttempts {
-				time.Sleep(2 * time.Second)
-			}
-		}
-
-		if resolveViewErr != nil {
-			logrus.Errorf("Failed to create resolve plain view: %v", resolveViewErr)
-			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to create resolve plain view: %v", resolveViewErr)
-			s.persistRule(timeoutCtx, rule, true)
-			return fmt.Errorf("failed to create resolve plain view: %w", resolveViewErr)
-		}
+		logrus.Infof("Creating resolve materialized view for rule %s", rule.ID)
 
 		// Create the materialized view that will auto-acknowledge alerts
 		resolveMVQuery := timeplus.GetRuleResolveViewQuery(
 			rule.ID,
+			resolveViewName,
+			resolveMaterializedViewName,
 			idColumnName,
-			targetAlertStreamName,
+			alertsStreamName,
 		)
 
 		logrus.Infof("Creating resolve materialized view with query: %s", resolveMVQuery)
@@ -1202,57 +1855,64 @@ func (s *RuleService) StartRule(ctx context.Context, ruleID string) error {
 		}
 
 		if resolveMVErr != nil {
-			logrus.Errorf("Failed to create resolve materialized view: %v", resolveMVErr)
-			rule.Status = models.RuleStatusFailed
-			rule.LastError = fmt.Sprintf("Failed to create resolve materialized view: %v", resolveMVErr)
-			s.persistRule(timeoutCtx, rule, true)
-			return fmt.Errorf("failed to create resolve materialized view: %w", resolveMVErr)
+			// The rule keeps alerting, its alerts just aren't resolved automatically until retried
+			logrus.Errorf("Failed to create resolve materialized view, rule %s is degraded: %v", rule.ID, resolveMVErr)
+			recordRuleError(rule, models.RulePhaseResolveMaterializedView, resolveMVQuery, fmt.Sprintf("Failed to create resolve materialized view: %v", resolveMVErr))
+			markRuleComponentFailed(rule, models.RuleComponentResolve)
+			if err := s.persistRule(timeoutCtx, rule, true); err != nil {
+				logrus.Errorf("START_RULE: Failed to mark rule %s degraded: %v", rule.ID, err)
+			}
+		} else {
+			// Store the resolve view name in the rule
+			rule.ResolveViewName = resolveViewName
 		}
-
-		// Store the resolve view name in the rule
-		rule.ResolveViewName = resolveViewName
 	}
 
+	// Push the rule's alerts to the notification pipeline
+	s.monitorRuleStarted(rule)
+
 	return nil
 }
 
 // GetAlerts returns all alerts, optionally filtered by rule ID
-func (s *RuleService) GetAlerts(ruleID string) ([]*models.Alert, error) {
-	ctx := context.Background()
-
+func (s *RuleService) GetAlerts(ctx context.Context, ruleID string) ([]*models.Alert, error) {
 	// Query from tp_alert_acks_mutable with table() function and proper field mapping
 	var query string
 	if ruleID == "" {
 		query = fmt.Sprintf(`
 			SELECT 
-				uuid() as id, 
 				rule_id, 
 				entity_id,
 				state,
 				created_at,
 				updated_at,
 				updated_by,
-				comment
-			FROM table(%s)
+				comment,
+				severity,
+				firing_seq,
+				reference
+			FROM %s
 			ORDER BY created_at DESC
 			LIMIT 1000
-		`, timeplus.AlertAcksMutableStream)
+		`, timeplus.AlertAcksTable())
 	} else {
 		query = fmt.Sprintf(`
 			SELECT 
-				uuid() as id, 
 				rule_id,
 				entity_id,
 				state,
 				created_at,
 				updated_at,
 				updated_by,
-				comment
+				comment,
+				severity,
+				firing_seq,
+				reference
 			FROM table(%s)
 			WHERE rule_id = '%s'
 			ORDER BY created_at DESC
 			LIMIT 1000
-		`, timeplus.AlertAcksMutableStream, ruleID)
+		`, timeplus.AlertAcksStreamFor(ruleID), ruleID)
 	}
 
 	logrus.Infof("GetAlerts query: %s", query)
@@ -1276,7 +1936,7 @@ func (s *RuleService) GetAlerts(ruleID string) ([]*models.Alert, error) {
 
 	// Fetch rule details for all involved rules
 	for rID := range ruleIDs {
-		rule, err := s.GetRule(rID)
+		rule, err := s.GetRule(ctx, rID)
 		if err == nil {
 			ruleDetails[rID] = rule
 		}
@@ -1284,89 +1944,56 @@ func (s *RuleService) GetAlerts(ruleID string) ([]*models.Alert, error) {
 
 	// Create alert objects with rule details
 	for _, result := range results {
-		alert := &models.Alert{
-			ID:     getString(result, "id"),
-			RuleID: getString(result, "rule_id"),
-		}
-
-		// Add rule details if available
-		if rule, ok := ruleDetails[alert.RuleID]; ok {
-			alert.RuleName = rule.Name
-			alert.Severity = rule.Severity
-		} else {
-			alert.RuleName = "Unknown Rule"
-			alert.Severity = models.RuleSeverity("info")
-		}
-
-		// Get entity ID and create data field
-		entityID := getString(result, "entity_id")
-		state := getString(result, "state")
-		alert.Data = fmt.Sprintf(`{"entity_id":"%s","state":"%s"}`, entityID, state)
-
-		// Set acknowledged status based on state
-		alert.Acknowledged = state != timeplus.AlertStateActive
-		alert.AcknowledgedBy = getString(result, "updated_by")
-
-		// Handle dates
-		if createdAt, ok := result["created_at"].(time.Time); ok {
-			alert.TriggeredAt = createdAt
-		}
-
-		// For acknowledged alerts, updated_at represents acknowledged_at
-		if alert.Acknowledged {
-			if updatedAt, ok := result["updated_at"].(time.Time); ok {
-				alert.AcknowledgedAt = &updatedAt
-			}
-		}
-
-		alerts = append(alerts, alert)
+		alerts = append(alerts, s.alertFromAckRow(ctx, result, ruleDetails[getString(result, "rule_id")]))
 	}
 
 	return alerts, nil
 }
 
 // GetAlertsByTimeRange returns alerts within a specified time range
-func (s *RuleService) GetAlertsByTimeRange(ruleID string, startTime, endTime time.Time) ([]*models.Alert, error) {
-	ctx := context.Background()
-
-	// Format timestamps
-	startStr := startTime.Format(time.RFC3339)
-	endStr := endTime.Format(time.RFC3339)
+func (s *RuleService) GetAlertsByTimeRange(ctx context.Context, ruleID string, startTime, endTime time.Time) ([]*models.Alert, error) {
+	// Timestamps are compared in UTC whatever the offset they were given in
+	startStr := timeplus.DateTime64(startTime)
+	endStr := timeplus.DateTime64(endTime)
 
 	// Build query based on whether a rule ID is provided, but using tp_alert_acks_mutable
 	var query string
 	if ruleID == "" {
 		query = fmt.Sprintf(`
 			SELECT 
-				uuid() as id, 
 				rule_id, 
 				entity_id,
 				state,
 				created_at,
 				updated_at,
 				updated_by,
-				comment
-			FROM table(%s)
-			WHERE created_at >= '%s' AND created_at <= '%s'
+				comment,
+				severity,
+				firing_seq,
+				reference
+			FROM %s
+			WHERE created_at >= %s AND created_at <= %s
 			ORDER BY created_at DESC
 			LIMIT 1000
-		`, timeplus.AlertAcksMutableStream, startStr, endStr)
+		`, timeplus.AlertAcksTable(), startStr, endStr)
 	} else {
 		query = fmt.Sprintf(`
 			SELECT 
-				uuid() as id, 
 				rule_id,
 				entity_id,
 				state,
 				created_at,
 				updated_at,
 				updated_by,
-				comment
+				comment,
+				severity,
+				firing_seq,
+				reference
 			FROM table(%s)
-			WHERE rule_id = '%s' AND created_at >= '%s' AND created_at <= '%s'
+			WHERE rule_id = '%s' AND created_at >= %s AND created_at <= %s
 			ORDER BY created_at DESC
 			LIMIT 1000
-		`, timeplus.AlertAcksMutableStream, ruleID, startStr, endStr)
+		`, timeplus.AlertAcksStreamFor(ruleID), ruleID, startStr, endStr)
 	}
 
 	logrus.Infof("GetAlertsByTimeRange query: %s", query)
@@ -1390,7 +2017,7 @@ func (s *RuleService) GetAlertsByTimeRange(ruleID string, startTime, endTime tim
 
 	// Fetch rule details for all involved rules
 	for rID := range ruleIDs {
-		rule, err := s.GetRule(rID)
+		rule, err := s.GetRule(ctx, rID)
 		if err == nil {
 			ruleDetails[rID] = rule
 		}
@@ -1398,82 +2025,45 @@ func (s *RuleService) GetAlertsByTimeRange(ruleID string, startTime, endTime tim
 
 	// Create alert objects
 	for _, result := range results {
-		alert := &models.Alert{
-			ID:     getString(result, "id"),
-			RuleID: getString(result, "rule_id"),
-		}
-
-		// Add rule details if available
-		if rule, ok := ruleDetails[alert.RuleID]; ok {
-			alert.RuleName = rule.Name
-			alert.Severity = rule.Severity
-		} else {
-			alert.RuleName = "Unknown Rule"
-			alert.Severity = models.RuleSeverity("info")
-		}
-
-		// Get entity ID and create data field
-		entityID := getString(result, "entity_id")
-		state := getString(result, "state")
-		alert.Data = fmt.Sprintf(`{"entity_id":"%s","state":"%s"}`, entityID, state)
-
-		// Set acknowledged status based on state
-		alert.Acknowledged = state != timeplus.AlertStateActive
-		alert.AcknowledgedBy = getString(result, "updated_by")
-
-		// Handle dates
-		if createdAt, ok := result["created_at"].(time.Time); ok {
-			alert.TriggeredAt = createdAt
-		}
-
-		// For acknowledged alerts, updated_at represents acknowledged_at
-		if alert.Acknowledged {
-			if updatedAt, ok := result["updated_at"].(time.Time); ok {
-				alert.AcknowledgedAt = &updatedAt
-			}
-		}
-
-		alerts = append(alerts, alert)
+		alerts = append(alerts, s.alertFromAckRow(ctx, result, ruleDetails[getString(result, "rule_id")]))
 	}
 
 	return alerts, nil
 }
 
 // GetAlert returns a single alert by ID
-func (s *RuleService) GetAlert(alertID string) (*models.Alert, error) {
-	// Parse composite ID to get rule_id and entity_id
-	parts := strings.Split(alertID, ":")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid alert ID format, expected 'rule_id:entity_id'")
+func (s *RuleService) GetAlert(ctx context.Context, alertID string) (*models.Alert, error) {
+	// Parse composite ID to get rule_id, entity_id and the firing sequence
+	ruleID, entityID, firingSeq, hasSeq, err := s.resolveAlertID(ctx, alertID)
+	if err != nil {
+		return nil, err
 	}
 
-	ruleID := parts[0]
-	entityID := parts[1]
-
 	// Get rule details first
-	rule, err := s.GetRule(ruleID)
+	rule, err := s.GetRule(ctx, ruleID)
 	if err != nil {
 		logrus.Warnf("Failed to get rule details for alert %s: %v", alertID, err)
 		// Continue anyway, we'll create an alert with minimal information
 	}
 
 	// Query the alert from the mutable stream
-	ctx := context.Background()
 	query := fmt.Sprintf(`
 		SELECT 
-			'%s' as id,
 			rule_id,
 			entity_id,
 			state,
 			created_at,
 			updated_at,
 			updated_by,
-			comment
+			comment,
+			severity,
+			firing_seq,
+			reference
 		FROM table(%s) 
 		WHERE rule_id = '%s' AND entity_id = '%s'
 		ORDER BY updated_at DESC 
 		LIMIT 1
-	`, alertID, timeplus.AlertAcksMutableStream, ruleID, entityID)
+	`, timeplus.AlertAcksStreamFor(ruleID), ruleID, entityID)
 
 	logrus.Infof("GetAlert query: %s", query)
 	results, err := s.tpClient.ExecuteQuery(ctx, query)
@@ -1485,30 +2075,33 @@ func (s *RuleService) GetAlert(alertID string) (*models.Alert, error) {
 		return nil, fmt.Errorf("alert %s not found", alertID)
 	}
 
-	// Create the alert with available information
+	// The acks stream only keeps the entity's latest firing
 	result := results[0]
+	currentSeq := getInt64(result, "firing_seq")
+	if hasSeq && firingSeq != currentSeq {
+		return nil, fmt.Errorf("%w: alert %s", ErrAlertSuperseded, alertID)
+	}
+
+	// Create the alert with available information
 	alert := &models.Alert{
-		ID:     alertID,
+		ID:     FormatAlertID(ruleID, entityID, currentSeq),
 		RuleID: ruleID,
 	}
 
 	// Add rule details if available
-	if rule != nil {
-		alert.RuleName = rule.Name
-		alert.Severity = rule.Severity
-	} else {
-		alert.RuleName = "Unknown Rule"
-		alert.Severity = models.RuleSeverity("info")
-	}
+	setAlertRuleDetails(alert, rule)
 
-	// Get entity ID and create data field
-	entityVal := getString(result, "entity_id")
+	// Data carries the triggering row captured by the rule's materialized view
 	state := getString(result, "state")
-	alert.Data = fmt.Sprintf(`{"entity_id":"%s","state":"%s"}`, entityVal, state)
+	rowData := alertRowData(ctx, result)
+	alert.Data = alertDataJSON(rowData)
+	setAlertRowSeverity(alert, result)
+	enrichAlert(alert, rule, rowData)
 
 	// Set acknowledged status based on state
 	alert.Acknowledged = state != timeplus.AlertStateActive
 	alert.AcknowledgedBy = getString(result, "updated_by")
+	alert.AckReference = getString(result, "reference")
 
 	// Handle dates
 	if createdAt, ok := result["created_at"].(time.Time); ok {
@@ -1521,32 +2114,46 @@ func (s *RuleService) GetAlert(alertID string) (*models.Alert, error) {
 			alert.AcknowledgedAt = &updatedAt
 		}
 	}
+	s.applySLA(alert)
 
 	return alert, nil
 }
 
 // AcknowledgeAlert acknowledges an alert
-func (s *RuleService) AcknowledgeAlert(id string, acknowledgedBy string) error {
-	// Parse the id which should be in format rule_id:entity_id
-	parts := strings.Split(id, ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid alert ID format, expected 'rule_id:entity_id'")
-	}
+func (s *RuleService) AcknowledgeAlert(ctx context.Context, id string, acknowledgedBy string) error {
+	return s.AcknowledgeAlertFrom(ctx, id, acknowledgedBy, "API")
+}
 
-	ruleID := parts[0]
-	entityID := parts[1]
+// AcknowledgeAlertFrom acknowledges an alert from a source such as "Slack", which is recorded in
+// the alert's audit trail
+func (s *RuleService) AcknowledgeAlertFrom(ctx context.Context, id, acknowledgedBy, source string) error {
+	// Parse the id which should be in format rule_id:entity_id:firing_seq
+	ruleID, entityID, firingSeq, hasSeq, err := s.resolveAlertID(ctx, id)
+	if err != nil {
+		return err
+	}
 
-	return s.AcknowledgeDevice(context.Background(), ruleID, entityID, acknowledgedBy, "Acknowledged via API")
+	var expectedSeq *int64
+	if hasSeq {
+		expectedSeq = &firingSeq
+	}
+	return s.acknowledgeFiring(ctx, ruleID, entityID, expectedSeq, acknowledgedBy, "Acknowledged via "+source)
 }
 
 // StopRule stops a rule in the new implementation
 func (s *RuleService) StopRule(ctx context.Context, ruleID string) error {
-	rule, err := s.GetRule(ruleID)
+	done, err := s.trackTask("stop rule " + ruleID)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	rule, err := s.GetRule(ctx, ruleID)
 	if err != nil {
 		return err
 	}
 
-	if rule.Status != models.RuleStatusRunning {
+	if !ruleEvaluating(rule) {
 		return fmt.Errorf("rule is not running")
 	}
 
@@ -1578,10 +2185,16 @@ func (s *RuleService) StopRule(ctx context.Context, ruleID string) error {
 		logrus.Warnf("Error deleting alert acks view %s: %v", acksViewName, err)
 	}
 
+	// Stop recording alert history; the history stream itself is kept until the rule is deleted
+	historyMVName := getRuleResources(rule).AlertHistoryMV
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", historyMVName)); err != nil {
+		logrus.Warnf("Error deleting alert history materialized view %s: %v", historyMVName, err)
+	}
+
 	// Delete the resolve views if they exist
 	if rule.ResolveViewName != "" {
 		resolveViewName := rule.ResolveViewName
-		resolveMVName := fmt.Sprintf("rule_%s_resolve_mv", GetFormattedRuleID(rule.ID))
+		resolveMVName := ruleObjects(rule).ResolveMaterializedView
 
 		// Try to drop the resolve materialized view
 		if err := s.tpClient.DeleteMaterializedView(ctx, resolveMVName); err != nil {
@@ -1599,8 +2212,11 @@ func (s *RuleService) StopRule(ctx context.Context, ruleID string) error {
 		}
 	}
 
+	s.monitorRuleStopped(rule.ID)
+
 	// Update rule status
 	rule.Status = models.RuleStatusStopped
+	rule.FailedComponents = nil
 	rule.UpdatedAt = time.Now()
 
 	return s.persistRule(ctx, rule, true)
@@ -1611,7 +2227,7 @@ func (s *RuleService) persistAlert(ctx context.Context, alert *models.Alert) err
 	// Use time.Time objects directly
 	var acknowledgedAtStr string
 	if alert.AcknowledgedAt != nil {
-		acknowledgedAtStr = fmt.Sprintf("'%s'", alert.AcknowledgedAt.Format("2006-01-02 15:04:05.000"))
+		acknowledgedAtStr = timeplus.DateTime64(*alert.AcknowledgedAt)
 	} else {
 		acknowledgedAtStr = "null"
 	}
@@ -1622,14 +2238,14 @@ func (s *RuleService) persistAlert(ctx context.Context, alert *models.Alert) err
 		(id, rule_id, rule_name, severity, triggered_at,
 		 data, acknowledged, acknowledged_at, acknowledged_by)
 		VALUES 
-		('%s', '%s', '%s', '%s', '%s',
+		('%s', '%s', '%s', '%s', %s,
 		 '%s', %t, %s, '%s')`,
 		s.alertStream,
 		strings.ReplaceAll(alert.ID, "'", "''"),
 		strings.ReplaceAll(alert.RuleID, "'", "''"),
 		strings.ReplaceAll(alert.RuleName, "'", "''"),
 		strings.ReplaceAll(string(alert.Severity), "'", "''"),
-		alert.TriggeredAt.Format("2006-01-02 15:04:05.000"),
+		timeplus.DateTime64(alert.TriggeredAt),
 		strings.ReplaceAll(alert.Data, "'", "''"),
 		alert.Acknowledged,
 		acknowledgedAtStr,
@@ -1642,13 +2258,16 @@ func (s *RuleService) persistAlert(ctx context.Context, alert *models.Alert) err
 }
 
 // GetTimeplusClient returns the Timeplus client
-func (s *RuleService) GetTimeplusClient() timeplus.TimeplusClient {
+func (s *RuleService) GetTimeplusClient() timeplus.RuleStore {
 	return s.tpClient
 }
 
 // GetActiveAlertAcks retrieves active alert acknowledgments from the mutable stream
 func (s *RuleService) GetActiveAlertAcks(ctx context.Context, ruleID string, entityID string) ([]map[string]interface{}, error) {
-	query := fmt.Sprintf("SELECT * FROM table(%s)", timeplus.AlertAcksMutableStream)
+	query := fmt.Sprintf("SELECT * FROM %s", timeplus.AlertAcksTable())
+	if ruleID != "" {
+		query = fmt.Sprintf("SELECT * FROM table(%s)", timeplus.AlertAcksStreamFor(ruleID))
+	}
 
 	// Add filter conditions if provided
 	whereConditions := []string{}
@@ -1684,6 +2303,18 @@ func (s *RuleService) GetActiveAlertAcks(ctx context.Context, ruleID string, ent
 // entityID can be any identifier that uniquely identifies the alerting entity
 // (device ID, IP address, user ID, transaction ID, etc.)
 func (s *RuleService) AcknowledgeDevice(ctx context.Context, ruleID string, entityID string, acknowledgedBy string, comment string) error {
+	return s.acknowledgeFiring(ctx, ruleID, entityID, nil, acknowledgedBy, comment)
+}
+
+// acknowledgeFiring acknowledges the active alert of an entity. When expectedSeq is set, the
+// acknowledgment is rejected if the entity's active alert is a different firing.
+func (s *RuleService) acknowledgeFiring(ctx context.Context, ruleID string, entityID string, expectedSeq *int64, acknowledgedBy string, comment string) error {
+	done, err := s.trackTask(fmt.Sprintf("acknowledge %s:%s", ruleID, entityID))
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	// First, check if there are any active alerts for this entity
 	acks, err := s.GetActiveAlertAcks(ctx, ruleID, entityID)
 	if err != nil {
@@ -1694,23 +2325,30 @@ func (s *RuleService) AcknowledgeDevice(ctx context.Context, ruleID string, enti
 		return fmt.Errorf("no active alerts found for entity %s with rule %s", entityID, ruleID)
 	}
 
-	// Update the alert acknowledgment in the mutable stream
+	firingSeq := getInt64(acks[0], "firing_seq")
+	if expectedSeq != nil && *expectedSeq != firingSeq {
+		return fmt.Errorf("%w: active alert is %s", ErrAlertSuperseded, FormatAlertID(ruleID, entityID, firingSeq))
+	}
+
+	// Update the alert acknowledgment in the mutable stream, keeping the firing sequence so the alert keeps its ID
 	updateQuery := fmt.Sprintf(`
-		INSERT INTO %s (rule_id, entity_id, state, created_at, updated_at, updated_by, comment)
-		VALUES ('%s', '%s', '%s', now(), now(), '%s', '%s')
+		INSERT INTO %s (rule_id, entity_id, state, created_at, updated_at, updated_by, comment, firing_seq)
+		VALUES ('%s', '%s', '%s', now(), now(), '%s', '%s', %d)
 	`,
-		timeplus.AlertAcksMutableStream,
-		ruleID,
-		entityID,
+		timeplus.AlertAcksStreamFor(ruleID),
+		strings.ReplaceAll(ruleID, "'", "''"),
+		strings.ReplaceAll(entityID, "'", "''"),
 		timeplus.AlertStateAcknowledged,
-		acknowledgedBy,
-		comment)
+		strings.ReplaceAll(acknowledgedBy, "'", "''"),
+		strings.ReplaceAll(comment, "'", "''"),
+		firingSeq)
 
 	_, err = s.tpClient.ExecuteQuery(ctx, updateQuery)
 	if err != nil {
 		return fmt.Errorf("failed to acknowledge entity: %w", err)
 	}
 
+	s.recordAlertAudit(ctx, ruleID, entityID, firingSeq, timeplus.AlertAuditActionAcknowledged, acknowledgedBy, comment)
 	logrus.Infof("Entity %s with rule %s acknowledged by %s", entityID, ruleID, acknowledgedBy)
 	return nil
 }
@@ -1733,7 +2371,7 @@ func (s *RuleService) CreateAlertFromData(ctx context.Context, rule *models.Rule
 	}
 
 	// Convert to JSON
-	dataJSON, err := json.Marshal(data)
+	dataJSON, err := timeplus.MarshalRowData(data)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal data to JSON: %w", err)
 	}
@@ -1742,12 +2380,12 @@ func (s *RuleService) CreateAlertFromData(ctx context.Context, rule *models.Rule
 	alert := &models.Alert{
 		ID:           alertID,
 		RuleID:       rule.ID,
-		RuleName:     rule.Name,
-		Severity:     rule.Severity,
 		TriggeredAt:  now,
 		Data:         string(dataJSON),
 		Acknowledged: false,
 	}
+	setAlertRuleDetails(alert, rule)
+	enrichAlert(alert, rule, data)
 
 	// Persist to alert stream
 	if err := s.persistAlert(ctx, alert); err != nil {
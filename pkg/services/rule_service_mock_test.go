@@ -170,7 +170,7 @@ func TestGetRulesWithMock(t *testing.T) {
 	}
 
 	// Call GetRules
-	rules, err := service.GetRules()
+	rules, err := service.GetRules(context.Background())
 
 	// Assert expectations
 	assert.NoError(t, err)
@@ -244,7 +244,7 @@ func TestGetAlertWithMock(t *testing.T) {
 	}
 
 	// Call GetAlert with properly formatted ID (rule_id:entity_id)
-	alert, err := service.GetAlert("rule1:entity123")
+	alert, err := service.GetAlert(context.Background(), "rule1:entity123")
 
 	// Assert expectations
 	assert.NoError(t, err)
@@ -339,6 +339,12 @@ func TestAcknowledgeAlertWithMock(t *testing.T) {
 			strings.Contains(query, "ORDER BY updated_at DESC")
 	})).Return(acknowledgedAlertData, nil)
 
+	// Mock the audit entry recorded for the acknowledgment
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO "+timeplus.AlertAuditStream) &&
+			strings.Contains(query, "'acknowledged', 'test-user'")
+	})).Return([]map[string]interface{}{}, nil)
+
 	// Remove the direct mock for GetRule since we're mocking the underlying query
 	// Create a rule service with the mock client
 	service := &RuleService{
@@ -348,11 +354,11 @@ func TestAcknowledgeAlertWithMock(t *testing.T) {
 	}
 
 	// Step 1: Acknowledge the alert
-	err := service.AcknowledgeAlert("rule1:entity123", "test-user")
+	err := service.AcknowledgeAlert(context.Background(), "rule1:entity123", "test-user")
 	assert.NoError(t, err)
 
 	// Step 2: Get the alert to verify it's acknowledged
-	alert, err := service.GetAlert("rule1:entity123")
+	alert, err := service.GetAlert(context.Background(), "rule1:entity123")
 	assert.NoError(t, err)
 	assert.Equal(t, "rule1", alert.RuleID)
 	assert.Equal(t, "Test Rule", alert.RuleName)
@@ -113,7 +113,7 @@ func TestStartStopRule(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify the rule is running
-	runningRule, err := service.GetRule(rule.ID)
+	runningRule, err := service.GetRule(ctx, rule.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, models.RuleStatusRunning, runningRule.Status)
 
@@ -122,7 +122,7 @@ func TestStartStopRule(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Verify the rule is stopped
-	stoppedRule, err := service.GetRule(rule.ID)
+	stoppedRule, err := service.GetRule(ctx, rule.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, models.RuleStatusStopped, stoppedRule.Status)
 }
@@ -160,11 +160,11 @@ func TestAcknowledgeAlert(t *testing.T) {
 	require.NotEmpty(t, alertID)
 
 	// Test acknowledging the alert
-	err = service.AcknowledgeAlert(alertID, "test-user")
+	err = service.AcknowledgeAlert(ctx, alertID, "test-user")
 	assert.NoError(t, err)
 
 	// Verify the alert is acknowledged
-	alert, err := service.GetAlert(alertID)
+	alert, err := service.GetAlert(ctx, alertID)
 	assert.NoError(t, err)
 	assert.True(t, alert.Acknowledged)
 	assert.Equal(t, "test-user", alert.AcknowledgedBy)
@@ -319,9 +319,39 @@ func TestAlertAcknowledgmentWithMock(t *testing.T) {
 	}
 
 	// Test acknowledging an alert
-	err := service.AcknowledgeAlert("rule1:device_123", "test-user")
+	err := service.AcknowledgeAlert(context.Background(), "rule1:device_123", "test-user")
 	assert.NoError(t, err)
 
 	// Verify that all expected mock calls were made
 	mockClient.AssertExpectations(t)
 }
+
+// ackQueryStore is a rule store that only runs queries, answering with the given rows. Other
+// methods panic, so a test using it fails if the code under test needs more than queries.
+type ackQueryStore struct {
+	timeplus.RuleStore
+	rows    []map[string]interface{}
+	queries []string
+}
+
+func (s *ackQueryStore) ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	s.queries = append(s.queries, query)
+	if strings.Contains(query, "INSERT") {
+		return nil, nil
+	}
+	return s.rows, nil
+}
+
+func TestAcknowledgeDeviceWithRuleStore(t *testing.T) {
+	store := &ackQueryStore{rows: []map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "device_123", "state": timeplus.AlertStateActive},
+	}}
+	service := &RuleService{tpClient: store, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	require.NoError(t, service.AcknowledgeDevice(context.Background(), "rule1", "device_123", "test-user", "Test comment"))
+	require.NotEmpty(t, store.queries)
+	assert.Contains(t, store.queries[len(store.queries)-1], "INSERT")
+
+	// The alert monitor streams from the same narrow store
+	assert.NotNil(t, NewAlertMonitor(service, store))
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// DefaultStatsWindow is the sampling window used for rule stats when none is given
+const DefaultStatsWindow = 5 * time.Minute
+
+// RuleStats holds sampled evaluation metrics for a rule
+type RuleStats struct {
+	RuleID        string     `json:"ruleId"`
+	RuleName      string     `json:"ruleName"`
+	Status        string     `json:"status"`
+	Shadow        bool       `json:"shadow,omitempty"` // Alerts are would-be alerts recorded in the result stream
+	WindowSeconds int        `json:"windowSeconds"`
+	Rows          int64      `json:"rows"`          // Rows that flowed through the rule view in the window
+	RowsPerSecond float64    `json:"rowsPerSecond"` // Rows / window
+	LastEventAt   *time.Time `json:"lastEventAt,omitempty"`
+	Alerts        int64      `json:"alerts"`   // Alerts created in the window that carry an event time
+	AvgLagMs      float64    `json:"avgLagMs"` // Average delay between event _tp_time and alert creation
+	P95LagMs      float64    `json:"p95LagMs"` // 95th percentile of that delay
+	MaxLagMs      float64    `json:"maxLagMs"` // Maximum of that delay
+	SampledAt     time.Time  `json:"sampledAt"`
+}
+
+// GetRuleStats samples throughput and alert lag for a rule over the given window.
+// Throughput is measured on the rule's plain view; lag compares the event_time the rule's
+// materialized view records for each alert with the time the alert was written. Shadow rules
+// report their would-be alerts.
+func (s *RuleService) GetRuleStats(ctx context.Context, ruleID string, window time.Duration) (*RuleStats, error) {
+	rule, err := s.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sampleRuleStats(ctx, rule, window)
+}
+
+// GetAllRuleStats samples stats for every running rule
+func (s *RuleService) GetAllRuleStats(ctx context.Context, window time.Duration) ([]*RuleStats, error) {
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]*RuleStats, 0, len(rules))
+	for _, rule := range rules {
+		if !ruleEvaluating(rule) {
+			continue
+		}
+		ruleStats, err := s.sampleRuleStats(ctx, rule, window)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample stats for rule %s: %w", rule.ID, err)
+		}
+		stats = append(stats, ruleStats)
+	}
+	return stats, nil
+}
+
+// sampleRuleStats runs the sampling queries for a single rule
+func (s *RuleService) sampleRuleStats(ctx context.Context, rule *models.Rule, window time.Duration) (*RuleStats, error) {
+	if window <= 0 {
+		window = DefaultStatsWindow
+	}
+	windowSeconds := int(window.Seconds())
+
+	stats := &RuleStats{
+		RuleID:        rule.ID,
+		RuleName:      rule.Name,
+		Status:        string(rule.Status),
+		Shadow:        rule.Shadow,
+		WindowSeconds: windowSeconds,
+		SampledAt:     time.Now(),
+	}
+
+	// Views only exist while the rule is running
+	if !ruleEvaluating(rule) {
+		return stats, nil
+	}
+
+	res := getRuleResources(rule)
+
+	// Aggregate views emit rows without _tp_time, so throughput is only sampled for query rules
+	if ruleViewSupportsHistory(rule) {
+		throughputQuery := fmt.Sprintf("SELECT count() AS rows, max(_tp_time) AS last_event FROM table(`%s`) WHERE _tp_time >= now() - INTERVAL %d SECOND",
+			res.PlainView, windowSeconds)
+		rows, err := s.tpClient.ExecuteQuery(ctx, throughputQuery)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample rule view throughput: %w", err)
+		}
+		if len(rows) > 0 {
+			stats.Rows = getInt64(rows[0], "rows")
+			if lastEvent := getTime(rows[0], "last_event"); stats.Rows > 0 && !lastEvent.IsZero() {
+				stats.LastEventAt = &lastEvent
+			}
+		}
+		stats.RowsPerSecond = float64(stats.Rows) / float64(windowSeconds)
+	}
+
+	lagExpr := "to_unix_timestamp64_milli(updated_at) - to_unix_timestamp64_milli(event_time)"
+	lagQuery := fmt.Sprintf(`SELECT count() AS alerts, avg(%s) AS avg_lag, quantile(0.95)(%s) AS p95_lag, max(%s) AS max_lag
+		FROM table(`+"`%s`"+`)
+		WHERE rule_id = '%s' AND state = 'active' AND event_time IS NOT NULL AND updated_at >= now() - INTERVAL %d SECOND`,
+		lagExpr, lagExpr, lagExpr, res.AlertsStream, rule.ID, windowSeconds)
+	lagRows, err := s.tpClient.ExecuteQuery(ctx, lagQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample alert lag: %w", err)
+	}
+	if len(lagRows) > 0 {
+		stats.Alerts = getInt64(lagRows[0], "alerts")
+		if stats.Alerts > 0 {
+			stats.AvgLagMs = getFloat64(lagRows[0], "avg_lag")
+			stats.P95LagMs = getFloat64(lagRows[0], "p95_lag")
+			stats.MaxLagMs = getFloat64(lagRows[0], "max_lag")
+		}
+	}
+
+	return stats, nil
+}
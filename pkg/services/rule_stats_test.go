@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRuleStats(t *testing.T) {
+	mockClient := new(MockClient)
+	lastEvent := time.Now().Add(-2 * time.Second)
+
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "table(`rule_rule1_view`)")
+	})).Return([]map[string]interface{}{
+		{"rows": uint64(120), "last_event": lastEvent},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "event_time IS NOT NULL")
+	})).Return([]map[string]interface{}{
+		{"alerts": uint64(3), "avg_lag": 250.0, "p95_lag": 400.0, "max_lag": float64(420)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "running"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	stats, err := service.GetRuleStats(context.Background(), "rule1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 60, stats.WindowSeconds)
+	assert.Equal(t, int64(120), stats.Rows)
+	assert.Equal(t, 2.0, stats.RowsPerSecond)
+	require.NotNil(t, stats.LastEventAt)
+	assert.True(t, lastEvent.Equal(*stats.LastEventAt))
+	assert.Equal(t, int64(3), stats.Alerts)
+	assert.Equal(t, 250.0, stats.AvgLagMs)
+	assert.Equal(t, 400.0, stats.P95LagMs)
+	assert.Equal(t, 420.0, stats.MaxLagMs)
+}
+
+func TestGetRuleStatsStoppedRule(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "status": "stopped"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	stats, err := service.GetRuleStats(context.Background(), "rule1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int(DefaultStatsWindow.Seconds()), stats.WindowSeconds)
+	assert.Zero(t, stats.Rows)
+
+	// Only the rule lookup ran, no sampling queries against missing views
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
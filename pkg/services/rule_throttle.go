@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// throttleOnlyUpdate reports whether an update request changes nothing but the throttle
+func throttleOnlyUpdate(req *models.UpdateRuleRequest) bool {
+	return req.ThrottleMinutes != nil && reflect.DeepEqual(*req, models.UpdateRuleRequest{ThrottleMinutes: req.ThrottleMinutes})
+}
+
+// updateRunningRuleThrottle changes the throttle of a running rule without stopping it
+func (s *RuleService) updateRunningRuleThrottle(ctx context.Context, rule *models.Rule, minutes int) (*models.Rule, error) {
+	if rule.ThrottleMinutes == minutes {
+		return rule, nil
+	}
+
+	previous := rule.ThrottleMinutes
+	rule.ThrottleMinutes = minutes
+	rule.UpdatedAt = time.Now()
+	if err := s.persistRule(ctx, rule, true); err != nil {
+		return nil, fmt.Errorf("failed to persist updated rule: %w", err)
+	}
+	if err := s.applyRuleThrottle(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Changed throttle of rule %s (%s) from %d to %d minute(s)", rule.Name, rule.ID, previous, minutes)
+	return rule, nil
+}
+
+// applyRuleThrottle recreates the throttled materialized view of a running rule with the rule's
+// throttle. The plain view, resolve views and alert history are kept, and throttling carries on from
+// the alert acks stream, so entities alerted recently stay throttled. Rules that aren't running pick
+// the throttle up when they start. Rows arriving while the view is recreated are not evaluated.
+func (s *RuleService) applyRuleThrottle(ctx context.Context, rule *models.Rule) error {
+	if !ruleEvaluating(rule) {
+		return nil
+	}
+
+	// Rules started before the entity ID column was recorded can't have their view rebuilt on its own
+	if rule.EntityIDColumn == "" {
+		if _, err := s.RebuildRule(ctx, rule.ID, false); err != nil {
+			return fmt.Errorf("failed to apply the throttle: %w", err)
+		}
+		return nil
+	}
+
+	res := getRuleResources(rule)
+	columns, err := s.tpClient.ExecuteQuery(ctx, fmt.Sprintf("DESCRIBE `%s`", res.PlainView))
+	if err != nil {
+		return fmt.Errorf("failed to get view columns of rule %s: %w", rule.ID, err)
+	}
+
+	dataExpr, err := ruleDataExpression(rule, columns, rule.EntityIDColumn)
+	if err != nil {
+		return err
+	}
+	query := timeplus.GetRuleThrottledMaterializedViewQuery(
+		rule.ID,
+		res.PlainView,
+		res.MaterializedView,
+		rule.ThrottleMinutes,
+		rule.EntityIDColumn,
+		dataExpr,
+		res.AlertsStream,
+		ruleSeverityExpression(rule),
+		eventTimeExpression(columns),
+		ruleStagingStream(rule),
+	)
+
+	if err := s.tpClient.ExecuteDDL(ctx, fmt.Sprintf("DROP VIEW IF EXISTS `%s`", res.MaterializedView)); err != nil {
+		return fmt.Errorf("failed to drop materialized view of rule %s: %w", rule.ID, err)
+	}
+	if err := s.tpClient.ExecuteDDL(ctx, query); err != nil {
+		// The rule no longer evaluates, so it's failed until restarted
+		rule.Status = models.RuleStatusFailed
+		recordRuleError(rule, models.RulePhaseThrottle, query, fmt.Sprintf("Failed to recreate materialized view with the new throttle: %v", err))
+		rule.UpdatedAt = time.Now()
+		s.persistRule(ctx, rule, true)
+		s.monitorRuleStopped(rule.ID)
+		return fmt.Errorf("failed to recreate materialized view of rule %s: %w", rule.ID, err)
+	}
+	return nil
+}
+
+// triggeringDataColumns returns the columns of a rule's plain view captured as the triggering data of
+// its alerts, leaving out internal columns and the entity ID column
+func triggeringDataColumns(viewColumns []map[string]interface{}, idColumnName string) []timeplus.Column {
+	var columns []timeplus.Column
+	for _, column := range viewColumns {
+		name := getString(column, "name")
+		if name == "" || name == "_tp_time" || name == "_tp_sn" || name == idColumnName {
+			continue
+		}
+		columns = append(columns, timeplus.Column{Name: name, Type: getString(column, "type")})
+	}
+	return columns
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func throttleMockClient(ddlErr error) *MockClient {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, "DESCRIBE `rule_r1_view`").Return([]map[string]interface{}{
+		{"name": "device_id", "type": "string"},
+		{"name": "temperature", "type": "float64"},
+		{"name": "_tp_time", "type": "datetime64(3, 'UTC')"},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Hot", "status": "running", "severity": "warning", "throttle_minutes": 5, "entity_id_column": "device_id"},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("ExecuteDDL", mock.Anything, "DROP VIEW IF EXISTS `rule_r1_mv`").Return(nil)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "CREATE MATERIALIZED VIEW")
+	})).Return(ddlErr)
+	return mockClient
+}
+
+func TestUpdateRunningRuleThrottleRecreatesOnlyMaterializedView(t *testing.T) {
+	mockClient := throttleMockClient(nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	throttle := 30
+	rule, err := service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{ThrottleMinutes: &throttle})
+	require.NoError(t, err)
+	assert.Equal(t, 30, rule.ThrottleMinutes)
+	assert.Equal(t, models.RuleStatusRunning, rule.Status)
+	assert.Equal(t, 30, persistedRule(t, mockClient)["throttle_minutes"])
+
+	var ddl []string
+	for _, call := range mockClient.Calls {
+		if call.Method == "ExecuteDDL" {
+			ddl = append(ddl, call.Arguments.String(1))
+		}
+	}
+	require.Len(t, ddl, 2, "only the materialized view is dropped and created")
+	assert.Contains(t, ddl[1], "`rule_r1_mv`")
+	assert.Contains(t, ddl[1], "30m")
+	assert.Contains(t, ddl[1], "rule_r1_view")
+
+	// Anything else still needs the rule stopped
+	name := "Hotter"
+	_, err = service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{Name: &name, ThrottleMinutes: &throttle})
+	assert.ErrorContains(t, err, "cannot update rule in running state")
+}
+
+func TestUpdateRunningRuleThrottleFailsRuleWhenViewCantBeRecreated(t *testing.T) {
+	mockClient := throttleMockClient(assert.AnError)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	throttle := 30
+	_, err := service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{ThrottleMinutes: &throttle})
+	require.Error(t, err)
+
+	row := persistedRule(t, mockClient)
+	assert.Equal(t, string(models.RuleStatusFailed), row["status"])
+	assert.Equal(t, 30, row["throttle_minutes"])
+}
+
+func TestTriggeringDataColumns(t *testing.T) {
+	columns := triggeringDataColumns([]map[string]interface{}{
+		{"name": "device_id", "type": "string"},
+		{"name": "temperature", "type": "float64"},
+		{"name": "_tp_time", "type": "datetime64(3)"},
+		{"name": "_tp_sn", "type": "int64"},
+	}, "device_id")
+	require.Len(t, columns, 1)
+	assert.Equal(t, "temperature", columns[0].Name)
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// ErrInvalidRule is returned when a rule definition is incomplete or inconsistent
+var ErrInvalidRule = errors.New("invalid rule")
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	intervalPattern   = regexp.MustCompile(`^[0-9]+[smhd]$`)
+)
+
+// comparisonOperators are the operators allowed in generated threshold conditions
+var comparisonOperators = map[string]bool{">": true, ">=": true, "<": true, "<=": true, "=": true, "!=": true}
+
+// windowAggregations are the aggregate functions allowed in window rules
+var windowAggregations = map[string]bool{"avg": true, "min": true, "max": true, "sum": true, "count": true}
+
+// applyRuleType validates a rule's type and, for generated rule types, builds its query from the spec
+func applyRuleType(rule *models.Rule) error {
+	switch rule.Type {
+	case "", models.RuleTypeQuery:
+		if strings.TrimSpace(rule.Query) == "" {
+			return fmt.Errorf("%w: query is required", ErrInvalidRule)
+		}
+		return nil
+	case models.RuleTypeWindow:
+		if rule.Spec == nil || rule.Spec.Window == nil {
+			return fmt.Errorf("%w: window rules require spec.window", ErrInvalidRule)
+		}
+		query, err := buildWindowQuery(rule.Spec.Window)
+		if err != nil {
+			return err
+		}
+		rule.Query = query
+		rule.EntityIDColumns = rule.Spec.Window.EntityColumn
+		return nil
+	case models.RuleTypeAbsence:
+		if rule.Spec == nil || rule.Spec.Absence == nil {
+			return fmt.Errorf("%w: absence rules require spec.absence", ErrInvalidRule)
+		}
+		query, resolveQuery, err := buildAbsenceQueries(rule.Spec.Absence)
+		if err != nil {
+			return err
+		}
+		rule.Query = query
+		rule.ResolveQuery = resolveQuery
+		rule.EntityIDColumns = rule.Spec.Absence.EntityColumn
+		return nil
+	case models.RuleTypeRate:
+		if rule.Spec == nil || rule.Spec.Rate == nil {
+			return fmt.Errorf("%w: rate rules require spec.rate", ErrInvalidRule)
+		}
+		query, err := buildRateQuery(rule.Spec.Rate)
+		if err != nil {
+			return err
+		}
+		rule.Query = query
+		rule.EntityIDColumns = rule.Spec.Rate.EntityColumn
+		return nil
+	case models.RuleTypeOutlier:
+		if rule.Spec == nil || rule.Spec.Outlier == nil {
+			return fmt.Errorf("%w: outlier rules require spec.outlier", ErrInvalidRule)
+		}
+		query, err := buildOutlierQuery(rule.Spec.Outlier)
+		if err != nil {
+			return err
+		}
+		rule.Query = query
+		rule.EntityIDColumns = rule.Spec.Outlier.EntityColumn
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported rule type %q", ErrInvalidRule, rule.Type)
+	}
+}
+
+// buildWindowQuery generates the windowed aggregation query for a window rule
+func buildWindowQuery(spec *models.WindowSpec) (string, error) {
+	for field, name := range map[string]string{"sourceStream": spec.SourceStream, "entityColumn": spec.EntityColumn} {
+		if !identifierPattern.MatchString(name) {
+			return "", fmt.Errorf("%w: %s must be a column or stream name, got %q", ErrInvalidRule, field, name)
+		}
+	}
+	aggregate, valueColumn, err := windowAggregate(spec.Aggregation, spec.Column)
+	if err != nil {
+		return "", err
+	}
+	if !comparisonOperators[spec.Operator] {
+		return "", fmt.Errorf("%w: unsupported operator %q", ErrInvalidRule, spec.Operator)
+	}
+	if !intervalPattern.MatchString(spec.Size) {
+		return "", fmt.Errorf("%w: size must be an interval like 30s, 5m or 1h, got %q", ErrInvalidRule, spec.Size)
+	}
+
+	var window string
+	switch spec.WindowType {
+	case "", "tumble":
+		window = fmt.Sprintf("tumble(`%s`, %s)", spec.SourceStream, spec.Size)
+	case "hop":
+		if !intervalPattern.MatchString(spec.Hop) {
+			return "", fmt.Errorf("%w: hop must be an interval like 30s, 5m or 1h, got %q", ErrInvalidRule, spec.Hop)
+		}
+		window = fmt.Sprintf("hop(`%s`, %s, %s)", spec.SourceStream, spec.Hop, spec.Size)
+	default:
+		return "", fmt.Errorf("%w: unsupported window type %q, expected tumble or hop", ErrInvalidRule, spec.WindowType)
+	}
+
+	return fmt.Sprintf("SELECT window_start, window_end, `%s`, %s AS `%s` FROM %s%s GROUP BY window_start, window_end, `%s` HAVING `%s` %s %v",
+		spec.EntityColumn, aggregate, valueColumn, window, filterClause(spec.Filter), spec.EntityColumn, valueColumn, spec.Operator, spec.Threshold), nil
+}
+
+// buildOutlierQuery generates the query for an outlier rule. Entities are aggregated per tumbling window,
+// the per-entity values of each window are collected into an array together with fleet statistics, and
+// the array is expanded back into one row per entity that is ranked in the top N or deviates from the median.
+func buildOutlierQuery(spec *models.OutlierSpec) (string, error) {
+	for field, name := range map[string]string{"sourceStream": spec.SourceStream, "entityColumn": spec.EntityColumn} {
+		if !identifierPattern.MatchString(name) {
+			return "", fmt.Errorf("%w: %s must be a column or stream name, got %q", ErrInvalidRule, field, name)
+		}
+	}
+	aggregate, valueColumn, err := windowAggregate(spec.Aggregation, spec.Column)
+	if err != nil {
+		return "", err
+	}
+	if !intervalPattern.MatchString(spec.Size) {
+		return "", fmt.Errorf("%w: size must be an interval like 30s, 5m or 1h, got %q", ErrInvalidRule, spec.Size)
+	}
+
+	var expand, condition string
+	switch spec.Method {
+	case models.OutlierMethodTopN:
+		if spec.TopN <= 0 {
+			return "", fmt.Errorf("%w: topN must be a positive number of entities", ErrInvalidRule)
+		}
+		sortFunc := "array_reverse_sort"
+		if spec.Lowest {
+			sortFunc = "array_sort"
+		}
+		expand = fmt.Sprintf("array_slice(%s(x -> tuple_element(x, 2), entities), 1, %d)", sortFunc, spec.TopN)
+	case models.OutlierMethodStdDev:
+		if spec.StdDevs <= 0 {
+			return "", fmt.Errorf("%w: stdDevs must be a positive number", ErrInvalidRule)
+		}
+		expand = "entities"
+		condition = fmt.Sprintf(" WHERE fleet_stddev > 0 AND abs(tuple_element(entity, 2) - fleet_median) > %v * fleet_stddev", spec.StdDevs)
+	default:
+		return "", fmt.Errorf("%w: unsupported outlier method %q, expected %s or %s", ErrInvalidRule, spec.Method,
+			models.OutlierMethodTopN, models.OutlierMethodStdDev)
+	}
+
+	perEntity := fmt.Sprintf("SELECT window_start, window_end, `%s`, %s AS `%s` FROM tumble(`%s`, %s)%s GROUP BY window_start, window_end, `%s`",
+		spec.EntityColumn, aggregate, valueColumn, spec.SourceStream, spec.Size, filterClause(spec.Filter), spec.EntityColumn)
+	fleet := fmt.Sprintf("SELECT window_start, window_end, group_array((`%s`, `%s`)) AS entities, median(`%s`) AS fleet_median, stddev_pop(`%s`) AS fleet_stddev "+
+		"FROM (%s) GROUP BY window_start, window_end",
+		spec.EntityColumn, valueColumn, valueColumn, valueColumn, perEntity)
+
+	return fmt.Sprintf("SELECT window_start, window_end, tuple_element(entity, 1) AS `%s`, tuple_element(entity, 2) AS `%s`, fleet_median, fleet_stddev "+
+		"FROM (%s) ARRAY JOIN %s AS entity%s",
+		spec.EntityColumn, valueColumn, fleet, expand, condition), nil
+}
+
+// windowAggregate validates an aggregation and returns its SQL expression and the name of its value column
+func windowAggregate(aggregation, column string) (string, string, error) {
+	if !windowAggregations[aggregation] {
+		return "", "", fmt.Errorf("%w: unsupported aggregation %q, expected avg, min, max, sum or count", ErrInvalidRule, aggregation)
+	}
+	if aggregation == "count" {
+		return "count()", "count", nil
+	}
+	if !identifierPattern.MatchString(column) {
+		return "", "", fmt.Errorf("%w: column must be a column name, got %q", ErrInvalidRule, column)
+	}
+	return fmt.Sprintf("%s(`%s`)", aggregation, column), aggregation + "_" + column, nil
+}
+
+// filterClause returns a WHERE clause for an optional user supplied filter
+func filterClause(filter string) string {
+	if strings.TrimSpace(filter) == "" {
+		return ""
+	}
+	return fmt.Sprintf(" WHERE %s", filter)
+}
+
+// defaultAbsenceCheckInterval is how often absence rules re-evaluate silence when no interval is given
+const defaultAbsenceCheckInterval = "30s"
+
+// buildAbsenceQueries generates the detection and resolve queries for an absence rule.
+// Detection keeps the last time each entity reported and periodically emits entities that have been
+// silent for longer than the maximum silence; any new row for an entity resolves its alert.
+func buildAbsenceQueries(spec *models.AbsenceSpec) (string, string, error) {
+	for field, name := range map[string]string{"sourceStream": spec.SourceStream, "entityColumn": spec.EntityColumn} {
+		if !identifierPattern.MatchString(name) {
+			return "", "", fmt.Errorf("%w: %s must be a column or stream name, got %q", ErrInvalidRule, field, name)
+		}
+	}
+	if !intervalPattern.MatchString(spec.MaxSilence) {
+		return "", "", fmt.Errorf("%w: maxSilence must be an interval like 30s, 5m or 1h, got %q", ErrInvalidRule, spec.MaxSilence)
+	}
+	checkInterval := spec.CheckInterval
+	if checkInterval == "" {
+		checkInterval = defaultAbsenceCheckInterval
+	}
+	if !intervalPattern.MatchString(checkInterval) {
+		return "", "", fmt.Errorf("%w: checkInterval must be an interval like 30s, 5m or 1h, got %q", ErrInvalidRule, checkInterval)
+	}
+
+	where := filterClause(spec.Filter)
+
+	query := fmt.Sprintf("SELECT `%s`, max(_tp_time) AS last_seen, date_diff('second', max(_tp_time), now()) AS silent_seconds FROM `%s`%s GROUP BY `%s` HAVING last_seen < now() - %s EMIT PERIODIC %s",
+		spec.EntityColumn, spec.SourceStream, where, spec.EntityColumn, spec.MaxSilence, checkInterval)
+	resolveQuery := fmt.Sprintf("SELECT `%s`, _tp_time AS last_seen FROM `%s`%s", spec.EntityColumn, spec.SourceStream, where)
+
+	return query, resolveQuery, nil
+}
+
+// buildRateQuery generates the query for a rate rule. Each entity's rows form a substream, so lag()
+// returns the entity's previous value; the change is scaled to the spec's time unit and compared with the threshold.
+func buildRateQuery(spec *models.RateSpec) (string, error) {
+	for field, name := range map[string]string{"sourceStream": spec.SourceStream, "entityColumn": spec.EntityColumn, "column": spec.Column} {
+		if !identifierPattern.MatchString(name) {
+			return "", fmt.Errorf("%w: %s must be a column or stream name, got %q", ErrInvalidRule, field, name)
+		}
+	}
+	perMillis, err := intervalMillis(spec.Per)
+	if err != nil {
+		return "", fmt.Errorf("%w: per must be an interval like 1s, 1m or 1h, got %q", ErrInvalidRule, spec.Per)
+	}
+	if spec.Threshold <= 0 {
+		return "", fmt.Errorf("%w: threshold must be a positive rate", ErrInvalidRule)
+	}
+
+	var condition string
+	switch spec.Direction {
+	case "", "rising":
+		condition = fmt.Sprintf("rate > %v", spec.Threshold)
+	case "falling":
+		condition = fmt.Sprintf("rate < -%v", spec.Threshold)
+	case "either":
+		condition = fmt.Sprintf("abs(rate) > %v", spec.Threshold)
+	default:
+		return "", fmt.Errorf("%w: unsupported direction %q, expected rising, falling or either", ErrInvalidRule, spec.Direction)
+	}
+
+	where := filterClause(spec.Filter)
+
+	// The first row of each entity has no previous row, so lag() returns the epoch and it is skipped
+	return fmt.Sprintf("SELECT * FROM (SELECT _tp_time, `%s`, `%s`, lag(`%s`) AS previous_value, lag(_tp_time) AS previous_time, "+
+		"(`%s` - lag(`%s`)) * %d / (to_unix_timestamp64_milli(_tp_time) - to_unix_timestamp64_milli(lag(_tp_time))) AS rate "+
+		"FROM `%s`%s PARTITION BY `%s`) WHERE to_unix_timestamp64_milli(previous_time) > 0 AND previous_time < _tp_time AND %s",
+		spec.EntityColumn, spec.Column, spec.Column, spec.Column, spec.Column, perMillis,
+		spec.SourceStream, where, spec.EntityColumn, condition), nil
+}
+
+// intervalMillis converts an interval like 30s, 5m, 1h or 1d to milliseconds
+func intervalMillis(interval string) (int64, error) {
+	if !intervalPattern.MatchString(interval) {
+		return 0, fmt.Errorf("invalid interval %q", interval)
+	}
+	n, err := strconv.ParseInt(interval[:len(interval)-1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("interval %q must not be zero", interval)
+	}
+	unitMillis := map[byte]int64{'s': 1000, 'm': 60 * 1000, 'h': 60 * 60 * 1000, 'd': 24 * 60 * 60 * 1000}
+	return n * unitMillis[interval[len(interval)-1]], nil
+}
+
+// ruleViewSupportsHistory reports whether a rule's view can be queried over historical data by _tp_time.
+// Generated rules rely on streaming aggregates or per-entity substreams, so only query rules qualify.
+func ruleViewSupportsHistory(rule *models.Rule) bool {
+	return rule.Type == "" || rule.Type == models.RuleTypeQuery
+}
+
+// eventTimeExpression returns the expression a rule's materialized view uses as the triggering
+// event's time, given the columns of the rule's view. Windowed aggregations have no _tp_time,
+// so the end of the window is used instead.
+func eventTimeExpression(viewColumns []map[string]interface{}) string {
+	columns := make(map[string]bool, len(viewColumns))
+	for _, column := range viewColumns {
+		columns[getString(column, "name")] = true
+	}
+
+	switch {
+	case columns["_tp_time"]:
+		return "view._tp_time"
+	case columns["window_end"]:
+		return "view.window_end"
+	default:
+		return "now64(3)"
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestApplyRuleTypeWindow(t *testing.T) {
+	rule := &models.Rule{
+		Type: models.RuleTypeWindow,
+		Spec: &models.RuleSpec{Window: &models.WindowSpec{
+			SourceStream: "device_temperatures",
+			EntityColumn: "device_id",
+			Size:         "5m",
+			Aggregation:  "avg",
+			Column:       "temperature",
+			Operator:     ">",
+			Threshold:    30,
+		}},
+	}
+
+	require.NoError(t, applyRuleType(rule))
+	assert.Equal(t, "SELECT window_start, window_end, `device_id`, avg(`temperature`) AS `avg_temperature` "+
+		"FROM tumble(`device_temperatures`, 5m) GROUP BY window_start, window_end, `device_id` HAVING `avg_temperature` > 30", rule.Query)
+	assert.Equal(t, "device_id", rule.EntityIDColumns)
+}
+
+func TestBuildWindowQueryHopCount(t *testing.T) {
+	query, err := buildWindowQuery(&models.WindowSpec{
+		SourceStream: "logins",
+		EntityColumn: "user_id",
+		WindowType:   "hop",
+		Size:         "10m",
+		Hop:          "1m",
+		Aggregation:  "count",
+		Operator:     ">=",
+		Threshold:    5,
+		Filter:       "success = false",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT window_start, window_end, `user_id`, count() AS `count` "+
+		"FROM hop(`logins`, 1m, 10m) WHERE success = false GROUP BY window_start, window_end, `user_id` HAVING `count` >= 5", query)
+}
+
+func TestApplyRuleTypeRejectsInvalidSpecs(t *testing.T) {
+	valid := func() *models.WindowSpec {
+		return &models.WindowSpec{SourceStream: "s", EntityColumn: "id", Size: "5m", Aggregation: "max", Column: "v", Operator: ">"}
+	}
+
+	cases := map[string]func(*models.WindowSpec){
+		"aggregation": func(w *models.WindowSpec) { w.Aggregation = "median" },
+		"operator":    func(w *models.WindowSpec) { w.Operator = "; DROP" },
+		"size":        func(w *models.WindowSpec) { w.Size = "5 minutes" },
+		"column":      func(w *models.WindowSpec) { w.Column = "v; DROP" },
+		"hop":         func(w *models.WindowSpec) { w.WindowType = "hop" },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			spec := valid()
+			mutate(spec)
+			err := applyRuleType(&models.Rule{Type: models.RuleTypeWindow, Spec: &models.RuleSpec{Window: spec}})
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+
+	assert.ErrorIs(t, applyRuleType(&models.Rule{Type: models.RuleTypeWindow}), ErrInvalidRule)
+	assert.ErrorIs(t, applyRuleType(&models.Rule{Type: "unknown"}), ErrInvalidRule)
+	assert.ErrorIs(t, applyRuleType(&models.Rule{}), ErrInvalidRule)
+}
+
+func TestEventTimeExpression(t *testing.T) {
+	assert.Equal(t, "view._tp_time", eventTimeExpression([]map[string]interface{}{{"name": "device_id"}, {"name": "_tp_time"}}))
+	assert.Equal(t, "view.window_end", eventTimeExpression([]map[string]interface{}{{"name": "window_start"}, {"name": "window_end"}}))
+	assert.Equal(t, "now64(3)", eventTimeExpression([]map[string]interface{}{{"name": "device_id"}}))
+}
+
+func TestApplyRuleTypeAbsence(t *testing.T) {
+	rule := &models.Rule{
+		Type: models.RuleTypeAbsence,
+		Spec: &models.RuleSpec{Absence: &models.AbsenceSpec{
+			SourceStream: "device_heartbeats",
+			EntityColumn: "device_id",
+			MaxSilence:   "5m",
+		}},
+	}
+
+	require.NoError(t, applyRuleType(rule))
+	assert.Equal(t, "SELECT `device_id`, max(_tp_time) AS last_seen, date_diff('second', max(_tp_time), now()) AS silent_seconds "+
+		"FROM `device_heartbeats` GROUP BY `device_id` HAVING last_seen < now() - 5m EMIT PERIODIC 30s", rule.Query)
+	assert.Equal(t, "SELECT `device_id`, _tp_time AS last_seen FROM `device_heartbeats`", rule.ResolveQuery)
+	assert.Equal(t, "device_id", rule.EntityIDColumns)
+	assert.False(t, ruleViewSupportsHistory(rule))
+}
+
+func TestBuildAbsenceQueriesWithFilter(t *testing.T) {
+	query, resolveQuery, err := buildAbsenceQueries(&models.AbsenceSpec{
+		SourceStream:  "metrics",
+		EntityColumn:  "host",
+		MaxSilence:    "2m",
+		CheckInterval: "10s",
+		Filter:        "metric = 'heartbeat'",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `host`, max(_tp_time) AS last_seen, date_diff('second', max(_tp_time), now()) AS silent_seconds "+
+		"FROM `metrics` WHERE metric = 'heartbeat' GROUP BY `host` HAVING last_seen < now() - 2m EMIT PERIODIC 10s", query)
+	assert.Equal(t, "SELECT `host`, _tp_time AS last_seen FROM `metrics` WHERE metric = 'heartbeat'", resolveQuery)
+
+	_, _, err = buildAbsenceQueries(&models.AbsenceSpec{SourceStream: "metrics", EntityColumn: "host", MaxSilence: "2 minutes"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	_, _, err = buildAbsenceQueries(&models.AbsenceSpec{SourceStream: "metrics", EntityColumn: "host", MaxSilence: "2m", CheckInterval: "often"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+	assert.ErrorIs(t, applyRuleType(&models.Rule{Type: models.RuleTypeAbsence}), ErrInvalidRule)
+}
+
+func TestApplyRuleTypeRate(t *testing.T) {
+	rule := &models.Rule{
+		Type: models.RuleTypeRate,
+		Spec: &models.RuleSpec{Rate: &models.RateSpec{
+			SourceStream: "device_temperatures",
+			EntityColumn: "device_id",
+			Column:       "temperature",
+			Per:          "1m",
+			Threshold:    5,
+		}},
+	}
+
+	require.NoError(t, applyRuleType(rule))
+	assert.Equal(t, "SELECT * FROM (SELECT _tp_time, `device_id`, `temperature`, lag(`temperature`) AS previous_value, lag(_tp_time) AS previous_time, "+
+		"(`temperature` - lag(`temperature`)) * 60000 / (to_unix_timestamp64_milli(_tp_time) - to_unix_timestamp64_milli(lag(_tp_time))) AS rate "+
+		"FROM `device_temperatures` PARTITION BY `device_id`) WHERE to_unix_timestamp64_milli(previous_time) > 0 AND previous_time < _tp_time AND rate > 5", rule.Query)
+	assert.Equal(t, "device_id", rule.EntityIDColumns)
+}
+
+func TestBuildRateQueryDirections(t *testing.T) {
+	spec := &models.RateSpec{SourceStream: "s", EntityColumn: "id", Column: "v", Per: "1s", Threshold: 2.5}
+
+	for direction, condition := range map[string]string{"falling": "rate < -2.5", "either": "abs(rate) > 2.5"} {
+		spec.Direction = direction
+		query, err := buildRateQuery(spec)
+		require.NoError(t, err)
+		assert.Contains(t, query, "* 1000 /")
+		assert.True(t, strings.HasSuffix(query, condition), query)
+	}
+
+	for name, invalid := range map[string]models.RateSpec{
+		"direction": {SourceStream: "s", EntityColumn: "id", Column: "v", Per: "1m", Threshold: 1, Direction: "sideways"},
+		"per":       {SourceStream: "s", EntityColumn: "id", Column: "v", Per: "0m", Threshold: 1},
+		"threshold": {SourceStream: "s", EntityColumn: "id", Column: "v", Per: "1m"},
+		"column":    {SourceStream: "s", EntityColumn: "id", Column: "v - 1", Per: "1m", Threshold: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := buildRateQuery(&invalid)
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
+
+func TestApplyRuleTypeOutlierStdDev(t *testing.T) {
+	rule := &models.Rule{
+		Type: models.RuleTypeOutlier,
+		Spec: &models.RuleSpec{Outlier: &models.OutlierSpec{
+			SourceStream: "device_temperatures",
+			EntityColumn: "device_id",
+			Size:         "5m",
+			Aggregation:  "avg",
+			Column:       "temperature",
+			Method:       models.OutlierMethodStdDev,
+			StdDevs:      3,
+		}},
+	}
+
+	require.NoError(t, applyRuleType(rule))
+	assert.Equal(t, "SELECT window_start, window_end, tuple_element(entity, 1) AS `device_id`, tuple_element(entity, 2) AS `avg_temperature`, fleet_median, fleet_stddev "+
+		"FROM (SELECT window_start, window_end, group_array((`device_id`, `avg_temperature`)) AS entities, median(`avg_temperature`) AS fleet_median, stddev_pop(`avg_temperature`) AS fleet_stddev "+
+		"FROM (SELECT window_start, window_end, `device_id`, avg(`temperature`) AS `avg_temperature` FROM tumble(`device_temperatures`, 5m) GROUP BY window_start, window_end, `device_id`) "+
+		"GROUP BY window_start, window_end) ARRAY JOIN entities AS entity WHERE fleet_stddev > 0 AND abs(tuple_element(entity, 2) - fleet_median) > 3 * fleet_stddev", rule.Query)
+	assert.Equal(t, "device_id", rule.EntityIDColumns)
+}
+
+func TestBuildOutlierQueryTopN(t *testing.T) {
+	spec := &models.OutlierSpec{SourceStream: "s", EntityColumn: "id", Size: "1m", Aggregation: "count", Method: models.OutlierMethodTopN, TopN: 3}
+
+	query, err := buildOutlierQuery(spec)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(query, "ARRAY JOIN array_slice(array_reverse_sort(x -> tuple_element(x, 2), entities), 1, 3) AS entity"), query)
+
+	spec.Lowest = true
+	query, err = buildOutlierQuery(spec)
+	require.NoError(t, err)
+	assert.Contains(t, query, "array_slice(array_sort(x -> tuple_element(x, 2), entities), 1, 3)")
+
+	for name, invalid := range map[string]models.OutlierSpec{
+		"method":  {SourceStream: "s", EntityColumn: "id", Size: "1m", Aggregation: "count", Method: "zscore"},
+		"topN":    {SourceStream: "s", EntityColumn: "id", Size: "1m", Aggregation: "count", Method: models.OutlierMethodTopN},
+		"stdDevs": {SourceStream: "s", EntityColumn: "id", Size: "1m", Aggregation: "count", Method: models.OutlierMethodStdDev},
+		"size":    {SourceStream: "s", EntityColumn: "id", Size: "1", Aggregation: "count", Method: models.OutlierMethodTopN, TopN: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := buildOutlierQuery(&invalid)
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ErrRuleValidation is returned when a rule refers to streams or SQL that Timeplus rejects
+var ErrRuleValidation = errors.New("rule validation failed")
+
+// RuleValidationProblem is one reason a rule was rejected
+type RuleValidationProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RuleValidationError lists every problem found when validating a rule against Timeplus
+type RuleValidationError struct {
+	Problems []RuleValidationProblem
+}
+
+func (e *RuleValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = fmt.Sprintf("%s: %s", problem.Field, problem.Message)
+	}
+	return fmt.Sprintf("%s: %s", ErrRuleValidation, strings.Join(messages, "; "))
+}
+
+func (e *RuleValidationError) Unwrap() error {
+	return ErrRuleValidation
+}
+
+// validateRuleSources checks a new rule against Timeplus: its source stream and lookup streams
+// must exist, a query rule must read from the source stream it names, Timeplus must accept the
+// rule's queries and they must not be too expensive to run. Problems are collected so they can all
+// be reported at once; failing to reach Timeplus is returned as a plain error.
+func (s *RuleService) validateRuleSources(ctx context.Context, rule *models.Rule, sourceStream string) error {
+	var problems []RuleValidationProblem
+
+	field := "sourceStream"
+	if specStream := ruleSpecSourceStream(rule); specStream != "" {
+		sourceStream = specStream
+		field = fmt.Sprintf("spec.%s.sourceStream", rule.Type)
+	}
+	if sourceStream != "" {
+		exists, err := s.tpClient.StreamExists(ctx, sourceStream)
+		if err != nil {
+			return fmt.Errorf("failed to check source stream %s: %w", sourceStream, err)
+		}
+		if !exists {
+			problems = append(problems, RuleValidationProblem{Field: field, Message: fmt.Sprintf("stream %s does not exist", sourceStream)})
+		} else if rule.Spec == nil && !queryReadsFrom(rule.Query, sourceStream) {
+			problems = append(problems, RuleValidationProblem{Field: "query", Message: fmt.Sprintf("query does not read from source stream %s", sourceStream)})
+		}
+	}
+
+	for i, lookup := range rule.Lookups {
+		exists, err := s.tpClient.StreamExists(ctx, lookup.Stream)
+		if err != nil {
+			return fmt.Errorf("failed to check lookup stream %s: %w", lookup.Stream, err)
+		}
+		if !exists {
+			problems = append(problems, RuleValidationProblem{Field: fmt.Sprintf("lookups[%d].stream", i), Message: fmt.Sprintf("stream %s does not exist", lookup.Stream)})
+		}
+	}
+
+	// Only explain the queries once the streams are known to exist, Timeplus would report the same
+	// missing stream again
+	if len(problems) == 0 {
+		fields, queries := []string{"query"}, []string{ruleViewQuery(rule)}
+		if rule.ResolveQuery != "" {
+			fields, queries = append(fields, "resolveQuery"), append(queries, rule.ResolveQuery)
+		}
+		for i, query := range queries {
+			// Exec doesn't retry, so a rejected query fails fast
+			err := s.tpClient.ExecuteDDL(ctx, "EXPLAIN "+query)
+			if err == nil {
+				continue
+			}
+			exception, ok := timeplus.ServerError(err)
+			if !ok {
+				return fmt.Errorf("failed to validate %s: %w", fields[i], err)
+			}
+			problems = append(problems, RuleValidationProblem{Field: fields[i], Message: exception.Message})
+		}
+	}
+
+	problems = append(problems, s.queryCostProblems(rule)...)
+
+	if len(problems) > 0 {
+		return &RuleValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ruleSpecSourceStream returns the source stream of a generated rule type, or "" for query rules
+func ruleSpecSourceStream(rule *models.Rule) string {
+	if rule.Spec == nil {
+		return ""
+	}
+	switch {
+	case rule.Spec.Window != nil:
+		return rule.Spec.Window.SourceStream
+	case rule.Spec.Absence != nil:
+		return rule.Spec.Absence.SourceStream
+	case rule.Spec.Rate != nil:
+		return rule.Spec.Rate.SourceStream
+	case rule.Spec.Outlier != nil:
+		return rule.Spec.Outlier.SourceStream
+	}
+	return ""
+}
+
+// queryReadsFrom reports whether a query mentions a stream as a whole identifier, quoted or not
+func queryReadsFrom(query, stream string) bool {
+	pattern := regexp.MustCompile("(^|[^A-Za-z0-9_])`?" + regexp.QuoteMeta(stream) + "`?([^A-Za-z0-9_]|$)")
+	return pattern.MatchString(query)
+}
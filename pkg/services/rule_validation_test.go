@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/proto"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestQueryReadsFrom(t *testing.T) {
+	assert.True(t, queryReadsFrom("SELECT * FROM devices WHERE temperature > 30", "devices"))
+	assert.True(t, queryReadsFrom("SELECT * FROM tumble(`devices`, 1m) GROUP BY window_start", "devices"))
+	assert.True(t, queryReadsFrom("SELECT * FROM default.devices", "devices"))
+	assert.False(t, queryReadsFrom("SELECT * FROM devices_v2", "devices"))
+	assert.False(t, queryReadsFrom("SELECT * FROM network_logs", "devices"))
+}
+
+func TestValidateRuleSourcesReportsAllProblems(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "devices").Return(true, nil)
+	mockClient.On("StreamExists", mock.Anything, "sites").Return(false, nil)
+
+	service := &RuleService{tpClient: mockClient}
+	rule := &models.Rule{
+		Query:   "SELECT * FROM network_logs WHERE status_code >= 500",
+		Lookups: []models.RuleLookup{{Stream: "sites", Key: "site_id"}},
+	}
+
+	err := service.validateRuleSources(context.Background(), rule, "devices")
+	var validationErr *RuleValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.True(t, errors.Is(err, ErrRuleValidation))
+	assert.Equal(t, []RuleValidationProblem{
+		{Field: "query", Message: "query does not read from source stream devices"},
+		{Field: "lookups[0].stream", Message: "stream sites does not exist"},
+	}, validationErr.Problems)
+
+	// Queries aren't explained while streams are missing
+	mockClient.AssertNotCalled(t, "ExecuteDDL", mock.Anything, mock.Anything)
+}
+
+func TestValidateRuleSourcesExplainsQueries(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "devices").Return(true, nil)
+	mockClient.On("ExecuteDDL", mock.Anything, "EXPLAIN SELECT * FROM devices WHERE temperature > 30").Return(nil)
+	mockClient.On("ExecuteDDL", mock.Anything, "EXPLAIN SELECT * FROM device WHERE temperature < 25").
+		Return(fmt.Errorf("failed to execute DDL query: %w", &proto.Exception{Code: 60, Message: "Stream default.device doesn't exist"}))
+
+	service := &RuleService{tpClient: mockClient}
+	rule := &models.Rule{
+		Query:        "SELECT * FROM devices WHERE temperature > 30",
+		ResolveQuery: "SELECT * FROM device WHERE temperature < 25",
+	}
+
+	err := service.validateRuleSources(context.Background(), rule, "devices")
+	var validationErr *RuleValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []RuleValidationProblem{
+		{Field: "resolveQuery", Message: "Stream default.device doesn't exist"},
+	}, validationErr.Problems)
+}
+
+func TestValidateRuleSourcesConnectionError(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteDDL", mock.Anything, mock.Anything).Return(errors.New("EOF"))
+
+	service := &RuleService{tpClient: mockClient}
+	err := service.validateRuleSources(context.Background(), &models.Rule{Query: "SELECT * FROM devices"}, "")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrRuleValidation), "an unreachable Timeplus isn't the rule's fault")
+}
+
+func TestValidateRuleSourcesUsesSpecSourceStream(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("StreamExists", mock.Anything, "metrics").Return(false, nil)
+
+	service := &RuleService{tpClient: mockClient}
+	rule := &models.Rule{
+		Type:  models.RuleTypeWindow,
+		Spec:  &models.RuleSpec{Window: &models.WindowSpec{SourceStream: "metrics"}},
+		Query: "SELECT window_start FROM tumble(`metrics`, 1m)",
+	}
+
+	err := service.validateRuleSources(context.Background(), rule, "")
+	var validationErr *RuleValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "spec.window.sourceStream", validationErr.Problems[0].Field)
+}
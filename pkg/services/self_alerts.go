@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// Self-alert checks, the built-in meta-rules watching the gateway itself
+const (
+	SelfAlertRuleFailed           = "rule_failed"           // A rule is in the failed state
+	SelfAlertTimeplusReconnects   = "timeplus_reconnects"   // The Timeplus connection keeps dropping
+	SelfAlertNotificationFailures = "notification_failures" // Notifiers fail to deliver events
+	SelfAlertAckBacklog           = "ack_backlog"           // Active alerts pile up unacknowledged
+)
+
+// selfAlertRulePrefix prefixes the rule IDs of self-alerts, e.g. "gateway:rule_failed"
+const selfAlertRulePrefix = "gateway:"
+
+// SelfAlertThresholds configure the self-alert checks. Zero thresholds disable their check; failed
+// rules are always alerted on.
+type SelfAlertThresholds struct {
+	Reconnects              int64   // Timeplus reconnects allowed between two checks
+	NotificationFailureRate float64 // Share of notification deliveries allowed to fail between two checks, 0 to 1
+	MinNotifications        int64   // Deliveries needed between two checks before their failure rate counts
+	AckBacklog              int64   // Active alerts allowed before the backlog is alerted on
+}
+
+// selfAlertBaseline holds the counters seen by the previous self-alert check, which the next check
+// compares against
+type selfAlertBaseline struct {
+	checked    bool
+	reconnects int64
+	delivered  int64
+	failed     int64
+}
+
+// SetSelfAlertThresholds sets the thresholds of the self-alert checks
+func (s *RuleService) SetSelfAlertThresholds(thresholds SelfAlertThresholds) {
+	s.selfAlertThresholds = thresholds
+}
+
+// StartSelfAlerts periodically checks the gateway for problems and notifies them through the
+// notification pipeline. Shutdown stops it.
+func (s *RuleService) StartSelfAlerts(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopSelfAlerts = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.CheckSelfAlerts(ctx)
+			}
+		}
+	}()
+}
+
+// SelfAlerts returns the gateway problems found by the latest self-alert check, oldest first
+func (s *RuleService) SelfAlerts() []*models.Alert {
+	s.selfAlertsMutex.Lock()
+	defer s.selfAlertsMutex.Unlock()
+
+	alerts := make([]*models.Alert, 0, len(s.selfAlerts))
+	for _, alert := range s.selfAlerts {
+		copied := *alert
+		alerts = append(alerts, &copied)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].TriggeredAt.Equal(alerts[j].TriggeredAt) {
+			return alerts[i].TriggeredAt.Before(alerts[j].TriggeredAt)
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+	return alerts
+}
+
+// CheckSelfAlerts runs the self-alert checks. A problem is notified as a gateway_problem event when
+// it's first found and as a gateway_recovered event once a check no longer finds it. Checks that
+// can't run, e.g. while Timeplus is unreachable, keep their problems as they were.
+func (s *RuleService) CheckSelfAlerts(ctx context.Context) []*models.Alert {
+	found := make(map[string]*models.Alert)
+	checked := make(map[string]bool)
+	add := func(alert *models.Alert) { found[alert.ID] = alert }
+
+	if rules, err := s.GetRules(ctx); err != nil {
+		logrus.Warnf("Self-alert check: failed to list rules: %v", err)
+	} else {
+		checked[SelfAlertRuleFailed] = true
+		for _, rule := range rules {
+			if rule.Status != models.RuleStatusFailed {
+				continue
+			}
+			alert := newSelfAlert(SelfAlertRuleFailed, rule.ID, models.RuleSeverityCritical, "Rule failed",
+				fmt.Sprintf("Rule %s (%s) failed: %s", rule.Name, rule.ID, rule.LastError))
+			alert.Owner = rule.Owner
+			alert.Team = rule.Team
+			s.setAlertOnCall(alert, s.withGroupDefaults(rule))
+			add(alert)
+		}
+	}
+
+	s.selfAlertsMutex.Lock()
+	baseline := s.selfAlertBaseline
+	s.selfAlertsMutex.Unlock()
+	next := selfAlertBaseline{checked: true}
+
+	if client, ok := s.tpClient.(connectionStatser); ok {
+		next.reconnects = client.ConnectionStats().Reconnects
+		if reconnects := next.reconnects - baseline.reconnects; baseline.checked && s.selfAlertThresholds.Reconnects > 0 {
+			checked[SelfAlertTimeplusReconnects] = true
+			if reconnects > s.selfAlertThresholds.Reconnects {
+				add(newSelfAlert(SelfAlertTimeplusReconnects, "", models.RuleSeverityCritical, "Timeplus reconnects",
+					fmt.Sprintf("Reconnected to Timeplus %d times since the last check, more than the %d allowed",
+						reconnects, s.selfAlertThresholds.Reconnects)))
+			}
+		}
+	}
+
+	if s.dispatcher != nil {
+		stats := s.dispatcher.Stats()
+		next.delivered, next.failed = stats.Delivered, stats.Failed
+		if baseline.checked && s.selfAlertThresholds.NotificationFailureRate > 0 {
+			failed := stats.Failed - baseline.failed
+			attempts := stats.Delivered - baseline.delivered + failed
+			// Too few deliveries to judge keep the problem as it was, unless none of them failed
+			enough := attempts > 0 && attempts >= s.selfAlertThresholds.MinNotifications
+			checked[SelfAlertNotificationFailures] = enough || failed == 0
+			if enough && float64(failed)/float64(attempts) > s.selfAlertThresholds.NotificationFailureRate {
+				add(newSelfAlert(SelfAlertNotificationFailures, "", models.RuleSeverityCritical, "Notification failures",
+					fmt.Sprintf("%d of %d notification deliveries failed since the last check, more than %.0f%%",
+						failed, attempts, s.selfAlertThresholds.NotificationFailureRate*100)))
+			}
+		}
+	}
+
+	if s.selfAlertThresholds.AckBacklog > 0 {
+		if counts, err := s.GetAlertCounts(ctx, AlertCountGroupNone, timeplus.AlertStateActive, ""); err != nil {
+			logrus.Warnf("Self-alert check: failed to count active alerts: %v", err)
+		} else {
+			checked[SelfAlertAckBacklog] = true
+			if counts.Total > s.selfAlertThresholds.AckBacklog {
+				add(newSelfAlert(SelfAlertAckBacklog, "", models.RuleSeverityWarning, "Acknowledgement backlog",
+					fmt.Sprintf("%d alerts are waiting to be acknowledged, more than the %d allowed",
+						counts.Total, s.selfAlertThresholds.AckBacklog)))
+			}
+		}
+	}
+
+	s.selfAlertsMutex.Lock()
+	if s.selfAlerts == nil {
+		s.selfAlerts = make(map[string]*models.Alert)
+	}
+	s.selfAlertBaseline = next
+	var fired, recovered []*models.Alert
+	for id, alert := range found {
+		if _, active := s.selfAlerts[id]; !active {
+			s.selfAlerts[id] = alert
+			fired = append(fired, alert)
+		}
+	}
+	for id, alert := range s.selfAlerts {
+		if _, still := found[id]; !still && checked[selfAlertCheck(alert)] {
+			delete(s.selfAlerts, id)
+			recovered = append(recovered, alert)
+		}
+	}
+	s.selfAlertsMutex.Unlock()
+
+	for _, alert := range fired {
+		logrus.Warnf("Gateway problem %s: %s", alert.ID, alert.Summary)
+		s.dispatchSelfAlert(notify.EventGatewayProblem, alert)
+	}
+	for _, alert := range recovered {
+		logrus.Infof("Gateway problem %s cleared", alert.ID)
+		s.dispatchSelfAlert(notify.EventGatewayRecovered, alert)
+	}
+	return s.SelfAlerts()
+}
+
+// dispatchSelfAlert sends a self-alert event through the notification pipeline, if there is one
+func (s *RuleService) dispatchSelfAlert(eventType string, alert *models.Alert) {
+	if s.dispatcher == nil {
+		return
+	}
+	copied := *alert
+	if err := s.dispatcher.Dispatch(notify.NewEvent(eventType, &copied)); err != nil {
+		logrus.Warnf("Failed to notify gateway problem %s: %v", alert.ID, err)
+	}
+}
+
+// newSelfAlert creates the alert of a self-alert check. subject tells apart problems of the same
+// check, such as the failed rule.
+func newSelfAlert(check, subject string, severity models.RuleSeverity, name, summary string) *models.Alert {
+	ruleID := selfAlertRulePrefix + check
+	id := ruleID
+	if subject != "" {
+		id += ":" + subject
+	}
+	return &models.Alert{
+		ID:          id,
+		RuleID:      ruleID,
+		RuleName:    "Gateway: " + name,
+		Severity:    severity,
+		TriggeredAt: time.Now(),
+		Summary:     summary,
+	}
+}
+
+// selfAlertCheck returns the check that raised a self-alert
+func selfAlertCheck(alert *models.Alert) string {
+	return alert.RuleID[len(selfAlertRulePrefix):]
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+// selfAlertMockClient returns the given rules and number of active alerts
+func selfAlertMockClient(rules []map[string]interface{}, active uint64) *MockClient {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "count()")
+	})).Return([]map[string]interface{}{{"key": "", "count": active}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return(rules, nil)
+	return mockClient
+}
+
+func TestCheckSelfAlertsFiresAndRecovers(t *testing.T) {
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{ruleStream: "tp_rules"}
+	service.SetNotificationDispatcher(dispatcher)
+	service.SetSelfAlertThresholds(SelfAlertThresholds{AckBacklog: 10})
+
+	service.tpClient = selfAlertMockClient([]map[string]interface{}{
+		{"id": "r1", "name": "Broken", "status": "failed", "last_error": "stream missing", "owner": "alice"},
+		{"id": "r2", "name": "Fine", "status": "running"},
+	}, 25)
+	alerts := service.CheckSelfAlerts(context.Background())
+	require.Len(t, alerts, 2)
+	ids := []string{alerts[0].ID, alerts[1].ID}
+	assert.ElementsMatch(t, []string{"gateway:rule_failed:r1", "gateway:ack_backlog"}, ids)
+
+	// Problems that persist aren't notified again
+	service.CheckSelfAlerts(context.Background())
+
+	service.tpClient = selfAlertMockClient([]map[string]interface{}{{"id": "r1", "name": "Broken", "status": "running"}}, 3)
+	assert.Empty(t, service.CheckSelfAlerts(context.Background()))
+
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	require.Len(t, recorder.events, 4)
+	byType := map[string][]string{}
+	for _, event := range recorder.events {
+		byType[event.Type] = append(byType[event.Type], event.Alert.ID)
+		if event.Alert.ID == "gateway:rule_failed:r1" {
+			assert.Equal(t, "alice", event.Alert.Owner)
+			assert.Equal(t, "Rule Broken (r1) failed: stream missing", event.Alert.Summary)
+		}
+	}
+	assert.Len(t, byType[notify.EventGatewayProblem], 2)
+	assert.ElementsMatch(t, byType[notify.EventGatewayProblem], byType[notify.EventGatewayRecovered])
+}
+
+// failingNotifier fails every delivery
+type failingNotifier struct{}
+
+func (failingNotifier) Name() string { return "failing" }
+
+func (failingNotifier) Notify(ctx context.Context, event notify.Event) error {
+	return errors.New("receiver down")
+}
+
+func TestCheckSelfAlertsNotificationFailures(t *testing.T) {
+	dispatcher := notify.NewDispatcher(10, 1, failingNotifier{})
+	dispatcher.SetRetry(1, 0)
+	service := &RuleService{tpClient: selfAlertMockClient(nil, 0), ruleStream: "tp_rules"}
+	service.SetNotificationDispatcher(dispatcher)
+	service.SetSelfAlertThresholds(SelfAlertThresholds{NotificationFailureRate: 0.5, MinNotifications: 3})
+
+	// The first check only records the counters later checks compare against
+	assert.Empty(t, service.CheckSelfAlerts(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{RuleID: "r1"})))
+	}
+	require.Eventually(t, func() bool { return dispatcher.Stats().Failed == 2 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, service.CheckSelfAlerts(context.Background()), "too few deliveries to judge")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, dispatcher.Dispatch(notify.NewEvent(notify.EventFired, &models.Alert{RuleID: "r1"})))
+	}
+	require.Eventually(t, func() bool { return dispatcher.Stats().Failed == 5 }, time.Second, 10*time.Millisecond)
+	alerts := service.CheckSelfAlerts(context.Background())
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "gateway:notification_failures", alerts[0].ID)
+	assert.Equal(t, "3 of 3 notification deliveries failed since the last check, more than 50%", alerts[0].Summary)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// ruleSeverityExpression returns the SQL expression the rule's materialized view uses to compute
+// each alert's severity: the rule's severityExpression if set, otherwise its static severity.
+func ruleSeverityExpression(rule *models.Rule) string {
+	if expr := strings.TrimSpace(rule.SeverityExpression); expr != "" {
+		return fmt.Sprintf("to_string(%s)", expr)
+	}
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(string(rule.Severity), "'", "''"))
+}
+
+// SetSeverityLevels sets the severities rules may use and their order. Nil restores the default
+// levels.
+func (s *RuleService) SetSeverityLevels(levels *models.SeverityLevels) {
+	s.severityLevels = levels
+}
+
+// SeverityLevels returns the severities rules may use, lowest first
+func (s *RuleService) SeverityLevels() *models.SeverityLevels {
+	if s.severityLevels != nil {
+		return s.severityLevels
+	}
+	levels, _ := models.NewSeverityLevels(nil)
+	return levels
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestRuleSeverityExpression(t *testing.T) {
+	static := &models.Rule{Severity: models.RuleSeverityWarning}
+	assert.Equal(t, "'warning'", ruleSeverityExpression(static))
+
+	dynamic := &models.Rule{
+		Severity:           models.RuleSeverityWarning,
+		SeverityExpression: " CASE WHEN temperature > 40 THEN 'critical' ELSE 'warning' END ",
+	}
+	assert.Equal(t, "to_string(CASE WHEN temperature > 40 THEN 'critical' ELSE 'warning' END)", ruleSeverityExpression(dynamic))
+}
+
+func TestSetAlertRowSeverityOverridesRuleSeverity(t *testing.T) {
+	alert := &models.Alert{}
+	setAlertRuleDetails(alert, &models.Rule{Severity: models.RuleSeverityWarning})
+
+	setAlertRowSeverity(alert, map[string]interface{}{"severity": nil})
+	assert.Equal(t, models.RuleSeverityWarning, alert.Severity)
+
+	setAlertRowSeverity(alert, map[string]interface{}{"severity": "critical"})
+	assert.Equal(t, models.RuleSeverityCritical, alert.Severity)
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// ensureResultStream creates a rule's result stream, which shadow rules record would-be alerts in.
+// It has the alert acks schema, so throttling and resolving work exactly as they would once the
+// rule alerts for real, and a rule switched to shadow mode finds it ready.
+func (s *RuleService) ensureResultStream(ctx context.Context, streamName string) error {
+	if err := s.tpClient.EnsureMutableStream(ctx, streamName, timeplus.GetMutableAlertAcksSchema(), []string{"rule_id", "entity_id"}); err != nil {
+		return fmt.Errorf("failed to ensure result stream %s: %w", streamName, err)
+	}
+	if _, err := timeplus.MigrateStream(ctx, s.tpClient, timeplus.AlertAcksStreamSchema(streamName)); err != nil {
+		return fmt.Errorf("failed to migrate result stream %s: %w", streamName, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+func TestShadowRuleResources(t *testing.T) {
+	dedicated := true
+	rule := &models.Rule{ID: "rule-1", Shadow: true, DedicatedAlertAcksStream: &dedicated}
+
+	res := getRuleResources(rule)
+	assert.Equal(t, "rule_rule_1_alert_acks", res.AlertAcksStream)
+	assert.Equal(t, "rule_rule_1_results", res.ResultStream)
+	assert.Equal(t, "rule_rule_1_results", res.AlertsStream)
+
+	artifacts := ruleArtifactList(rule)
+	assert.Equal(t, RuleArtifact{Role: ArtifactResultStream, Kind: "stream", Name: "rule_rule_1_results"}, artifacts[len(artifacts)-3])
+
+	rule.Shadow = false
+	assert.Equal(t, "rule_rule_1_alert_acks", getRuleResources(rule).AlertsStream)
+}
+
+func TestGetRuleStatsShadowRule(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "table(`rule_rule1_view`)")
+	})).Return([]map[string]interface{}{{"rows": uint64(0)}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "event_time IS NOT NULL") && strings.Contains(query, "table(`rule_rule1_results`)")
+	})).Return([]map[string]interface{}{{"alerts": uint64(7), "avg_lag": 10.0}}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "Noisy rule", "status": "running", "shadow": true, "result_stream": "rule_rule1_results"},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+
+	stats, err := service.GetRuleStats(context.Background(), "rule1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, stats.Shadow)
+	mockClient.AssertCalled(t, "ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "require_entity_id, shadow") && strings.Contains(query, "FROM table(tp_rules)")
+	}))
+	assert.Equal(t, int64(7), stats.Alerts)
+}
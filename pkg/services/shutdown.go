@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrShuttingDown is returned when new work is submitted after shutdown has started
+var ErrShuttingDown = errors.New("alert gateway is shutting down")
+
+// ShutdownReport summarizes what happened to in-flight work during shutdown
+type ShutdownReport struct {
+	CancelledStreams     int      `json:"cancelledStreams"`     // Streaming queries that were cancelled
+	CompletedTasks       int      `json:"completedTasks"`       // In-flight writes/starts that finished before the deadline
+	DroppedTasks         []string `json:"droppedTasks"`         // In-flight work still running when the deadline expired
+	DroppedNotifications int      `json:"droppedNotifications"` // Queued notifications not delivered before the deadline
+}
+
+// taskTracker keeps track of in-flight background work (rule starts, alert/ack writes)
+// so that shutdown can wait for it to finish and report anything that had to be abandoned.
+type taskTracker struct {
+	mu        sync.Mutex
+	nextID    int64
+	tasks     map[int64]string
+	completed int
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func newTaskTracker() *taskTracker {
+	return &taskTracker{tasks: make(map[int64]string)}
+}
+
+// begin registers a new task. It returns ErrShuttingDown once the tracker is closed.
+func (t *taskTracker) begin(name string) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, ErrShuttingDown
+	}
+
+	id := t.nextID
+	t.nextID++
+	t.tasks[id] = name
+	t.wg.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.tasks, id)
+			t.completed++
+			t.mu.Unlock()
+			t.wg.Done()
+		})
+	}, nil
+}
+
+// close stops accepting new tasks and waits for the in-flight ones until ctx is done.
+// It returns the number of tasks completed while draining and the names of the dropped ones.
+func (t *taskTracker) close(ctx context.Context) (int, []string) {
+	t.mu.Lock()
+	t.closed = true
+	completedBefore := t.completed
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dropped := make([]string, 0, len(t.tasks))
+	for _, name := range t.tasks {
+		dropped = append(dropped, name)
+	}
+	sort.Strings(dropped)
+
+	return t.completed - completedBefore, dropped
+}
+
+// trackTask registers in-flight work with the service's task tracker
+func (s *RuleService) trackTask(name string) (func(), error) {
+	if s.tasks == nil {
+		// Services built directly in tests don't have a tracker
+		return func() {}, nil
+	}
+	return s.tasks.begin(name)
+}
+
+// Shutdown quiesces the rule service: it stops accepting new rule starts and alert/ack writes,
+// cancels any streaming queries owned by the service, and waits for pending writes and queued
+// notifications to be flushed until ctx expires. Whatever is still pending at that point is reported as dropped.
+func (s *RuleService) Shutdown(ctx context.Context) ShutdownReport {
+	logrus.Info("Shutting down rule service")
+	report := ShutdownReport{}
+
+	// Stop background checks and cancel streaming queries first so they stop producing work
+	if s.stopSLAEscalation != nil {
+		s.stopSLAEscalation()
+	}
+	if s.stopHealthMonitor != nil {
+		s.stopHealthMonitor()
+	}
+	if s.stopRecommendations != nil {
+		s.stopRecommendations()
+	}
+	if s.stopQuotaGuard != nil {
+		s.stopQuotaGuard()
+	}
+	if s.stopSelfAlerts != nil {
+		s.stopSelfAlerts()
+	}
+	if s.stopGatewayMetrics != nil {
+		s.stopGatewayMetrics()
+	}
+	if s.stopDemoGenerator != nil {
+		s.stopDemoGenerator()
+	}
+	s.stopRuleChangeFeed(ctx)
+	s.ruleContextMutex.Lock()
+	for ruleID, cancel := range s.ruleContexts {
+		cancel()
+		delete(s.ruleContexts, ruleID)
+		report.CancelledStreams++
+	}
+	s.ruleContextMutex.Unlock()
+
+	s.ruleMonitorMutex.Lock()
+	for ruleID, cancel := range s.ruleMonitors {
+		cancel()
+		delete(s.ruleMonitors, ruleID)
+		report.CancelledStreams++
+	}
+	s.ruleMonitorMutex.Unlock()
+
+	// Flush pending writes
+	if s.tasks != nil {
+		report.CompletedTasks, report.DroppedTasks = s.tasks.close(ctx)
+	}
+
+	// Entries the outbox didn't deliver stay pending until the next start
+	if s.outbox != nil {
+		s.outbox.Stop(ctx)
+	}
+
+	// Deliver queued notifications, including those produced by the flushed tasks
+	if s.dispatcher != nil {
+		report.DroppedNotifications = s.dispatcher.Drain(ctx)
+	}
+
+	if report.DroppedNotifications > 0 {
+		logrus.Warnf("Rule service shutdown dropped %d queued notification(s)", report.DroppedNotifications)
+	}
+	if len(report.DroppedTasks) > 0 {
+		logrus.Warnf("Rule service shutdown dropped %d in-flight task(s): %v", len(report.DroppedTasks), report.DroppedTasks)
+	}
+	logrus.Infof("Rule service shutdown complete: cancelled %d stream(s), flushed %d task(s), dropped %d task(s)",
+		report.CancelledStreams, report.CompletedTasks, len(report.DroppedTasks))
+
+	return report
+}
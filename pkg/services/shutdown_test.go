@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleServiceShutdownReportsDroppedTasks(t *testing.T) {
+	service := &RuleService{
+		ruleContexts: make(map[string]context.CancelFunc),
+		ruleMonitors: make(map[string]context.CancelFunc),
+		tasks:        newTaskTracker(),
+	}
+
+	// One streaming query that should be cancelled
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+	service.ruleContexts["rule1"] = streamCancel
+
+	// One task that finishes in time, one that never finishes
+	finished, err := service.trackTask("acknowledge rule1:device_1")
+	require.NoError(t, err)
+	_, err = service.trackTask("start rule rule2")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		finished()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	report := service.Shutdown(ctx)
+
+	assert.Equal(t, 1, report.CancelledStreams)
+	assert.Equal(t, 1, report.CompletedTasks)
+	assert.Equal(t, []string{"start rule rule2"}, report.DroppedTasks)
+	assert.Error(t, streamCtx.Err())
+
+	// New work is rejected once shutdown has started
+	_, err = service.trackTask("acknowledge rule1:device_2")
+	assert.ErrorIs(t, err, ErrShuttingDown)
+}
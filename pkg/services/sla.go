@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// SLA statuses of an alert
+const (
+	SLAStatusPending  = "pending"  // Not acknowledged yet, still within its target
+	SLAStatusMet      = "met"      // Acknowledged within its target
+	SLAStatusBreached = "breached" // Acknowledged late, or still unacknowledged past its target
+)
+
+// SLASeverityReport is the SLA compliance of the alerts of one severity
+type SLASeverityReport struct {
+	Severity           string   `json:"severity"`
+	TargetMinutes      float64  `json:"targetMinutes"`
+	Total              int64    `json:"total"`
+	Met                int64    `json:"met"`
+	Breached           int64    `json:"breached"`          // Acknowledged late plus still open past the target
+	OpenBreached       int64    `json:"openBreached"`      // Still unacknowledged past the target
+	Pending            int64    `json:"pending"`           // Still unacknowledged within the target
+	CompliancePercent  *float64 `json:"compliancePercent"` // Met out of met and breached, null when none have been decided
+	AvgResponseSeconds float64  `json:"avgResponseSeconds"`
+	MaxResponseSeconds float64  `json:"maxResponseSeconds"`
+}
+
+// SLAReport aggregates SLA compliance of the alerts that fired in a time range
+type SLAReport struct {
+	StartTime  time.Time           `json:"startTime"`
+	EndTime    time.Time           `json:"endTime"`
+	RuleID     string              `json:"ruleId,omitempty"`
+	Severities []SLASeverityReport `json:"severities"`
+}
+
+// SetSLATargets sets how long alerts of each severity may stay unacknowledged. Severities
+// without a target have no SLA.
+func (s *RuleService) SetSLATargets(targets map[string]time.Duration) {
+	s.slaTargets = make(map[string]time.Duration, len(targets))
+	for severity, target := range targets {
+		if target > 0 {
+			s.slaTargets[strings.ToLower(severity)] = target
+		}
+	}
+}
+
+// applySLA sets the SLA deadline and status of an alert from its severity's target
+func (s *RuleService) applySLA(alert *models.Alert) {
+	target, ok := s.slaTargets[string(alert.Severity)]
+	if !ok || alert.TriggeredAt.IsZero() {
+		return
+	}
+
+	deadline := alert.TriggeredAt.Add(target)
+	alert.SLADeadline = &deadline
+	switch {
+	case alert.AcknowledgedAt != nil && !alert.AcknowledgedAt.After(deadline):
+		alert.SLAStatus = SLAStatusMet
+	case alert.AcknowledgedAt != nil || time.Now().After(deadline):
+		alert.SLAStatus = SLAStatusBreached
+	default:
+		alert.SLAStatus = SLAStatusPending
+	}
+}
+
+// slaSeverities returns the severities that have an SLA target, sorted for stable queries
+func (s *RuleService) slaSeverities() []string {
+	severities := make([]string, 0, len(s.slaTargets))
+	for severity := range s.slaTargets {
+		severities = append(severities, severity)
+	}
+	sort.Strings(severities)
+	return severities
+}
+
+// slaSource returns a subquery over the alert acks with each alert's effective severity and its SLA
+// target in seconds. Like the alert counts, the severity is the one computed when the alert fired,
+// falling back to the rule's.
+func (s *RuleService) slaSource(conditions []string) string {
+	severities := s.slaSeverities()
+	cases := make([]string, 0, len(severities))
+	quoted := make([]string, 0, len(severities))
+	for _, severity := range severities {
+		literal := fmt.Sprintf("'%s'", strings.ReplaceAll(severity, "'", "''"))
+		cases = append(cases, fmt.Sprintf("sev = %s, %d", literal, int64(s.slaTargets[severity].Seconds())))
+		quoted = append(quoted, literal)
+	}
+
+	where := fmt.Sprintf("WHERE sev IN (%s)", strings.Join(quoted, ", "))
+	if len(conditions) > 0 {
+		where += " AND " + strings.Join(conditions, " AND ")
+	}
+
+	return fmt.Sprintf(`(
+		SELECT a.rule_id AS rule_id, a.entity_id AS entity_id, a.state AS state, a.created_at AS created_at,
+			a.updated_at AS updated_at, a.firing_seq AS firing_seq,
+			coalesce(nullif(a.severity, ''), r.severity) AS sev,
+			multi_if(%s, 0) AS target_seconds
+		FROM %s AS a
+		LEFT JOIN (SELECT id, severity FROM table(%s) WHERE active = true) AS r ON a.rule_id = r.id
+		%s
+	)`, strings.Join(cases, ", "), timeplus.AlertAcksTable(), s.ruleStream, where)
+}
+
+// GetSLAReport aggregates the SLA compliance of alerts that fired between start and end, per
+// severity, with a single aggregate query. ruleID optionally limits the report to one rule.
+func (s *RuleService) GetSLAReport(ctx context.Context, start, end time.Time, ruleID string) (*SLAReport, error) {
+	report := &SLAReport{StartTime: start, EndTime: end, RuleID: ruleID, Severities: []SLASeverityReport{}}
+	if len(s.slaTargets) == 0 {
+		return report, nil
+	}
+
+	conditions := []string{
+		fmt.Sprintf("a.created_at >= %s", timeplus.DateTime64(start)),
+		fmt.Sprintf("a.created_at < %s", timeplus.DateTime64(end)),
+	}
+	if ruleID != "" {
+		conditions = append(conditions, fmt.Sprintf("a.rule_id = '%s'", strings.ReplaceAll(ruleID, "'", "''")))
+	}
+
+	acked := fmt.Sprintf("state != '%s'", timeplus.AlertStateActive)
+	response := "date_diff('second', created_at, updated_at)"
+	age := "date_diff('second', created_at, now())"
+	query := fmt.Sprintf(`SELECT sev AS severity,
+		count() AS total,
+		count_if(%[1]s AND %[2]s <= target_seconds) AS met,
+		count_if(%[1]s AND %[2]s > target_seconds) AS late,
+		count_if(NOT (%[1]s) AND %[3]s > target_seconds) AS open_breached,
+		count_if(NOT (%[1]s) AND %[3]s <= target_seconds) AS pending,
+		avg_if(%[2]s, %[1]s) AS avg_response_seconds,
+		max_if(%[2]s, %[1]s) AS max_response_seconds
+	FROM %[4]s
+	GROUP BY sev
+	ORDER BY sev`, acked, response, age, s.slaSource(conditions))
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate SLA compliance: %w", err)
+	}
+
+	for _, row := range rows {
+		severity := getString(row, "severity")
+		entry := SLASeverityReport{
+			Severity:           severity,
+			TargetMinutes:      s.slaTargets[severity].Minutes(),
+			Total:              getInt64(row, "total"),
+			Met:                getInt64(row, "met"),
+			OpenBreached:       getInt64(row, "open_breached"),
+			Pending:            getInt64(row, "pending"),
+			AvgResponseSeconds: getFloat64(row, "avg_response_seconds"),
+			MaxResponseSeconds: getFloat64(row, "max_response_seconds"),
+		}
+		entry.Breached = getInt64(row, "late") + entry.OpenBreached
+		if decided := entry.Met + entry.Breached; decided > 0 {
+			compliance := float64(entry.Met) / float64(decided) * 100
+			entry.CompliancePercent = &compliance
+		}
+		report.Severities = append(report.Severities, entry)
+	}
+
+	return report, nil
+}
+
+// StartSLAEscalation periodically sends an escalation notification for every active alert that has
+// passed its SLA target. Each firing is escalated once; escalations are recorded in the alert audit
+// stream, which is also how already escalated firings are skipped after a restart.
+func (s *RuleService) StartSLAEscalation(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopSLAEscalation = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.escalateSLABreaches(ctx); err != nil {
+					logrus.Warnf("SLA escalation check failed: %v", err)
+				} else if n > 0 {
+					logrus.Infof("Escalated %d alert(s) past their SLA", n)
+				}
+			}
+		}
+	}()
+}
+
+// escalateSLABreaches notifies about active alerts past their SLA that haven't been escalated yet
+// and returns how many were escalated
+func (s *RuleService) escalateSLABreaches(ctx context.Context) (int, error) {
+	if s.dispatcher == nil || len(s.slaTargets) == 0 {
+		return 0, nil
+	}
+
+	done, err := s.trackTask("SLA escalation")
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	query := fmt.Sprintf(`SELECT rule_id, entity_id, firing_seq, target_seconds
+	FROM %s
+	WHERE date_diff('second', created_at, now()) > target_seconds
+		AND (rule_id, entity_id, firing_seq) NOT IN (
+			SELECT rule_id, entity_id, firing_seq FROM table(%s) WHERE action = '%s'
+		)`,
+		s.slaSource([]string{fmt.Sprintf("a.state = '%s'", timeplus.AlertStateActive)}),
+		timeplus.AlertAuditStream, timeplus.AlertAuditActionEscalated)
+
+	rows, err := s.tpClient.ExecuteQuery(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find SLA breaches: %w", err)
+	}
+
+	escalated := 0
+	for _, row := range rows {
+		ruleID, entityID, firingSeq := getString(row, "rule_id"), getString(row, "entity_id"), getInt64(row, "firing_seq")
+		alertID := FormatAlertID(ruleID, entityID, firingSeq)
+
+		alert, err := s.GetAlert(ctx, alertID)
+		if err != nil {
+			logrus.Warnf("Skipping SLA escalation of alert %s: %v", alertID, err)
+			continue
+		}
+		rule, _ := s.GetRule(ctx, ruleID)
+		if rule != nil && len(rule.DependsOn) > 0 {
+			// Escalated once the rules it depends on are no longer active
+			if reason, err := s.suppressingDependency(ctx, rule, entityID); err == nil && reason != "" {
+				continue
+			}
+		}
+		if reason, err := s.inhibitingAlert(ctx, alert, entityID); err == nil && reason != "" {
+			continue
+		}
+		if err := s.dispatcher.Dispatch(s.notificationEvent(notify.EventEscalated, alert, rule)); err != nil {
+			// Not recorded, so the next check retries it
+			logrus.Warnf("Failed to queue SLA escalation of alert %s: %v", alertID, err)
+			continue
+		}
+
+		target := time.Duration(getInt64(row, "target_seconds")) * time.Second
+		s.recordAlertAudit(ctx, ruleID, entityID, firingSeq, timeplus.AlertAuditActionEscalated, "sla",
+			fmt.Sprintf("Not acknowledged within %g minutes", target.Minutes()))
+		escalated++
+	}
+	return escalated, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestApplySLAStatus(t *testing.T) {
+	service := &RuleService{}
+	service.SetSLATargets(map[string]time.Duration{"Critical": 15 * time.Minute})
+
+	now := time.Now()
+	ackedAt := func(d time.Duration) *time.Time {
+		at := now.Add(-time.Hour).Add(d)
+		return &at
+	}
+
+	tests := []struct {
+		name   string
+		alert  models.Alert
+		status string
+	}{
+		{"acknowledged in time", models.Alert{Severity: "critical", TriggeredAt: now.Add(-time.Hour), AcknowledgedAt: ackedAt(10 * time.Minute)}, SLAStatusMet},
+		{"acknowledged late", models.Alert{Severity: "critical", TriggeredAt: now.Add(-time.Hour), AcknowledgedAt: ackedAt(20 * time.Minute)}, SLAStatusBreached},
+		{"open past target", models.Alert{Severity: "critical", TriggeredAt: now.Add(-time.Hour)}, SLAStatusBreached},
+		{"open within target", models.Alert{Severity: "critical", TriggeredAt: now.Add(-time.Minute)}, SLAStatusPending},
+		{"no target for severity", models.Alert{Severity: "info", TriggeredAt: now.Add(-time.Hour)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := tt.alert
+			service.applySLA(&alert)
+			assert.Equal(t, tt.status, alert.SLAStatus)
+			if tt.status == "" {
+				assert.Nil(t, alert.SLADeadline)
+			} else {
+				require.NotNil(t, alert.SLADeadline)
+				assert.Equal(t, alert.TriggeredAt.Add(15*time.Minute), *alert.SLADeadline)
+			}
+		})
+	}
+}
+
+func TestGetSLAReport(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "multi_if(sev = 'critical', 900, sev = 'warning', 3600, 0) AS target_seconds") &&
+			strings.Contains(query, "WHERE sev IN ('critical', 'warning')") &&
+			strings.Contains(query, "a.rule_id = 'rule1'") &&
+			strings.Contains(query, "GROUP BY sev")
+	})).Return([]map[string]interface{}{
+		{"severity": "critical", "total": uint64(10), "met": uint64(6), "late": uint64(1), "open_breached": uint64(1), "pending": uint64(2),
+			"avg_response_seconds": float64(420), "max_response_seconds": float64(1200)},
+		{"severity": "warning", "total": uint64(1), "met": uint64(0), "late": uint64(0), "open_breached": uint64(0), "pending": uint64(1)},
+	}, nil)
+
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+	service.SetSLATargets(map[string]time.Duration{"critical": 15 * time.Minute, "warning": time.Hour})
+
+	end := time.Now()
+	report, err := service.GetSLAReport(context.Background(), end.Add(-24*time.Hour), end, "rule1")
+	require.NoError(t, err)
+	require.Len(t, report.Severities, 2)
+
+	critical := report.Severities[0]
+	assert.Equal(t, float64(15), critical.TargetMinutes)
+	assert.Equal(t, int64(2), critical.Breached)
+	require.NotNil(t, critical.CompliancePercent)
+	assert.InDelta(t, 75.0, *critical.CompliancePercent, 0.001)
+
+	// Nothing decided yet for warning alerts
+	assert.Nil(t, report.Severities[1].CompliancePercent)
+	mockClient.AssertNumberOfCalls(t, "ExecuteQuery", 1)
+}
+
+func TestEscalateSLABreachesOncePerFiring(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "a.state = 'active'") &&
+			strings.Contains(query, "NOT IN (") &&
+			strings.Contains(query, "action = 'escalated'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "dev1", "firing_seq": uint64(2), "target_seconds": int64(900)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "WHERE rule_id = 'rule1' AND entity_id = 'dev1'")
+	})).Return([]map[string]interface{}{
+		{"rule_id": "rule1", "entity_id": "dev1", "state": "active", "created_at": time.Now().Add(-time.Hour), "firing_seq": uint64(2)},
+	}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "INSERT INTO tp_alert_audit") &&
+			strings.Contains(query, "'rule1', 'dev1', 2, 'escalated', 'sla', 'Not acknowledged within 15 minutes'")
+	})).Return([]map[string]interface{}{}, nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "rule1", "name": "High temp", "severity": "critical"},
+	}, nil)
+
+	recorder := &recordingNotifier{}
+	dispatcher := notify.NewDispatcher(10, 1, recorder)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", alertStream: "tp_alerts"}
+	service.SetNotificationDispatcher(dispatcher)
+	service.SetSLATargets(map[string]time.Duration{"critical": 15 * time.Minute})
+
+	escalated, err := service.escalateSLABreaches(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, escalated)
+
+	require.Equal(t, 0, dispatcher.Drain(context.Background()))
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, notify.EventEscalated, recorder.events[0].Type)
+	assert.Equal(t, "rule1:dev1:2", recorder.events[0].Alert.ID)
+	assert.Equal(t, SLAStatusBreached, recorder.events[0].Alert.SLAStatus)
+	mockClient.AssertExpectations(t)
+}
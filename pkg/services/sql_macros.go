@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var (
+	// ErrSQLMacroNotFound is returned when no SQL macro, or no version of it, has the given name
+	ErrSQLMacroNotFound = errors.New("SQL macro not found")
+	// ErrSQLMacroExists is returned when creating a SQL macro whose name is taken
+	ErrSQLMacroExists = errors.New("SQL macro already exists")
+	// ErrInvalidSQLMacro is returned for SQL macros with a malformed name or without SQL
+	ErrInvalidSQLMacro = errors.New("invalid SQL macro")
+	// ErrSQLMacroInUse is returned when deleting a SQL macro that rule queries still reference
+	ErrSQLMacroInUse = errors.New("SQL macro is still referenced by rules")
+)
+
+// macroReferencePattern matches macro references in rule queries: {{macro:name}}, or
+// {{macro:name@3}} for a given version
+var macroReferencePattern = regexp.MustCompile(`\{\{\s*macro:([^@}\s]*)(?:@([0-9]+))?\s*\}\}`)
+
+// SQLMacroStore keeps the versions of SQL macros in memory, backed by a mutable stream so they
+// survive restarts. Every version is kept so rules expanded with an older one can be saved again.
+type SQLMacroStore struct {
+	tpClient timeplus.StreamStore
+	mu       sync.RWMutex
+	macros   map[string][]*models.SQLMacro // Versions of each macro, oldest first
+}
+
+// NewSQLMacroStore ensures the SQL macros stream exists and loads the stored macros
+func NewSQLMacroStore(ctx context.Context, tpClient timeplus.StreamStore) (*SQLMacroStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.SQLMacrosStream,
+		timeplus.GetSQLMacrosSchema(), []string{"name", "version"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure SQL macros stream: %w", err)
+	}
+
+	store := &SQLMacroStore{tpClient: tpClient, macros: make(map[string][]*models.SQLMacro)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, version, description, sql, created_at, updated_at FROM table(%s) WHERE active = true ORDER BY name, version",
+		timeplus.SQLMacrosStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SQL macros: %w", err)
+	}
+	for _, row := range rows {
+		macro := &models.SQLMacro{
+			Name:        getString(row, "name"),
+			Version:     int(getInt64(row, "version")),
+			Description: getString(row, "description"),
+			SQL:         getString(row, "sql"),
+			CreatedAt:   getTime(row, "created_at"),
+			UpdatedAt:   getTime(row, "updated_at"),
+		}
+		store.macros[macro.Name] = append(store.macros[macro.Name], macro)
+	}
+
+	logrus.Infof("Loaded %d SQL macro(s)", len(store.macros))
+	return store, nil
+}
+
+// List returns the latest version of every macro sorted by name
+func (st *SQLMacroStore) List() []*models.SQLMacro {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	macros := make([]*models.SQLMacro, 0, len(st.macros))
+	for _, versions := range st.macros {
+		copied := *versions[len(versions)-1]
+		macros = append(macros, &copied)
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	return macros
+}
+
+// Get returns the latest version of the macro with the given name
+func (st *SQLMacroStore) Get(name string) (*models.SQLMacro, error) {
+	return st.GetVersion(name, 0)
+}
+
+// GetVersion returns a version of a macro, the latest for version 0
+func (st *SQLMacroStore) GetVersion(name string, version int) (*models.SQLMacro, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	macro := st.version(name, version)
+	if macro == nil {
+		if version > 0 {
+			return nil, fmt.Errorf("%w: %s version %d", ErrSQLMacroNotFound, name, version)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSQLMacroNotFound, name)
+	}
+	copied := *macro
+	return &copied, nil
+}
+
+// Versions returns every version of a macro, newest first
+func (st *SQLMacroStore) Versions(name string) ([]*models.SQLMacro, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	versions, ok := st.macros[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSQLMacroNotFound, name)
+	}
+	result := make([]*models.SQLMacro, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		copied := *versions[i]
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// Create stores the first version of a new macro
+func (st *SQLMacroStore) Create(ctx context.Context, macro *models.SQLMacro) (*models.SQLMacro, error) {
+	now := time.Now()
+	stored := &models.SQLMacro{
+		Name:        strings.TrimSpace(macro.Name),
+		Description: macro.Description,
+		SQL:         strings.TrimSpace(macro.SQL),
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateSQLMacro(stored); err != nil {
+		return nil, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.macros[stored.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrSQLMacroExists, stored.Name)
+	}
+	if err := st.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	st.macros[stored.Name] = []*models.SQLMacro{stored}
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Update stores a new version of an existing macro with the given SQL and description. Rules
+// expanded with earlier versions keep them until their query is saved again.
+func (st *SQLMacroStore) Update(ctx context.Context, name string, macro *models.SQLMacro) (*models.SQLMacro, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	latest := st.version(name, 0)
+	if latest == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSQLMacroNotFound, name)
+	}
+
+	updated := &models.SQLMacro{
+		Name:        name,
+		Description: macro.Description,
+		SQL:         strings.TrimSpace(macro.SQL),
+		Version:     latest.Version + 1,
+		CreatedAt:   latest.CreatedAt,
+		UpdatedAt:   time.Now(),
+	}
+	if err := validateSQLMacro(updated); err != nil {
+		return nil, err
+	}
+	if err := st.persist(ctx, updated, true); err != nil {
+		return nil, err
+	}
+	st.macros[name] = append(st.macros[name], updated)
+
+	copied := *updated
+	return &copied, nil
+}
+
+// Delete removes a macro with all its versions
+func (st *SQLMacroStore) Delete(ctx context.Context, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	versions, ok := st.macros[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSQLMacroNotFound, name)
+	}
+	for _, version := range versions {
+		deleted := *version
+		deleted.UpdatedAt = time.Now()
+		if err := st.persist(ctx, &deleted, false); err != nil {
+			return err
+		}
+	}
+	delete(st.macros, name)
+	return nil
+}
+
+// Expand replaces the macro references of a query with the SQL of the macros. References without a
+// version use the version in pinned, if any, and the latest otherwise. It returns the expanded query
+// and the version each referenced macro was expanded with.
+func (st *SQLMacroStore) Expand(query string, pinned map[string]int) (string, map[string]int, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	used := make(map[string]int)
+	var expandErr error
+	expanded := macroReferencePattern.ReplaceAllStringFunc(query, func(reference string) string {
+		if expandErr != nil {
+			return reference
+		}
+		match := macroReferencePattern.FindStringSubmatch(reference)
+		name, version := match[1], pinned[match[1]]
+		if !identifierPattern.MatchString(name) {
+			expandErr = fmt.Errorf("malformed macro reference %s, expected {{macro:name}} or {{macro:name@version}}", reference)
+			return reference
+		}
+		if match[2] != "" {
+			version, _ = strconv.Atoi(match[2])
+		}
+
+		macro := st.version(name, version)
+		if macro == nil {
+			if version > 0 {
+				expandErr = fmt.Errorf("unknown macro %s version %d", name, version)
+			} else {
+				expandErr = fmt.Errorf("unknown macro %s", name)
+			}
+			return reference
+		}
+		if previous, ok := used[name]; ok && previous != macro.Version {
+			expandErr = fmt.Errorf("macro %s is referenced at versions %d and %d", name, previous, macro.Version)
+			return reference
+		}
+		used[name] = macro.Version
+		return macro.SQL
+	})
+	if expandErr != nil {
+		return "", nil, expandErr
+	}
+	if strings.Contains(expanded, "{{macro:") {
+		return "", nil, errors.New("malformed macro reference, expected {{macro:name}} or {{macro:name@version}}")
+	}
+	return expanded, used, nil
+}
+
+// version returns a version of a macro, the latest for version 0, or nil. Must be called with mu held.
+func (st *SQLMacroStore) version(name string, version int) *models.SQLMacro {
+	versions := st.macros[name]
+	if len(versions) == 0 {
+		return nil
+	}
+	if version == 0 {
+		return versions[len(versions)-1]
+	}
+	for _, macro := range versions {
+		if macro.Version == version {
+			return macro
+		}
+	}
+	return nil
+}
+
+// persist writes a macro version to the SQL macros stream
+func (st *SQLMacroStore) persist(ctx context.Context, macro *models.SQLMacro, active bool) error {
+	columns := []string{"name", "version", "description", "sql", "created_at", "updated_at", "active"}
+	values := []interface{}{macro.Name, macro.Version, macro.Description, macro.SQL, macro.CreatedAt, macro.UpdatedAt, active}
+	if err := st.tpClient.InsertIntoStream(ctx, timeplus.SQLMacrosStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist SQL macro %s: %w", macro.Name, err)
+	}
+	return nil
+}
+
+// validateSQLMacro checks that a macro has an identifier name and SQL that doesn't reference other
+// macros, which aren't expanded
+func validateSQLMacro(macro *models.SQLMacro) error {
+	if !identifierPattern.MatchString(macro.Name) {
+		return fmt.Errorf("%w: name must contain only letters, digits and underscores, got %q", ErrInvalidSQLMacro, macro.Name)
+	}
+	if macro.SQL == "" {
+		return fmt.Errorf("%w: sql is required", ErrInvalidSQLMacro)
+	}
+	if strings.Contains(macro.SQL, "{{macro:") || macroReferencePattern.MatchString(macro.SQL) {
+		return fmt.Errorf("%w: macros can't reference other macros", ErrInvalidSQLMacro)
+	}
+	return nil
+}
+
+// SQLMacros returns the SQL macro store, nil when it isn't available
+func (s *RuleService) SQLMacros() *SQLMacroStore {
+	return s.sqlMacros
+}
+
+// expandRuleMacros expands the macro references of a query rule's query, recording the query as
+// written in QueryTemplate and the versions used in Macros. Rules saved again without a new query
+// keep the versions they were expanded with; a new query is expanded with the latest versions.
+func (s *RuleService) expandRuleMacros(rule *models.Rule) error {
+	if rule.Type != "" && rule.Type != models.RuleTypeQuery {
+		rule.QueryTemplate, rule.Macros = "", nil
+		return nil
+	}
+	if rule.QueryTemplate == "" {
+		if !macroReferencePattern.MatchString(rule.Query) && !strings.Contains(rule.Query, "{{macro:") {
+			rule.Macros = nil
+			return nil
+		}
+		rule.QueryTemplate = rule.Query
+	}
+	if s.sqlMacros == nil {
+		return fmt.Errorf("%w: query references SQL macros, which are not available", ErrInvalidRule)
+	}
+
+	query, versions, err := s.sqlMacros.Expand(rule.QueryTemplate, rule.Macros)
+	if err != nil {
+		return fmt.Errorf("%w: query: %v", ErrInvalidRule, err)
+	}
+	rule.Query, rule.Macros = query, versions
+	return nil
+}
+
+// SQLMacroRules returns the rules whose query references a macro, with the version each was
+// expanded with
+func (s *RuleService) SQLMacroRules(ctx context.Context, name string) ([]models.SQLMacroUsage, error) {
+	if s.sqlMacros == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSQLMacroNotFound, name)
+	}
+	latest, err := s.sqlMacros.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := []models.SQLMacroUsage{}
+	for _, rule := range rules {
+		if version, ok := rule.Macros[name]; ok {
+			usages = append(usages, models.SQLMacroUsage{
+				RuleID:   rule.ID,
+				RuleName: rule.Name,
+				Version:  version,
+				Latest:   version == latest.Version,
+			})
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].RuleName < usages[j].RuleName })
+	return usages, nil
+}
+
+// DeleteSQLMacro deletes a SQL macro that no rule query references anymore
+func (s *RuleService) DeleteSQLMacro(ctx context.Context, name string) error {
+	usages, err := s.SQLMacroRules(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(usages) > 0 {
+		return fmt.Errorf("%w: %s is referenced by %d rule(s), change their queries first", ErrSQLMacroInUse, name, len(usages))
+	}
+	return s.sqlMacros.Delete(ctx, name)
+}
+
+// ExpandSQLMacros previews the expansion of a query's macro references with their latest versions,
+// or the versions the references name
+func (s *RuleService) ExpandSQLMacros(query string) (*models.SQLMacroExpansion, error) {
+	if s.sqlMacros == nil {
+		return nil, fmt.Errorf("%w: SQL macros are not available", ErrInvalidSQLMacro)
+	}
+	expanded, versions, err := s.sqlMacros.Expand(query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSQLMacro, err)
+	}
+	if len(versions) == 0 {
+		versions = nil
+	}
+	return &models.SQLMacroExpansion{Query: expanded, Macros: versions}, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+// testSQLMacros returns a store with two versions of high_temp and one of known_devices
+func testSQLMacros(client timeplus.StreamStore) *SQLMacroStore {
+	return &SQLMacroStore{tpClient: client, macros: map[string][]*models.SQLMacro{
+		"high_temp": {
+			{Name: "high_temp", Version: 1, SQL: "temperature > 80"},
+			{Name: "high_temp", Version: 2, SQL: "temperature > 90"},
+		},
+		"known_devices": {
+			{Name: "known_devices", Version: 1, SQL: "INNER JOIN table(devices) AS d ON d.id = device_id"},
+		},
+	}}
+}
+
+func TestSQLMacroStoreVersions(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.SQLMacrosStream, mock.Anything, []string{"name", "version"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "high_temp", "version": int32(1), "sql": "temperature > 80"},
+		{"name": "high_temp", "version": int32(2), "sql": "temperature > 90"},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.SQLMacrosStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewSQLMacroStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	latest, err := store.Get("high_temp")
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+
+	_, err = store.Create(context.Background(), &models.SQLMacro{Name: "high_temp", SQL: "temperature > 70"})
+	assert.ErrorIs(t, err, ErrSQLMacroExists)
+	for name, macro := range map[string]*models.SQLMacro{
+		"no name":   {SQL: "temperature > 70"},
+		"bad name":  {Name: "high-temp", SQL: "temperature > 70"},
+		"no sql":    {Name: "warm"},
+		"reference": {Name: "warm", SQL: "{{macro:high_temp}} OR humidity > 90"},
+	} {
+		_, err = store.Create(context.Background(), macro)
+		assert.ErrorIs(t, err, ErrInvalidSQLMacro, name)
+	}
+
+	updated, err := store.Update(context.Background(), "high_temp", &models.SQLMacro{SQL: "temperature > 95"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.Version)
+
+	versions, err := store.Versions("high_temp")
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2, 1}, []int{versions[0].Version, versions[1].Version, versions[2].Version})
+	first, err := store.GetVersion("high_temp", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "temperature > 80", first.SQL)
+	_, err = store.GetVersion("high_temp", 7)
+	assert.ErrorIs(t, err, ErrSQLMacroNotFound)
+
+	// Deleting marks every version inactive
+	require.NoError(t, store.Delete(context.Background(), "high_temp"))
+	_, err = store.Get("high_temp")
+	assert.ErrorIs(t, err, ErrSQLMacroNotFound)
+	inactive := 0
+	for _, call := range mockClient.Calls {
+		if call.Method == "InsertIntoStream" && call.Arguments.Get(3).([]interface{})[6] == false {
+			inactive++
+		}
+	}
+	assert.Equal(t, 3, inactive)
+}
+
+func TestSQLMacroStoreExpand(t *testing.T) {
+	store := testSQLMacros(new(MockClient))
+
+	query, versions, err := store.Expand("SELECT * FROM sensors {{macro:known_devices}} WHERE {{ macro:high_temp }}", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM sensors INNER JOIN table(devices) AS d ON d.id = device_id WHERE temperature > 90", query)
+	assert.Equal(t, map[string]int{"known_devices": 1, "high_temp": 2}, versions)
+
+	// Versions named by the reference win over pinned ones, which win over the latest
+	query, versions, err = store.Expand("SELECT * FROM sensors WHERE {{macro:high_temp@1}}", map[string]int{"high_temp": 2})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM sensors WHERE temperature > 80", query)
+	assert.Equal(t, map[string]int{"high_temp": 1}, versions)
+	query, _, err = store.Expand("SELECT * FROM sensors WHERE {{macro:high_temp}}", map[string]int{"high_temp": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM sensors WHERE temperature > 80", query)
+
+	for name, query := range map[string]string{
+		"unknown macro":      "SELECT * FROM sensors WHERE {{macro:cold}}",
+		"unknown version":    "SELECT * FROM sensors WHERE {{macro:high_temp@5}}",
+		"malformed name":     "SELECT * FROM sensors WHERE {{macro:high-temp}}",
+		"unclosed reference": "SELECT * FROM sensors WHERE {{macro:high_temp",
+		"two versions":       "SELECT * FROM sensors WHERE {{macro:high_temp@1}} AND {{macro:high_temp@2}}",
+	} {
+		_, _, err := store.Expand(query, nil)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestUpdateRuleExpandsMacros(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Hot", "status": "stopped", "severity": "warning",
+			"query":          "SELECT * FROM sensors WHERE temperature > 80",
+			"query_template": "SELECT * FROM sensors WHERE {{macro:high_temp}}",
+			"macros":         `{"high_temp": 1}`},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, "tp_rules", mock.Anything, mock.Anything).Return(nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", sqlMacros: testSQLMacros(mockClient)}
+
+	// Saved again without a new query, the rule keeps the version it was expanded with
+	name := "Hotter"
+	rule, err := service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM sensors WHERE temperature > 80", rule.Query)
+	assert.Equal(t, map[string]int{"high_temp": 1}, rule.Macros)
+
+	// A new query is expanded with the latest version
+	query := "SELECT * FROM sensors WHERE {{macro:high_temp}}"
+	rule, err = service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{Query: &query})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM sensors WHERE temperature > 90", rule.Query)
+	assert.Equal(t, query, rule.QueryTemplate)
+	persisted := persistedRule(t, mockClient)
+	assert.Equal(t, "SELECT * FROM sensors WHERE temperature > 90", persisted["query"])
+	assert.Equal(t, query, persisted["query_template"])
+	assert.Equal(t, `{"high_temp":2}`, persisted["macros"])
+
+	// Queries without references drop the template
+	plain := "SELECT * FROM sensors WHERE temperature > 100"
+	rule, err = service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{Query: &plain})
+	require.NoError(t, err)
+	assert.Empty(t, rule.QueryTemplate)
+	assert.Nil(t, rule.Macros)
+
+	unknown := "SELECT * FROM sensors WHERE {{macro:cold}}"
+	_, err = service.UpdateRule(context.Background(), "r1", &models.UpdateRuleRequest{Query: &unknown})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestDeleteSQLMacroInUse(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"id": "r1", "name": "Hot", "status": "running", "macros": `{"high_temp": 1}`},
+	}, nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules", sqlMacros: testSQLMacros(mockClient)}
+
+	usages, err := service.SQLMacroRules(context.Background(), "high_temp")
+	require.NoError(t, err)
+	assert.Equal(t, []models.SQLMacroUsage{{RuleID: "r1", RuleName: "Hot", Version: 1, Latest: false}}, usages)
+
+	err = service.DeleteSQLMacro(context.Background(), "high_temp")
+	assert.ErrorIs(t, err, ErrSQLMacroInUse)
+	mockClient.AssertNotCalled(t, "InsertIntoStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+)
+
+// ErrStreamInUse is returned when deleting a stream that active rules read from or write to
+var ErrStreamInUse = errors.New("stream is in use")
+
+// StreamInUseError lists the active rules deleting a stream would break
+type StreamInUseError struct {
+	Stream  string
+	RuleIDs []string
+}
+
+func (e *StreamInUseError) Error() string {
+	return fmt.Sprintf("%s: %s is used by active rule(s) %s, delete with force to break them", ErrStreamInUse,
+		e.Stream, strings.Join(e.RuleIDs, ", "))
+}
+
+func (e *StreamInUseError) Unwrap() error {
+	return ErrStreamInUse
+}
+
+// DeleteStream drops a stream or view, refusing when running or degraded rules read it, look it up
+// or write their alerts to it, unless force is set. It returns what deleting the stream affects.
+func (s *RuleService) DeleteStream(ctx context.Context, name string, force bool) (*RuleGraphImpact, error) {
+	graph, err := s.GetRuleGraph(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rules using stream %s: %w", name, err)
+	}
+	impact := graph.ImpactOf(name)
+
+	if active := graph.activeRules(impact.Rules); len(active) > 0 {
+		if !force {
+			return impact, &StreamInUseError{Stream: name, RuleIDs: active}
+		}
+		logrus.Warnf("Deleting stream %s used by active rule(s) %s", name, strings.Join(active, ", "))
+	}
+
+	// The name may be a view rather than a stream
+	if err := s.tpClient.DeleteMaterializedView(ctx, name); err != nil {
+		logrus.Warnf("Failed to delete %s as a view: %v", name, err)
+	}
+	if err := s.tpClient.DeleteStream(ctx, name); err != nil {
+		return impact, err
+	}
+	return impact, nil
+}
+
+// activeRules returns the rules of ruleIDs that are running or degraded
+func (g *RuleGraph) activeRules(ruleIDs []string) []string {
+	status := make(map[string]models.RuleStatus, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if node.Kind == GraphNodeRule {
+			status[graphNodeName(node.ID)] = models.RuleStatus(node.Status)
+		}
+	}
+	var active []string
+	for _, id := range ruleIDs {
+		if status[id] == models.RuleStatusRunning || status[id] == models.RuleStatusDegraded {
+			active = append(active, id)
+		}
+	}
+	return active
+}
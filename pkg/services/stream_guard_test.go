@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteStreamRefusesStreamsOfActiveRules(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("ExecuteQuery", mock.Anything, ruleQuery).Return([]map[string]interface{}{
+		{"id": "r1", "status": "running", "query": "SELECT * FROM sensors WHERE temperature > 90"},
+		{"id": "r2", "status": "stopped", "query": "SELECT * FROM sensors WHERE temperature < 0"},
+		{"id": "r3", "status": "stopped", "query": "SELECT * FROM metrics WHERE latency > 5"},
+	}, nil)
+	mockClient.On("ListStreams", mock.Anything).Return([]string{"sensors", "metrics"}, nil)
+	mockClient.On("ListMaterializedViews", mock.Anything).Return([]string{}, nil)
+	mockClient.On("DeleteMaterializedView", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("DeleteStream", mock.Anything, mock.Anything).Return(nil)
+	service := &RuleService{tpClient: mockClient, ruleStream: "tp_rules"}
+
+	impact, err := service.DeleteStream(context.Background(), "sensors", false)
+	var inUse *StreamInUseError
+	require.ErrorAs(t, err, &inUse)
+	assert.ErrorIs(t, err, ErrStreamInUse)
+	assert.Equal(t, []string{"r1"}, inUse.RuleIDs, "stopped rules don't block the delete")
+	assert.Equal(t, []string{"r1", "r2"}, impact.Rules)
+	mockClient.AssertNotCalled(t, "DeleteStream", mock.Anything, mock.Anything)
+
+	// Only stopped rules use metrics
+	_, err = service.DeleteStream(context.Background(), "metrics", false)
+	require.NoError(t, err)
+	mockClient.AssertCalled(t, "DeleteStream", mock.Anything, "metrics")
+
+	_, err = service.DeleteStream(context.Background(), "sensors", true)
+	require.NoError(t, err)
+	mockClient.AssertCalled(t, "DeleteStream", mock.Anything, "sensors")
+}
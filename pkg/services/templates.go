@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/i18n"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+var (
+	// ErrTemplateNotFound is returned when no notification template has the given name
+	ErrTemplateNotFound = errors.New("notification template not found")
+	// ErrTemplateExists is returned when creating a template whose name is taken
+	ErrTemplateExists = errors.New("notification template already exists")
+	// ErrInvalidTemplate is returned for templates without a name or whose body doesn't parse
+	ErrInvalidTemplate = errors.New("invalid notification template")
+)
+
+// NotificationTemplateData is what notification templates are rendered against
+type NotificationTemplateData struct {
+	Event  string                 // Event type, e.g. "fired" or "escalated"
+	Alert  *models.Alert          // The alert, with rule details and rendered summary
+	Data   map[string]interface{} // The triggering row, e.g. {{.Data.temperature}}
+	Locale string                 // Locale the message is rendered in, e.g. "en" or "de"
+}
+
+// notificationTemplateFuncs returns the helpers available to notification templates, with the
+// localized ones rendering in the given locale
+func notificationTemplateFuncs(locale *i18n.Locale) template.FuncMap {
+	funcs := template.FuncMap{
+		"severityName": func(severity interface{}) string { return locale.Severity(fmt.Sprint(severity)) },
+		"eventName":    locale.Event,
+		"localTime": func(value interface{}) string {
+			switch t := value.(type) {
+			case time.Time:
+				return locale.FormatTime(t, DisplayTimezone())
+			case *time.Time:
+				if t != nil {
+					return locale.FormatTime(*t, DisplayTimezone())
+				}
+			}
+			return ""
+		},
+	}
+	for name, fn := range baseTemplateFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// baseTemplateFuncs are the helpers of notification templates that don't depend on the locale
+var baseTemplateFuncs = template.FuncMap{
+	"formatTime":   formatTemplateTime,
+	"since":        templateSince,
+	"formatNumber": formatTemplateNumber,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"json": func(value interface{}) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	},
+}
+
+// formatTemplateTime formats a time in the display timezone with an optional Go layout, RFC3339
+// by default
+func formatTemplateTime(value interface{}, layout ...string) string {
+	format := time.RFC3339
+	if len(layout) > 0 && layout[0] != "" {
+		format = layout[0]
+	}
+	switch t := value.(type) {
+	case time.Time:
+		return t.In(DisplayTimezone()).Format(format)
+	case *time.Time:
+		if t != nil {
+			return t.In(DisplayTimezone()).Format(format)
+		}
+	}
+	return ""
+}
+
+// templateSince returns how long ago a time was, rounded to the second
+func templateSince(value interface{}) string {
+	switch t := value.(type) {
+	case time.Time:
+		return time.Since(t).Round(time.Second).String()
+	case *time.Time:
+		if t != nil {
+			return time.Since(*t).Round(time.Second).String()
+		}
+	}
+	return ""
+}
+
+// formatTemplateNumber formats a number with a fixed number of decimals. Values that aren't
+// numbers are returned as-is.
+func formatTemplateNumber(value interface{}, decimals int) string {
+	var f float64
+	switch v := value.(type) {
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		f = parsed
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return v
+		}
+		f = parsed
+	default:
+		return fmt.Sprint(value)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64)
+}
+
+// parseNotificationTemplate parses a notification template body with the helper functions of a locale
+func parseNotificationTemplate(name, body string, locale *i18n.Locale) (*template.Template, error) {
+	return template.New(name).Funcs(notificationTemplateFuncs(locale)).Option("missingkey=zero").Parse(body)
+}
+
+// RenderNotificationTemplate renders a template body in English for an event about an alert
+func RenderNotificationTemplate(body, eventType string, alert *models.Alert) (string, error) {
+	return RenderLocalizedNotificationTemplate(body, i18n.DefaultLocale, eventType, alert)
+}
+
+// RenderLocalizedNotificationTemplate renders a template body for an event about an alert, with
+// severity names and times in the given locale
+func RenderLocalizedNotificationTemplate(body, locale, eventType string, alert *models.Alert) (string, error) {
+	catalog := i18n.Lookup(locale)
+	tmpl, err := parseNotificationTemplate("notification", body, catalog)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	data := make(map[string]interface{})
+	decoder := json.NewDecoder(strings.NewReader(alert.Data))
+	decoder.UseNumber()
+	_ = decoder.Decode(&data)
+
+	var buf bytes.Buffer
+	if locale == "" {
+		locale = i18n.DefaultLocale
+	}
+	if err := tmpl.Execute(&buf, NotificationTemplateData{Event: eventType, Alert: alert, Data: data, Locale: i18n.Normalize(locale)}); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	return buf.String(), nil
+}
+
+// TemplateBody returns the body of a template to render for a locale: its translation for the
+// locale or the locale's language, or the English body. It also returns the locale of the body.
+func TemplateBody(tmpl *models.NotificationTemplate, locale string) (string, string) {
+	if key, ok := i18n.Match(locale, tmpl.Translations); ok {
+		return tmpl.Translations[key], key
+	}
+	return tmpl.Body, i18n.DefaultLocale
+}
+
+// SampleAlert returns the alert templates are previewed against when no sample is given
+func SampleAlert() *models.Alert {
+	acknowledgedAt := time.Now().Add(-2 * time.Minute)
+	return &models.Alert{
+		ID:             "high-temperature:device-42:3",
+		RuleID:         "high-temperature",
+		RuleName:       "High temperature",
+		Severity:       models.RuleSeverityCritical,
+		TriggeredAt:    time.Now().Add(-5 * time.Minute),
+		Data:           `{"device_id":"device-42","temperature":87.25,"location":"Building A"}`,
+		Acknowledged:   true,
+		AcknowledgedAt: &acknowledgedAt,
+		AcknowledgedBy: "alice",
+		Owner:          "alice",
+		Team:           "facilities",
+		RunbookURL:     "https://runbooks.example.com/high-temperature",
+		Summary:        "device-42 is at 87.25°C",
+	}
+}
+
+// TemplateStore keeps notification templates in memory, backed by a mutable stream so they
+// survive restarts
+type TemplateStore struct {
+	tpClient  timeplus.StreamStore
+	mu        sync.RWMutex
+	templates map[string]*models.NotificationTemplate
+}
+
+// NewTemplateStore ensures the templates stream exists and loads the stored templates
+func NewTemplateStore(ctx context.Context, tpClient timeplus.StreamStore) (*TemplateStore, error) {
+	if err := tpClient.EnsureMutableStream(ctx, timeplus.NotificationTemplatesStream,
+		timeplus.GetNotificationTemplatesSchema(), []string{"name"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure notification templates stream: %w", err)
+	}
+
+	store := &TemplateStore{tpClient: tpClient, templates: make(map[string]*models.NotificationTemplate)}
+	rows, err := tpClient.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, description, body, translations, created_at, updated_at FROM table(%s) WHERE active = true",
+		timeplus.NotificationTemplatesStream))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification templates: %w", err)
+	}
+	for _, row := range rows {
+		tmpl := &models.NotificationTemplate{
+			Name:        getString(row, "name"),
+			Description: getString(row, "description"),
+			Body:        getString(row, "body"),
+			CreatedAt:   getTime(row, "created_at"),
+			UpdatedAt:   getTime(row, "updated_at"),
+		}
+		if translations := getString(row, "translations"); translations != "" {
+			if err := json.Unmarshal([]byte(translations), &tmpl.Translations); err != nil {
+				logrus.Warnf("Ignoring unreadable translations of notification template %s: %v", tmpl.Name, err)
+			}
+		}
+		store.templates[tmpl.Name] = tmpl
+	}
+
+	logrus.Infof("Loaded %d notification template(s)", len(store.templates))
+	return store, nil
+}
+
+// List returns all templates sorted by name
+func (t *TemplateStore) List() []*models.NotificationTemplate {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	templates := make([]*models.NotificationTemplate, 0, len(t.templates))
+	for _, tmpl := range t.templates {
+		copied := *tmpl
+		templates = append(templates, &copied)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// Get returns the template with the given name
+func (t *TemplateStore) Get(name string) (*models.NotificationTemplate, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tmpl, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	copied := *tmpl
+	return &copied, nil
+}
+
+// Create stores a new template
+func (t *TemplateStore) Create(ctx context.Context, tmpl *models.NotificationTemplate) (*models.NotificationTemplate, error) {
+	if err := validateNotificationTemplate(tmpl); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.templates[tmpl.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateExists, tmpl.Name)
+	}
+
+	now := time.Now()
+	stored := &models.NotificationTemplate{
+		Name:         tmpl.Name,
+		Description:  tmpl.Description,
+		Body:         tmpl.Body,
+		Translations: tmpl.Translations,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := t.persist(ctx, stored, true); err != nil {
+		return nil, err
+	}
+	t.templates[stored.Name] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// Update replaces the body, translations and description of an existing template
+func (t *TemplateStore) Update(ctx context.Context, name string, tmpl *models.NotificationTemplate) (*models.NotificationTemplate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	existing, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	updated := &models.NotificationTemplate{
+		Name:         name,
+		Description:  tmpl.Description,
+		Body:         tmpl.Body,
+		Translations: tmpl.Translations,
+		CreatedAt:    existing.CreatedAt,
+		UpdatedAt:    time.Now(),
+	}
+	if err := validateNotificationTemplate(updated); err != nil {
+		return nil, err
+	}
+	if err := t.persist(ctx, updated, true); err != nil {
+		return nil, err
+	}
+	t.templates[name] = updated
+
+	copied := *updated
+	return &copied, nil
+}
+
+// Delete removes a template. Rules still referencing it fall back to the default notification message.
+func (t *TemplateStore) Delete(ctx context.Context, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	existing, ok := t.templates[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	deleted := *existing
+	deleted.UpdatedAt = time.Now()
+	if err := t.persist(ctx, &deleted, false); err != nil {
+		return err
+	}
+	delete(t.templates, name)
+	return nil
+}
+
+// persist writes a template to the templates stream
+func (t *TemplateStore) persist(ctx context.Context, tmpl *models.NotificationTemplate, active bool) error {
+	translations := ""
+	if len(tmpl.Translations) > 0 {
+		encoded, err := json.Marshal(tmpl.Translations)
+		if err != nil {
+			return fmt.Errorf("failed to encode translations of notification template %s: %w", tmpl.Name, err)
+		}
+		translations = string(encoded)
+	}
+	columns := []string{"name", "description", "body", "created_at", "updated_at", "active", "translations"}
+	values := []interface{}{tmpl.Name, tmpl.Description, tmpl.Body, tmpl.CreatedAt, tmpl.UpdatedAt, active, translations}
+	if err := t.tpClient.InsertIntoStream(ctx, timeplus.NotificationTemplatesStream, columns, values); err != nil {
+		return fmt.Errorf("failed to persist notification template %s: %w", tmpl.Name, err)
+	}
+	return nil
+}
+
+// validateNotificationTemplate checks that a template has a name and that its body and
+// translations parse. Translation locales are normalized, e.g. "pt_br" to "pt-BR".
+func validateNotificationTemplate(tmpl *models.NotificationTemplate) error {
+	if tmpl.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+	}
+	if tmpl.Body == "" {
+		return fmt.Errorf("%w: body is required", ErrInvalidTemplate)
+	}
+	if _, err := parseNotificationTemplate(tmpl.Name, tmpl.Body, i18n.Lookup(i18n.DefaultLocale)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	if len(tmpl.Translations) == 0 {
+		tmpl.Translations = nil
+		return nil
+	}
+	translations := make(map[string]string, len(tmpl.Translations))
+	for locale, body := range tmpl.Translations {
+		if err := i18n.Validate(locale); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		locale = i18n.Normalize(locale)
+		if _, duplicate := translations[locale]; duplicate {
+			return fmt.Errorf("%w: duplicate translation for locale %s", ErrInvalidTemplate, locale)
+		}
+		if body == "" {
+			return fmt.Errorf("%w: translation for locale %s is empty", ErrInvalidTemplate, locale)
+		}
+		if _, err := parseNotificationTemplate(tmpl.Name, body, i18n.Lookup(locale)); err != nil {
+			return fmt.Errorf("%w: translation for locale %s: %v", ErrInvalidTemplate, locale, err)
+		}
+		translations[locale] = body
+	}
+	tmpl.Translations = translations
+	return nil
+}
+
+// Templates returns the notification template store, nil when it isn't available
+func (s *RuleService) Templates() *TemplateStore {
+	return s.templates
+}
+
+// validateRuleNotificationTemplate checks that the template a rule references exists
+func (s *RuleService) validateRuleNotificationTemplate(rule *models.Rule) error {
+	if rule.NotificationTemplate == "" {
+		return nil
+	}
+	if s.templates == nil {
+		return fmt.Errorf("%w: notification templates are not available", ErrInvalidRule)
+	}
+	if _, err := s.templates.Get(rule.NotificationTemplate); err != nil {
+		return fmt.Errorf("%w: unknown notificationTemplate %q", ErrInvalidRule, rule.NotificationTemplate)
+	}
+	return nil
+}
+
+// notificationEvent creates a notification event for an alert, addressed to whoever is on call for
+// the rule, with its message rendered from the rule's notification template when the rule has one.
+// Rules without their own template or schedule use those of their group.
+func (s *RuleService) notificationEvent(eventType string, alert *models.Alert, rule *models.Rule) notify.Event {
+	rule = s.withGroupDefaults(rule)
+	s.setAlertOnCall(alert, rule)
+	event := notify.NewEvent(eventType, alert)
+	if rule == nil || rule.NotificationTemplate == "" || s.templates == nil {
+		return event
+	}
+
+	tmpl, err := s.templates.Get(rule.NotificationTemplate)
+	if err != nil {
+		logrus.Warnf("Rule %s references missing notification template %q, using the default message", rule.ID, rule.NotificationTemplate)
+		return event
+	}
+	message, err := RenderNotificationTemplate(tmpl.Body, eventType, alert)
+	if err != nil {
+		logrus.Warnf("Failed to render notification template %q for alert %s: %v", tmpl.Name, alert.ID, err)
+		return event
+	}
+	event.Message = message
+
+	// Notifiers pick the translation for their recipients' locale, or fall back to the English message
+	for locale, body := range tmpl.Translations {
+		localized, err := RenderLocalizedNotificationTemplate(body, locale, eventType, alert)
+		if err != nil {
+			logrus.Warnf("Failed to render the %s translation of notification template %q for alert %s: %v", locale, tmpl.Name, alert.ID, err)
+			continue
+		}
+		if event.Messages == nil {
+			event.Messages = make(map[string]string, len(tmpl.Translations))
+		}
+		event.Messages[locale] = localized
+	}
+	return event
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/timeplus"
+)
+
+func TestRenderNotificationTemplateHelpers(t *testing.T) {
+	alert := &models.Alert{
+		ID:          "rule1:dev1:2",
+		RuleName:    "High temp",
+		Severity:    models.RuleSeverityCritical,
+		TriggeredAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Data:        `{"device_id":"dev1","temperature":87.256,"site":""}`,
+	}
+
+	message, err := RenderNotificationTemplate(
+		`[{{upper (print .Alert.Severity)}}] {{.Alert.RuleName}} {{.Event}}: {{.Data.device_id}} at {{formatNumber .Data.temperature 1}} `+
+			`since {{formatTime .Alert.TriggeredAt "15:04"}} ({{default "unknown site" .Data.site}})`,
+		notify.EventFired, alert)
+	require.NoError(t, err)
+	assert.Equal(t, "[CRITICAL] High temp fired: dev1 at 87.3 since 12:30 (unknown site)", message)
+
+	_, err = RenderNotificationTemplate("{{.Alert.RuleName", notify.EventFired, alert)
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+}
+
+func TestTemplateStoreLifecycle(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.NotificationTemplatesStream, mock.Anything, []string{"name"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "short", "body": "{{.Alert.RuleName}}"},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.NotificationTemplatesStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewTemplateStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	require.Len(t, store.List(), 1)
+
+	_, err = store.Create(context.Background(), &models.NotificationTemplate{Name: "short", Body: "x"})
+	assert.ErrorIs(t, err, ErrTemplateExists)
+
+	_, err = store.Create(context.Background(), &models.NotificationTemplate{Name: "broken", Body: "{{if}}"})
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+
+	created, err := store.Create(context.Background(), &models.NotificationTemplate{Name: "pager", Body: "{{.Alert.ID}} needs attention"})
+	require.NoError(t, err)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	updated, err := store.Update(context.Background(), "pager", &models.NotificationTemplate{Body: "{{.Alert.ID}} escalated"})
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	require.NoError(t, store.Delete(context.Background(), "pager"))
+	_, err = store.Get("pager")
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	// The delete is persisted as an inactive row
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, false, lastInsert.Arguments.Get(3).([]interface{})[5])
+}
+
+func TestNotificationEventUsesRuleTemplate(t *testing.T) {
+	service := &RuleService{templates: &TemplateStore{templates: map[string]*models.NotificationTemplate{
+		"pager": {Name: "pager", Body: "{{.Event}}: {{.Alert.ID}} on {{.Data.device_id}}"},
+	}}}
+	alert := &models.Alert{ID: "rule1:dev1:2", Data: `{"device_id":"dev1"}`}
+
+	event := service.notificationEvent(notify.EventEscalated, alert, &models.Rule{ID: "rule1", NotificationTemplate: "pager"})
+	assert.Equal(t, "escalated: rule1:dev1:2 on dev1", event.Message)
+
+	// Missing templates fall back to the default message
+	event = service.notificationEvent(notify.EventFired, alert, &models.Rule{ID: "rule1", NotificationTemplate: "gone"})
+	assert.Empty(t, event.Message)
+
+	err := service.validateRuleNotificationTemplate(&models.Rule{NotificationTemplate: "gone"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestTemplateStoreTranslations(t *testing.T) {
+	mockClient := new(MockClient)
+	mockClient.On("EnsureMutableStream", mock.Anything, timeplus.NotificationTemplatesStream, mock.Anything, []string{"name"}).Return(nil)
+	mockClient.On("ExecuteQuery", mock.Anything, mock.Anything).Return([]map[string]interface{}{
+		{"name": "short", "body": "{{.Alert.RuleName}}", "translations": `{"de":"{{.Alert.RuleName}} ausgelöst"}`},
+	}, nil)
+	mockClient.On("InsertIntoStream", mock.Anything, timeplus.NotificationTemplatesStream, mock.Anything, mock.Anything).Return(nil)
+
+	store, err := NewTemplateStore(context.Background(), mockClient)
+	require.NoError(t, err)
+	loaded, err := store.Get("short")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"de": "{{.Alert.RuleName}} ausgelöst"}, loaded.Translations)
+
+	_, err = store.Create(context.Background(), &models.NotificationTemplate{Name: "bad-locale", Body: "x", Translations: map[string]string{"german": "x"}})
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+	_, err = store.Create(context.Background(), &models.NotificationTemplate{Name: "bad-body", Body: "x", Translations: map[string]string{"de": "{{if}}"}})
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+
+	created, err := store.Create(context.Background(), &models.NotificationTemplate{
+		Name: "pager", Body: "{{.Alert.ID}}", Translations: map[string]string{"pt_br": "{{.Alert.ID}} disparado"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pt-BR": "{{.Alert.ID}} disparado"}, created.Translations)
+
+	lastInsert := mockClient.Calls[len(mockClient.Calls)-1]
+	assert.Equal(t, `{"pt-BR":"{{.Alert.ID}} disparado"}`, lastInsert.Arguments.Get(3).([]interface{})[6])
+}
+
+func TestNotificationEventRendersTranslations(t *testing.T) {
+	service := &RuleService{templates: &TemplateStore{templates: map[string]*models.NotificationTemplate{
+		"pager": {
+			Name: "pager",
+			Body: "[{{severityName .Alert.Severity}}] {{.Alert.ID}} {{eventName .Event}} at {{localTime .Alert.TriggeredAt}}",
+			Translations: map[string]string{
+				"de": "[{{severityName .Alert.Severity}}] {{.Alert.ID}} {{eventName .Event}} am {{localTime .Alert.TriggeredAt}} ({{.Locale}})",
+			},
+		},
+	}}}
+	alert := &models.Alert{ID: "rule1:dev1:2", Severity: models.RuleSeverityCritical, TriggeredAt: time.Date(2026, 3, 4, 12, 30, 0, 0, time.UTC)}
+
+	event := service.notificationEvent(notify.EventFired, alert, &models.Rule{ID: "rule1", NotificationTemplate: "pager"})
+	assert.Equal(t, "[Critical] rule1:dev1:2 fired at Mar 4, 2026 12:30 UTC", event.Message)
+	assert.Equal(t, "[Kritisch] rule1:dev1:2 ausgelöst am 04.03.2026 12:30 UTC (de)", event.Localized("de-AT").Message)
+	// Locales without a translation get the English message
+	assert.Equal(t, event.Message, event.Localized("fr").Message)
+}
+
+func TestTemplateBodyFallsBackToEnglish(t *testing.T) {
+	tmpl := &models.NotificationTemplate{Body: "english", Translations: map[string]string{"de": "deutsch", "pt-BR": "português"}}
+
+	for locale, expected := range map[string][2]string{
+		"de-CH": {"deutsch", "de"},
+		"pt-br": {"português", "pt-BR"},
+		"pt":    {"english", "en"},
+		"":      {"english", "en"},
+	} {
+		body, resolved := TemplateBody(tmpl, locale)
+		assert.Equal(t, expected[0], body, locale)
+		assert.Equal(t, expected[1], resolved, locale)
+	}
+}
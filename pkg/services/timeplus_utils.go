@@ -19,7 +19,12 @@ func getTime(data map[string]interface{}, key string) time.Time {
 func parseTimeplus(val interface{}) (time.Time, error) {
 	switch v := val.(type) {
 	case time.Time:
-		return v, nil
+		return v.UTC(), nil
+	case *time.Time: // Nullable columns
+		if v == nil {
+			return time.Time{}, fmt.Errorf("time value is null")
+		}
+		return v.UTC(), nil
 	case string:
 		// Try to parse various time formats
 		layouts := []string{
@@ -41,3 +46,35 @@ func parseTimeplus(val interface{}) (time.Time, error) {
 		return time.Time{}, fmt.Errorf("unsupported time type: %T", val)
 	}
 }
+
+// getInt64 extracts an integer value from a map, accepting any numeric type Timeplus returns (count() is uint64)
+func getInt64(data map[string]interface{}, key string) int64 {
+	switch v := data[key].(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// getFloat64 extracts a floating point value from a map, accepting any numeric type
+func getFloat64(data map[string]interface{}, key string) float64 {
+	switch v := data[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	default:
+		return float64(getInt64(data, key))
+	}
+}
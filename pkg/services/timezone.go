@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// displayLocation is the timezone times are shown in to people, UTC unless configured
+var displayLocation atomic.Pointer[time.Location]
+
+// SetDisplayTimezone sets the timezone of display contexts, such as notification templates and
+// API times given without an offset. Stored timestamps are always UTC.
+func SetDisplayTimezone(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	displayLocation.Store(loc)
+}
+
+// DisplayTimezone returns the timezone of display contexts
+func DisplayTimezone() *time.Location {
+	if loc := displayLocation.Load(); loc != nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// LoadDisplayTimezone returns the timezone with the given IANA name, e.g. "Europe/Berlin", or
+// UTC when the name is empty
+func LoadDisplayTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// ParseTime parses an API time: RFC3339 with an offset, or a date and time without one, e.g.
+// "2026-01-02 15:04:05" or "2026-01-02", read in the display timezone. The result is UTC.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, DisplayTimezone()); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or a date and time", value)
+}
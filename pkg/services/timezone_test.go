@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/models"
+	"github.com/timeplus-io/tp-alert-gateway/pkg/notify"
+)
+
+func TestParseTime(t *testing.T) {
+	newYork, err := LoadDisplayTimezone("America/New_York")
+	require.NoError(t, err)
+	SetDisplayTimezone(newYork)
+	t.Cleanup(func() { SetDisplayTimezone(time.UTC) })
+
+	for value, expected := range map[string]time.Time{
+		"2026-01-02T15:04:05Z":      time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		"2026-01-02T15:04:05+01:00": time.Date(2026, 1, 2, 14, 4, 5, 0, time.UTC),
+		"2026-01-02T15:04:05.5Z":    time.Date(2026, 1, 2, 15, 4, 5, 5e8, time.UTC),
+		// Without an offset, times are in the display timezone
+		"2026-01-02 15:04:05": time.Date(2026, 1, 2, 20, 4, 5, 0, time.UTC),
+		"2026-07-02T15:04":    time.Date(2026, 7, 2, 19, 4, 0, 0, time.UTC),
+		"2026-01-02":          time.Date(2026, 1, 2, 5, 0, 0, 0, time.UTC),
+	} {
+		parsed, err := ParseTime(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, parsed, value)
+		assert.Equal(t, time.UTC, parsed.Location(), value)
+	}
+
+	_, err = ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestLoadDisplayTimezone(t *testing.T) {
+	loc, err := LoadDisplayTimezone("")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, loc)
+
+	_, err = LoadDisplayTimezone("Mars/Olympus_Mons")
+	assert.Error(t, err)
+}
+
+func TestNotificationTemplateTimesInDisplayTimezone(t *testing.T) {
+	tokyo, err := LoadDisplayTimezone("Asia/Tokyo")
+	require.NoError(t, err)
+	SetDisplayTimezone(tokyo)
+	t.Cleanup(func() { SetDisplayTimezone(time.UTC) })
+
+	alert := &models.Alert{TriggeredAt: time.Date(2026, 1, 2, 12, 30, 0, 0, time.UTC)}
+	message, err := RenderNotificationTemplate(`{{formatTime .Alert.TriggeredAt "15:04 MST"}} {{formatTime .Alert.TriggeredAt}}`, notify.EventFired, alert)
+	require.NoError(t, err)
+	assert.Equal(t, "21:30 JST 2026-01-02T21:30:00+09:00", message)
+}
@@ -0,0 +1,108 @@
+package timeplus
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// alertAcksPartitions is the number of streams the shared alert acks stream is split into
+var alertAcksPartitions atomic.Int32
+
+func init() {
+	alertAcksPartitions.Store(1)
+}
+
+// alertAcksPartitionPattern matches the names of alert acks partitions after the first
+var alertAcksPartitionPattern = regexp.MustCompile("^" + AlertAcksMutableStream + `_p([0-9]+)$`)
+
+// SetAlertAcksPartitions splits the shared alert acks stream into n streams, with each rule's
+// alerts routed to one of them by a hash of the rule ID. Partition 0 is AlertAcksMutableStream
+// itself, so a single partition is the unpartitioned layout. Must be set before the streams are
+// set up; changing it moves rules to other partitions until their alerts are rebalanced.
+func SetAlertAcksPartitions(n int) {
+	if n < 1 {
+		n = 1
+	}
+	alertAcksPartitions.Store(int32(n))
+}
+
+// AlertAcksPartitions returns the number of partitions of the shared alert acks stream
+func AlertAcksPartitions() int {
+	return int(alertAcksPartitions.Load())
+}
+
+// AlertAcksPartitionStream returns the name of a partition of the shared alert acks stream
+func AlertAcksPartitionStream(partition int) string {
+	if partition == 0 {
+		return AlertAcksMutableStream
+	}
+	return fmt.Sprintf("%s_p%d", AlertAcksMutableStream, partition)
+}
+
+// AlertAcksStreams returns every partition of the shared alert acks stream
+func AlertAcksStreams() []string {
+	streams := make([]string, AlertAcksPartitions())
+	for i := range streams {
+		streams[i] = AlertAcksPartitionStream(i)
+	}
+	return streams
+}
+
+// AlertAcksStreamFor returns the partition of the shared alert acks stream holding a rule's alerts
+func AlertAcksStreamFor(ruleID string) string {
+	partitions := AlertAcksPartitions()
+	if partitions == 1 {
+		return AlertAcksMutableStream
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ruleID))
+	return AlertAcksPartitionStream(int(h.Sum32() % uint32(partitions)))
+}
+
+// IsAlertAcksPartition reports whether a stream is a partition of the shared alert acks stream,
+// including partitions beyond the configured number left over from a larger setting
+func IsAlertAcksPartition(stream string) bool {
+	return stream == AlertAcksMutableStream || alertAcksPartitionPattern.MatchString(stream)
+}
+
+// AlertAcksPartitionIndex returns the partition number of an alert acks partition stream, or -1
+func AlertAcksPartitionIndex(stream string) int {
+	if stream == AlertAcksMutableStream {
+		return 0
+	}
+	if match := alertAcksPartitionPattern.FindStringSubmatch(stream); match != nil {
+		if i, err := strconv.Atoi(match[1]); err == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// AlertAcksTable returns a FROM expression reading the alerts of every rule in the shared alert
+// acks stream: table(tp_alert_acks_mutable) when it isn't partitioned, otherwise a union of the
+// partitions
+func AlertAcksTable() string {
+	streams := AlertAcksStreams()
+	if len(streams) == 1 {
+		return fmt.Sprintf("table(%s)", streams[0])
+	}
+	selects := make([]string, len(streams))
+	for i, stream := range streams {
+		selects[i] = fmt.Sprintf("SELECT * FROM table(`%s`)", stream)
+	}
+	return "(" + strings.Join(selects, " UNION ALL ") + ")"
+}
+
+// alertAcksPartitionSchemas returns the versioned schemas of the partitions after the first, which
+// is migrated as a system stream
+func alertAcksPartitionSchemas() []StreamSchema {
+	var schemas []StreamSchema
+	for _, stream := range AlertAcksStreams()[1:] {
+		schemas = append(schemas, AlertAcksStreamSchema(stream))
+	}
+	return schemas
+}
@@ -0,0 +1,53 @@
+package timeplus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertAcksPartitionsDefaultToSharedStream(t *testing.T) {
+	assert.Equal(t, 1, AlertAcksPartitions())
+	assert.Equal(t, []string{AlertAcksMutableStream}, AlertAcksStreams())
+	assert.Equal(t, AlertAcksMutableStream, AlertAcksStreamFor("r1"))
+	assert.Equal(t, "table(tp_alert_acks_mutable)", AlertAcksTable())
+	assert.Empty(t, alertAcksPartitionSchemas())
+}
+
+func TestAlertAcksStreamForRoutesByRuleID(t *testing.T) {
+	SetAlertAcksPartitions(4)
+	t.Cleanup(func() { SetAlertAcksPartitions(1) })
+
+	assert.Equal(t, []string{"tp_alert_acks_mutable", "tp_alert_acks_mutable_p1", "tp_alert_acks_mutable_p2", "tp_alert_acks_mutable_p3"},
+		AlertAcksStreams())
+
+	used := map[string]bool{}
+	for _, ruleID := range []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8"} {
+		stream := AlertAcksStreamFor(ruleID)
+		assert.Equal(t, stream, AlertAcksStreamFor(ruleID), "routing must be stable")
+		assert.Contains(t, AlertAcksStreams(), stream)
+		used[stream] = true
+	}
+	assert.Greater(t, len(used), 1, "rules should spread over the partitions")
+
+	assert.Equal(t, "(SELECT * FROM table(`tp_alert_acks_mutable`) UNION ALL SELECT * FROM table(`tp_alert_acks_mutable_p1`) "+
+		"UNION ALL SELECT * FROM table(`tp_alert_acks_mutable_p2`) UNION ALL SELECT * FROM table(`tp_alert_acks_mutable_p3`))",
+		AlertAcksTable())
+	assert.Len(t, alertAcksPartitionSchemas(), 3)
+}
+
+func TestSetAlertAcksPartitionsIgnoresInvalidCounts(t *testing.T) {
+	SetAlertAcksPartitions(0)
+	t.Cleanup(func() { SetAlertAcksPartitions(1) })
+	assert.Equal(t, 1, AlertAcksPartitions())
+}
+
+func TestAlertAcksPartitionIndex(t *testing.T) {
+	assert.Equal(t, 0, AlertAcksPartitionIndex("tp_alert_acks_mutable"))
+	assert.Equal(t, 12, AlertAcksPartitionIndex("tp_alert_acks_mutable_p12"))
+	assert.Equal(t, -1, AlertAcksPartitionIndex("rule_r1_alert_acks"))
+
+	assert.True(t, IsAlertAcksPartition("tp_alert_acks_mutable_p7"))
+	assert.False(t, IsAlertAcksPartition("tp_alert_acks_mutable_px"))
+	assert.False(t, IsAlertAcksPartition("rule_r1_alert_acks"))
+}
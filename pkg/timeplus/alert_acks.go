@@ -61,15 +61,15 @@ func (c *Client) CreateAlertAck(ctx context.Context, alertAck AlertAck) error {
 
 	// Construct SQL to insert data
 	sql := fmt.Sprintf(
-		"INSERT INTO %s (alert_id, rule_id, state, updated_by, updated_at, comment, valid_until) VALUES ('%s', '%s', '%s', '%s', parseDateTimeBestEffort('%s'), '%s', parseDateTimeBestEffort('%s'))",
+		"INSERT INTO %s (alert_id, rule_id, state, updated_by, updated_at, comment, valid_until) VALUES ('%s', '%s', '%s', '%s', %s, '%s', %s)",
 		AlertAcksStream,
 		alertAck.AlertID,
 		alertAck.RuleID,
 		alertAck.State,
 		alertAck.UpdatedBy,
-		alertAck.UpdatedAt.Format(time.RFC3339),
+		DateTime64(alertAck.UpdatedAt),
 		alertAck.Comment,
-		alertAck.ValidUntil.Format(time.RFC3339),
+		DateTime64(alertAck.ValidUntil),
 	)
 
 	_, err := c.ExecuteQuery(ctx, sql)
@@ -0,0 +1,343 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // Operations run as usual
+	CircuitOpen     = "open"      // Operations fail fast until the open duration is over
+	CircuitHalfOpen = "half_open" // One operation probes whether Timeplus is back
+)
+
+// Circuit breaker defaults, used when BreakerOptions leaves them unset
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned, wrapped in a CircuitOpenError, for operations not attempted because
+// Timeplus kept failing
+var ErrCircuitOpen = errors.New("Timeplus is unavailable, circuit breaker is open")
+
+// CircuitOpenError is returned for an operation the circuit breaker rejected, with how long until
+// it lets an operation through again
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match rejected operations
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitRetryAfter returns how long until the circuit breaker that rejected an operation lets
+// operations through again. It returns false for other errors.
+func CircuitRetryAfter(err error) (time.Duration, bool) {
+	var open *CircuitOpenError
+	if errors.As(err, &open) {
+		return open.RetryAfter, true
+	}
+	return 0, false
+}
+
+// BreakerOptions configures a circuit breaker
+type BreakerOptions struct {
+	FailureThreshold int           // Consecutive failures opening the circuit, DefaultBreakerFailureThreshold when not positive
+	OpenDuration     time.Duration // How long operations fail fast, DefaultBreakerOpenDuration when not positive
+}
+
+// CircuitStatus describes a circuit breaker
+type CircuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	Rejected            int64      `json:"rejected"` // Operations failed fast since the client was created
+	Opened              int64      `json:"opened"`   // Times the circuit opened since the client was created
+}
+
+// CircuitBreaker stops operations against Timeplus after consecutive failures, so callers fail
+// fast instead of each waiting out the client's retries. After the open duration one operation is
+// let through; the circuit closes if it succeeds and opens again if it fails. Only failures to
+// reach Timeplus count: exceptions Timeplus raised, such as a syntax error, mean it is up.
+type CircuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool // Whether the half-open probe is in flight
+	rejected int64
+	opened   int64
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = DefaultBreakerOpenDuration
+	}
+	return &CircuitBreaker{
+		threshold:    opts.FailureThreshold,
+		openDuration: opts.OpenDuration,
+		now:          time.Now,
+		state:        CircuitClosed,
+	}
+}
+
+// allow returns a CircuitOpenError if an operation must fail fast
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if remaining := b.openDuration - b.now().Sub(b.openedAt); remaining > 0 {
+			b.rejected++
+			return &CircuitOpenError{RetryAfter: remaining}
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		logrus.Info("Timeplus circuit breaker half-open, probing")
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			b.rejected++
+			return &CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// allowStream returns a CircuitOpenError unless the circuit is closed
+func (b *CircuitBreaker) allowStream() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitClosed {
+		return nil
+	}
+	b.rejected++
+	retryAfter := b.openDuration - b.now().Sub(b.openedAt)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &CircuitOpenError{RetryAfter: retryAfter}
+}
+
+// record counts the outcome of an operation allow let through. ctx is the caller's context: an
+// operation the caller canceled says nothing about Timeplus, and neither does a quiet stream.
+func (b *CircuitBreaker) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		err = nil
+	}
+	if _, raised := ServerError(err); raised || errors.Is(err, ErrStreamIdle) {
+		err = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+	}
+	if err == nil {
+		if b.state != CircuitClosed {
+			logrus.Info("Timeplus circuit breaker closed, Timeplus is reachable again")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+		b.opened++
+		logrus.Warnf("Timeplus circuit breaker open for %s after %d consecutive failure(s): %v", b.openDuration, b.failures, err)
+	}
+}
+
+// Status returns the breaker's state
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Rejected:            b.rejected,
+		Opened:              b.opened,
+	}
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// BreakerClient is a TimeplusClient failing fast while its circuit breaker is open
+type BreakerClient struct {
+	client  TimeplusClient
+	breaker *CircuitBreaker
+}
+
+// Ensure BreakerClient implements TimeplusClient
+var _ TimeplusClient = (*BreakerClient)(nil)
+
+// NewBreakerClient wraps a client with a circuit breaker
+func NewBreakerClient(client TimeplusClient, opts BreakerOptions) *BreakerClient {
+	return &BreakerClient{client: client, breaker: NewCircuitBreaker(opts)}
+}
+
+// Breaker returns the client's circuit breaker
+func (c *BreakerClient) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// ConnectionStats returns the wrapped client's stats, when it keeps them, with the circuit's state
+func (c *BreakerClient) ConnectionStats() ConnectionStats {
+	var stats ConnectionStats
+	if statser, ok := c.client.(interface{ ConnectionStats() ConnectionStats }); ok {
+		stats = statser.ConnectionStats()
+	}
+	circuit := c.breaker.Status()
+	stats.Circuit = &circuit
+	return stats
+}
+
+// call runs an operation through the circuit breaker
+func (c *BreakerClient) call(ctx context.Context, op func() error) error {
+	if err := c.breaker.allow(); err != nil {
+		return err
+	}
+	err := op()
+	c.breaker.record(ctx, err)
+	return err
+}
+
+// callStream runs a streaming query through the circuit breaker. Streaming queries run until
+// canceled, so one is never the probe of a half-open circuit, and only one ending with an error
+// counts.
+func (c *BreakerClient) callStream(ctx context.Context, op func() error) error {
+	if err := c.breaker.allowStream(); err != nil {
+		return err
+	}
+	if err := op(); err != nil {
+		c.breaker.record(ctx, err)
+		return err
+	}
+	return nil
+}
+
+func (c *BreakerClient) StreamExists(ctx context.Context, name string) (exists bool, err error) {
+	err = c.call(ctx, func() error { exists, err = c.client.StreamExists(ctx, name); return err })
+	return exists, err
+}
+
+func (c *BreakerClient) CreateStream(ctx context.Context, name string, schema []Column) error {
+	return c.call(ctx, func() error { return c.client.CreateStream(ctx, name, schema) })
+}
+
+func (c *BreakerClient) CreateMaterializedView(ctx context.Context, name string, query string) error {
+	return c.call(ctx, func() error { return c.client.CreateMaterializedView(ctx, name, query) })
+}
+
+func (c *BreakerClient) DeleteMaterializedView(ctx context.Context, name string) error {
+	return c.call(ctx, func() error { return c.client.DeleteMaterializedView(ctx, name) })
+}
+
+func (c *BreakerClient) ViewExists(ctx context.Context, name string) (exists bool, err error) {
+	err = c.call(ctx, func() error { exists, err = c.client.ViewExists(ctx, name); return err })
+	return exists, err
+}
+
+func (c *BreakerClient) DeleteStream(ctx context.Context, name string) error {
+	return c.call(ctx, func() error { return c.client.DeleteStream(ctx, name) })
+}
+
+func (c *BreakerClient) ListStreams(ctx context.Context) (names []string, err error) {
+	err = c.call(ctx, func() error { names, err = c.client.ListStreams(ctx); return err })
+	return names, err
+}
+
+func (c *BreakerClient) ListViews(ctx context.Context) (names []string, err error) {
+	err = c.call(ctx, func() error { names, err = c.client.ListViews(ctx); return err })
+	return names, err
+}
+
+func (c *BreakerClient) ListMaterializedViews(ctx context.Context) (names []string, err error) {
+	err = c.call(ctx, func() error { names, err = c.client.ListMaterializedViews(ctx); return err })
+	return names, err
+}
+
+func (c *BreakerClient) CreateRuleResultsStream(ctx context.Context, ruleID string) error {
+	return c.call(ctx, func() error { return c.client.CreateRuleResultsStream(ctx, ruleID) })
+}
+
+func (c *BreakerClient) ExecuteDDL(ctx context.Context, query string) error {
+	return c.call(ctx, func() error { return c.client.ExecuteDDL(ctx, query) })
+}
+
+func (c *BreakerClient) EnsureMutableStream(ctx context.Context, streamName string, schema []Column, primaryKeys []string) error {
+	return c.call(ctx, func() error { return c.client.EnsureMutableStream(ctx, streamName, schema, primaryKeys) })
+}
+
+func (c *BreakerClient) ExecuteQuery(ctx context.Context, query string) (rows []map[string]interface{}, err error) {
+	err = c.call(ctx, func() error { rows, err = c.client.ExecuteQuery(ctx, query); return err })
+	return rows, err
+}
+
+func (c *BreakerClient) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
+	return c.call(ctx, func() error { return c.client.InsertIntoStream(ctx, streamName, columns, values) })
+}
+
+// StreamQuery starts a streaming query unless the circuit is open, see callStream
+func (c *BreakerClient) StreamQuery(ctx context.Context, query string, callback func(row interface{})) error {
+	return c.callStream(ctx, func() error { return c.client.StreamQuery(ctx, query, callback) })
+}
+
+// ExecuteStreamingQuery starts a streaming query unless the circuit is open, see callStream
+func (c *BreakerClient) ExecuteStreamingQuery(ctx context.Context, query string, callback func(result map[string]interface{}) error) error {
+	return c.callStream(ctx, func() error { return c.client.ExecuteStreamingQuery(ctx, query, callback) })
+}
+
+func (c *BreakerClient) SetupAlertAcksStream(ctx context.Context) error {
+	return c.call(ctx, func() error { return c.client.SetupAlertAcksStream(ctx) })
+}
+
+func (c *BreakerClient) SetupMutableAlertAcksStream(ctx context.Context) error {
+	return c.call(ctx, func() error { return c.client.SetupMutableAlertAcksStream(ctx) })
+}
+
+func (c *BreakerClient) CreateAlertAck(ctx context.Context, alertAck AlertAck) error {
+	return c.call(ctx, func() error { return c.client.CreateAlertAck(ctx, alertAck) })
+}
+
+func (c *BreakerClient) GetAlertAck(ctx context.Context, alertID string) (ack *AlertAck, err error) {
+	err = c.call(ctx, func() error { ack, err = c.client.GetAlertAck(ctx, alertID); return err })
+	return ack, err
+}
+
+func (c *BreakerClient) IsAlertAcknowledged(ctx context.Context, alertID string) (acknowledged bool, err error) {
+	err = c.call(ctx, func() error { acknowledged, err = c.client.IsAlertAcknowledged(ctx, alertID); return err })
+	return acknowledged, err
+}
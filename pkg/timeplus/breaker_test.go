@@ -0,0 +1,74 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/proto"
+)
+
+// flakyClient fails its queries with err
+type flakyClient struct {
+	TimeplusClient
+	err     error
+	queries int
+}
+
+func (c *flakyClient) ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	c.queries++
+	return nil, c.err
+}
+
+func TestBreakerClient(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	inner := &flakyClient{err: errors.New("EOF")}
+	client := NewBreakerClient(inner, BreakerOptions{FailureThreshold: 3, OpenDuration: 10 * time.Second})
+	client.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.ExecuteQuery(ctx, "SELECT 1")
+		require.EqualError(t, err, "EOF")
+	}
+	assert.Equal(t, CircuitOpen, client.Breaker().Status().State)
+
+	_, err := client.ExecuteQuery(ctx, "SELECT 1")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	retryAfter, ok := CircuitRetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Second, retryAfter)
+	assert.Equal(t, 3, inner.queries, "an open circuit fails fast")
+	assert.ErrorIs(t, client.ExecuteStreamingQuery(ctx, "SELECT 1", nil), ErrCircuitOpen)
+
+	// The probe after the open duration fails, so the circuit opens again
+	now = now.Add(10 * time.Second)
+	_, err = client.ExecuteQuery(ctx, "SELECT 1")
+	require.EqualError(t, err, "EOF")
+	assert.Equal(t, CircuitOpen, client.Breaker().Status().State)
+
+	// Exceptions Timeplus raised mean it is up
+	now = now.Add(10 * time.Second)
+	inner.err = &proto.Exception{Code: 60, Message: "Stream default.missing doesn't exist"}
+	_, err = client.ExecuteQuery(ctx, "SELECT * FROM missing")
+	require.Error(t, err)
+	status := client.Breaker().Status()
+	assert.Equal(t, CircuitClosed, status.State)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Equal(t, int64(2), status.Opened)
+	assert.Equal(t, int64(2), status.Rejected)
+	assert.Equal(t, CircuitClosed, client.ConnectionStats().Circuit.State)
+}
+
+func TestCircuitBreakerIgnoresCanceledCalls(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerOptions{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.NoError(t, breaker.allow())
+	breaker.record(ctx, context.Canceled)
+	assert.Equal(t, CircuitClosed, breaker.Status().State)
+}
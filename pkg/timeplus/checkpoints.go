@@ -0,0 +1,124 @@
+package timeplus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Checkpoint is how far a streaming consumer has read a stream: the _tp_time of the latest row it
+// handled, and how many rows at exactly that time it handled. Resuming at the time replays those
+// rows, so the count lets them be skipped rather than handled twice.
+type Checkpoint struct {
+	Time time.Time `json:"time"`
+	Rows int64     `json:"rows"`
+}
+
+// CheckpointStore keeps the checkpoints of streaming consumers in MonitorCheckpointsStream, one row
+// per key, so consumers resume where they left off after a restart. Checkpoints are recorded in
+// memory as rows are handled and written by Flush, rather than once per row.
+type CheckpointStore struct {
+	client StreamStore
+
+	mu      sync.Mutex
+	saved   map[string]Checkpoint // Checkpoints loaded or written, by key
+	pending map[string]Checkpoint // Checkpoints not yet written, by key
+}
+
+// NewCheckpointStore creates a checkpoint store keeping its checkpoints through client
+func NewCheckpointStore(client StreamStore) *CheckpointStore {
+	return &CheckpointStore{
+		client:  client,
+		saved:   make(map[string]Checkpoint),
+		pending: make(map[string]Checkpoint),
+	}
+}
+
+// Load creates the checkpoints stream if needed and reads the checkpoints written before the last shutdown
+func (s *CheckpointStore) Load(ctx context.Context) error {
+	if err := s.client.EnsureMutableStream(ctx, MonitorCheckpointsStream, GetMonitorCheckpointsSchema(), []string{"stream"}); err != nil {
+		return fmt.Errorf("failed to ensure checkpoints stream: %w", err)
+	}
+
+	rows, err := s.client.ExecuteQuery(ctx, fmt.Sprintf("SELECT stream, checkpoint, rows FROM table(%s)", MonitorCheckpointsStream))
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoints: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range rows {
+		key, _ := row["stream"].(string)
+		if t, ok := row["checkpoint"].(time.Time); ok && key != "" {
+			s.saved[key] = Checkpoint{Time: t, Rows: checkpointRows(row["rows"])}
+		}
+	}
+	return nil
+}
+
+// Get returns the latest checkpoint recorded under key, written or not
+func (s *CheckpointStore) Get(key string) (Checkpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if checkpoint, ok := s.pending[key]; ok {
+		return checkpoint, true
+	}
+	checkpoint, ok := s.saved[key]
+	return checkpoint, ok
+}
+
+// Record records a checkpoint under key, to be written by the next Flush
+func (s *CheckpointStore) Record(key string, checkpoint Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[key] = checkpoint
+}
+
+// Pending returns the number of checkpoints recorded but not yet written
+func (s *CheckpointStore) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Flush writes the checkpoints recorded since the last flush. Checkpoints that fail to be written
+// are kept for the next flush unless a newer one was recorded meanwhile.
+func (s *CheckpointStore) Flush(ctx context.Context) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[string]Checkpoint)
+	s.mu.Unlock()
+
+	for key, checkpoint := range pending {
+		err := s.client.InsertIntoStream(ctx, MonitorCheckpointsStream, []string{"stream", "checkpoint", "rows", "updated_at"},
+			[]interface{}{key, checkpoint.Time, checkpoint.Rows, time.Now()})
+
+		s.mu.Lock()
+		if err != nil {
+			logrus.Warnf("Failed to write checkpoint of %s: %v", key, err)
+			if _, ok := s.pending[key]; !ok {
+				s.pending[key] = checkpoint
+			}
+		} else {
+			s.saved[key] = checkpoint
+		}
+		s.mu.Unlock()
+	}
+}
+
+// checkpointRows reads the rows column, which checkpoints written before it existed lack
+func checkpointRows(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case int32:
+		return int64(v)
+	default:
+		return 0
+	}
+}
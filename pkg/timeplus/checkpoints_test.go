@@ -0,0 +1,71 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkpointsClient keeps the rows inserted into the checkpoints stream, failing inserts while err is set
+type checkpointsClient struct {
+	TimeplusClient
+	rows []map[string]interface{}
+	err  error
+}
+
+func (c *checkpointsClient) EnsureMutableStream(ctx context.Context, streamName string, schema []Column, primaryKeys []string) error {
+	return nil
+}
+
+func (c *checkpointsClient) ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	return c.rows, nil
+}
+
+func (c *checkpointsClient) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	c.rows = append(c.rows, row)
+	return nil
+}
+
+func TestCheckpointStore(t *testing.T) {
+	checkpoint := Checkpoint{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Rows: 2}
+	client := &checkpointsClient{
+		// Written before checkpoints counted rows
+		rows: []map[string]interface{}{{"stream": "tp_alert_acks_mutable", "checkpoint": checkpoint.Time}},
+		err:  errors.New("EOF"),
+	}
+	ctx := context.Background()
+
+	store := NewCheckpointStore(client)
+	require.NoError(t, store.Load(ctx))
+	loaded, ok := store.Get("tp_alert_acks_mutable")
+	require.True(t, ok)
+	assert.Equal(t, Checkpoint{Time: checkpoint.Time}, loaded)
+	_, ok = store.Get("other")
+	assert.False(t, ok)
+
+	store.Record("tp_alert_acks_mutable", checkpoint)
+	store.Flush(ctx)
+	assert.Equal(t, 1, store.Pending(), "failed write is kept for the next flush")
+
+	client.err = nil
+	store.Flush(ctx)
+	assert.Zero(t, store.Pending())
+
+	// A restarted consumer resumes from the written checkpoint
+	client.rows = client.rows[1:]
+	restarted := NewCheckpointStore(client)
+	require.NoError(t, restarted.Load(ctx))
+	loaded, _ = restarted.Get("tp_alert_acks_mutable")
+	assert.Equal(t, checkpoint, loaded)
+}
@@ -3,8 +3,9 @@ package timeplus
 import (
 	"context"
 	"fmt"
-	"reflect"
+	"math"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -29,6 +30,9 @@ type Client struct {
 	username  string          // Store username
 	password  string          // Store password
 	opts      *proton.Options // Store original connection options
+	stats     clientStats     // Operation counts and recent errors, for diagnostics
+	timeouts  Timeouts        // How long each class of operation may take
+	schemas   streamSchemas   // Column types of the streams inserted into
 }
 
 // NewClient creates a new Timeplus client
@@ -109,9 +113,26 @@ func NewClient(cfg *config.TimeplusConfig) (*Client, error) {
 		username:  cfg.Username,
 		password:  cfg.Password,
 		opts:      opts, // Store the original options
+		timeouts:  timeoutsFromConfig(cfg.Timeouts),
 	}, nil
 }
 
+// Close closes the underlying connection to Timeplus
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// execDDL runs a statement creating or dropping a stream or view, bounded by the DDL timeout
+func (c *Client) execDDL(ctx context.Context, query string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.DDL)
+	defer cancel()
+	c.schemas.clear()
+	return c.conn.Exec(ctx, query)
+}
+
 // CreateStream creates a new stream with the given name and schema
 func (c *Client) CreateStream(ctx context.Context, name string, schema []Column) error {
 	// Build schema string
@@ -130,7 +151,7 @@ func (c *Client) CreateStream(ctx context.Context, name string, schema []Column)
 
 	// Create stream, wrap name in backticks
 	query := fmt.Sprintf("CREATE STREAM IF NOT EXISTS `%s` %s", name, schemaStr)
-	if err := c.conn.Exec(ctx, query); err != nil {
+	if err := c.execDDL(ctx, query); err != nil {
 		return fmt.Errorf("failed to create stream '%s': %w", name, err)
 	}
 	return nil
@@ -174,7 +195,7 @@ func (c *Client) CreateMaterializedView(ctx context.Context, name string, query
 	// Execute the query with retry logic
 	var lastErr error
 	for i := 0; i < 3; i++ {
-		err := c.conn.Exec(ctx, finalQuery)
+		err := c.execDDL(ctx, finalQuery)
 		if err == nil {
 			return nil // Success
 		}
@@ -201,7 +222,7 @@ func (c *Client) DeleteMaterializedView(ctx context.Context, name string) error
 
 	// Drop view, wrap name in backticks
 	query := fmt.Sprintf("DROP VIEW `%s`", name)
-	if err = c.conn.Exec(ctx, query); err != nil {
+	if err = c.execDDL(ctx, query); err != nil {
 		return fmt.Errorf("failed to delete view '%s': %w", name, err)
 	}
 	return nil
@@ -209,6 +230,9 @@ func (c *Client) DeleteMaterializedView(ctx context.Context, name string) error
 
 // ViewExists checks if a view exists
 func (c *Client) ViewExists(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	// Use SHOW STREAMS to check if view exists (in Timeplus, views are also streams)
 	// Use LIKE for pattern matching, no backticks needed here, but escape single quotes in name
 	escapedName := strings.ReplaceAll(name, "'", "''")
@@ -241,7 +265,7 @@ func (c *Client) DeleteStream(ctx context.Context, name string) error {
 
 	// Drop stream, wrap name in backticks
 	query := fmt.Sprintf("DROP STREAM `%s`", name)
-	if err = c.conn.Exec(ctx, query); err != nil {
+	if err = c.execDDL(ctx, query); err != nil {
 		return fmt.Errorf("failed to delete stream '%s': %w", name, err)
 	}
 	return nil
@@ -249,6 +273,9 @@ func (c *Client) DeleteStream(ctx context.Context, name string) error {
 
 // StreamExists checks if a stream exists
 func (c *Client) StreamExists(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	// Use SHOW STREAMS to check if stream exists
 	// Use LIKE for pattern matching, no backticks needed here, but escape single quotes in name
 	escapedName := strings.ReplaceAll(name, "'", "''")
@@ -277,6 +304,7 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
 			logrus.Warnf("Retrying query execution (attempt %d/%d) after error: %v", attempt+1, maxRetries, lastErr)
+			c.stats.record("retry", "", nil)
 
 			// Check for EOF errors and reconnect if needed
 			if lastErr != nil && strings.Contains(lastErr.Error(), "EOF") {
@@ -300,7 +328,7 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 		}
 
 		// Create a timeout context for this query attempt
-		queryCtx, cancel := context.WithTimeout(ctx, 15*time.Second) // Increased timeout
+		queryCtx, cancel := withTimeout(ctx, c.timeouts.Query)
 		defer cancel()
 
 		// Execute the query using direct connection
@@ -308,6 +336,7 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 		if err != nil {
 			lastErr = err
 			cancel() // Cancel this attempt's context
+			c.stats.record("query", query, err)
 
 			if strings.Contains(err.Error(), "EOF") {
 				logrus.Warnf("EOF error during query execution, will retry: %v", err)
@@ -322,9 +351,8 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 		// Successfully connected, get column metadata
 		defer rows.Close()
 
-		// Get column names and types
-		columnNames := rows.Columns()
-		columnTypes := rows.ColumnTypes()
+		// Pick a decoder for each column from its type
+		scanner := newRowScanner(rows)
 
 		// Prepare result
 		result := make([]map[string]interface{}, 0)
@@ -333,29 +361,20 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 		rowsProcessed := 0
 		for rows.Next() {
 			rowsProcessed++
-			// Create a slice for scanning, matching column types
-			scanArgs := make([]interface{}, len(columnNames))
-			for i, ct := range columnTypes {
-				scanArgs[i] = reflect.New(ct.ScanType()).Interface()
-			}
-
-			if err := rows.Scan(scanArgs...); err != nil {
+			rowMap, err := scanner.scan(rows)
+			if err != nil {
 				cancel() // Cancel context before returning
+				c.stats.record("query", query, err)
 				return nil, fmt.Errorf("failed to scan row: %w", err)
 			}
 
-			// Convert to map
-			rowMap := make(map[string]interface{})
-			for i, name := range columnNames {
-				rowMap[name] = reflect.ValueOf(scanArgs[i]).Elem().Interface()
-			}
-
 			result = append(result, rowMap)
 		}
 
 		if err := rows.Err(); err != nil {
 			cancel() // Cancel context before returning
 			lastErr = err
+			c.stats.record("query", query, err)
 
 			if strings.Contains(err.Error(), "EOF") {
 				logrus.Warnf("EOF error during row iteration, will retry: %v", err)
@@ -366,6 +385,7 @@ func (c *Client) ExecuteQuery(ctx context.Context, query string) ([]map[string]i
 		}
 
 		logrus.Infof("Successfully executed query with %d rows", rowsProcessed)
+		c.stats.record("query", query, nil)
 		return result, nil
 	}
 
@@ -410,6 +430,7 @@ func (c *Client) reconnect(ctx context.Context) error {
 
 			if pingErr == nil {
 				c.conn = conn
+				c.stats.record("reconnect", "", nil)
 				logrus.Info("Successfully reconnected to Timeplus")
 				return nil
 			}
@@ -423,56 +444,71 @@ func (c *Client) reconnect(ctx context.Context) error {
 		}
 	}
 
+	c.stats.record("reconnect", "", err)
 	return fmt.Errorf("failed to reconnect after %d attempts: %w", maxRetries, err)
 }
 
 // StreamQuery executes a streaming query and calls the given callback for each result row
 func (c *Client) StreamQuery(ctx context.Context, query string, callback func(row interface{})) error {
-	rows, err := c.conn.Query(ctx, query)
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// End a query that goes without rows for the idle timeout, so its caller can resubscribe
+	var idled atomic.Bool
+	idleTimer := time.AfterFunc(time.Duration(math.MaxInt64), func() {
+		idled.Store(true)
+		cancel()
+	})
+	defer idleTimer.Stop()
+	resetIdle := func() {
+		if c.timeouts.StreamIdle > 0 {
+			idleTimer.Reset(c.timeouts.StreamIdle)
+		}
+	}
+	// The caller canceling ends the query as usual; only the idle timer ending it is reported
+	result := func(err error) error {
+		if idled.Load() && ctx.Err() == nil {
+			return fmt.Errorf("%w for %s", ErrStreamIdle, c.timeouts.StreamIdle)
+		}
+		return err
+	}
+	resetIdle()
+
+	rows, err := c.conn.Query(streamCtx, query)
+	c.stats.record("stream", query, err)
 	if err != nil {
-		return fmt.Errorf("failed to execute streaming query: %w", err)
+		return result(fmt.Errorf("failed to execute streaming query: %w", err))
 	}
 	defer rows.Close()
 
-	// Get column names and types
-	columnNames := rows.Columns()
-	columnTypes := rows.ColumnTypes()
+	// Pick a decoder for each column from its type
+	scanner := newRowScanner(rows)
 
 	// Process each row
 	for rows.Next() {
-		// Create a slice for scanning, matching column types
-		rowScan := make([]interface{}, len(columnNames))
-		for i, ct := range columnTypes {
-			// Use driver.Valuer for Scan based on the type
-			rowScan[i] = reflect.New(ct.ScanType()).Interface()
-		}
+		resetIdle()
 
-		if err := rows.Scan(rowScan...); err != nil {
+		// Create a map with column names as keys
+		rowMap, err := scanner.scan(rows)
+		if err != nil {
 			logrus.Errorf("Error scanning streaming row: %v", err)
 			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Create a map with column names as keys
-		rowMap := make(map[string]interface{})
-		for i, colName := range columnNames {
-			// Dereference the pointer received from Scan
-			val := reflect.ValueOf(rowScan[i]).Elem().Interface()
-			rowMap[colName] = val
-		}
-
-		// Call the callback with the row
+		// Call the callback with the row, a slow callback doesn't make the query idle
 		callback(rowMap)
+		resetIdle()
 
 		// Check if context is done
 		select {
-		case <-ctx.Done():
-			return ctx.Err()
+		case <-streamCtx.Done():
+			return result(streamCtx.Err())
 		default:
 			// Continue processing
 		}
 	}
 
-	return rows.Err()
+	return result(rows.Err())
 }
 
 // GetAlertSchema returns the schema for the alert stream
@@ -480,7 +516,8 @@ func (c *Client) GetAlertSchema() []Column {
 	return GetAlertSchema()
 }
 
-// InsertIntoStream inserts data into a stream
+// InsertIntoStream inserts data into a stream. Values are formatted for the types of the columns
+// they go to, e.g. times with the precision of a datetime64 column and slices as arrays.
 func (c *Client) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
 	maxRetries := 5
 	var lastErr error
@@ -488,26 +525,15 @@ func (c *Client) InsertIntoStream(ctx context.Context, streamName string, column
 	// Build the SQL query with column names and placeholders
 	columnList := strings.Join(columns, ", ")
 
-	// Format each value for SQL
+	// Format each value for SQL, by its Go type where the column's type is unknown
+	types := c.columnTypes(ctx, streamName)
 	formattedValues := make([]string, len(values))
 	for i, val := range values {
-		switch v := val.(type) {
-		case nil:
-			formattedValues[i] = "null"
-		case string:
-			formattedValues[i] = fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
-		case time.Time:
-			formattedValues[i] = fmt.Sprintf("'%s'", v.Format("2006-01-02 15:04:05.000"))
-		case bool:
-			formattedValues[i] = fmt.Sprintf("%t", v)
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			formattedValues[i] = fmt.Sprintf("%d", v)
-		case float32, float64:
-			formattedValues[i] = fmt.Sprintf("%f", v)
-		default:
-			// Try to convert to string if possible
-			formattedValues[i] = fmt.Sprintf("'%v'", v)
+		columnType := ""
+		if i < len(columns) {
+			columnType = types[columns[i]]
 		}
+		formattedValues[i] = formatInsertValue(val, columnType)
 	}
 
 	valuesList := strings.Join(formattedValues, ", ")
@@ -518,6 +544,7 @@ func (c *Client) InsertIntoStream(ctx context.Context, streamName string, column
 		if attempt > 0 {
 			logrus.Warnf("Retrying insertion to stream '%s' (attempt %d/%d) after error: %v",
 				streamName, attempt+1, maxRetries, lastErr)
+			c.stats.record("retry", "", nil)
 
 			// Check for EOF errors and reconnect if needed
 			if lastErr != nil && strings.Contains(lastErr.Error(), "EOF") {
@@ -540,7 +567,10 @@ func (c *Client) InsertIntoStream(ctx context.Context, streamName string, column
 		}
 
 		// Execute the insert statement directly
-		err := c.conn.Exec(ctx, query)
+		insertCtx, cancel := withTimeout(ctx, c.timeouts.Insert)
+		err := c.conn.Exec(insertCtx, query)
+		cancel()
+		c.stats.record("insert", query, err)
 		if err == nil {
 			return nil // Success
 		}
@@ -548,6 +578,9 @@ func (c *Client) InsertIntoStream(ctx context.Context, streamName string, column
 		lastErr = err
 		logrus.Warnf("Insert failed (attempt %d/%d): %v", attempt+1, maxRetries, err)
 
+		// The stream may have changed since it was described, describe it again next time
+		c.schemas.forget(streamName)
+
 		// Continue with retry logic
 	}
 
@@ -584,6 +617,9 @@ func (c *Client) CreateContextWithRetry(parent context.Context, timeout time.Dur
 
 // CheckStreamExists efficiently checks if a specific stream exists
 func (c *Client) CheckStreamExists(ctx context.Context, streamName string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	query := fmt.Sprintf("SHOW STREAMS LIKE '%s'", streamName)
 
 	rows, err := c.conn.Query(ctx, query)
@@ -596,10 +632,20 @@ func (c *Client) CheckStreamExists(ctx context.Context, streamName string) (bool
 	return rows.Next(), rows.Err()
 }
 
-// SetupMutableAlertAcksStream ensures the mutable alert acknowledgments stream exists
+// SetupMutableAlertAcksStream ensures the mutable alert acknowledgments stream exists, with every
+// partition when it is partitioned
 func (c *Client) SetupMutableAlertAcksStream(ctx context.Context) error {
+	for _, streamName := range AlertAcksStreams() {
+		if err := c.setupMutableAlertAcksStream(ctx, streamName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupMutableAlertAcksStream ensures one mutable alert acknowledgments stream exists
+func (c *Client) setupMutableAlertAcksStream(ctx context.Context, streamName string) error {
 	schema := GetMutableAlertAcksSchema()
-	streamName := AlertAcksMutableStream
 
 	// Efficiently check if stream exists using direct query
 	exists, err := c.CheckStreamExists(ctx, streamName)
@@ -630,7 +676,7 @@ func (c *Client) SetupMutableAlertAcksStream(ctx context.Context) error {
 	query := fmt.Sprintf("CREATE MUTABLE STREAM %s (%s) PRIMARY KEY (rule_id, entity_id)",
 		streamName, columnsStr)
 
-	err = c.conn.Exec(ctx, query)
+	err = c.execDDL(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to create mutable stream: %w", err)
 	}
@@ -641,6 +687,9 @@ func (c *Client) SetupMutableAlertAcksStream(ctx context.Context) error {
 
 // ListStreams returns a list of all streams in Timeplus
 func (c *Client) ListStreams(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	// Use direct connection Query method instead of ExecuteQuery
 	rows, err := c.conn.Query(ctx, "SHOW STREAMS")
 	if err != nil {
@@ -662,21 +711,16 @@ func (c *Client) ListStreams(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("no 'name' column found in SHOW STREAMS result")
 	}
 
+	scanner := newRowScanner(rows)
 	streams := make([]string, 0)
 	for rows.Next() {
-		// Create a slice for scanning, matching column types
-		columnTypes := rows.ColumnTypes()
-		scanArgs := make([]interface{}, len(columnNames))
-		for i, ct := range columnTypes {
-			scanArgs[i] = reflect.New(ct.ScanType()).Interface()
-		}
-
-		if err := rows.Scan(scanArgs...); err != nil {
+		row, err := scanner.scan(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		// Extract the name value
-		if name, ok := reflect.ValueOf(scanArgs[nameIdx]).Elem().Interface().(string); ok {
+		if name, ok := row[columnNames[nameIdx]].(string); ok {
 			streams = append(streams, name)
 		}
 	}
@@ -708,6 +752,9 @@ func (c *Client) ExecuteStreamingQuery(ctx context.Context, query string, callba
 
 // ListViews returns a list of all views in the workspace
 func (c *Client) ListViews(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	query := "SELECT name FROM system.tables WHERE engine = 'View'"
 
 	// Use direct connection Query method instead of ExecuteQuery
@@ -735,6 +782,9 @@ func (c *Client) ListViews(ctx context.Context) ([]string, error) {
 
 // ListMaterializedViews returns a list of all materialized views in the workspace
 func (c *Client) ListMaterializedViews(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+
 	query := "SELECT name FROM system.tables WHERE engine = 'MaterializedView'"
 
 	// Use direct connection Query method instead of ExecuteQuery
@@ -763,7 +813,9 @@ func (c *Client) ListMaterializedViews(ctx context.Context) ([]string, error) {
 // ExecuteDDL executes a Data Definition Language (DDL) statement like CREATE or DROP
 func (c *Client) ExecuteDDL(ctx context.Context, query string) error {
 	// DDL statements typically don't return rows, so use Exec
-	if err := c.conn.Exec(ctx, query); err != nil {
+	err := c.execDDL(ctx, query)
+	c.stats.record("ddl", query, err)
+	if err != nil {
 		return fmt.Errorf("failed to execute DDL query '%s': %w", query, err)
 	}
 	return nil
@@ -792,9 +844,9 @@ func (c *Client) EnsureMutableStream(ctx context.Context, streamName string, sch
 		}
 		if col.Nullable {
 			columnsStr += fmt.Sprintf("`%s` nullable(%s)", col.Name, col.Type)
-
+		} else {
+			columnsStr += fmt.Sprintf("`%s` %s", col.Name, col.Type)
 		}
-		columnsStr += fmt.Sprintf("`%s` %s", col.Name, col.Type)
 	}
 
 	// Build primary key string
@@ -814,7 +866,7 @@ func (c *Client) EnsureMutableStream(ctx context.Context, streamName string, sch
 		streamName, columnsStr, primaryKeyStr)
 
 	// Execute the DDL
-	err = c.conn.Exec(ctx, query)
+	err = c.execDDL(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to create mutable stream '%s': %w", streamName, err)
 	}
@@ -0,0 +1,217 @@
+package timeplus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+)
+
+// benchColumn is a column of the rows a fakeConn returns
+type benchColumn struct {
+	name     string
+	dbType   string
+	scanType reflect.Type
+	value    interface{}
+}
+
+// alertAckBenchColumns mirrors the columns GetAlerts reads from the alert acks stream
+var alertAckBenchColumns = []benchColumn{
+	{"rule_id", "string", reflect.TypeOf(""), "6b0f6c2e-1d6a-4d8e-9d0c-2f1a7e3b9c41"},
+	{"entity_id", "string", reflect.TypeOf(""), "thermostat_living_room"},
+	{"state", "string", reflect.TypeOf(""), AlertStateActive},
+	{"created_at", "datetime64(3)", reflect.TypeOf(time.Time{}), time.Now()},
+	{"updated_at", "datetime64(3)", reflect.TypeOf(time.Time{}), time.Now()},
+	{"updated_by", "string", reflect.TypeOf(""), ""},
+	{"comment", "string", reflect.TypeOf(""), `{"device_id": "thermostat_living_room", "temperature": 35.5}`},
+	{"severity", "nullable(string)", reflect.TypeOf((*string)(nil)), func() *string { s := "warning"; return &s }()},
+	{"firing_seq", "uint64", reflect.TypeOf(uint64(0)), uint64(3)},
+}
+
+// fakeConn answers every query with the same rows, so the client's row handling can be measured
+// without a server. Other driver.Conn methods aren't implemented.
+type fakeConn struct {
+	driver.Conn
+	columns []benchColumn
+	rows    int
+}
+
+func (c *fakeConn) Query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	return &fakeRows{columns: c.columns, remaining: c.rows}, nil
+}
+
+// fakeRows returns a fixed number of identical rows
+type fakeRows struct {
+	columns   []benchColumn
+	remaining int
+}
+
+func (r *fakeRows) Next() bool {
+	if r.remaining == 0 {
+		return false
+	}
+	r.remaining--
+	return true
+}
+
+// Scan sets the destinations through reflection, as the driver does
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.columns), len(dest))
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.columns[i].value))
+	}
+	return nil
+}
+
+func (r *fakeRows) ScanStruct(dest interface{}) error { return fmt.Errorf("not implemented") }
+func (r *fakeRows) Totals(dest ...interface{}) error  { return nil }
+func (r *fakeRows) Close() error                      { return nil }
+func (r *fakeRows) Err() error                        { return nil }
+
+func (r *fakeRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+func (r *fakeRows) ColumnTypes() []driver.ColumnType {
+	types := make([]driver.ColumnType, len(r.columns))
+	for i, column := range r.columns {
+		types[i] = fakeColumnType{column}
+	}
+	return types
+}
+
+type fakeColumnType struct {
+	column benchColumn
+}
+
+func (t fakeColumnType) Name() string             { return t.column.name }
+func (t fakeColumnType) Nullable() bool           { return t.column.scanType.Kind() == reflect.Ptr }
+func (t fakeColumnType) ScanType() reflect.Type   { return t.column.scanType }
+func (t fakeColumnType) DatabaseTypeName() string { return t.column.dbType }
+
+// quietLogs keeps per-query logging out of the measurements
+func quietLogs(b *testing.B) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.WarnLevel)
+	b.Cleanup(func() { logrus.SetLevel(level) })
+}
+
+func BenchmarkExecuteQuery(b *testing.B) {
+	quietLogs(b)
+	ctx := context.Background()
+
+	for _, rows := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			client := &Client{conn: &fakeConn{columns: alertAckBenchColumns, rows: rows}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.ExecuteQuery(ctx, "SELECT"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkStreamQuery(b *testing.B) {
+	quietLogs(b)
+	ctx := context.Background()
+	client := &Client{conn: &fakeConn{columns: alertAckBenchColumns, rows: 10000}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := client.StreamQuery(ctx, "SELECT", func(row interface{}) {}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchClient connects to the instance in TP_BENCH_ADDRESS and creates a stream for insert
+// benchmarks, skipping the benchmark when no instance is configured
+func benchClient(b *testing.B) (*Client, string) {
+	address := os.Getenv("TP_BENCH_ADDRESS")
+	if address == "" {
+		b.Skip("set TP_BENCH_ADDRESS to run insert benchmarks against Timeplus")
+	}
+	quietLogs(b)
+
+	username := os.Getenv("TP_BENCH_USERNAME")
+	if username == "" {
+		username = "default"
+	}
+	client, err := NewClient(&config.TimeplusConfig{
+		Address:   address,
+		Username:  username,
+		Password:  os.Getenv("TP_BENCH_PASSWORD"),
+		Workspace: "default",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	stream := fmt.Sprintf("bench_inserts_%d", time.Now().UnixNano())
+	if err := client.CreateStream(ctx, stream, []Column{
+		{Name: "device_id", Type: "string"},
+		{Name: "temperature", Type: "float64"},
+		{Name: "timestamp", Type: "datetime64(3)"},
+	}); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		client.ExecuteDDL(context.Background(), fmt.Sprintf("DROP STREAM IF EXISTS `%s`", stream))
+		client.Close()
+	})
+	return client, stream
+}
+
+// BenchmarkInsertIntoStream measures inserting rows one statement at a time, per row
+func BenchmarkInsertIntoStream(b *testing.B) {
+	client, stream := benchClient(b)
+	ctx := context.Background()
+	columns := []string{"device_id", "temperature", "timestamp"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		values := []interface{}{fmt.Sprintf("device_%d", i%100), 20.5, time.Now()}
+		if err := client.InsertIntoStream(ctx, stream, columns, values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBatchInsert measures inserting rows through the driver's batches of 1000 rows, per row
+func BenchmarkBatchInsert(b *testing.B) {
+	client, stream := benchClient(b)
+	ctx := context.Background()
+	const batchSize = 1000
+
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += batchSize {
+		batch, err := client.conn.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO `%s` (device_id, temperature, timestamp)", stream))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := sent; i < b.N && i < sent+batchSize; i++ {
+			if err := batch.Append(fmt.Sprintf("device_%d", i%100), 20.5, time.Now()); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := batch.Send(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,32 +4,76 @@ import (
 	"context"
 )
 
-// TimeplusClient defines the interface for a Timeplus client
-// This allows us to mock the client for testing
-type TimeplusClient interface {
+// DDLExecutor creates, lists and drops streams and views
+type DDLExecutor interface {
 	StreamExists(ctx context.Context, name string) (bool, error)
 	CreateStream(ctx context.Context, name string, schema []Column) error
 	CreateMaterializedView(ctx context.Context, name string, query string) error
 	DeleteMaterializedView(ctx context.Context, name string) error
 	ViewExists(ctx context.Context, name string) (bool, error)
 	DeleteStream(ctx context.Context, name string) error
-	ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error)
-	StreamQuery(ctx context.Context, query string, callback func(row interface{})) error
-	InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error
-
-	// New methods
 	ListStreams(ctx context.Context) ([]string, error)
 	ListViews(ctx context.Context) ([]string, error)
 	ListMaterializedViews(ctx context.Context) ([]string, error)
+	CreateRuleResultsStream(ctx context.Context, ruleID string) error
+	ExecuteDDL(ctx context.Context, query string) error
+	EnsureMutableStream(ctx context.Context, streamName string, schema []Column, primaryKeys []string) error
+}
+
+// QueryRunner runs bounded queries and inserts rows
+type QueryRunner interface {
+	ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error)
+	InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error
+}
+
+// StreamSubscriber runs unbounded streaming queries, calling back for each row until the
+// context is canceled
+type StreamSubscriber interface {
+	StreamQuery(ctx context.Context, query string, callback func(row interface{})) error
 	ExecuteStreamingQuery(ctx context.Context, query string, callback func(result map[string]interface{}) error) error
-	SetupAlertAcksStream(ctx context.Context) error
+}
+
+// AckStore sets up the mutable stream alert acknowledgements are kept in
+type AckStore interface {
 	SetupMutableAlertAcksStream(ctx context.Context) error
+}
+
+// LegacyAckStore reads and writes alert acknowledgements in the append-only alert acks stream
+// that preceded the mutable one
+type LegacyAckStore interface {
+	AckStore
+	SetupAlertAcksStream(ctx context.Context) error
 	CreateAlertAck(ctx context.Context, alertAck AlertAck) error
 	GetAlertAck(ctx context.Context, alertID string) (*AlertAck, error)
 	IsAlertAcknowledged(ctx context.Context, alertID string) (bool, error)
-	CreateRuleResultsStream(ctx context.Context, ruleID string) error
-	ExecuteDDL(ctx context.Context, query string) error
-	EnsureMutableStream(ctx context.Context, streamName string, schema []Column, primaryKeys []string) error
+}
+
+// StreamStore is what code keeping its state in streams needs: creating its streams, and
+// querying and inserting rows
+type StreamStore interface {
+	DDLExecutor
+	QueryRunner
+}
+
+// MonitorStore is what streaming consumers need: streaming queries, and streams to keep their
+// checkpoints in
+type MonitorStore interface {
+	StreamStore
+	StreamSubscriber
+}
+
+// RuleStore is what the rule service needs: the streams and views of rules, bounded and
+// streaming queries, and the alert acks stream
+type RuleStore interface {
+	MonitorStore
+	AckStore
+}
+
+// TimeplusClient defines the interface for a Timeplus client
+// This allows us to mock the client for testing
+type TimeplusClient interface {
+	RuleStore
+	LegacyAckStore
 }
 
 // Ensure Client implements TimeplusClient
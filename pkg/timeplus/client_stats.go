@@ -0,0 +1,119 @@
+package timeplus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxRecentErrors is the number of failed operations a client remembers for diagnostics
+const maxRecentErrors = 50
+
+// maxErrorQueryLength truncates queries kept with recent errors, inserts can be large
+const maxErrorQueryLength = 500
+
+// ClientError is a failed Timeplus operation
+type ClientError struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"` // "query", "stream", "insert", "ddl" or "reconnect"
+	Query     string    `json:"query,omitempty"`
+	Error     string    `json:"error"`
+}
+
+// ConnectionStats describes a client's connection and the operations it ran since it was created
+type ConnectionStats struct {
+	Address       string        `json:"address"`
+	Username      string        `json:"username"`
+	Workspace     string        `json:"workspace"`
+	ServerVersion string        `json:"serverVersion,omitempty"`
+	OpenConns     int           `json:"openConns"`
+	IdleConns     int           `json:"idleConns"`
+	MaxOpenConns  int           `json:"maxOpenConns"`
+	Queries       int64         `json:"queries"`
+	Inserts       int64         `json:"inserts"`
+	DDL           int64         `json:"ddl"`
+	Errors        int64         `json:"errors"`
+	Reconnects    int64         `json:"reconnects"`
+	Retries       int64         `json:"retries"`      // Queries and inserts tried again after failing
+	RecentErrors  []ClientError `json:"recentErrors"` // Oldest first
+	// Circuit breaker failing operations fast, nil when the client has none
+	Circuit *CircuitStatus `json:"circuit,omitempty"`
+}
+
+// clientStats counts a client's operations and keeps its most recent errors
+type clientStats struct {
+	mu           sync.Mutex
+	queries      int64
+	inserts      int64
+	ddl          int64
+	errors       int64
+	reconnects   int64
+	retries      int64
+	recentErrors []ClientError
+}
+
+// record counts an operation and remembers it if it failed
+func (s *clientStats) record(operation, query string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch operation {
+	case "query", "stream":
+		s.queries++
+	case "insert":
+		s.inserts++
+	case "ddl":
+		s.ddl++
+	case "reconnect":
+		s.reconnects++
+	case "retry":
+		s.retries++
+	}
+	if err == nil {
+		return
+	}
+
+	s.errors++
+	if len(query) > maxErrorQueryLength {
+		query = query[:maxErrorQueryLength] + "..."
+	}
+	if len(s.recentErrors) == maxRecentErrors {
+		s.recentErrors = append(s.recentErrors[:0], s.recentErrors[1:]...)
+	}
+	s.recentErrors = append(s.recentErrors, ClientError{
+		Time:      time.Now(),
+		Operation: operation,
+		Query:     query,
+		Error:     err.Error(),
+	})
+}
+
+// ConnectionStats returns the client's connection details, operation counts and recent errors
+func (c *Client) ConnectionStats() ConnectionStats {
+	stats := ConnectionStats{
+		Address:   c.address,
+		Username:  c.username,
+		Workspace: c.workspace,
+	}
+
+	if c.conn != nil {
+		connStats := c.conn.Stats()
+		stats.OpenConns = connStats.Open
+		stats.IdleConns = connStats.Idle
+		stats.MaxOpenConns = connStats.MaxOpenConns
+		if version, err := c.conn.ServerVersion(); err == nil && version != nil {
+			stats.ServerVersion = fmt.Sprintf("%s %d.%d.%d", version.Name, version.Version.Major, version.Version.Minor, version.Version.Patch)
+		}
+	}
+
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+	stats.Queries = c.stats.queries
+	stats.Inserts = c.stats.inserts
+	stats.DDL = c.stats.ddl
+	stats.Errors = c.stats.errors
+	stats.Reconnects = c.stats.reconnects
+	stats.Retries = c.stats.retries
+	stats.RecentErrors = append([]ClientError{}, c.stats.recentErrors...)
+	return stats
+}
@@ -0,0 +1,40 @@
+package timeplus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientStatsKeepsRecentErrors(t *testing.T) {
+	c := &Client{address: "localhost:8464", username: "proton", workspace: "default"}
+
+	c.stats.record("query", "SELECT 1", nil)
+	c.stats.record("retry", "", nil)
+	c.stats.record("insert", "INSERT INTO s VALUES ("+strings.Repeat("1, ", 500)+"1)", errors.New("insert failed"))
+	for i := 0; i < maxRecentErrors; i++ {
+		c.stats.record("ddl", fmt.Sprintf("CREATE VIEW v%d AS SELECT 1", i), errors.New("ddl failed"))
+	}
+
+	stats := c.ConnectionStats()
+	assert.Equal(t, "localhost:8464", stats.Address)
+	assert.EqualValues(t, 1, stats.Queries)
+	assert.EqualValues(t, 1, stats.Inserts)
+	assert.EqualValues(t, maxRecentErrors, stats.DDL)
+	assert.EqualValues(t, maxRecentErrors+1, stats.Errors)
+	assert.EqualValues(t, 1, stats.Retries)
+
+	// The insert error was the oldest and has been dropped
+	assert.Len(t, stats.RecentErrors, maxRecentErrors)
+	assert.Equal(t, "CREATE VIEW v0 AS SELECT 1", stats.RecentErrors[0].Query)
+	assert.Equal(t, "ddl failed", stats.RecentErrors[maxRecentErrors-1].Error)
+}
+
+func TestClientStatsTruncatesQueries(t *testing.T) {
+	var stats clientStats
+	stats.record("insert", strings.Repeat("x", 2*maxErrorQueryLength), errors.New("failed"))
+	assert.Len(t, stats.recentErrors[0].Query, maxErrorQueryLength+len("..."))
+}
@@ -0,0 +1,110 @@
+package timeplus
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// encryptedPayloadPrefix starts captured rows encrypted at rest. It's followed by the hex nonce and,
+// after a colon, the hex AES-256-GCM ciphertext and tag.
+const encryptedPayloadPrefix = "enc:v1:"
+
+// payloadNonceSize is the size of the random nonce each payload is encrypted with
+const payloadNonceSize = 12
+
+// ErrPayloadKeyMissing is returned when an encrypted payload is read or written without a key
+var ErrPayloadKeyMissing = errors.New("no payload encryption key is set")
+
+var (
+	payloadKeyMu sync.RWMutex
+	payloadKey   []byte
+)
+
+// SetPayloadKey sets the AES-256 key the triggering rows of rules with encryptData are encrypted
+// with, 32 bytes. An empty key disables encryption. Must be set before rules are started.
+func SetPayloadKey(key []byte) error {
+	if len(key) != 0 && len(key) != 32 {
+		return fmt.Errorf("payload encryption key must be 32 bytes, got %d", len(key))
+	}
+	payloadKeyMu.Lock()
+	defer payloadKeyMu.Unlock()
+	payloadKey = append([]byte(nil), key...)
+	return nil
+}
+
+// PayloadEncryptionEnabled reports whether a payload encryption key is set
+func PayloadEncryptionEnabled() bool {
+	payloadKeyMu.RLock()
+	defer payloadKeyMu.RUnlock()
+	return len(payloadKey) > 0
+}
+
+// IsEncryptedPayload reports whether a captured row is encrypted
+func IsEncryptedPayload(data string) bool {
+	return strings.HasPrefix(data, encryptedPayloadPrefix)
+}
+
+// EncryptPayload encrypts a captured row with the payload key
+func EncryptPayload(data string) (string, error) {
+	gcm, err := payloadCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, payloadNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nil, nonce, []byte(data), nil)
+	return encryptedPayloadPrefix + hex.EncodeToString(nonce) + ":" + hex.EncodeToString(sealed), nil
+}
+
+// DecryptPayload decrypts a captured row encrypted by EncryptPayload.
+// Rows that aren't encrypted are returned as they are.
+func DecryptPayload(data string) (string, error) {
+	if !IsEncryptedPayload(data) {
+		return data, nil
+	}
+	gcm, err := payloadCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonceHex, sealedHex, ok := strings.Cut(strings.TrimPrefix(data, encryptedPayloadPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted payload")
+	}
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil || len(nonce) != payloadNonceSize {
+		return "", errors.New("malformed encrypted payload nonce")
+	}
+	sealed, err := hex.DecodeString(sealedHex)
+	if err != nil {
+		return "", errors.New("malformed encrypted payload ciphertext")
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+	return string(plain), nil
+}
+
+// payloadCipher returns the AES-GCM cipher of the payload key
+func payloadCipher() (cipher.AEAD, error) {
+	payloadKeyMu.RLock()
+	key := payloadKey
+	payloadKeyMu.RUnlock()
+	if len(key) == 0 {
+		return nil, ErrPayloadKeyMissing
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, payloadNonceSize)
+}
@@ -0,0 +1,60 @@
+package timeplus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadEncryption(t *testing.T) {
+	t.Cleanup(func() { SetPayloadKey(nil) })
+
+	_, err := EncryptPayload(`{"cpu": 97}`)
+	assert.ErrorIs(t, err, ErrPayloadKeyMissing)
+	assert.Error(t, SetPayloadKey([]byte("short")))
+
+	require.NoError(t, SetPayloadKey(bytes.Repeat([]byte{1}, 32)))
+	assert.True(t, PayloadEncryptionEnabled())
+
+	encrypted, err := EncryptPayload(`{"cpu": 97}`)
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedPayload(encrypted))
+	assert.NotContains(t, encrypted, "cpu")
+
+	again, err := EncryptPayload(`{"cpu": 97}`)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "each payload has its own nonce")
+
+	decrypted, err := DecryptPayload(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, `{"cpu": 97}`, decrypted)
+
+	// Rows written in the clear are read as they are
+	decrypted, err = DecryptPayload(`{"cpu": 97}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"cpu": 97}`, decrypted)
+
+	// Tampered rows and other keys fail authentication
+	tampered := []byte(encrypted)
+	tampered[len(tampered)-1] ^= 1
+	_, err = DecryptPayload(string(tampered))
+	assert.Error(t, err)
+	require.NoError(t, SetPayloadKey(bytes.Repeat([]byte{2}, 32)))
+	_, err = DecryptPayload(encrypted)
+	assert.Error(t, err)
+}
+
+func TestThrottledMaterializedViewStagesAlerts(t *testing.T) {
+	query := GetRuleThrottledMaterializedViewQuery("rule1", "rule_rule1_view", "rule_rule1_mv", 5, "account",
+		"'{}'", "tp_alert_acks_rule1", "'critical'", "view._tp_time", AlertPayloadStagingStream)
+	assert.Contains(t, query, "INTO `tp_alert_payload_staging`")
+	assert.Contains(t, query, "LEFT JOIN `tp_alert_acks_rule1` AS ack", "throttling still reads the acks stream")
+	assert.Contains(t, query, "'tp_alert_acks_rule1' AS target_stream")
+
+	query = GetRuleThrottledMaterializedViewQuery("rule1", "rule_rule1_view", "rule_rule1_mv", 5, "account",
+		"'{}'", "tp_alert_acks_rule1", "'critical'", "view._tp_time", "")
+	assert.Contains(t, query, "INTO `tp_alert_acks_rule1`")
+	assert.NotContains(t, query, "target_stream")
+}
@@ -0,0 +1,60 @@
+package timeplus
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// environment is the name system streams are prefixed with, empty for unprefixed names
+var environment string
+
+// environmentPattern matches valid environment names, which become part of stream names
+var environmentPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// SetEnvironment prefixes the system streams with env, e.g. "prod_tp_rules", so gateways of
+// several environments can share one Timeplus workspace. An empty env keeps the unprefixed names.
+// Must be set before the streams are set up, like SetAlertAcksPartitions.
+func SetEnvironment(env string) error {
+	if env != "" && !environmentPattern.MatchString(env) {
+		return fmt.Errorf("environment %q must start with a lowercase letter and contain only lowercase letters, digits and underscores", env)
+	}
+	environment = env
+
+	prefix := EnvironmentPrefix()
+	AlertsStream = prefix + "tp_alerts"
+	RulesStream = prefix + "tp_rules"
+	AlertAcksStream = prefix + "tp_alert_acks"
+	AlertAcksMutableStream = prefix + "tp_alert_acks_mutable"
+	AlertPayloadStagingStream = prefix + "tp_alert_payload_staging"
+	AlertAuditStream = prefix + "tp_alert_audit"
+	AlertMetricsStream = prefix + "tp_alert_metrics"
+	NotificationTemplatesStream = prefix + "tp_notification_templates"
+	InhibitionsStream = prefix + "tp_inhibitions"
+	IncidentsStream = prefix + "tp_incidents"
+	RuleGroupsStream = prefix + "tp_rule_groups"
+	SQLMacrosStream = prefix + "tp_sql_macros"
+	MonitorCheckpointsStream = prefix + "tp_monitor_checkpoints"
+	OnCallSchedulesStream = prefix + "tp_oncall_schedules"
+	GatewayStateStream = prefix + "tp_gateway_state"
+	NotificationOutboxStream = prefix + "tp_notification_outbox"
+	PushDevicesStream = prefix + "tp_push_devices"
+	NotificationLogStream = prefix + "tp_notification_log"
+	GatewayMetricsStream = prefix + "tp_gateway_metrics"
+	SchemaVersionsStream = prefix + "tp_schema_versions"
+	alertAcksPartitionPattern = regexp.MustCompile("^" + AlertAcksMutableStream + `_p([0-9]+)$`)
+	return nil
+}
+
+// Environment returns the environment system streams are prefixed with, empty for none
+func Environment() string {
+	return environment
+}
+
+// EnvironmentPrefix returns the prefix of the environment's stream and object names, e.g. "prod_",
+// or an empty string without an environment
+func EnvironmentPrefix() string {
+	if environment == "" {
+		return ""
+	}
+	return environment + "_"
+}
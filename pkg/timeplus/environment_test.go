@@ -0,0 +1,40 @@
+package timeplus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetEnvironmentPrefixesSystemStreams(t *testing.T) {
+	require.NoError(t, SetEnvironment("staging"))
+	t.Cleanup(func() { SetEnvironment("") })
+
+	assert.Equal(t, "staging", Environment())
+	assert.Equal(t, "staging_", EnvironmentPrefix())
+	assert.Equal(t, "staging_tp_rules", RulesStream)
+	assert.Equal(t, "staging_tp_alerts", AlertsStream)
+	assert.Equal(t, "staging_tp_alert_acks_mutable", AlertAcksMutableStream)
+	assert.Equal(t, "staging_tp_schema_versions", SchemaVersionsStream)
+	for _, schema := range SystemStreamSchemas() {
+		assert.Regexp(t, "^staging_tp_", schema.Name)
+	}
+
+	SetAlertAcksPartitions(2)
+	t.Cleanup(func() { SetAlertAcksPartitions(1) })
+	assert.Equal(t, []string{"staging_tp_alert_acks_mutable", "staging_tp_alert_acks_mutable_p1"}, AlertAcksStreams())
+	assert.Equal(t, 1, AlertAcksPartitionIndex("staging_tp_alert_acks_mutable_p1"))
+	assert.False(t, IsAlertAcksPartition("tp_alert_acks_mutable_p1"), "partitions of other environments aren't ours")
+}
+
+func TestSetEnvironmentRejectsInvalidNames(t *testing.T) {
+	for _, env := range []string{"Prod", "1dev", "dev-1", "dev env"} {
+		assert.Error(t, SetEnvironment(env), env)
+	}
+	assert.Equal(t, "", Environment())
+	assert.Equal(t, "tp_rules", RulesStream)
+
+	require.NoError(t, SetEnvironment(""))
+	assert.Equal(t, "", EnvironmentPrefix())
+}
@@ -0,0 +1,17 @@
+package timeplus
+
+import (
+	"errors"
+
+	"github.com/timeplus-io/proton-go-driver/v2/lib/proto"
+)
+
+// ServerError returns the exception Timeplus raised for a statement, such as an unknown stream
+// or a syntax error. It returns false for connection errors and other client-side failures.
+func ServerError(err error) (*proto.Exception, bool) {
+	var exception *proto.Exception
+	if errors.As(err, &exception) {
+		return exception, true
+	}
+	return nil, false
+}
@@ -0,0 +1,438 @@
+package timeplus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// streamSchemas caches the column types of the streams inserted into, so each value is written as
+// a literal of its column's type. DDL clears it, since it may have changed any stream.
+type streamSchemas struct {
+	mu      sync.Mutex
+	streams map[string]map[string]string // Column types by column name, by stream
+}
+
+func (s *streamSchemas) get(stream string) (map[string]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	types, ok := s.streams[stream]
+	return types, ok
+}
+
+func (s *streamSchemas) set(stream string, types map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[string]map[string]string)
+	}
+	s.streams[stream] = types
+}
+
+// forget drops a stream's cached types, so they are described again before the next insert
+func (s *streamSchemas) forget(stream string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, stream)
+}
+
+func (s *streamSchemas) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams = nil
+}
+
+// columnTypes returns the types of a stream's columns, described once and then cached. It returns
+// nil when the stream can't be described, and its values are then formatted by their Go type.
+func (c *Client) columnTypes(ctx context.Context, stream string) map[string]string {
+	if types, ok := c.schemas.get(stream); ok {
+		return types
+	}
+
+	// A single attempt, the insert that follows retries if Timeplus is unreachable
+	queryCtx, cancel := withTimeout(ctx, c.timeouts.Query)
+	defer cancel()
+	rows, err := c.conn.Query(queryCtx, fmt.Sprintf("DESCRIBE `%s`", stream))
+	if err != nil {
+		logrus.Debugf("Failed to describe stream %s, formatting inserted values by type: %v", stream, err)
+		return nil
+	}
+	defer rows.Close()
+
+	scanner := newRowScanner(rows)
+	types := make(map[string]string)
+	for rows.Next() {
+		row, err := scanner.scan(rows)
+		if err != nil {
+			logrus.Debugf("Failed to describe stream %s, formatting inserted values by type: %v", stream, err)
+			return nil
+		}
+		types[getString(row, "name")] = getString(row, "type")
+	}
+	if err := rows.Err(); err != nil {
+		logrus.Debugf("Failed to describe stream %s, formatting inserted values by type: %v", stream, err)
+		return nil
+	}
+	c.schemas.set(stream, types)
+	return types
+}
+
+// formatInsertValue formats a value as a SQL literal for a column of the given type, e.g. a time
+// with the column's datetime64 precision or a slice as an array. Values the type has no conversion
+// for, and all values when the type is empty, are formatted by their Go type.
+func formatInsertValue(value interface{}, columnType string) string {
+	value = indirectValue(value)
+	if value == nil {
+		return "null"
+	}
+
+	columnType = strings.TrimSpace(columnType)
+	name, args := parseColumnType(columnType)
+	switch {
+	case name == "nullable" || name == "low_cardinality":
+		if len(args) == 1 {
+			return formatInsertValue(value, args[0])
+		}
+	case name == "string" || name == "fixed_string" || name == "uuid" || name == "ipv4" || name == "ipv6" ||
+		strings.HasPrefix(name, "enum"):
+		switch v := value.(type) {
+		case time.Time:
+			return QuoteString(FormatDateTime(v))
+		case []byte:
+			return QuoteString(string(v))
+		}
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map {
+			break // Let the server report the mismatch rather than store the slice's %v
+		}
+		return QuoteString(fmt.Sprint(value))
+	case name == "datetime64":
+		if t, ok := timeValue(value); ok {
+			precision := 3
+			if len(args) > 0 {
+				if p, err := strconv.Atoi(args[0]); err == nil && p >= 0 && p <= 9 {
+					precision = p
+				}
+			}
+			return formatDateTime64(t, precision)
+		}
+	case name == "datetime":
+		if t, ok := timeValue(value); ok {
+			return fmt.Sprintf("to_datetime('%s', 'UTC')", t.UTC().Format("2006-01-02 15:04:05"))
+		}
+	case name == "date" || name == "date32":
+		if t, ok := timeValue(value); ok {
+			return fmt.Sprintf("'%s'", t.UTC().Format("2006-01-02"))
+		}
+	case name == "bool" || name == "boolean":
+		if v, ok := value.(bool); ok {
+			return strconv.FormatBool(v)
+		}
+	case strings.HasPrefix(name, "int") || strings.HasPrefix(name, "uint"):
+		if s, ok := integerLiteral(value); ok {
+			return s
+		}
+	case strings.HasPrefix(name, "float"):
+		if s, ok := floatLiteral(value); ok {
+			return s
+		}
+	case strings.HasPrefix(name, "decimal"):
+		if s, ok := decimalLiteral(value); ok {
+			return fmt.Sprintf("CAST('%s' AS %s)", s, columnType)
+		}
+	case name == "array":
+		if len(args) == 1 {
+			if s, ok := arrayLiteral(value, args[0]); ok {
+				return s
+			}
+		}
+	case name == "map":
+		if len(args) == 2 {
+			if s, ok := mapLiteral(value, args[0], args[1]); ok {
+				return s
+			}
+		}
+	case name == "tuple":
+		if s, ok := tupleLiteral(value, args); ok {
+			return s
+		}
+	}
+	return formatGoValue(value)
+}
+
+// formatGoValue formats a value as a SQL literal chosen by its Go type
+func formatGoValue(value interface{}) string {
+	value = indirectValue(value)
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return QuoteString(v)
+	case []byte:
+		return QuoteString(string(v))
+	case time.Time:
+		return DateTime64(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	var s string
+	var ok bool
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s, ok = integerLiteral(value)
+	case reflect.Float32, reflect.Float64:
+		s, ok = floatLiteral(value)
+	case reflect.Slice, reflect.Array:
+		s, ok = arrayLiteral(value, "")
+	case reflect.Map:
+		s, ok = mapLiteral(value, "", "")
+	}
+	if ok {
+		return s
+	}
+	return QuoteString(fmt.Sprint(value))
+}
+
+// parseColumnType splits a column type into its lowercase name and its arguments, e.g.
+// "map(string, array(int32))" into "map" and ["string", "array(int32)"]
+func parseColumnType(columnType string) (string, []string) {
+	open := strings.Index(columnType, "(")
+	if open < 0 || !strings.HasSuffix(columnType, ")") {
+		return strings.ToLower(columnType), nil
+	}
+	name := strings.ToLower(strings.TrimSpace(columnType[:open]))
+	inner := columnType[open+1 : len(columnType)-1]
+
+	var args []string
+	depth, start := 0, 0
+	quoted := false
+	for i, r := range inner {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	return name, append(args, strings.TrimSpace(inner[start:]))
+}
+
+// formatDateTime64 returns a SQL expression for t with the given precision, read as UTC whatever
+// the server or column timezone
+func formatDateTime64(t time.Time, precision int) string {
+	layout := "2006-01-02 15:04:05"
+	if precision > 0 {
+		layout += "." + strings.Repeat("0", precision)
+	}
+	return fmt.Sprintf("to_datetime64('%s', %d, 'UTC')", t.UTC().Format(layout), precision)
+}
+
+// quoteString returns s as a SQL string literal. Backslashes are escapes in Timeplus literals, so
+// they are escaped as well as quotes.
+func QuoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// indirectValue dereferences pointers, returning nil for nil pointers
+func indirectValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// timeValue returns a time, or a string holding an RFC 3339 or datetime64 literal, as a time
+func timeValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		if t, err := time.Parse(DateTimeLayout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// integerLiteral formats integers, floats without a fractional part and strings holding an integer
+func integerLiteral(value interface{}) (string, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'f', -1, 64), true
+		}
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return s, true
+		}
+		if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// floatLiteral formats numbers and strings holding a number with the shortest literal that reads
+// back as the same value
+func floatLiteral(value interface{}) (string, bool) {
+	rv := reflect.ValueOf(value)
+	var f float64
+	bits := 64
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32:
+		f, bits = rv.Float(), 32
+	case reflect.Float64:
+		f = rv.Float()
+	case reflect.String:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return "", false
+		}
+		f = parsed
+	default:
+		return "", false
+	}
+
+	switch {
+	case math.IsNaN(f):
+		return "nan", true
+	case math.IsInf(f, 1):
+		return "inf", true
+	case math.IsInf(f, -1):
+		return "-inf", true
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits), true
+}
+
+// decimalLiteral formats numbers and strings holding a number in plain decimal notation. Strings
+// are kept as they are, so decimals beyond a float's precision can be inserted exactly.
+func decimalLiteral(value interface{}) (string, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		bits := 64
+		if rv.Kind() == reflect.Float32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(f, 'f', -1, bits), true
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		if _, err := strconv.ParseFloat(s, 64); err != nil || strings.ContainsAny(s, "eEnNiI") {
+			return "", false
+		}
+		return s, true
+	}
+	return "", false
+}
+
+// arrayLiteral formats a slice or array as an array of elements of the given type
+func arrayLiteral(value interface{}, elemType string) (string, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", false
+	}
+	if _, ok := value.([]byte); ok {
+		return "", false
+	}
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = formatInsertValue(rv.Index(i).Interface(), elemType)
+	}
+	return "[" + strings.Join(items, ", ") + "]", true
+}
+
+// mapLiteral formats a map as a map of the given key and value types, with its keys in order so
+// the same map always gives the same literal
+func mapLiteral(value interface{}, keyType, valueType string) (string, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map {
+		return "", false
+	}
+	type entry struct{ key, value string }
+	entries := make([]entry, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		entries = append(entries, entry{
+			key:   formatInsertValue(iter.Key().Interface(), keyType),
+			value: formatInsertValue(iter.Value().Interface(), valueType),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	args := make([]string, 0, 2*len(entries))
+	for _, e := range entries {
+		args = append(args, e.key, e.value)
+	}
+	return "map(" + strings.Join(args, ", ") + ")", true
+}
+
+// tupleLiteral formats a slice with an item per element of a tuple type, or a map with a value per
+// element of a named tuple type, as a tuple
+func tupleLiteral(value interface{}, elements []string) (string, bool) {
+	rv := reflect.ValueOf(value)
+	items := make([]string, len(elements))
+	switch {
+	case (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() == len(elements):
+		for i, element := range elements {
+			_, elementType := tupleElement(element)
+			items[i] = formatInsertValue(rv.Index(i).Interface(), elementType)
+		}
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		for i, element := range elements {
+			name, elementType := tupleElement(element)
+			item := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+			if name == "" || !item.IsValid() {
+				return "", false
+			}
+			items[i] = formatInsertValue(item.Interface(), elementType)
+		}
+	default:
+		return "", false
+	}
+	return "tuple(" + strings.Join(items, ", ") + ")", true
+}
@@ -0,0 +1,84 @@
+package timeplus
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatInsertValueByColumnType(t *testing.T) {
+	at := time.Date(2026, 3, 29, 3, 30, 0, 123456789, time.FixedZone("CEST", 2*3600))
+	message := "it's"
+	var missing *string
+
+	tests := []struct {
+		name       string
+		value      interface{}
+		columnType string
+		want       string
+	}{
+		{"string", "it's", "string", "'it''s'"},
+		{"backslashes", `{"a":"x\"y"}`, "string", `'{"a":"x\\"y"}'`},
+		{"number into string", 42, "string", "'42'"},
+		{"pointer", &message, "nullable(string)", "'it''s'"},
+		{"nil pointer", missing, "nullable(string)", "null"},
+		{"nil", nil, "int32", "null"},
+		{"low cardinality", "a", "low_cardinality(string)", "'a'"},
+		{"datetime64 precision", at, "datetime64(6)", "to_datetime64('2026-03-29 01:30:00.123456', 6, 'UTC')"},
+		{"datetime64 with timezone", at, "datetime64(3, 'Europe/Berlin')", "to_datetime64('2026-03-29 01:30:00.123', 3, 'UTC')"},
+		{"datetime64 default precision", at, "datetime64", "to_datetime64('2026-03-29 01:30:00.123', 3, 'UTC')"},
+		{"datetime64 from RFC 3339", "2026-03-29T01:30:00Z", "nullable(datetime64(3))", "to_datetime64('2026-03-29 01:30:00.000', 3, 'UTC')"},
+		{"datetime", at, "datetime", "to_datetime('2026-03-29 01:30:00', 'UTC')"},
+		{"date", at, "date", "'2026-03-29'"},
+		{"bool", true, "bool", "true"},
+		{"integer", int64(-7), "int64", "-7"},
+		{"integral float into integer", 3.0, "uint64", "3"},
+		{"numeric string into integer", "12", "int32", "12"},
+		{"float keeps precision", 0.1234567891, "float64", "0.1234567891"},
+		{"float32", float32(0.1), "float32", "0.1"},
+		{"nan", math.NaN(), "float64", "nan"},
+		{"infinity", math.Inf(-1), "float64", "-inf"},
+		{"decimal from float", 12.5, "decimal(10, 2)", "CAST('12.5' AS decimal(10, 2))"},
+		{"decimal from string", "12345678901234567890.12", "nullable(decimal(38, 2))", "CAST('12345678901234567890.12' AS decimal(38, 2))"},
+		{"array", []string{"a", "b'c"}, "array(string)", "['a', 'b''c']"},
+		{"nested array", [][]int{{1, 2}, {}}, "array(array(int32))", "[[1, 2], []]"},
+		{"array of times", []time.Time{at}, "array(datetime64(3))", "[to_datetime64('2026-03-29 01:30:00.123', 3, 'UTC')]"},
+		{"map", map[string]int{"b": 2, "a": 1}, "map(string, int64)", "map('a', 1, 'b', 2)"},
+		{"map of arrays", map[string][]string{"k": {"v"}}, "map(string, array(string))", "map('k', ['v'])"},
+		{"tuple", []interface{}{"a", 1.5}, "tuple(string, float64)", "tuple('a', 1.5)"},
+		{"named tuple", map[string]interface{}{"lon": 2.5, "lat": 1.5}, "tuple(lat float64, lon float64)", "tuple(1.5, 2.5)"},
+		{"unknown type", "x", "", "'x'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatInsertValue(tt.value, tt.columnType))
+		})
+	}
+}
+
+func TestFormatInsertValueFallsBackToGoType(t *testing.T) {
+	at := time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC)
+
+	// Without a column type, or one the value can't be converted to, values keep their Go type
+	assert.Equal(t, "to_datetime64('2026-03-29 01:30:00.000', 3, 'UTC')", formatInsertValue(at, ""))
+	assert.Equal(t, "1.5", formatInsertValue(1.5, ""))
+	assert.Equal(t, "[1, 2]", formatInsertValue([]int{1, 2}, ""))
+	assert.Equal(t, "'not a number'", formatInsertValue("not a number", "int32"))
+	assert.Equal(t, "'yes'", formatInsertValue("yes", "bool"))
+}
+
+func TestParseColumnType(t *testing.T) {
+	name, args := parseColumnType("Map(String, Array(Nullable(Int32)))")
+	assert.Equal(t, "map", name)
+	assert.Equal(t, []string{"String", "Array(Nullable(Int32))"}, args)
+
+	name, args = parseColumnType("enum8('a,b' = 1, 'c' = 2)")
+	assert.Equal(t, "enum8", name)
+	assert.Equal(t, []string{"'a,b' = 1", "'c' = 2"}, args)
+
+	name, args = parseColumnType("string")
+	assert.Equal(t, "string", name)
+	assert.Nil(t, args)
+}
@@ -0,0 +1,460 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaVersionsStream is the mutable stream that records the applied schema version of each system stream
+var SchemaVersionsStream = "tp_schema_versions"
+
+// ErrStreamRebuildRequired is returned when a stream's schema can only be migrated by rebuilding
+// the stream and rebuilds haven't been allowed with SetStreamRebuild
+var ErrStreamRebuildRequired = errors.New("stream must be rebuilt to migrate its schema")
+
+// streamRebuild allows the migrator to rebuild streams that reject ALTER STREAM
+var streamRebuild atomic.Bool
+
+// SetStreamRebuild allows streams whose schema can't be migrated with ALTER STREAM to be rebuilt:
+// their data is copied into a new stream, which replaces them. Off by default, since a rebuild
+// drops the live stream; the server's -rebuild-streams flag turns it on for one start.
+func SetStreamRebuild(allow bool) {
+	streamRebuild.Store(allow)
+}
+
+// StreamSchema is a versioned schema definition for one of the gateway's system streams.
+// Bump Version whenever Columns changes so the change is recorded in SchemaVersionsStream.
+type StreamSchema struct {
+	Name        string
+	Version     int
+	Columns     []Column
+	Mutable     bool
+	PrimaryKeys []string // Only used for mutable streams
+}
+
+// MigrationResult describes what the migrator did for a single system stream
+type MigrationResult struct {
+	Stream       string   `json:"stream"`
+	FromVersion  int      `json:"fromVersion"`
+	ToVersion    int      `json:"toVersion"`
+	AddedColumns []string `json:"addedColumns,omitempty"`
+	Rebuilt      bool     `json:"rebuilt"`
+	Skipped      bool     `json:"skipped"` // Stream does not exist yet and will be created with the current schema
+}
+
+// SystemStreamSchemas returns the current schemas of the gateway's system streams
+func SystemStreamSchemas() []StreamSchema {
+	return []StreamSchema{
+		{
+			Name:        RulesStream,
+			Version:     23,
+			Columns:     GetMutableRulesSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"id"},
+		},
+		{
+			Name:    AlertsStream,
+			Version: 1,
+			Columns: GetAlertSchema(),
+		},
+		{
+			Name:        AlertAcksMutableStream,
+			Version:     5,
+			Columns:     GetMutableAlertAcksSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"rule_id", "entity_id"},
+		},
+		{
+			Name:        AlertPayloadStagingStream,
+			Version:     1,
+			Columns:     GetAlertPayloadStagingSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"rule_id", "entity_id"},
+		},
+		{
+			Name:    AlertAuditStream,
+			Version: 2,
+			Columns: GetAlertAuditSchema(),
+		},
+		{
+			Name:    AlertMetricsStream,
+			Version: 1,
+			Columns: GetAlertMetricsSchema(),
+		},
+		{
+			Name:        NotificationTemplatesStream,
+			Version:     2,
+			Columns:     GetNotificationTemplatesSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"name"},
+		},
+		{
+			Name:        InhibitionsStream,
+			Version:     1,
+			Columns:     GetInhibitionsSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"name"},
+		},
+		{
+			Name:        RuleGroupsStream,
+			Version:     1,
+			Columns:     GetRuleGroupsSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"name"},
+		},
+		{
+			Name:        SQLMacrosStream,
+			Version:     1,
+			Columns:     GetSQLMacrosSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"name", "version"},
+		},
+		{
+			Name:        IncidentsStream,
+			Version:     1,
+			Columns:     GetIncidentsSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"id"},
+		},
+		{
+			Name:        OnCallSchedulesStream,
+			Version:     1,
+			Columns:     GetOnCallSchedulesSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"name"},
+		},
+		{
+			Name:        GatewayStateStream,
+			Version:     1,
+			Columns:     GetGatewayStateSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"key"},
+		},
+		{
+			Name:        MonitorCheckpointsStream,
+			Version:     2,
+			Columns:     GetMonitorCheckpointsSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"stream"},
+		},
+		{
+			Name:        NotificationOutboxStream,
+			Version:     2,
+			Columns:     GetNotificationOutboxSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"id"},
+		},
+		{
+			Name:        PushDevicesStream,
+			Version:     1,
+			Columns:     GetPushDevicesSchema(),
+			Mutable:     true,
+			PrimaryKeys: []string{"token"},
+		},
+		{
+			Name:    NotificationLogStream,
+			Version: 1,
+			Columns: GetNotificationLogSchema(),
+		},
+		{
+			Name:    GatewayMetricsStream,
+			Version: 1,
+			Columns: GetGatewayMetricsSchema(),
+		},
+	}
+}
+
+// getSchemaVersionsSchema returns the schema for the schema versions stream
+func getSchemaVersionsSchema() []Column {
+	return []Column{
+		{Name: "stream_name", Type: "string"},
+		{Name: "version", Type: "int32"},
+		{Name: "columns", Type: "string"},
+		{Name: "applied_at", Type: "datetime64(3)"},
+	}
+}
+
+// MigrateSystemStreams brings existing system streams up to their current schema.
+// Missing columns are added with ALTER STREAM; if the ALTER is rejected (e.g. by a mutable stream)
+// migration stops with ErrStreamRebuildRequired, leaving the stream alone, unless SetStreamRebuild
+// allowed the stream to be rebuilt with the new schema and its data copied over.
+// Streams that don't exist yet are skipped since they will be created with the current schema.
+func MigrateSystemStreams(ctx context.Context, client StreamStore) ([]MigrationResult, error) {
+	if err := client.EnsureMutableStream(ctx, SchemaVersionsStream, getSchemaVersionsSchema(), []string{"stream_name"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure schema versions stream: %w", err)
+	}
+
+	versions, err := getAppliedSchemaVersions(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MigrationResult, 0)
+	for _, schema := range append(SystemStreamSchemas(), alertAcksPartitionSchemas()...) {
+		result, err := migrateStream(ctx, client, schema, versions[schema.Name])
+		if err != nil {
+			return results, fmt.Errorf("failed to migrate stream %s: %w", schema.Name, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// AlertAcksStreamSchema returns the versioned schema for an alert acks stream.
+// Rules with a dedicated alert acks stream share the schema of the global one.
+func AlertAcksStreamSchema(streamName string) StreamSchema {
+	for _, schema := range SystemStreamSchemas() {
+		if schema.Name == AlertAcksMutableStream {
+			schema.Name = streamName
+			return schema
+		}
+	}
+	return StreamSchema{}
+}
+
+// AlertHistoryStreamSchema returns the versioned schema for a rule's alert history stream
+func AlertHistoryStreamSchema(streamName string) StreamSchema {
+	return StreamSchema{
+		Name:    streamName,
+		Version: 2,
+		Columns: GetAlertHistorySchema(),
+	}
+}
+
+// MigrateStream brings a single existing stream up to the given schema
+func MigrateStream(ctx context.Context, client StreamStore, schema StreamSchema) (MigrationResult, error) {
+	if err := client.EnsureMutableStream(ctx, SchemaVersionsStream, getSchemaVersionsSchema(), []string{"stream_name"}); err != nil {
+		return MigrationResult{Stream: schema.Name}, fmt.Errorf("failed to ensure schema versions stream: %w", err)
+	}
+
+	versions, err := getAppliedSchemaVersions(ctx, client)
+	if err != nil {
+		return MigrationResult{Stream: schema.Name}, err
+	}
+
+	return migrateStream(ctx, client, schema, versions[schema.Name])
+}
+
+// getAppliedSchemaVersions returns the recorded schema version per stream
+func getAppliedSchemaVersions(ctx context.Context, client StreamStore) (map[string]int, error) {
+	query := fmt.Sprintf("SELECT stream_name, version FROM table(%s)", SchemaVersionsStream)
+	rows, err := client.ExecuteQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema versions: %w", err)
+	}
+
+	versions := make(map[string]int, len(rows))
+	for _, row := range rows {
+		name := getString(row, "stream_name")
+		switch v := row["version"].(type) {
+		case int32:
+			versions[name] = int(v)
+		case int64:
+			versions[name] = int(v)
+		case int:
+			versions[name] = v
+		}
+	}
+	return versions, nil
+}
+
+// migrateStream applies any missing columns for a single stream and records the new version
+func migrateStream(ctx context.Context, client StreamStore, schema StreamSchema, appliedVersion int) (MigrationResult, error) {
+	result := MigrationResult{Stream: schema.Name, FromVersion: appliedVersion, ToVersion: schema.Version}
+
+	exists, err := client.StreamExists(ctx, schema.Name)
+	if err != nil {
+		return result, err
+	}
+	if !exists {
+		result.Skipped = true
+		return result, nil
+	}
+
+	existing, err := describeColumns(ctx, client, schema.Name)
+	if err != nil {
+		return result, err
+	}
+
+	missing := MissingColumns(schema.Columns, existing)
+	for _, col := range missing {
+		result.AddedColumns = append(result.AddedColumns, col.Name)
+	}
+
+	if len(missing) > 0 {
+		logrus.Infof("Migrating stream %s from schema v%d to v%d, adding columns: %s",
+			schema.Name, appliedVersion, schema.Version, strings.Join(result.AddedColumns, ", "))
+
+		if err := addColumns(ctx, client, schema.Name, missing); err != nil {
+			if !streamRebuild.Load() {
+				return result, fmt.Errorf("%w: ALTER STREAM on %s failed (%v), restart with -rebuild-streams to rebuild it with its data copied over",
+					ErrStreamRebuildRequired, schema.Name, err)
+			}
+			logrus.Warnf("ALTER STREAM on %s failed (%v), rebuilding stream with backfill", schema.Name, err)
+			if err := rebuildStream(ctx, client, schema, existing); err != nil {
+				return result, err
+			}
+			result.Rebuilt = true
+		}
+	}
+
+	if len(missing) > 0 || appliedVersion != schema.Version {
+		if err := recordSchemaVersion(ctx, client, schema); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// describeColumns returns the column names currently present on a stream
+func describeColumns(ctx context.Context, client StreamStore, streamName string) (map[string]bool, error) {
+	rows, err := client.ExecuteQuery(ctx, fmt.Sprintf("DESCRIBE `%s`", streamName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe stream %s: %w", streamName, err)
+	}
+
+	columns := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		columns[getString(row, "name")] = true
+	}
+	return columns, nil
+}
+
+// MissingColumns returns the columns in want that are not in existing.
+// Internal _tp_ columns are managed by Timeplus and are never reported as missing.
+func MissingColumns(want []Column, existing map[string]bool) []Column {
+	var missing []Column
+	for _, col := range want {
+		if strings.HasPrefix(col.Name, "_tp_") {
+			continue
+		}
+		if !existing[col.Name] {
+			missing = append(missing, col)
+		}
+	}
+	return missing
+}
+
+// columnDefinition renders a column for use in DDL
+func columnDefinition(col Column) string {
+	if col.Nullable {
+		return fmt.Sprintf("`%s` nullable(%s)", col.Name, col.Type)
+	}
+	return fmt.Sprintf("`%s` %s", col.Name, col.Type)
+}
+
+// addColumns adds the given columns to a stream with ALTER STREAM
+func addColumns(ctx context.Context, client StreamStore, streamName string, columns []Column) error {
+	clauses := make([]string, len(columns))
+	for i, col := range columns {
+		clauses[i] = "ADD COLUMN " + columnDefinition(col)
+	}
+	return client.ExecuteDDL(ctx, fmt.Sprintf("ALTER STREAM `%s` %s", streamName, strings.Join(clauses, ", ")))
+}
+
+// rebuildStream recreates a stream with the new schema and copies the existing data into it.
+// The old stream is only dropped once every row has been copied into the new one.
+func rebuildStream(ctx context.Context, client StreamStore, schema StreamSchema, existing map[string]bool) error {
+	tmpName := schema.Name + "_migrating"
+
+	// A leftover migration stream may hold the only copy of the data of an interrupted rebuild
+	leftover, err := client.StreamExists(ctx, tmpName)
+	if err != nil {
+		return err
+	}
+	if leftover {
+		return fmt.Errorf("migration stream %s is left over from an earlier rebuild and may hold %s's data, check and drop it before retrying", tmpName, schema.Name)
+	}
+
+	var userColumns []Column
+	for _, col := range schema.Columns {
+		if !strings.HasPrefix(col.Name, "_tp_") {
+			userColumns = append(userColumns, col)
+		}
+	}
+
+	if schema.Mutable {
+		err = client.EnsureMutableStream(ctx, tmpName, userColumns, schema.PrimaryKeys)
+	} else {
+		err = client.CreateStream(ctx, tmpName, userColumns)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create migration stream %s: %w", tmpName, err)
+	}
+
+	// Backfill the columns both schemas share
+	var shared []string
+	for _, col := range userColumns {
+		if existing[col.Name] {
+			shared = append(shared, fmt.Sprintf("`%s`", col.Name))
+		}
+	}
+	columnList := strings.Join(shared, ", ")
+	backfill := fmt.Sprintf("INSERT INTO `%s` (%s) SELECT %s FROM table(`%s`)", tmpName, columnList, columnList, schema.Name)
+	if err := client.ExecuteDDL(ctx, backfill); err != nil {
+		return fmt.Errorf("failed to backfill migration stream %s: %w", tmpName, err)
+	}
+
+	copied, err := countRows(ctx, client, tmpName)
+	if err != nil {
+		return err
+	}
+	total, err := countRows(ctx, client, schema.Name)
+	if err != nil {
+		return err
+	}
+	if copied != total {
+		if err := client.ExecuteDDL(ctx, fmt.Sprintf("DROP STREAM `%s`", tmpName)); err != nil {
+			logrus.Warnf("Failed to drop incomplete migration stream %s: %v", tmpName, err)
+		}
+		return fmt.Errorf("copied %d of %d rows of %s, leaving the stream unchanged", copied, total, schema.Name)
+	}
+
+	if err := client.ExecuteDDL(ctx, fmt.Sprintf("DROP STREAM `%s`", schema.Name)); err != nil {
+		return fmt.Errorf("failed to drop old stream %s (views may still depend on it): %w", schema.Name, err)
+	}
+
+	if err := client.ExecuteDDL(ctx, fmt.Sprintf("RENAME STREAM `%s` TO `%s`", tmpName, schema.Name)); err != nil {
+		return fmt.Errorf("failed to rename %s to %s, data is preserved in %s: %w", tmpName, schema.Name, tmpName, err)
+	}
+
+	logrus.Infof("Rebuilt stream %s with %d backfilled column(s)", schema.Name, len(shared))
+	return nil
+}
+
+// countRows returns the number of rows in a stream
+func countRows(ctx context.Context, client StreamStore, streamName string) (int64, error) {
+	rows, err := client.ExecuteQuery(ctx, fmt.Sprintf("SELECT count() AS n FROM table(`%s`)", streamName))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", streamName, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(rows[0]["n"]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", streamName, err)
+	}
+	return n, nil
+}
+
+// recordSchemaVersion stores the applied schema version for a stream
+func recordSchemaVersion(ctx context.Context, client StreamStore, schema StreamSchema) error {
+	names := make([]string, len(schema.Columns))
+	for i, col := range schema.Columns {
+		names[i] = col.Name
+	}
+
+	return client.InsertIntoStream(ctx, SchemaVersionsStream,
+		[]string{"stream_name", "version", "columns", "applied_at"},
+		[]interface{}{schema.Name, schema.Version, strings.Join(names, ","), time.Now()})
+}
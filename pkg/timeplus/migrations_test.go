@@ -0,0 +1,126 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingColumns(t *testing.T) {
+	want := []Column{
+		{Name: "id", Type: "string"},
+		{Name: "owner", Type: "string", Nullable: true},
+		{Name: "_tp_time", Type: "datetime64"},
+	}
+	existing := map[string]bool{"id": true}
+
+	missing := MissingColumns(want, existing)
+
+	assert.Equal(t, []Column{{Name: "owner", Type: "string", Nullable: true}}, missing)
+	assert.Equal(t, "`owner` nullable(string)", columnDefinition(missing[0]))
+}
+
+// migratingClient rejects ALTER STREAM and records the DDL it is sent
+type migratingClient struct {
+	TimeplusClient
+	streams map[string]bool
+	counts  map[string]int64
+	ddl     []string
+}
+
+func (c *migratingClient) StreamExists(ctx context.Context, streamName string) (bool, error) {
+	return c.streams[streamName], nil
+}
+
+func (c *migratingClient) EnsureMutableStream(ctx context.Context, streamName string, schema []Column, primaryKeys []string) error {
+	c.streams[streamName] = true
+	return nil
+}
+
+func (c *migratingClient) ExecuteQuery(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	if strings.HasPrefix(query, "DESCRIBE") {
+		return []map[string]interface{}{{"name": "id"}}, nil
+	}
+	for name, n := range c.counts {
+		if strings.Contains(query, "table(`"+name+"`)") {
+			return []map[string]interface{}{{"n": uint64(n)}}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *migratingClient) ExecuteDDL(ctx context.Context, ddl string) error {
+	if strings.HasPrefix(ddl, "ALTER STREAM") {
+		return errors.New("code: 48, not supported for mutable streams")
+	}
+	c.ddl = append(c.ddl, ddl)
+	return nil
+}
+
+func (c *migratingClient) InsertIntoStream(ctx context.Context, streamName string, columns []string, values []interface{}) error {
+	return nil
+}
+
+func migratingSchema() StreamSchema {
+	return StreamSchema{
+		Name:        "tp_things",
+		Version:     2,
+		Columns:     []Column{{Name: "id", Type: "string"}, {Name: "owner", Type: "string"}},
+		Mutable:     true,
+		PrimaryKeys: []string{"id"},
+	}
+}
+
+func TestMigrateStreamLeavesStreamWithoutRebuild(t *testing.T) {
+	client := &migratingClient{streams: map[string]bool{"tp_things": true}}
+
+	_, err := migrateStream(context.Background(), client, migratingSchema(), 1)
+
+	assert.ErrorIs(t, err, ErrStreamRebuildRequired)
+	assert.Empty(t, client.ddl, "the stream is left alone")
+}
+
+func TestMigrateStreamRebuildsWhenAllowed(t *testing.T) {
+	SetStreamRebuild(true)
+	defer SetStreamRebuild(false)
+	client := &migratingClient{
+		streams: map[string]bool{"tp_things": true},
+		counts:  map[string]int64{"tp_things": 3, "tp_things_migrating": 3},
+	}
+
+	result, err := migrateStream(context.Background(), client, migratingSchema(), 1)
+
+	require.NoError(t, err)
+	assert.True(t, result.Rebuilt)
+	assert.Equal(t, []string{
+		"INSERT INTO `tp_things_migrating` (`id`) SELECT `id` FROM table(`tp_things`)",
+		"DROP STREAM `tp_things`",
+		"RENAME STREAM `tp_things_migrating` TO `tp_things`",
+	}, client.ddl)
+}
+
+func TestRebuildStreamKeepsStreamWhenCopyIsIncomplete(t *testing.T) {
+	client := &migratingClient{
+		streams: map[string]bool{"tp_things": true},
+		counts:  map[string]int64{"tp_things": 3, "tp_things_migrating": 2},
+	}
+
+	err := rebuildStream(context.Background(), client, migratingSchema(), map[string]bool{"id": true})
+
+	require.Error(t, err)
+	assert.NotContains(t, client.ddl, "DROP STREAM `tp_things`")
+	assert.Contains(t, client.ddl, "DROP STREAM `tp_things_migrating`")
+}
+
+func TestRebuildStreamKeepsLeftoverMigrationStream(t *testing.T) {
+	client := &migratingClient{streams: map[string]bool{"tp_things": true, "tp_things_migrating": true}}
+
+	err := rebuildStream(context.Background(), client, migratingSchema(), map[string]bool{"id": true})
+
+	require.Error(t, err)
+	assert.Empty(t, client.ddl)
+}
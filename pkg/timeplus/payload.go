@@ -0,0 +1,151 @@
+package timeplus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PayloadLimits bound the triggering row rules capture in the comment column of their alerts
+type PayloadLimits struct {
+	// MaxBytes is the largest captured row kept whole; zero keeps rows whatever their size
+	MaxBytes int
+	// KeepKeys are the columns still captured when a row is too large, as long as they fit
+	KeepKeys []string
+}
+
+var (
+	payloadLimitsMu sync.RWMutex
+	payloadLimits   PayloadLimits
+)
+
+// SetPayloadLimits bounds the triggering rows captured from now on. Must be set before rules are
+// started, like SetAlertAcksPartitions; rules started earlier keep their views' behavior.
+func SetPayloadLimits(limits PayloadLimits) {
+	payloadLimitsMu.Lock()
+	defer payloadLimitsMu.Unlock()
+	payloadLimits = PayloadLimits{MaxBytes: limits.MaxBytes, KeepKeys: append([]string(nil), limits.KeepKeys...)}
+}
+
+// GetPayloadLimits returns the limits triggering rows are captured with
+func GetPayloadLimits() PayloadLimits {
+	payloadLimitsMu.RLock()
+	defer payloadLimitsMu.RUnlock()
+	return payloadLimits
+}
+
+// truncationNote returns the JSON members marking a truncated payload, as a SQL expression given
+// the expression of the original size
+func truncationNote(sizeExpr string) string {
+	return fmt.Sprintf(`'"_truncated": true, "_originalBytes": ', to_string(%s)`, sizeExpr)
+}
+
+// boundedDataExpression wraps the expression capturing every column so that rows larger than the
+// limit are replaced with the kept columns and a note of the truncation, or the note alone when
+// even the kept columns don't fit
+func boundedDataExpression(full string, columns []Column, limits PayloadLimits, redaction Redaction) string {
+	size := fmt.Sprintf("length(%s)", full)
+
+	keep := make(map[string]bool, len(limits.KeepKeys))
+	for _, key := range limits.KeepKeys {
+		keep[key] = true
+	}
+	var kept []string
+	for _, column := range columns {
+		if !keep[column.Name] {
+			continue
+		}
+		kept = append(kept, fmt.Sprintf(`'"%s": '`, jsonKeyLiteral(column.Name)), redaction.valueExpression(column), "', '")
+	}
+
+	note := fmt.Sprintf("concat('{', %s, '}')", truncationNote(size))
+	if len(kept) == 0 {
+		return fmt.Sprintf("if(%s <= %d, %s, %s)", size, limits.MaxBytes, full, note)
+	}
+	keptExpr := fmt.Sprintf("concat('{', %s, %s, '}')", strings.Join(kept, ", "), truncationNote(size))
+	return fmt.Sprintf("multi_if(%s <= %d, %s, length(%s) <= %d, %s, %s)",
+		size, limits.MaxBytes, full, keptExpr, limits.MaxBytes, keptExpr, note)
+}
+
+// TruncatePayload applies the payload limits to a captured row, the way the rules' views do. It
+// bounds rows captured by views created before the limits were set, before they reach notifiers.
+func TruncatePayload(data string) string {
+	limits := GetPayloadLimits()
+	if limits.MaxBytes <= 0 || len(data) <= limits.MaxBytes {
+		return data
+	}
+
+	truncated := map[string]interface{}{"_truncated": true, "_originalBytes": len(data)}
+	note, _ := json.Marshal(truncated)
+
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &row); err != nil {
+		return string(note)
+	}
+	for _, key := range limits.KeepKeys {
+		if value, ok := row[key]; ok {
+			truncated[key] = value
+		}
+	}
+	kept, err := json.Marshal(truncated)
+	if err != nil || len(kept) > limits.MaxBytes {
+		return string(note)
+	}
+	return string(kept)
+}
+
+// MarshalRowData encodes a row captured in Go as the JSON of its alert's triggering data, the way
+// the rules' views capture rows: NaN and infinite floats are written as null, and maps of any key
+// type as objects
+func MarshalRowData(data map[string]interface{}) ([]byte, error) {
+	return json.Marshal(jsonSafeValue(data))
+}
+
+// jsonSafeValue converts a value to one encoding/json can always encode
+func jsonSafeValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return jsonSafeValue(rv.Elem().Interface())
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = jsonSafeValue(rv.Index(i).Interface())
+		}
+		return items
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		entries := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().Interface()
+			if t, ok := key.(time.Time); ok {
+				key = FormatDateTime(t)
+			}
+			entries[fmt.Sprint(key)] = jsonSafeValue(iter.Value().Interface())
+		}
+		return entries
+	}
+	return value
+}
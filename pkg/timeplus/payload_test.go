@@ -0,0 +1,70 @@
+package timeplus
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncatePayload(t *testing.T) {
+	t.Cleanup(func() { SetPayloadLimits(PayloadLimits{}) })
+
+	large := `{"host": "web-1", "cpu": 97, "dump": "` + strings.Repeat("x", 500) + `"}`
+
+	// Without limits rows are kept whatever their size
+	assert.Equal(t, large, TruncatePayload(large))
+
+	SetPayloadLimits(PayloadLimits{MaxBytes: 100, KeepKeys: []string{"cpu", "missing"}})
+	assert.Equal(t, `{"cpu": 97}`, TruncatePayload(`{"cpu": 97}`))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(TruncatePayload(large)), &data))
+	assert.Equal(t, map[string]interface{}{"cpu": float64(97), "_truncated": true, "_originalBytes": float64(len(large))}, data)
+
+	// Kept keys that don't fit, and rows that aren't JSON, leave the note alone
+	SetPayloadLimits(PayloadLimits{MaxBytes: 100, KeepKeys: []string{"dump"}})
+	data = nil
+	require.NoError(t, json.Unmarshal([]byte(TruncatePayload(large)), &data))
+	assert.Equal(t, map[string]interface{}{"_truncated": true, "_originalBytes": float64(len(large))}, data)
+
+	truncated := TruncatePayload(strings.Repeat("x", 200))
+	assert.JSONEq(t, `{"_truncated": true, "_originalBytes": 200}`, truncated)
+}
+
+func TestGetTriggeringDataExpressionBoundsPayload(t *testing.T) {
+	t.Cleanup(func() { SetPayloadLimits(PayloadLimits{}) })
+
+	columns := []Column{{Name: "host", Type: "string"}, {Name: "cpu", Type: "float64"}}
+	full := GetTriggeringDataExpression(columns, Redaction{})
+	assert.NotContains(t, full, "_truncated")
+
+	SetPayloadLimits(PayloadLimits{MaxBytes: 1024, KeepKeys: []string{"cpu"}})
+	bounded := GetTriggeringDataExpression(columns, Redaction{})
+	assert.True(t, strings.HasPrefix(bounded, "multi_if(length("+full+") <= 1024, "+full+", "))
+	assert.Contains(t, bounded, `'"cpu": '`)
+
+	// Without kept columns the note replaces the row
+	SetPayloadLimits(PayloadLimits{MaxBytes: 1024})
+	bounded = GetTriggeringDataExpression(columns, Redaction{})
+	assert.Equal(t, "if(length("+full+") <= 1024, "+full+", concat('{', "+truncationNote("length("+full+")")+", '}'))", bounded)
+}
+
+func TestMarshalRowData(t *testing.T) {
+	at := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	data, err := MarshalRowData(map[string]interface{}{
+		"cpu":     math.NaN(),
+		"limits":  map[int32]float64{1: 0.5, 2: math.Inf(1)},
+		"seen":    map[time.Time]bool{at: true},
+		"tags":    []string{"a"},
+		"empty":   []string(nil),
+		"reading": &[]float32{1.5},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cpu": null, "limits": {"1": 0.5, "2": null}, "seen": {"2026-01-02 10:00:00.000": true}, `+
+		`"tags": ["a"], "empty": null, "reading": [1.5]}`, string(data))
+}
@@ -0,0 +1,97 @@
+package timeplus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the values a Redaction masks
+const RedactedValue = "[REDACTED]"
+
+// Redaction masks sensitive values of the triggering rows rules capture, before they are written
+// to the alert acks stream
+type Redaction struct {
+	Columns  []string // Columns whose values are replaced whole
+	Patterns []string // RE2 expressions whose matches are replaced in string values
+}
+
+// valueExpression returns a SQL expression rendering a column's value as a JSON value, masked
+func (r Redaction) valueExpression(column Column) string {
+	for _, name := range r.Columns {
+		if name == column.Name {
+			return fmt.Sprintf("'\"%s\"'", RedactedValue)
+		}
+	}
+
+	if len(r.Patterns) == 0 {
+		return jsonValueExpression(column, nil)
+	}
+	return jsonValueExpression(column, func(value string) string {
+		for _, pattern := range r.Patterns {
+			pattern = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(pattern)
+			value = fmt.Sprintf("replace_regex(%s, '%s', '%s')", value, pattern, RedactedValue)
+		}
+		return value
+	})
+}
+
+// Apply masks the values of a row captured in Go, the way the rules' views mask the rows they capture
+func (r Redaction) Apply(data map[string]interface{}) {
+	for _, name := range r.Columns {
+		if _, ok := data[name]; ok {
+			data[name] = RedactedValue
+		}
+	}
+
+	var patterns []*regexp.Regexp
+	for _, pattern := range r.Patterns {
+		// Patterns are validated when rules are saved
+		if re, err := regexp.Compile(pattern); err == nil {
+			patterns = append(patterns, re)
+		}
+	}
+	if len(patterns) == 0 {
+		return
+	}
+	for key, value := range data {
+		data[key] = maskStrings(value, patterns)
+	}
+}
+
+// maskStrings replaces the matches of the patterns in a string value, or in the strings of arrays,
+// maps and named tuples, which a row holds as slices and maps
+func maskStrings(value interface{}, patterns []*regexp.Regexp) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, re := range patterns {
+			v = re.ReplaceAllLiteralString(v, RedactedValue)
+		}
+		return v
+	case []string:
+		masked := make([]string, len(v))
+		for i, item := range v {
+			masked[i] = maskStrings(item, patterns).(string)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskStrings(item, patterns)
+		}
+		return masked
+	case map[string]string:
+		masked := make(map[string]string, len(v))
+		for key, item := range v {
+			masked[key] = maskStrings(item, patterns).(string)
+		}
+		return masked
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			masked[key] = maskStrings(item, patterns)
+		}
+		return masked
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+package timeplus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTriggeringDataExpressionRedacts(t *testing.T) {
+	redaction := Redaction{Columns: []string{"email"}, Patterns: []string{`\d{4}-\d{4}`, `it's`}}
+	expr := GetTriggeringDataExpression([]Column{
+		{Name: "email", Type: "nullable(string)"},
+		{Name: "note", Type: "string"},
+		{Name: "cpu", Type: "float64"},
+	}, redaction)
+
+	assert.Equal(t, "concat('{', "+
+		`'"email": ', '"[REDACTED]"', `+
+		`', "note": ', concat('"', replace(replace(replace(`+
+		`replace_regex(replace_regex(to_string(`+"`note`"+`), '\\d{4}-\\d{4}', '[REDACTED]'), 'it\'s', '[REDACTED]'), `+
+		`'\\', '\\\\'), '"', '\\"'), '\n', '\\n'), '"'), `+
+		"', \"cpu\": ', if(is_finite(`cpu`), to_string(`cpu`), 'null'), "+
+		"'}')", expr)
+}
+
+func TestRedactionApply(t *testing.T) {
+	data := map[string]interface{}{"email": "a@example.com", "note": "card 1234-5678 used", "cpu": 97.0}
+	Redaction{Columns: []string{"email", "missing"}, Patterns: []string{`\d{4}-\d{4}`}}.Apply(data)
+
+	assert.Equal(t, map[string]interface{}{"email": RedactedValue, "note": "card [REDACTED] used", "cpu": 97.0}, data)
+}
+
+func TestRedactionMasksNestedStrings(t *testing.T) {
+	redaction := Redaction{Patterns: []string{`secret-\d+`}}
+	expr := redaction.valueExpression(Column{Name: "tags", Type: "array(string)"})
+	assert.Contains(t, expr, `array_map(__v1 -> concat('"', replace(replace(replace(replace_regex(to_string(__v1), 'secret-\\d+', '[REDACTED]')`)
+
+	data := map[string]interface{}{
+		"tags":     []string{"web", "secret-1"},
+		"labels":   map[string]interface{}{"token": "secret-2", "port": int32(80)},
+		"location": []interface{}{"secret-3", 1.5},
+	}
+	redaction.Apply(data)
+	assert.Equal(t, map[string]interface{}{
+		"tags":     []string{"web", RedactedValue},
+		"labels":   map[string]interface{}{"token": RedactedValue, "port": int32(80)},
+		"location": []interface{}{RedactedValue, 1.5},
+	}, data)
+}
@@ -0,0 +1,233 @@
+package timeplus
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+)
+
+// columnDecoder scans one column of a result set into a destination that is allocated once and
+// reused for every row
+type columnDecoder struct {
+	dest  interface{}        // Passed to rows.Scan
+	value func() interface{} // Returns the scanned value and resets dest for the next row
+}
+
+// typedDecoder returns a decoder for columns scanned into a T. dest is reset after each read
+// because the driver leaves the destination untouched for NULLs of nullable columns.
+func typedDecoder[T any]() columnDecoder {
+	var v T
+	return columnDecoder{
+		dest: &v,
+		value: func() interface{} {
+			out := v
+			var zero T
+			v = zero
+			return out
+		},
+	}
+}
+
+// utcTimeDecoder returns a decoder for datetime columns that normalizes values to UTC, whatever the
+// timezone of the column or server
+func utcTimeDecoder() columnDecoder {
+	decoder := typedDecoder[time.Time]()
+	value := decoder.value
+	decoder.value = func() interface{} {
+		return value().(time.Time).UTC()
+	}
+	return decoder
+}
+
+// nullableUTCTimeDecoder is utcTimeDecoder for nullable datetime columns
+func nullableUTCTimeDecoder() columnDecoder {
+	decoder := typedDecoder[*time.Time]()
+	value := decoder.value
+	decoder.value = func() interface{} {
+		t := value().(*time.Time)
+		if t != nil {
+			utc := t.UTC()
+			t = &utc
+		}
+		return t
+	}
+	return decoder
+}
+
+// typedDecoders has a decoder constructor for each scan type the driver commonly reports.
+// Nullable columns are scanned into pointers.
+var typedDecoders = map[reflect.Type]func() columnDecoder{
+	reflect.TypeOf(""):          typedDecoder[string],
+	reflect.TypeOf(false):       typedDecoder[bool],
+	reflect.TypeOf(int8(0)):     typedDecoder[int8],
+	reflect.TypeOf(int16(0)):    typedDecoder[int16],
+	reflect.TypeOf(int32(0)):    typedDecoder[int32],
+	reflect.TypeOf(int64(0)):    typedDecoder[int64],
+	reflect.TypeOf(uint8(0)):    typedDecoder[uint8],
+	reflect.TypeOf(uint16(0)):   typedDecoder[uint16],
+	reflect.TypeOf(uint32(0)):   typedDecoder[uint32],
+	reflect.TypeOf(uint64(0)):   typedDecoder[uint64],
+	reflect.TypeOf(float32(0)):  typedDecoder[float32],
+	reflect.TypeOf(float64(0)):  typedDecoder[float64],
+	reflect.TypeOf(time.Time{}): utcTimeDecoder,
+	reflect.TypeOf(uuid.UUID{}): typedDecoder[uuid.UUID],
+	reflect.TypeOf(net.IP{}):    typedDecoder[net.IP],
+
+	reflect.TypeOf((*string)(nil)):    typedDecoder[*string],
+	reflect.TypeOf((*bool)(nil)):      typedDecoder[*bool],
+	reflect.TypeOf((*int8)(nil)):      typedDecoder[*int8],
+	reflect.TypeOf((*int16)(nil)):     typedDecoder[*int16],
+	reflect.TypeOf((*int32)(nil)):     typedDecoder[*int32],
+	reflect.TypeOf((*int64)(nil)):     typedDecoder[*int64],
+	reflect.TypeOf((*uint8)(nil)):     typedDecoder[*uint8],
+	reflect.TypeOf((*uint16)(nil)):    typedDecoder[*uint16],
+	reflect.TypeOf((*uint32)(nil)):    typedDecoder[*uint32],
+	reflect.TypeOf((*uint64)(nil)):    typedDecoder[*uint64],
+	reflect.TypeOf((*float32)(nil)):   typedDecoder[*float32],
+	reflect.TypeOf((*float64)(nil)):   typedDecoder[*float64],
+	reflect.TypeOf((*time.Time)(nil)): nullableUTCTimeDecoder,
+}
+
+// newColumnDecoder returns the decoder for a column's scan type. Types without a typed decoder,
+// such as arrays, maps and decimals, are scanned through reflection.
+func newColumnDecoder(scanType reflect.Type) columnDecoder {
+	if newDecoder, ok := typedDecoders[scanType]; ok {
+		return newDecoder()
+	}
+
+	ptr := reflect.New(scanType)
+	elem := ptr.Elem()
+	zero := reflect.Zero(scanType)
+	return columnDecoder{
+		dest: ptr.Interface(),
+		value: func() interface{} {
+			out := elem.Interface()
+			elem.Set(zero)
+			return out
+		},
+	}
+}
+
+// hasNestedValues reports whether values of a column type hold times or named tuples nested in
+// arrays, maps or tuples, which the driver scans without UTC normalization or element names
+func hasNestedValues(columnType string) bool {
+	name, args := parseColumnType(strings.TrimSpace(columnType))
+	for (name == "nullable" || name == "low_cardinality") && len(args) == 1 {
+		name, args = parseColumnType(args[0])
+	}
+	if name != "array" && name != "map" && name != "tuple" {
+		return false
+	}
+	t := strings.ToLower(columnType)
+	return strings.Contains(t, "date") || strings.Contains(t, "tuple(")
+}
+
+// nestedDecoder wraps the decoder of a column with nested values, normalizing them with
+// normalizeNested
+func nestedDecoder(decoder columnDecoder, columnType string) columnDecoder {
+	value := decoder.value
+	decoder.value = func() interface{} {
+		return normalizeNested(value(), columnType)
+	}
+	return decoder
+}
+
+// normalizeNested converts a value of an array, map or tuple column for callers and JSON: times are
+// normalized to UTC, named tuples become maps of their elements by name and maps are keyed by
+// strings. Arrays and unnamed tuples become []interface{}, and NULLs nil.
+func normalizeNested(value interface{}, columnType string) interface{} {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return nil
+	}
+
+	name, args := parseColumnType(strings.TrimSpace(columnType))
+	switch {
+	case (name == "nullable" || name == "low_cardinality") && len(args) == 1:
+		if rv.Kind() == reflect.Ptr {
+			return normalizeNested(rv.Elem().Interface(), args[0])
+		}
+		return normalizeNested(value, args[0])
+	case name == "array" && len(args) == 1 && rv.Kind() == reflect.Slice:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = normalizeNested(rv.Index(i).Interface(), args[0])
+		}
+		return items
+	case name == "map" && len(args) == 2 && rv.Kind() == reflect.Map:
+		entries := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().Interface()
+			if t, ok := key.(time.Time); ok {
+				key = FormatDateTime(t)
+			}
+			entries[fmt.Sprint(key)] = normalizeNested(iter.Value().Interface(), args[1])
+		}
+		return entries
+	case name == "tuple" && rv.Kind() == reflect.Slice && rv.Len() == len(args):
+		items := make([]interface{}, len(args))
+		named := make(map[string]interface{}, len(args))
+		for i, element := range args {
+			elementName, elementType := tupleElement(element)
+			items[i] = normalizeNested(rv.Index(i).Interface(), elementType)
+			named[elementName] = items[i]
+		}
+		if _, ok := named[""]; ok {
+			return items
+		}
+		return named
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC()
+	case *time.Time:
+		return v.UTC()
+	}
+	return value
+}
+
+// rowScanner scans rows of a result set into maps keyed by column name. The decoders are picked
+// once from the column types, so scanning a row doesn't allocate destinations.
+type rowScanner struct {
+	names    []string
+	decoders []columnDecoder
+	dest     []interface{}
+}
+
+// newRowScanner prepares a scanner for the columns of rows
+func newRowScanner(rows driver.Rows) *rowScanner {
+	columnTypes := rows.ColumnTypes()
+	s := &rowScanner{
+		names:    rows.Columns(),
+		decoders: make([]columnDecoder, len(columnTypes)),
+		dest:     make([]interface{}, len(columnTypes)),
+	}
+	for i, ct := range columnTypes {
+		s.decoders[i] = newColumnDecoder(ct.ScanType())
+		if hasNestedValues(ct.DatabaseTypeName()) {
+			s.decoders[i] = nestedDecoder(s.decoders[i], ct.DatabaseTypeName())
+		}
+		s.dest[i] = s.decoders[i].dest
+	}
+	return s
+}
+
+// scan scans the current row
+func (s *rowScanner) scan(rows driver.Rows) (map[string]interface{}, error) {
+	if err := rows.Scan(s.dest...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(s.names))
+	for i, name := range s.names {
+		row[name] = s.decoders[i].value()
+	}
+	return row, nil
+}
@@ -0,0 +1,107 @@
+package timeplus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceRows returns the given rows. Like the driver, Scan leaves the destination untouched for NULLs.
+type sliceRows struct {
+	fakeRows
+	data [][]interface{}
+	row  int
+}
+
+func (r *sliceRows) Next() bool {
+	r.row++
+	return r.row <= len(r.data)
+}
+
+func (r *sliceRows) Scan(dest ...interface{}) error {
+	for i, value := range r.data[r.row-1] {
+		if value != nil {
+			reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+		}
+	}
+	return nil
+}
+
+func TestRowScanner(t *testing.T) {
+	warning := "warning"
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	local := now.In(time.FixedZone("PST", -8*3600))
+	rows := &sliceRows{
+		fakeRows: fakeRows{columns: []benchColumn{
+			{name: "entity_id", scanType: reflect.TypeOf("")},
+			{name: "severity", scanType: reflect.TypeOf((*string)(nil))},
+			{name: "created_at", scanType: reflect.TypeOf(time.Time{})},
+			{name: "firing_seq", scanType: reflect.TypeOf(uint64(0))},
+			{name: "acknowledged_at", scanType: reflect.TypeOf((*time.Time)(nil))},
+			{name: "tags", scanType: reflect.TypeOf([]string(nil))}, // No typed decoder
+		}},
+		data: [][]interface{}{
+			{"d1", &warning, now, uint64(2), &local, []string{"a", "b"}},
+			{"d2", nil, local, uint64(1), nil, nil},
+		},
+	}
+
+	scanner := newRowScanner(rows)
+	var result []map[string]interface{}
+	for rows.Next() {
+		row, err := scanner.scan(rows)
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+
+	require.Len(t, result, 2)
+	assert.Equal(t, map[string]interface{}{
+		"entity_id": "d1", "severity": &warning, "created_at": now, "firing_seq": uint64(2), "acknowledged_at": &now, "tags": []string{"a", "b"},
+	}, result[0])
+
+	// Times are normalized to UTC
+	assert.Equal(t, now, result[1]["created_at"])
+
+	// NULLs don't carry over the previous row's values
+	assert.Equal(t, "d2", result[1]["entity_id"])
+	assert.Equal(t, (*string)(nil), result[1]["severity"])
+	assert.Equal(t, []string(nil), result[1]["tags"])
+	assert.Equal(t, (*time.Time)(nil), result[1]["acknowledged_at"])
+}
+
+func TestRowScannerNormalizesNestedValues(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	local := now.In(time.FixedZone("PST", -8*3600))
+	rows := &sliceRows{
+		fakeRows: fakeRows{columns: []benchColumn{
+			{name: "seen", dbType: "array(datetime64(3))", scanType: reflect.TypeOf([]time.Time(nil))},
+			{name: "location", dbType: "tuple(lat float64, lon float64)", scanType: reflect.TypeOf([]interface{}(nil))},
+			{name: "pair", dbType: "tuple(string, nullable(int32))", scanType: reflect.TypeOf([]interface{}(nil))},
+			{name: "windows", dbType: "map(int32, tuple(start datetime64(3), count uint64))", scanType: reflect.TypeOf(map[int32][]interface{}(nil))},
+			{name: "tags", dbType: "array(string)", scanType: reflect.TypeOf([]string(nil))}, // Left as scanned
+		}},
+		data: [][]interface{}{{
+			[]time.Time{local},
+			[]interface{}{1.5, 2.5},
+			[]interface{}{"a", (*int32)(nil)},
+			map[int32][]interface{}{7: {local, uint64(3)}},
+			[]string{"a"},
+		}},
+	}
+
+	scanner := newRowScanner(rows)
+	require.True(t, rows.Next())
+	row, err := scanner.scan(rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"seen":     []interface{}{now},
+		"location": map[string]interface{}{"lat": 1.5, "lon": 2.5},
+		"pair":     []interface{}{"a", nil},
+		"windows":  map[string]interface{}{"7": map[string]interface{}{"start": now, "count": uint64(3)}},
+		"tags":     []string{"a"},
+	}, row)
+}
@@ -5,8 +5,8 @@ import (
 	"strings"
 )
 
-// Stream names
-const (
+// Stream names of the system streams, prefixed with the environment by SetEnvironment
+var (
 	// AlertsStream is the name of the stream that stores alerts
 	AlertsStream = "tp_alerts"
 
@@ -18,6 +18,73 @@ const (
 
 	// AlertAcksMutableStream is the name of the mutable stream that stores alert acknowledgments
 	AlertAcksMutableStream = "tp_alert_acks_mutable"
+
+	// AlertPayloadStagingStream is the name of the mutable stream the materialized views of rules
+	// with encryptData write their alerts to, until the gateway encrypts their triggering rows and
+	// moves them to the rules' alert acks streams
+	AlertPayloadStagingStream = "tp_alert_payload_staging"
+
+	// AlertAuditStream is the name of the append-only stream recording who changed an alert's state and why
+	AlertAuditStream = "tp_alert_audit"
+
+	// AlertMetricsStream is the name of the append-only stream recording alert lifecycle events and
+	// their latencies, for dashboards built in Timeplus
+	AlertMetricsStream = "tp_alert_metrics"
+
+	// NotificationTemplatesStream is the name of the mutable stream that stores notification templates
+	NotificationTemplatesStream = "tp_notification_templates"
+
+	// InhibitionsStream is the name of the mutable stream that stores inhibition rules
+	InhibitionsStream = "tp_inhibitions"
+
+	// SQLMacrosStream is the name of the mutable stream that stores the versions of SQL macros
+	SQLMacrosStream = "tp_sql_macros"
+
+	// RuleGroupsStream is the name of the mutable stream that stores rule groups
+	RuleGroupsStream = "tp_rule_groups"
+
+	// IncidentsStream is the name of the mutable stream that stores incidents grouping correlated alerts
+	IncidentsStream = "tp_incidents"
+
+	// MonitorCheckpointsStream is the name of the mutable stream that stores how far streaming
+	// consumers, such as the alert monitor, have read each stream
+	MonitorCheckpointsStream = "tp_monitor_checkpoints"
+
+	// OnCallSchedulesStream is the name of the mutable stream that stores on-call schedules
+	OnCallSchedulesStream = "tp_oncall_schedules"
+
+	// GatewayStateStream is the name of the mutable stream that stores gateway-wide state, such as
+	// whether the gateway is paused
+	GatewayStateStream = "tp_gateway_state"
+
+	// NotificationOutboxStream is the name of the mutable stream that records notifications until
+	// they are delivered
+	NotificationOutboxStream = "tp_notification_outbox"
+
+	// PushDevicesStream is the name of the mutable stream that stores the devices registered for
+	// push notifications
+	PushDevicesStream = "tp_push_devices"
+
+	// NotificationLogStream is the name of the append-only stream recording the delivery status of
+	// notifications sent to people, such as SMS messages and voice calls
+	NotificationLogStream = "tp_notification_log"
+
+	// GatewayMetricsStream is the name of the append-only stream the gateway periodically writes its
+	// internal counters to, so rules can monitor the gateway itself
+	GatewayMetricsStream = "tp_gateway_metrics"
+)
+
+// Alert audit actions
+const (
+	AlertAuditActionAcknowledged = "acknowledged"
+	AlertAuditActionReopened     = "reopened"
+	AlertAuditActionResolved     = "resolved"   // Resolved by hand rather than by the rule's resolve query
+	AlertAuditActionEscalated    = "escalated"  // Not acknowledged within its SLA
+	AlertAuditActionSuppressed   = "suppressed" // Not notified while a rule it depends on is active
+	AlertAuditActionInhibited    = "inhibited"  // Not notified while a more severe alert is active for the entity
+	AlertAuditActionEnriched     = "enriched"   // Enrichment hooks added context before it was notified
+	AlertAuditActionFiltered     = "filtered"   // Not notified because the rule's suppress expression matched
+	AlertAuditActionCorrelated   = "correlated" // Not notified on its own, it joined an incident that was notified
 )
 
 // GetAlertsSchema returns the schema for the alerts stream
@@ -55,6 +122,82 @@ func GetRulesSchema() []Column {
 	}
 }
 
+// GetMutableRulesSchema returns the schema for the mutable rules stream (primary key: id)
+func GetMutableRulesSchema() []Column {
+	return []Column{
+		{Name: "id", Type: "string"},
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string"},
+		{Name: "query", Type: "string"},
+		{Name: "resolve_query", Type: "string", Nullable: true},
+		{Name: "status", Type: "string"},
+		{Name: "severity", Type: "string"},
+		{Name: "throttle_minutes", Type: "int32"},
+		{Name: "entity_id_columns", Type: "string"},
+		{Name: "created_at", Type: "datetime64"},
+		{Name: "updated_at", Type: "datetime64"},
+		{Name: "last_triggered_at", Type: "datetime64", Nullable: true},
+		{Name: "result_stream", Type: "string"},
+		{Name: "view_name", Type: "string"},
+		{Name: "resolve_view_name", Type: "string", Nullable: true},
+		{Name: "last_error", Type: "string", Nullable: true},
+		{Name: "dedicated_alert_acks_stream", Type: "bool", Nullable: true},
+		{Name: "alert_acks_stream_name", Type: "string", Nullable: true},
+		{Name: "_tp_time", Type: "datetime64"},
+		{Name: "active", Type: "bool"},
+		// Added in schema v2
+		{Name: "entity_id_column", Type: "string", Nullable: true},
+		// Added in schema v3
+		{Name: "owner", Type: "string", Nullable: true},
+		{Name: "team", Type: "string", Nullable: true},
+		// Added in schema v4
+		{Name: "runbook_url", Type: "string", Nullable: true},
+		{Name: "summary_template", Type: "string", Nullable: true},
+		{Name: "description_template", Type: "string", Nullable: true},
+		// Added in schema v5
+		{Name: "severity_expression", Type: "string", Nullable: true},
+		// Added in schema v6
+		{Name: "rule_type", Type: "string", Nullable: true},
+		{Name: "rule_spec", Type: "string", Nullable: true}, // JSON definition of generated rule types
+		// Added in schema v7
+		{Name: "lookups", Type: "string", Nullable: true}, // JSON list of dimension stream joins
+		// Added in schema v8
+		{Name: "notification_template", Type: "string", Nullable: true}, // Name of the notification template
+		// Added in schema v9
+		{Name: "entity_id_priority", Type: "string", Nullable: true}, // Comma-separated entity ID priority columns
+		// Added in schema v10
+		{Name: "require_entity_id", Type: "bool", Nullable: true},
+		// Added in schema v11
+		{Name: "shadow", Type: "bool", Nullable: true},
+		// Added in schema v12
+		{Name: "depends_on", Type: "string", Nullable: true}, // JSON list of rule dependencies
+		// Added in schema v13
+		{Name: "max_alerts_per_minute", Type: "int32", Nullable: true},
+		{Name: "degraded", Type: "string", Nullable: true}, // JSON degradation details, NULL unless degraded
+		// Added in schema v14
+		{Name: "oncall_schedule", Type: "string", Nullable: true}, // Name of the on-call schedule notified
+		// Added in schema v15
+		{Name: "object_names", Type: "string", Nullable: true}, // JSON names of the generated Timeplus objects
+		// Added in schema v16
+		{Name: "enrichments", Type: "string", Nullable: true}, // JSON list of enrichment hooks
+		// Added in schema v17
+		{Name: "script", Type: "string", Nullable: true}, // JSON expressions filtering and modifying alerts
+		// Added in schema v18
+		{Name: "group_name", Type: "string", Nullable: true}, // Rule group the rule is filed under
+		// Added in schema v19
+		{Name: "error_history", Type: "string", Nullable: true}, // JSON list of the rule's recent failures
+		// Added in schema v20
+		{Name: "failed_components", Type: "string", Nullable: true}, // Comma-separated components of a degraded rule that failed
+		// Added in schema v21
+		{Name: "redaction", Type: "string", Nullable: true}, // JSON columns and patterns masked in alert data
+		// Added in schema v22
+		{Name: "encrypt_data", Type: "bool", Nullable: true},
+		// Added in schema v23
+		{Name: "query_template", Type: "string", Nullable: true}, // Query as written, with the macro references query expands
+		{Name: "macros", Type: "string", Nullable: true},         // JSON versions of the macros query was expanded with, by name
+	}
+}
+
 // GetMutableAlertAcksSchema returns the schema for the mutable alert acknowledgments stream
 // The schema is generic and can accommodate any type of alert source, not just device data
 func GetMutableAlertAcksSchema() []Column {
@@ -66,6 +209,210 @@ func GetMutableAlertAcksSchema() []Column {
 		{Name: "updated_at", Type: "datetime64"},
 		{Name: "updated_by", Type: "string", Nullable: true},
 		{Name: "comment", Type: "string", Nullable: true},
+		// Added in schema v2
+		{Name: "event_time", Type: "datetime64(3)", Nullable: true}, // _tp_time of the triggering event, used for lag metrics
+		// Added in schema v3
+		{Name: "severity", Type: "string", Nullable: true}, // Severity computed when the alert fired, overrides the rule severity
+		// Added in schema v4
+		{Name: "firing_seq", Type: "uint64"}, // Incremented each time the entity starts a new alert, part of the alert ID
+		// Added in schema v5
+		{Name: "reference", Type: "string", Nullable: true}, // Ticket ID or URL the alert was acknowledged under
+	}
+}
+
+// GetAlertPayloadStagingSchema returns the schema for the alert payload staging stream: the columns
+// of an alert acks stream, and the acks stream the alert is moved to
+func GetAlertPayloadStagingSchema() []Column {
+	return append(GetMutableAlertAcksSchema(), Column{Name: "target_stream", Type: "string"})
+}
+
+// GetAlertAuditSchema returns the schema for the alert audit stream
+func GetAlertAuditSchema() []Column {
+	return []Column{
+		{Name: "rule_id", Type: "string"},
+		{Name: "entity_id", Type: "string"},
+		{Name: "firing_seq", Type: "uint64"},
+		{Name: "action", Type: "string"}, // acknowledged, reopened or escalated
+		{Name: "actor", Type: "string"},
+		{Name: "reason", Type: "string", Nullable: true},
+		{Name: "at", Type: "datetime64(3)"},
+		// Added in schema v2
+		{Name: "reference", Type: "string", Nullable: true}, // Ticket ID or URL of a bulk acknowledgment
+	}
+}
+
+// GetAlertMetricsSchema returns the schema for the alert metrics stream
+func GetAlertMetricsSchema() []Column {
+	return []Column{
+		{Name: "rule_id", Type: "string"},
+		{Name: "entity_id", Type: "string"},
+		{Name: "firing_seq", Type: "uint64"},
+		{Name: "event_type", Type: "string"}, // fired, notified, suppressed, acknowledged, resolved, ...
+		{Name: "severity", Type: "string"},
+		{Name: "latency_ms", Type: "int64", Nullable: true}, // Meaning depends on event_type, null when unknown
+		{Name: "at", Type: "datetime64(3)"},
+	}
+}
+
+// GetNotificationLogSchema returns the schema for the notification log stream, one row per
+// delivery attempt or status update
+func GetNotificationLogSchema() []Column {
+	return []Column{
+		{Name: "notifier", Type: "string"},
+		{Name: "channel", Type: "string"}, // sms or voice
+		{Name: "recipient", Type: "string"},
+		{Name: "alert_id", Type: "string"},
+		{Name: "event_type", Type: "string"},
+		{Name: "status", Type: "string"},                     // queued, failed, suppressed, rate_limited or the provider's status
+		{Name: "message_id", Type: "string", Nullable: true}, // The provider's ID of the message or call
+		{Name: "detail", Type: "string", Nullable: true},
+		{Name: "at", Type: "datetime64(3)"},
+	}
+}
+
+// GetGatewayMetricsSchema returns the schema for the gateway metrics stream, one row per metric and write
+func GetGatewayMetricsSchema() []Column {
+	return []Column{
+		{Name: "instance", Type: "string"}, // Host name of the gateway replica
+		{Name: "metric", Type: "string"},
+		{Name: "value", Type: "float64"},
+		{Name: "at", Type: "datetime64(3)"},
+	}
+}
+
+// GetSQLMacrosSchema returns the schema for the SQL macros stream, one row per macro version
+func GetSQLMacrosSchema() []Column {
+	return []Column{
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "int32"},
+		{Name: "description", Type: "string", Nullable: true},
+		{Name: "sql", Type: "string"},
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"}, // When the version was written
+		{Name: "active", Type: "bool"},              // False once the macro is deleted
+	}
+}
+
+// GetNotificationTemplatesSchema returns the schema for the notification templates stream
+func GetNotificationTemplatesSchema() []Column {
+	return []Column{
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string", Nullable: true},
+		{Name: "body", Type: "string"},
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "active", Type: "bool"}, // false once the template is deleted
+		// Added in schema v2
+		{Name: "translations", Type: "string", Nullable: true}, // JSON object of bodies by locale
+	}
+}
+
+// GetInhibitionsSchema returns the schema for the inhibitions stream
+func GetInhibitionsSchema() []Column {
+	return []Column{
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string", Nullable: true},
+		{Name: "source_severity", Type: "string"},
+		{Name: "target_severities", Type: "string"}, // JSON array of severities
+		{Name: "equal", Type: "string"},             // JSON array of labels
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "active", Type: "bool"}, // false once the inhibition is deleted
+	}
+}
+
+// GetPushDevicesSchema returns the schema for the push devices stream
+func GetPushDevicesSchema() []Column {
+	return []Column{
+		{Name: "token", Type: "string"},
+		{Name: "platform", Type: "string"},
+		{Name: "user_name", Type: "string", Nullable: true},
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "active", Type: "bool"}, // false once the device is unregistered
+	}
+}
+
+// GetRuleGroupsSchema returns the schema for the rule groups stream
+func GetRuleGroupsSchema() []Column {
+	return []Column{
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string", Nullable: true},
+		{Name: "folder", Type: "string", Nullable: true},
+		{Name: "notification_template", Type: "string", Nullable: true},
+		{Name: "oncall_schedule", Type: "string", Nullable: true},
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "active", Type: "bool"}, // false once the group is deleted
+	}
+}
+
+// GetIncidentsSchema returns the schema for the incidents stream
+func GetIncidentsSchema() []Column {
+	return []Column{
+		{Name: "id", Type: "string"},
+		{Name: "correlation_key", Type: "string"},
+		{Name: "status", Type: "string"},
+		{Name: "title", Type: "string"},
+		{Name: "summary", Type: "string"},
+		{Name: "severity", Type: "string"},
+		{Name: "alerts", Type: "string"}, // JSON array of member alerts
+		{Name: "opened_at", Type: "datetime64(3)"},
+		{Name: "last_alert_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "acknowledged_by", Type: "string", Nullable: true},
+		{Name: "acknowledged_at", Type: "datetime64(3)", Nullable: true},
+		{Name: "resolved_by", Type: "string", Nullable: true},
+		{Name: "resolved_at", Type: "datetime64(3)", Nullable: true},
+	}
+}
+
+// GetOnCallSchedulesSchema returns the schema for the on-call schedules stream
+func GetOnCallSchedulesSchema() []Column {
+	return []Column{
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string", Nullable: true},
+		{Name: "users", Type: "string"}, // JSON array of users in rotation order
+		{Name: "rotation_start", Type: "datetime64(3)"},
+		{Name: "shift_hours", Type: "int32"},
+		{Name: "overrides", Type: "string"}, // JSON array of overrides
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "active", Type: "bool"}, // false once the schedule is deleted
+	}
+}
+
+// GetGatewayStateSchema returns the schema for the gateway state stream, one JSON value per key
+func GetGatewayStateSchema() []Column {
+	return []Column{
+		{Name: "key", Type: "string"},
+		{Name: "value", Type: "string"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+	}
+}
+
+// GetNotificationOutboxSchema returns the schema for the notification outbox stream
+func GetNotificationOutboxSchema() []Column {
+	return []Column{
+		{Name: "id", Type: "string"},           // Event type, alert ID and, for state changes, the change time
+		{Name: "event", Type: "string"},        // The event as JSON
+		{Name: "status", Type: "string"},       // pending, sent or failed
+		{Name: "delivered_to", Type: "string"}, // JSON array of the notifiers the event was delivered to
+		{Name: "attempts", Type: "int32"},
+		{Name: "last_error", Type: "string"},
+		{Name: "created_at", Type: "datetime64(3)"},
+		{Name: "updated_at", Type: "datetime64(3)"},
+		{Name: "next_attempt_at", Type: "datetime64(3)"}, // When a pending entry is delivered next
+	}
+}
+
+// GetMonitorCheckpointsSchema returns the schema for the alert monitor checkpoints stream
+func GetMonitorCheckpointsSchema() []Column {
+	return []Column{
+		{Name: "stream", Type: "string"},            // Alert acks stream the monitor reads, "archive:<stream>" for the archiver
+		{Name: "checkpoint", Type: "datetime64(3)"}, // _tp_time of the latest row handled
+		{Name: "rows", Type: "int64"},               // Rows at exactly the checkpoint time that were handled
+		{Name: "updated_at", Type: "datetime64(3)"},
 	}
 }
 
@@ -99,27 +446,198 @@ func GetAlertSchema() []Column {
 
 // GetRulePlainViewQuery returns a SQL query to create a regular view for a rule
 // This view doesn't store any state and simply represents the rule query
-func GetRulePlainViewQuery(ruleID, ruleQuery string) string {
-	// Sanitize the rule ID for view name
-	sanitizedRuleID := strings.ReplaceAll(ruleID, "-", "_")
-	viewName := fmt.Sprintf("rule_%s_view", sanitizedRuleID)
-
+func GetRulePlainViewQuery(viewName, ruleQuery string) string {
 	return fmt.Sprintf("CREATE VIEW %s AS %s", viewName, ruleQuery)
 }
 
+// GetAlertHistorySchema returns the schema of a rule's append-only alert history stream.
+// Every time the rule fires a row is appended, so the stream keeps firings the acks stream overwrites.
+func GetAlertHistorySchema() []Column {
+	return []Column{
+		{Name: "rule_id", Type: "string"},
+		{Name: "entity_id", Type: "string"},
+		{Name: "severity", Type: "string", Nullable: true},
+		{Name: "triggered_at", Type: "datetime64(3)"},
+		{Name: "event_time", Type: "datetime64(3)", Nullable: true},
+		{Name: "triggered_by", Type: "string"}, // Empty for the rule's materialized view, e.g. "backfill" otherwise
+		{Name: "data", Type: "string"},         // Triggering row as JSON
+		// Added in schema v2
+		{Name: "firing_seq", Type: "uint64"},
+	}
+}
+
+// GetRuleAlertHistoryMaterializedViewQuery generates the SQL for the materialized view that appends every
+// active alert a rule writes to its alert acks stream to the rule's alert history stream
+func GetRuleAlertHistoryMaterializedViewQuery(ruleID, mvName, sourceAlertStream, historyStream string) string {
+	return fmt.Sprintf(`
+CREATE MATERIALIZED VIEW `+"`%s`"+` INTO `+"`%s`"+` AS
+SELECT
+    rule_id,
+    entity_id,
+    severity,
+    updated_at AS triggered_at,
+    event_time,
+    updated_by AS triggered_by,
+    comment AS data,
+    firing_seq
+FROM `+"`%s`"+`
+WHERE rule_id = '%s' AND state = '%s'`,
+		mvName, historyStream, sourceAlertStream, ruleID, AlertStateActive)
+}
+
+// GetTriggeringDataExpression builds a SQL expression that serializes a row with the given columns into a
+// JSON object. Column types come from DESCRIBE, so numbers and booleans are written as JSON numbers and
+// booleans, NULLs as null, and everything else as escaped JSON strings. Values the redaction masks are
+// replaced before anything else. With payload limits set, larger objects are cut down to the columns
+// PayloadLimits keeps, with a note of the truncation.
+func GetTriggeringDataExpression(columns []Column, redaction Redaction) string {
+	if len(columns) == 0 {
+		return "'{}'"
+	}
+
+	parts := make([]string, 0, len(columns))
+	for i, column := range columns {
+		separator := ", "
+		if i == 0 {
+			separator = ""
+		}
+		parts = append(parts, fmt.Sprintf(`'%s"%s": '`, separator, jsonKeyLiteral(column.Name)))
+		parts = append(parts, redaction.valueExpression(column))
+	}
+
+	full := fmt.Sprintf("concat('{', %s, '}')", strings.Join(parts, ", "))
+	if limits := GetPayloadLimits(); limits.MaxBytes > 0 {
+		return boundedDataExpression(full, columns, limits, redaction)
+	}
+	return full
+}
+
+// jsonValueExpression returns a SQL expression rendering a column's value as a JSON value. mask,
+// when set, rewrites the expression of each string value, including strings nested in arrays,
+// maps and tuples.
+func jsonValueExpression(column Column, mask func(string) string) string {
+	columnType := column.Type
+	if _, nullable := unwrapNullableType(columnType); column.Nullable && !nullable {
+		columnType = fmt.Sprintf("nullable(%s)", columnType)
+	}
+	return jsonExpression(fmt.Sprintf("`%s`", column.Name), columnType, mask, 1)
+}
+
+// jsonExpression returns a SQL expression rendering expr, a value of the given DESCRIBE type, as
+// JSON. Arrays and unnamed tuples are written as JSON arrays, maps and named tuples as objects.
+// depth numbers the variables of the lambdas that walk nested arrays and maps.
+func jsonExpression(expr, columnType string, mask func(string) string, depth int) string {
+	name, args := parseColumnType(strings.TrimSpace(columnType))
+	switch {
+	case name == "nullable" && len(args) == 1:
+		return fmt.Sprintf("if(%s IS NULL, 'null', %s)", expr, jsonExpression(expr, args[0], mask, depth))
+	case name == "low_cardinality" && len(args) == 1:
+		return jsonExpression(expr, args[0], mask, depth)
+	case strings.HasPrefix(name, "bool"):
+		return fmt.Sprintf("if(%s, 'true', 'false')", expr)
+	case strings.HasPrefix(name, "float"):
+		// NaN and infinity have no JSON representation
+		return fmt.Sprintf("if(is_finite(%s), to_string(%s), 'null')", expr, expr)
+	case strings.HasPrefix(name, "int"), strings.HasPrefix(name, "uint"), strings.HasPrefix(name, "decimal"):
+		return fmt.Sprintf("to_string(%s)", expr)
+	case name == "array" && len(args) == 1:
+		item := fmt.Sprintf("__v%d", depth)
+		return fmt.Sprintf("concat('[', array_string_concat(array_map(%s -> %s, %s), ', '), ']')",
+			item, jsonExpression(item, args[0], mask, depth+1), expr)
+	case name == "map" && len(args) == 2:
+		// JSON object keys are strings, whatever the type of the map's keys
+		key, value := fmt.Sprintf("__k%d", depth), fmt.Sprintf("__v%d", depth)
+		return fmt.Sprintf("concat('{', array_string_concat(array_map((%s, %s) -> concat(%s, ': ', %s), map_keys(%s), map_values(%s)), ', '), '}')",
+			key, value, jsonStringValue(fmt.Sprintf("to_string(%s)", key)), jsonExpression(value, args[1], mask, depth+1), expr, expr)
+	case name == "tuple" && len(args) > 0:
+		return jsonTupleExpression(expr, args, mask, depth)
+	}
+
+	value := fmt.Sprintf("to_string(%s)", expr)
+	if mask != nil {
+		value = mask(value)
+	}
+	return jsonStringValue(value)
+}
+
+// jsonTupleExpression renders a tuple as a JSON object when all its elements are named, and as a
+// JSON array otherwise
+func jsonTupleExpression(expr string, elements []string, mask func(string) string, depth int) string {
+	names := make([]string, len(elements))
+	types := make([]string, len(elements))
+	named := true
+	for i, element := range elements {
+		names[i], types[i] = tupleElement(element)
+		if names[i] == "" {
+			named = false
+		}
+	}
+
+	parts := make([]string, 0, 2*len(elements))
+	for i := range elements {
+		separator := ", "
+		if i == 0 {
+			separator = ""
+		}
+		if named {
+			parts = append(parts, fmt.Sprintf(`'%s"%s": '`, separator, jsonKeyLiteral(names[i])))
+		} else if separator != "" {
+			parts = append(parts, fmt.Sprintf("'%s'", separator))
+		}
+		parts = append(parts, jsonExpression(fmt.Sprintf("tuple_element(%s, %d)", expr, i+1), types[i], mask, depth))
+	}
+	if named {
+		return fmt.Sprintf("concat('{', %s, '}')", strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("concat('[', %s, ']')", strings.Join(parts, ", "))
+}
+
+// tupleElement splits an element of a tuple type into its name, empty when it has none, and type,
+// e.g. "lat float64" into "lat" and "float64"
+func tupleElement(element string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(element), " ", 2)
+	if len(parts) == 2 && !strings.Contains(parts[0], "(") {
+		return strings.Trim(parts[0], "`"), strings.TrimSpace(parts[1])
+	}
+	return "", strings.TrimSpace(element)
+}
+
+// jsonStringValue returns a SQL expression rendering a string expression as an escaped JSON string
+func jsonStringValue(value string) string {
+	return fmt.Sprintf(`concat('"', replace(replace(replace(%s, '\\', '\\\\'), '"', '\\"'), '\n', '\\n'), '"')`, value)
+}
+
+// jsonKeyLiteral escapes a JSON object key for a double-quoted JSON string inside a SQL string
+// literal
+func jsonKeyLiteral(key string) string {
+	key = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key)
+}
+
+// unwrapNullableType strips a nullable(...) wrapper from a DESCRIBE type and lower-cases it
+func unwrapNullableType(columnType string) (string, bool) {
+	t := strings.ToLower(strings.TrimSpace(columnType))
+	if strings.HasPrefix(t, "nullable(") && strings.HasSuffix(t, ")") {
+		return strings.TrimSuffix(strings.TrimPrefix(t, "nullable("), ")"), true
+	}
+	return t, false
+}
+
 // GetRuleThrottledMaterializedViewQuery generates the SQL query for creating a materialized view
 // that feeds into a specified rule-specific alert ack stream and includes throttling logic, using a CTE.
+// With a staging stream the alerts are written there instead, for the gateway to move them.
 func GetRuleThrottledMaterializedViewQuery(
 	ruleID string,
+	viewName string, // The rule's plain view the materialized view reads from
+	mvName string,
 	ThrottleMinutes int,
 	idColumnName string,
 	triggeringDataExpr string, // SQL expression for the comment field (e.g., a JSON string)
 	targetAlertStream string, // The rule-specific alert ack stream name
+	severityExpr string, // SQL expression for the severity column (e.g., a quoted static severity or a CASE expression)
+	eventTimeExpr string, // SQL expression over the view for the triggering event's time (e.g., view._tp_time)
+	stagingStream string, // Stream alerts are written to instead of targetAlertStream, or empty
 ) string {
-	sanitizedRuleID := strings.ReplaceAll(ruleID, "-", "_")
-	viewName := fmt.Sprintf("rule_%s_view", sanitizedRuleID)
-	mvName := fmt.Sprintf("rule_%s_mv", sanitizedRuleID)
-
 	// Throttling condition using Timeplus interval syntax, referencing aliased ack columns
 	throttleCondition := "ack_state = ''" // Always trigger if no previous state
 	if ThrottleMinutes >= 0 {             // Apply user logic if throttle is enabled (>= 0)
@@ -133,14 +651,23 @@ func GetRuleThrottledMaterializedViewQuery(
 		throttleCondition = "ack_state = ''"
 	}
 
+	// Staged alerts name the acks stream they are moved to
+	intoStream, targetColumn := targetAlertStream, ""
+	if stagingStream != "" {
+		intoStream = stagingStream
+		targetColumn = fmt.Sprintf(",\n    '%s' AS target_stream", targetAlertStream)
+	}
+
 	// Use CTE to resolve potential column name conflicts and clarify logic
 	query := fmt.Sprintf(`
 CREATE MATERIALIZED VIEW `+"`%s`"+` INTO `+"`%s`"+` AS
 WITH filtered_events AS (
     SELECT
         view.*,
+        %s AS event_tp_time,
         ack.state AS ack_state,
-        ack.created_at AS ack_created_at
+        ack.created_at AS ack_created_at,
+        ack.firing_seq AS ack_firing_seq
     FROM `+"`%s`"+` AS view
     LEFT JOIN `+"`%s`"+` AS ack ON view.`+"`%s`"+` = ack.entity_id
     WHERE (ack.rule_id = '') OR (ack.rule_id = '%s' AND (%s))
@@ -149,12 +676,16 @@ SELECT
     '%s' AS rule_id,
     fe.`+"`%s`"+` AS entity_id,
     '%s' AS state,
-    coalesce(fe.ack_created_at, now()) AS created_at,
+    if(fe.ack_state = '%s', fe.ack_created_at, now()) AS created_at,
     now() AS updated_at,
     '' AS updated_by,
-    %s AS comment
+    %s AS comment,
+    fe.event_tp_time AS event_time,
+    %s AS severity,
+    if(fe.ack_state = '%s', fe.ack_firing_seq, fe.ack_firing_seq + 1) AS firing_seq%s
 FROM filtered_events AS fe`,
-		mvName, targetAlertStream, // Use parameterized target stream
+		mvName, intoStream, // Use parameterized target stream, or the staging stream
+		eventTimeExpr,      // Event time for CTE
 		viewName,           // Source view for CTE
 		targetAlertStream,  // Join with parameterized target stream
 		idColumnName,       // Join column entity_id
@@ -163,40 +694,50 @@ FROM filtered_events AS fe`,
 		ruleID,             // rule_id for final SELECT
 		idColumnName,       // entity_id for final SELECT
 		AlertStateActive,   // state for final SELECT
-		triggeringDataExpr) // comment expression for final SELECT
+		AlertStateActive,   // an active alert keeps its created_at
+		triggeringDataExpr, // comment expression for final SELECT
+		severityExpr,       // severity expression for final SELECT
+		AlertStateActive,   // an active alert keeps its firing sequence, otherwise a new firing starts
+		targetColumn)       // the acks stream staged alerts are moved to
 
 	return query
 }
 
 // GetRuleResolveViewQuery generates a SQL query for creating a materialized view
-// that will automatically acknowledge alerts when a resolve condition is met
+// that acknowledges a rule's active alerts whenever the rule's resolve view emits their entity
 func GetRuleResolveViewQuery(
 	ruleID string,
+	viewName string, // The rule's resolve view
+	mvName string,
 	idColumnName string,
 	targetAlertStream string, // The alert ack stream name
 ) string {
-	sanitizedRuleID := strings.ReplaceAll(ruleID, "-", "_")
-	viewName := fmt.Sprintf("rule_%s_view", sanitizedRuleID)
-	mvName := fmt.Sprintf("rule_%s_resolve_mv", sanitizedRuleID)
-
-	// Create a view that inserts records with 'acknowledged' state
-	// based on the resolve query results
+	// Only entities with an active alert are resolved, so matching rows for healthy
+	// entities don't create acknowledged alert states
 	query := fmt.Sprintf(`
 CREATE MATERIALIZED VIEW `+"`%s`"+` INTO `+"`%s`"+` AS
 SELECT
     '%s' AS rule_id,
-    `+"`%s`"+` AS entity_id,
+    view.`+"`%s`"+` AS entity_id,
     '%s' AS state,
-    now() AS created_at,
+    ack.created_at AS created_at,
     now() AS updated_at,
     'auto-resolver' AS updated_by,
-    '{"reason": "Auto-resolved by resolve query"}' AS comment
-FROM `+"`%s`"+``,
+    '{"reason": "Auto-resolved by resolve query"}' AS comment,
+    ack.firing_seq AS firing_seq,
+    view._tp_time AS event_time
+FROM `+"`%s`"+` AS view
+INNER JOIN `+"`%s`"+` AS ack ON view.`+"`%s`"+` = ack.entity_id
+WHERE ack.rule_id = '%s' AND ack.state = '%s'`,
 		mvName, targetAlertStream, // View name and target stream
 		ruleID,                 // rule_id for INSERT
 		idColumnName,           // entity_id column from resolve query
 		AlertStateAcknowledged, // Set state to acknowledged
-		viewName)               // Source view with resolve query
+		viewName,               // Source view with resolve query
+		targetAlertStream,      // Join with the alert ack stream
+		idColumnName,           // Join column
+		ruleID,                 // Only this rule's alerts
+		AlertStateActive)       // Only alerts that are still active
 
 	return query
 }
@@ -0,0 +1,79 @@
+package timeplus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTriggeringDataExpression(t *testing.T) {
+	assert.Equal(t, "'{}'", GetTriggeringDataExpression(nil, Redaction{}))
+
+	expr := GetTriggeringDataExpression([]Column{
+		{Name: "temperature", Type: "float64"},
+		{Name: "reading_count", Type: "nullable(uint32)"},
+		{Name: "online", Type: "bool"},
+		{Name: "location", Type: "string"},
+	}, Redaction{})
+	assert.Equal(t, "concat('{', "+
+		"'\"temperature\": ', if(is_finite(`temperature`), to_string(`temperature`), 'null'), "+
+		"', \"reading_count\": ', if(`reading_count` IS NULL, 'null', to_string(`reading_count`)), "+
+		"', \"online\": ', if(`online`, 'true', 'false'), "+
+		`', "location": ', concat('"', replace(replace(replace(to_string(`+"`location`"+`), '\\', '\\\\'), '"', '\\"'), '\n', '\\n'), '"'), `+
+		"'}')", expr)
+}
+
+func TestGetTriggeringDataExpressionEscapesKeys(t *testing.T) {
+	expr := GetTriggeringDataExpression([]Column{{Name: `it's "odd"`, Type: "int64"}}, Redaction{})
+	assert.Equal(t, `concat('{', '"it\'s \\"odd\\"": ', to_string(`+"`it's \"odd\"`"+`), '}')`, expr)
+}
+
+func TestGetTriggeringDataExpressionNestedTypes(t *testing.T) {
+	jsonString := func(value string) string {
+		return `concat('"', replace(replace(replace(to_string(` + value + `), '\\', '\\\\'), '"', '\\"'), '\n', '\\n'), '"')`
+	}
+
+	// Arrays are JSON arrays, walked with a lambda per level of nesting
+	assert.Equal(t, "concat('[', array_string_concat(array_map(__v1 -> if(__v1 IS NULL, 'null', "+jsonString("__v1")+"), `tags`), ', '), ']')",
+		jsonValueExpression(Column{Name: "tags", Type: "array(nullable(string))"}, nil))
+	assert.Equal(t, "concat('[', array_string_concat(array_map(__v1 -> concat('[', array_string_concat(array_map(__v2 -> to_string(__v2), __v1), ', '), ']'), `m`), ', '), ']')",
+		jsonValueExpression(Column{Name: "m", Type: "array(array(int32))"}, nil))
+
+	// Maps are JSON objects keyed by their keys as strings
+	assert.Equal(t, "concat('{', array_string_concat(array_map((__k1, __v1) -> concat("+jsonString("__k1")+", ': ', "+
+		"if(is_finite(__v1), to_string(__v1), 'null')), map_keys(`labels`), map_values(`labels`)), ', '), '}')",
+		jsonValueExpression(Column{Name: "labels", Type: "map(int32, float64)"}, nil))
+
+	// Named tuples are objects, other tuples arrays
+	assert.Equal(t, "concat('{', '\"lat\": ', to_string(tuple_element(`loc`, 1)), ', \"lon\": ', to_string(tuple_element(`loc`, 2)), '}')",
+		jsonValueExpression(Column{Name: "loc", Type: "tuple(lat decimal(9, 6), lon decimal(9, 6))"}, nil))
+	assert.Equal(t, "concat('[', "+jsonString("tuple_element(`pair`, 1)")+", ', ', to_string(tuple_element(`pair`, 2)), ']')",
+		jsonValueExpression(Column{Name: "pair", Type: "Tuple(String, Int32)"}, nil))
+}
+
+func TestTupleElement(t *testing.T) {
+	name, elementType := tupleElement("lat float64")
+	assert.Equal(t, "lat", name)
+	assert.Equal(t, "float64", elementType)
+
+	name, elementType = tupleElement("datetime64(3, 'UTC')")
+	assert.Equal(t, "", name)
+	assert.Equal(t, "datetime64(3, 'UTC')", elementType)
+}
+
+func TestUnwrapNullableType(t *testing.T) {
+	baseType, nullable := unwrapNullableType("Nullable(Float64)")
+	assert.Equal(t, "float64", baseType)
+	assert.True(t, nullable)
+
+	baseType, nullable = unwrapNullableType("datetime64(3)")
+	assert.Equal(t, "datetime64(3)", baseType)
+	assert.False(t, nullable)
+}
+
+func TestGetRuleResolveViewQueryRecordsEventTime(t *testing.T) {
+	query := GetRuleResolveViewQuery("rule1", "rule_rule1_resolve_view", "rule_rule1_resolve_mv", "device", AlertAcksMutableStream)
+
+	assert.Contains(t, query, "view._tp_time AS event_time")
+	assert.Contains(t, query, "ack.firing_seq AS firing_seq")
+}
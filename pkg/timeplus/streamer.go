@@ -0,0 +1,476 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Streaming query states
+const (
+	StreamStateRunning      = "running"
+	StreamStateReconnecting = "reconnecting" // The query failed or ended and is waiting to be resumed
+	StreamStateStopped      = "stopped"
+)
+
+var (
+	// ErrStreamExists is returned when starting a stream under a name that is already supervised
+	ErrStreamExists = errors.New("stream is already running")
+	// ErrStreamerClosed is returned when starting a stream after Shutdown
+	ErrStreamerClosed = errors.New("streamer is shut down")
+)
+
+// StreamSpec describes a long-lived streaming query owned by a Streamer
+type StreamSpec struct {
+	Name string
+	// Query is the streaming query, without a SETTINGS clause. It should select _tp_time, which is
+	// used as the checkpoint the query resumes from after a failure.
+	Query string
+	// Handler is called for each row. Errors are logged and counted, they don't stop the stream. A
+	// row whose handler failed is handled again after a backoff until it succeeds or is given up on,
+	// and the checkpoint holds before it meanwhile, so a restart in between handles it again.
+	Handler func(ctx context.Context, row map[string]interface{}) error
+	// Checkpoint resumes the query from a _tp_time, e.g. one persisted before a restart.
+	// Without it the query starts at the latest data.
+	Checkpoint *time.Time
+	// CheckpointRows is how many rows at exactly Checkpoint were already handled; they are skipped
+	// when the query resumes
+	CheckpointRows int64
+	// OnCheckpoint is called after each row that advanced the checkpoint, so it can be persisted
+	OnCheckpoint func(checkpoint Checkpoint)
+}
+
+// StreamStatus is the state of a supervised streaming query
+type StreamStatus struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	Checkpoint     *time.Time `json:"checkpoint,omitempty"`     // _tp_time of the latest row handled
+	CheckpointRows int64      `json:"checkpointRows,omitempty"` // Rows handled at exactly the checkpoint time
+	Rows           int64      `json:"rows"`
+	HandlerErrors  int64      `json:"handlerErrors"`
+	Retrying       int        `json:"retrying,omitempty"` // Failed rows waiting to be handled again, holding the checkpoint
+	GivenUp        int64      `json:"givenUp,omitempty"`  // Failed rows given up on after every attempt
+	Restarts       int        `json:"restarts"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastErrorAt    *time.Time `json:"lastErrorAt,omitempty"`
+	StartedAt      time.Time  `json:"startedAt"`
+}
+
+// Streamer supervises long-lived streaming queries. A query that fails or ends is resumed from its
+// checkpoint after a backoff, so a dropped connection doesn't silently stop consumers.
+//
+// Resuming uses seek_to on the checkpoint, which is inclusive: rows at exactly the checkpoint
+// time are delivered again and as many as were handled before are skipped. Timeplus delivers rows
+// sharing a _tp_time in the order they were written, but a row written at the checkpoint time after
+// the query failed may still be mistaken for one already handled, and handlers that didn't finish
+// before a restart see their row again, so handlers must tolerate duplicates.
+type Streamer struct {
+	client StreamerClient
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// Rows whose handler failed are handled again after a backoff doubling with each attempt
+	retryAttempts int
+	retryBackoff  time.Duration
+
+	mu      sync.Mutex
+	streams map[string]*supervisedStream
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// supervisedStream is a running stream and its status
+type supervisedStream struct {
+	spec   StreamSpec
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Serializes handler calls between the query and retries
+	handleMu sync.Mutex
+
+	mu     sync.RWMutex
+	status StreamStatus
+	// Latest row handled, which becomes the checkpoint once no failed row is waiting for a retry
+	progress *Checkpoint
+	retries  []*failedRow
+}
+
+// failedRow is a row whose handler failed, waiting to be handled again
+type failedRow struct {
+	row      map[string]interface{}
+	attempts int
+	next     time.Time
+}
+
+// StreamerClient is what a Streamer needs from Timeplus: streaming queries, and a query to check
+// the connection before resubscribing
+type StreamerClient interface {
+	StreamSubscriber
+	QueryRunner
+}
+
+// NewStreamer creates a streamer running queries through client
+func NewStreamer(client StreamerClient) *Streamer {
+	return &Streamer{
+		client:        client,
+		minBackoff:    time.Second,
+		maxBackoff:    30 * time.Second,
+		retryAttempts: 5,
+		retryBackoff:  time.Second,
+		streams:       make(map[string]*supervisedStream),
+	}
+}
+
+// Start starts supervising a streaming query
+func (s *Streamer) Start(spec StreamSpec) error {
+	if spec.Name == "" || spec.Query == "" || spec.Handler == nil {
+		return fmt.Errorf("stream name, query and handler are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamerClosed
+	}
+	if _, ok := s.streams[spec.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrStreamExists, spec.Name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &supervisedStream{
+		spec:   spec,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: StreamStatus{
+			Name:           spec.Name,
+			State:          StreamStateRunning,
+			Checkpoint:     spec.Checkpoint,
+			CheckpointRows: spec.CheckpointRows,
+			StartedAt:      time.Now(),
+		},
+	}
+	if spec.Checkpoint != nil {
+		stream.progress = &Checkpoint{Time: *spec.Checkpoint, Rows: spec.CheckpointRows}
+	}
+	s.streams[spec.Name] = stream
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(stream.done)
+		s.supervise(ctx, stream)
+	}()
+
+	logrus.Infof("Streamer: started stream %s", spec.Name)
+	return nil
+}
+
+// Stop stops a stream and waits for its handler to return. It returns false if no stream has the name.
+func (s *Streamer) Stop(name string) bool {
+	s.mu.Lock()
+	stream, ok := s.streams[name]
+	delete(s.streams, name)
+	s.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	stream.cancel()
+	<-stream.done
+	logrus.Infof("Streamer: stopped stream %s", name)
+	return true
+}
+
+// Status returns the status of every supervised stream, ordered by name
+func (s *Streamer) Status() []StreamStatus {
+	s.mu.Lock()
+	statuses := make([]StreamStatus, 0, len(s.streams))
+	for _, stream := range s.streams {
+		statuses = append(statuses, stream.snapshot())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// StreamStatus returns the status of a stream
+func (s *Streamer) StreamStatus(name string) (StreamStatus, bool) {
+	s.mu.Lock()
+	stream, ok := s.streams[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return StreamStatus{}, false
+	}
+	return stream.snapshot(), true
+}
+
+// Shutdown stops every stream and waits for them until ctx is done
+func (s *Streamer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for _, stream := range s.streams {
+		stream.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// supervise runs a stream's query until ctx is cancelled, resuming it whenever it returns
+func (s *Streamer) supervise(ctx context.Context, stream *supervisedStream) {
+	var retrying sync.WaitGroup
+	retrying.Add(1)
+	go func() {
+		defer retrying.Done()
+		s.retryFailed(ctx, stream)
+	}()
+	defer retrying.Wait()
+
+	backoff := s.minBackoff
+	for {
+		resumed := stream.snapshot()
+		var skip int64
+		if resumed.Checkpoint != nil {
+			skip = resumed.CheckpointRows
+		}
+		err := s.client.StreamQuery(ctx, resumeQuery(stream.spec.Query, resumed.Checkpoint), func(row interface{}) {
+			values, ok := row.(map[string]interface{})
+			if !ok {
+				return
+			}
+			// Rows at the checkpoint time come first after seek_to; skip those already handled
+			if skip > 0 {
+				if tpTime, ok := values["_tp_time"].(time.Time); ok && tpTime.Equal(*resumed.Checkpoint) {
+					skip--
+					return
+				}
+				skip = 0
+			}
+			stream.handle(ctx, values, s.retryBackoff)
+		})
+		if ctx.Err() != nil {
+			stream.setState(StreamStateStopped)
+			return
+		}
+
+		if err == nil {
+			err = errors.New("streaming query ended")
+		}
+		stream.recordError(err)
+		logrus.Warnf("Streamer: stream %s failed, resuming in %s: %v", stream.spec.Name, backoff, err)
+
+		// A query that made progress failed on its own, rather than on a connection that's still down
+		if stream.snapshot().Rows > resumed.Rows {
+			backoff = s.minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			stream.setState(StreamStateStopped)
+			return
+		case <-time.After(backoff):
+		}
+
+		// Reconnects the client if the connection was lost
+		if _, err := s.client.ExecuteQuery(ctx, "SELECT 1"); err != nil {
+			logrus.Warnf("Streamer: Timeplus is unavailable for stream %s: %v", stream.spec.Name, err)
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+		stream.restarted()
+	}
+}
+
+// resumeQuery returns the query resuming at checkpoint
+func resumeQuery(query string, checkpoint *time.Time) string {
+	if checkpoint == nil {
+		return query
+	}
+	return fmt.Sprintf("%s SETTINGS seek_to='%s'", query, FormatDateTime(*checkpoint))
+}
+
+// handle passes a row to the handler and advances the checkpoint, unless a failed row is waiting
+// for a retry. A row whose handler fails is retried after backoff.
+func (st *supervisedStream) handle(ctx context.Context, row map[string]interface{}, backoff time.Duration) {
+	st.handleMu.Lock()
+	defer st.handleMu.Unlock()
+
+	err := st.spec.Handler(ctx, row)
+	if err != nil {
+		logrus.Errorf("Streamer: handler of stream %s failed: %v", st.spec.Name, err)
+	}
+
+	st.mu.Lock()
+	st.status.Rows++
+	if err != nil {
+		st.status.HandlerErrors++
+		st.retries = append(st.retries, &failedRow{row: row, attempts: 1, next: time.Now().Add(backoff)})
+		st.status.Retrying = len(st.retries)
+	}
+	if tpTime, ok := row["_tp_time"].(time.Time); ok {
+		switch {
+		case st.progress == nil || tpTime.After(st.progress.Time):
+			st.progress = &Checkpoint{Time: tpTime, Rows: 1}
+		case tpTime.Equal(st.progress.Time):
+			st.progress.Rows++
+		}
+	}
+	checkpoint, advanced := st.advanceCheckpoint()
+	st.mu.Unlock()
+
+	if advanced && st.spec.OnCheckpoint != nil {
+		st.spec.OnCheckpoint(checkpoint)
+	}
+}
+
+// retryFailed handles failed rows of a stream again once their backoff is over, until ctx is done
+func (s *Streamer) retryFailed(ctx context.Context, stream *supervisedStream) {
+	ticker := time.NewTicker(s.retryBackoff)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stream.retryDue(ctx, s.retryAttempts, s.retryBackoff)
+		}
+	}
+}
+
+// retryDue handles the failed rows whose backoff is over again. Rows failing attempts times are
+// given up on, releasing the checkpoint they hold.
+func (st *supervisedStream) retryDue(ctx context.Context, attempts int, backoff time.Duration) {
+	st.handleMu.Lock()
+	defer st.handleMu.Unlock()
+
+	now := time.Now()
+	st.mu.RLock()
+	var due []*failedRow
+	for _, failed := range st.retries {
+		if !failed.next.After(now) {
+			due = append(due, failed)
+		}
+	}
+	st.mu.RUnlock()
+	if len(due) == 0 {
+		return
+	}
+
+	for _, failed := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		err := st.spec.Handler(ctx, failed.row)
+
+		st.mu.Lock()
+		switch {
+		case err == nil:
+			st.removeRetry(failed)
+		case failed.attempts+1 >= attempts:
+			st.status.HandlerErrors++
+			st.status.GivenUp++
+			st.removeRetry(failed)
+			logrus.Errorf("Streamer: giving up on a row of stream %s after %d attempts: %v", st.spec.Name, attempts, err)
+		default:
+			st.status.HandlerErrors++
+			failed.attempts++
+			failed.next = time.Now().Add(backoff << (failed.attempts - 1))
+			logrus.Errorf("Streamer: handler of stream %s failed again (attempt %d of %d): %v", st.spec.Name, failed.attempts, attempts, err)
+		}
+		st.mu.Unlock()
+	}
+
+	st.mu.Lock()
+	checkpoint, advanced := st.advanceCheckpoint()
+	st.mu.Unlock()
+	if advanced && st.spec.OnCheckpoint != nil {
+		st.spec.OnCheckpoint(checkpoint)
+	}
+}
+
+// removeRetry removes a failed row from the rows waiting for a retry. Must be called with mu held.
+func (st *supervisedStream) removeRetry(failed *failedRow) {
+	for i, retry := range st.retries {
+		if retry == failed {
+			st.retries = append(st.retries[:i], st.retries[i+1:]...)
+			break
+		}
+	}
+	st.status.Retrying = len(st.retries)
+}
+
+// advanceCheckpoint moves the checkpoint to the latest row handled when no failed row holds it,
+// returning the checkpoint and whether it moved. Must be called with mu held.
+func (st *supervisedStream) advanceCheckpoint() (Checkpoint, bool) {
+	if len(st.retries) > 0 || st.progress == nil {
+		return Checkpoint{}, false
+	}
+	if st.status.Checkpoint != nil && st.status.Checkpoint.Equal(st.progress.Time) && st.status.CheckpointRows == st.progress.Rows {
+		return Checkpoint{}, false
+	}
+	checkpointTime := st.progress.Time
+	st.status.Checkpoint = &checkpointTime
+	st.status.CheckpointRows = st.progress.Rows
+	return *st.progress, true
+}
+
+func (st *supervisedStream) snapshot() StreamStatus {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.status
+}
+
+func (st *supervisedStream) setState(state string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.status.State = state
+}
+
+func (st *supervisedStream) recordError(err error) {
+	now := time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.status.State = StreamStateReconnecting
+	st.status.LastError = err.Error()
+	st.status.LastErrorAt = &now
+}
+
+// restarted records that the query resumed from the checkpoint. Failed rows after it are read and
+// handled again, so they are no longer retried on their own.
+func (st *supervisedStream) restarted() {
+	st.handleMu.Lock()
+	defer st.handleMu.Unlock()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.status.State = StreamStateRunning
+	st.status.Restarts++
+	st.retries = nil
+	st.status.Retrying = 0
+	st.progress = nil
+	if st.status.Checkpoint != nil {
+		st.progress = &Checkpoint{Time: *st.status.Checkpoint, Rows: st.status.CheckpointRows}
+	}
+}
@@ -0,0 +1,327 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timeplus-io/proton-go-driver/v2/lib/driver"
+)
+
+// scriptedConn answers streaming queries from a script: each query returns the next batch of rows,
+// followed by the batch's error. Once the script runs out, queries block until cancelled.
+type scriptedConn struct {
+	driver.Conn
+
+	mu      sync.Mutex
+	queries []string
+	script  []scriptedQuery
+}
+
+type scriptedQuery struct {
+	rows [][]interface{}
+	err  error
+}
+
+var streamerColumns = []benchColumn{
+	{name: "entity_id", scanType: reflect.TypeOf("")},
+	{name: "_tp_time", scanType: reflect.TypeOf(time.Time{})},
+}
+
+func (c *scriptedConn) Query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	if query == "SELECT 1" {
+		return &fakeRows{columns: []benchColumn{{name: "1", scanType: reflect.TypeOf(uint8(0)), value: uint8(1)}}, remaining: 1}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, query)
+
+	if len(c.script) == 0 {
+		return &blockingRows{fakeRows: fakeRows{columns: streamerColumns}, ctx: ctx}, nil
+	}
+	next := c.script[0]
+	c.script = c.script[1:]
+	return &scriptedRows{sliceRows: sliceRows{fakeRows: fakeRows{columns: streamerColumns}, data: next.rows}, err: next.err}, nil
+}
+
+func (c *scriptedConn) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.queries...)
+}
+
+type scriptedRows struct {
+	sliceRows
+	err error
+}
+
+func (r *scriptedRows) Err() error { return r.err }
+
+// blockingRows has no rows until ctx is cancelled, like an idle streaming query
+type blockingRows struct {
+	fakeRows
+	ctx context.Context
+}
+
+func (r *blockingRows) Next() bool {
+	<-r.ctx.Done()
+	return false
+}
+
+func (r *blockingRows) Err() error { return r.ctx.Err() }
+
+func TestStreamerResumesFromCheckpoint(t *testing.T) {
+	first := time.Date(2026, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	second := first.Add(time.Second)
+	conn := &scriptedConn{script: []scriptedQuery{
+		{rows: [][]interface{}{{"d1", first}, {"d2", second}}, err: errors.New("EOF")},
+		{rows: [][]interface{}{{"d3", second.Add(time.Second)}}, err: errors.New("EOF")},
+	}}
+	streamer := NewStreamer(&Client{conn: conn})
+	streamer.minBackoff = time.Millisecond
+
+	var mu sync.Mutex
+	var handled []string
+	var checkpoints []time.Time
+	require.NoError(t, streamer.Start(StreamSpec{
+		Name:  "alerts",
+		Query: "SELECT entity_id, _tp_time FROM alerts",
+		Handler: func(ctx context.Context, row map[string]interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, row["entity_id"].(string))
+			return nil
+		},
+		OnCheckpoint: func(checkpoint Checkpoint) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkpoints = append(checkpoints, checkpoint.Time)
+		},
+	}))
+	defer streamer.Shutdown(context.Background())
+
+	require.Eventually(t, func() bool { return len(conn.recorded()) == 3 }, 5*time.Second, time.Millisecond)
+
+	queries := conn.recorded()
+	assert.Equal(t, "SELECT entity_id, _tp_time FROM alerts", queries[0])
+	assert.Equal(t, "SELECT entity_id, _tp_time FROM alerts SETTINGS seek_to='"+second.Format("2006-01-02 15:04:05.000")+"'", queries[1])
+	assert.True(t, strings.HasSuffix(queries[2], "seek_to='"+second.Add(time.Second).Format("2006-01-02 15:04:05.000")+"'"))
+
+	mu.Lock()
+	assert.Equal(t, []string{"d1", "d2", "d3"}, handled)
+	assert.Len(t, checkpoints, 3)
+	mu.Unlock()
+
+	status, ok := streamer.StreamStatus("alerts")
+	require.True(t, ok)
+	assert.Equal(t, StreamStateRunning, status.State)
+	assert.Equal(t, int64(3), status.Rows)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Equal(t, "EOF", status.LastError)
+	require.NotNil(t, status.Checkpoint)
+	assert.Equal(t, second.Add(time.Second), *status.Checkpoint)
+}
+
+func TestStreamerStartsFromGivenCheckpoint(t *testing.T) {
+	checkpoint := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &scriptedConn{}
+	streamer := NewStreamer(&Client{conn: conn})
+	defer streamer.Shutdown(context.Background())
+
+	require.NoError(t, streamer.Start(StreamSpec{
+		Name:       "alerts",
+		Query:      "SELECT * FROM alerts",
+		Handler:    func(ctx context.Context, row map[string]interface{}) error { return nil },
+		Checkpoint: &checkpoint,
+	}))
+	require.Eventually(t, func() bool { return len(conn.recorded()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "SELECT * FROM alerts SETTINGS seek_to='2026-01-02 03:04:05.000'", conn.recorded()[0])
+}
+
+func TestStreamerSkipsRowsHandledAtCheckpoint(t *testing.T) {
+	checkpoint := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &scriptedConn{script: []scriptedQuery{
+		{rows: [][]interface{}{{"d1", checkpoint}, {"d2", checkpoint}, {"d3", checkpoint}, {"d4", checkpoint.Add(time.Second)}}},
+	}}
+	streamer := NewStreamer(&Client{conn: conn})
+	defer streamer.Shutdown(context.Background())
+
+	var mu sync.Mutex
+	var handled []string
+	var checkpoints []Checkpoint
+	require.NoError(t, streamer.Start(StreamSpec{
+		Name:  "alerts",
+		Query: "SELECT * FROM alerts",
+		Handler: func(ctx context.Context, row map[string]interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, row["entity_id"].(string))
+			return nil
+		},
+		Checkpoint:     &checkpoint,
+		CheckpointRows: 2,
+		OnCheckpoint: func(checkpoint Checkpoint) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkpoints = append(checkpoints, checkpoint)
+		},
+	}))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 2
+	}, 5*time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"d3", "d4"}, handled, "the rows handled before the restart are skipped")
+	assert.Equal(t, []Checkpoint{{Time: checkpoint, Rows: 3}, {Time: checkpoint.Add(time.Second), Rows: 1}}, checkpoints)
+}
+
+func TestStreamerCountsHandlerErrors(t *testing.T) {
+	conn := &scriptedConn{script: []scriptedQuery{
+		{rows: [][]interface{}{{"d1", time.Now()}, {"d2", time.Now()}}},
+	}}
+	streamer := NewStreamer(&Client{conn: conn})
+	streamer.minBackoff = time.Millisecond
+	defer streamer.Shutdown(context.Background())
+
+	require.NoError(t, streamer.Start(StreamSpec{
+		Name:  "alerts",
+		Query: "SELECT * FROM alerts",
+		Handler: func(ctx context.Context, row map[string]interface{}) error {
+			if row["entity_id"] == "d1" {
+				return errors.New("queue full")
+			}
+			return nil
+		},
+	}))
+
+	// A query that ends without an error is resumed too
+	require.Eventually(t, func() bool { return len(conn.recorded()) == 2 }, 5*time.Second, time.Millisecond)
+	status, _ := streamer.StreamStatus("alerts")
+	assert.Equal(t, int64(2), status.Rows)
+	assert.Equal(t, int64(1), status.HandlerErrors)
+	assert.Equal(t, "streaming query ended", status.LastError)
+}
+
+func TestStreamerHoldsCheckpointAfterHandlerError(t *testing.T) {
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &scriptedConn{script: []scriptedQuery{
+		{rows: [][]interface{}{{"d1", first}, {"d2", first.Add(time.Second)}, {"d3", first.Add(2 * time.Second)}}, err: errors.New("EOF")},
+	}}
+	streamer := NewStreamer(&Client{conn: conn})
+	streamer.minBackoff = time.Millisecond
+	streamer.retryBackoff = time.Hour
+	defer streamer.Shutdown(context.Background())
+
+	var mu sync.Mutex
+	var checkpoints []Checkpoint
+	require.NoError(t, streamer.Start(StreamSpec{
+		Name:  "alerts",
+		Query: "SELECT * FROM alerts",
+		Handler: func(ctx context.Context, row map[string]interface{}) error {
+			if row["entity_id"] == "d2" {
+				return errors.New("queue full")
+			}
+			return nil
+		},
+		OnCheckpoint: func(checkpoint Checkpoint) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkpoints = append(checkpoints, checkpoint)
+		},
+	}))
+
+	// The query resumes before the failed row, so it is handled again
+	require.Eventually(t, func() bool { return len(conn.recorded()) == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "SELECT * FROM alerts SETTINGS seek_to='2026-01-02 03:04:05.000'", conn.recorded()[1])
+	mu.Lock()
+	assert.Equal(t, []Checkpoint{{Time: first, Rows: 1}}, checkpoints)
+	mu.Unlock()
+	status, _ := streamer.StreamStatus("alerts")
+	assert.Zero(t, status.Retrying, "rows read again aren't retried on their own")
+}
+
+func TestStreamerRetriesFailedRows(t *testing.T) {
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	run := func(t *testing.T, failures int) (StreamStatus, []Checkpoint) {
+		conn := &scriptedConn{script: []scriptedQuery{
+			{rows: [][]interface{}{{"d1", first}, {"d2", first.Add(time.Second)}, {"d3", first.Add(2 * time.Second)}}},
+		}}
+		streamer := NewStreamer(&Client{conn: conn})
+		streamer.retryAttempts = 3
+		streamer.retryBackoff = time.Millisecond
+		defer streamer.Shutdown(context.Background())
+
+		var mu sync.Mutex
+		var checkpoints []Checkpoint
+		calls := 0
+		require.NoError(t, streamer.Start(StreamSpec{
+			Name:  "alerts",
+			Query: "SELECT * FROM alerts",
+			Handler: func(ctx context.Context, row map[string]interface{}) error {
+				if row["entity_id"] != "d2" {
+					return nil
+				}
+				calls++
+				if calls <= failures {
+					return errors.New("queue full")
+				}
+				return nil
+			},
+			OnCheckpoint: func(checkpoint Checkpoint) {
+				mu.Lock()
+				defer mu.Unlock()
+				checkpoints = append(checkpoints, checkpoint)
+			},
+		}))
+
+		require.Eventually(t, func() bool {
+			status, _ := streamer.StreamStatus("alerts")
+			return status.Rows == 3 && status.Retrying == 0
+		}, 5*time.Second, time.Millisecond)
+		require.Len(t, conn.recorded(), 1, "failed rows are retried without restarting the query")
+		status, _ := streamer.StreamStatus("alerts")
+		mu.Lock()
+		defer mu.Unlock()
+		return status, append([]Checkpoint(nil), checkpoints...)
+	}
+
+	// The checkpoint holds before the failed row until a retry handles it
+	status, checkpoints := run(t, 2)
+	assert.Equal(t, []Checkpoint{{Time: first, Rows: 1}, {Time: first.Add(2 * time.Second), Rows: 1}}, checkpoints)
+	assert.Equal(t, int64(2), status.HandlerErrors)
+	assert.Zero(t, status.GivenUp)
+
+	// A row failing every attempt is given up on, releasing the checkpoint
+	status, checkpoints = run(t, 100)
+	assert.Equal(t, []Checkpoint{{Time: first, Rows: 1}, {Time: first.Add(2 * time.Second), Rows: 1}}, checkpoints)
+	assert.Equal(t, int64(3), status.HandlerErrors)
+	assert.Equal(t, int64(1), status.GivenUp)
+}
+
+func TestStreamerStartAndStop(t *testing.T) {
+	streamer := NewStreamer(&Client{conn: &scriptedConn{}})
+	handler := func(ctx context.Context, row map[string]interface{}) error { return nil }
+
+	require.NoError(t, streamer.Start(StreamSpec{Name: "a", Query: "SELECT * FROM a", Handler: handler}))
+	assert.ErrorIs(t, streamer.Start(StreamSpec{Name: "a", Query: "SELECT * FROM a", Handler: handler}), ErrStreamExists)
+	assert.Error(t, streamer.Start(StreamSpec{Name: "b"}))
+	require.Len(t, streamer.Status(), 1)
+
+	assert.True(t, streamer.Stop("a"))
+	assert.False(t, streamer.Stop("a"))
+	assert.Empty(t, streamer.Status())
+
+	require.NoError(t, streamer.Shutdown(context.Background()))
+	assert.ErrorIs(t, streamer.Start(StreamSpec{Name: "a", Query: "SELECT * FROM a", Handler: handler}), ErrStreamerClosed)
+}
@@ -0,0 +1,60 @@
+package timeplus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+)
+
+// ErrStreamIdle is returned when a streaming query is ended for going without rows for longer
+// than the stream idle timeout
+var ErrStreamIdle = errors.New("streaming query was idle")
+
+// Timeouts bound how long each class of Timeplus operation may take. A zero timeout leaves the
+// operations bounded by their caller's context only.
+type Timeouts struct {
+	DDL    time.Duration // Each statement creating or dropping a stream or view
+	Query  time.Duration // Each attempt of a bounded query, including existence checks and listings
+	Insert time.Duration // Each attempt of an insert
+	// Longest a streaming query may go without a row before it is ended with ErrStreamIdle, so a
+	// connection that silently stopped delivering is noticed. Zero lets streams stay quiet forever.
+	StreamIdle time.Duration
+}
+
+// DefaultTimeouts returns the timeouts clients use unless configured otherwise
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		DDL:    60 * time.Second,
+		Query:  15 * time.Second,
+		Insert: 15 * time.Second,
+	}
+}
+
+// timeoutsFromConfig returns the configured timeouts, in seconds. Unset DDL, query and insert
+// timeouts take their defaults; an unset stream idle timeout leaves streams quiet forever.
+func timeoutsFromConfig(cfg config.TimeoutsConfig) Timeouts {
+	timeouts := DefaultTimeouts()
+	if cfg.DDL > 0 {
+		timeouts.DDL = time.Duration(cfg.DDL) * time.Second
+	}
+	if cfg.Query > 0 {
+		timeouts.Query = time.Duration(cfg.Query) * time.Second
+	}
+	if cfg.Insert > 0 {
+		timeouts.Insert = time.Duration(cfg.Insert) * time.Second
+	}
+	if cfg.StreamIdle > 0 {
+		timeouts.StreamIdle = time.Duration(cfg.StreamIdle) * time.Second
+	}
+	return timeouts
+}
+
+// withTimeout derives a context bounded by timeout, or only by ctx when timeout is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,32 @@
+package timeplus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/timeplus-io/tp-alert-gateway/pkg/config"
+)
+
+func TestTimeoutsFromConfig(t *testing.T) {
+	assert.Equal(t, DefaultTimeouts(), timeoutsFromConfig(config.TimeoutsConfig{}))
+
+	timeouts := timeoutsFromConfig(config.TimeoutsConfig{DDL: 120, Query: 5, Insert: 3, StreamIdle: 600})
+	assert.Equal(t, Timeouts{DDL: 2 * time.Minute, Query: 5 * time.Second, Insert: 3 * time.Second, StreamIdle: 10 * time.Minute}, timeouts)
+}
+
+func TestStreamQueryIdleTimeout(t *testing.T) {
+	client := &Client{conn: &scriptedConn{}, timeouts: Timeouts{StreamIdle: 20 * time.Millisecond}}
+	err := client.StreamQuery(context.Background(), "SELECT entity_id, _tp_time FROM alerts", func(row interface{}) {})
+	assert.ErrorIs(t, err, ErrStreamIdle)
+
+	// Without an idle timeout only the caller ends the query
+	client.timeouts.StreamIdle = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.StreamQuery(ctx, "SELECT entity_id, _tp_time FROM alerts", func(row interface{}) {})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrStreamIdle)
+}
@@ -0,0 +1,20 @@
+package timeplus
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateTimeLayout is the layout of datetime64(3) literals
+const DateTimeLayout = "2006-01-02 15:04:05.000"
+
+// FormatDateTime formats t as a UTC datetime64(3) literal, without quotes
+func FormatDateTime(t time.Time) string {
+	return t.UTC().Format(DateTimeLayout)
+}
+
+// DateTime64 returns a SQL expression for t that Timeplus reads as UTC whatever the server or
+// column timezone, for inserts and time filters
+func DateTime64(t time.Time) string {
+	return fmt.Sprintf("to_datetime64('%s', 3, 'UTC')", FormatDateTime(t))
+}
@@ -0,0 +1,15 @@
+package timeplus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateTime64IsUTC(t *testing.T) {
+	berlin := time.Date(2026, 3, 29, 3, 30, 0, 125e6, time.FixedZone("CEST", 2*3600))
+
+	assert.Equal(t, "2026-03-29 01:30:00.125", FormatDateTime(berlin))
+	assert.Equal(t, "to_datetime64('2026-03-29 01:30:00.125', 3, 'UTC')", DateTime64(berlin))
+}
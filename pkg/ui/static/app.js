@@ -0,0 +1,188 @@
+// Dashboard of the alert gateway: rules, active alerts and live updates from /api/alerts/events
+(function () {
+  "use strict";
+
+  var REFRESH_INTERVAL = 30000; // Picks up acknowledgements made elsewhere
+  var alerts = {};
+  var rules = {};
+
+  var userInput = document.getElementById("user");
+  userInput.value = localStorage.getItem("acknowledgedBy") || "";
+  userInput.addEventListener("change", function () {
+    localStorage.setItem("acknowledgedBy", userInput.value.trim());
+  });
+
+  function request(method, path, body) {
+    var options = { method: method, headers: {} };
+    if (body !== undefined) {
+      options.headers["Content-Type"] = "application/json";
+      options.body = JSON.stringify(body);
+    }
+    return fetch(path, options).then(function (resp) {
+      return resp.json().catch(function () { return {}; }).then(function (data) {
+        if (!resp.ok) {
+          var message = data.error && data.error.message;
+          throw new Error(message || resp.status + " " + resp.statusText);
+        }
+        return data;
+      });
+    });
+  }
+
+  function showError(err) {
+    var el = document.getElementById("error");
+    el.textContent = err.message || String(err);
+    el.hidden = false;
+    clearTimeout(showError.timer);
+    showError.timer = setTimeout(function () { el.hidden = true; }, 5000);
+  }
+
+  function cell(row, content) {
+    var td = document.createElement("td");
+    if (content instanceof Node) {
+      td.appendChild(content);
+    } else {
+      td.textContent = content == null ? "" : content;
+    }
+    row.appendChild(td);
+    return td;
+  }
+
+  function badge(text, kind) {
+    var span = document.createElement("span");
+    span.className = "badge " + kind + "-" + text;
+    span.textContent = text;
+    return span;
+  }
+
+  function formatTime(value) {
+    return value ? new Date(value).toLocaleString() : "";
+  }
+
+  function renderAlerts(highlight) {
+    var body = document.getElementById("alerts");
+    body.innerHTML = "";
+    var active = Object.keys(alerts).map(function (id) { return alerts[id]; })
+      .filter(function (alert) { return !alert.acknowledged; })
+      .sort(function (a, b) { return new Date(b.triggeredAt) - new Date(a.triggeredAt); });
+
+    active.forEach(function (alert) {
+      var row = document.createElement("tr");
+      if (alert.id === highlight) {
+        row.className = "new";
+      }
+      cell(row, badge(alert.severity || "unknown", "severity"));
+      cell(row, alert.ruleName || alert.ruleId);
+      cell(row, alert.summary || alert.id);
+      cell(row, formatTime(alert.triggeredAt));
+      cell(row, alert.slaStatus ? badge(alert.slaStatus, "sla") : "");
+
+      var button = document.createElement("button");
+      button.textContent = "Acknowledge";
+      button.addEventListener("click", function () { acknowledge(alert, button); });
+      cell(row, button);
+      body.appendChild(row);
+    });
+
+    document.getElementById("alert-count").textContent = "(" + active.length + ")";
+    document.getElementById("no-alerts").hidden = active.length > 0;
+  }
+
+  function renderRules() {
+    var body = document.getElementById("rules");
+    body.innerHTML = "";
+    var list = Object.keys(rules).map(function (id) { return rules[id]; })
+      .sort(function (a, b) { return a.name.localeCompare(b.name); });
+
+    list.forEach(function (rule) {
+      var row = document.createElement("tr");
+      cell(row, rule.name);
+      var status = cell(row, badge(rule.status, "status"));
+      if (rule.lastError) {
+        status.title = rule.lastError;
+      }
+      cell(row, badge(rule.severity, "severity"));
+      cell(row, [rule.owner, rule.team].filter(Boolean).join(" / "));
+      cell(row, formatTime(rule.lastTriggeredAt));
+      body.appendChild(row);
+    });
+
+    document.getElementById("rule-count").textContent = "(" + list.length + ")";
+    document.getElementById("no-rules").hidden = list.length > 0;
+  }
+
+  function refresh() {
+    request("GET", "/api/rules").then(function (data) {
+      rules = {};
+      (data || []).forEach(function (rule) { rules[rule.id] = rule; });
+      renderRules();
+    }).catch(showError);
+
+    request("GET", "/api/alerts").then(function (data) {
+      alerts = {};
+      (data || []).forEach(function (alert) { alerts[alert.id] = alert; });
+      renderAlerts();
+    }).catch(showError);
+  }
+
+  function acknowledge(alert, button) {
+    var user = userInput.value.trim();
+    if (!user) {
+      userInput.focus();
+      showError(new Error("Enter your name to acknowledge alerts"));
+      return;
+    }
+    button.disabled = true;
+    request("POST", "/api/alerts/" + encodeURIComponent(alert.id) + "/acknowledge", { acknowledged_by: user })
+      .then(function () {
+        alert.acknowledged = true;
+        renderAlerts();
+      })
+      .catch(function (err) {
+        button.disabled = false;
+        showError(err);
+      });
+  }
+
+  function connect() {
+    var live = document.getElementById("live");
+    if (!window.EventSource) {
+      live.textContent = "polling";
+      return;
+    }
+
+    var source = new EventSource("/api/alerts/events");
+    source.onopen = function () {
+      live.textContent = "live";
+      live.className = "live connected";
+    };
+    source.onerror = function () {
+      // EventSource reconnects by itself
+      live.textContent = "reconnecting";
+      live.className = "live disconnected";
+    };
+
+    // State changes carry the alert's new acknowledged flag, so acknowledged, snoozed and resolved
+    // alerts leave the list and reopened ones come back
+    ["fired", "escalated", "acknowledged", "snoozed", "resolved", "reopened"].forEach(function (type) {
+      source.addEventListener(type, function (message) {
+        var event = JSON.parse(message.data);
+        if (!event.alert) {
+          return;
+        }
+        alerts[event.alert.id] = event.alert;
+        renderAlerts(event.alert.id);
+
+        var rule = rules[event.alert.ruleId];
+        if (rule && type === "fired") {
+          rule.lastTriggeredAt = event.alert.triggeredAt;
+          renderRules();
+        }
+      });
+    });
+  }
+
+  refresh();
+  setInterval(refresh, REFRESH_INTERVAL);
+  connect();
+})();
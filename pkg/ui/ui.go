@@ -0,0 +1,30 @@
+// Package ui serves the built-in web dashboard: rules with their status, active alerts with
+// acknowledge buttons, and live updates from the alert feed
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard. A non-empty dir serves a custom UI build from disk instead.
+func Handler(dir string) http.Handler {
+	if dir != "" {
+		return http.FileServer(http.Dir(dir))
+	}
+	return http.FileServer(http.FS(Files()))
+}
+
+// Files returns the files of the built-in dashboard
+func Files() fs.FS {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The directory is embedded at build time, so it is always there
+		panic(err)
+	}
+	return files
+}